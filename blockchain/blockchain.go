@@ -15,7 +15,6 @@ import (
 	"sync/atomic"
 
 	"github.com/boltdb/bolt"
-	"github.com/dgraph-io/badger"
 	"github.com/facebookgo/clock"
 	"github.com/pkg/errors"
 
@@ -318,7 +317,7 @@ func (bc *blockchain) Start(ctx context.Context) (err error) {
 	if bc.tipHeight == 0 {
 		_, err = bc.getBlockByHeight(0)
 		// TODO: Need to unify the NotFound error no matter which db is used
-		if errors.Cause(err) == bolt.ErrBucketNotFound || errors.Cause(err) == badger.ErrKeyNotFound {
+		if errors.Cause(err) == bolt.ErrBucketNotFound || errors.Cause(err) == db.ErrNotExist {
 			return bc.startEmptyBlockchain()
 		}
 		if err != nil {
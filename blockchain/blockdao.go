@@ -90,7 +90,7 @@ func (dao *blockDAO) Start(ctx context.Context) error {
 	// set init height value
 	if err := dao.kvstore.PutIfNotExists(blockNS, topHeightKey, make([]byte, 8)); err != nil {
 		// ok on none-fresh db
-		if err == db.ErrAlreadyExist {
+		if errors.Cause(err) == db.ErrAlreadyExist {
 			return nil
 		}
 
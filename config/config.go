@@ -155,8 +155,13 @@ var (
 			StartSubChainInterval: 10 * time.Second,
 		},
 		DB: DB{
-			UseBadgerDB: false,
-			NumRetries:  3,
+			UseBadgerDB:      false,
+			NumRetries:       3,
+			AllowTruncate:    false,
+			OpenRetries:      0,
+			OpenRetryBackoff: 100 * time.Millisecond,
+			MaxBatchEntries:  1000000,
+			MaxBatchBytes:    256 * 1024 * 1024,
 		},
 	}
 
@@ -317,6 +322,20 @@ type (
 		UseBadgerDB bool `yaml:"useBadgerDB"`
 		// NumRetries is the number of retries
 		NumRetries uint8 `yaml:"numRetries"`
+		// AllowTruncate allows BadgerDB to truncate the corrupted tail of value log on open, which loses the data
+		// in the tail. Otherwise opening a corrupted DB fails
+		AllowTruncate bool `yaml:"allowTruncate"`
+		// OpenRetries is the number of retries of opening the DB on start upon a transient filesystem error, e.g. a
+		// stale NFS file handle
+		OpenRetries uint8 `yaml:"openRetries"`
+		// OpenRetryBackoff is the wait before the first retry of opening the DB, doubled before each next retry
+		OpenRetryBackoff time.Duration `yaml:"openRetryBackoff"`
+		// MaxBatchEntries is the number of entries a batch created with db.WithBatchLimits is limited to, 0 means
+		// unlimited
+		MaxBatchEntries int `yaml:"maxBatchEntries"`
+		// MaxBatchBytes is the total length of namespaces, keys and values a batch created with db.WithBatchLimits is
+		// limited to, 0 means unlimited
+		MaxBatchBytes int `yaml:"maxBatchBytes"`
 
 		// RDS is the config for rds
 		RDS RDS `yaml:"RDS"`
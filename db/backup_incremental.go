@@ -0,0 +1,222 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// incrementMagic starts an incremental backup, and tells its format version
+var incrementMagic = []byte("KVINCR01")
+
+const (
+	// incrementTagEnd, incrementTagPut and incrementTagDelete tag the end of the increment, a record written and a
+	// record deleted
+	incrementTagEnd = iota
+	incrementTagPut
+	incrementTagDelete
+)
+
+// IncrementalBackuper is the interface of KV store which is able to back up the changes made by the commits after a
+// sequence, so that a chain of increments is taken at the cost of the changes rather than of the whole DB
+type IncrementalBackuper interface {
+	// IncrementalBackup writes to w the records changed by the commits after the sequence, and returns the sequence
+	// of the last commit, which the next increment of the chain is taken after. The first increment of a chain is
+	// taken after sequence 0, and holds every record written so far. RestoreIncremental applies a chain of increments.
+	//
+	// The increment starts with the magic "KVINCR01", followed by the big-endian sequence it is taken after and the
+	// one it is taken up to, each record changed as the tag 1, its namespace, key and value if it exists, or the tag 2,
+	// its namespace and key if it is deleted, and the tag 0 ending the increment along with the big-endian CRC-32 of
+	// all bytes before it. The tags are bytes, and the names, keys and values are prefixed with their length as uvarint
+	IncrementalBackup(io.Writer, uint64) (uint64, error)
+}
+
+// IncrementalBackup writes the records changed by the commits of the audit log after the sequence, as they are now.
+// The commits are held off while the increment is taken, so that it is as of the last commit. It returns
+// ErrSequencePruned if a commit after the sequence is trimmed from the audit log, so the audit log must keep the
+// commits since the last increment, or all commits for the first one
+func (s *auditKVStore) IncrementalBackup(w io.Writer, since uint64) (uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	last := s.next - 1
+	if since > last {
+		return 0, errors.Wrapf(ErrInvalidDB, "commit %d is not made yet", since)
+	}
+	if since+1 < s.oldest {
+		return 0, errors.Wrapf(ErrSequencePruned, "commit %d is trimmed from the audit log", since+1)
+	}
+	records, err := s.records(since + 1)
+	if err != nil {
+		return 0, err
+	}
+
+	// each record changed is backed up once, in order of namespace and key
+	changed := make(map[string]map[string]struct{})
+	for _, record := range records {
+		for _, m := range record.Mutations {
+			if changed[m.Namespace] == nil {
+				changed[m.Namespace] = make(map[string]struct{})
+			}
+			changed[m.Namespace][string(m.Key)] = struct{}{}
+		}
+	}
+	namespaces := make([]string, 0, len(changed))
+	for namespace := range changed {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	e := newIncrementEncoder(w, since, last)
+	for _, namespace := range namespaces {
+		keys := make([]string, 0, len(changed[namespace]))
+		for key := range changed[namespace] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value, err := s.kvStore.Get(namespace, []byte(key))
+			switch {
+			case err == nil:
+				e.write([]byte{incrementTagPut})
+				e.writeBytes([]byte(namespace))
+				e.writeBytes([]byte(key))
+				e.writeBytes(value)
+			case isNotExist(err):
+				e.write([]byte{incrementTagDelete})
+				e.writeBytes([]byte(namespace))
+				e.writeBytes([]byte(key))
+			default:
+				return 0, errors.Wrapf(err, "failed to get key = %x", key)
+			}
+			// the error of the writer so far stops the backup early
+			if _, err := e.w.Write(nil); err != nil {
+				return 0, errors.Wrap(err, "failed to write incremental backup")
+			}
+		}
+	}
+	if err := e.close(); err != nil {
+		return 0, errors.Wrap(err, "failed to write incremental backup")
+	}
+	return last, nil
+}
+
+// RestoreIncremental applies a chain of increments taken by IncrementalBackuper.IncrementalBackup to the KV store,
+// which is restored up to the sequence given, 0 for an empty KV store, and returns the sequence it is restored up to
+// afterwards. Each increment must be taken after the sequence the increment before it is taken up to, otherwise the
+// chain misses a link and ErrInvalidDB is returned. An increment is checked against its CRC-32 before it is applied,
+// and applied in one commit, so a failure leaves the KV store restored up to the increment before, whose sequence is
+// returned along with the error
+func RestoreIncremental(kvStore KVStore, seq uint64, increments ...io.Reader) (uint64, error) {
+	for _, r := range increments {
+		d := &snapshotDecoder{r: bufio.NewReader(r), crc: crc32.NewIEEE()}
+		header := make([]byte, len(incrementMagic)+16)
+		if err := d.read(header); err != nil || !bytes.Equal(header[:len(incrementMagic)], incrementMagic) {
+			return seq, errors.Wrap(ErrInvalidDB, "not an incremental backup")
+		}
+		since := binary.BigEndian.Uint64(header[len(incrementMagic):])
+		last := binary.BigEndian.Uint64(header[len(incrementMagic)+8:])
+		if since != seq {
+			return seq, errors.Wrapf(
+				ErrInvalidDB,
+				"missing link in the chain of increments: increment after commit %d applied to a restore up to commit %d",
+				since,
+				seq,
+			)
+		}
+		batch, namespaces, err := decodeIncrement(d)
+		if err != nil {
+			return seq, err
+		}
+		for _, namespace := range namespaces {
+			if err := createReservedNamespace(kvStore, namespace); err != nil {
+				return seq, errors.Wrapf(err, "failed to create namespace %s", namespace)
+			}
+		}
+		if err := kvStore.Commit(batch); err != nil {
+			return seq, errors.Wrapf(err, "failed to restore increment after commit %d", since)
+		}
+		seq = last
+	}
+	return seq, nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// newIncrementEncoder returns an encoder writing an increment to w, which starts with the magic and the sequences
+// it is taken after and up to
+func newIncrementEncoder(w io.Writer, since, last uint64) *snapshotEncoder {
+	e := &snapshotEncoder{
+		w:   bufio.NewWriter(w),
+		crc: crc32.NewIEEE(),
+		n:   make([]byte, binary.MaxVarintLen64),
+	}
+	header := make([]byte, len(incrementMagic)+16)
+	copy(header, incrementMagic)
+	binary.BigEndian.PutUint64(header[len(incrementMagic):], since)
+	binary.BigEndian.PutUint64(header[len(incrementMagic)+8:], last)
+	e.write(header)
+	return e
+}
+
+// decodeIncrement reads the records of an increment into a batch along with the namespaces they belong to, and checks
+// the CRC-32 of the increment at its end
+func decodeIncrement(d *snapshotDecoder) (KVStoreBatch, []string, error) {
+	batch := NewBatch()
+	var namespaces []string
+	for {
+		tag, err := d.readByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		switch tag {
+		case incrementTagPut, incrementTagDelete:
+			namespace, err := d.readBytes()
+			if err != nil {
+				return nil, nil, err
+			}
+			// the records are in order of namespace
+			if len(namespaces) == 0 || namespaces[len(namespaces)-1] != string(namespace) {
+				namespaces = append(namespaces, string(namespace))
+			}
+			key, err := d.readBytes()
+			if err != nil {
+				return nil, nil, err
+			}
+			if tag == incrementTagDelete {
+				batch.Delete(string(namespace), key, "failed to restore key = %x", key)
+				continue
+			}
+			value, err := d.readBytes()
+			if err != nil {
+				return nil, nil, err
+			}
+			batch.Put(string(namespace), key, value, "failed to restore key = %x", key)
+		case incrementTagEnd:
+			sum := d.crc.Sum32()
+			crc := make([]byte, 4)
+			if _, err := io.ReadFull(d.r, crc); err != nil {
+				return nil, nil, errors.Wrap(ErrInvalidDB, "malformed incremental backup: cut short")
+			}
+			if binary.BigEndian.Uint32(crc) != sum {
+				return nil, nil, errors.Wrap(ErrChecksumMismatch, "incremental backup")
+			}
+			return batch, namespaces, nil
+		default:
+			return nil, nil, errors.Wrapf(ErrInvalidDB, "malformed incremental backup: unknown tag %d", tag)
+		}
+	}
+}
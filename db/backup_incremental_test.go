@@ -0,0 +1,185 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestIncrementalBackup(t *testing.T) {
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key-%03d", i)) }
+
+	testBackup := func(newKVStore func(...KVStoreOption) KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		kvStore := newKVStore(WithAuditLog(0, false))
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		backuper := kvStore.(IncrementalBackuper)
+		requireRestored := func(restored KVStore) {
+			for i := 0; i < 60; i++ {
+				value, err := kvStore.Get(bucket1, key(i))
+				restoredValue, restoredErr := restored.Get(bucket1, key(i))
+				require.Equal(isNotExist(err), isNotExist(restoredErr))
+				require.Equal(value, restoredValue)
+			}
+			for _, k := range testK2[:2] {
+				value, err := kvStore.Get(bucket2, k)
+				restoredValue, restoredErr := restored.Get(bucket2, k)
+				require.Equal(isNotExist(err), isNotExist(restoredErr))
+				require.Equal(value, restoredValue)
+			}
+		}
+
+		// the base backup holds the records written so far
+		for i := 0; i < 50; i++ {
+			require.NoError(kvStore.Put(bucket1, key(i), testV1[i%3]))
+		}
+		require.NoError(kvStore.Put(bucket2, testK2[0], testV2[0]))
+		var base bytes.Buffer
+		seq, err := backuper.IncrementalBackup(&base, 0)
+		require.NoError(err)
+		require.Equal(uint64(51), seq)
+
+		// the increments hold the records changed since, deleted ones included
+		batch := NewBatch()
+		for i := 40; i < 60; i++ {
+			batch.Put(bucket1, key(i), testV2[i%3], "")
+		}
+		batch.Delete(bucket2, testK2[0], "")
+		require.NoError(kvStore.Commit(batch))
+		var increment1 bytes.Buffer
+		seq1, err := backuper.IncrementalBackup(&increment1, seq)
+		require.NoError(err)
+		require.Equal(seq+1, seq1)
+		require.True(increment1.Len() < base.Len())
+
+		require.NoError(kvStore.Delete(bucket1, key(0)))
+		require.NoError(kvStore.Put(bucket2, testK2[1], []byte{}))
+		require.NoError(kvStore.Put(bucket1, key(0), testV1[1]))
+		require.NoError(kvStore.Delete(bucket1, key(1)))
+		var increment2 bytes.Buffer
+		seq2, err := backuper.IncrementalBackup(&increment2, seq1)
+		require.NoError(err)
+		require.Equal(seq1+4, seq2)
+
+		// no commit since the last increment makes an empty one
+		var empty bytes.Buffer
+		seq3, err := backuper.IncrementalBackup(&empty, seq2)
+		require.NoError(err)
+		require.Equal(seq2, seq3)
+
+		// the chain restores a KV store identical to the one backed up
+		restored := NewMemKVStore()
+		last, err := RestoreIncremental(
+			restored,
+			0,
+			bytes.NewReader(base.Bytes()),
+			bytes.NewReader(increment1.Bytes()),
+			bytes.NewReader(increment2.Bytes()),
+			bytes.NewReader(empty.Bytes()),
+		)
+		require.NoError(err)
+		require.Equal(seq2, last)
+		requireRestored(restored)
+		_, err = restored.Get(bucket1, key(1))
+		require.Equal(ErrNotExist, errors.Cause(err))
+		value, err := restored.Get(bucket2, testK2[1])
+		require.NoError(err)
+		require.Equal([]byte{}, value)
+
+		// the chain is restored a link at a time as well
+		restored = NewMemKVStore()
+		last, err = RestoreIncremental(restored, 0, bytes.NewReader(base.Bytes()))
+		require.NoError(err)
+		last, err = RestoreIncremental(restored, last, bytes.NewReader(increment1.Bytes()),
+			bytes.NewReader(increment2.Bytes()))
+		require.NoError(err)
+		require.Equal(seq2, last)
+		requireRestored(restored)
+
+		// a missing link stops the restore at the increment before it
+		restored = NewMemKVStore()
+		last, err = RestoreIncremental(restored, 0, bytes.NewReader(base.Bytes()), bytes.NewReader(increment2.Bytes()))
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+		require.Equal(seq, last)
+		value, err = restored.Get(bucket1, key(0))
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+		_, err = RestoreIncremental(NewMemKVStore(), 0, bytes.NewReader(increment1.Bytes()))
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+
+		// a corrupted increment is not applied
+		corrupted := append([]byte(nil), increment1.Bytes()...)
+		corrupted[len(corrupted)/2] ^= 0x01
+		restored = NewMemKVStore()
+		last, err = RestoreIncremental(restored, 0, bytes.NewReader(base.Bytes()), bytes.NewReader(corrupted))
+		require.Error(err)
+		require.Contains([]error{ErrChecksumMismatch, ErrInvalidDB}, errors.Cause(err))
+		require.Equal(seq, last)
+		value, err = restored.Get(bucket1, key(45))
+		require.NoError(err)
+		require.Equal(testV1[45%3], value)
+		_, err = RestoreIncremental(NewMemKVStore(), 0, bytes.NewReader([]byte("not an increment")))
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+
+		// an increment after a commit not made yet is rejected
+		_, err = backuper.IncrementalBackup(&bytes.Buffer{}, seq2+1)
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testBackup(func(opts ...KVStoreOption) KVStore { return NewMemKVStore(opts...) }, t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-incremental-backup.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testBackup(func(opts ...KVStoreOption) KVStore { return NewOnDiskDB(dbCfg, opts...) }, t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-incremental-backup.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testBackup(func(opts ...KVStoreOption) KVStore { return NewOnDiskDB(dbCfg, opts...) }, t)
+	})
+
+	t.Run("Pruned audit log", func(t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		kvStore := NewMemKVStore(WithAuditLog(2, false))
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		for i := 0; i < 5; i++ {
+			require.NoError(kvStore.Put(bucket1, key(i), testV1[0]))
+		}
+		backuper := kvStore.(IncrementalBackuper)
+		_, err := backuper.IncrementalBackup(&bytes.Buffer{}, 0)
+		require.Equal(ErrSequencePruned, errors.Cause(err))
+		_, err = backuper.IncrementalBackup(&bytes.Buffer{}, 3)
+		require.NoError(err)
+	})
+}
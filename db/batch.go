@@ -7,9 +7,11 @@
 package db
 
 import (
+	"encoding/binary"
 	"sync"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/iotexproject/iotex-core/pkg/hash"
 	"github.com/iotexproject/iotex-core/pkg/util/byteutil"
@@ -23,10 +25,13 @@ type (
 	// b.Put(bucket, k, v)
 	// b.PutIfNotExists(bucket, k, v)
 	// b.Delete(bucket, k, v)
+	// b.AddCounter(bucket, k, delta)
 	// once it's done, call KVStore interface's Commit() to persist to underlying DB
 	// KVStore.Commit(b)
 	// if commit succeeds, the batch is cleared
+	// and committing it again returns ErrBatchAlreadyCommitted, until new entries are staged or it is cleared
 	// otherwise the batch is kept intact (so batch user can figure out what’s wrong and attempt re-commit later)
+	// a batch created with WithBatchLimits rejects an entry beyond its limits with ErrBatchTooLarge and stays as is
 	KVStoreBatch interface {
 		// Lock locks the batch
 		Lock()
@@ -35,23 +40,38 @@ type (
 		// ClearAndUnlock clears the write queue and unlocks the batch
 		ClearAndUnlock()
 		// Put insert or update a record identified by (namespace, key)
-		Put(string, []byte, []byte, string, ...interface{})
+		Put(string, []byte, []byte, string, ...interface{}) error
 		// PutIfNotExists puts a record only if (namespace, key) doesn't exist, otherwise return ErrAlreadyExist
 		PutIfNotExists(string, []byte, []byte, string, ...interface{}) error
 		// Delete deletes a record by (namespace, key)
-		Delete(string, []byte, string, ...interface{})
+		Delete(string, []byte, string, ...interface{}) error
+		// AddCounter adds a delta to the 8-byte big-endian counter of (namespace, key) when the batch is committed, a
+		// missing record counting as 0
+		AddCounter(string, []byte, int64) error
 		// Size returns the size of batch
 		Size() int
+		// ByteSize returns the estimated memory footprint of the batch, which is the total length of namespaces, keys
+		// and values of all entries
+		ByteSize() int
 		// Entry returns the entry at the index
 		Entry(int) (*writeInfo, error)
 		// Clear clears entries staged in batch
 		Clear()
 		// CloneBatch clones the batch
 		CloneBatch() KVStoreBatch
+		// Merge appends a copy of the other batch's entries to the end of the batch
+		Merge(KVStoreBatch) error
+		// committed returns true if the batch has been committed, and not modified or cleared since
+		committed() bool
 		// batch puts an entry into the write queue
-		batch(op int32, namespace string, key, value []byte, errorFormat string, errorArgs ...interface{})
+		batch(op int32, namespace string, key, value []byte, errorFormat string, errorArgs ...interface{}) error
+		// admit returns ErrBatchTooLarge if the entry does not fit in the limits of the batch
+		admit(namespace string, key, value []byte) error
 	}
 
+	// BatchOption sets an option of the batch
+	BatchOption func(*baseKVStoreBatch)
+
 	// writeInfo is the struct to store Put/Delete operation info
 	writeInfo struct {
 		writeType   int32
@@ -66,6 +86,16 @@ type (
 	baseKVStoreBatch struct {
 		mutex      sync.RWMutex
 		writeQueue []writeInfo
+		// byteSize is the total length of namespaces, keys and values in writeQueue
+		byteSize int
+		// isCommitted is set once the batch is committed, until it is modified or cleared
+		isCommitted bool
+		// maxEntries and maxBytes are the limits of the number of entries and ByteSize, 0 means unlimited
+		maxEntries int
+		maxBytes   int
+		// reuseQueue keeps the room of writeQueue once the batch is emptied. It is only set for a batch allocating the
+		// write queue itself, as the one of newBatchOf is owned by its caller
+		reuseQueue bool
 	}
 
 	// CachedBatch derives from Batch interface
@@ -103,11 +133,85 @@ const (
 	Delete int32 = 1
 	// PutIfNotExists indicate the type of write operation to be PutIfNotExists
 	PutIfNotExists int32 = 2
+	// AddCounter indicate the type of write operation to be adding the delta in value to a counter
+	AddCounter int32 = 3
+)
+
+// counterSize is the length of a counter and of the delta of an AddCounter entry
+const counterSize = 8
+
+// pooledBatchMaxCapacity is the capacity of entries above which a released batch is not pooled, so that a batch grown
+// large once does not hold its memory in the pool
+const pooledBatchMaxCapacity = 1 << 16
+
+var batchPool = sync.Pool{
+	New: func() interface{} {
+		return &baseKVStoreBatch{}
+	},
+}
+
+var batchTooLargeMtc = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "iotex_db_batch_too_large",
+		Help: "Number of entries rejected by batches at their limits.",
+	},
 )
 
+func init() {
+	prometheus.MustRegister(batchTooLargeMtc)
+}
+
+// WithBatchLimits limits the batch to maxEntries entries and maxBytes of ByteSize, e.g. config.DB.MaxBatchEntries and
+// MaxBatchBytes, so that a batch growing without being committed fails early with ErrBatchTooLarge rather than runs
+// out of memory. 0 means unlimited, which is the default
+func WithBatchLimits(maxEntries, maxBytes int) BatchOption {
+	return func(b *baseKVStoreBatch) {
+		b.maxEntries = maxEntries
+		b.maxBytes = maxBytes
+	}
+}
+
 // NewBatch returns a batch
-func NewBatch() KVStoreBatch {
-	return &baseKVStoreBatch{}
+func NewBatch(opts ...BatchOption) KVStoreBatch {
+	b := &baseKVStoreBatch{}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// NewKVStoreBatchWithCapacity returns a batch with room for n entries, so that staging up to n entries does not grow
+// the write queue
+func NewKVStoreBatchWithCapacity(n int, opts ...BatchOption) KVStoreBatch {
+	b := &baseKVStoreBatch{writeQueue: make([]writeInfo, 0, n), reuseQueue: true}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// AcquireBatch returns a batch from the pool, or a new one if the pool is empty, emptied and reset to the options. It
+// reuses the room for entries of a batch released by ReleaseBatch, which saves the allocations of the write queue
+// when batches are staged and committed at a high rate, e.g. one per block
+func AcquireBatch(opts ...BatchOption) KVStoreBatch {
+	b := batchPool.Get().(*baseKVStoreBatch)
+	b.reset()
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// ReleaseBatch empties the batch and puts it back to the pool, dropping the references to the keys and values it
+// holds. The batch must not be used afterwards. Only a batch returned by NewBatch, NewKVStoreBatchWithCapacity or
+// AcquireBatch is pooled, others are left to the garbage collector
+func ReleaseBatch(batch KVStoreBatch) {
+	b, ok := batch.(*baseKVStoreBatch)
+	if !ok || cap(b.writeQueue) > pooledBatchMaxCapacity {
+		return
+	}
+	b.reset()
+	batchPool.Put(b)
 }
 
 // Lock locks the batch
@@ -123,29 +227,37 @@ func (b *baseKVStoreBatch) Unlock() {
 // ClearAndUnlock clears the write queue and unlocks the batch
 func (b *baseKVStoreBatch) ClearAndUnlock() {
 	defer b.mutex.Unlock()
-	b.writeQueue = nil
+	b.empty()
+	// ClearAndUnlock is called by the KV stores once the batch is committed
+	b.isCommitted = true
 }
 
 // Put inserts a <key, value> record
-func (b *baseKVStoreBatch) Put(namespace string, key, value []byte, errorFormat string, errorArgs ...interface{}) {
+func (b *baseKVStoreBatch) Put(namespace string, key, value []byte, errorFormat string, errorArgs ...interface{}) error {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
-	b.batch(Put, namespace, key, value, errorFormat, errorArgs)
+	return b.batch(Put, namespace, key, value, errorFormat, errorArgs)
 }
 
 // PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
 func (b *baseKVStoreBatch) PutIfNotExists(namespace string, key, value []byte, errorFormat string, errorArgs ...interface{}) error {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
-	b.batch(PutIfNotExists, namespace, key, value, errorFormat, errorArgs)
-	return nil
+	return b.batch(PutIfNotExists, namespace, key, value, errorFormat, errorArgs)
 }
 
 // Delete deletes a record
-func (b *baseKVStoreBatch) Delete(namespace string, key []byte, errorFormat string, errorArgs ...interface{}) {
+func (b *baseKVStoreBatch) Delete(namespace string, key []byte, errorFormat string, errorArgs ...interface{}) error {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
-	b.batch(Delete, namespace, key, nil, errorFormat, errorArgs)
+	return b.batch(Delete, namespace, key, nil, errorFormat, errorArgs)
+}
+
+// AddCounter adds a delta to the counter of a record, within the transaction committing the batch
+func (b *baseKVStoreBatch) AddCounter(namespace string, key []byte, delta int64) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.batch(AddCounter, namespace, key, counterDelta(delta), "")
 }
 
 // Size returns the size of batch
@@ -153,6 +265,11 @@ func (b *baseKVStoreBatch) Size() int {
 	return len(b.writeQueue)
 }
 
+// ByteSize returns the total length of namespaces, keys and values of all entries
+func (b *baseKVStoreBatch) ByteSize() int {
+	return b.byteSize
+}
+
 // Entry returns the entry at the index
 func (b *baseKVStoreBatch) Entry(index int) (*writeInfo, error) {
 	if index < 0 || index >= len(b.writeQueue) {
@@ -165,7 +282,8 @@ func (b *baseKVStoreBatch) Entry(index int) (*writeInfo, error) {
 func (b *baseKVStoreBatch) Clear() {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
-	b.writeQueue = nil
+	b.empty()
+	b.isCommitted = false
 }
 
 // CloneBatch clones the batch
@@ -175,14 +293,45 @@ func (b *baseKVStoreBatch) CloneBatch() KVStoreBatch {
 
 	c := baseKVStoreBatch{
 		writeQueue: make([]writeInfo, b.Size()),
+		byteSize:   b.byteSize,
+		maxEntries: b.maxEntries,
+		maxBytes:   b.maxBytes,
 	}
 	// clone the writeQueue
 	copy(c.writeQueue, b.writeQueue)
 	return &c
 }
 
+// Merge appends a copy of the other batch's entries to the end of the batch, in the order they were staged
+func (b *baseKVStoreBatch) Merge(other KVStoreBatch) error {
+	if other == KVStoreBatch(b) {
+		return errors.Wrap(ErrInvalidDB, "cannot merge a batch into itself")
+	}
+	entries, err := copyEntries(other)
+	if err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	byteSize := 0
+	for _, e := range entries {
+		byteSize += e.byteSize()
+	}
+	if err := b.checkLimits(len(entries), byteSize); err != nil {
+		return err
+	}
+	b.writeQueue = append(b.writeQueue, entries...)
+	b.byteSize += byteSize
+	b.isCommitted = false
+	return nil
+}
+
 // batch puts an entry into the write queue
-func (b *baseKVStoreBatch) batch(op int32, namespace string, key, value []byte, errorFormat string, errorArgs ...interface{}) {
+func (b *baseKVStoreBatch) batch(op int32, namespace string, key, value []byte, errorFormat string, errorArgs ...interface{}) error {
+	if err := b.admit(namespace, key, value); err != nil {
+		return err
+	}
 	b.writeQueue = append(
 		b.writeQueue,
 		writeInfo{
@@ -193,6 +342,44 @@ func (b *baseKVStoreBatch) batch(op int32, namespace string, key, value []byte,
 			errorFormat: errorFormat,
 			errorArgs:   errorArgs,
 		})
+	b.byteSize += b.writeQueue[len(b.writeQueue)-1].byteSize()
+	b.isCommitted = false
+	return nil
+}
+
+// reset empties the batch to be pooled, keeping the room for entries, and removes its limits
+func (b *baseKVStoreBatch) reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.reuseQueue = true
+	b.empty()
+	b.isCommitted = false
+	b.maxEntries = 0
+	b.maxBytes = 0
+}
+
+// empty drops the entries. The room of the write queue is kept if reuseQueue is set, with the entries zeroed so that
+// the keys and values are not referenced anymore
+func (b *baseKVStoreBatch) empty() {
+	if b.reuseQueue {
+		for i := range b.writeQueue {
+			b.writeQueue[i] = writeInfo{}
+		}
+		b.writeQueue = b.writeQueue[:0]
+	} else {
+		b.writeQueue = nil
+	}
+	b.byteSize = 0
+}
+
+// admit returns ErrBatchTooLarge if the entry does not fit in the limits of the batch
+func (b *baseKVStoreBatch) admit(namespace string, key, value []byte) error {
+	return b.checkLimits(1, len(namespace)+len(key)+len(value))
+}
+
+// committed returns true if the batch has been committed, and not modified or cleared since
+func (b *baseKVStoreBatch) committed() bool {
+	return b.isCommitted
 }
 
 //======================================
@@ -200,9 +387,9 @@ func (b *baseKVStoreBatch) batch(op int32, namespace string, key, value []byte,
 //======================================
 
 // NewCachedBatch returns a new cached batch buffer
-func NewCachedBatch() CachedBatch {
+func NewCachedBatch(opts ...BatchOption) CachedBatch {
 	return &cachedBatch{
-		KVStoreBatch: NewBatch(),
+		KVStoreBatch: NewBatch(opts...),
 		KVStoreCache: NewKVCache(),
 		snapshots:    make(map[int]CachedBatch),
 	}
@@ -222,7 +409,9 @@ func (cb *cachedBatch) Unlock() {
 func (cb *cachedBatch) ClearAndUnlock() {
 	defer cb.lock.Unlock()
 	cb.KVStoreCache.Clear()
-	cb.KVStoreBatch.Clear()
+	// mark the embedded batch committed as well
+	cb.KVStoreBatch.Lock()
+	cb.KVStoreBatch.ClearAndUnlock()
 	// clear all saved snapshots
 	cb.tag = 0
 	cb.snapshots = nil
@@ -230,34 +419,56 @@ func (cb *cachedBatch) ClearAndUnlock() {
 }
 
 // Put inserts a <key, value> record
-func (cb *cachedBatch) Put(namespace string, key, value []byte, errorFormat string, errorArgs ...interface{}) {
+func (cb *cachedBatch) Put(namespace string, key, value []byte, errorFormat string, errorArgs ...interface{}) error {
 	cb.lock.Lock()
 	defer cb.lock.Unlock()
+	if err := cb.admit(namespace, key, value); err != nil {
+		return err
+	}
 	h := cb.hash(namespace, key)
 	cb.Write(h, value)
-	cb.batch(Put, namespace, key, value, errorFormat, errorArgs)
+	return cb.batch(Put, namespace, key, value, errorFormat, errorArgs)
 }
 
 // PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
 func (cb *cachedBatch) PutIfNotExists(namespace string, key, value []byte, errorFormat string, errorArgs ...interface{}) error {
 	cb.lock.Lock()
 	defer cb.lock.Unlock()
+	if err := cb.admit(namespace, key, value); err != nil {
+		return err
+	}
 	// TODO: bug, this is not a valid check whether the instance exists
 	h := cb.hash(namespace, key)
 	if err := cb.WriteIfNotExist(h, value); err != nil {
 		return err
 	}
-	cb.batch(PutIfNotExists, namespace, key, value, errorFormat, errorArgs)
-	return nil
+	return cb.batch(PutIfNotExists, namespace, key, value, errorFormat, errorArgs)
 }
 
 // Delete deletes a record
-func (cb *cachedBatch) Delete(namespace string, key []byte, errorFormat string, errorArgs ...interface{}) {
+func (cb *cachedBatch) Delete(namespace string, key []byte, errorFormat string, errorArgs ...interface{}) error {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	if err := cb.admit(namespace, key, nil); err != nil {
+		return err
+	}
+	h := cb.hash(namespace, key)
+	cb.Evict(h)
+	return cb.batch(Delete, namespace, key, nil, errorFormat, errorArgs)
+}
+
+// AddCounter adds a delta to the counter of a record, whose value is evicted from the cache as it is unknown until
+// the batch is committed
+func (cb *cachedBatch) AddCounter(namespace string, key []byte, delta int64) error {
 	cb.lock.Lock()
 	defer cb.lock.Unlock()
+	value := counterDelta(delta)
+	if err := cb.admit(namespace, key, value); err != nil {
+		return err
+	}
 	h := cb.hash(namespace, key)
 	cb.Evict(h)
-	cb.batch(Delete, namespace, key, nil, errorFormat, errorArgs)
+	return cb.batch(AddCounter, namespace, key, value, "")
 }
 
 // Clear clear the cached batch buffer
@@ -272,6 +483,40 @@ func (cb *cachedBatch) Clear() {
 	cb.snapshots = make(map[int]CachedBatch)
 }
 
+// Merge appends a copy of the other batch's entries to the end of the batch, in the order they were staged
+func (cb *cachedBatch) Merge(other KVStoreBatch) error {
+	if other == KVStoreBatch(cb) {
+		return errors.Wrap(ErrInvalidDB, "cannot merge a batch into itself")
+	}
+	entries, err := copyEntries(other)
+	if err != nil {
+		return err
+	}
+
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	// apply the entries to a clone of the cache, so the cached batch is intact if any entry fails
+	cache := cb.KVStoreCache.Clone()
+	for _, e := range entries {
+		h := cb.hash(e.namespace, e.key)
+		switch e.writeType {
+		case Put:
+			cache.Write(h, e.value)
+		case PutIfNotExists:
+			if err := cache.WriteIfNotExist(h, e.value); err != nil {
+				return err
+			}
+		case Delete, AddCounter:
+			cache.Evict(h)
+		}
+	}
+	if err := cb.KVStoreBatch.Merge(&baseKVStoreBatch{writeQueue: entries}); err != nil {
+		return err
+	}
+	cb.KVStoreCache = cache
+	return nil
+}
+
 // Get retrieves a record
 func (cb *cachedBatch) Get(namespace string, key []byte) ([]byte, error) {
 	cb.lock.RLock()
@@ -308,6 +553,75 @@ func (cb *cachedBatch) Revert(snapshot int) error {
 //======================================
 // private functions
 //======================================
+
+// newBatchOf returns a batch of the entries
+func newBatchOf(entries []writeInfo) KVStoreBatch {
+	b := &baseKVStoreBatch{writeQueue: entries}
+	for _, e := range entries {
+		b.byteSize += e.byteSize()
+	}
+	return b
+}
+
+// checkLimits returns ErrBatchTooLarge if the batch would exceed its limits with more entries of byteSize bytes
+func (b *baseKVStoreBatch) checkLimits(entries, byteSize int) error {
+	if b.maxEntries > 0 && len(b.writeQueue)+entries > b.maxEntries {
+		batchTooLargeMtc.Add(float64(entries))
+		return errors.Wrapf(ErrBatchTooLarge, "batch of %d entries is limited to %d", len(b.writeQueue), b.maxEntries)
+	}
+	if b.maxBytes > 0 && b.byteSize+byteSize > b.maxBytes {
+		batchTooLargeMtc.Add(float64(entries))
+		return errors.Wrapf(ErrBatchTooLarge, "batch of %d bytes is limited to %d", b.byteSize, b.maxBytes)
+	}
+	return nil
+}
+
+// byteSize returns the total length of namespace, key and value of the entry
+func (w *writeInfo) byteSize() int {
+	return len(w.namespace) + len(w.key) + len(w.value)
+}
+
+// copyEntries returns a deep copy of the batch's entries
+func copyEntries(b KVStoreBatch) ([]writeInfo, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	entries := make([]writeInfo, b.Size())
+	for i := range entries {
+		e, err := b.Entry(i)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = *e
+		entries[i].key = make([]byte, len(e.key))
+		copy(entries[i].key, e.key)
+		if e.value != nil {
+			entries[i].value = make([]byte, len(e.value))
+			copy(entries[i].value, e.value)
+		}
+	}
+	return entries, nil
+}
+
+// counterDelta encodes the delta of an AddCounter entry
+func counterDelta(delta int64) []byte {
+	value := make([]byte, counterSize)
+	binary.BigEndian.PutUint64(value, uint64(delta))
+	return value
+}
+
+// addToCounter returns the counter with the delta of an AddCounter entry added, a nil counter being 0
+func addToCounter(counter, delta []byte) ([]byte, error) {
+	var n uint64
+	if counter != nil {
+		if len(counter) != counterSize {
+			return nil, errors.Wrapf(ErrInvalidDB, "counter of %d bytes", len(counter))
+		}
+		n = binary.BigEndian.Uint64(counter)
+	}
+	return counterDelta(int64(n + binary.BigEndian.Uint64(delta))), nil
+}
+
 func (cb *cachedBatch) hash(namespace string, key []byte) hash.CacheHash {
 	stream := hash.Hash160b([]byte(namespace))
 	stream = append(stream, key...)
@@ -0,0 +1,210 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// compactCompressed is the flag of a compact batch whose fields are compressed by DEFLATE
+const compactCompressed = 1 << 0
+
+// wire types of the fields of a compact batch, which are the same as those of protobuf
+const (
+	compactVarint = 0
+	compactBytes  = 2
+)
+
+// fields of a compact batch
+const (
+	// compactEntry is an entry of the batch, holding the fields of the entry
+	compactEntry = 1
+)
+
+// fields of an entry of a compact batch
+const (
+	// compactWriteType is the write type, which is Put if omitted
+	compactWriteType = 1
+	// compactNamespace is the namespace, which is the one of the previous entry if omitted
+	compactNamespace = 2
+	compactKey       = 3
+	// compactValue is the value, which is empty if omitted, or nil for a Delete
+	compactValue = 4
+)
+
+// SerializeCompact serializes the entries of the batch in a compact format, e.g. to be written to a WAL or sent to a
+// replica. The format is a byte of flags followed by a sequence of fields, each a varint tag of the field number and
+// wire type followed by a varint or bytes prefixed with their length, as protobuf does. Each entry is a field of its
+// own fields, and the fields of default values are omitted, so is the namespace of an entry of the same namespace as
+// the previous one. A decoder skips the fields it does not know, so that fields can be added while staying readable
+// by older decoders. With compress, the fields are compressed by DEFLATE unless it does not make them smaller. The
+// formats of the errors of the entries are not serialized
+func SerializeCompact(b KVStoreBatch, compress bool) ([]byte, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	var body, entry bytes.Buffer
+	n := make([]byte, binary.MaxVarintLen64)
+	writeTag := func(buf *bytes.Buffer, field, wireType uint64) {
+		buf.Write(n[:binary.PutUvarint(n, field<<3|wireType)])
+	}
+	writeBytes := func(buf *bytes.Buffer, field uint64, b []byte) {
+		writeTag(buf, field, compactBytes)
+		buf.Write(n[:binary.PutUvarint(n, uint64(len(b)))])
+		buf.Write(b)
+	}
+	namespace := ""
+	for i := 0; i < b.Size(); i++ {
+		write, err := b.Entry(i)
+		if err != nil {
+			return nil, err
+		}
+		entry.Reset()
+		if write.writeType != Put {
+			writeTag(&entry, compactWriteType, compactVarint)
+			entry.Write(n[:binary.PutUvarint(n, uint64(write.writeType))])
+		}
+		if i == 0 || write.namespace != namespace {
+			writeBytes(&entry, compactNamespace, []byte(write.namespace))
+			namespace = write.namespace
+		}
+		writeBytes(&entry, compactKey, write.key)
+		if len(write.value) > 0 {
+			writeBytes(&entry, compactValue, write.value)
+		}
+		writeBytes(&body, compactEntry, entry.Bytes())
+	}
+
+	if compress {
+		var compressed bytes.Buffer
+		compressed.WriteByte(compactCompressed)
+		w, err := flate.NewWriter(&compressed, flate.BestSpeed)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to compress batch")
+		}
+		if _, err := w.Write(body.Bytes()); err != nil {
+			return nil, errors.Wrap(err, "failed to compress batch")
+		}
+		if err := w.Close(); err != nil {
+			return nil, errors.Wrap(err, "failed to compress batch")
+		}
+		if compressed.Len() < body.Len()+1 {
+			return compressed.Bytes(), nil
+		}
+	}
+	return append([]byte{0}, body.Bytes()...), nil
+}
+
+// DeserializeCompact deserializes a batch serialized by SerializeCompact, skipping the fields it does not know
+func DeserializeCompact(data []byte) (KVStoreBatch, error) {
+	if len(data) == 0 {
+		return nil, errors.Wrap(ErrInvalidDB, "empty compact batch")
+	}
+	body := data[1:]
+	switch data[0] {
+	case 0:
+	case compactCompressed:
+		var err error
+		r := flate.NewReader(bytes.NewReader(body))
+		if body, err = ioutil.ReadAll(r); err != nil {
+			return nil, errors.Wrapf(ErrInvalidDB, "failed to decompress batch: %v", err)
+		}
+	default:
+		return nil, errors.Wrapf(ErrInvalidDB, "unsupported flags %x of compact batch", data[0])
+	}
+
+	var writes []writeInfo
+	namespace := ""
+	err := decodeCompactFields(body, func(field uint64, value []byte) error {
+		if field != compactEntry {
+			return nil
+		}
+		write := writeInfo{writeType: Put, namespace: namespace, errorFormat: "failed to write key = %x"}
+		err := decodeCompactFields(value, func(field uint64, value []byte) error {
+			switch field {
+			case compactWriteType:
+				writeType, l := binary.Uvarint(value)
+				if l <= 0 || writeType > uint64(AddCounter) {
+					return errors.Wrap(ErrInvalidDB, "malformed write type of compact batch")
+				}
+				write.writeType = int32(writeType)
+			case compactNamespace:
+				write.namespace = string(value)
+			case compactKey:
+				write.key = value
+			case compactValue:
+				write.value = value
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// an empty value is kept non-nil, since a nil value is reported as not existing by the in-memory KV store
+		switch {
+		case write.writeType == Delete:
+			write.value = nil
+		case write.value == nil:
+			write.value = []byte{}
+		}
+		if write.key == nil {
+			write.key = []byte{}
+		}
+		write.errorArgs = write.key
+		namespace = write.namespace
+		writes = append(writes, write)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newBatchOf(writes), nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// decodeCompactFields calls fn with the number and the value of each field in data in order, the value of a varint
+// field being its encoding. The bytes returned are copies, so they do not alias data
+func decodeCompactFields(data []byte, fn func(uint64, []byte) error) error {
+	malformed := errors.Wrap(ErrInvalidDB, "malformed compact batch")
+	for len(data) > 0 {
+		tag, l := binary.Uvarint(data)
+		if l <= 0 {
+			return malformed
+		}
+		data = data[l:]
+		var value []byte
+		switch tag & 7 {
+		case compactVarint:
+			if _, l = binary.Uvarint(data); l <= 0 {
+				return malformed
+			}
+			value, data = data[:l], data[l:]
+		case compactBytes:
+			size, l := binary.Uvarint(data)
+			if l <= 0 || size > uint64(len(data)-l) {
+				return malformed
+			}
+			value = make([]byte, size)
+			copy(value, data[l:])
+			data = data[l+int(size):]
+		default:
+			return errors.Wrapf(ErrInvalidDB, "unknown wire type %d of compact batch", tag&7)
+		}
+		if err := fn(tag>>3, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
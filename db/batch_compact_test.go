@@ -0,0 +1,165 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// largeTestBatch returns a batch of n entries over a few namespaces, with values alike as those of a block
+func largeTestBatch(n int) KVStoreBatch {
+	batch := NewBatch()
+	for i := 0; i < n; i++ {
+		key := []byte(fmt.Sprintf("key-%08d", i))
+		switch i % 4 {
+		case 0:
+			batch.Delete(bucket1, key, "")
+		case 1:
+			batch.AddCounter(bucket2, key, int64(i))
+		default:
+			batch.Put(bucket1, key, bytes.Repeat([]byte{byte(i)}, 32), "")
+		}
+	}
+	return batch
+}
+
+func TestSerializeCompact(t *testing.T) {
+	require := require.New(t)
+
+	// requireRoundTrip checks that the batch is deserialized with the same entries, compressed or not
+	requireRoundTrip := func(batch KVStoreBatch) {
+		expected, err := copyEntries(batch)
+		require.NoError(err)
+		for _, compress := range []bool{false, true} {
+			data, err := SerializeCompact(batch, compress)
+			require.NoError(err)
+			decoded, err := DeserializeCompact(data)
+			require.NoError(err)
+			require.Equal(len(expected), decoded.Size())
+			for i, e := range expected {
+				entry, err := decoded.Entry(i)
+				require.NoError(err)
+				require.Equal(e.writeType, entry.writeType)
+				require.Equal(e.namespace, entry.namespace)
+				require.Equal(e.key, entry.key)
+				require.Equal(e.value, entry.value)
+			}
+		}
+	}
+
+	requireRoundTrip(NewBatch())
+	batch := NewBatch()
+	require.NoError(batch.Put(bucket1, testK1[0], testV1[0], ""))
+	require.NoError(batch.Put(bucket1, testK1[1], []byte{}, ""))
+	require.NoError(batch.Delete(bucket1, testK1[2], ""))
+	require.NoError(batch.PutIfNotExists(bucket2, testK2[0], testV2[0], ""))
+	require.NoError(batch.AddCounter(bucket2, testK2[1], -3))
+	require.NoError(batch.Put("", []byte{}, testV2[1], ""))
+	require.NoError(batch.Put(bucket1, testK1[0], testV1[1], ""))
+	requireRoundTrip(batch)
+	requireRoundTrip(largeTestBatch(10000))
+
+	// compression only applies if it makes the batch smaller
+	batch = NewBatch()
+	require.NoError(batch.Put("n", []byte("k"), []byte("v"), ""))
+	data, err := SerializeCompact(batch, true)
+	require.NoError(err)
+	require.Equal(byte(0), data[0])
+	large := largeTestBatch(1000)
+	compressed, err := SerializeCompact(large, true)
+	require.NoError(err)
+	require.Equal(byte(compactCompressed), compressed[0])
+	data, err = SerializeCompact(large, false)
+	require.NoError(err)
+	require.True(len(compressed) < len(data))
+
+	// the fields unknown are skipped, whether of the batch or of an entry
+	data = []byte{
+		0,
+		5<<3 | compactVarint, 0x80, 0x01,
+		compactEntry<<3 | compactBytes, 16,
+		compactNamespace<<3 | compactBytes, 1, 'n',
+		6<<3 | compactBytes, 2, 'x', 'y',
+		compactKey<<3 | compactBytes, 1, 'k',
+		compactValue<<3 | compactBytes, 1, 'v',
+		7<<3 | compactBytes, 1, 'z',
+	}
+	decoded, err := DeserializeCompact(data)
+	require.NoError(err)
+	require.Equal(1, decoded.Size())
+	entry, err := decoded.Entry(0)
+	require.NoError(err)
+	require.Equal(Put, entry.writeType)
+	require.Equal("n", entry.namespace)
+	require.Equal([]byte("k"), entry.key)
+	require.Equal([]byte("v"), entry.value)
+
+	// malformed batches are rejected
+	for _, data := range [][]byte{
+		nil,
+		{2},
+		{0, compactEntry<<3 | compactBytes, 5, 0},
+		{0, compactEntry<<3 | 1, 0},
+		{0, compactEntry<<3 | compactBytes, 2, compactWriteType<<3 | compactVarint, 9},
+		{compactCompressed, 0xff},
+	} {
+		_, err := DeserializeCompact(data)
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+	}
+}
+
+func BenchmarkSerializeCompact(b *testing.B) {
+	batch := largeTestBatch(1000)
+	var log bytes.Buffer
+	require.NoError(b, WriteBatch(&log, 1, batch))
+	compact, err := SerializeCompact(batch, false)
+	require.NoError(b, err)
+	compressed, err := SerializeCompact(batch, true)
+	require.NoError(b, err)
+	b.Logf("%d entries: %d bytes by WriteBatch, %d compact, %d compact and compressed", batch.Size(), log.Len(),
+		len(compact), len(compressed))
+
+	b.Run("WriteBatch", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			var buf bytes.Buffer
+			WriteBatch(&buf, 1, batch)
+		}
+	})
+	b.Run("ReadBatch", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			decodeBatch(1, log.Bytes()[batchRecordHeaderSize:])
+		}
+	})
+	for _, c := range []struct {
+		name     string
+		compress bool
+		data     []byte
+	}{
+		{"Compact", false, compact},
+		{"Compressed", true, compressed},
+	} {
+		b.Run("Serialize"+c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				SerializeCompact(batch, c.compress)
+			}
+		})
+		b.Run("Deserialize"+c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				DeserializeCompact(c.data)
+			}
+		})
+	}
+}
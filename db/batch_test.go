@@ -151,3 +151,232 @@ func TestSnapshot(t *testing.T) {
 	require.NoError(err)
 	require.Equal(testV2[2], v)
 }
+
+func TestMerge(t *testing.T) {
+	require := require.New(t)
+
+	b1 := NewBatch()
+	b1.Put(bucket1, testK1[0], testV1[0], "")
+	b1.Put(bucket1, testK1[1], testV1[1], "")
+	value := []byte("value_merged")
+	b2 := NewBatch()
+	b2.Put(bucket1, testK1[0], value, "")
+	b2.Delete(bucket1, testK1[1], "")
+	require.NoError(b2.PutIfNotExists(bucket2, testK2[0], testV2[0], ""))
+	require.Error(b1.Merge(b1))
+
+	require.NoError(b1.Merge(b2))
+	require.Equal(5, b1.Size())
+	require.Equal(3, b2.Size())
+	w, err := b1.Entry(2)
+	require.NoError(err)
+	require.Equal(testK1[0], w.key)
+	require.Equal([]byte("value_merged"), w.value)
+
+	// the merged entries do not share memory with the source batch
+	value[0] = 'x'
+	b2.Clear()
+	require.Equal([]byte("value_merged"), w.value)
+	require.Equal(5, b1.Size())
+
+	kvStore := NewMemKVStore()
+	require.NoError(kvStore.Commit(b1))
+	v, err := kvStore.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal([]byte("value_merged"), v)
+	_, err = kvStore.Get(bucket1, testK1[1])
+	require.Error(err)
+	v, err = kvStore.Get(bucket2, testK2[0])
+	require.NoError(err)
+	require.Equal(testV2[0], v)
+
+	// merging into a cached batch updates its cache
+	cb := NewCachedBatch()
+	cb.Put(bucket1, testK1[1], testV1[1], "")
+	b2.Put(bucket1, testK1[0], testV1[0], "")
+	b2.Delete(bucket1, testK1[1], "")
+	require.NoError(cb.Merge(b2))
+	require.Equal(3, cb.Size())
+	v, err = cb.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], v)
+	_, err = cb.Get(bucket1, testK1[1])
+	require.Equal(ErrAlreadyDeleted, err)
+
+	// a failed merge leaves the cached batch intact
+	b2.Clear()
+	require.NoError(b2.PutIfNotExists(bucket1, testK1[0], testV1[1], ""))
+	require.Error(cb.Merge(b2))
+	require.Equal(3, cb.Size())
+	v, err = cb.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], v)
+}
+
+func TestBatchByteSize(t *testing.T) {
+	require := require.New(t)
+
+	manualSize := func(b KVStoreBatch) int {
+		size := 0
+		for i := 0; i < b.Size(); i++ {
+			w, err := b.Entry(i)
+			require.NoError(err)
+			size += len(w.namespace) + len(w.key) + len(w.value)
+		}
+		return size
+	}
+
+	for _, b := range []KVStoreBatch{NewBatch(), NewCachedBatch()} {
+		require.Equal(0, b.ByteSize())
+		b.Put(bucket1, testK1[0], testV1[0], "")
+		require.NoError(b.PutIfNotExists(bucket2, testK1[1], testV1[1], ""))
+		b.Delete(bucket1, testK1[2], "")
+		require.Equal(len(bucket1)+len(testK1[0])+len(testV1[0])+len(bucket2)+len(testK1[1])+len(testV1[1])+
+			len(bucket1)+len(testK1[2]), b.ByteSize())
+		require.Equal(manualSize(b), b.ByteSize())
+
+		other := NewBatch()
+		other.Put(bucket3, testK2[0], testV2[0], "")
+		require.NoError(b.Merge(other))
+		require.Equal(manualSize(b), b.ByteSize())
+
+		clone := b.CloneBatch()
+		require.Equal(b.ByteSize(), clone.ByteSize())
+
+		b.Clear()
+		require.Equal(0, b.ByteSize())
+		require.Equal(manualSize(clone), clone.ByteSize())
+	}
+
+	// reverting a cached batch restores the byte size at the snapshot
+	cb := NewCachedBatch()
+	cb.Put(bucket1, testK1[0], testV1[0], "")
+	snapshot := cb.Snapshot()
+	cb.Put(bucket1, testK1[1], testV1[1], "")
+	require.NoError(cb.Revert(snapshot))
+	require.Equal(len(bucket1)+len(testK1[0])+len(testV1[0]), cb.ByteSize())
+
+	// committing clears the batch
+	b := NewBatch()
+	b.Put(bucket1, testK1[0], testV1[0], "")
+	require.NoError(NewMemKVStore().Commit(b))
+	require.Equal(0, b.ByteSize())
+}
+
+func TestBatchLimits(t *testing.T) {
+	require := require.New(t)
+
+	for _, batch := range []KVStoreBatch{NewBatch(WithBatchLimits(3, 0)), NewCachedBatch(WithBatchLimits(3, 0))} {
+		require.NoError(batch.Put(bucket1, testK1[0], testV1[0], ""))
+		require.NoError(batch.PutIfNotExists(bucket1, testK1[1], testV1[1], ""))
+		require.NoError(batch.Delete(bucket1, testK1[2], ""))
+		require.Equal(ErrBatchTooLarge, errors.Cause(batch.Put(bucket1, testK2[0], testV2[0], "")))
+		require.Equal(ErrBatchTooLarge, errors.Cause(batch.PutIfNotExists(bucket1, testK2[1], testV2[1], "")))
+		require.Equal(ErrBatchTooLarge, errors.Cause(batch.Delete(bucket1, testK2[2], "")))
+		// the batch stops growing
+		require.Equal(3, batch.Size())
+		if cb, ok := batch.(CachedBatch); ok {
+			_, err := cb.Get(bucket1, testK2[0])
+			require.Equal(ErrNotExist, errors.Cause(err))
+		}
+		// a merge beyond the limits merges nothing
+		other := NewBatch()
+		other.Put(bucket2, testK2[0], testV2[0], "")
+		require.Equal(ErrBatchTooLarge, errors.Cause(batch.Merge(other)))
+		require.Equal(3, batch.Size())
+		// the clone keeps the limits, and a cleared batch grows again
+		require.Equal(ErrBatchTooLarge, errors.Cause(batch.CloneBatch().Put(bucket1, testK2[0], testV2[0], "")))
+		batch.Clear()
+		require.NoError(batch.Put(bucket1, testK2[0], testV2[0], ""))
+	}
+
+	// the byte size is limited to the total length of namespaces, keys and values
+	entrySize := len(bucket1) + len(testK1[0]) + len(testV1[0])
+	batch := NewBatch(WithBatchLimits(0, 2*entrySize))
+	require.NoError(batch.Put(bucket1, testK1[0], testV1[0], ""))
+	require.NoError(batch.Put(bucket1, testK1[0], testV1[0], ""))
+	require.Equal(ErrBatchTooLarge, errors.Cause(batch.Delete(bucket1, testK1[0], "")))
+	require.Equal(2*entrySize, batch.ByteSize())
+
+	// no limits by default
+	batch = NewBatch()
+	for i := 0; i < 10000; i++ {
+		require.NoError(batch.Put(bucket1, testK1[0], testV1[0], ""))
+	}
+}
+
+func TestBatchPool(t *testing.T) {
+	require := require.New(t)
+
+	batch := NewKVStoreBatchWithCapacity(8)
+	require.Equal(8, cap(batch.(*baseKVStoreBatch).writeQueue))
+	require.NoError(batch.Put(bucket1, testK1[0], testV1[0], ""))
+	// a committed batch keeps the room for entries, but not the entries
+	batch.Lock()
+	batch.ClearAndUnlock()
+	require.Equal(0, batch.Size())
+	require.Equal(8, cap(batch.(*baseKVStoreBatch).writeQueue))
+
+	batch = AcquireBatch(WithBatchLimits(2, 0))
+	require.NoError(batch.Put(bucket1, testK1[0], testV1[0], ""))
+	require.NoError(batch.Delete(bucket1, testK1[1], ""))
+	require.Equal(ErrBatchTooLarge, errors.Cause(batch.Put(bucket1, testK1[2], testV1[2], "")))
+	b := batch.(*baseKVStoreBatch)
+	ReleaseBatch(batch)
+	// the released batch references no key or value
+	require.Equal(0, b.Size())
+	require.Equal(0, b.ByteSize())
+	for _, e := range b.writeQueue[:cap(b.writeQueue)] {
+		require.Equal(writeInfo{}, e)
+	}
+
+	// an acquired batch has no stale entries nor limits, whether reused or not
+	for i := 0; i < 10; i++ {
+		batch = AcquireBatch()
+		require.Equal(0, batch.Size())
+		require.Equal(0, batch.ByteSize())
+		require.False(batch.committed())
+		require.NoError(batch.Put(bucket1, testK1[0], testV1[0], ""))
+		require.NoError(batch.Put(bucket1, testK1[1], testV1[1], ""))
+		require.NoError(batch.Put(bucket1, testK1[2], testV1[2], ""))
+		entry, err := batch.Entry(0)
+		require.NoError(err)
+		require.Equal(testK1[0], entry.key)
+		ReleaseBatch(batch)
+	}
+
+	// a cached batch is not pooled
+	ReleaseBatch(NewCachedBatch())
+}
+
+func BenchmarkBatchPool(b *testing.B) {
+	const entries = 100
+	stage := func(batch KVStoreBatch) {
+		for i := 0; i < entries; i++ {
+			batch.Put(bucket1, testK1[0], testV1[0], "")
+		}
+		batch.Lock()
+		batch.ClearAndUnlock()
+	}
+
+	b.Run("NewBatch", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			stage(NewBatch())
+		}
+	})
+	b.Run("NewKVStoreBatchWithCapacity", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			stage(NewKVStoreBatchWithCapacity(entries))
+		}
+	})
+	b.Run("AcquireBatch", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			batch := AcquireBatch()
+			stage(batch)
+			ReleaseBatch(batch)
+		}
+	})
+}
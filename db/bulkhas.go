@@ -0,0 +1,130 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+)
+
+// bulkHasNextSteps is the number of records the cursor is moved over to reach the next key before seeking it instead
+const bulkHasNextSteps = 8
+
+// BulkExistenceChecker is the interface of KV store which is able to check the existence of many keys at once
+type BulkExistenceChecker interface {
+	// BulkHas returns whether each of the keys exists in the namespace, in the order of the keys, all at the same
+	// point in time. None exists if the namespace does not exist
+	BulkHas(string, [][]byte) ([]bool, error)
+}
+
+// BulkHas checks the keys in sorted order within one read transaction, moving one cursor forward from a key to the
+// next, so that the keys close to each other share the traversal of the B+tree rather than each going from the root
+func (b *boltDB) BulkHas(namespace string, keys [][]byte) ([]bool, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	found := make([]bool, len(keys))
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(namespace))
+		if bucket == nil || len(keys) == 0 {
+			return nil
+		}
+		if wrapped, ok := b.wrapBucket(namespace, bucket).(frontCodedBucket); ok {
+			// the keys of the bucket are those of the blocks rather than the records
+			for i, key := range keys {
+				found[i] = wrapped.Get(key) != nil
+			}
+			return nil
+		}
+		order := sortedOrder(keys)
+		c := bucket.Cursor()
+		k, _ := c.Seek(keys[order[0]])
+		for _, i := range order {
+			for step := 0; k != nil && bytes.Compare(k, keys[i]) < 0; step++ {
+				if step == bulkHasNextSteps {
+					k, _ = c.Seek(keys[i])
+					break
+				}
+				k, _ = c.Next()
+			}
+			found[i] = k != nil && bytes.Equal(k, keys[i])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// BulkHas checks the keys within one read transaction. BadgerDB looks each key up from the memtables and the levels
+// alike, so there is nothing to gain from a cursor over sorted keys
+func (b *badgerDB) BulkHas(namespace string, keys [][]byte) ([]bool, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	found := make([]bool, len(keys))
+	err := b.db.View(func(txn *badger.Txn) error {
+		for i, key := range keys {
+			k := append([]byte(namespace), key...)
+			_, err := txn.Get(k)
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed to get key = %x", k)
+			}
+			found[i] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// BulkHas checks the keys with all shards read locked
+func (m *memKVStore) BulkHas(namespace string, keys [][]byte) ([]bool, error) {
+	m.rlockAll()
+	defer m.runlockAll()
+
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		// a record of nil value is reported as not existing
+		found[i] = m.shard(namespace, key).bucket[namespace][string(key)] != nil
+	}
+	return found, nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// sortedOrder returns the indices of the keys in the order of the keys
+func sortedOrder(keys [][]byte) []int {
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return bytes.Compare(keys[order[i]], keys[order[j]]) < 0
+	})
+	return order
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestBulkHas(t *testing.T) {
+	testBulkHas := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		checker, ok := kvStore.(BulkExistenceChecker)
+		require.True(ok)
+
+		// the keys of every other number exist, so the cursor moves over gaps of every size
+		r := rand.New(rand.NewSource(1))
+		batch := NewBatch()
+		for i := 0; i < 1000; i += 2 {
+			require.NoError(batch.Put(bucket1, bulkHasKey(uint32(i)), []byte{byte(i)}, ""))
+		}
+		require.NoError(kvStore.Commit(batch))
+		for round := 0; round < 20; round++ {
+			keys := make([][]byte, r.Intn(200))
+			for i := range keys {
+				keys[i] = bulkHasKey(uint32(r.Intn(1100)))
+			}
+			found, err := checker.BulkHas(bucket1, keys)
+			require.NoError(err)
+			require.Len(found, len(keys))
+			for i, key := range keys {
+				_, err := kvStore.Get(bucket1, key)
+				require.Equal(err == nil, found[i], "key = %x", key)
+			}
+		}
+
+		// none of the keys of a missing namespace exists
+		found, err := checker.BulkHas(bucket2, [][]byte{bulkHasKey(0), bulkHasKey(2)})
+		require.NoError(err)
+		require.Equal([]bool{false, false}, found)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testBulkHas(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-bulk-has.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testBulkHas(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Bolt DB front-coded", func(t *testing.T) {
+		path := "test-bulk-has-front-coded.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testBulkHas(NewOnDiskDB(dbCfg, WithFrontCoding(bucket1)), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-bulk-has.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testBulkHas(NewOnDiskDB(dbCfg), t)
+	})
+}
+
+func BenchmarkBoltBulkHas(b *testing.B) {
+	require := require.New(b)
+	ctx := context.Background()
+	dbCfg := cfg
+	path := "bench-bulk-has.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	require.NoError(os.RemoveAll(path))
+	defer func() {
+		require.NoError(os.RemoveAll(path))
+	}()
+
+	kvStore := NewOnDiskDB(dbCfg)
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	batch := NewBatch()
+	for i := 0; i < 200000; i += 2 {
+		require.NoError(batch.Put(bucket1, bulkHasKey(uint32(i)), make([]byte, 32), ""))
+	}
+	require.NoError(kvStore.Commit(batch))
+	r := rand.New(rand.NewSource(1))
+	keys := make([][]byte, 10000)
+	for i := range keys {
+		keys[i] = bulkHasKey(uint32(r.Intn(200000)))
+	}
+
+	b.Run("Get", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for _, key := range keys {
+				if _, err := kvStore.Get(bucket1, key); err != nil && !isNotExist(err) {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("BulkHas", func(b *testing.B) {
+		checker := kvStore.(BulkExistenceChecker)
+		for n := 0; n < b.N; n++ {
+			if _, err := checker.BulkHas(bucket1, keys); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// bulkHasKey returns the key of the number, which sorts in number order
+func bulkHasKey(i uint32) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, i)
+	return key
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+)
+
+// bulkLoadChunkSize is the total size of the records a bulk loader of BoltDB or another KV store commits at a time
+const bulkLoadChunkSize = 16 * 1024 * 1024
+
+// BulkLoader loads a large number of records into a KV store, such as at genesis or a full resync, without making
+// each commit durable on its own. The records are durable only once Finish returns nil. A crash or an error before
+// that may lose any of the records, and may even leave a BoltDB file corrupted, so a failed load must start over from
+// an empty KV store. The records may be visible to reads before Finish. A BulkLoader is not safe for concurrent use
+type BulkLoader interface {
+	// Add puts a <key, value> record. As with KVStoreBatch, the key and value must not be modified afterwards. An error
+	// is returned by Finish, and the records added after it are dropped
+	Add(string, []byte, []byte)
+	// Finish commits the records not committed yet and fsyncs them with all the others, and returns the first error
+	// of the load
+	Finish() error
+}
+
+type (
+	// boltBulkLoader commits the records in chunks of a single Update each, with fsync off
+	boltBulkLoader struct {
+		db *boltDB
+		// sorted is whether the records are added in key order of a single namespace, in which case they are not
+		// sorted again, and the pages are filled up rather than split half full
+		sorted  bool
+		entries []writeInfo
+		size    int
+		err     error
+	}
+
+	// badgerBulkLoader commits the records in transactions as large as BadgerDB allows, without waiting for one to be
+	// written before filling the next, so the value log is written and fsynced once for several transactions
+	badgerBulkLoader struct {
+		db         *badgerDB
+		txn        *badger.Txn
+		namespaces map[string]struct{}
+		// writes is the keys put by txn, applied to the in-memory key index once it is committed
+		writes []keyWrite
+		wg     sync.WaitGroup
+		mutex  sync.Mutex
+		err    error
+	}
+
+	// batchBulkLoader commits the records in regular batches, for a KV store with no faster way to load
+	batchBulkLoader struct {
+		kvStore KVStore
+		batch   KVStoreBatch
+		err     error
+	}
+)
+
+// NewBulkLoader returns a bulk loader of the KV store, which must be started. BoltDB commits with fsync off until
+// Finish fsyncs the file; BadgerDB commits asynchronously and fsyncs once for as many commits as queue up, since its
+// API has no way to turn fsync off after the DB is open. Any other KV store commits in regular batches
+func NewBulkLoader(kvStore KVStore) BulkLoader {
+	switch s := kvStore.(type) {
+	case *boltDB:
+		return &boltBulkLoader{db: s}
+	case *badgerDB:
+		return &badgerBulkLoader{db: s, namespaces: make(map[string]struct{})}
+	default:
+		return &batchBulkLoader{kvStore: kvStore, batch: NewBatch()}
+	}
+}
+
+// Add puts a <key, value> record, committing the chunk once it is full
+func (l *boltBulkLoader) Add(namespace string, key, value []byte) {
+	if l.err != nil {
+		return
+	}
+	l.entries = append(l.entries, writeInfo{writeType: Put, namespace: namespace, key: key, value: value})
+	l.size += l.entries[len(l.entries)-1].byteSize()
+	if l.size >= bulkLoadChunkSize {
+		l.commit()
+	}
+}
+
+// Finish commits the last chunk and fsyncs the BoltDB file
+func (l *boltBulkLoader) Finish() error {
+	if l.err != nil {
+		return l.err
+	}
+	if l.commit(); l.err != nil {
+		return l.err
+	}
+	return l.db.Sync()
+}
+
+// Add puts a <key, value> record into the transaction being filled, committing it once it is full
+func (l *badgerBulkLoader) Add(namespace string, key, value []byte) {
+	if l.failed() {
+		return
+	}
+	l.db.mutex.Lock()
+	defer l.db.mutex.Unlock()
+
+	if l.db.db == nil {
+		l.fail(ErrDBClosed)
+		return
+	}
+	if _, ok := l.namespaces[namespace]; !ok {
+		if err := l.db.checkNamespace(namespace); err != nil {
+			l.fail(err)
+			return
+		}
+		l.namespaces[namespace] = struct{}{}
+	}
+	k := append([]byte(namespace), key...)
+	if l.txn == nil {
+		l.txn = l.db.db.NewTransaction(true)
+	}
+	err := l.txn.Set(k, value)
+	if err == badger.ErrTxnTooBig {
+		l.commitAsync()
+		l.txn = l.db.db.NewTransaction(true)
+		err = l.txn.Set(k, value)
+	}
+	if err != nil {
+		l.fail(errors.Wrapf(err, "failed to put key = %x", key))
+		return
+	}
+	if l.db.index != nil {
+		l.writes = append(l.writes, keyWrite{key: k})
+	}
+}
+
+// Finish commits the last transaction, waits for the others to be written, and fsyncs the value log
+func (l *badgerBulkLoader) Finish() error {
+	l.db.mutex.Lock()
+	if l.txn != nil {
+		if l.db.db == nil {
+			l.fail(ErrDBClosed)
+		} else if !l.failed() {
+			l.commitAsync()
+		} else {
+			l.txn.Discard()
+		}
+		l.txn, l.writes = nil, nil
+	}
+	l.db.mutex.Unlock()
+	l.wg.Wait()
+	if l.failed() {
+		return l.err
+	}
+	return l.db.Sync()
+}
+
+// Add puts a <key, value> record into the batch, committing it once it is full
+func (l *batchBulkLoader) Add(namespace string, key, value []byte) {
+	if l.err != nil {
+		return
+	}
+	l.batch.Put(namespace, key, value, "failed to put key = %x", key)
+	if l.batch.ByteSize() >= bulkLoadChunkSize {
+		l.err = l.kvStore.Commit(l.batch)
+	}
+}
+
+// Finish commits the last batch, and syncs the KV store if it implements Syncer
+func (l *batchBulkLoader) Finish() error {
+	if l.err != nil {
+		return l.err
+	}
+	if l.batch.Size() > 0 {
+		if err := l.kvStore.Commit(l.batch); err != nil {
+			return err
+		}
+	}
+	if syncer, ok := l.kvStore.(Syncer); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// commit commits the entries of the chunk in a single Update with fsync off
+func (l *boltBulkLoader) commit() {
+	entries := l.entries
+	l.entries, l.size = nil, 0
+	if len(entries) == 0 {
+		return
+	}
+	b := l.db
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		l.err = ErrDBClosed
+		return
+	}
+	// BoltDB splits the nodes only on commit, so the records are put in order to append to the nodes rather than
+	// insert in the middle of ever larger ones. Of records of the same key, the one added last is put last
+	if !l.sorted {
+		sort.SliceStable(entries, func(i, j int) bool {
+			if entries[i].namespace != entries[j].namespace {
+				return entries[i].namespace < entries[j].namespace
+			}
+			return bytes.Compare(entries[i].key, entries[j].key) < 0
+		})
+	}
+	// all commits are made with the mutex locked, so none of the others runs with fsync off
+	b.db.NoSync = true
+	defer func() {
+		b.db.NoSync = false
+	}()
+	l.err = b.db.Update(func(tx *bolt.Tx) error {
+		for _, write := range entries {
+			bucket, err := b.bucketToWrite(tx, write.namespace)
+			if err != nil {
+				return err
+			}
+			if l.sorted {
+				fillUp(bucket)
+			}
+			if err := bucket.Put(write.key, write.value); err != nil {
+				return errors.Wrapf(err, "failed to put key = %x", write.key)
+			}
+		}
+		return nil
+	})
+}
+
+// commitAsync sends the transaction being filled to be committed, which the mutex of the DB must be locked for
+func (l *badgerBulkLoader) commitAsync() {
+	index, writes := l.db.index, l.writes
+	l.wg.Add(1)
+	if err := l.txn.Commit(func(err error) {
+		defer l.wg.Done()
+		if err != nil {
+			l.fail(err)
+			return
+		}
+		index.apply(writes)
+	}); err != nil {
+		l.wg.Done()
+		l.fail(err)
+	}
+	l.txn, l.writes = nil, nil
+	l.db.markDirty()
+}
+
+// fail records the first error of the load
+func (l *badgerBulkLoader) fail(err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.err == nil {
+		l.err = err
+	}
+}
+
+// failed returns whether the load has failed
+func (l *badgerBulkLoader) failed() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.err != nil
+}
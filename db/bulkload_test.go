@@ -0,0 +1,180 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestBulkLoader(t *testing.T) {
+	// enough records for more than one chunk of BoltDB and more than one transaction of BadgerDB
+	const numRecords = 1 << 17
+	value := make([]byte, 128)
+	load := func(require *require.Assertions, kvStore KVStore) {
+		loader := NewBulkLoader(kvStore)
+		for i := 0; i < numRecords; i++ {
+			loader.Add(bucket1, []byte(fmt.Sprintf("key_%06d", i)), value)
+		}
+		loader.Add(bucket2, testK2[0], testV2[0])
+		require.NoError(loader.Finish())
+	}
+	check := func(require *require.Assertions, kvStore KVStore) {
+		for _, i := range []int{0, 1, numRecords / 2, numRecords - 1} {
+			v, err := kvStore.Get(bucket1, []byte(fmt.Sprintf("key_%06d", i)))
+			require.NoError(err)
+			require.Equal(value, v)
+		}
+		count := 0
+		require.NoError(kvStore.(Streamer).StreamAll(bucket1, func([]byte, []byte) error {
+			count++
+			return nil
+		}))
+		require.Equal(numRecords, count)
+		v, err := kvStore.Get(bucket2, testK2[0])
+		require.NoError(err)
+		require.Equal(testV2[0], v)
+	}
+	testDurable := func(newKVStore func() KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		kvStore := newKVStore()
+		require.NoError(kvStore.Start(ctx))
+		load(require, kvStore)
+		check(require, kvStore)
+		// regular commits are fsynced again afterwards
+		if bolt, ok := kvStore.(*boltDB); ok {
+			require.False(bolt.db.NoSync)
+		}
+		require.NoError(kvStore.Put(bucket2, testK2[1], testV2[1]))
+		require.NoError(kvStore.Stop(ctx))
+
+		// the records are all there after reopening
+		kvStore = newKVStore()
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		check(require, kvStore)
+		v, err := kvStore.Get(bucket2, testK2[1])
+		require.NoError(err)
+		require.Equal(testV2[1], v)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		require := require.New(t)
+		kvStore := NewMemKVStore()
+		require.NoError(kvStore.Start(context.Background()))
+		load(require, kvStore)
+		check(require, kvStore)
+	})
+
+	dbCfg := cfg
+	path := "test-bulk-loader.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		boltCfg := dbCfg
+		testDurable(func() KVStore { return NewOnDiskDB(boltCfg) }, t)
+	})
+
+	path = "test-bulk-loader.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		badgerCfg := dbCfg
+		testDurable(func() KVStore { return NewOnDiskDB(badgerCfg) }, t)
+	})
+	t.Run("Badger DB group commit", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		badgerCfg := dbCfg
+		testDurable(func() KVStore { return NewOnDiskDB(badgerCfg, WithGroupCommit(time.Hour)) }, t)
+	})
+
+	// the first error is returned by Finish
+	for _, useBadger := range []bool{false, true} {
+		require := require.New(t)
+		ctx := context.Background()
+		dbCfg.UseBadgerDB = useBadger
+		dbCfg.DbPath = fmt.Sprintf("test-bulk-loader-%t", useBadger)
+		testutil.CleanupPath(t, dbCfg.DbPath)
+		kvStore := NewOnDiskDB(dbCfg, WithExplicitNamespaces(bucket1))
+		require.NoError(kvStore.Start(ctx))
+		loader := NewBulkLoader(kvStore)
+		loader.Add(bucket1, testK1[0], testV1[0])
+		loader.Add(bucket2, testK2[0], testV2[0])
+		loader.Add(bucket1, testK1[1], testV1[1])
+		require.Equal(ErrInvalidDB, errors.Cause(loader.Finish()))
+		require.NoError(kvStore.Stop(ctx))
+		testutil.CleanupPath(t, dbCfg.DbPath)
+	}
+}
+
+func BenchmarkBulkLoader(b *testing.B) {
+	const batchSize = 100
+	benchmark := func(b *testing.B, useBadger, bulk bool) {
+		require := require.New(b)
+		ctx := context.Background()
+		dbCfg := cfg
+		dbCfg.DbPath = "bench-bulk-loader.db"
+		dbCfg.UseBadgerDB = useBadger
+		require.NoError(os.RemoveAll(dbCfg.DbPath))
+		defer func() {
+			require.NoError(os.RemoveAll(dbCfg.DbPath))
+		}()
+
+		kvStore := NewOnDiskDB(dbCfg)
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		value := make([]byte, 256)
+		b.ResetTimer()
+		if bulk {
+			loader := NewBulkLoader(kvStore)
+			for n := 0; n < b.N; n++ {
+				loader.Add(bucket1, []byte(fmt.Sprintf("key_%d", n)), value)
+			}
+			require.NoError(loader.Finish())
+			return
+		}
+		batch := NewBatch()
+		for n := 0; n < b.N; n++ {
+			batch.Put(bucket1, []byte(fmt.Sprintf("key_%d", n)), value, "")
+			if batch.Size() == batchSize || n == b.N-1 {
+				require.NoError(kvStore.Commit(batch))
+			}
+		}
+	}
+
+	for _, useBadger := range []bool{false, true} {
+		name := "Bolt"
+		if useBadger {
+			name = "Badger"
+		}
+		b.Run(name+"Batches", func(b *testing.B) {
+			benchmark(b, useBadger, false)
+		})
+		b.Run(name+"BulkLoader", func(b *testing.B) {
+			benchmark(b, useBadger, true)
+		})
+	}
+}
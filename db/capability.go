@@ -0,0 +1,328 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"strings"
+)
+
+// Capability is an optional interface of KV store beyond KVStore, named after the interface
+type Capability uint64
+
+// CapabilitySet is a set of capabilities
+type CapabilitySet uint64
+
+const (
+	// CapStreamer is Streamer
+	CapStreamer Capability = 1 << iota
+	// CapCountingCommitter is CountingCommitter
+	CapCountingCommitter
+	// CapSplitCommitter is SplitCommitter
+	CapSplitCommitter
+	// CapBulkInserter is BulkInserter
+	CapBulkInserter
+	// CapClearable is Clearable
+	CapClearable
+	// CapEmptyChecker is EmptyChecker
+	CapEmptyChecker
+	// CapWarmer is Warmer
+	CapWarmer
+	// CapNamespaceIterator is NamespaceIterator
+	CapNamespaceIterator
+	// CapSyncer is Syncer
+	CapSyncer
+	// CapNamespaceManager is NamespaceManager
+	CapNamespaceManager
+	// CapNamespaceSwapper is NamespaceSwapper
+	CapNamespaceSwapper
+	// CapSnapshotGetter is SnapshotGetter
+	CapSnapshotGetter
+	// CapUpdater is Updater
+	CapUpdater
+	// CapRenamer is Renamer
+	CapRenamer
+	// CapDequeuer is Dequeuer
+	CapDequeuer
+	// CapNamespaceInitializer is NamespaceInitializer
+	CapNamespaceInitializer
+	// CapConditionalDeleter is ConditionalDeleter
+	CapConditionalDeleter
+	// CapEntryMover is EntryMover
+	CapEntryMover
+	// CapUnsafeGetter is UnsafeGetter
+	CapUnsafeGetter
+	// CapMappedGetter is MappedGetter
+	CapMappedGetter
+	// CapKeyPager is KeyPager
+	CapKeyPager
+	// CapSnapshotter is Snapshotter
+	CapSnapshotter
+	// CapReadTxnObserver is ReadTxnObserver
+	CapReadTxnObserver
+	// CapSizer is Sizer
+	CapSizer
+	// CapSnapshotOpener is SnapshotOpener
+	CapSnapshotOpener
+	// CapValueStreamer is ValueStreamer
+	CapValueStreamer
+	// CapSchemaVersioner is SchemaVersioner
+	CapSchemaVersioner
+	// CapTimestampGetter is TimestampGetter
+	CapTimestampGetter
+	// CapAuditLogReader is AuditLogReader
+	CapAuditLogReader
+	// CapHistoryReader is HistoryReader
+	CapHistoryReader
+	// CapNamespaceAliaser is NamespaceAliaser
+	CapNamespaceAliaser
+	// CapSwapper is Swapper
+	CapSwapper
+	// CapNamespaceTreeManager is NamespaceTreeManager
+	CapNamespaceTreeManager
+	// CapDurableCommitter is DurableCommitter
+	CapDurableCommitter
+	// CapBulkExistenceChecker is BulkExistenceChecker
+	CapBulkExistenceChecker
+	// CapLastWrittenGetter is LastWrittenGetter
+	CapLastWrittenGetter
+	// CapRangeGetter is RangeGetter
+	CapRangeGetter
+	// CapRateLimitedCommitter is RateLimitedCommitter
+	CapRateLimitedCommitter
+	// CapLSMStatsReporter is LSMStatsReporter
+	CapLSMStatsReporter
+	// CapSnapshotExporter is SnapshotExporter
+	CapSnapshotExporter
+	// CapInsertionOrderIterator is InsertionOrderIterator
+	CapInsertionOrderIterator
+	// CapSortedIngester is SortedIngester
+	CapSortedIngester
+	// CapValueLogGCObserver is ValueLogGCObserver
+	CapValueLogGCObserver
+	// CapIdempotentCommitter is IdempotentCommitter
+	CapIdempotentCommitter
+	// CapModifier is Modifier
+	CapModifier
+	// CapHotKeyReporter is HotKeyReporter
+	CapHotKeyReporter
+	// CapNamespaceSchemaCreator is NamespaceSchemaCreator
+	CapNamespaceSchemaCreator
+	// CapOutboxCommitter is OutboxCommitter
+	CapOutboxCommitter
+	// CapCommitBarrier is CommitBarrier
+	CapCommitBarrier
+	// CapNamespaceFlusher is NamespaceFlusher
+	CapNamespaceFlusher
+	// CapIncrementalBackuper is IncrementalBackuper
+	CapIncrementalBackuper
+)
+
+// capabilityNarrower is the interface of KV store which implements a capability but only serves it if the KV stores
+// it wraps do, or if a mode is on
+type capabilityNarrower interface {
+	// narrowCapabilities removes the capabilities not served from the set of those implemented
+	narrowCapabilities(CapabilitySet) CapabilitySet
+}
+
+// knownCapabilities is the capabilities a KV store is tested for, in the order of their names in String
+var knownCapabilities = []struct {
+	capability  Capability
+	name        string
+	implemented func(KVStore) bool
+}{
+	{CapStreamer, "Streamer", func(s KVStore) bool { _, ok := s.(Streamer); return ok }},
+	{CapCountingCommitter, "CountingCommitter", func(s KVStore) bool { _, ok := s.(CountingCommitter); return ok }},
+	{CapSplitCommitter, "SplitCommitter", func(s KVStore) bool { _, ok := s.(SplitCommitter); return ok }},
+	{CapBulkInserter, "BulkInserter", func(s KVStore) bool { _, ok := s.(BulkInserter); return ok }},
+	{CapClearable, "Clearable", func(s KVStore) bool { _, ok := s.(Clearable); return ok }},
+	{CapEmptyChecker, "EmptyChecker", func(s KVStore) bool { _, ok := s.(EmptyChecker); return ok }},
+	{CapWarmer, "Warmer", func(s KVStore) bool { _, ok := s.(Warmer); return ok }},
+	{CapNamespaceIterator, "NamespaceIterator", func(s KVStore) bool { _, ok := s.(NamespaceIterator); return ok }},
+	{CapSyncer, "Syncer", func(s KVStore) bool { _, ok := s.(Syncer); return ok }},
+	{CapNamespaceManager, "NamespaceManager", func(s KVStore) bool { _, ok := s.(NamespaceManager); return ok }},
+	{CapNamespaceSwapper, "NamespaceSwapper", func(s KVStore) bool { _, ok := s.(NamespaceSwapper); return ok }},
+	{CapSnapshotGetter, "SnapshotGetter", func(s KVStore) bool { _, ok := s.(SnapshotGetter); return ok }},
+	{CapUpdater, "Updater", func(s KVStore) bool { _, ok := s.(Updater); return ok }},
+	{CapRenamer, "Renamer", func(s KVStore) bool { _, ok := s.(Renamer); return ok }},
+	{CapDequeuer, "Dequeuer", func(s KVStore) bool { _, ok := s.(Dequeuer); return ok }},
+	{CapNamespaceInitializer, "NamespaceInitializer", func(s KVStore) bool {
+		_, ok := s.(NamespaceInitializer)
+		return ok
+	}},
+	{CapConditionalDeleter, "ConditionalDeleter", func(s KVStore) bool { _, ok := s.(ConditionalDeleter); return ok }},
+	{CapEntryMover, "EntryMover", func(s KVStore) bool { _, ok := s.(EntryMover); return ok }},
+	{CapUnsafeGetter, "UnsafeGetter", func(s KVStore) bool { _, ok := s.(UnsafeGetter); return ok }},
+	{CapMappedGetter, "MappedGetter", func(s KVStore) bool { _, ok := s.(MappedGetter); return ok }},
+	{CapKeyPager, "KeyPager", func(s KVStore) bool { _, ok := s.(KeyPager); return ok }},
+	{CapSnapshotter, "Snapshotter", func(s KVStore) bool { _, ok := s.(Snapshotter); return ok }},
+	{CapReadTxnObserver, "ReadTxnObserver", func(s KVStore) bool { _, ok := s.(ReadTxnObserver); return ok }},
+	{CapSizer, "Sizer", func(s KVStore) bool { _, ok := s.(Sizer); return ok }},
+	{CapSnapshotOpener, "SnapshotOpener", func(s KVStore) bool { _, ok := s.(SnapshotOpener); return ok }},
+	{CapValueStreamer, "ValueStreamer", func(s KVStore) bool { _, ok := s.(ValueStreamer); return ok }},
+	{CapSchemaVersioner, "SchemaVersioner", func(s KVStore) bool { _, ok := s.(SchemaVersioner); return ok }},
+	{CapTimestampGetter, "TimestampGetter", func(s KVStore) bool { _, ok := s.(TimestampGetter); return ok }},
+	{CapAuditLogReader, "AuditLogReader", func(s KVStore) bool { _, ok := s.(AuditLogReader); return ok }},
+	{CapHistoryReader, "HistoryReader", func(s KVStore) bool { _, ok := s.(HistoryReader); return ok }},
+	{CapNamespaceAliaser, "NamespaceAliaser", func(s KVStore) bool { _, ok := s.(NamespaceAliaser); return ok }},
+	{CapSwapper, "Swapper", func(s KVStore) bool { _, ok := s.(Swapper); return ok }},
+	{CapNamespaceTreeManager, "NamespaceTreeManager", func(s KVStore) bool {
+		_, ok := s.(NamespaceTreeManager)
+		return ok
+	}},
+	{CapDurableCommitter, "DurableCommitter", func(s KVStore) bool { _, ok := s.(DurableCommitter); return ok }},
+	{CapBulkExistenceChecker, "BulkExistenceChecker", func(s KVStore) bool {
+		_, ok := s.(BulkExistenceChecker)
+		return ok
+	}},
+	{CapLastWrittenGetter, "LastWrittenGetter", func(s KVStore) bool { _, ok := s.(LastWrittenGetter); return ok }},
+	{CapRangeGetter, "RangeGetter", func(s KVStore) bool { _, ok := s.(RangeGetter); return ok }},
+	{CapRateLimitedCommitter, "RateLimitedCommitter", func(s KVStore) bool {
+		_, ok := s.(RateLimitedCommitter)
+		return ok
+	}},
+	{CapLSMStatsReporter, "LSMStatsReporter", func(s KVStore) bool { _, ok := s.(LSMStatsReporter); return ok }},
+	{CapSnapshotExporter, "SnapshotExporter", func(s KVStore) bool { _, ok := s.(SnapshotExporter); return ok }},
+	{CapInsertionOrderIterator, "InsertionOrderIterator", func(s KVStore) bool {
+		_, ok := s.(InsertionOrderIterator)
+		return ok
+	}},
+	{CapSortedIngester, "SortedIngester", func(s KVStore) bool { _, ok := s.(SortedIngester); return ok }},
+	{CapValueLogGCObserver, "ValueLogGCObserver", func(s KVStore) bool {
+		_, ok := s.(ValueLogGCObserver)
+		return ok
+	}},
+	{CapIdempotentCommitter, "IdempotentCommitter", func(s KVStore) bool {
+		_, ok := s.(IdempotentCommitter)
+		return ok
+	}},
+	{CapModifier, "Modifier", func(s KVStore) bool { _, ok := s.(Modifier); return ok }},
+	{CapHotKeyReporter, "HotKeyReporter", func(s KVStore) bool { _, ok := s.(HotKeyReporter); return ok }},
+	{CapNamespaceSchemaCreator, "NamespaceSchemaCreator", func(s KVStore) bool {
+		_, ok := s.(NamespaceSchemaCreator)
+		return ok
+	}},
+	{CapOutboxCommitter, "OutboxCommitter", func(s KVStore) bool { _, ok := s.(OutboxCommitter); return ok }},
+	{CapCommitBarrier, "CommitBarrier", func(s KVStore) bool { _, ok := s.(CommitBarrier); return ok }},
+	{CapNamespaceFlusher, "NamespaceFlusher", func(s KVStore) bool { _, ok := s.(NamespaceFlusher); return ok }},
+	{CapIncrementalBackuper, "IncrementalBackuper", func(s KVStore) bool {
+		_, ok := s.(IncrementalBackuper)
+		return ok
+	}},
+}
+
+// Capabilities returns the capabilities the KV store serves, so that a caller feature-detects them and falls back
+// rather than assuming them of a KV store behind decorators. A capability is served if the KV store implements its
+// interface, except for a decorator forwarding it, which only serves it if the KV stores it wraps do. A capability
+// not served is an interface the KV store does not implement, or whose methods return ErrInvalidDB
+func Capabilities(kvStore KVStore) CapabilitySet {
+	var set CapabilitySet
+	for _, c := range knownCapabilities {
+		if c.implemented(kvStore) {
+			set = set.With(c.capability)
+		}
+	}
+	if narrower, ok := kvStore.(capabilityNarrower); ok {
+		set = narrower.narrowCapabilities(set)
+	}
+	return set
+}
+
+// Has returns true if the set holds all the capabilities
+func (s CapabilitySet) Has(caps ...Capability) bool {
+	for _, c := range caps {
+		if s&CapabilitySet(c) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// With returns the set with the capabilities added
+func (s CapabilitySet) With(caps ...Capability) CapabilitySet {
+	for _, c := range caps {
+		s |= CapabilitySet(c)
+	}
+	return s
+}
+
+// Without returns the set with the capabilities removed
+func (s CapabilitySet) Without(caps ...Capability) CapabilitySet {
+	for _, c := range caps {
+		s &^= CapabilitySet(c)
+	}
+	return s
+}
+
+// String returns the names of the capabilities in the set, separated by commas
+func (s CapabilitySet) String() string {
+	var names []string
+	for _, c := range knownCapabilities {
+		if s.Has(c.capability) {
+			names = append(names, c.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+//======================================
+// private functions
+//======================================
+
+// narrowCapabilities serves the snapshot reads, streaming and listing of keys only if the underlying KV store does
+func (s *checksumKVStore) narrowCapabilities(set CapabilitySet) CapabilitySet {
+	return narrowToUnderlying(set, []KVStore{s.kvStore}, CapSnapshotGetter, CapStreamer, CapKeyPager)
+}
+
+// narrowCapabilities serves the snapshot reads, streaming, listing of keys and size only if the underlying KV store
+// does
+func (s *prefixKVStore) narrowCapabilities(set CapabilitySet) CapabilitySet {
+	return narrowToUnderlying(set, []KVStore{s.kvStore}, CapSnapshotGetter, CapStreamer, CapKeyPager, CapSizer)
+}
+
+// narrowCapabilities serves streaming and listing of keys only if the underlying KV store lists its keys, which is
+// what merging the buckets of a split namespace requires
+func (s *splitKVStore) narrowCapabilities(set CapabilitySet) CapabilitySet {
+	if !Capabilities(s.kvStore).Has(CapKeyPager) {
+		return set.Without(CapStreamer, CapKeyPager)
+	}
+	return set
+}
+
+// narrowCapabilities serves streaming and listing of keys only if every shard does
+func (s *shardedKVStore) narrowCapabilities(set CapabilitySet) CapabilitySet {
+	return narrowToUnderlying(set, s.shards, CapStreamer, CapKeyPager)
+}
+
+// narrowCapabilities serves warming up only if the underlying KV store lists its keys
+func (c *cachedKVStore) narrowCapabilities(set CapabilitySet) CapabilitySet {
+	if !Capabilities(c.kvStore).Has(CapKeyPager) {
+		return set.Without(CapWarmer)
+	}
+	return set
+}
+
+// narrowCapabilities serves reading the history only if it is kept
+func (s *auditKVStore) narrowCapabilities(set CapabilitySet) CapabilitySet {
+	if !s.history {
+		return set.Without(CapHistoryReader)
+	}
+	return set
+}
+
+// narrowToUnderlying removes each of the forwarded capabilities from the set unless every underlying KV store serves
+// it
+func narrowToUnderlying(set CapabilitySet, underlying []KVStore, forwarded ...Capability) CapabilitySet {
+	for _, kvStore := range underlying {
+		served := Capabilities(kvStore)
+		for _, c := range forwarded {
+			if !served.Has(c) {
+				set = set.Without(c)
+			}
+		}
+	}
+	return set
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapabilities(t *testing.T) {
+	require := require.New(t)
+
+	mem := CapabilitySet(0).With(CapStreamer, CapCountingCommitter, CapBulkInserter, CapClearable, CapEmptyChecker,
+		CapNamespaceIterator, CapSyncer, CapNamespaceManager, CapNamespaceSwapper, CapSnapshotGetter, CapUpdater,
+		CapRenamer, CapDequeuer, CapNamespaceInitializer, CapConditionalDeleter, CapEntryMover, CapUnsafeGetter,
+		CapKeyPager, CapSnapshotter, CapSizer, CapSnapshotOpener, CapValueStreamer, CapSchemaVersioner, CapSwapper,
+		CapNamespaceTreeManager, CapDurableCommitter, CapBulkExistenceChecker, CapRangeGetter,
+		CapSnapshotExporter, CapSortedIngester, CapIdempotentCommitter, CapModifier, CapNamespaceSchemaCreator,
+		CapOutboxCommitter, CapCommitBarrier, CapNamespaceFlusher)
+	bolt := mem.With(CapWarmer, CapMappedGetter, CapReadTxnObserver)
+	// BadgerDB has no namespaces of its own to iterate over, swap or nest, nor a way to flush its memtables on demand
+	badger := mem.Without(CapNamespaceIterator, CapNamespaceSwapper, CapNamespaceTreeManager, CapNamespaceFlusher).
+		With(CapSplitCommitter, CapWarmer, CapLSMStatsReporter, CapValueLogGCObserver)
+
+	dbCfg := cfg
+	dbCfg.UseBadgerDB = false
+	require.Equal(mem, Capabilities(NewMemKVStore()))
+	require.Equal(bolt, Capabilities(NewOnDiskDB(dbCfg)))
+	dbCfg.UseBadgerDB = true
+	require.Equal(badger, Capabilities(NewOnDiskDB(dbCfg)))
+	require.True(Capabilities(NewMemKVStore()).Has(CapStreamer, CapKeyPager))
+	require.False(Capabilities(NewMemKVStore()).Has(CapStreamer, CapWarmer))
+	require.Equal("Streamer,KeyPager,Sizer", CapabilitySet(0).With(CapSizer, CapStreamer, CapKeyPager).String())
+
+	// the decorators serve only the capabilities of their own, and those they forward if the KV stores they wrap do
+	none := CapabilitySet(0)
+	for name, c := range map[string]struct {
+		kvStore  KVStore
+		expected CapabilitySet
+	}{
+		"checksum":           {NewMemKVStore(WithChecksums(bucket1)), none.With(CapSnapshotGetter, CapStreamer, CapKeyPager)},
+		"checksum over blob": {NewMemKVStore(WithChecksums(bucket1), WithDedup(16)), none},
+		"timestamp":          {NewMemKVStore(WithTimestamps(bucket1)), none.With(CapTimestampGetter)},
+		"audit":              {NewMemKVStore(WithAuditLog(0, false)), none.With(CapAuditLogReader, CapIncrementalBackuper)},
+		"audit history": {
+			NewMemKVStore(WithAuditLog(0, false), WithAuditHistory()),
+			none.With(CapAuditLogReader, CapHistoryReader, CapIncrementalBackuper),
+		},
+		"last written":     {NewMemKVStore(WithLastWritten(bucket1)), none.With(CapLastWrittenGetter)},
+		"write rate limit": {NewMemKVStore(WithWriteRateLimit(bucket1, 1, 1)), none.With(CapRateLimitedCommitter)},
+		"insertion order": {
+			NewMemKVStore(WithInsertionOrder(bucket1, KeepPosition)),
+			none.With(CapInsertionOrderIterator),
+		},
+		"key prefix": {
+			NewMemKVStore(WithKeyPrefix(bucket1, []byte("tag"))),
+			none.With(CapSnapshotGetter, CapStreamer, CapKeyPager, CapSizer),
+		},
+		"split namespace": {
+			NewMemKVStore(WithSplitNamespace(bucket1, 4)),
+			none.With(CapStreamer, CapKeyPager),
+		},
+		"key filter": {
+			NewMemKVStore(WithKeyFilter(bucket1, 1024)),
+			none.With(CapBulkExistenceChecker),
+		},
+		"size limit":       {NewMemKVStore(WithSizeLimit(1024, EvictLRU, bucket1)), none.With(CapSizer)},
+		"scheduled purge":  {NewMemKVStore(WithScheduledPurge(bucket1, time.Hour)), none},
+		"latency metrics":  {NewMemKVStore(WithLatencyMetrics(16)), none},
+		"hot keys":         {NewMemKVStore(WithHotKeyTracking(time.Minute, 10)), none.With(CapHotKeyReporter)},
+		"cache":            {NewCachedKVStore(NewMemKVStore(), 16), none.With(CapWarmer)},
+		"cache over cache": {NewCachedKVStore(NewCachedKVStore(NewMemKVStore(), 16), 16), none},
+		"sharded": {
+			NewShardedKVStore([]KVStore{NewMemKVStore(), NewMemKVStore()}, 16),
+			none.With(CapStreamer, CapKeyPager),
+		},
+		"sharded over cache": {
+			NewShardedKVStore([]KVStore{NewMemKVStore(), NewCachedKVStore(NewMemKVStore(), 16)}, 16),
+			none,
+		},
+		"alias":      {NewAliasKVStore(NewMemKVStore()), none.With(CapNamespaceAliaser)},
+		"timeout":    {NewTimeoutKVStore(NewMemKVStore(), time.Second), none},
+		"hooked":     {NewHookedKVStore(NewMemKVStore()), none},
+		"watchable":  {NewWatchableKVStore(NewMemKVStore()), none},
+		"replicated": {NewReplicatedKVStore([]KVStore{NewMemKVStore(), NewMemKVStore()}), none},
+		"tee":        {NewTeeKVStore(NewMemKVStore(), NewMemKVStore(), TeeFatal), none},
+	} {
+		require.Equal(c.expected, Capabilities(c.kvStore), name)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// compactTxSize is the size of the records copied into the compacted file in one transaction
+const compactTxSize = 64 * 1024 * 1024
+
+// compactSuffix is the suffix of the path of the compacted file, while it is written
+const compactSuffix = ".compact"
+
+//======================================
+// private functions
+//======================================
+
+// compactBolt copies the buckets and records of the DB into a new file next to the path, which holds only the pages
+// in use, and returns the path of the new file. The new file is removed if it fails
+func compactBolt(db *bolt.DB, path string) (string, error) {
+	tmp := path + compactSuffix
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return "", errors.Wrapf(err, "failed to remove stale compacted file %s", tmp)
+	}
+	dst, err := bolt.Open(tmp, fileMode, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to create compacted file %s", tmp)
+	}
+	if err := copyBolt(dst, db); err != nil {
+		if closeErr := dst.Close(); closeErr != nil {
+			err = errors.Wrapf(err, "failed to close compacted file: %v", closeErr)
+		}
+		return "", removeCompacted(tmp, err)
+	}
+	if err := dst.Close(); err != nil {
+		return "", removeCompacted(tmp, errors.Wrap(err, "failed to close compacted file"))
+	}
+	return tmp, nil
+}
+
+// replaceCompacted replaces the file of the path with the compacted file, and fsyncs the directory so that the
+// replacement survives a crash. The compacted file is removed if it fails, leaving the file of the path as is
+func replaceCompacted(tmp, path string) error {
+	if err := os.Rename(tmp, path); err != nil {
+		return removeCompacted(tmp, errors.Wrapf(err, "failed to replace %s with compacted file", path))
+	}
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return errors.Wrapf(err, "failed to open directory of %s", path)
+	}
+	defer dir.Close()
+	return errors.Wrapf(dir.Sync(), "failed to fsync directory of %s", path)
+}
+
+// removeCompacted removes the compacted file not used, and returns the error it is removed for
+func removeCompacted(tmp string, err error) error {
+	if removeErr := os.Remove(tmp); removeErr != nil && !os.IsNotExist(removeErr) {
+		return errors.Wrapf(err, "failed to remove compacted file: %v", removeErr)
+	}
+	return err
+}
+
+// copyBolt copies the buckets, nested buckets included, and the records of src into dst, committing a transaction of
+// dst every compactTxSize bytes. The pages of dst are filled up, since it is written in key order
+func copyBolt(dst, src *bolt.DB) error {
+	tx, err := dst.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// the last transaction is rolled back unless committed, which is a no-op once it is
+		_ = tx.Rollback()
+	}()
+
+	var size int64
+	if err := src.View(func(srcTx *bolt.Tx) error {
+		return srcTx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			return copyBucket(nil, name, bucket, func(path [][]byte, k, v []byte, seq uint64) error {
+				if size += int64(len(k) + len(v)); size > compactTxSize {
+					if err := tx.Commit(); err != nil {
+						return err
+					}
+					if tx, err = dst.Begin(true); err != nil {
+						return err
+					}
+					size = int64(len(k) + len(v))
+				}
+				return putCompacted(tx, path, k, v, seq)
+			})
+		})
+	}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// copyBucket calls fn on the bucket of the name under the path of its parent buckets, and then on each of its records
+// and nested buckets in key order, a nested bucket being passed with a nil value and its sequence
+func copyBucket(
+	path [][]byte,
+	name []byte,
+	bucket *bolt.Bucket,
+	fn func([][]byte, []byte, []byte, uint64) error,
+) error {
+	if err := fn(path, name, nil, bucket.Sequence()); err != nil {
+		return err
+	}
+	path = append(append([][]byte(nil), path...), name)
+	return bucket.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return copyBucket(path, k, bucket.Bucket(k), fn)
+		}
+		return fn(path, k, v, 0)
+	})
+}
+
+// putCompacted writes the record, or creates the bucket of the sequence if value is nil, under the path of buckets
+func putCompacted(tx *bolt.Tx, path [][]byte, key, value []byte, seq uint64) error {
+	if len(path) == 0 {
+		bucket, err := tx.CreateBucket(key)
+		if err != nil {
+			return err
+		}
+		return bucket.SetSequence(seq)
+	}
+	parent := tx.Bucket(path[0])
+	for _, name := range path[1:] {
+		parent = parent.Bucket(name)
+	}
+	// the records are written in key order, so the pages are best filled up
+	parent.FillPercent = 1.0
+	if value == nil {
+		bucket, err := parent.CreateBucket(key)
+		if err != nil {
+			return err
+		}
+		return bucket.SetSequence(seq)
+	}
+	return parent.Put(key, value)
+}
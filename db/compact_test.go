@@ -0,0 +1,97 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestCompactOnClose(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	path := "test-compact-on-close.bolt"
+	compacted := path + compactSuffix
+	testutil.CleanupPath(t, path)
+	testutil.CleanupPath(t, compacted)
+	defer testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, compacted)
+	dbCfg := cfg
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+
+	value := bytes.Repeat([]byte{0xef}, 1024)
+	churn := func(kvStore KVStore) {
+		require.NoError(kvStore.Start(ctx))
+		for i := 0; i < 2000; i++ {
+			batch := NewBatch()
+			require.NoError(batch.Put(bucket1, []byte(fmt.Sprintf("key_%04d", i)), value, ""))
+			require.NoError(kvStore.Commit(batch))
+		}
+		// only every tenth record is kept, the pages of the others are free
+		for i := 0; i < 2000; i++ {
+			if i%10 != 0 {
+				require.NoError(kvStore.Delete(bucket1, []byte(fmt.Sprintf("key_%04d", i))))
+			}
+		}
+		require.NoError(kvStore.(NamespaceManager).CreateNamespace(bucket2))
+	}
+	verify := func() {
+		kvStore := NewOnDiskDB(dbCfg)
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		for i := 0; i < 2000; i++ {
+			v, err := kvStore.Get(bucket1, []byte(fmt.Sprintf("key_%04d", i)))
+			if i%10 != 0 {
+				require.True(isNotExist(err))
+				continue
+			}
+			require.NoError(err)
+			require.Equal(value, v)
+		}
+		exists, err := kvStore.(NamespaceManager).HasNamespace(bucket2)
+		require.NoError(err)
+		require.True(exists)
+	}
+	fileSize := func() int64 {
+		info, err := os.Stat(path)
+		require.NoError(err)
+		return info.Size()
+	}
+
+	// the file is closed as is if the compaction fails
+	require.NoError(os.Mkdir(compacted, 0700))
+	f, err := os.Create(compacted + "/blocker")
+	require.NoError(err)
+	require.NoError(f.Close())
+	kvStore := NewOnDiskDB(dbCfg, WithCompactOnClose(true))
+	churn(kvStore)
+	churned := fileSize()
+	require.NoError(kvStore.Stop(ctx))
+	require.Equal(churned, fileSize())
+	require.NoError(os.RemoveAll(compacted))
+	verify()
+
+	// the file reopened is smaller and holds the same records
+	kvStore = NewOnDiskDB(dbCfg, WithCompactOnClose(true))
+	require.NoError(kvStore.Start(ctx))
+	require.NoError(kvStore.Stop(ctx))
+	require.True(fileSize() < churned/2)
+	_, err = os.Stat(compacted)
+	require.True(os.IsNotExist(err))
+	verify()
+}
@@ -8,12 +8,19 @@ package db
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/boltdb/bolt"
+	"github.com/dgraph-io/badger"
+	"github.com/facebookgo/clock"
 	"github.com/pkg/errors"
 
 	"github.com/iotexproject/iotex-core/config"
+	"github.com/iotexproject/iotex-core/logger"
 	"github.com/iotexproject/iotex-core/pkg/lifecycle"
 )
 
@@ -26,9 +33,85 @@ var (
 	ErrAlreadyDeleted = errors.New("already deleted from DB")
 	// ErrAlreadyExist indicates certain item already exists in Blockchain database
 	ErrAlreadyExist = errors.New("already exist in DB")
+	// ErrReadOnlyTxn indicates a write is attempted through a read-only handle of the DB
+	ErrReadOnlyTxn = errors.New("write attempted in read-only transaction")
+	// ErrBatchAlreadyCommitted indicates a batch is committed again after being committed successfully
+	ErrBatchAlreadyCommitted = errors.New("batch already committed")
+	// ErrBatchTooLarge indicates an entry is staged into a batch which is at its limits already
+	ErrBatchTooLarge = errors.New("batch too large")
+	// ErrPermissionDenied indicates an operation on a namespace is not permitted
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrDBClosed indicates an operation is attempted after the DB is stopped
+	ErrDBClosed = errors.New("DB is closed")
+	// ErrSchemaTooNew indicates the DB is of a schema version later than the binary understands
+	ErrSchemaTooNew = errors.New("schema version of DB too new")
+	// ErrSequencePruned indicates a record is read as of a commit whose history is not kept anymore
+	ErrSequencePruned = errors.New("sequence pruned")
+	// ErrDataLoss indicates the KV store is stopped without making all writes acknowledged before durable
+	ErrDataLoss = errors.New("acknowledged writes may be lost")
+	// ErrChecksumMismatch indicates a value read does not match the checksum it is stored with
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrLeakedReadTxn indicates the KV store is stopped with read transactions handed out and not released yet
+	ErrLeakedReadTxn = errors.New("read transactions leaked")
+	// ErrOutOfRange indicates a range of a value to read is not within the value
+	ErrOutOfRange = errors.New("range out of value")
+	// ErrRateLimited indicates a write is rejected as its namespace is written to beyond its rate limit
+	ErrRateLimited = errors.New("write rate limited")
+	// ErrTxnConflict indicates a transaction conflicts with another one, and may succeed if run again
+	ErrTxnConflict = errors.New("transaction conflict")
+	// ErrTxnRetryExhausted indicates a transaction keeps conflicting after being run as many times as allowed
+	ErrTxnRetryExhausted = errors.New("transaction retries exhausted")
+	// ErrDBLocked indicates the DB is locked by another process writing it
+	ErrDBLocked = errors.New("DB is locked by another writer")
 )
 
+// KVError is the error of an operation on a record, returned by Put, PutIfNotExists, Get and Delete of the KV stores
+// created by NewMemKVStore and NewOnDiskDB. errors.Cause returns the cause of Err as usual, e.g. ErrNotExist, and
+// KVErrorOf extracts the KVError from an error wrapping it
+type KVError struct {
+	// Op is the name of the operation, e.g. "Get"
+	Op string
+	// Namespace is the namespace of the record
+	Namespace string
+	// Key is the key of the record
+	Key []byte
+	// Err is the error of the operation
+	Err error
+}
+
+// Error returns the error message naming the operation and the record
+func (e *KVError) Error() string {
+	return fmt.Sprintf("failed to %s key = %x of namespace %s: %v", e.Op, e.Key, e.Namespace, e.Err)
+}
+
+// Cause returns the error of the operation, so errors.Cause sees through KVError
+func (e *KVError) Cause() error { return e.Err }
+
+// Unwrap returns the error of the operation
+func (e *KVError) Unwrap() error { return e.Err }
+
+// KVErrorOf returns the KVError the error is or wraps, and false if there is none
+func KVErrorOf(err error) (*KVError, bool) {
+	for err != nil {
+		if e, ok := err.(*KVError); ok {
+			return e, true
+		}
+		causer, ok := err.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		err = causer.Cause()
+	}
+	return nil, false
+}
+
 // KVStore is the interface of KV store.
+//
+// Stop flushes and closes the KV store. A nil error means every write acknowledged before it, by a commit returning
+// or by a BufferedWriter accepting a batch, is durable. An error whose cause is ErrDataLoss means some of them may be
+// lost. An error of ctx being done means the KV store is still stopping, and Stop may be called again to wait for the
+// result. Any other error is a failure to release the resources of the KV store, and loses no acknowledged write. The
+// in-memory KV store keeps nothing durable, so its writes are as good as lost upon Stop
 type KVStore interface {
 	lifecycle.StartStopper
 
@@ -36,7 +119,8 @@ type KVStore interface {
 	Put(string, []byte, []byte) error
 	// Put puts a record only if (namespace, key) doesn't exist, otherwise return ErrAlreadyExist
 	PutIfNotExists(string, []byte, []byte) error
-	// Get gets a record by (namespace, key)
+	// Get gets a record by (namespace, key). A record stored with an empty value is returned with an empty value
+	// rather than nil, and a missing key returns ErrNotExist
 	Get(string, []byte) ([]byte, error)
 	// Delete deletes a record by (namespace, key)
 	Delete(string, []byte) error
@@ -44,108 +128,1118 @@ type KVStore interface {
 	Commit(KVStoreBatch) error
 }
 
-const (
-	keyDelimiter = "."
+type (
+	// KVStoreOption sets an option of the KV store
+	KVStoreOption func(*kvStoreOptions)
+
+	// kvStoreOptions is the collection of options of the KV store
+	kvStoreOptions struct {
+		// truncate allows BadgerDB to truncate the corrupted tail of value log on open
+		truncate bool
+		// groupCommitInterval is the interval to fsync the commits of BadgerDB as a group, 0 means each commit is
+		// fsynced on its own
+		groupCommitInterval time.Duration
+		// valueLogFileSize is the size BadgerDB rotates its value log files at, 0 means the default of BadgerDB
+		valueLogFileSize int64
+		// memTableSize is the size BadgerDB flushes its memtables at, 0 means the default of BadgerDB
+		memTableSize int64
+		// valueLogGCInterval is the interval to run the value log GC of BadgerDB, 0 means never
+		valueLogGCInterval time.Duration
+		// valueLogGCRatio is the ratio of stale data above which the value log GC rewrites a value log file
+		valueLogGCRatio float64
+		// aggressiveGCThreshold is the size of the value logs above which the value log GC runs with
+		// aggressiveGCRatio until no more file is rewritten, 0 means never
+		aggressiveGCThreshold int64
+		// aggressiveGCRatio is the ratio of stale data above which the aggressive value log GC rewrites a file
+		aggressiveGCRatio float64
+		// retainedVersions is the number of versions BadgerDB keeps of each key, 0 means the default of BadgerDB
+		retainedVersions int
+		// memShards is the number of shards of the in-memory KV store
+		memShards int
+		// explicitNamespaces makes writes to a namespace not created yet fail, rather than create it
+		explicitNamespaces bool
+		// namespaces is the namespaces created on start in explicit namespace mode
+		namespaces []string
+		// blobThreshold is the size above which values are kept in blob files under blobDir
+		blobThreshold int
+		// blobDir is the directory of blob files, empty means values are always kept in the KV store
+		blobDir string
+		// dedup is whether values larger than blobThreshold are kept in the DB once per distinct value
+		dedup bool
+		// frontCodedNamespaces is the namespaces whose keys BoltDB stores front-coded
+		frontCodedNamespaces []string
+		// checksummedNamespaces is the namespaces whose values are prefixed with their checksums
+		checksummedNamespaces []string
+		// timestampedNamespaces is the namespaces whose values are prefixed with the time they are written at
+		timestampedNamespaces []string
+		// clk is the clock stamping the values of timestampedNamespaces and the records of the audit log
+		clk clock.Clock
+		// auditLog makes the KV store keep the audit log of its commits
+		auditLog bool
+		// auditRetention is the number of latest commits kept in the audit log, 0 means unbounded
+		auditRetention uint64
+		// auditValueHashes makes the audit log record the hash of each value written
+		auditValueHashes bool
+		// auditHistory makes the audit log keep the value overwritten by each write
+		auditHistory bool
+		// keyIndexNamespaces is the namespaces whose keys BadgerDB mirrors in memory
+		keyIndexNamespaces []string
+		// schemaVersion is the schema version the DB is upgraded to on start, 0 means the schema is not managed
+		schemaVersion uint32
+		// migrations is the migrations upgrading the DB to schemaVersion
+		migrations *SchemaMigrations
+		// readTxnWatchdog is the age above which a read transaction held open by BoltDB is warned of, 0 means never
+		readTxnWatchdog time.Duration
+		// keyValidators is the validator of the keys written to each namespace
+		keyValidators map[string]func([]byte) error
+		// sizeBudget is the size of the DB beyond which the records of evictableNamespaces are evicted, 0 means no limit
+		sizeBudget int64
+		// evictionPolicy is the order the records of evictableNamespaces are evicted in
+		evictionPolicy EvictionPolicy
+		// evictableNamespaces is the namespaces whose records are evicted to keep the DB within sizeBudget
+		evictableNamespaces []string
+		// compactOnClose makes BoltDB rewrite its file with only the pages in use on Stop
+		compactOnClose bool
+		// lastWrittenNamespaces is the namespaces whose key last written is tracked
+		lastWrittenNamespaces []string
+		// writeRateLimits is the rate limit of the writes to each limited namespace
+		writeRateLimits map[string]writeRateLimit
+		// keyPrefixes is the prefix shared by all keys of each prefixed namespace, which is elided from the keys stored
+		keyPrefixes map[string][]byte
+		// insertionOrders is the position an overwritten key takes in each namespace kept in insertion order
+		insertionOrders map[string]OverwritePosition
+		// scheduledPurges is the interval each purged namespace is emptied at
+		scheduledPurges map[string]time.Duration
+		// latencyMetrics makes the KV store observe the latency of the writes and the commits of each namespace
+		latencyMetrics bool
+		// latencyNamespaces is the number of distinct namespaces observed under their own label
+		latencyNamespaces int
+		// hotKeyWindow is the sliding window the accesses of each key are counted over, 0 means no hot key tracking
+		hotKeyWindow time.Duration
+		// hotKeySampleRate is the one in how many accesses sampled for hot key tracking
+		hotKeySampleRate int
+		// splitNamespaces is the number of buckets each split namespace is spread over, when it is created
+		splitNamespaces map[string]int
+		// keyFilters is the number of keys the key filter of each filtered namespace is sized for
+		keyFilters map[string]int
+		// writerLock makes the DB on disk take its lock file on open, and staleLockRecovery take over a lock file left
+		// by a process not running anymore
+		writerLock        bool
+		staleLockRecovery bool
+	}
 )
 
-// memKVStore is the in-memory implementation of KVStore for testing purpose
-type memKVStore struct {
-	data   *sync.Map
-	bucket map[string]struct{}
+// WithTruncate allows BadgerDB to recover from a corrupted value log on open by truncating the corrupted tail,
+// rather than failing to open. The data in the tail is lost
+func WithTruncate(truncate bool) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.truncate = truncate
+	}
 }
 
-// NewMemKVStore instantiates an in-memory KV store
-func NewMemKVStore() KVStore {
-	return &memKVStore{
-		bucket: make(map[string]struct{}),
-		data:   &sync.Map{},
+// WithGroupCommit makes BadgerDB fsync commits as a group every interval, rather than fsync each of them. This
+// amortizes the cost of fsync over all commits within an interval, at the cost of durability: a commit is durable
+// at most interval after it returns, so it may be lost upon a crash within that window. Sync and Stop fsync the
+// pending commits immediately. It has no effect on other KV stores
+func WithGroupCommit(interval time.Duration) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.groupCommitInterval = interval
 	}
 }
 
-func (m *memKVStore) Start(_ context.Context) error { return nil }
+// WithValueLogFileSize sets the size BadgerDB rotates its value log files at. The value log GC never rewrites the
+// file being written, and reclaims the space of a file only as a whole, so smaller files are reclaimed sooner at the
+// cost of more files. The number of entries a file holds at most is scaled down along with its size, since the GC
+// samples a number of entries proportional to it. It has no effect on other KV stores
+func WithValueLogFileSize(size int64) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.valueLogFileSize = size
+	}
+}
 
-func (m *memKVStore) Stop(_ context.Context) error { return nil }
+// WithRetainedVersions makes BadgerDB keep up to versions versions of each key through compactions, rather than the
+// latest one only, so that OpenAtVersion is able to read the DB as of an earlier commit, except for the keys deleted
+// since. The versions kept take disk space until compacted away. It has no effect on other KV stores
+func WithRetainedVersions(versions int) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.retainedVersions = versions
+	}
+}
 
-// Put inserts a <key, value> record
-func (m *memKVStore) Put(namespace string, key, value []byte) error {
-	m.bucket[namespace] = struct{}{}
-	m.data.Store(namespace+keyDelimiter+string(key), value)
-	return nil
+// WithMemTableSize sets the size BadgerDB flushes its memtables to tables of level 0 at, which is the size of the
+// tables as well. The value log GC only reclaims the values of the writes flushed and compacted, see WithValueLogGC, so
+// smaller memtables let it reclaim the space of the recent writes sooner, at the cost of more and smaller tables to
+// compact. It has no effect on other KV stores
+func WithMemTableSize(size int64) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.memTableSize = size
+	}
 }
 
-// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
-func (m *memKVStore) PutIfNotExists(namespace string, key, value []byte) error {
-	m.bucket[namespace] = struct{}{}
-	_, loaded := m.data.LoadOrStore(namespace+keyDelimiter+string(key), value)
-	if loaded {
-		return ErrAlreadyExist
+// WithValueLogGC makes BadgerDB run the value log GC every interval, which rewrites a value log file once at least
+// discardRatio of a sample of it is stale. BadgerDB v1.5 only considers the value log files before the one the last
+// memtable flush reached, and a value stale only once a compaction of the tables has dropped its version, so the space
+// of a write overwritten or deleted is not reclaimed until both are done, see WithMemTableSize. A lower ratio reclaims
+// more space at the cost of more rewriting. It has no effect on other KV stores
+func WithValueLogGC(interval time.Duration, discardRatio float64) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.valueLogGCInterval = interval
+		opts.valueLogGCRatio = discardRatio
+	}
+}
+
+// WithAggressiveValueLogGC makes a run of the value log GC of WithValueLogGC, once the value logs of BadgerDB exceed
+// threshold bytes, rewrite the files with discardRatio instead, and keep rewriting until no file is rewritten or the
+// value logs are within threshold again, e.g. to reclaim the space of bulk deletes soon. It has no effect without
+// WithValueLogGC, or on other KV stores
+func WithAggressiveValueLogGC(threshold int64, discardRatio float64) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.aggressiveGCThreshold = threshold
+		opts.aggressiveGCRatio = discardRatio
 	}
-	return nil
 }
 
-// Get retrieves a record
-func (m *memKVStore) Get(namespace string, key []byte) ([]byte, error) {
-	if _, ok := m.bucket[namespace]; !ok {
-		return nil, errors.Wrapf(bolt.ErrBucketNotFound, "bucket = %s", namespace)
+// WithMemShards sets the number of shards the in-memory KV store splits its records into, each guarded by its own
+// lock, so that concurrent operations on different keys rarely contend. It has no effect on other KV stores
+func WithMemShards(shards int) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.memShards = shards
 	}
-	value, _ := m.data.Load(namespace + keyDelimiter + string(key))
-	if value != nil {
-		return value.([]byte), nil
+}
+
+// WithExplicitNamespaces makes writes to a namespace which has not been created yet fail with ErrInvalidDB, rather
+// than create the namespace implicitly, so that a misspelled namespace is caught early. The namespaces given are
+// created on start and re-created by Clear, others must be created by NamespaceManager.CreateNamespace before being
+// written to
+func WithExplicitNamespaces(namespaces ...string) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.explicitNamespaces = true
+		opts.namespaces = append(opts.namespaces, namespaces...)
+	}
+}
+
+// WithExternalBlobs makes the on-disk KV store keep values larger than threshold bytes in content-addressed files
+// under dir, and only references to them in the DB, which reduces the write amplification of large values. A blob
+// file is removed once no record references it. The number of references to each blob is kept in a reserved
+// namespace "externalBlobRefs". Each value is tagged in the DB in this mode, so it must not be turned on or off for
+// an existing DB. Only the methods of KVStore are provided in this mode. It has no effect on the in-memory KV store
+func WithExternalBlobs(threshold int, dir string) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.blobThreshold = threshold
+		opts.blobDir = dir
+	}
+}
+
+// WithDedup makes the KV store keep values larger than threshold bytes once per distinct value, in a reserved
+// namespace "dedupBlobs" keyed by the hash of the value, and only references to them in the records. The number of
+// references to each value is kept in the reserved namespace "externalBlobRefs", and a value is deleted along with
+// the last record referencing it, in the same commit. Each value is tagged in the DB in this mode, so it must not be
+// turned on or off for an existing DB. Only the methods of KVStore are provided in this mode. WithExternalBlobs takes
+// precedence over it
+func WithDedup(threshold int) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.blobThreshold = threshold
+		opts.dedup = true
 	}
-	return nil, errors.Wrapf(ErrNotExist, "key = %x", key)
 }
 
-// Delete deletes a record
-func (m *memKVStore) Delete(namespace string, key []byte) error {
-	m.data.Delete(namespace + keyDelimiter + string(key))
+// WithFrontCoding makes BoltDB store the keys of the namespaces front-coded: the records are kept in blocks of up to
+// 16 sorted records, each key stored as the length of the prefix it shares with the previous key in the block and the
+// rest of the key. This shrinks namespaces of long keys with common prefixes, e.g. hashes under a common tag, at the
+// cost of decoding a block on each read and re-encoding it on each write. The records of a front-coded bucket are not
+// readable as plain records, so the mode must not be turned on or off for an existing namespace. It has no effect on
+// other KV stores
+func WithFrontCoding(namespaces ...string) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.frontCodedNamespaces = append(opts.frontCodedNamespaces, namespaces...)
+	}
+}
+
+// WithTimestamps makes the KV store prefix each value of the namespaces with an 8-byte timestamp of when it is written,
+// which TimestampGetter.GetWithTimestamp returns, while Get returns the value without it. The timestamps are taken
+// from the clock given by WithClock, and kept increasing across the writes of a KV store even if the clock goes back,
+// but not across restarts. The values of a timestamped namespace are not readable without the mode, so it must not be
+// turned on or off for an existing namespace. Only the methods of KVStore and TimestampGetter are provided in this mode
+func WithTimestamps(namespaces ...string) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.timestampedNamespaces = append(opts.timestampedNamespaces, namespaces...)
+	}
+}
+
+// WithChecksums makes the KV store prefix each value of the namespaces with its CRC-32 checksum, and verify it on
+// Get, SnapshotGet and StreamAll, which return ErrChecksumMismatch for a value corrupted on disk rather than the
+// corrupted value. The checksum is 4 bytes per value and a hash per read and write. Each value of the namespaces is
+// prefixed in the DB in this mode, so a namespace must not be turned on or off for an existing DB, and its records
+// must not be counters. Only the methods of KVStore, SnapshotGetter, Streamer and KeyPager are provided in this mode.
+// NewScrubber verifies the checksums in the background
+func WithChecksums(namespaces ...string) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.checksummedNamespaces = append(opts.checksummedNamespaces, namespaces...)
+	}
+}
+
+// WithAuditLog makes the KV store record each commit in the audit log, kept in a reserved namespace "auditLog", which
+// AuditLogReader.AuditLog replays. A record holds the sequence and the time of the commit, and the type, namespace and
+// key of each write, as well as the hash of the value if valueHashes is set. The record is written in the same commit
+// as the writes, so the audit log never diverges from the records. Only the latest retention records are kept, 0
+// means all of them. Only the methods of KVStore, AuditLogReader, HistoryReader and IncrementalBackuper are provided in
+// this mode
+func WithAuditLog(retention uint64, valueHashes bool) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.auditLog = true
+		opts.auditRetention = retention
+		opts.auditValueHashes = valueHashes
+	}
+}
+
+// WithAuditHistory makes the audit log also keep the values each commit overwrites, in a reserved namespace
+// "auditHistory" trimmed along with the records, so that HistoryReader.GetAsOf reads a record as of any commit still
+// in the audit log. The history is as long as the retention of WithAuditLog, and a commit made before the mode is
+// turned on has no history. It costs a read of each record written by a commit, and the space of the values
+// overwritten. It has no effect without WithAuditLog
+func WithAuditHistory() KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.auditHistory = true
+	}
+}
+
+// WithInMemoryKeyIndex makes BadgerDB keep the sorted keys of the namespaces in memory, rebuilt from disk on start and
+// updated on each commit, so that KeysPaged lists them without reading the disk. Values are still read from disk. The
+// index costs the length of each key plus about 16 bytes of memory, a longer start to read all keys, and a write of a
+// new or deleted key moves the keys after it in the sorted slice, which is O(n). The index of a namespace is dropped
+// once it grows beyond 4M keys, and KeysPaged reads the disk for it afterwards. It has no effect on other KV stores
+func WithInMemoryKeyIndex(namespaces ...string) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.keyIndexNamespaces = append(opts.keyIndexNamespaces, namespaces...)
+	}
+}
+
+// WithReadTxnWatchdog makes BoltDB log a warning once a read transaction held beyond a single read, e.g. by a value of
+// GetMapped not released, stays open longer than threshold, which is likely a leak that keeps the file growing. The
+// read transactions are checked every threshold, so one is warned of within twice threshold. It has no effect on other
+// KV stores
+func WithReadTxnWatchdog(threshold time.Duration) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.readTxnWatchdog = threshold
+	}
+}
+
+// WithSchema makes the KV store record the schema version of its DB in a reserved namespace "schema", and
+// upgrade the DB to version on start by running the migrations in order. A new DB is recorded at version right away,
+// and a DB with records but no version recorded is taken as version 0. Start fails with ErrSchemaTooNew if the DB is
+// of a later version, rather than reading a format it does not understand. Clear removes the version as well, it is
+// recorded again on next start
+func WithSchema(version uint32, migrations *SchemaMigrations) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.schemaVersion = version
+		opts.migrations = migrations
+	}
+}
+
+// WithKeyValidator makes the KV store check each key written to the namespace by Put, PutIfNotExists and Delete, and
+// each key of the entries of the namespace committed by Commit, with fn before writing anything. A key fn returns an
+// error for is rejected with that error, so that a malformed key is caught where it is written rather than read back
+// wrong later. The keys of the namespaces without a validator are not checked, and a namespace has at most one
+// validator, the last one given
+func WithKeyValidator(namespace string, fn func(key []byte) error) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		if opts.keyValidators == nil {
+			opts.keyValidators = make(map[string]func([]byte) error)
+		}
+		opts.keyValidators[namespace] = fn
+	}
+}
+
+// WithSizeLimit makes the KV store keep the size of its DB, as reported by Sizer.Size, within budget bytes, for a DB
+// used as a cache tier. Once the DB grows beyond the budget, the records of the evictable namespaces are evicted in the
+// background in the order of the policy until it is within the budget again. Only the evictable namespaces are ever
+// evicted from, the records of any other namespace are protected, and the DB stays beyond the budget if they alone
+// exceed it. The size is checked after each write, and the order is tracked in memory, so the records found on start
+// are evicted first, in the order they are written in for EvictOldest of a namespace of WithTimestamps, in key order
+// otherwise. BoltDB reuses the pages freed by an eviction, while BadgerDB only shrinks its files once they are
+// compacted and their value logs garbage collected, so an eviction may empty the evictable namespaces without bringing
+// it within the budget right away. Only the methods of KVStore and Sizer are provided in this mode
+func WithSizeLimit(budget int64, policy EvictionPolicy, evictable ...string) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.sizeBudget = budget
+		opts.evictionPolicy = policy
+		opts.evictableNamespaces = append(opts.evictableNamespaces, evictable...)
+	}
+}
+
+// WithCompactOnClose makes Stop of BoltDB copy the records into a new file next to the DB file, which holds only the
+// pages in use, and replace the DB file with it once closed, so that the space of the pages freed by deletes is given
+// back to the disk on a graceful shutdown. It takes as long as reading all records and writing them again, and as
+// much free disk space as the records take. The DB file is closed as is if the compaction fails, and is never left
+// partially replaced. It is skipped for a read-only DB, and has no effect on other KV stores
+func WithCompactOnClose(compact bool) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.compactOnClose = compact
+	}
+}
+
+// WithLastWritten makes the KV store track the key last written to each of the namespaces, kept in a reserved
+// namespace "lastWritten" and updated in the same commit as the write, which LastWrittenGetter.LastWritten returns in
+// O(1) whatever the order of the keys. It costs a write of the key along with each commit to the namespaces. Only the
+// methods of KVStore and LastWrittenGetter are provided in this mode
+func WithLastWritten(namespaces ...string) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.lastWrittenNamespaces = append(opts.lastWrittenNamespaces, namespaces...)
+	}
+}
+
+// WithWriteRateLimit makes the KV store limit the writes to the namespace to opsPerSec entries per second on average,
+// with bursts of up to burst entries, by a token bucket refilled by the clock given by WithClock. Put, PutIfNotExists
+// and Delete take a token each, and Commit a token per entry of the namespace, all of them or none. A write finding
+// too few tokens returns ErrRateLimited at once and writes nothing, while RateLimitedCommitter.WaitCommit waits for
+// the tokens until its context is done. A batch of more entries of the namespace than burst is always rejected. The
+// writes to other namespaces are never limited, and a namespace has at most one limit, the last one given. Only the
+// methods of KVStore and RateLimitedCommitter are provided in this mode
+func WithWriteRateLimit(namespace string, opsPerSec, burst int) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		if opts.writeRateLimits == nil {
+			opts.writeRateLimits = make(map[string]writeRateLimit)
+		}
+		opts.writeRateLimits[namespace] = writeRateLimit{opsPerSec: opsPerSec, burst: burst}
+	}
+}
+
+// WithScheduledPurge makes the KV store delete all records of the namespace every interval of the clock given by
+// WithClock, e.g. to reset a namespace of daily counters, which costs far less than an expiry per record. A purge
+// deletes the records in a single commit, so the namespace must be small enough for one, and holds off the writes
+// meanwhile, so that a read sees either all of the records or none of them, and a write lands either before the purge
+// or after it. A namespace has at most one schedule, the last one given. Only the methods of KVStore are provided in
+// this mode
+func WithScheduledPurge(namespace string, interval time.Duration) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		if opts.scheduledPurges == nil {
+			opts.scheduledPurges = make(map[string]time.Duration)
+		}
+		opts.scheduledPurges[namespace] = interval
+	}
+}
+
+// WithLatencyMetrics makes the KV store observe the latency of Put, PutIfNotExists and Delete as the op "write", and of
+// Commit as the op "commit", on the histogram iotex_db_namespace_latency_seconds labeled by the namespace written, as
+// timed by the clock given by WithClock. A batch of several namespaces, or of none, is labeled "mixed". The first
+// maxNamespaces distinct namespaces written get a label of their own, and the rest are labeled "other", so that the
+// number of series stays bounded however many namespaces there are. Only the methods of KVStore are provided in this
+// mode
+func WithLatencyMetrics(maxNamespaces int) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.latencyMetrics = true
+		opts.latencyNamespaces = maxNamespaces
+	}
+}
+
+// WithHotKeyTracking makes the KV store count the accesses of each key over a sliding window of the clock given by
+// WithClock, for HotKeyReporter to report the keys accessed the most, e.g. to spot a key worth caching or a contended
+// counter worth splitting. Get, Put, PutIfNotExists, Delete and each entry of a commit are accesses, of which one in
+// sampleRate is counted to keep the overhead low, so the counts are estimates, scaled back by sampleRate. Only the
+// methods of KVStore and HotKeyReporter are provided in this mode
+func WithHotKeyTracking(window time.Duration, sampleRate int) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.hotKeyWindow = window
+		opts.hotKeySampleRate = sampleRate
+	}
+}
+
+// WithKeyPrefix makes the KV store elide the prefix all keys of the namespace share from the keys it stores, and add it
+// back to the keys it reads, e.g. for a namespace of keys under a common tag, so that the prefix takes no space per
+// record while the callers keep using the full keys. The keys keep their order, so KeyPager lists them in the same
+// order either way. A write of a key without the prefix is rejected with ErrInvalidDB, and such a key is never found.
+// Unlike WithFrontCoding, it works on every KV store. The keys of a prefixed namespace are stored without the prefix,
+// so the mode must not be turned on or off for an existing namespace. The keys of the namespaces without a prefix are
+// stored as is, and a namespace has at most one prefix, the last one given. Only the methods of KVStore,
+// SnapshotGetter, Streamer, KeyPager and Sizer are provided in this mode
+func WithKeyPrefix(namespace string, prefix []byte) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		if opts.keyPrefixes == nil {
+			opts.keyPrefixes = make(map[string][]byte)
+		}
+		opts.keyPrefixes[namespace] = append([]byte(nil), prefix...)
+	}
+}
+
+// WithSplitNamespace makes the KV store spread the records of the namespace over the given number of buckets by the
+// hash of their keys, e.g. for a namespace of so many records that a single B+tree of BoltDB degrades, so that each
+// bucket is a smaller tree. Get, Put, Delete and Commit go to the bucket of the key, while KeyPager and Streamer merge
+// the buckets back into key order, at the cost of a listing of every bucket. The buckets are the reserved namespaces
+// "<namespace>#<i>", and the number of buckets is recorded in the reserved namespace "splitNamespaces" on the first
+// start, after which the one recorded is used whatever is given, since the records would be looked for in another
+// bucket otherwise. The records written to the namespace before it is split are not found anymore, so the mode must
+// be turned on for a new namespace. Only the methods of KVStore, Streamer and KeyPager are provided in this mode
+func WithSplitNamespace(namespace string, buckets int) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		if opts.splitNamespaces == nil {
+			opts.splitNamespaces = make(map[string]int)
+		}
+		opts.splitNamespaces[namespace] = buckets
+	}
+}
+
+// WithKeyFilter makes the KV store keep a bloom filter of the keys of the namespace, so that a Get or BulkHas of a key
+// absent from it is answered without reading the DB, e.g. for a large append-mostly namespace mostly looked up for
+// keys it does not hold. The filter is sized for capacity keys, at 10 bits per key for a false positive rate of about
+// 1%, and split into blocks of 512 bytes, each write setting the bits of its key in a single block which is persisted
+// in the reserved namespace "keyFilters" in the same commit as the write, so that the filter is loaded on start rather
+// than rebuilt from the keys, and never misses a key committed. A deleted key keeps its bits, and the false positive
+// rate rises as more keys than capacity are written, so the filter is rebuilt from the keys on the start after the
+// keys written since it is built, deleted or not, exceed capacity, sized for twice the keys then or capacity,
+// whichever is larger. It is also built on the first start, so the mode may be turned on for a namespace holding
+// records already, but the records written while the mode is off are missed, so it must stay on once turned on. The
+// filter takes a lock serializing the writes. Only the methods of KVStore and BulkExistenceChecker are provided in
+// this mode
+func WithKeyFilter(namespace string, capacity int) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		if opts.keyFilters == nil {
+			opts.keyFilters = make(map[string]int)
+		}
+		opts.keyFilters[namespace] = capacity
+	}
+}
+
+// WithInsertionOrder makes the KV store keep the order the keys of the namespace are written in, for
+// InsertionOrderIterator.IterateInsertionOrder to visit the records in that order rather than in the order of their
+// keys, e.g. for an event log keyed by hash. Each key written for the first time takes the next sequence of the
+// namespace, kept in the reserved namespaces "insertionOrder" and "insertionPosition" and updated in the same commit
+// as the write, and a deleted key gives up its sequence. An overwritten key keeps its sequence or takes the next one,
+// as overwrite tells. It costs a read and up to four writes along with each write to the namespace, and the writes to
+// the namespaces are serialized. The records written before the mode is turned on are not visited until written
+// again. A namespace has at most one overwrite position, the last one given. Only the methods of KVStore and
+// InsertionOrderIterator are provided in this mode
+func WithInsertionOrder(namespace string, overwrite OverwritePosition) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		if opts.insertionOrders == nil {
+			opts.insertionOrders = make(map[string]OverwritePosition)
+		}
+		opts.insertionOrders[namespace] = overwrite
+	}
+}
+
+// WithWriterLock makes the DB on disk take a lock file on open, the path of the DB followed by ".lock", which is
+// flocked as long as the DB is open and names the PID and hostname of the process holding it, so that another
+// process opening the DB fails at once with ErrDBLocked naming the owner, rather than waiting for the lock of BoltDB
+// forever or failing with the opaque error of BadgerDB. A process which dies without stopping the DB leaves its lock
+// file behind, which the next open fails on as well until the file is removed, or unless in mode
+// WithStaleLockRecovery. It has no effect on the in-memory KV store
+func WithWriterLock() KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.writerLock = true
+	}
+}
+
+// WithStaleLockRecovery turns on WithWriterLock, and makes the DB take over a lock file on open if it is left behind
+// by a process of the same host which is not running anymore. A lock file of another host, e.g. of a DB on a network
+// file system, is never taken over, since whether its process is running is unknown
+func WithStaleLockRecovery() KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.writerLock = true
+		opts.staleLockRecovery = true
+	}
+}
+
+// WithClock sets the clock stamping the values in timestamp mode and the records of the audit log, timing the read
+// transactions of BoltDB and the group commits of BadgerDB, waiting between the retries to open the DB, and refilling
+// the write rate limits, which is the system clock by default. A mock clock makes all of them advance only as the
+// test moves it
+func WithClock(clk clock.Clock) KVStoreOption {
+	return func(opts *kvStoreOptions) {
+		opts.clk = clk
+	}
+}
+
+// Streamer is the interface of KV store which is able to visit every record of a namespace
+type Streamer interface {
+	// StreamAll calls fn on each record of the namespace. fn may be called concurrently by multiple goroutines,
+	// so it must be thread-safe. key and value are only valid during the call and must not be modified. The store
+	// is locked for reading during the whole scan, so fn must not write to the same store, or it deadlocks; stage
+	// the writes in a batch and commit it after StreamAll returns instead
+	StreamAll(string, func([]byte, []byte) error) error
+}
+
+// CountingCommitter is the interface of KV store which is able to commit a batch and report the applied entries
+type CountingCommitter interface {
+	// CommitCounting commits a batch and returns the number of applied and skipped entries. Unlike Commit, which is
+	// all-or-nothing, a PutIfNotExists entry whose key already exists is skipped on a best-effort basis per entry,
+	// and the rest of the batch still applies. The batch is still written in a single transaction, so a failure
+	// other than an existing key applies nothing
+	CommitCounting(KVStoreBatch) (uint64, uint64, error)
+}
+
+// SplitCommitter is the interface of KV store which is able to commit a batch too large for a single transaction
+type SplitCommitter interface {
+	// CommitSplit commits the batch in order in as many transactions as needed to stay within the transaction limits
+	// of the backend, and returns the number of transactions. Unlike Commit, only each transaction is atomic rather
+	// than the whole batch: upon an error, the transactions committed before it stay committed, and the batch is left
+	// as is
+	CommitSplit(KVStoreBatch) (int, error)
+}
+
+// KeyValue is a <key, value> record
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// BulkInserter is the interface of KV store which is able to insert records only if their keys do not exist yet
+type BulkInserter interface {
+	// PutIfNotExistsBatch inserts the records of the namespace whose keys do not exist yet, in a single transaction,
+	// and returns whether each record is inserted. An existing key is left untouched rather than failing the others,
+	// and of multiple records of the same key, only the first one is inserted
+	PutIfNotExistsBatch(string, []KeyValue) ([]bool, error)
+}
+
+// Clearable is the interface of KV store which is able to remove all data. It is meant for tests and resetting
+// a subsystem, and should not be used in regular code paths
+type Clearable interface {
+	// Clear removes all records of all namespaces, the store is still open and usable afterwards
+	Clear() error
+}
+
+// EmptyChecker is the interface of KV store which is able to tell whether it holds any record, e.g. for bootstrap to
+// tell a fresh store needing genesis from a populated one to resume
+type EmptyChecker interface {
+	// IsEmpty returns true if no namespace has any record. It stops at the first record found rather than counting
+	// them all. The namespaces created without records do not make the store non-empty
+	IsEmpty() (bool, error)
+}
+
+// Warmer is the interface of KV store which is able to read namespaces ahead of use, so the first reads after a
+// restart do not hit a cold cache
+type Warmer interface {
+	// Warmup reads every record of the namespaces in turn, the keys only or the values as well, until ctx is done, in
+	// which case it returns the error of ctx
+	Warmup(ctx context.Context, namespaces []string, withValues bool) error
+}
+
+// Iterator iterates over the records of a namespace in key order
+type Iterator interface {
+	// Next moves to the next record, and returns false once there is none left
+	Next() bool
+	// Key returns a copy of the key of the current record, which the caller owns
+	Key() []byte
+	// Value returns a copy of the value of the current record, which the caller owns
+	Value() []byte
+	// KeyUnsafe returns the key of the current record without copying it, for the loops scanning many records to
+	// copy only what they keep. It is UNSAFE: the slice is owned by the KV store, must not be modified, and is only
+	// valid until Next is called again, after which it may hold another key or memory no longer mapped
+	KeyUnsafe() []byte
+	// ValueUnsafe returns the value of the current record without copying it, which is as unsafe as KeyUnsafe
+	ValueUnsafe() []byte
+}
+
+// NamespaceIterator is the interface of KV store which is able to visit all namespaces in one pass, for whole-DB
+// operations like checksum, backup and export. BadgerDB does not implement it, since it has no namespaces of its own
+// to tell apart the keys of namespace||key
+type NamespaceIterator interface {
+	// ForEachNamespace calls fn on each namespace in name order, with the iterator over its records, all within a
+	// single read transaction, until fn returns an error, which ForEachNamespace returns. The iterator is only valid
+	// during the call, and fn must not write to the KV store
+	ForEachNamespace(func(string, Iterator) error) error
+}
+
+// Syncer is the interface of KV store which is able to flush the committed data to disk
+type Syncer interface {
+	// Sync makes all data committed so far durable
+	Sync() error
+}
+
+// NamespaceManager is the interface of KV store which is able to manage namespaces explicitly
+type NamespaceManager interface {
+	// CreateNamespace creates the namespace if it does not exist yet
+	CreateNamespace(string) error
+	// HasNamespace returns true if the namespace exists
+	HasNamespace(string) (bool, error)
+}
+
+// NamespaceSwapper is the interface of KV store which is able to swap namespaces atomically, e.g. to cut over to an
+// index rebuilt in a shadow namespace. BadgerDB does not implement it, since it has no namespaces of its own and
+// swapping would rewrite every key of both namespaces
+type NamespaceSwapper interface {
+	// SwapNamespaces atomically makes each of the two namespaces hold the records of the other. A namespace which
+	// does not exist makes the other one not exist after the swap
+	SwapNamespaces(string, string) error
+}
+
+// SnapshotGetter is the interface of KV store which is able to read multiple records consistently. Unlike Snapshot,
+// it holds no resources after returning, so it is the bounded alternative for callers who know the keys up front
+type SnapshotGetter interface {
+	// SnapshotGet retrieves the records of the keys at the same point in time. The value of a key which does not exist
+	// is nil, so is the value of every key if the namespace does not exist
+	SnapshotGet(string, [][]byte) ([][]byte, error)
+}
+
+// Tx is a read-write transaction of KV store, which sees its own writes
+type Tx interface {
+	// Get gets a record by (namespace, key)
+	Get(string, []byte) ([]byte, error)
+	// Has returns whether the record of (namespace, key) exists
+	Has(string, []byte) (bool, error)
+	// Put insert or update a record identified by (namespace, key)
+	Put(string, []byte, []byte) error
+	// Delete deletes a record by (namespace, key)
+	Delete(string, []byte) error
+}
+
+// Updater is the interface of KV store which is able to run custom logic within a read-write transaction
+type Updater interface {
+	// Update calls fn within a read-write transaction, which is committed if fn returns nil, and rolled back if fn
+	// returns an error, which Update returns. The transaction is only valid during the call. Writes are serialized
+	// against the transaction while fn runs, so fn must not use the KV store other than through the transaction, or
+	// it deadlocks
+	Update(func(Tx) error) error
+}
+
+// Renamer is the interface of KV store which is able to move a record to another key atomically
+type Renamer interface {
+	// Rename moves the value of the old key to the new key of the namespace in a single transaction, so there is no
+	// point in time where both or neither of them exist. It returns ErrNotExist if the old key does not exist, and
+	// ErrAlreadyExist if the new key exists, in which case nothing is changed. Renaming a key to itself does nothing
+	Rename(string, []byte, []byte) error
+}
+
+// Dequeuer is the interface of KV store which is able to use a namespace as a work queue in key order
+type Dequeuer interface {
+	// PopFirst reads and deletes the first n records of the namespace in key order in a single transaction, and
+	// returns them, fewer if the namespace has fewer records. Concurrent callers never receive the same record
+	PopFirst(string, int) ([]KeyValue, error)
+}
+
+// NamespaceInitializer is the interface of KV store which is able to populate an empty namespace exactly once
+type NamespaceInitializer interface {
+	// InitNamespaceIfEmpty calls fn to stage the initial records of the namespace into a batch, and commits it, only if
+	// the namespace has no record. It checks and commits within a single transaction, so among concurrent callers
+	// exactly one initializes the namespace, and the others see it populated. It returns whether the namespace is
+	// initialized by this call. Nothing is written if fn returns an error, which InitNamespaceIfEmpty returns
+	InitNamespaceIfEmpty(string, func(KVStoreBatch) error) (bool, error)
+}
+
+// ConditionalDeleter is the interface of KV store which is able to delete a record only if it holds a given value
+type ConditionalDeleter interface {
+	// CompareAndDelete deletes the record of (namespace, key) if its value is the expected value, checking and deleting
+	// it atomically, so that a record overwritten meanwhile is never deleted. It returns whether the record is
+	// deleted, which is false if the value does not match or the record does not exist. An error is returned only if
+	// the KV store fails
+	CompareAndDelete(string, []byte, []byte) (bool, error)
+}
+
+// Swapper is the interface of KV store which is able to overwrite a record and get the value it replaces
+type Swapper interface {
+	// Swap writes the new value of (namespace, key) and returns the value it replaces, reading and writing atomically,
+	// so that no write in between is lost as in a Get followed by a Put. It returns false if the record does not
+	// exist before, in which case the old value is nil
+	Swap(string, []byte, []byte) ([]byte, bool, error)
+}
+
+// EntryMover is the interface of KV store which is able to move a set of records to another namespace atomically
+type EntryMover interface {
+	// MoveEntries moves the records of the keys from the source namespace to the destination namespace in a single
+	// transaction, so that each of them is in exactly one of the namespaces at any point in time, even upon a crash. A
+	// record existing in the destination is overwritten. It returns ErrNotExist if a key does not exist in the source,
+	// in which case nothing is moved, unless WithSkipMissing is given. A key given more than once is moved once
+	MoveEntries(string, string, [][]byte, ...MoveOption) error
+}
+
+// UnsafeGetter is the interface of KV store which is able to read a record without copying its value, for read-heavy
+// hot paths where the copy made by Get is pure overhead
+type UnsafeGetter interface {
+	// UnsafeGet retrieves a record, and returns the value owned by the KV store and the function to release it.
+	//
+	// WARNING: the value is only valid until released, and reading it afterwards reads freed or remapped memory. The
+	// value must not be modified or retained, and release must be called exactly once when done with it, or the read
+	// transaction held open blocks BoltDB from growing its file and BadgerDB from discarding old versions. The
+	// goroutine holding the value must not write to the KV store before releasing it, or it may deadlock. If an
+	// error is returned, there is nothing to release
+	UnsafeGet(string, []byte) ([]byte, func(), error)
+}
+
+// MappedGetter is the interface of KV store which is able to expose a record as the memory-mapped region of its file,
+// for large values of read-mostly namespaces which are costly to copy and to garbage collect
+type MappedGetter interface {
+	// GetMapped retrieves a record as a value mapped from the file, which must be closed when done with it.
+	//
+	// WARNING: the file must not be written, truncated or compacted by anything other than the KV store while a
+	// mapped value is held, or the value changes under the reader or faults. See UnsafeGet for the other restrictions
+	// of holding a value owned by the KV store
+	GetMapped(string, []byte) (*Value, error)
+}
+
+// Value is a value mapped from the file of the KV store, which holds a read transaction open until closed
+type Value struct {
+	mutex   sync.Mutex
+	bytes   []byte
+	release func()
+}
+
+// wrapper is the interface of the KV stores which the options of NewOnDiskDB and NewMemKVStore wrap the backend in
+type wrapper interface {
+	// underlying returns the KV store wrapped
+	underlying() KVStore
+}
+
+// KeyPager is the interface of KV store which is able to list the keys of a namespace page by page
+type KeyPager interface {
+	// KeysPaged returns up to limit keys of the namespace after the cursor, in sorted order, and the cursor to resume
+	// from. An empty cursor starts from the first key, and a nil cursor is returned once there are no more keys
+	KeysPaged(namespace string, after []byte, limit int) ([][]byte, []byte, error)
+}
+
+// Snapshot is a read-only, point-in-time consistent view of the KV store. Writes made to the KV store after the
+// snapshot is taken are not visible through it, and writing to the KV store while a snapshot is open is safe. It must
+// be released once done to free the resources it holds, after which Get returns ErrInvalidDB
+type Snapshot interface {
+	// Get gets a record by (namespace, key) as of the time the snapshot is taken
+	Get(string, []byte) ([]byte, error)
+	// Put always returns ErrReadOnlyTxn
+	Put(string, []byte, []byte) error
+	// Delete always returns ErrReadOnlyTxn
+	Delete(string, []byte) error
+	// Release releases the resources held by the snapshot
+	Release()
+}
+
+// Snapshotter is the interface of KV store which is able to take a snapshot
+type Snapshotter interface {
+	// Snapshot takes a snapshot of the KV store
+	Snapshot() (Snapshot, error)
+}
+
+// ReadTxnObserver is the interface of KV store which reports the read transactions it has open, to diagnose the growth
+// of the file caused by a long-lived or leaked read transaction
+type ReadTxnObserver interface {
+	// Stats returns the statistics of the read transactions open
+	Stats() ReadTxnStats
+}
+
+// Sizer is the interface of KV store which reports the size of its DB
+type Sizer interface {
+	// Size returns the number of bytes the DB takes: the pages in use for BoltDB, the tables and value logs on disk
+	// for BadgerDB, and the keys and values held for the in-memory KV store
+	Size() (int64, error)
+}
+
+// SnapshotOpener is the interface of KV store which is able to open a snapshot as a KV store of its own, e.g. for
+// analytics to read a consistent view concurrently with the live KV store
+type SnapshotOpener interface {
+	// OpenSnapshot returns a read-only KV store of the records as of now, which is open already and unaffected by
+	// later writes to the live KV store. Its writes return ErrReadOnlyTxn, and its Stop releases the resources of the
+	// snapshot, after which its reads return ErrDBClosed
+	OpenSnapshot() (KVStore, error)
+}
+
+// GetOrDefault retrieves a record, or returns a copy of defaultValue if the key does not exist. Other errors, such as
+// a missing namespace, are returned as is. BadgerDB has no namespaces of its own, so a missing namespace is reported
+// as a missing key there
+func GetOrDefault(kvStore KVStore, namespace string, key, defaultValue []byte) ([]byte, error) {
+	value, err := kvStore.Get(namespace, key)
+	switch errors.Cause(err) {
+	case nil:
+		return value, nil
+	case ErrNotExist:
+		return copyBytes(defaultValue), nil
+	}
+	return nil, err
+}
+
+// BoltDB returns the native handle of a BoltDB KV store created by NewOnDiskDB, for backend-specific features such as
+// Stats, and false if the KV store is not backed by BoltDB. The handle is found through the KV stores the options wrap
+// the BoltDB in. The handle is nil unless the KV store is started.
+//
+// WARNING: the handle bypasses every guarantee of KVStore. Writes through it skip the namespace, batch and front coding
+// handling of the KV store, and the handle must not be used after the KV store is stopped
+func BoltDB(kvStore KVStore) (*bolt.DB, bool) {
+	b, ok := backendOf(kvStore).(*boltDB)
+	if !ok {
+		return nil, false
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.db, true
+}
+
+// BadgerDB returns the native handle of a BadgerDB KV store created by NewOnDiskDB, for backend-specific features
+// such as Subscribe, and false if the KV store is not backed by BadgerDB. The handle is found through the KV stores the
+// options wrap the BadgerDB in. The handle is nil unless the KV store is started.
+//
+// WARNING: the handle bypasses every guarantee of KVStore. Keys are stored as namespace||key, writes through it skip
+// the namespace and group commit handling of the KV store, and the handle must not be used after the KV store is
+// stopped
+func BadgerDB(kvStore KVStore) (*badger.DB, bool) {
+	b, ok := backendOf(kvStore).(*badgerDB)
+	if !ok {
+		return nil, false
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.db, true
+}
+
+// Bytes returns the mapped bytes, which must not be modified, or nil once the value is closed
+func (v *Value) Bytes() []byte {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.bytes
+}
+
+// Close releases the read transaction holding the mapped bytes. Closing a closed value does nothing
+func (v *Value) Close() error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.release != nil {
+		v.release()
+		v.bytes, v.release = nil, nil
+	}
 	return nil
 }
 
-// Commit commits a batch
-func (m *memKVStore) Commit(b KVStoreBatch) (e error) {
-	succeed := false
-	b.Lock()
-	defer func() {
-		if succeed {
-			// clear the batch if commit succeeds
-			b.ClearAndUnlock()
-		} else {
-			b.Unlock()
-		}
-	}()
-	for i := 0; i < b.Size(); i++ {
-		write, err := b.Entry(i)
+// pageOf returns the first limit of the sorted keys, and the cursor to resume from if there are more
+func pageOf(keys []string, limit int) ([][]byte, []byte, error) {
+	page := make([][]byte, 0, limit)
+	for _, k := range keys {
+		if len(page) == limit {
+			return page, page[limit-1], nil
+		}
+		page = append(page, []byte(k))
+	}
+	return page, nil, nil
+}
+
+// kvError returns the KVError of the operation on the record, or nil if err is nil
+func kvError(op, namespace string, key []byte, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &KVError{Op: op, Namespace: namespace, Key: copyBytes(key), Err: err}
+}
+
+// validateKey returns the error of the validator of the namespace if the key is rejected
+func validateKey(options kvStoreOptions, namespace string, key []byte) error {
+	validate, ok := options.keyValidators[namespace]
+	if !ok {
+		return nil
+	}
+	return validate(key)
+}
+
+// validateBatchKeys validates the keys of all entries of the batch, which must be locked
+func validateBatchKeys(options kvStoreOptions, batch KVStoreBatch) error {
+	if len(options.keyValidators) == 0 {
+		return nil
+	}
+	for i := 0; i < batch.Size(); i++ {
+		write, err := batch.Entry(i)
 		if err != nil {
 			return err
 		}
-		if write.writeType == Put {
-			if err := m.Put(write.namespace, write.key, write.value); err != nil {
-				e = err
-				break
-			}
-		} else if write.writeType == PutIfNotExists {
-			if err := m.PutIfNotExists(write.namespace, write.key, write.value); err != nil {
-				e = err
-				break
-			}
-		} else if write.writeType == Delete {
-			if err := m.Delete(write.namespace, write.key); err != nil {
-				e = err
-				break
-			}
+		if err := validateKey(options, write.namespace, write.key); err != nil {
+			return errors.Wrapf(err, "invalid key = %x of namespace %s", write.key, write.namespace)
+		}
+	}
+	return nil
+}
+
+// stopError returns the error of stopping multiple KV stores: the first error, unless a later one may have lost data
+func stopError(err, stopErr error) error {
+	if err == nil || (errors.Cause(stopErr) == ErrDataLoss && errors.Cause(err) != ErrDataLoss) {
+		return stopErr
+	}
+	return err
+}
+
+// createReservedNamespace creates the reserved namespace if it does not exist yet, since it must be created in
+// explicit namespace mode
+func createReservedNamespace(kvStore KVStore, namespace string) error {
+	manager, ok := kvStore.(NamespaceManager)
+	if !ok {
+		return nil
+	}
+	exists, err := manager.HasNamespace(namespace)
+	if err != nil || exists {
+		return err
+	}
+	return manager.CreateNamespace(namespace)
+}
+
+// backendOf returns the backend the KV store wraps, through as many wrappers as the options of the KV store add
+func backendOf(kvStore KVStore) KVStore {
+	for {
+		w, ok := kvStore.(wrapper)
+		if !ok {
+			return kvStore
+		}
+		kvStore = w.underlying()
+	}
+}
+
+// isNotExist returns true if the error indicates the record or its namespace doesn't exist
+func isNotExist(err error) bool {
+	switch errors.Cause(err) {
+	case ErrNotExist, bolt.ErrBucketNotFound:
+		return true
+	}
+	return false
+}
+
+// openWithRetries calls open, and retries it up to cfg.OpenRetries times upon a transient error, waiting
+// cfg.OpenRetryBackoff by clk before the first retry and twice as long before each next one. The last error is returned
+func openWithRetries(cfg config.DB, path string, clk clock.Clock, open func() error) error {
+	backoff := cfg.OpenRetryBackoff
+	for retry := uint8(0); ; retry++ {
+		err := open()
+		if err == nil || retry == cfg.OpenRetries || !isTransientOpenError(err) {
+			return err
 		}
+		logger.Warn().
+			Err(err).
+			Str("path", path).
+			Uint8("retry", retry+1).
+			Dur("backoff", backoff).
+			Msg("Failed to open DB, retrying.")
+		clk.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// isTransientOpenError returns true if the error of opening a DB may go away on retry, e.g. a stale NFS file handle
+// or a lock held by a process exiting. A corrupted or invalid DB is not transient
+func isTransientOpenError(err error) bool {
+	cause := errors.Cause(err)
+	switch e := cause.(type) {
+	case *os.PathError:
+		cause = e.Err
+	case *os.SyscallError:
+		cause = e.Err
 	}
-	if e == nil {
-		succeed = true
+	if cause == bolt.ErrTimeout {
+		return true
+	}
+	errno, ok := cause.(syscall.Errno)
+	if !ok {
+		return false
+	}
+	switch errno {
+	case syscall.ESTALE, syscall.EAGAIN, syscall.EBUSY, syscall.EINTR, syscall.ETIMEDOUT:
+		return true
+	}
+	return false
+}
+
+// idleStopper stops a DB once the in-flight operations finish. A Stop arriving while the close of an earlier one is
+// pending waits for that close rather than scheduling another, which could otherwise close the DB opened by a Start
+// in between
+type idleStopper struct {
+	mutex sync.Mutex
+	// pending is the close scheduled but not done yet, nil if there is none
+	pending *pendingClose
+}
+
+// pendingClose is a close of the DB, err is set before done is closed
+type pendingClose struct {
+	done chan struct{}
+	err  error
+}
+
+// stop calls closeDB once the in-flight operations holding the mutex finish, the operations arriving meanwhile wait for
+// closeDB and then see the DB closed. If ctx is done before that, it returns an error of forced shutdown without waiting
+// any more, and closeDB is still called once the in-flight operations finish
+func (s *idleStopper) stop(ctx context.Context, mutex *sync.RWMutex, closeDB func() error) error {
+	s.mutex.Lock()
+	p := s.pending
+	if p == nil {
+		p = &pendingClose{done: make(chan struct{})}
+		s.pending = p
+		go func() {
+			mutex.Lock()
+			p.err = closeDB()
+			mutex.Unlock()
+			s.mutex.Lock()
+			s.pending = nil
+			s.mutex.Unlock()
+			close(p.done)
+		}()
 	}
+	s.mutex.Unlock()
 
-	return e
+	select {
+	case <-p.done:
+		return p.err
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "forced shutdown before in-flight operations finish")
+	}
 }
 
 // NewOnDiskDB instantiates an on-disk KV store
-func NewOnDiskDB(cfg config.DB) KVStore {
+func NewOnDiskDB(cfg config.DB, opts ...KVStoreOption) KVStore {
+	options := kvStoreOptions{
+		truncate: cfg.AllowTruncate,
+		clk:      clock.New(),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	var kvStore KVStore
 	if cfg.UseBadgerDB {
-		return &badgerDB{db: nil, path: cfg.DbPath, config: cfg}
+		kvStore = &badgerDB{
+			db:      nil,
+			path:    cfg.DbPath,
+			config:  cfg,
+			options: options,
+			index:   newKeyIndex(options.keyIndexNamespaces),
+		}
+	} else {
+		kvStore = &boltDB{
+			db:       nil,
+			path:     cfg.DbPath,
+			config:   cfg,
+			options:  options,
+			readTxns: newReadTxnTracker(options.clk),
+		}
+	}
+	if len(options.splitNamespaces) > 0 {
+		kvStore = newSplitKVStore(kvStore, options.splitNamespaces)
+	}
+	if len(options.keyPrefixes) > 0 {
+		kvStore = newPrefixKVStore(kvStore, options.keyPrefixes)
+	}
+	backend := kvStore
+	if len(options.keyFilters) > 0 {
+		kvStore = newKeyFilterKVStore(kvStore, options.keyFilters)
+	}
+	if len(options.checksummedNamespaces) > 0 {
+		kvStore = newChecksumKVStore(kvStore, options.checksummedNamespaces)
+	}
+	if options.blobDir != "" || options.dedup {
+		kvStore = newBlobKVStore(kvStore, options.blobThreshold, options.blobDir)
+	}
+	if len(options.timestampedNamespaces) > 0 {
+		kvStore = newTimestampKVStore(kvStore, options.timestampedNamespaces, options.clk)
+	}
+	stamps, _ := kvStore.(TimestampGetter)
+	if len(options.lastWrittenNamespaces) > 0 {
+		kvStore = newLastWrittenKVStore(kvStore, options.lastWrittenNamespaces)
+	}
+	if len(options.insertionOrders) > 0 {
+		kvStore = newInsertionOrderKVStore(kvStore, backend, options.insertionOrders)
+	}
+	if options.auditLog {
+		kvStore = newAuditKVStore(kvStore, options.auditRetention, options.auditValueHashes, options.auditHistory, options.clk)
+	}
+	if options.sizeBudget > 0 {
+		kvStore = newEvictKVStore(kvStore, backend, stamps, options)
+	}
+	if len(options.scheduledPurges) > 0 {
+		kvStore = newPurgeKVStore(kvStore, backend, options.scheduledPurges, options.clk)
+	}
+	if len(options.writeRateLimits) > 0 {
+		kvStore = newRateLimitKVStore(kvStore, options.writeRateLimits, options.clk)
+	}
+	if options.hotKeyWindow > 0 {
+		kvStore = newHotKeyKVStore(kvStore, options.hotKeyWindow, options.hotKeySampleRate, options.clk)
+	}
+	if options.latencyMetrics {
+		kvStore = newLatencyKVStore(kvStore, options.latencyNamespaces, options.clk)
 	}
-	return &boltDB{db: nil, path: cfg.DbPath, config: cfg}
+	return kvStore
 }
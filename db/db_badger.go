@@ -7,54 +7,106 @@
 package db
 
 import (
+	"bytes"
 	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/dgraph-io/badger"
 	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/iotexproject/iotex-core/config"
+	"github.com/iotexproject/iotex-core/logger"
 )
 
+// streamBufferSize is the number of records buffered between the iterating goroutine and fn of StreamAll
+const streamBufferSize = 1024
+
+// minValueLogMaxEntries is the fewest entries a value log file of BadgerDB is rotated at, however small the file
+const minValueLogMaxEntries = 1000
+
 // badgerDB is KVStore implementation based bolt DB
 type badgerDB struct {
-	mutex  sync.RWMutex
-	db     *badger.DB
-	path   string
-	config config.DB
+	mutex   sync.RWMutex
+	stopper idleStopper
+	db      *badger.DB
+	path    string
+	config  config.DB
+	options kvStoreOptions
+	// lock is the lock file of WithWriterLock, held as long as the DB is open
+	lock *writerLock
+	// dirty is set to 1 when there are commits not fsynced yet in group commit mode
+	dirty int32
+	// syncs is the number of fsyncs of the value log done in group commit mode
+	syncs uint64
+	// syncMutex serializes the fsyncs, so Sync returns only after the commits so far are fsynced
+	syncMutex sync.Mutex
+	done      chan struct{}
+	wg        sync.WaitGroup
+	// namespaces is the namespaces created explicitly, which may have no records yet
+	namespaces map[string]struct{}
+	// index is the in-memory key index of WithInMemoryKeyIndex, nil if there is no namespace to index
+	index *keyIndex
+	// gc is the statistics of the value log GC of WithValueLogGC
+	gc valueLogGC
+}
+
+// Start opens the badgerDB (creates new file if not existing yet), and upgrades its schema to the version of
+// WithSchema
+func (b *badgerDB) Start(ctx context.Context) error {
+	return startWithSchema(ctx, b, b.options, b.open)
 }
 
-// Start opens the badgerDB (creates new file if not existing yet)
-func (b *badgerDB) Start(_ context.Context) error {
+// open opens the badgerDB
+func (b *badgerDB) open() error {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
 	if b.db != nil {
 		return nil
 	}
-
-	opts := badger.DefaultOptions
-	opts.Dir = b.path
-	opts.ValueDir = b.path
-	db, err := badger.Open(opts)
+	lock, err := acquireWriterLock(b.path, b.options)
 	if err != nil {
 		return err
 	}
-	b.db = db
+	if err := b.openDB(); err != nil {
+		lock.release()
+		return err
+	}
+	b.lock = lock
 	return nil
 }
 
-// Stop closes the badgerDB
-func (b *badgerDB) Stop(_ context.Context) error {
+// Stop closes the badgerDB after the in-flight operations finish, or returns an error if ctx is done before that. The
+// operations afterwards return ErrDBClosed
+func (b *badgerDB) Stop(ctx context.Context) error {
+	return b.stopper.stop(ctx, &b.mutex, func() error {
+		if b.db == nil {
+			return nil
+		}
+		err := b.closeDB()
+		b.lock.release()
+		b.lock = nil
+		return err
+	})
+}
+
+// Sync fsyncs the commits pending in group commit mode, otherwise each commit is fsynced on its own already
+func (b *badgerDB) Sync() error {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
-	if b.db != nil {
-		err := b.db.Close()
-		b.db = nil
-		return err
+	if b.db == nil {
+		return ErrDBClosed
 	}
-	return nil
+
+	return b.flush()
 }
 
 // Put inserts a <key, value> record
@@ -62,9 +114,20 @@ func (b *badgerDB) Put(namespace string, key, value []byte) error {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
+	if b.db == nil {
+		return kvError("Put", namespace, key, ErrDBClosed)
+	}
+
+	if err := b.checkNamespace(namespace); err != nil {
+		return kvError("Put", namespace, key, err)
+	}
+	if err := validateKey(b.options, namespace, key); err != nil {
+		return kvError("Put", namespace, key, err)
+	}
+
 	var err error
 	for c := uint8(0); c < b.config.NumRetries; c++ {
-		err = b.db.Update(func(txn *badger.Txn) error {
+		err = b.update(func(txn *keyIndexTxn) error {
 			k := append([]byte(namespace), key...)
 			// put <k, v>
 			return txn.Set(k, value)
@@ -73,7 +136,8 @@ func (b *badgerDB) Put(namespace string, key, value []byte) error {
 			break
 		}
 	}
-	return err
+	b.markDirty()
+	return kvError("Put", namespace, key, err)
 }
 
 // PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
@@ -81,9 +145,20 @@ func (b *badgerDB) PutIfNotExists(namespace string, key, value []byte) error {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
+	if b.db == nil {
+		return kvError("PutIfNotExists", namespace, key, ErrDBClosed)
+	}
+
+	if err := b.checkNamespace(namespace); err != nil {
+		return kvError("PutIfNotExists", namespace, key, err)
+	}
+	if err := validateKey(b.options, namespace, key); err != nil {
+		return kvError("PutIfNotExists", namespace, key, err)
+	}
+
 	var err error
 	for c := uint8(0); c < b.config.NumRetries; c++ {
-		err = b.db.Update(func(txn *badger.Txn) error {
+		err = b.update(func(txn *keyIndexTxn) error {
 			// check if already exist
 			k := append([]byte(namespace), key...)
 			_, err := txn.Get(k)
@@ -100,7 +175,8 @@ func (b *badgerDB) PutIfNotExists(namespace string, key, value []byte) error {
 			break
 		}
 	}
-	return err
+	b.markDirty()
+	return kvError("PutIfNotExists", namespace, key, err)
 }
 
 // Get retrieves a record
@@ -108,33 +184,228 @@ func (b *badgerDB) Get(namespace string, key []byte) ([]byte, error) {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
+	if b.db == nil {
+		return nil, kvError("Get", namespace, key, ErrDBClosed)
+	}
+
 	var value []byte
 	err := b.db.View(func(txn *badger.Txn) error {
 		k := append([]byte(namespace), key...)
 		item, err := txn.Get(k)
+		if err == badger.ErrKeyNotFound {
+			return ErrNotExist
+		}
 		if err != nil {
-			return errors.Wrapf(err, "failed to get key = %x", k)
+			return err
 		}
-		value, err = item.ValueCopy(nil)
+		value, err = valueOf(item)
 		if err != nil {
-			return errors.Wrapf(err, "failed to get value from key = %x", k)
+			return errors.Wrap(err, "failed to get value")
 		}
 		return nil
 	})
 	if err != nil {
-		return nil, err
+		return nil, kvError("Get", namespace, key, err)
 	}
 	return value, nil
 }
 
+// Rename moves the record to the new key in one transaction
+func (b *badgerDB) Rename(namespace string, oldKey, newKey []byte) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	if err := b.checkNamespace(namespace); err != nil {
+		return err
+	}
+	if err := validateKey(b.options, namespace, newKey); err != nil {
+		return kvError("Rename", namespace, newKey, err)
+	}
+	oldK := append([]byte(namespace), oldKey...)
+	newK := append([]byte(namespace), newKey...)
+	var err error
+	for c := uint8(0); c < b.config.NumRetries; c++ {
+		err = b.update(func(txn *keyIndexTxn) error {
+			item, err := txn.Get(oldK)
+			if err == badger.ErrKeyNotFound {
+				return errors.Wrapf(ErrNotExist, "key = %x", oldK)
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed to get key = %x", oldK)
+			}
+			if string(oldKey) == string(newKey) {
+				return nil
+			}
+			value, err := valueOf(item)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get value from key = %x", oldK)
+			}
+			_, err = txn.Get(newK)
+			if err == nil {
+				return errors.Wrapf(ErrAlreadyExist, "key = %x", newK)
+			}
+			if err != badger.ErrKeyNotFound {
+				return errors.Wrapf(err, "failed to get key = %x", newK)
+			}
+			if err := txn.Set(newK, value); err != nil {
+				return errors.Wrapf(err, "failed to put key = %x", newK)
+			}
+			return errors.Wrapf(txn.Delete(oldK), "failed to delete key = %x", oldK)
+		})
+		if cause := errors.Cause(err); cause == nil || cause == ErrNotExist || cause == ErrAlreadyExist {
+			break
+		}
+	}
+	b.markDirty()
+	return err
+}
+
+// CompareAndDelete deletes the record if it holds the expected value, in one transaction
+func (b *badgerDB) CompareAndDelete(namespace string, key, expected []byte) (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return false, kvError("CompareAndDelete", namespace, key, ErrDBClosed)
+	}
+
+	if err := b.checkNamespace(namespace); err != nil {
+		return false, kvError("CompareAndDelete", namespace, key, err)
+	}
+	k := append([]byte(namespace), key...)
+	var deleted bool
+	var err error
+	for c := uint8(0); c < b.config.NumRetries; c++ {
+		deleted = false
+		err = b.update(func(txn *keyIndexTxn) error {
+			item, err := txn.Get(k)
+			if err == badger.ErrKeyNotFound {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			value, err := valueOf(item)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(value, expected) {
+				return nil
+			}
+			deleted = true
+			return txn.Delete(k)
+		})
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return false, kvError("CompareAndDelete", namespace, key, err)
+	}
+	b.markDirty()
+	return deleted, nil
+}
+
+// Swap writes the new value and returns the old one, in one transaction
+func (b *badgerDB) Swap(namespace string, key, value []byte) ([]byte, bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return nil, false, kvError("Swap", namespace, key, ErrDBClosed)
+	}
+
+	if err := b.checkNamespace(namespace); err != nil {
+		return nil, false, kvError("Swap", namespace, key, err)
+	}
+	if err := validateKey(b.options, namespace, key); err != nil {
+		return nil, false, kvError("Swap", namespace, key, err)
+	}
+	k := append([]byte(namespace), key...)
+	var old []byte
+	var existed bool
+	var err error
+	for c := uint8(0); c < b.config.NumRetries; c++ {
+		old, existed = nil, false
+		err = b.update(func(txn *keyIndexTxn) error {
+			item, err := txn.Get(k)
+			if err != nil && err != badger.ErrKeyNotFound {
+				return err
+			}
+			if err == nil {
+				if old, err = valueOf(item); err != nil {
+					return err
+				}
+				existed = true
+			}
+			return txn.Set(k, value)
+		})
+		if err == nil {
+			break
+		}
+	}
+	b.markDirty()
+	if err != nil {
+		return nil, false, kvError("Swap", namespace, key, err)
+	}
+	return old, existed, nil
+}
+
+// UnsafeGet retrieves a record within a read-only transaction, which is held open until the value is released
+func (b *badgerDB) UnsafeGet(namespace string, key []byte) ([]byte, func(), error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return nil, nil, ErrDBClosed
+	}
+
+	txn := b.db.NewTransaction(false)
+	k := append([]byte(namespace), key...)
+	item, err := txn.Get(k)
+	if err == badger.ErrKeyNotFound {
+		txn.Discard()
+		return nil, nil, errors.Wrapf(ErrNotExist, "key = %x", k)
+	}
+	if err != nil {
+		txn.Discard()
+		return nil, nil, errors.Wrapf(err, "failed to get key = %x", k)
+	}
+	value, err := item.Value()
+	if err != nil {
+		txn.Discard()
+		return nil, nil, errors.Wrapf(err, "failed to get value from key = %x", k)
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	var once sync.Once
+	return value, func() { once.Do(txn.Discard) }, nil
+}
+
 // Delete deletes a record
 func (b *badgerDB) Delete(namespace string, key []byte) error {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
+	if b.db == nil {
+		return kvError("Delete", namespace, key, ErrDBClosed)
+	}
+
+	if err := b.checkNamespace(namespace); err != nil {
+		return kvError("Delete", namespace, key, err)
+	}
+	if err := validateKey(b.options, namespace, key); err != nil {
+		return kvError("Delete", namespace, key, err)
+	}
+
 	var err error
 	for c := uint8(0); c < b.config.NumRetries; c++ {
-		err = b.db.Update(func(txn *badger.Txn) error {
+		err = b.update(func(txn *keyIndexTxn) error {
 			k := append([]byte(namespace), key...)
 			return txn.Delete(k)
 		})
@@ -142,7 +413,8 @@ func (b *badgerDB) Delete(namespace string, key []byte) error {
 			break
 		}
 	}
-	return err
+	b.markDirty()
+	return kvError("Delete", namespace, key, err)
 }
 
 // Commit commits a batch
@@ -150,6 +422,10 @@ func (b *badgerDB) Commit(batch KVStoreBatch) error {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
 	succeed := false
 	batch.Lock()
 	defer func() {
@@ -162,9 +438,125 @@ func (b *badgerDB) Commit(batch KVStoreBatch) error {
 
 	}()
 
+	if batch.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+
+	if err := b.checkBatchNamespaces(batch); err != nil {
+		return err
+	}
+	if err := validateBatchKeys(b.options, batch); err != nil {
+		return err
+	}
 	var err error
 	for c := uint8(0); c < b.config.NumRetries; c++ {
-		err = b.db.Update(func(txn *badger.Txn) error {
+		err = b.update(func(txn *keyIndexTxn) error {
+			for i := 0; i < batch.Size(); i++ {
+				write, err := batch.Entry(i)
+				if err != nil {
+					return err
+				}
+				if err := writeEntry(txn, write); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err == nil || err == ErrAlreadyExist {
+			break
+		}
+	}
+	b.markDirty()
+	succeed = (err == nil)
+	return err
+}
+
+// CommitSplit commits a batch in as many transactions as needed to stay within the transaction limits of BadgerDB,
+// and returns the number of transactions
+func (b *badgerDB) CommitSplit(batch KVStoreBatch) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return 0, ErrDBClosed
+	}
+
+	succeed := false
+	batch.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			batch.ClearAndUnlock()
+		} else {
+			batch.Unlock()
+		}
+	}()
+
+	if batch.committed() {
+		return 0, ErrBatchAlreadyCommitted
+	}
+
+	if err := b.checkBatchNamespaces(batch); err != nil {
+		return 0, err
+	}
+	if err := validateBatchKeys(b.options, batch); err != nil {
+		return 0, err
+	}
+	defer b.markDirty()
+	txns := 0
+	for start := 0; start < batch.Size(); txns++ {
+		var end int
+		var err error
+		for c := uint8(0); c < b.config.NumRetries; c++ {
+			end, err = b.commitFrom(batch, start)
+			if err == nil || err == ErrAlreadyExist {
+				break
+			}
+		}
+		if err != nil {
+			return txns, err
+		}
+		start = end
+	}
+	succeed = true
+	return txns, nil
+}
+
+// CommitCounting commits a batch, skipping PutIfNotExists entries whose key already exists
+func (b *badgerDB) CommitCounting(batch KVStoreBatch) (uint64, uint64, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return 0, 0, ErrDBClosed
+	}
+
+	succeed := false
+	batch.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			batch.ClearAndUnlock()
+		} else {
+			batch.Unlock()
+		}
+	}()
+
+	if batch.committed() {
+		return 0, 0, ErrBatchAlreadyCommitted
+	}
+
+	if err := b.checkBatchNamespaces(batch); err != nil {
+		return 0, 0, err
+	}
+	if err := validateBatchKeys(b.options, batch); err != nil {
+		return 0, 0, err
+	}
+	var applied, skipped uint64
+	var err error
+	for c := uint8(0); c < b.config.NumRetries; c++ {
+		applied, skipped = 0, 0
+		err = b.update(func(txn *keyIndexTxn) error {
 			for i := 0; i < batch.Size(); i++ {
 				write, err := batch.Entry(i)
 				if err != nil {
@@ -172,19 +564,17 @@ func (b *badgerDB) Commit(batch KVStoreBatch) error {
 				}
 				k := append([]byte(write.namespace), write.key...)
 
-				if write.writeType == Put {
-					if err := txn.Set(k, write.value); err != nil {
-						return errors.Wrapf(err, write.errorFormat, write.errorArgs)
-					}
-				} else if write.writeType == PutIfNotExists {
-					_, err := txn.Get(k)
-					if err == nil {
-						return ErrAlreadyExist
-					}
-					if err != badger.ErrKeyNotFound {
-						return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+				if write.writeType == Put || write.writeType == PutIfNotExists {
+					if write.writeType == PutIfNotExists {
+						_, err := txn.Get(k)
+						if err == nil {
+							skipped++
+							continue
+						}
+						if err != badger.ErrKeyNotFound {
+							return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+						}
 					}
-					// put <k, v>
 					if err := txn.Set(k, write.value); err != nil {
 						return errors.Wrapf(err, write.errorFormat, write.errorArgs)
 					}
@@ -192,22 +582,644 @@ func (b *badgerDB) Commit(batch KVStoreBatch) error {
 					if err := txn.Delete(k); err != nil {
 						return errors.Wrapf(err, write.errorFormat, write.errorArgs)
 					}
+				} else if write.writeType == AddCounter {
+					if err := addCounter(txn, k, write); err != nil {
+						return err
+					}
 				}
+				applied++
 			}
 			return nil
 		})
-		if err == nil || err == ErrAlreadyExist {
+		if err == nil {
 			break
 		}
 	}
-	succeed = (err == nil)
-	return err
+	b.markDirty()
+	if err != nil {
+		return 0, 0, err
+	}
+	succeed = true
+	return applied, skipped, nil
+}
+
+// PutIfNotExistsBatch inserts the records whose keys do not exist yet in one transaction
+func (b *badgerDB) PutIfNotExistsBatch(namespace string, kvs []KeyValue) ([]bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	if err := b.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	inserted := make([]bool, len(kvs))
+	var err error
+	for c := uint8(0); c < b.config.NumRetries; c++ {
+		err = b.update(func(txn *keyIndexTxn) error {
+			for i, kv := range kvs {
+				k := append([]byte(namespace), kv.Key...)
+				// the transaction reads its own writes, so a repeated key is found
+				_, err := txn.Get(k)
+				if inserted[i] = err == badger.ErrKeyNotFound; !inserted[i] {
+					if err != nil {
+						return errors.Wrapf(err, "failed to get key = %x", k)
+					}
+					continue
+				}
+				if err := txn.Set(k, kv.Value); err != nil {
+					return errors.Wrapf(err, "failed to put key = %x", k)
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			break
+		}
+	}
+	b.markDirty()
+	if err != nil {
+		return nil, err
+	}
+	return inserted, nil
+}
+
+// StreamAll calls fn on each record of the namespace. The namespace is iterated by one goroutine, which fans the
+// records out to multiple goroutines calling fn concurrently, so fn must be thread-safe.
+// Note that keys are stored as namespace||key, so records of other namespaces which have this namespace as prefix
+// are visited as well
+func (b *badgerDB) StreamAll(namespace string, fn func([]byte, []byte) error) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	type record struct {
+		key   []byte
+		value []byte
+	}
+	records := make(chan record, streamBufferSize)
+	g, ctx := errgroup.WithContext(context.Background())
+	for i := 0; i < runtime.NumCPU(); i++ {
+		g.Go(func() error {
+			for r := range records {
+				if err := fn(r.key, r.value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	g.Go(func() error {
+		defer close(records)
+		prefix := []byte(namespace)
+		return b.db.View(func(txn *badger.Txn) error {
+			it := txn.NewIterator(badger.DefaultIteratorOptions)
+			defer it.Close()
+			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+				item := it.Item()
+				value, err := valueOf(item)
+				if err != nil {
+					return errors.Wrapf(err, "failed to get value from key = %x", item.Key())
+				}
+				select {
+				case records <- record{key: item.KeyCopy(nil)[len(prefix):], value: value}:
+				case <-ctx.Done():
+					// fn failed, stop iterating
+					return nil
+				}
+			}
+			return nil
+		})
+	})
+	return g.Wait()
+}
+
+// Clear deletes all records of the badgerDB. The deletes are split into as many transactions as needed to stay
+// within badger's transaction size limit, so a failure may leave part of the records deleted
+func (b *badgerDB) Clear() (err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	b.createNamespaces()
+	var keys [][]byte
+	if err := b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "failed to list keys to clear")
+	}
+
+	defer b.markDirty()
+	// the key index is rebuilt from what is left, which is all of the records but those deleted if a commit fails
+	defer func() {
+		if indexErr := b.index.rebuild(b.db); err == nil {
+			err = errors.Wrap(indexErr, "failed to rebuild the in-memory key index")
+		}
+	}()
+	txn := b.db.NewTransaction(true)
+	defer func() { txn.Discard() }()
+	for _, k := range keys {
+		err := txn.Delete(k)
+		if err == badger.ErrTxnTooBig {
+			if err = txn.Commit(nil); err != nil {
+				return errors.Wrap(err, "failed to commit deletes")
+			}
+			txn = b.db.NewTransaction(true)
+			err = txn.Delete(k)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete key = %x", k)
+		}
+	}
+	return errors.Wrap(txn.Commit(nil), "failed to commit deletes")
+}
+
+// IsEmpty returns true if the badgerDB has no key
+func (b *badgerDB) IsEmpty() (bool, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return false, ErrDBClosed
+	}
+
+	empty := true
+	err := b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		it.Rewind()
+		empty = !it.Valid()
+		return nil
+	})
+	return empty, err
+}
+
+// CreateNamespace creates the namespace if it does not exist yet. BadgerDB has no namespaces of its own, so the
+// namespaces created are kept in memory, and must be created again after restart unless they have records
+func (b *badgerDB) CreateNamespace(namespace string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	b.namespaces[namespace] = struct{}{}
+	return nil
+}
+
+// HasNamespace returns true if the namespace has been created, or has records. Like StreamAll, records of other
+// namespaces which have this namespace as prefix count as well
+func (b *badgerDB) HasNamespace(namespace string) (bool, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return false, ErrDBClosed
+	}
+
+	return b.hasNamespace(namespace)
+}
+
+// SnapshotGet retrieves the records of the keys within one read transaction
+func (b *badgerDB) SnapshotGet(namespace string, keys [][]byte) ([][]byte, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	values := make([][]byte, len(keys))
+	err := b.db.View(func(txn *badger.Txn) error {
+		for i, key := range keys {
+			k := append([]byte(namespace), key...)
+			item, err := txn.Get(k)
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed to get key = %x", k)
+			}
+			if values[i], err = valueOf(item); err != nil {
+				return errors.Wrapf(err, "failed to get value from key = %x", k)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// KeysPaged returns up to limit keys of the namespace after the cursor, seeking the iterator to it. Like StreamAll,
+// keys of other namespaces which have this namespace as prefix are listed as well
+func (b *badgerDB) KeysPaged(namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	if limit <= 0 {
+		return nil, nil, errors.Wrapf(ErrInvalidDB, "invalid limit %d", limit)
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return nil, nil, ErrDBClosed
+	}
+
+	if keys, cursor, ok := b.index.keysPaged(namespace, after, limit); ok {
+		return keys, cursor, nil
+	}
+	// one more key is read to tell if there are more
+	keys := make([]string, 0, limit+1)
+	err := b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(namespace)
+		for it.Seek(append(prefix, after...)); it.ValidForPrefix(prefix) && len(keys) <= limit; it.Next() {
+			k := it.Item().Key()[len(prefix):]
+			if len(after) > 0 && string(k) == string(after) {
+				continue
+			}
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pageOf(keys, limit)
+}
+
+// Snapshot opens a read-only transaction as the snapshot, which reads at the latest committed version
+func (b *badgerDB) Snapshot() (Snapshot, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	return &badgerSnapshot{txn: b.db.NewTransaction(false)}, nil
+}
+
+// badgerSnapshot is the snapshot of badgerDB backed by a read-only transaction
+type badgerSnapshot struct {
+	mutex sync.Mutex
+	txn   *badger.Txn
+}
+
+// Get retrieves a record
+func (s *badgerSnapshot) Get(namespace string, key []byte) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.txn == nil {
+		return nil, errors.Wrap(ErrInvalidDB, "snapshot is released")
+	}
+	k := append([]byte(namespace), key...)
+	item, err := s.txn.Get(k)
+	if err == badger.ErrKeyNotFound {
+		return nil, errors.Wrapf(ErrNotExist, "key = %x", k)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get key = %x", k)
+	}
+	value, err := valueOf(item)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get value from key = %x", k)
+	}
+	return value, nil
+}
+
+// Put returns ErrReadOnlyTxn
+func (s *badgerSnapshot) Put(string, []byte, []byte) error { return ErrReadOnlyTxn }
+
+// Delete returns ErrReadOnlyTxn
+func (s *badgerSnapshot) Delete(string, []byte) error { return ErrReadOnlyTxn }
+
+// Release discards the read-only transaction
+func (s *badgerSnapshot) Release() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.txn != nil {
+		s.txn.Discard()
+		s.txn = nil
+	}
 }
 
 //======================================
 // private functions
 //======================================
 
+// openDB opens the badgerDB and starts its background routines, which the mutex must be locked for
+func (b *badgerDB) openDB() error {
+	opts := badger.DefaultOptions
+	opts.Dir = b.path
+	opts.ValueDir = b.path
+	opts.Truncate = b.options.truncate
+	if b.options.valueLogFileSize > 0 {
+		opts.ValueLogFileSize = b.options.valueLogFileSize
+		// the value log GC of BadgerDB v1.5 skips a file unless it samples 1% of ValueLogMaxEntries entries of it, so
+		// the entries a file holds at most are scaled down along with its size, keeping the ratio of the defaults
+		entries := int64(opts.ValueLogMaxEntries) * opts.ValueLogFileSize / badger.DefaultOptions.ValueLogFileSize
+		if entries < minValueLogMaxEntries {
+			entries = minValueLogMaxEntries
+		}
+		if entries < int64(opts.ValueLogMaxEntries) {
+			opts.ValueLogMaxEntries = uint32(entries)
+		}
+	}
+	if b.options.memTableSize > 0 {
+		opts.MaxTableSize = b.options.memTableSize
+	}
+	if b.options.retainedVersions > 0 {
+		opts.NumVersionsToKeep = b.options.retainedVersions
+	}
+	if b.options.groupCommitInterval > 0 {
+		// commits are fsynced as a group by groupCommit()
+		opts.SyncWrites = false
+	}
+	var vlogSize int64
+	if opts.Truncate {
+		vlogSize = valueLogSize(b.path)
+	}
+	var db *badger.DB
+	if err := openWithRetries(b.config, b.path, b.options.clk, func() error {
+		var err error
+		db, err = badger.Open(opts)
+		return err
+	}); err != nil {
+		return err
+	}
+	if opts.Truncate {
+		if discarded := vlogSize - valueLogSize(b.path); discarded > 0 {
+			logger.Warn().
+				Str("path", b.path).
+				Int64("discardedBytes", discarded).
+				Msg("Corrupted value log is truncated on open, data in the tail is lost.")
+		}
+	}
+	if err := b.index.rebuild(db); err != nil {
+		db.Close()
+		return errors.Wrap(err, "failed to build the in-memory key index")
+	}
+	b.db = db
+	b.createNamespaces()
+	if b.options.groupCommitInterval > 0 || b.options.valueLogGCInterval > 0 {
+		b.done = make(chan struct{})
+	}
+	if b.options.groupCommitInterval > 0 {
+		b.wg.Add(1)
+		go b.groupCommit(b.options.groupCommitInterval)
+	}
+	if b.options.valueLogGCInterval > 0 {
+		b.wg.Add(1)
+		go b.scheduleValueLogGC(db, b.options.valueLogGCInterval)
+	}
+	return nil
+}
+
+// closeDB stops the background routines of the badgerDB and closes it, which the mutex must be locked for
+func (b *badgerDB) closeDB() error {
+	if b.done != nil {
+		close(b.done)
+		b.wg.Wait()
+		b.done = nil
+	}
+	// Close does not fsync the value log, so pending commits of group commit must be fsynced here
+	err := b.flush()
+	if err != nil {
+		err = errors.Wrapf(ErrDataLoss, "failed to fsync pending commits: %v", err)
+	}
+	if closeErr := b.db.Close(); err == nil {
+		err = closeErr
+	}
+	b.db = nil
+	return err
+}
+
+// valueOf returns a copy of the value of the item. ValueCopy returns nil for an empty value, which callers would take
+// for a missing key, so the copy is made into a non-nil buffer
+func valueOf(item *badger.Item) ([]byte, error) {
+	return item.ValueCopy([]byte{})
+}
+
+// commitFrom commits the entries of the batch from start on in one transaction, as many of them as it holds, and
+// returns the index of the first entry left, which the batch must be locked for
+func (b *badgerDB) commitFrom(batch KVStoreBatch, start int) (int, error) {
+	txn := &keyIndexTxn{Txn: b.db.NewTransaction(true), record: b.index != nil}
+	defer txn.Discard()
+
+	end := start
+	for ; end < batch.Size(); end++ {
+		write, err := batch.Entry(end)
+		if err != nil {
+			return 0, err
+		}
+		if err := writeEntry(txn, write); err != nil {
+			if errors.Cause(err) == badger.ErrTxnTooBig && end > start {
+				break
+			}
+			return 0, err
+		}
+	}
+	if err := txn.Commit(nil); err != nil {
+		return 0, err
+	}
+	b.index.apply(txn.writes)
+	return end, nil
+}
+
+// writeEntry applies the entry of a batch within the transaction
+func writeEntry(txn *keyIndexTxn, write *writeInfo) error {
+	k := append([]byte(write.namespace), write.key...)
+
+	if write.writeType == Put {
+		if err := txn.Set(k, write.value); err != nil {
+			return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+		}
+	} else if write.writeType == PutIfNotExists {
+		_, err := txn.Get(k)
+		if err == nil {
+			return ErrAlreadyExist
+		}
+		if err != badger.ErrKeyNotFound {
+			return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+		}
+		// put <k, v>
+		if err := txn.Set(k, write.value); err != nil {
+			return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+		}
+	} else if write.writeType == Delete {
+		if err := txn.Delete(k); err != nil {
+			return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+		}
+	} else if write.writeType == AddCounter {
+		return addCounter(txn, k, write)
+	}
+	return nil
+}
+
+// addCounter adds the delta of the AddCounter entry to the counter of the record of key k within the transaction
+func addCounter(txn *keyIndexTxn, k []byte, write *writeInfo) error {
+	var value []byte
+	item, err := txn.Get(k)
+	if err == nil {
+		value, err = valueOf(item)
+	}
+	if err != nil && err != badger.ErrKeyNotFound {
+		return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+	}
+	counter, err := addToCounter(value, write.value)
+	if err != nil {
+		return errors.Wrapf(err, "key = %x", write.key)
+	}
+	if err := txn.Set(k, counter); err != nil {
+		return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+	}
+	return nil
+}
+
+// createNamespaces resets the namespaces created to the ones given by WithExplicitNamespaces
+func (b *badgerDB) createNamespaces() {
+	b.namespaces = make(map[string]struct{})
+	for _, namespace := range b.options.namespaces {
+		b.namespaces[namespace] = struct{}{}
+	}
+}
+
+func (b *badgerDB) hasNamespace(namespace string) (bool, error) {
+	if _, ok := b.namespaces[namespace]; ok {
+		return true, nil
+	}
+	var ok bool
+	err := b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(namespace)
+		it.Seek(prefix)
+		ok = it.ValidForPrefix(prefix)
+		return nil
+	})
+	return ok, err
+}
+
+// checkNamespace returns ErrInvalidDB if the namespace must be created before being written to
+func (b *badgerDB) checkNamespace(namespace string) error {
+	if !b.options.explicitNamespaces {
+		return nil
+	}
+	ok, err := b.hasNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Wrapf(ErrInvalidDB, "namespace %s is not created", namespace)
+	}
+	return nil
+}
+
+// checkBatchNamespaces checks the namespaces of all entries of the batch, which must be locked
+func (b *badgerDB) checkBatchNamespaces(batch KVStoreBatch) error {
+	if !b.options.explicitNamespaces {
+		return nil
+	}
+	for i := 0; i < batch.Size(); i++ {
+		write, err := batch.Entry(i)
+		if err != nil {
+			return err
+		}
+		if err := b.checkNamespace(write.namespace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markDirty marks there are commits to be fsynced in group commit mode
+func (b *badgerDB) markDirty() {
+	if b.options.groupCommitInterval > 0 {
+		atomic.StoreInt32(&b.dirty, 1)
+	}
+}
+
+// groupCommit fsyncs the commits made within each interval as a group
+func (b *badgerDB) groupCommit(interval time.Duration) {
+	defer b.wg.Done()
+
+	ticker := b.options.clk.Ticker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			if err := b.flush(); err != nil {
+				logger.Error().Err(err).Msg("Failed to fsync the group of commits.")
+			}
+		}
+	}
+}
+
+// flush fsyncs the value log if there are commits not fsynced yet
+func (b *badgerDB) flush() error {
+	b.syncMutex.Lock()
+	defer b.syncMutex.Unlock()
+
+	if atomic.SwapInt32(&b.dirty, 0) == 0 {
+		return nil
+	}
+	if err := b.syncValueLog(); err != nil {
+		atomic.StoreInt32(&b.dirty, 1)
+		return err
+	}
+	return nil
+}
+
+// syncValueLog fsyncs the value log file being written, since badger has no API to fsync the writes made with
+// SyncWrites off. fsync applies to the file rather than the descriptor, so it is fine to open the file again.
+// The older value log files are fsynced by badger when it moves on to a new file
+func (b *badgerDB) syncValueLog() error {
+	atomic.AddUint64(&b.syncs, 1)
+	files, err := filepath.Glob(filepath.Join(b.path, "*.vlog"))
+	if err != nil {
+		return errors.Wrap(err, "failed to list value log files")
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	// value log files are named by increasing file ID
+	sort.Strings(files)
+	file, err := os.Open(files[len(files)-1])
+	if err != nil {
+		return errors.Wrap(err, "failed to open value log file")
+	}
+	defer file.Close()
+	return errors.Wrapf(file.Sync(), "failed to fsync value log file %s", file.Name())
+}
+
 // intentionally fail to test DB can successfully rollback
 func (b *badgerDB) batchPutForceFail(namespace string, key [][]byte, value [][]byte) error {
 	return b.db.Update(func(txn *badger.Txn) error {
@@ -228,3 +1240,8 @@ func (b *badgerDB) batchPutForceFail(namespace string, key [][]byte, value [][]b
 		return nil
 	})
 }
+
+// valueLogSize returns the total size of value log files under the path
+func valueLogSize(path string) int64 {
+	return filesSize(path, "*.vlog")
+}
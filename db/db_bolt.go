@@ -7,6 +7,7 @@
 package db
 
 import (
+	"bytes"
 	"context"
 	"sync"
 
@@ -14,20 +15,35 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/iotexproject/iotex-core/config"
+	"github.com/iotexproject/iotex-core/logger"
 )
 
 const fileMode = 0600
 
 // boltDB is KVStore implementation based bolt DB
 type boltDB struct {
-	mutex  sync.RWMutex
-	db     *bolt.DB
-	path   string
-	config config.DB
+	mutex   sync.RWMutex
+	stopper idleStopper
+	db      *bolt.DB
+	path    string
+	config  config.DB
+	options kvStoreOptions
+	// lock is the lock file of WithWriterLock, held as long as the DB is open
+	lock *writerLock
+	// readTxns tracks the read transactions held beyond a single read
+	readTxns *readTxnTracker
+	// done stops the watchdog of read transactions
+	done chan struct{}
+	wg   sync.WaitGroup
 }
 
-// Start opens the BoltDB (creates new file if not existing yet)
-func (b *boltDB) Start(_ context.Context) error {
+// Start opens the BoltDB (creates new file if not existing yet), and upgrades its schema to the version of WithSchema
+func (b *boltDB) Start(ctx context.Context) error {
+	return startWithSchema(ctx, b, b.options, b.open)
+}
+
+// open opens the BoltDB
+func (b *boltDB) open() error {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
@@ -35,25 +51,78 @@ func (b *boltDB) Start(_ context.Context) error {
 		return nil
 	}
 
-	db, err := bolt.Open(b.path, fileMode, nil)
+	lock, err := acquireWriterLock(b.path, b.options)
 	if err != nil {
 		return err
 	}
+	var db *bolt.DB
+	if err := openWithRetries(b.config, b.path, b.options.clk, func() error {
+		var err error
+		db, err = bolt.Open(b.path, fileMode, nil)
+		return err
+	}); err != nil {
+		lock.release()
+		return err
+	}
+	if err := db.Update(b.createNamespaces); err != nil {
+		if closeErr := db.Close(); closeErr != nil {
+			logger.Error().Err(closeErr).Str("path", b.path).Msg("Failed to close BoltDB.")
+		}
+		lock.release()
+		return err
+	}
 	b.db = db
+	b.lock = lock
+	if b.options.readTxnWatchdog > 0 && b.readTxns != nil {
+		b.done = make(chan struct{})
+		b.wg.Add(1)
+		go b.watchReadTxns(b.options.readTxnWatchdog, b.done)
+	}
 	return nil
 }
 
-// Stop closes the BoltDB
-func (b *boltDB) Stop(_ context.Context) error {
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
-
-	if b.db != nil {
+// Stop closes the BoltDB after the in-flight operations finish, or returns an error if ctx is done before that. The
+// operations afterwards return ErrDBClosed. In mode WithCompactOnClose the file is compacted before it is closed, and
+// is closed as is if the compaction fails
+func (b *boltDB) Stop(ctx context.Context) error {
+	return b.stopper.stop(ctx, &b.mutex, func() error {
+		if b.done != nil {
+			close(b.done)
+			b.wg.Wait()
+			b.done = nil
+		}
+		if b.db == nil {
+			return nil
+		}
+		// the lock is released once the file is closed, and replaced by the compacted one if any
+		defer func() {
+			b.lock.release()
+			b.lock = nil
+		}()
+		// a read transaction left open would block closing the file forever
+		leakErr := b.releaseLeaked()
+		var compacted string
+		if b.options.compactOnClose && !b.db.IsReadOnly() {
+			var err error
+			if compacted, err = compactBolt(b.db, b.path); err != nil {
+				logger.Error().Err(err).Str("path", b.path).Msg("Failed to compact BoltDB, closing it as is.")
+			}
+		}
 		err := b.db.Close()
 		b.db = nil
-		return err
-	}
-	return nil
+		if err != nil {
+			if compacted == "" {
+				return err
+			}
+			return removeCompacted(compacted, err)
+		}
+		if compacted != "" {
+			if err := replaceCompacted(compacted, b.path); err != nil {
+				logger.Error().Err(err).Str("path", b.path).Msg("Failed to replace BoltDB with its compacted file.")
+			}
+		}
+		return leakErr
+	})
 }
 
 // Put inserts a <key, value> record
@@ -61,11 +130,19 @@ func (b *boltDB) Put(namespace string, key, value []byte) error {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
+	if b.db == nil {
+		return kvError("Put", namespace, key, ErrDBClosed)
+	}
+
+	if err := validateKey(b.options, namespace, key); err != nil {
+		return kvError("Put", namespace, key, err)
+	}
+
 	var err error
 	numRetries := b.config.NumRetries
 	for c := uint8(0); c < numRetries; c++ {
 		err = b.db.Update(func(tx *bolt.Tx) error {
-			bucket, err := tx.CreateBucketIfNotExists([]byte(namespace))
+			bucket, err := b.bucketToWrite(tx, namespace)
 			if err != nil {
 				return err
 			}
@@ -75,7 +152,7 @@ func (b *boltDB) Put(namespace string, key, value []byte) error {
 			break
 		}
 	}
-	return err
+	return kvError("Put", namespace, key, err)
 }
 
 // PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
@@ -83,11 +160,19 @@ func (b *boltDB) PutIfNotExists(namespace string, key, value []byte) error {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
+	if b.db == nil {
+		return kvError("PutIfNotExists", namespace, key, ErrDBClosed)
+	}
+
+	if err := validateKey(b.options, namespace, key); err != nil {
+		return kvError("PutIfNotExists", namespace, key, err)
+	}
+
 	var err error
 	numRetries := b.config.NumRetries
 	for c := uint8(0); c < numRetries; c++ {
 		err = b.db.Update(func(tx *bolt.Tx) error {
-			bucket, err := tx.CreateBucketIfNotExists([]byte(namespace))
+			bucket, err := b.bucketToWrite(tx, namespace)
 			if err != nil {
 				return err
 			}
@@ -100,7 +185,7 @@ func (b *boltDB) PutIfNotExists(namespace string, key, value []byte) error {
 			break
 		}
 	}
-	return err
+	return kvError("PutIfNotExists", namespace, key, err)
 }
 
 // Get retrieves a record
@@ -108,22 +193,199 @@ func (b *boltDB) Get(namespace string, key []byte) ([]byte, error) {
 	b.mutex.RLock()
 	defer b.mutex.RUnlock()
 
+	if b.db == nil {
+		return nil, kvError("Get", namespace, key, ErrDBClosed)
+	}
+
 	var value []byte
 	err := b.db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(namespace))
+		bucket := b.wrapBucket(namespace, tx.Bucket([]byte(namespace)))
 		if bucket == nil {
-			return errors.Wrapf(bolt.ErrBucketNotFound, "bucket = %s", namespace)
+			return bolt.ErrBucketNotFound
+		}
+		// the value is only valid during the transaction, and an empty value is kept apart from a missing key
+		if v := bucket.Get(key); v != nil {
+			value = append([]byte{}, v...)
 		}
-		value = bucket.Get(key)
 		return nil
 	})
+	if err == nil && value == nil {
+		err = ErrNotExist
+	}
 	if err != nil {
-		return nil, err
+		return nil, kvError("Get", namespace, key, err)
+	}
+	return value, nil
+}
+
+// Rename moves the record to the new key in one transaction
+func (b *boltDB) Rename(namespace string, oldKey, newKey []byte) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+	if err := validateKey(b.options, namespace, newKey); err != nil {
+		return kvError("Rename", namespace, newKey, err)
+	}
+
+	var err error
+	numRetries := b.config.NumRetries
+	for c := uint8(0); c < numRetries; c++ {
+		err = b.db.Update(func(tx *bolt.Tx) error {
+			bucket, err := b.bucketToDelete(tx, namespace)
+			if err != nil {
+				return err
+			}
+			var value []byte
+			if bucket != nil {
+				value = bucket.Get(oldKey)
+			}
+			if value == nil {
+				return errors.Wrapf(ErrNotExist, "key = %x", oldKey)
+			}
+			if string(oldKey) == string(newKey) {
+				return nil
+			}
+			if bucket.Get(newKey) != nil {
+				return errors.Wrapf(ErrAlreadyExist, "key = %x", newKey)
+			}
+			// the value is only valid until the bucket is modified
+			if err := bucket.Put(newKey, append([]byte{}, value...)); err != nil {
+				return errors.Wrapf(err, "failed to put key = %x", newKey)
+			}
+			return errors.Wrapf(bucket.Delete(oldKey), "failed to delete key = %x", oldKey)
+		})
+		if cause := errors.Cause(err); cause == nil || cause == ErrNotExist || cause == ErrAlreadyExist {
+			break
+		}
+	}
+	return err
+}
+
+// CompareAndDelete deletes the record if it holds the expected value, in one transaction
+func (b *boltDB) CompareAndDelete(namespace string, key, expected []byte) (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return false, kvError("CompareAndDelete", namespace, key, ErrDBClosed)
+	}
+
+	var deleted bool
+	var err error
+	numRetries := b.config.NumRetries
+	for c := uint8(0); c < numRetries; c++ {
+		deleted = false
+		err = b.db.Update(func(tx *bolt.Tx) error {
+			bucket, err := b.bucketToDelete(tx, namespace)
+			if bucket == nil {
+				return err
+			}
+			value := bucket.Get(key)
+			if value == nil || !bytes.Equal(value, expected) {
+				return nil
+			}
+			deleted = true
+			return bucket.Delete(key)
+		})
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return false, kvError("CompareAndDelete", namespace, key, err)
+	}
+	return deleted, nil
+}
+
+// Swap writes the new value and returns the old one, in one transaction
+func (b *boltDB) Swap(namespace string, key, value []byte) ([]byte, bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return nil, false, kvError("Swap", namespace, key, ErrDBClosed)
+	}
+
+	if err := validateKey(b.options, namespace, key); err != nil {
+		return nil, false, kvError("Swap", namespace, key, err)
+	}
+
+	var old []byte
+	var err error
+	numRetries := b.config.NumRetries
+	for c := uint8(0); c < numRetries; c++ {
+		old = nil
+		err = b.db.Update(func(tx *bolt.Tx) error {
+			bucket, err := b.bucketToWrite(tx, namespace)
+			if err != nil {
+				return err
+			}
+			// the old value is only valid during the transaction
+			if v := bucket.Get(key); v != nil {
+				old = append([]byte{}, v...)
+			}
+			return bucket.Put(key, value)
+		})
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, false, kvError("Swap", namespace, key, err)
 	}
+	return old, old != nil, nil
+}
+
+// UnsafeGet retrieves a record within a read transaction, which is held open until the value is released
+func (b *boltDB) UnsafeGet(namespace string, key []byte) ([]byte, func(), error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return nil, nil, ErrDBClosed
+	}
+
+	tx, err := b.db.Begin(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	bucket := b.wrapBucket(namespace, tx.Bucket([]byte(namespace)))
+	if bucket == nil {
+		tx.Rollback()
+		return nil, nil, errors.Wrapf(bolt.ErrBucketNotFound, "bucket = %s", namespace)
+	}
+	value := bucket.Get(key)
 	if value == nil {
-		err = errors.Wrapf(ErrNotExist, "key = %x", key)
+		tx.Rollback()
+		return nil, nil, errors.Wrapf(ErrNotExist, "key = %x", key)
+	}
+	var (
+		once     sync.Once
+		released func()
+	)
+	release := func() {
+		once.Do(func() {
+			// a read-only transaction has nothing to roll back, so it never fails
+			tx.Rollback()
+			released()
+		})
+	}
+	// Stop waits for the read lock, so it never force-releases the value before released is set
+	released = b.readTxns.holdReleasable("UnsafeGet", release)
+	return value, release, nil
+}
+
+// GetMapped retrieves a record as the bytes of the file BoltDB mmaps, without copying them. The read transaction is
+// held open until the value is closed, so BoltDB neither remaps the file nor reuses the pages of the value meanwhile
+func (b *boltDB) GetMapped(namespace string, key []byte) (*Value, error) {
+	value, release, err := b.UnsafeGet(namespace, key)
+	if err != nil {
+		return nil, err
 	}
-	return value, err
+	return &Value{bytes: value, release: release}, nil
 }
 
 // Delete deletes a record
@@ -131,13 +393,21 @@ func (b *boltDB) Delete(namespace string, key []byte) error {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
+	if b.db == nil {
+		return kvError("Delete", namespace, key, ErrDBClosed)
+	}
+
+	if err := validateKey(b.options, namespace, key); err != nil {
+		return kvError("Delete", namespace, key, err)
+	}
+
 	var err error
 	numRetries := b.config.NumRetries
 	for c := uint8(0); c < numRetries; c++ {
 		err = b.db.Update(func(tx *bolt.Tx) error {
-			bucket := tx.Bucket([]byte(namespace))
+			bucket, err := b.bucketToDelete(tx, namespace)
 			if bucket == nil {
-				return nil
+				return err
 			}
 			return bucket.Delete(key)
 		})
@@ -145,7 +415,7 @@ func (b *boltDB) Delete(namespace string, key []byte) error {
 			break
 		}
 	}
-	return err
+	return kvError("Delete", namespace, key, err)
 }
 
 // Commit commits a batch
@@ -153,6 +423,10 @@ func (b *boltDB) Commit(batch KVStoreBatch) error {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
 	succeed := false
 	batch.Lock()
 	defer func() {
@@ -165,63 +439,517 @@ func (b *boltDB) Commit(batch KVStoreBatch) error {
 
 	}()
 
+	if batch.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	if err := validateBatchKeys(b.options, batch); err != nil {
+		return err
+	}
+
 	var err error
 	numRetries := b.config.NumRetries
 	for c := uint8(0); c < numRetries; c++ {
+		err = b.db.Update(func(tx *bolt.Tx) error {
+			return b.writeBatch(tx, batch)
+		})
+		if err == nil || err == ErrAlreadyExist {
+			break
+		}
+	}
+	succeed = (err == nil)
+	return err
+}
+
+// CommitCounting commits a batch, skipping PutIfNotExists entries whose key already exists
+func (b *boltDB) CommitCounting(batch KVStoreBatch) (uint64, uint64, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return 0, 0, ErrDBClosed
+	}
+
+	succeed := false
+	batch.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			batch.ClearAndUnlock()
+		} else {
+			batch.Unlock()
+		}
+	}()
+
+	if batch.committed() {
+		return 0, 0, ErrBatchAlreadyCommitted
+	}
+	if err := validateBatchKeys(b.options, batch); err != nil {
+		return 0, 0, err
+	}
+
+	var applied, skipped uint64
+	var err error
+	numRetries := b.config.NumRetries
+	for c := uint8(0); c < numRetries; c++ {
+		applied, skipped = 0, 0
 		err = b.db.Update(func(tx *bolt.Tx) error {
 			for i := 0; i < batch.Size(); i++ {
 				write, err := batch.Entry(i)
 				if err != nil {
 					return err
 				}
-				if write.writeType == Put {
-					bucket, err := tx.CreateBucketIfNotExists([]byte(write.namespace))
+				if write.writeType == Put || write.writeType == PutIfNotExists {
+					bucket, err := b.bucketToWrite(tx, write.namespace)
 					if err != nil {
 						return errors.Wrapf(err, write.errorFormat, write.errorArgs)
 					}
+					if write.writeType == PutIfNotExists && bucket.Get(write.key) != nil {
+						skipped++
+						continue
+					}
 					if err := bucket.Put(write.key, write.value); err != nil {
 						return errors.Wrapf(err, write.errorFormat, write.errorArgs)
 					}
-				} else if write.writeType == PutIfNotExists {
-					bucket, err := tx.CreateBucketIfNotExists([]byte(write.namespace))
+				} else if write.writeType == Delete {
+					bucket, err := b.bucketToDelete(tx, write.namespace)
 					if err != nil {
 						return errors.Wrapf(err, write.errorFormat, write.errorArgs)
 					}
-					if bucket.Get(write.key) == nil {
-						if err := bucket.Put(write.key, write.value); err != nil {
+					if bucket != nil {
+						if err := bucket.Delete(write.key); err != nil {
 							return errors.Wrapf(err, write.errorFormat, write.errorArgs)
 						}
-					} else {
-						return ErrAlreadyExist
-					}
-				} else if write.writeType == Delete {
-					bucket := tx.Bucket([]byte(write.namespace))
-					if bucket == nil {
-						continue
 					}
-					if err := bucket.Delete(write.key); err != nil {
-						return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+				} else if write.writeType == AddCounter {
+					if err := b.addCounter(tx, write); err != nil {
+						return err
 					}
 				}
+				applied++
 			}
 			return nil
 		})
-		if err == nil || err == ErrAlreadyExist {
+		if err == nil {
 			break
 		}
 	}
-	succeed = (err == nil)
-	return err
+	if err != nil {
+		return 0, 0, err
+	}
+	succeed = true
+	return applied, skipped, nil
+}
+
+// PutIfNotExistsBatch inserts the records whose keys do not exist yet in one transaction
+func (b *boltDB) PutIfNotExistsBatch(namespace string, kvs []KeyValue) ([]bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	inserted := make([]bool, len(kvs))
+	var err error
+	numRetries := b.config.NumRetries
+	for c := uint8(0); c < numRetries; c++ {
+		err = b.db.Update(func(tx *bolt.Tx) error {
+			bucket, err := b.bucketToWrite(tx, namespace)
+			if err != nil {
+				return err
+			}
+			for i, kv := range kvs {
+				if inserted[i] = bucket.Get(kv.Key) == nil; !inserted[i] {
+					continue
+				}
+				if err := bucket.Put(kv.Key, kv.Value); err != nil {
+					return errors.Wrapf(err, "failed to put key = %x", kv.Key)
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return inserted, nil
+}
+
+// StreamAll calls fn on each record of the namespace, serially
+func (b *boltDB) StreamAll(namespace string, fn func([]byte, []byte) error) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	return b.db.View(func(tx *bolt.Tx) error {
+		defer b.readTxns.hold("StreamAll")()
+		bucket := b.wrapBucket(namespace, tx.Bucket([]byte(namespace)))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(fn)
+	})
+}
+
+// Clear removes all buckets in one transaction
+func (b *boltDB) Clear() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		var names [][]byte
+		if err := tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			names = append(names, append([]byte(nil), name...))
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := tx.DeleteBucket(name); err != nil {
+				return errors.Wrapf(err, "failed to delete bucket %s", name)
+			}
+		}
+		return b.createNamespaces(tx)
+	})
+}
+
+// IsEmpty returns true if no bucket has any record
+func (b *boltDB) IsEmpty() (bool, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return false, ErrDBClosed
+	}
+
+	empty := true
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			if err := b.wrapBucket(string(name), bucket).ForEachFrom(nil, func(_, _ []byte) error {
+				empty = false
+				return errStopIteration
+			}); err != nil {
+				return err
+			}
+			if !empty {
+				return errStopIteration
+			}
+			return nil
+		})
+	})
+	if err == errStopIteration {
+		err = nil
+	}
+	return empty, err
+}
+
+// CreateNamespace creates the bucket of the namespace if it does not exist yet
+func (b *boltDB) CreateNamespace(namespace string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(namespace))
+		return err
+	})
+}
+
+// HasNamespace returns true if the bucket of the namespace exists
+func (b *boltDB) HasNamespace(namespace string) (bool, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return false, ErrDBClosed
+	}
+
+	var ok bool
+	err := b.db.View(func(tx *bolt.Tx) error {
+		ok = tx.Bucket([]byte(namespace)) != nil
+		return nil
+	})
+	return ok, err
+}
+
+// Sync fsyncs the BoltDB file, which commits already do on their own
+func (b *boltDB) Sync() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	return b.db.Sync()
+}
+
+// SwapNamespaces swaps the buckets of the two namespaces within one transaction. BoltDB is unable to rename a bucket,
+// so both buckets are copied over, which costs time and memory proportional to their size
+func (b *boltDB) SwapNamespaces(ns1, ns2 string) error {
+	if ns1 == ns2 {
+		return nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		records1, has1, err := b.removeBucket(tx, ns1)
+		if err != nil {
+			return err
+		}
+		records2, has2, err := b.removeBucket(tx, ns2)
+		if err != nil {
+			return err
+		}
+		if has2 {
+			if err := b.putBucket(tx, ns1, records2); err != nil {
+				return err
+			}
+		}
+		if has1 {
+			return b.putBucket(tx, ns2, records1)
+		}
+		return nil
+	})
+}
+
+// SnapshotGet retrieves the records of the keys within one read transaction
+func (b *boltDB) SnapshotGet(namespace string, keys [][]byte) ([][]byte, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	values := make([][]byte, len(keys))
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := b.wrapBucket(namespace, tx.Bucket([]byte(namespace)))
+		if bucket == nil {
+			return nil
+		}
+		for i, key := range keys {
+			// the value is only valid during the transaction
+			if v := bucket.Get(key); v != nil {
+				values[i] = append([]byte{}, v...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// KeysPaged returns up to limit keys of the namespace after the cursor, seeking the bucket cursor to it
+func (b *boltDB) KeysPaged(namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	if limit <= 0 {
+		return nil, nil, errors.Wrapf(ErrInvalidDB, "invalid limit %d", limit)
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return nil, nil, ErrDBClosed
+	}
+
+	// one more key is read to tell if there are more
+	keys := make([]string, 0, limit+1)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := b.wrapBucket(namespace, tx.Bucket([]byte(namespace)))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEachFrom(after, func(k, _ []byte) error {
+			if len(after) > 0 && string(k) == string(after) {
+				return nil
+			}
+			keys = append(keys, string(k))
+			if len(keys) > limit {
+				return errStopIteration
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pageOf(keys, limit)
+}
+
+// Snapshot copies all records into memory within one read transaction, and serves reads from the copy. Holding the
+// read transaction open instead would block any write that needs to grow the BoltDB file until the snapshot is
+// released, so the snapshot costs memory proportional to the size of the DB
+func (b *boltDB) Snapshot() (Snapshot, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	store := newMemKVStore(kvStoreOptions{})
+	if err := b.db.View(func(tx *bolt.Tx) error {
+		defer b.readTxns.hold("Snapshot")()
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			return b.wrapBucket(string(name), bucket).ForEach(func(k, v []byte) error {
+				// k and v are only valid during the transaction
+				return store.Put(string(name), append([]byte(nil), k...), append([]byte{}, v...))
+			})
+		})
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to copy records for snapshot")
+	}
+	return &memSnapshot{store: store}, nil
 }
 
 //======================================
 // private functions
 //======================================
 
+// namespaceNames returns the names of all buckets
+func (b *boltDB) namespaceNames() ([]string, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	var names []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			names = append(names, string(name))
+			return nil
+		})
+	})
+	return names, err
+}
+
+// createNamespaces creates the buckets of the namespaces given by WithExplicitNamespaces
+func (b *boltDB) createNamespaces(tx *bolt.Tx) error {
+	for _, namespace := range b.options.namespaces {
+		if _, err := tx.CreateBucketIfNotExists([]byte(namespace)); err != nil {
+			return errors.Wrapf(err, "failed to create bucket %s", namespace)
+		}
+	}
+	return nil
+}
+
+// bucketToWrite returns the bucket of the namespace, which is created if not existing yet, unless in explicit
+// namespace mode
+func (b *boltDB) bucketToWrite(tx *bolt.Tx, namespace string) (kvBucket, error) {
+	if !b.options.explicitNamespaces {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(namespace))
+		if err != nil {
+			return nil, err
+		}
+		return b.wrapBucket(namespace, bucket), nil
+	}
+	if bucket := tx.Bucket([]byte(namespace)); bucket != nil {
+		return b.wrapBucket(namespace, bucket), nil
+	}
+	return nil, errors.Wrapf(ErrInvalidDB, "namespace %s is not created", namespace)
+}
+
+// writeBatch writes the entries of the batch within the transaction, which the batch must be locked for
+func (b *boltDB) writeBatch(tx *bolt.Tx, batch KVStoreBatch) error {
+	for i := 0; i < batch.Size(); i++ {
+		write, err := batch.Entry(i)
+		if err != nil {
+			return err
+		}
+		if write.writeType == Put {
+			bucket, err := b.bucketToWrite(tx, write.namespace)
+			if err != nil {
+				return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+			}
+			if err := bucket.Put(write.key, write.value); err != nil {
+				return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+			}
+		} else if write.writeType == PutIfNotExists {
+			bucket, err := b.bucketToWrite(tx, write.namespace)
+			if err != nil {
+				return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+			}
+			if bucket.Get(write.key) == nil {
+				if err := bucket.Put(write.key, write.value); err != nil {
+					return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+				}
+			} else {
+				return ErrAlreadyExist
+			}
+		} else if write.writeType == Delete {
+			bucket, err := b.bucketToDelete(tx, write.namespace)
+			if err != nil {
+				return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+			}
+			if bucket == nil {
+				continue
+			}
+			if err := bucket.Delete(write.key); err != nil {
+				return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+			}
+		} else if write.writeType == AddCounter {
+			if err := b.addCounter(tx, write); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addCounter adds the delta of the AddCounter entry to the counter of the record within the transaction
+func (b *boltDB) addCounter(tx *bolt.Tx, write *writeInfo) error {
+	bucket, err := b.bucketToWrite(tx, write.namespace)
+	if err != nil {
+		return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+	}
+	counter, err := addToCounter(bucket.Get(write.key), write.value)
+	if err != nil {
+		return errors.Wrapf(err, "key = %x", write.key)
+	}
+	if err := bucket.Put(write.key, counter); err != nil {
+		return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+	}
+	return nil
+}
+
+// bucketToDelete returns the bucket of the namespace, or nil if not existing, which is an error in explicit
+// namespace mode
+func (b *boltDB) bucketToDelete(tx *bolt.Tx, namespace string) (kvBucket, error) {
+	if bucket := tx.Bucket([]byte(namespace)); bucket != nil {
+		return b.wrapBucket(namespace, bucket), nil
+	}
+	if b.options.explicitNamespaces {
+		return nil, errors.Wrapf(ErrInvalidDB, "namespace %s is not created", namespace)
+	}
+	return nil, nil
+}
+
 // intentionally fail to test DB can successfully rollback
 func (b *boltDB) batchPutForceFail(namespace string, key [][]byte, value [][]byte) error {
 	return b.db.Update(func(tx *bolt.Tx) error {
-		bucket, err := tx.CreateBucketIfNotExists([]byte(namespace))
+		bucket, err := b.bucketToWrite(tx, namespace)
 		if err != nil {
 			return err
 		}
@@ -240,3 +968,38 @@ func (b *boltDB) batchPutForceFail(namespace string, key [][]byte, value [][]byt
 		return nil
 	})
 }
+
+// removeBucket deletes the bucket, and returns copies of its records and whether it existed
+func (b *boltDB) removeBucket(tx *bolt.Tx, namespace string) ([][2][]byte, bool, error) {
+	bucket := b.wrapBucket(namespace, tx.Bucket([]byte(namespace)))
+	if bucket == nil {
+		return nil, false, nil
+	}
+	var records [][2][]byte
+	if err := bucket.ForEach(func(k, v []byte) error {
+		// k and v are only valid until the bucket is deleted
+		records = append(records, [2][]byte{append([]byte(nil), k...), append([]byte{}, v...)})
+		return nil
+	}); err != nil {
+		return nil, false, err
+	}
+	if err := tx.DeleteBucket([]byte(namespace)); err != nil {
+		return nil, false, errors.Wrapf(err, "failed to delete bucket %s", namespace)
+	}
+	return records, true, nil
+}
+
+// putBucket creates the bucket with the records
+func (b *boltDB) putBucket(tx *bolt.Tx, namespace string, records [][2][]byte) error {
+	created, err := tx.CreateBucket([]byte(namespace))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create bucket %s", namespace)
+	}
+	bucket := b.wrapBucket(namespace, created)
+	for _, r := range records {
+		if err := bucket.Put(r[0], r[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
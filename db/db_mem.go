@@ -0,0 +1,809 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+)
+
+const defaultMemShards = 32
+
+type (
+	// memKVStore is the in-memory implementation of KVStore for testing purpose. The records are split into shards
+	// by the hash of (namespace, key), each guarded by its own lock
+	memKVStore struct {
+		options kvStoreOptions
+		shards  []*memShard
+		// nsMutex guards namespaces, it is never held while acquiring a shard lock
+		nsMutex    sync.RWMutex
+		namespaces map[string]struct{}
+	}
+
+	// memShard is a shard of the in-memory KV store
+	memShard struct {
+		mutex  sync.RWMutex
+		bucket map[string]map[string][]byte
+	}
+
+	// memSnapshot is a snapshot serving reads from a copy of the records
+	memSnapshot struct {
+		mutex sync.RWMutex
+		store *memKVStore
+	}
+)
+
+// NewMemKVStore instantiates an in-memory KV store
+func NewMemKVStore(opts ...KVStoreOption) KVStore {
+	options := kvStoreOptions{
+		memShards: defaultMemShards,
+		clk:       clock.New(),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	var kvStore KVStore = newMemKVStore(options)
+	if len(options.splitNamespaces) > 0 {
+		kvStore = newSplitKVStore(kvStore, options.splitNamespaces)
+	}
+	if len(options.keyPrefixes) > 0 {
+		kvStore = newPrefixKVStore(kvStore, options.keyPrefixes)
+	}
+	backend := kvStore
+	if len(options.keyFilters) > 0 {
+		kvStore = newKeyFilterKVStore(kvStore, options.keyFilters)
+	}
+	if len(options.checksummedNamespaces) > 0 {
+		kvStore = newChecksumKVStore(kvStore, options.checksummedNamespaces)
+	}
+	if options.dedup {
+		kvStore = newBlobKVStore(kvStore, options.blobThreshold, "")
+	}
+	if len(options.timestampedNamespaces) > 0 {
+		kvStore = newTimestampKVStore(kvStore, options.timestampedNamespaces, options.clk)
+	}
+	stamps, _ := kvStore.(TimestampGetter)
+	if len(options.lastWrittenNamespaces) > 0 {
+		kvStore = newLastWrittenKVStore(kvStore, options.lastWrittenNamespaces)
+	}
+	if len(options.insertionOrders) > 0 {
+		kvStore = newInsertionOrderKVStore(kvStore, backend, options.insertionOrders)
+	}
+	if options.auditLog {
+		kvStore = newAuditKVStore(kvStore, options.auditRetention, options.auditValueHashes, options.auditHistory, options.clk)
+	}
+	if options.sizeBudget > 0 {
+		kvStore = newEvictKVStore(kvStore, backend, stamps, options)
+	}
+	if len(options.scheduledPurges) > 0 {
+		kvStore = newPurgeKVStore(kvStore, backend, options.scheduledPurges, options.clk)
+	}
+	if len(options.writeRateLimits) > 0 {
+		kvStore = newRateLimitKVStore(kvStore, options.writeRateLimits, options.clk)
+	}
+	if options.hotKeyWindow > 0 {
+		kvStore = newHotKeyKVStore(kvStore, options.hotKeyWindow, options.hotKeySampleRate, options.clk)
+	}
+	if options.latencyMetrics {
+		kvStore = newLatencyKVStore(kvStore, options.latencyNamespaces, options.clk)
+	}
+	return kvStore
+}
+
+// Start records the schema version of WithSchema, as the in-memory KV store is always new on start
+func (m *memKVStore) Start(_ context.Context) error {
+	return upgradeSchema(m, m.options)
+}
+
+func (m *memKVStore) Stop(_ context.Context) error { return nil }
+
+// Put inserts a <key, value> record
+func (m *memKVStore) Put(namespace string, key, value []byte) error {
+	if err := m.checkNamespace(namespace); err != nil {
+		return kvError("Put", namespace, key, err)
+	}
+	if err := validateKey(m.options, namespace, key); err != nil {
+		return kvError("Put", namespace, key, err)
+	}
+	shard := m.shard(namespace, key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	m.put(shard, namespace, key, value)
+	return nil
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (m *memKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	if err := m.checkNamespace(namespace); err != nil {
+		return kvError("PutIfNotExists", namespace, key, err)
+	}
+	if err := validateKey(m.options, namespace, key); err != nil {
+		return kvError("PutIfNotExists", namespace, key, err)
+	}
+	shard := m.shard(namespace, key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	return kvError("PutIfNotExists", namespace, key, m.putIfNotExists(shard, namespace, key, value))
+}
+
+// Get retrieves a record
+func (m *memKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	shard := m.shard(namespace, key)
+	shard.mutex.RLock()
+	// a record of nil value is reported as not existing
+	value := shard.bucket[namespace][string(key)]
+	shard.mutex.RUnlock()
+	if value != nil {
+		return value, nil
+	}
+
+	m.nsMutex.RLock()
+	_, ok := m.namespaces[namespace]
+	m.nsMutex.RUnlock()
+	if !ok {
+		return nil, kvError("Get", namespace, key, bolt.ErrBucketNotFound)
+	}
+	return nil, kvError("Get", namespace, key, ErrNotExist)
+}
+
+// Rename moves the record to the new key with the shards of both keys locked
+func (m *memKVStore) Rename(namespace string, oldKey, newKey []byte) error {
+	if err := m.checkNamespace(namespace); err != nil {
+		return kvError("Rename", namespace, oldKey, err)
+	}
+	if err := validateKey(m.options, namespace, newKey); err != nil {
+		return kvError("Rename", namespace, newKey, err)
+	}
+	unlock, err := m.lockShardsOf(newBatchOf([]writeInfo{
+		{writeType: Delete, namespace: namespace, key: oldKey},
+		{writeType: Put, namespace: namespace, key: newKey},
+	}))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	oldShard := m.shard(namespace, oldKey)
+	// a record of nil value is reported as not existing
+	value := oldShard.bucket[namespace][string(oldKey)]
+	if value == nil {
+		return errors.Wrapf(ErrNotExist, "key = %x", oldKey)
+	}
+	if string(oldKey) == string(newKey) {
+		return nil
+	}
+	newShard := m.shard(namespace, newKey)
+	if newShard.bucket[namespace][string(newKey)] != nil {
+		return errors.Wrapf(ErrAlreadyExist, "key = %x", newKey)
+	}
+	m.put(newShard, namespace, newKey, value)
+	oldShard.delete(namespace, oldKey)
+	return nil
+}
+
+// CompareAndDelete deletes the record if it holds the expected value, with the shard of the key locked
+func (m *memKVStore) CompareAndDelete(namespace string, key, expected []byte) (bool, error) {
+	if err := m.checkNamespace(namespace); err != nil {
+		return false, kvError("CompareAndDelete", namespace, key, err)
+	}
+	shard := m.shard(namespace, key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	// a record of nil value is reported as not existing
+	value := shard.bucket[namespace][string(key)]
+	if value == nil || !bytes.Equal(value, expected) {
+		return false, nil
+	}
+	shard.delete(namespace, key)
+	return true, nil
+}
+
+// Swap writes the new value and returns the old one, with the shard of the key locked
+func (m *memKVStore) Swap(namespace string, key, value []byte) ([]byte, bool, error) {
+	if err := m.checkNamespace(namespace); err != nil {
+		return nil, false, kvError("Swap", namespace, key, err)
+	}
+	if err := validateKey(m.options, namespace, key); err != nil {
+		return nil, false, kvError("Swap", namespace, key, err)
+	}
+	shard := m.shard(namespace, key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	// a record of nil value is reported as not existing
+	old := shard.bucket[namespace][string(key)]
+	m.put(shard, namespace, key, value)
+	return old, old != nil, nil
+}
+
+// UnsafeGet retrieves a record. The in-memory KV store never copies the value, so there is nothing to release
+func (m *memKVStore) UnsafeGet(namespace string, key []byte) ([]byte, func(), error) {
+	value, err := m.Get(namespace, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, func() {}, nil
+}
+
+// Delete deletes a record
+func (m *memKVStore) Delete(namespace string, key []byte) error {
+	if err := m.checkNamespace(namespace); err != nil {
+		return kvError("Delete", namespace, key, err)
+	}
+	if err := validateKey(m.options, namespace, key); err != nil {
+		return kvError("Delete", namespace, key, err)
+	}
+	shard := m.shard(namespace, key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	shard.delete(namespace, key)
+	return nil
+}
+
+// Commit commits a batch. The shards written by the batch are locked all together, so the commit is atomic
+func (m *memKVStore) Commit(b KVStoreBatch) (e error) {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	if err := validateBatchKeys(m.options, b); err != nil {
+		return err
+	}
+	unlock, err := m.lockShardsOf(b)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// the records overwritten so far, to roll back if the commit fails
+	type undo struct {
+		namespace string
+		key       []byte
+		value     []byte
+		existed   bool
+	}
+	var undos []undo
+	defer func() {
+		if e == nil {
+			succeed = true
+			return
+		}
+		for i := len(undos) - 1; i >= 0; i-- {
+			u := undos[i]
+			shard := m.shard(u.namespace, u.key)
+			if u.existed {
+				m.put(shard, u.namespace, u.key, u.value)
+			} else {
+				shard.delete(u.namespace, u.key)
+			}
+		}
+	}()
+	for i := 0; i < b.Size(); i++ {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		if err := m.checkNamespace(write.namespace); err != nil {
+			return err
+		}
+		shard := m.shard(write.namespace, write.key)
+		value, existed := shard.bucket[write.namespace][string(write.key)]
+		if write.writeType == Put {
+			m.put(shard, write.namespace, write.key, write.value)
+		} else if write.writeType == PutIfNotExists {
+			if err := m.putIfNotExists(shard, write.namespace, write.key, write.value); err != nil {
+				return err
+			}
+		} else if write.writeType == Delete {
+			shard.delete(write.namespace, write.key)
+		} else if write.writeType == AddCounter {
+			counter, err := addToCounter(value, write.value)
+			if err != nil {
+				return err
+			}
+			m.put(shard, write.namespace, write.key, counter)
+		}
+		undos = append(undos, undo{namespace: write.namespace, key: write.key, value: value, existed: existed})
+	}
+	return nil
+}
+
+// CommitCounting commits a batch, skipping PutIfNotExists entries whose key already exists
+func (m *memKVStore) CommitCounting(b KVStoreBatch) (uint64, uint64, error) {
+	b.Lock()
+	if b.committed() {
+		b.Unlock()
+		return 0, 0, ErrBatchAlreadyCommitted
+	}
+	if err := validateBatchKeys(m.options, b); err != nil {
+		b.Unlock()
+		return 0, 0, err
+	}
+	unlock, err := m.lockShardsOf(b)
+	if err != nil {
+		b.Unlock()
+		return 0, 0, err
+	}
+	defer unlock()
+
+	// check the namespaces and counters upfront, since the entries applied are not rolled back
+	counters := make(map[cacheKey][]byte)
+	for i := 0; i < b.Size(); i++ {
+		write, err := b.Entry(i)
+		if err == nil {
+			err = m.checkNamespace(write.namespace)
+		}
+		if err == nil {
+			err = m.stageCounter(counters, write)
+		}
+		if err != nil {
+			b.Unlock()
+			return 0, 0, err
+		}
+	}
+	var applied, skipped uint64
+	for i := 0; i < b.Size(); i++ {
+		write, err := b.Entry(i)
+		if err != nil {
+			b.Unlock()
+			return 0, 0, err
+		}
+		shard := m.shard(write.namespace, write.key)
+		if write.writeType == Put {
+			m.put(shard, write.namespace, write.key, write.value)
+		} else if write.writeType == PutIfNotExists {
+			if err := m.putIfNotExists(shard, write.namespace, write.key, write.value); err != nil {
+				skipped++
+				continue
+			}
+		} else if write.writeType == Delete {
+			shard.delete(write.namespace, write.key)
+		} else if write.writeType == AddCounter {
+			counter, err := addToCounter(shard.bucket[write.namespace][string(write.key)], write.value)
+			if err != nil {
+				b.Unlock()
+				return 0, 0, err
+			}
+			m.put(shard, write.namespace, write.key, counter)
+		}
+		applied++
+	}
+	// clear the batch since commit succeeds
+	b.ClearAndUnlock()
+	return applied, skipped, nil
+}
+
+// PutIfNotExistsBatch inserts the records whose keys do not exist yet, with the shards of all keys locked
+func (m *memKVStore) PutIfNotExistsBatch(namespace string, kvs []KeyValue) ([]bool, error) {
+	if err := m.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	entries := make([]writeInfo, len(kvs))
+	for i, kv := range kvs {
+		entries[i] = writeInfo{writeType: PutIfNotExists, namespace: namespace, key: kv.Key, value: kv.Value}
+	}
+	unlock, err := m.lockShardsOf(newBatchOf(entries))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	inserted := make([]bool, len(kvs))
+	for i, kv := range kvs {
+		inserted[i] = m.putIfNotExists(m.shard(namespace, kv.Key), namespace, kv.Key, kv.Value) == nil
+	}
+	return inserted, nil
+}
+
+// StreamAll calls fn on each record of the namespace, serially
+func (m *memKVStore) StreamAll(namespace string, fn func([]byte, []byte) error) error {
+	m.rlockAll()
+	defer m.runlockAll()
+
+	for _, shard := range m.shards {
+		for k, v := range shard.bucket[namespace] {
+			if err := fn([]byte(k), v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Clear removes all records of all namespaces
+func (m *memKVStore) Clear() error {
+	m.lockAll()
+	defer m.unlockAll()
+
+	for _, shard := range m.shards {
+		shard.bucket = make(map[string]map[string][]byte)
+	}
+	m.nsMutex.Lock()
+	m.namespaces = make(map[string]struct{})
+	m.nsMutex.Unlock()
+	m.createNamespaces()
+	return nil
+}
+
+// IsEmpty returns true if no shard has any record
+func (m *memKVStore) IsEmpty() (bool, error) {
+	m.rlockAll()
+	defer m.runlockAll()
+
+	for _, shard := range m.shards {
+		for _, bucket := range shard.bucket {
+			for _, v := range bucket {
+				// a record of nil value is reported as not existing
+				if v != nil {
+					return false, nil
+				}
+			}
+		}
+	}
+	return true, nil
+}
+
+// Sync is a no-op since data is not kept on disk
+func (m *memKVStore) Sync() error { return nil }
+
+// Snapshot takes a snapshot by copying the records of all namespaces
+func (m *memKVStore) Snapshot() (Snapshot, error) {
+	m.rlockAll()
+	defer m.runlockAll()
+
+	store := newMemKVStore(m.options)
+	for i, shard := range m.shards {
+		for namespace, bucket := range shard.bucket {
+			b := make(map[string][]byte, len(bucket))
+			for k, v := range bucket {
+				b[k] = v
+			}
+			store.shards[i].bucket[namespace] = b
+		}
+	}
+	m.nsMutex.RLock()
+	for namespace := range m.namespaces {
+		store.namespaces[namespace] = struct{}{}
+	}
+	m.nsMutex.RUnlock()
+	return &memSnapshot{store: store}, nil
+}
+
+// CreateNamespace creates the namespace if it does not exist yet
+func (m *memKVStore) CreateNamespace(namespace string) error {
+	m.nsMutex.Lock()
+	defer m.nsMutex.Unlock()
+	m.namespaces[namespace] = struct{}{}
+	return nil
+}
+
+// HasNamespace returns true if the namespace has been created or written to
+func (m *memKVStore) HasNamespace(namespace string) (bool, error) {
+	m.nsMutex.RLock()
+	defer m.nsMutex.RUnlock()
+	_, ok := m.namespaces[namespace]
+	return ok, nil
+}
+
+// SwapNamespaces swaps the records of the two namespaces while all shards are locked
+func (m *memKVStore) SwapNamespaces(ns1, ns2 string) error {
+	if ns1 == ns2 {
+		return nil
+	}
+	m.lockAll()
+	defer m.unlockAll()
+
+	// records move to other shards as the shard depends on the namespace
+	records := make(map[string]map[string][]byte)
+	for _, shard := range m.shards {
+		for _, namespace := range []string{ns1, ns2} {
+			if records[namespace] == nil {
+				records[namespace] = make(map[string][]byte)
+			}
+			for k, v := range shard.bucket[namespace] {
+				records[namespace][k] = v
+			}
+			delete(shard.bucket, namespace)
+		}
+	}
+	for namespace, other := range map[string]string{ns1: ns2, ns2: ns1} {
+		for k, v := range records[other] {
+			shard := m.shard(namespace, []byte(k))
+			bucket, ok := shard.bucket[namespace]
+			if !ok {
+				bucket = make(map[string][]byte)
+				shard.bucket[namespace] = bucket
+			}
+			bucket[k] = v
+		}
+	}
+
+	m.nsMutex.Lock()
+	defer m.nsMutex.Unlock()
+	_, has1 := m.namespaces[ns1]
+	_, has2 := m.namespaces[ns2]
+	delete(m.namespaces, ns1)
+	delete(m.namespaces, ns2)
+	if has1 {
+		m.namespaces[ns2] = struct{}{}
+	}
+	if has2 {
+		m.namespaces[ns1] = struct{}{}
+	}
+	return nil
+}
+
+// SnapshotGet retrieves the records of the keys while the shards holding them are read-locked
+func (m *memKVStore) SnapshotGet(namespace string, keys [][]byte) ([][]byte, error) {
+	indexes := make([]int, len(keys))
+	for i, key := range keys {
+		indexes[i] = m.shardIndex(namespace, key)
+	}
+	indexes = uniqueSorted(indexes)
+	for _, index := range indexes {
+		m.shards[index].mutex.RLock()
+	}
+	defer func() {
+		for _, index := range indexes {
+			m.shards[index].mutex.RUnlock()
+		}
+	}()
+
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = m.shard(namespace, key).bucket[namespace][string(key)]
+	}
+	return values, nil
+}
+
+// KeysPaged returns up to limit keys of the namespace after the cursor, by sorting all keys of the namespace
+func (m *memKVStore) KeysPaged(namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	if limit <= 0 {
+		return nil, nil, errors.Wrapf(ErrInvalidDB, "invalid limit %d", limit)
+	}
+	m.rlockAll()
+	var keys []string
+	for _, shard := range m.shards {
+		for k, v := range shard.bucket[namespace] {
+			// a record of nil value is reported as not existing
+			if v != nil && k > string(after) {
+				keys = append(keys, k)
+			}
+		}
+	}
+	m.runlockAll()
+
+	sort.Strings(keys)
+	return pageOf(keys, limit)
+}
+
+// Get retrieves a record
+func (s *memSnapshot) Get(namespace string, key []byte) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.store == nil {
+		return nil, errors.Wrap(ErrInvalidDB, "snapshot is released")
+	}
+	return s.store.Get(namespace, key)
+}
+
+// Put returns ErrReadOnlyTxn
+func (s *memSnapshot) Put(string, []byte, []byte) error { return ErrReadOnlyTxn }
+
+// Delete returns ErrReadOnlyTxn
+func (s *memSnapshot) Delete(string, []byte) error { return ErrReadOnlyTxn }
+
+// Release drops the copied records
+func (s *memSnapshot) Release() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.store = nil
+}
+
+//======================================
+// private functions
+//======================================
+
+func newMemKVStore(options kvStoreOptions) *memKVStore {
+	if options.memShards <= 0 {
+		options.memShards = defaultMemShards
+	}
+	m := &memKVStore{
+		options:    options,
+		shards:     make([]*memShard, options.memShards),
+		namespaces: make(map[string]struct{}),
+	}
+	for i := range m.shards {
+		m.shards[i] = &memShard{bucket: make(map[string]map[string][]byte)}
+	}
+	m.createNamespaces()
+	return m
+}
+
+// namespaceNames returns the namespaces which have been created or written to
+func (m *memKVStore) namespaceNames() ([]string, error) {
+	m.nsMutex.RLock()
+	defer m.nsMutex.RUnlock()
+
+	names := make([]string, 0, len(m.namespaces))
+	for namespace := range m.namespaces {
+		names = append(names, namespace)
+	}
+	return names, nil
+}
+
+// createNamespaces creates the namespaces given by WithExplicitNamespaces
+func (m *memKVStore) createNamespaces() {
+	m.nsMutex.Lock()
+	defer m.nsMutex.Unlock()
+	for _, namespace := range m.options.namespaces {
+		m.namespaces[namespace] = struct{}{}
+	}
+}
+
+// checkNamespace returns ErrInvalidDB if the namespace must be created before being written to
+func (m *memKVStore) checkNamespace(namespace string) error {
+	if !m.options.explicitNamespaces {
+		return nil
+	}
+	if ok, _ := m.HasNamespace(namespace); !ok {
+		return errors.Wrapf(ErrInvalidDB, "namespace %s is not created", namespace)
+	}
+	return nil
+}
+
+// stageCounter tracks the value written by the entry into counters, as the entries before were applied, and returns
+// an error if the entry adds to a record which is not a counter. The shards must be locked
+func (m *memKVStore) stageCounter(counters map[cacheKey][]byte, write *writeInfo) error {
+	k := cacheKey{namespace: write.namespace, key: string(write.key)}
+	value, ok := counters[k]
+	if !ok {
+		value = m.shard(write.namespace, write.key).bucket[write.namespace][string(write.key)]
+	}
+	switch write.writeType {
+	case Put:
+		value = write.value
+	case PutIfNotExists:
+		if value == nil {
+			value = write.value
+		}
+	case Delete:
+		value = nil
+	case AddCounter:
+		counter, err := addToCounter(value, write.value)
+		if err != nil {
+			return err
+		}
+		value = counter
+	}
+	counters[k] = value
+	return nil
+}
+
+// shardIndex returns the index of the shard holding the record
+func (m *memKVStore) shardIndex(namespace string, key []byte) int {
+	h := fnv.New32a()
+	h.Write([]byte(namespace))
+	// separate namespace and key, so that ("a", "bc") and ("ab", "c") hash differently
+	h.Write([]byte{0})
+	h.Write(key)
+	return int(h.Sum32() % uint32(len(m.shards)))
+}
+
+func (m *memKVStore) shard(namespace string, key []byte) *memShard {
+	return m.shards[m.shardIndex(namespace, key)]
+}
+
+// lockShardsOf locks the shards written by the batch in the order of shard index, so committing batches never
+// deadlock each other, and returns the function to unlock them
+func (m *memKVStore) lockShardsOf(b KVStoreBatch) (func(), error) {
+	indexes := make([]int, b.Size())
+	for i := range indexes {
+		write, err := b.Entry(i)
+		if err != nil {
+			return nil, err
+		}
+		indexes[i] = m.shardIndex(write.namespace, write.key)
+	}
+	indexes = uniqueSorted(indexes)
+	for _, index := range indexes {
+		m.shards[index].mutex.Lock()
+	}
+	return func() {
+		for _, index := range indexes {
+			m.shards[index].mutex.Unlock()
+		}
+	}, nil
+}
+
+// uniqueSorted sorts the shard indexes and removes the duplicates in place
+func uniqueSorted(indexes []int) []int {
+	sort.Ints(indexes)
+	unique := indexes[:0]
+	for _, index := range indexes {
+		if len(unique) == 0 || index != unique[len(unique)-1] {
+			unique = append(unique, index)
+		}
+	}
+	return unique
+}
+
+func (m *memKVStore) lockAll() {
+	for _, shard := range m.shards {
+		shard.mutex.Lock()
+	}
+}
+
+func (m *memKVStore) unlockAll() {
+	for _, shard := range m.shards {
+		shard.mutex.Unlock()
+	}
+}
+
+func (m *memKVStore) rlockAll() {
+	for _, shard := range m.shards {
+		shard.mutex.RLock()
+	}
+}
+
+func (m *memKVStore) runlockAll() {
+	for _, shard := range m.shards {
+		shard.mutex.RUnlock()
+	}
+}
+
+// put puts the record into the shard, which must be locked
+func (m *memKVStore) put(shard *memShard, namespace string, key, value []byte) {
+	bucket, ok := shard.bucket[namespace]
+	if !ok {
+		bucket = make(map[string][]byte)
+		shard.bucket[namespace] = bucket
+	}
+	bucket[string(key)] = value
+
+	m.nsMutex.RLock()
+	_, ok = m.namespaces[namespace]
+	m.nsMutex.RUnlock()
+	if !ok {
+		m.nsMutex.Lock()
+		m.namespaces[namespace] = struct{}{}
+		m.nsMutex.Unlock()
+	}
+}
+
+// putIfNotExists puts the record into the shard if it does not exist, the shard must be locked
+func (m *memKVStore) putIfNotExists(shard *memShard, namespace string, key, value []byte) error {
+	if _, ok := shard.bucket[namespace][string(key)]; ok {
+		return ErrAlreadyExist
+	}
+	m.put(shard, namespace, key, value)
+	return nil
+}
+
+// delete deletes the record from the shard, which must be locked
+func (s *memShard) delete(namespace string, key []byte) {
+	if bucket, ok := s.bucket[namespace]; ok {
+		delete(bucket, string(key))
+	}
+}
@@ -7,14 +7,28 @@
 package db
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/boltdb/bolt"
+	"github.com/dgraph-io/badger"
+	"github.com/facebookgo/clock"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/iotexproject/iotex-core/config"
+	"github.com/iotexproject/iotex-core/pkg/hash"
 	"github.com/iotexproject/iotex-core/testutil"
 )
 
@@ -84,284 +98,2457 @@ func TestKVStorePutGet(t *testing.T) {
 	})
 }
 
+func TestMemKVStoreNilValue(t *testing.T) {
+	require := require.New(t)
+
+	kvStore := NewMemKVStore()
+	require.NoError(kvStore.Put(bucket1, testK1[0], nil))
+	_, err := kvStore.Get(bucket1, testK1[0])
+	require.Equal(ErrNotExist, errors.Cause(err))
+	require.Equal(ErrAlreadyExist, errors.Cause(kvStore.PutIfNotExists(bucket1, testK1[0], testV1[0])))
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+	value, err := kvStore.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], value)
+}
+
+func TestGetOrDefault(t *testing.T) {
+	testGetOrDefault := func(kvStore KVStore, hasNamespaces bool, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+
+		// missing namespace
+		value, err := GetOrDefault(kvStore, bucket1, testK1[0], testV2[0])
+		if hasNamespaces {
+			require.Error(err)
+			require.Nil(value)
+		} else {
+			require.NoError(err)
+			require.Equal(testV2[0], value)
+		}
+
+		// present
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		value, err = GetOrDefault(kvStore, bucket1, testK1[0], testV2[0])
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+
+		// absent, and the default returned is a copy
+		value, err = GetOrDefault(kvStore, bucket1, testK1[1], testV2[0])
+		require.NoError(err)
+		require.Equal(testV2[0], value)
+		value[0] = 'x'
+		require.Equal([]byte("value_4"), testV2[0])
+		value, err = GetOrDefault(kvStore, bucket1, testK1[1], nil)
+		require.NoError(err)
+		require.Nil(value)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testGetOrDefault(NewMemKVStore(), true, t)
+	})
+
+	dbCfg := cfg
+	path := "test-get-or-default.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testGetOrDefault(NewOnDiskDB(dbCfg), true, t)
+	})
+
+	path = "test-get-or-default.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testGetOrDefault(NewOnDiskDB(dbCfg), false, t)
+	})
+}
+
+func TestExplicitNamespaces(t *testing.T) {
+	testExplicitNamespaces := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		manager, ok := kvStore.(NamespaceManager)
+		require.True(ok)
+
+		// the namespaces given by the option are created on start
+		ok, err := manager.HasNamespace(bucket1)
+		require.NoError(err)
+		require.True(ok)
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+
+		// writes to a namespace not created fail
+		require.Equal(ErrInvalidDB, errors.Cause(kvStore.Put(bucket2, testK1[0], testV1[0])))
+		require.Equal(ErrInvalidDB, errors.Cause(kvStore.PutIfNotExists(bucket2, testK1[0], testV1[0])))
+		require.Equal(ErrInvalidDB, errors.Cause(kvStore.Delete(bucket2, testK1[0])))
+		batch := NewBatch()
+		batch.Put(bucket1, testK1[1], testV1[1], "")
+		batch.Put(bucket2, testK1[1], testV1[1], "")
+		require.Equal(ErrInvalidDB, errors.Cause(kvStore.Commit(batch)))
+		_, err = kvStore.Get(bucket1, testK1[1])
+		require.Error(err)
+		ok, err = manager.HasNamespace(bucket2)
+		require.NoError(err)
+		require.False(ok)
+
+		// and succeed once the namespace is created
+		require.NoError(manager.CreateNamespace(bucket2))
+		require.NoError(kvStore.Commit(batch))
+		value, err := kvStore.Get(bucket2, testK1[1])
+		require.NoError(err)
+		require.Equal(testV1[1], value)
+		require.NoError(kvStore.Put(bucket2, testK1[0], testV1[0]))
+		require.NoError(kvStore.Delete(bucket2, testK1[0]))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testExplicitNamespaces(NewMemKVStore(WithExplicitNamespaces(bucket1)), t)
+	})
+
+	dbCfg := cfg
+	path := "test-explicit-namespaces.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testExplicitNamespaces(NewOnDiskDB(dbCfg, WithExplicitNamespaces(bucket1)), t)
+	})
+
+	path = "test-explicit-namespaces.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testExplicitNamespaces(NewOnDiskDB(dbCfg, WithExplicitNamespaces(bucket1)), t)
+	})
+}
+
+func TestSwapNamespaces(t *testing.T) {
+	testSwapNamespaces := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		swapper, ok := kvStore.(NamespaceSwapper)
+		require.True(ok)
+
+		// rebuild the index into a shadow namespace, then cut over
+		for i := 0; i < 3; i++ {
+			require.NoError(kvStore.Put(bucket1, testK1[i], testV1[i]))
+		}
+		for i := 0; i < 2; i++ {
+			require.NoError(kvStore.Put(bucket2, testK2[i], testV2[i]))
+		}
+		require.NoError(swapper.SwapNamespaces(bucket1, bucket2))
+		for i := 0; i < 2; i++ {
+			value, err := kvStore.Get(bucket1, testK2[i])
+			require.NoError(err)
+			require.Equal(testV2[i], value)
+			_, err = kvStore.Get(bucket2, testK2[i])
+			require.True(isNotExist(err))
+		}
+		for i := 0; i < 3; i++ {
+			value, err := kvStore.Get(bucket2, testK1[i])
+			require.NoError(err)
+			require.Equal(testV1[i], value)
+			_, err = kvStore.Get(bucket1, testK1[i])
+			require.True(isNotExist(err))
+		}
+
+		// drop the old index by swapping with a namespace which does not exist
+		require.NoError(swapper.SwapNamespaces(bucket2, bucket3))
+		_, err := kvStore.Get(bucket2, testK1[0])
+		require.True(isNotExist(err))
+		value, err := kvStore.Get(bucket3, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+		require.NoError(swapper.SwapNamespaces(bucket1, bucket1))
+		value, err = kvStore.Get(bucket1, testK2[0])
+		require.NoError(err)
+		require.Equal(testV2[0], value)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testSwapNamespaces(NewMemKVStore(), t)
+	})
+
+	dbCfg := cfg
+	path := "test-swap-namespaces.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testSwapNamespaces(NewOnDiskDB(dbCfg), t)
+	})
+
+	dbCfg.UseBadgerDB = true
+	_, ok := NewOnDiskDB(dbCfg).(NamespaceSwapper)
+	require.False(t, ok)
+}
+
+func TestSnapshotGet(t *testing.T) {
+	testSnapshotGet := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		getter, ok := kvStore.(SnapshotGetter)
+		require.True(ok)
+
+		keys := [][]byte{testK1[0], testK1[1], testK1[2], testK2[0]}
+		values, err := getter.SnapshotGet(bucket1, keys)
+		require.NoError(err)
+		require.Equal(make([][]byte, len(keys)), values)
+
+		// every commit writes the same value to all keys but the last, so a consistent read sees them all equal
+		done := make(chan struct{})
+		writerErr := make(chan error, 1)
+		go func() {
+			defer close(writerErr)
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				batch := NewBatch()
+				for _, key := range keys[:len(keys)-1] {
+					batch.Put(bucket1, key, []byte(fmt.Sprintf("value_%d", i)), "")
+				}
+				if err := kvStore.Commit(batch); err != nil {
+					writerErr <- err
+					return
+				}
+			}
+		}()
+		for n := 0; n < 200; n++ {
+			values, err := getter.SnapshotGet(bucket1, keys)
+			require.NoError(err)
+			require.Nil(values[len(values)-1])
+			for _, value := range values[1 : len(values)-1] {
+				require.Equal(values[0], value)
+			}
+		}
+		close(done)
+		require.NoError(<-writerErr)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testSnapshotGet(NewMemKVStore(WithMemShards(4)), t)
+	})
+
+	dbCfg := cfg
+	path := "test-snapshot-get.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testSnapshotGet(NewOnDiskDB(dbCfg), t)
+	})
+
+	path = "test-snapshot-get.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testSnapshotGet(NewOnDiskDB(dbCfg), t)
+	})
+}
+
+func TestKeysPaged(t *testing.T) {
+	testKeysPaged := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		pager, ok := kvStore.(KeyPager)
+		require.True(ok)
+
+		keys, cursor, err := pager.KeysPaged(bucket1, nil, 10)
+		require.NoError(err)
+		require.Empty(keys)
+		require.Nil(cursor)
+		_, _, err = pager.KeysPaged(bucket1, nil, 0)
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+
+		var expected []string
+		for i := 24; i >= 0; i-- {
+			key := fmt.Sprintf("key_%02d", i)
+			expected = append([]string{key}, expected...)
+			require.NoError(kvStore.Put(bucket1, []byte(key), testV1[0]))
+		}
+		require.NoError(kvStore.Put(bucket2, []byte("key_00"), testV1[0]))
+
+		for _, limit := range []int{1, 7, 25, 100} {
+			var listed []string
+			var after []byte
+			for pages := 0; pages <= len(expected); pages++ {
+				keys, cursor, err := pager.KeysPaged(bucket1, after, limit)
+				require.NoError(err)
+				require.True(len(keys) <= limit)
+				for _, key := range keys {
+					listed = append(listed, string(key))
+				}
+				if cursor == nil {
+					break
+				}
+				after = cursor
+			}
+			require.Equal(expected, listed)
+		}
+
+		// the cursor does not have to be an existing key
+		keys, cursor, err = pager.KeysPaged(bucket1, []byte("key_22a"), 10)
+		require.NoError(err)
+		require.Equal([][]byte{[]byte("key_23"), []byte("key_24")}, keys)
+		require.Nil(cursor)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testKeysPaged(NewMemKVStore(), t)
+	})
+
+	dbCfg := cfg
+	path := "test-keys-paged.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testKeysPaged(NewOnDiskDB(dbCfg), t)
+	})
+
+	path = "test-keys-paged.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testKeysPaged(NewOnDiskDB(dbCfg), t)
+	})
+}
+
+func TestCommitBatchTwice(t *testing.T) {
+	testCommitBatchTwice := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+
+		for _, batch := range []KVStoreBatch{NewBatch(), NewCachedBatch()} {
+			batch.Put(bucket1, testK1[0], testV1[0], "")
+			require.NoError(kvStore.Commit(batch))
+			require.NoError(kvStore.Put(bucket1, testK1[0], testV1[1]))
+
+			// committing again leaves the KV store unchanged
+			require.Equal(ErrBatchAlreadyCommitted, errors.Cause(kvStore.Commit(batch)))
+			if committer, ok := kvStore.(CountingCommitter); ok {
+				_, _, err := committer.CommitCounting(batch)
+				require.Equal(ErrBatchAlreadyCommitted, errors.Cause(err))
+			}
+			value, err := kvStore.Get(bucket1, testK1[0])
+			require.NoError(err)
+			require.Equal(testV1[1], value)
+
+			// the batch is usable again once new entries are staged, or it is cleared
+			batch.Put(bucket1, testK1[0], testV1[2], "")
+			require.NoError(kvStore.Commit(batch))
+			value, err = kvStore.Get(bucket1, testK1[0])
+			require.NoError(err)
+			require.Equal(testV1[2], value)
+			batch.Clear()
+			require.NoError(kvStore.Commit(batch))
+		}
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testCommitBatchTwice(NewMemKVStore(), t)
+	})
+
+	dbCfg := cfg
+	path := "test-commit-batch-twice.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testCommitBatchTwice(NewOnDiskDB(dbCfg), t)
+	})
+
+	path = "test-commit-batch-twice.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testCommitBatchTwice(NewOnDiskDB(dbCfg), t)
+	})
+}
+
+func TestNativeHandle(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	_, ok := BoltDB(NewMemKVStore())
+	require.False(ok)
+	_, ok = BadgerDB(NewMemKVStore())
+	require.False(ok)
+
+	dbCfg := cfg
+	path := "test-native-handle.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+	kvStore := NewOnDiskDB(dbCfg)
+	boltHandle, ok := BoltDB(kvStore)
+	require.True(ok)
+	require.Nil(boltHandle)
+	_, ok = BadgerDB(kvStore)
+	require.False(ok)
+	require.NoError(kvStore.Start(ctx))
+	boltHandle, ok = BoltDB(kvStore)
+	require.True(ok)
+	require.NotNil(boltHandle)
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+	require.NoError(boltHandle.View(func(tx *bolt.Tx) error {
+		require.Equal(testV1[0], tx.Bucket([]byte(bucket1)).Get(testK1[0]))
+		return nil
+	}))
+	require.NoError(kvStore.Stop(ctx))
+
+	// the handle is reachable through the KV stores the options wrap the BoltDB in
+	kvStore = NewOnDiskDB(dbCfg, WithChecksums(bucket1), WithAuditLog(0, false), WithLastWritten(bucket2))
+	require.NoError(kvStore.Start(ctx))
+	boltHandle, ok = BoltDB(kvStore)
+	require.True(ok)
+	require.NotNil(boltHandle)
+	_, ok = BadgerDB(kvStore)
+	require.False(ok)
+	require.NoError(kvStore.Stop(ctx))
+	_, ok = BoltDB(NewMemKVStore(WithChecksums(bucket1), WithAuditLog(0, false)))
+	require.False(ok)
+
+	path = "test-native-handle.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+	// the handle is reachable through the blob store and the audit log wrapping the BadgerDB
+	blobDir := "test-native-handle.blobs"
+	testutil.CleanupPath(t, blobDir)
+	defer testutil.CleanupPath(t, blobDir)
+	kvStore = NewOnDiskDB(dbCfg, WithExternalBlobs(64, blobDir), WithAuditLog(0, false))
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	badgerHandle, ok := BadgerDB(kvStore)
+	require.True(ok)
+	require.NotNil(badgerHandle)
+	_, ok = BoltDB(kvStore)
+	require.False(ok)
+}
+
+func TestEmptyValue(t *testing.T) {
+	testEmptyValue := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+
+		requireEmpty := func(value []byte, err error) {
+			require.NoError(err)
+			require.NotNil(value)
+			require.Len(value, 0)
+		}
+		require.NoError(kvStore.Put(bucket1, testK1[0], []byte{}))
+		batch := NewBatch()
+		batch.Put(bucket1, testK1[1], []byte{}, "")
+		require.NoError(kvStore.Commit(batch))
+		requireEmpty(kvStore.Get(bucket1, testK1[0]))
+		requireEmpty(kvStore.Get(bucket1, testK1[1]))
+		requireEmpty(GetOrDefault(kvStore, bucket1, testK1[0], testV1[0]))
+		require.Equal(ErrAlreadyExist, errors.Cause(kvStore.PutIfNotExists(bucket1, testK1[0], testV1[0])))
+
+		// a missing key is reported as such
+		_, err := kvStore.Get(bucket1, testK1[2])
+		require.Equal(ErrNotExist, errors.Cause(err))
+		require.NoError(kvStore.Delete(bucket1, testK1[0]))
+		_, err = kvStore.Get(bucket1, testK1[0])
+		require.Equal(ErrNotExist, errors.Cause(err))
+
+		values, err := kvStore.(SnapshotGetter).SnapshotGet(bucket1, [][]byte{testK1[1], testK1[2]})
+		require.NoError(err)
+		requireEmpty(values[0], nil)
+		require.Nil(values[1])
+
+		require.NoError(kvStore.(Streamer).StreamAll(bucket1, func(k, v []byte) error {
+			require.Equal(testK1[1], k)
+			requireEmpty(v, nil)
+			return nil
+		}))
+
+		snapshot, err := kvStore.(Snapshotter).Snapshot()
+		require.NoError(err)
+		defer snapshot.Release()
+		requireEmpty(snapshot.Get(bucket1, testK1[1]))
+		_, err = snapshot.Get(bucket1, testK1[2])
+		require.Equal(ErrNotExist, errors.Cause(err))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testEmptyValue(NewMemKVStore(), t)
+	})
+
+	dbCfg := cfg
+	path := "test-empty-value.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testEmptyValue(NewOnDiskDB(dbCfg), t)
+	})
+
+	path = "test-empty-value.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testEmptyValue(NewOnDiskDB(dbCfg), t)
+	})
+}
+
+func TestPutIfNotExistsBatch(t *testing.T) {
+	testPutIfNotExistsBatch := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		inserter, ok := kvStore.(BulkInserter)
+		require.True(ok)
+
+		inserted, err := inserter.PutIfNotExistsBatch(bucket1, nil)
+		require.NoError(err)
+		require.Empty(inserted)
+
+		require.NoError(kvStore.Put(bucket1, testK1[1], testV1[1]))
+		require.NoError(kvStore.Put(bucket2, testK1[0], testV2[0]))
+		inserted, err = inserter.PutIfNotExistsBatch(bucket1, []KeyValue{
+			{Key: testK1[0], Value: testV1[0]},
+			{Key: testK1[1], Value: testV2[1]},
+			{Key: testK1[2], Value: testV1[2]},
+		})
+		require.NoError(err)
+		require.Equal([]bool{true, false, true}, inserted)
+		for i, expected := range testV1 {
+			value, err := kvStore.Get(bucket1, testK1[i])
+			require.NoError(err)
+			require.Equal(expected, value)
+		}
+		// the same key in another namespace is unaffected
+		value, err := kvStore.Get(bucket2, testK1[0])
+		require.NoError(err)
+		require.Equal(testV2[0], value)
+
+		// inserting again inserts nothing
+		inserted, err = inserter.PutIfNotExistsBatch(bucket1, []KeyValue{
+			{Key: testK1[0], Value: testV2[0]},
+			{Key: testK1[2], Value: testV2[2]},
+		})
+		require.NoError(err)
+		require.Equal([]bool{false, false}, inserted)
+		value, err = kvStore.Get(bucket1, testK1[2])
+		require.NoError(err)
+		require.Equal(testV1[2], value)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testPutIfNotExistsBatch(NewMemKVStore(), t)
+	})
+
+	dbCfg := cfg
+	path := "test-put-if-not-exists-batch.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testPutIfNotExistsBatch(NewOnDiskDB(dbCfg), t)
+	})
+
+	path = "test-put-if-not-exists-batch.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testPutIfNotExistsBatch(NewOnDiskDB(dbCfg), t)
+	})
+}
+
+func TestUnsafeGet(t *testing.T) {
+	testUnsafeGet := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		getter, ok := kvStore.(UnsafeGetter)
+		require.True(ok)
+
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		require.NoError(kvStore.Put(bucket1, testK1[1], []byte{}))
+		value, release, err := getter.UnsafeGet(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+		release()
+		// releasing again is harmless
+		release()
+		value, release, err = getter.UnsafeGet(bucket1, testK1[1])
+		require.NoError(err)
+		require.NotNil(value)
+		require.Len(value, 0)
+		release()
+
+		_, release, err = getter.UnsafeGet(bucket1, testK1[2])
+		require.Equal(ErrNotExist, errors.Cause(err))
+		require.Nil(release)
+		_, _, err = getter.UnsafeGet(bucket2, testK1[0])
+		require.True(isNotExist(err))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testUnsafeGet(NewMemKVStore(), t)
+	})
+
+	dbCfg := cfg
+	path := "test-unsafe-get.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testUnsafeGet(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Bolt DB transaction", func(t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+
+		kvStore := NewOnDiskDB(dbCfg)
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		handle, _ := BoltDB(kvStore)
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		// the read transaction is open until the value is released
+		_, release, err := kvStore.(UnsafeGetter).UnsafeGet(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(1, handle.Stats().OpenTxN)
+		release()
+		require.Equal(0, handle.Stats().OpenTxN)
+		_, _, err = kvStore.(UnsafeGetter).UnsafeGet(bucket1, testK1[1])
+		require.Error(err)
+		require.Equal(0, handle.Stats().OpenTxN)
+	})
+
+	path = "test-unsafe-get.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testUnsafeGet(NewOnDiskDB(dbCfg), t)
+	})
+}
+
+func TestGetMapped(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	dbCfg := cfg
+	path := "test-get-mapped.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+
+	kvStore := NewOnDiskDB(dbCfg)
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	handle, _ := BoltDB(kvStore)
+	getter, ok := kvStore.(MappedGetter)
+	require.True(ok)
+	// free pages for the writes below, so that they do not have to remap the file while the value is held
+	batch := NewBatch()
+	for i := 0; i < 1000; i++ {
+		batch.Put(bucket2, []byte(fmt.Sprintf("key_%04d", i)), make([]byte, 64), "")
+	}
+	require.NoError(kvStore.Commit(batch))
+	for i := 0; i < 1000; i++ {
+		batch.Delete(bucket2, []byte(fmt.Sprintf("key_%04d", i)), "")
+	}
+	require.NoError(kvStore.Commit(batch))
+
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+	value, err := getter.GetMapped(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], value.Bytes())
+	require.Equal(1, handle.Stats().OpenTxN)
+
+	// the mapped bytes are not overwritten while the value is held
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[1]))
+	require.NoError(kvStore.Delete(bucket1, testK1[0]))
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[2]))
+	require.Equal(testV1[0], value.Bytes())
+	current, err := kvStore.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[2], current)
+
+	// closing releases the read transaction and the bytes
+	require.NoError(value.Close())
+	require.Equal(0, handle.Stats().OpenTxN)
+	require.Nil(value.Bytes())
+	// closing again is harmless
+	require.NoError(value.Close())
+	require.Equal(0, handle.Stats().OpenTxN)
+
+	value, err = getter.GetMapped(bucket1, testK1[1])
+	require.Equal(ErrNotExist, errors.Cause(err))
+	require.Nil(value)
+	_, err = getter.GetMapped(bucket3, testK1[0])
+	require.True(isNotExist(err))
+	require.Equal(0, handle.Stats().OpenTxN)
+}
+
+func TestRename(t *testing.T) {
+	testRename := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		renamer, ok := kvStore.(Renamer)
+		require.True(ok)
+
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		require.NoError(kvStore.Put(bucket1, testK1[1], testV1[1]))
+		require.NoError(renamer.Rename(bucket1, testK1[0], testK1[2]))
+		value, err := kvStore.Get(bucket1, testK1[2])
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+		_, err = kvStore.Get(bucket1, testK1[0])
+		require.Equal(ErrNotExist, errors.Cause(err))
+
+		// a missing source fails
+		require.Equal(ErrNotExist, errors.Cause(renamer.Rename(bucket1, testK1[0], testK2[0])))
+		_, err = kvStore.Get(bucket1, testK2[0])
+		require.Equal(ErrNotExist, errors.Cause(err))
+		require.True(isNotExist(renamer.Rename(bucket2, testK1[0], testK2[0])))
+
+		// an existing destination fails, and both records are left as they are
+		require.Equal(ErrAlreadyExist, errors.Cause(renamer.Rename(bucket1, testK1[2], testK1[1])))
+		value, err = kvStore.Get(bucket1, testK1[1])
+		require.NoError(err)
+		require.Equal(testV1[1], value)
+		value, err = kvStore.Get(bucket1, testK1[2])
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+
+		// renaming a key to itself does nothing
+		require.NoError(renamer.Rename(bucket1, testK1[1], testK1[1]))
+		value, err = kvStore.Get(bucket1, testK1[1])
+		require.NoError(err)
+		require.Equal(testV1[1], value)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testRename(NewMemKVStore(), t)
+	})
+
+	dbCfg := cfg
+	path := "test-rename.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testRename(NewOnDiskDB(dbCfg), t)
+	})
+
+	path = "test-rename.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testRename(NewOnDiskDB(dbCfg), t)
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	testUpdate := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		updater, ok := kvStore.(Updater)
+		require.True(ok)
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+
+		// the transaction sees its own writes
+		fn := func(tx Tx) error {
+			value, err := tx.Get(bucket1, testK1[0])
+			require.NoError(err)
+			require.Equal(testV1[0], value)
+			require.NoError(tx.Put(bucket1, testK1[1], testV1[1]))
+			require.NoError(tx.Put(bucket2, testK2[0], testV2[0]))
+			require.NoError(tx.Delete(bucket1, testK1[0]))
+			has, err := tx.Has(bucket1, testK1[0])
+			require.NoError(err)
+			require.False(has)
+			has, err = tx.Has(bucket1, testK1[1])
+			require.NoError(err)
+			require.True(has)
+			value, err = tx.Get(bucket2, testK2[0])
+			require.NoError(err)
+			require.Equal(testV2[0], value)
+			_, err = tx.Get(bucket1, testK1[2])
+			require.Equal(ErrNotExist, errors.Cause(err))
+			return nil
+		}
+
+		// an error returned rolls back all writes
+		errRollback := errors.New("roll back")
+		require.Equal(errRollback, updater.Update(func(tx Tx) error {
+			require.NoError(fn(tx))
+			return errRollback
+		}))
+		value, err := kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+		_, err = kvStore.Get(bucket1, testK1[1])
+		require.Equal(ErrNotExist, errors.Cause(err))
+		_, err = kvStore.Get(bucket2, testK2[0])
+		require.True(isNotExist(err))
+
+		// nil returned commits all writes
+		require.NoError(updater.Update(fn))
+		_, err = kvStore.Get(bucket1, testK1[0])
+		require.Equal(ErrNotExist, errors.Cause(err))
+		value, err = kvStore.Get(bucket1, testK1[1])
+		require.NoError(err)
+		require.Equal(testV1[1], value)
+		value, err = kvStore.Get(bucket2, testK2[0])
+		require.NoError(err)
+		require.Equal(testV2[0], value)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testUpdate(NewMemKVStore(), t)
+	})
+
+	dbCfg := cfg
+	path := "test-update.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testUpdate(NewOnDiskDB(dbCfg), t)
+	})
+
+	path = "test-update.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testUpdate(NewOnDiskDB(dbCfg), t)
+	})
+}
+
+func TestStopWithInFlightOperations(t *testing.T) {
+	testStop := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		// the operations racing with Stop either succeed or see the DB closed
+		require.NoError(kvStore.Start(ctx))
+		var wg sync.WaitGroup
+		errs := make(chan error, 1024)
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				key := []byte(fmt.Sprintf("key_%d", i))
+				for {
+					err := kvStore.Put(bucket1, key, testV1[0])
+					if err == nil {
+						_, err = kvStore.Get(bucket1, key)
+					}
+					if err == nil {
+						batch := NewBatch()
+						batch.Put(bucket2, key, testV2[0], "")
+						err = kvStore.Commit(batch)
+					}
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}(i)
+		}
+		time.Sleep(10 * time.Millisecond)
+		require.NoError(kvStore.Stop(ctx))
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.Equal(ErrDBClosed, errors.Cause(err))
+		}
+		_, err := kvStore.Get(bucket1, testK1[0])
+		require.Equal(ErrDBClosed, errors.Cause(err))
+		require.NoError(kvStore.Stop(ctx))
+
+		// Stop gives up waiting once ctx is done, and the DB is closed after the in-flight operation finishes
+		require.NoError(kvStore.Start(ctx))
+		started := make(chan struct{})
+		resume := make(chan struct{})
+		updated := make(chan error, 1)
+		go func() {
+			updated <- kvStore.(Updater).Update(func(tx Tx) error {
+				close(started)
+				<-resume
+				return tx.Put(bucket1, testK1[0], testV1[0])
+			})
+		}()
+		<-started
+		timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		require.Equal(context.DeadlineExceeded, errors.Cause(kvStore.Stop(timeoutCtx)))
+		close(resume)
+		require.NoError(<-updated)
+		require.NoError(kvStore.Stop(ctx))
+		require.Equal(ErrDBClosed, errors.Cause(kvStore.Put(bucket1, testK1[0], testV1[0])))
+
+		// the records committed before Stop are kept
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		value, err := kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+	}
+
+	dbCfg := cfg
+	path := "test-stop.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testStop(NewOnDiskDB(dbCfg), t)
+	})
+
+	path = "test-stop.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testStop(NewOnDiskDB(dbCfg), t)
+	})
+}
+
+func BenchmarkBoltUnsafeGet(b *testing.B) {
+	require := require.New(b)
+	ctx := context.Background()
+	dbCfg := cfg
+	path := "bench-unsafe-get.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	require.NoError(os.RemoveAll(path))
+	defer func() {
+		require.NoError(os.RemoveAll(path))
+	}()
+
+	kvStore := NewOnDiskDB(dbCfg)
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	require.NoError(kvStore.Put(bucket1, testK1[0], make([]byte, 64*1024)))
+
+	b.Run("Get", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			if _, err := kvStore.Get(bucket1, testK1[0]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("UnsafeGet", func(b *testing.B) {
+		getter := kvStore.(UnsafeGetter)
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			_, release, err := getter.UnsafeGet(bucket1, testK1[0])
+			if err != nil {
+				b.Fatal(err)
+			}
+			release()
+		}
+	})
+	b.Run("GetMapped", func(b *testing.B) {
+		getter := kvStore.(MappedGetter)
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			value, err := getter.GetMapped(bucket1, testK1[0])
+			if err != nil {
+				b.Fatal(err)
+			}
+			value.Close()
+		}
+	})
+}
+
 func TestBatchRollback(t *testing.T) {
 	testBatchRollback := func(kvStore KVStore, t *testing.T) {
-		assert := assert.New(t)
+		assert := assert.New(t)
+		ctx := context.Background()
+
+		assert.Nil(kvStore.Start(ctx))
+		defer func() {
+			err := kvStore.Stop(ctx)
+			assert.Nil(err)
+		}()
+
+		assert.Nil(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		value, err := kvStore.Get(bucket1, testK1[0])
+		assert.Nil(err)
+		assert.Equal(testV1[0], value)
+		assert.Nil(kvStore.Put(bucket1, testK1[1], testV1[1]))
+		value, err = kvStore.Get(bucket1, testK1[1])
+		assert.Nil(err)
+		assert.Equal(testV1[1], value)
+		assert.Nil(kvStore.Put(bucket1, testK1[2], testV1[2]))
+		value, err = kvStore.Get(bucket1, testK1[2])
+		assert.Nil(err)
+		assert.Equal(testV1[2], value)
+
+		testV := [3][]byte{[]byte("value1.1"), []byte("value2.1"), []byte("value3.1")}
+		if kvboltDB, ok := kvStore.(*boltDB); ok {
+			err = kvboltDB.batchPutForceFail(bucket1, testK1[:], testV[:])
+			assert.NotNil(err)
+		} else if kvbadgerDB, ok := kvStore.(*boltDB); ok {
+			err = kvbadgerDB.batchPutForceFail(bucket1, testK1[:], testV[:])
+			assert.NotNil(err)
+		}
+
+		value, err = kvStore.Get(bucket1, testK1[0])
+		assert.Nil(err)
+		assert.Equal(testV1[0], value)
+		value, err = kvStore.Get(bucket1, testK1[1])
+		assert.Nil(err)
+		assert.Equal(testV1[1], value)
+		value, err = kvStore.Get(bucket1, testK1[2])
+		assert.Nil(err)
+		assert.Equal(testV1[2], value)
+	}
+
+	path := "test-batch-rollback.bolt"
+	cfg.DbPath = path
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testBatchRollback(NewOnDiskDB(cfg), t)
+	})
+
+	path = "test-batch-rollback.badger"
+	cfg.DbPath = path
+	cfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testBatchRollback(NewOnDiskDB(cfg), t)
+	})
+}
+
+func TestDBInMemBatchCommit(t *testing.T) {
+	require := require.New(t)
+	kvStore := NewMemKVStore()
+	ctx := context.Background()
+	batch := NewBatch()
+
+	require.Nil(kvStore.Start(ctx))
+	defer func() {
+		err := kvStore.Stop(ctx)
+		require.Nil(err)
+	}()
+
+	require.Nil(kvStore.Put(bucket1, testK1[0], testV1[1]))
+	require.Nil(kvStore.Put(bucket2, testK2[1], testV2[0]))
+	require.Nil(kvStore.Put(bucket1, testK1[2], testV1[0]))
+	batch.Put(bucket1, testK1[0], testV1[0], "")
+	require.Nil(batch.PutIfNotExists(bucket2, []byte("test"), []byte("test"), ""))
+	value, err := kvStore.Get(bucket1, testK1[0])
+	require.Nil(err)
+	require.Equal(testV1[1], value)
+	value, err = kvStore.Get(bucket2, testK2[1])
+	require.Nil(err)
+	require.Equal(testV2[0], value)
+	require.Nil(kvStore.Commit(batch))
+	value, err = kvStore.Get(bucket1, testK1[0])
+	require.Nil(err)
+	require.Equal(testV1[0], value)
+}
+
+func TestDBBatch(t *testing.T) {
+	testBatchRollback := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+		batch := NewBatch()
+
+		require.Nil(kvStore.Start(ctx))
+		defer func() {
+			err := kvStore.Stop(ctx)
+			require.Nil(err)
+		}()
+
+		require.Nil(kvStore.Put(bucket1, testK1[0], testV1[1]))
+		require.Nil(kvStore.Put(bucket2, testK2[1], testV2[0]))
+		require.Nil(kvStore.Put(bucket1, testK1[2], testV1[0]))
+
+		batch.Put(bucket1, testK1[0], testV1[0], "")
+		batch.Put(bucket2, testK2[1], testV2[1], "")
+		value, err := kvStore.Get(bucket1, testK1[0])
+		require.Nil(err)
+		require.Equal(testV1[1], value)
+
+		value, err = kvStore.Get(bucket2, testK2[1])
+		require.Nil(err)
+		require.Equal(testV2[0], value)
+		require.Nil(kvStore.Commit(batch))
+
+		value, err = kvStore.Get(bucket1, testK1[0])
+		require.Nil(err)
+		require.Equal(testV1[0], value)
+
+		value, err = kvStore.Get(bucket2, testK2[1])
+		require.Nil(err)
+		require.Equal(testV2[1], value)
+
+		value, err = kvStore.Get(bucket1, testK1[2])
+		require.Nil(err)
+		require.Equal(testV1[0], value)
+
+		batch.Put(bucket1, testK1[0], testV1[1], "")
+		require.Nil(batch.PutIfNotExists(bucket2, testK2[1], testV2[0], ""))
+		err = kvStore.Commit(batch)
+		require.Equal(err, ErrAlreadyExist)
+		// need to clear the batch in case of commit error
+		batch.Clear()
+		require.Equal(0, batch.Size())
+
+		value, err = kvStore.Get(bucket2, testK2[1])
+		require.Nil(err)
+		require.Equal(testV2[1], value)
+
+		value, err = kvStore.Get(bucket1, testK1[0])
+		require.Nil(err)
+		require.Equal(testV1[0], value)
+
+		require.Nil(batch.PutIfNotExists(bucket3, testK2[0], testV2[0], ""))
+		require.Nil(kvStore.Commit(batch))
+
+		value, err = kvStore.Get(bucket3, testK2[0])
+		require.Nil(err)
+		require.Equal(testV2[0], value)
+
+		batch.Put(bucket1, testK1[2], testV1[2], "")
+		// we did not set key in bucket3 yet, so this operation will fail and
+		// cause transaction rollback
+		require.Nil(batch.PutIfNotExists(bucket3, testK2[0], testV2[1], ""))
+		require.NotNil(kvStore.Commit(batch))
+
+		value, err = kvStore.Get(bucket1, testK1[2])
+		require.Nil(err)
+		require.Equal(testV1[0], value)
+
+		value, err = kvStore.Get(bucket2, testK2[1])
+		require.Nil(err)
+		require.Equal(testV2[1], value)
+
+		batch.Clear()
+		batch.Put(bucket1, testK1[2], testV1[2], "")
+		batch.Delete(bucket2, testK2[1], "")
+		require.Nil(kvStore.Commit(batch))
+
+		value, err = kvStore.Get(bucket1, testK1[2])
+		require.Nil(err)
+		require.Equal(testV1[2], value)
+
+		_, err = kvStore.Get(bucket2, testK2[1])
+		require.NotNil(err)
+	}
+
+	path := "test-batch-commit.bolt"
+	cfg.DbPath = path
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testBatchRollback(NewOnDiskDB(cfg), t)
+	})
+
+	path = "test-batch-commit.badger"
+	cfg.DbPath = path
+	cfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testBatchRollback(NewOnDiskDB(cfg), t)
+	})
+}
+
+func TestCacheKV(t *testing.T) {
+	testFunc := func(kv KVStore, t *testing.T) {
+		require := require.New(t)
+
+		require.Nil(kv.Start(context.Background()))
+		defer func() {
+			err := kv.Stop(context.Background())
+			require.Nil(err)
+		}()
+
+		cb := NewCachedBatch()
+		cb.Put(bucket1, testK1[0], testV1[0], "")
+		v, _ := cb.Get(bucket1, testK1[0])
+		require.Equal(testV1[0], v)
+		cb.Clear()
+		require.Equal(0, cb.Size())
+		_, err := cb.Get(bucket1, testK1[0])
+		require.Error(err)
+		cb.Put(bucket2, testK2[2], testV2[2], "")
+		v, _ = cb.Get(bucket2, testK2[2])
+		require.Equal(testV2[2], v)
+		// <k1[0], v1[0]> is gone
+		require.Nil(cb.PutIfNotExists(bucket1, testK1[0], testV1[0], ""))
+		require.Nil(cb.PutIfNotExists(bucket1, testK1[2], testV1[2], ""))
+		require.Nil(cb.PutIfNotExists(bucket1, testK1[1], testV1[1], ""))
+		v, _ = cb.Get(bucket1, testK1[0])
+		require.Equal(testV1[0], v)
+		v, _ = cb.Get(bucket1, testK1[1])
+		require.Equal(testV1[1], v)
+		v, _ = cb.Get(bucket1, testK1[2])
+		require.Equal(testV1[2], v)
+		// put testK1[1] with a new value
+		cb.Put(bucket1, testK1[1], testV1[2], "")
+		v, _ = cb.Get(bucket1, testK1[1])
+		require.Equal(testV1[2], v)
+		// cannot put same entry again
+		require.Equal(ErrAlreadyExist, errors.Cause(cb.PutIfNotExists(bucket1, testK1[1], testV1[0], "")))
+		// same key but diff bucket name is OK
+		require.Nil(cb.PutIfNotExists(bucket2, testK1[0], testV1[0], ""))
+		// delete a non-existing entry is OK
+		cb.Delete(bucket2, []byte("notexist"), "")
+		require.Nil(kv.Commit(cb))
+
+		cb = nil
+		cb = NewCachedBatch()
+		v, _ = kv.Get(bucket1, testK1[0])
+		require.Equal(testV1[0], v)
+		v, _ = kv.Get(bucket1, testK1[1])
+		require.Equal(testV1[2], v)
+		v, _ = kv.Get(bucket1, testK1[2])
+		require.Equal(testV1[2], v)
+		v, _ = kv.Get(bucket2, testK1[0])
+		require.Equal(testV1[0], v)
+		require.Nil(cb.PutIfNotExists(bucket2, testK2[0], testV2[0], ""))
+		require.NoError(kv.Commit(cb))
+		// entry exists in DB but not in cache, so OK at this point
+		require.Nil(cb.PutIfNotExists(bucket2, testK1[0], testV1[2], ""))
+		// but would fail upon commit
+		require.Equal(ErrAlreadyExist, errors.Cause(kv.Commit(cb)))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		kv := NewMemKVStore()
+		testFunc(kv, t)
+	})
+
+	path := "test-cache-kv.bolt"
+	cfg.DbPath = path
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testFunc(NewOnDiskDB(cfg), t)
+	})
+
+	path = "test-cache-kv.badger"
+	cfg.DbPath = path
+	cfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testFunc(NewOnDiskDB(cfg), t)
+	})
+}
+
+func TestStreamAll(t *testing.T) {
+	testStreamAll := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+
+		expected := make(map[string][]byte)
+		batch := NewBatch()
+		for i := 0; i < 100; i++ {
+			k := []byte(fmt.Sprintf("key_%d", i))
+			v := []byte(fmt.Sprintf("value_%d", i))
+			expected[string(k)] = v
+			batch.Put(bucket1, k, v, "")
+		}
+		batch.Put(bucket2, testK2[0], testV2[0], "")
+		require.NoError(kvStore.Commit(batch))
+
+		streamer, ok := kvStore.(Streamer)
+		require.True(ok)
+		var mutex sync.Mutex
+		visited := make(map[string][]byte)
+		require.NoError(streamer.StreamAll(bucket1, func(k, v []byte) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			visited[string(k)] = append([]byte(nil), v...)
+			return nil
+		}))
+		require.Equal(expected, visited)
+
+		// error returned by fn aborts the stream
+		errStop := errors.New("stop")
+		require.Equal(errStop, errors.Cause(streamer.StreamAll(bucket1, func(k, v []byte) error {
+			return errStop
+		})))
+
+		// non-existing namespace has nothing to visit
+		require.NoError(streamer.StreamAll(bucket3, func(k, v []byte) error {
+			return errStop
+		}))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testStreamAll(NewMemKVStore(), t)
+	})
+
+	path := "test-stream-all.bolt"
+	cfg.DbPath = path
+	cfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testStreamAll(NewOnDiskDB(cfg), t)
+	})
+
+	path = "test-stream-all.badger"
+	cfg.DbPath = path
+	cfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testStreamAll(NewOnDiskDB(cfg), t)
+	})
+}
+
+func BenchmarkBadgerStreamAll(b *testing.B) {
+	require := require.New(b)
+	ctx := context.Background()
+	path := "bench-stream-all.badger"
+	cfg.DbPath = path
+	cfg.UseBadgerDB = true
+	require.NoError(os.RemoveAll(path))
+	defer func() {
+		require.NoError(os.RemoveAll(path))
+	}()
+
+	kvStore := NewOnDiskDB(cfg)
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	value := make([]byte, 256)
+	for i := 0; i < 20; i++ {
+		batch := NewBatch()
+		for j := 0; j < 10000; j++ {
+			batch.Put(bucket1, []byte(fmt.Sprintf("key_%d_%d", i, j)), value, "")
+		}
+		require.NoError(kvStore.Commit(batch))
+	}
+	badgerStore := kvStore.(*badgerDB)
+
+	b.Run("Serial", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			var count int
+			require.NoError(badgerForEach(badgerStore.db, bucket1, func(k, v []byte) error {
+				hash.Hash256b(v)
+				count++
+				return nil
+			}))
+		}
+	})
+	b.Run("Stream", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			var count int64
+			require.NoError(badgerStore.StreamAll(bucket1, func(k, v []byte) error {
+				hash.Hash256b(v)
+				atomic.AddInt64(&count, 1)
+				return nil
+			}))
+		}
+	})
+}
+
+func TestBadgerTruncate(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	path := "test-truncate.badger"
+	cfg.DbPath = path
+	cfg.UseBadgerDB = true
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+
+	kvStore := NewOnDiskDB(cfg)
+	require.NoError(kvStore.Start(ctx))
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+	require.NoError(kvStore.Put(bucket1, testK1[1], testV1[1]))
+	require.NoError(kvStore.Stop(ctx))
+
+	// corrupt the tail of the latest value log
+	files, err := filepath.Glob(filepath.Join(path, "*.vlog"))
+	require.NoError(err)
+	require.NotEmpty(files)
+	sort.Strings(files)
+	f, err := os.OpenFile(files[len(files)-1], os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(err)
+	_, err = f.Write(bytes.Repeat([]byte{0xff}, 64))
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	// fail to open by default
+	kvStore = NewOnDiskDB(cfg)
+	require.Error(kvStore.Start(ctx))
+
+	// open with truncation
+	kvStore = NewOnDiskDB(cfg, WithTruncate(true))
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	value, err := kvStore.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], value)
+	value, err = kvStore.Get(bucket1, testK1[1])
+	require.NoError(err)
+	require.Equal(testV1[1], value)
+}
+
+func TestCommitCounting(t *testing.T) {
+	testCommitCounting := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
 		ctx := context.Background()
 
-		assert.Nil(kvStore.Start(ctx))
+		require.NoError(kvStore.Start(ctx))
 		defer func() {
-			err := kvStore.Stop(ctx)
-			assert.Nil(err)
+			require.NoError(kvStore.Stop(ctx))
 		}()
 
-		assert.Nil(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+
+		batch := NewBatch()
+		// key already exists in DB
+		require.NoError(batch.PutIfNotExists(bucket1, testK1[0], testV1[1], ""))
+		require.NoError(batch.PutIfNotExists(bucket1, testK1[1], testV1[1], ""))
+		// key already exists in the same batch
+		require.NoError(batch.PutIfNotExists(bucket1, testK1[1], testV1[2], ""))
+		batch.Put(bucket2, testK2[0], testV2[0], "")
+		batch.Delete(bucket1, testK1[2], "")
+
+		committer, ok := kvStore.(CountingCommitter)
+		require.True(ok)
+		applied, skipped, err := committer.CommitCounting(batch)
+		require.NoError(err)
+		require.Equal(uint64(3), applied)
+		require.Equal(uint64(2), skipped)
+		require.Equal(0, batch.Size())
+
 		value, err := kvStore.Get(bucket1, testK1[0])
-		assert.Nil(err)
-		assert.Equal(testV1[0], value)
-		assert.Nil(kvStore.Put(bucket1, testK1[1], testV1[1]))
+		require.NoError(err)
+		require.Equal(testV1[0], value)
 		value, err = kvStore.Get(bucket1, testK1[1])
-		assert.Nil(err)
-		assert.Equal(testV1[1], value)
-		assert.Nil(kvStore.Put(bucket1, testK1[2], testV1[2]))
-		value, err = kvStore.Get(bucket1, testK1[2])
-		assert.Nil(err)
-		assert.Equal(testV1[2], value)
+		require.NoError(err)
+		require.Equal(testV1[1], value)
+		value, err = kvStore.Get(bucket2, testK2[0])
+		require.NoError(err)
+		require.Equal(testV2[0], value)
+	}
 
-		testV := [3][]byte{[]byte("value1.1"), []byte("value2.1"), []byte("value3.1")}
-		if kvboltDB, ok := kvStore.(*boltDB); ok {
-			err = kvboltDB.batchPutForceFail(bucket1, testK1[:], testV[:])
-			assert.NotNil(err)
-		} else if kvbadgerDB, ok := kvStore.(*boltDB); ok {
-			err = kvbadgerDB.batchPutForceFail(bucket1, testK1[:], testV[:])
-			assert.NotNil(err)
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testCommitCounting(NewMemKVStore(), t)
+	})
+
+	path := "test-commit-counting.bolt"
+	cfg.DbPath = path
+	cfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testCommitCounting(NewOnDiskDB(cfg), t)
+	})
+
+	path = "test-commit-counting.badger"
+	cfg.DbPath = path
+	cfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testCommitCounting(NewOnDiskDB(cfg), t)
+	})
+}
+
+func TestAddCounter(t *testing.T) {
+	testAddCounter := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		counterOf := func(namespace string, key []byte) int64 {
+			value, err := kvStore.Get(namespace, key)
+			require.NoError(err)
+			require.Len(value, 8)
+			return int64(binary.BigEndian.Uint64(value))
 		}
 
-		value, err = kvStore.Get(bucket1, testK1[0])
-		assert.Nil(err)
-		assert.Equal(testV1[0], value)
-		value, err = kvStore.Get(bucket1, testK1[1])
-		assert.Nil(err)
-		assert.Equal(testV1[1], value)
-		value, err = kvStore.Get(bucket1, testK1[2])
-		assert.Nil(err)
-		assert.Equal(testV1[2], value)
+		require.NoError(kvStore.Put(bucket1, testK1[0], counterDelta(10)))
+		batch := NewBatch()
+		require.NoError(batch.AddCounter(bucket1, testK1[0], 5))
+		require.NoError(batch.AddCounter(bucket1, testK1[1], 3))
+		require.NoError(batch.AddCounter(bucket1, testK1[0], -2))
+		require.NoError(batch.AddCounter(bucket2, testK2[0], -7))
+		require.NoError(batch.AddCounter(bucket1, testK1[1], 4))
+		// a counter put by the batch is added to by the entries after
+		require.NoError(batch.Put(bucket1, testK1[2], counterDelta(100), ""))
+		require.NoError(batch.AddCounter(bucket1, testK1[2], 1))
+		require.NoError(kvStore.Commit(batch))
+		require.Equal(int64(13), counterOf(bucket1, testK1[0]))
+		require.Equal(int64(7), counterOf(bucket1, testK1[1]))
+		require.Equal(int64(-7), counterOf(bucket2, testK2[0]))
+		require.Equal(int64(101), counterOf(bucket1, testK1[2]))
+
+		// a counter deleted by the batch starts over from 0
+		require.NoError(batch.Delete(bucket1, testK1[0], ""))
+		require.NoError(batch.AddCounter(bucket1, testK1[0], 1))
+		require.NoError(batch.AddCounter(bucket1, testK1[1], 1))
+		applied, skipped, err := kvStore.(CountingCommitter).CommitCounting(batch)
+		require.NoError(err)
+		require.Equal(uint64(3), applied)
+		require.Equal(uint64(0), skipped)
+		require.Equal(int64(1), counterOf(bucket1, testK1[0]))
+		require.Equal(int64(8), counterOf(bucket1, testK1[1]))
+
+		// adding to a record which is not a counter fails the whole batch
+		require.NoError(kvStore.Put(bucket2, testK2[1], testV2[1]))
+		require.NoError(batch.AddCounter(bucket1, testK1[0], 1))
+		require.NoError(batch.AddCounter(bucket2, testK2[1], 1))
+		require.Equal(ErrInvalidDB, errors.Cause(kvStore.Commit(batch)))
+		require.Equal(2, batch.Size())
+		_, _, err = kvStore.(CountingCommitter).CommitCounting(batch)
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+		require.Equal(int64(1), counterOf(bucket1, testK1[0]))
+		value, err := kvStore.Get(bucket2, testK2[1])
+		require.NoError(err)
+		require.Equal(testV2[1], value)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testAddCounter(NewMemKVStore(), t)
+	})
+
+	dbCfg := cfg
+	path := "test-add-counter.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testAddCounter(NewOnDiskDB(dbCfg), t)
+	})
+
+	path = "test-add-counter.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testAddCounter(NewOnDiskDB(dbCfg), t)
+	})
+}
+
+func TestClear(t *testing.T) {
+	testClear := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+
+		for i := 0; i < 3; i++ {
+			require.NoError(kvStore.Put(bucket1, testK1[i], testV1[i]))
+			require.NoError(kvStore.Put(bucket2, testK2[i], testV2[i]))
+		}
+
+		clearable, ok := kvStore.(Clearable)
+		require.True(ok)
+		require.NoError(clearable.Clear())
+		for i := 0; i < 3; i++ {
+			_, err := kvStore.Get(bucket1, testK1[i])
+			require.Error(err)
+			_, err = kvStore.Get(bucket2, testK2[i])
+			require.Error(err)
+		}
+		streamer := kvStore.(Streamer)
+		for _, ns := range []string{bucket1, bucket2} {
+			require.NoError(streamer.StreamAll(ns, func(k, v []byte) error {
+				return errors.Errorf("namespace %s is not cleared", ns)
+			}))
+		}
+
+		// the store is still usable
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[1]))
+		value, err := kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[1], value)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testClear(NewMemKVStore(), t)
+	})
+
+	path := "test-clear.bolt"
+	cfg.DbPath = path
+	cfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testClear(NewOnDiskDB(cfg), t)
+	})
+
+	path = "test-clear.badger"
+	cfg.DbPath = path
+	cfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testClear(NewOnDiskDB(cfg), t)
+	})
+}
+
+func TestIsEmpty(t *testing.T) {
+	testIsEmpty := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		checker, ok := kvStore.(EmptyChecker)
+		require.True(ok)
+
+		// a fresh store is empty, even with namespaces created
+		empty, err := checker.IsEmpty()
+		require.NoError(err)
+		require.True(empty)
+		require.NoError(kvStore.(NamespaceManager).CreateNamespace(bucket2))
+		empty, err = checker.IsEmpty()
+		require.NoError(err)
+		require.True(empty)
+
+		// a single record makes it non-empty
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		empty, err = checker.IsEmpty()
+		require.NoError(err)
+		require.False(empty)
+		require.NoError(kvStore.Put(bucket2, testK2[0], testV2[0]))
+
+		// it is empty again once all records are deleted
+		require.NoError(kvStore.Delete(bucket1, testK1[0]))
+		empty, err = checker.IsEmpty()
+		require.NoError(err)
+		require.False(empty)
+		require.NoError(kvStore.Delete(bucket2, testK2[0]))
+		empty, err = checker.IsEmpty()
+		require.NoError(err)
+		require.True(empty)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testIsEmpty(NewMemKVStore(), t)
+	})
+
+	dbCfg := cfg
+	path := "test-is-empty.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testIsEmpty(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Bolt DB with front coding", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testIsEmpty(NewOnDiskDB(dbCfg, WithFrontCoding(bucket1)), t)
+	})
+
+	path = "test-is-empty.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testIsEmpty(NewOnDiskDB(dbCfg), t)
+	})
+}
+
+func TestBadgerGroupCommitClock(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	path := "test-group-commit-clock.badger"
+	dbCfg := cfg
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+
+	clk := clock.NewMock()
+	kvStore := NewOnDiskDB(dbCfg, WithGroupCommit(time.Minute), WithClock(clk))
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	badgerStore := kvStore.(*badgerDB)
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+	require.Equal(int32(1), atomic.LoadInt32(&badgerStore.dirty))
+
+	// the commit is fsynced once the clock reaches the interval
+	require.NoError(testutil.WaitUntil(5*time.Millisecond, time.Second, func() (bool, error) {
+		// the ticks of the mock clock are dropped unless the group commit is waiting for them, so tick until it is
+		clk.Add(time.Minute)
+		return atomic.LoadInt32(&badgerStore.dirty) == 0, nil
+	}))
+	require.Equal(uint64(1), atomic.LoadUint64(&badgerStore.syncs))
+}
+
+func TestBadgerGroupCommit(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	path := "test-group-commit.badger"
+	cfg.DbPath = path
+	cfg.UseBadgerDB = true
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+
+	kvStore := NewOnDiskDB(cfg, WithGroupCommit(10*time.Millisecond))
+	require.NoError(kvStore.Start(ctx))
+	badgerStore := kvStore.(*badgerDB)
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+	batch := NewBatch()
+	batch.Put(bucket1, testK1[1], testV1[1], "")
+	require.NoError(kvStore.Commit(batch))
+	// the commits are fsynced as a group within the interval
+	require.NoError(testutil.WaitUntil(5*time.Millisecond, time.Second, func() (bool, error) {
+		return atomic.LoadInt32(&badgerStore.dirty) == 0 && atomic.LoadUint64(&badgerStore.syncs) > 0, nil
+	}))
+	// nothing to fsync without new commits
+	syncs := atomic.LoadUint64(&badgerStore.syncs)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(syncs, atomic.LoadUint64(&badgerStore.syncs))
+
+	// Sync fsyncs immediately, unless the commit is fsynced by the group already
+	require.NoError(kvStore.Put(bucket1, testK1[2], testV1[2]))
+	require.NoError(kvStore.(Syncer).Sync())
+	require.Equal(syncs+1, atomic.LoadUint64(&badgerStore.syncs))
+	require.Equal(int32(0), atomic.LoadInt32(&badgerStore.dirty))
+
+	// Stop fsyncs pending commits
+	require.NoError(kvStore.Put(bucket2, testK2[0], testV2[0]))
+	require.NoError(kvStore.Stop(ctx))
+	require.Equal(syncs+2, atomic.LoadUint64(&badgerStore.syncs))
+
+	kvStore = NewOnDiskDB(cfg, WithGroupCommit(10*time.Millisecond))
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	for i := 0; i < 3; i++ {
+		value, err := kvStore.Get(bucket1, testK1[i])
+		require.NoError(err)
+		require.Equal(testV1[i], value)
+	}
+	value, err := kvStore.Get(bucket2, testK2[0])
+	require.NoError(err)
+	require.Equal(testV2[0], value)
+}
+
+func BenchmarkBadgerGroupCommit(b *testing.B) {
+	benchmark := func(b *testing.B, opts ...KVStoreOption) {
+		require := require.New(b)
+		ctx := context.Background()
+		path := "bench-group-commit.badger"
+		cfg.DbPath = path
+		cfg.UseBadgerDB = true
+		require.NoError(os.RemoveAll(path))
+		defer func() {
+			require.NoError(os.RemoveAll(path))
+		}()
+
+		kvStore := NewOnDiskDB(cfg, opts...)
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		value := make([]byte, 256)
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			require.NoError(kvStore.Put(bucket1, []byte(fmt.Sprintf("key_%d", n)), value))
+		}
+	}
+
+	b.Run("SyncWrites", func(b *testing.B) {
+		benchmark(b)
+	})
+	b.Run("GroupCommit", func(b *testing.B) {
+		benchmark(b, WithGroupCommit(10*time.Millisecond))
+	})
+}
+
+func TestMemKVStoreShards(t *testing.T) {
+	require := require.New(t)
+
+	for _, shards := range []int{-1, 1, 7} {
+		kvStore := NewMemKVStore(WithMemShards(shards))
+		batch := NewBatch()
+		for i := 0; i < 100; i++ {
+			batch.Put(bucket1, []byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i)), "")
+		}
+		require.NoError(kvStore.Commit(batch))
+		for i := 0; i < 100; i++ {
+			value, err := kvStore.Get(bucket1, []byte(fmt.Sprintf("key_%d", i)))
+			require.NoError(err)
+			require.Equal([]byte(fmt.Sprintf("value_%d", i)), value)
+		}
+
+		// a failed commit spanning multiple shards leaves none of them written
+		batch.Put(bucket2, []byte("new_key"), testV1[0], "")
+		batch.Put(bucket1, []byte("key_0"), testV2[0], "")
+		batch.PutIfNotExists(bucket1, []byte("key_99"), testV1[1], "")
+		require.Error(kvStore.Commit(batch))
+		_, err := kvStore.Get(bucket2, []byte("new_key"))
+		require.Error(err)
+		value, err := kvStore.Get(bucket1, []byte("key_0"))
+		require.NoError(err)
+		require.Equal([]byte("value_0"), value)
+	}
+}
+
+func BenchmarkMemKVStoreParallel(b *testing.B) {
+	benchmark := func(b *testing.B, opts ...KVStoreOption) {
+		kvStore := NewMemKVStore(opts...)
+		keys := make([][]byte, 1024)
+		for i := range keys {
+			keys[i] = []byte(fmt.Sprintf("key_%d", i))
+			if err := kvStore.Put(bucket1, keys[i], testV1[0]); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				key := keys[i%len(keys)]
+				// 1 write per 4 reads
+				if i%5 == 0 {
+					if err := kvStore.Put(bucket1, key, testV2[0]); err != nil {
+						b.Fatal(err)
+					}
+					continue
+				}
+				if _, err := kvStore.Get(bucket1, key); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+
+	b.Run("SingleShard", func(b *testing.B) {
+		benchmark(b, WithMemShards(1))
+	})
+	b.Run("DefaultShards", func(b *testing.B) {
+		benchmark(b)
+	})
+}
+
+func TestKVStoreSnapshot(t *testing.T) {
+	testSnapshot := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		snapshot, err := kvStore.(Snapshotter).Snapshot()
+		require.NoError(err)
+
+		// writes through the snapshot are rejected
+		require.Equal(ErrReadOnlyTxn, errors.Cause(snapshot.Put(bucket1, testK1[1], testV1[1])))
+		require.Equal(ErrReadOnlyTxn, errors.Cause(snapshot.Delete(bucket1, testK1[0])))
+
+		// writes to the store after the snapshot is taken are not visible, even a write that grows the DB file
+		require.NoError(kvStore.Put(bucket2, testK2[0], make([]byte, 1<<20)))
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[2]))
+		require.NoError(kvStore.Put(bucket1, testK1[1], testV1[1]))
+		value, err := snapshot.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+		_, err = snapshot.Get(bucket1, testK1[1])
+		require.Error(err)
+		snapshot.Release()
+		_, err = snapshot.Get(bucket1, testK1[0])
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+
+		value, err = kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[2], value)
 	}
 
-	path := "test-batch-rollback.bolt"
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testSnapshot(NewMemKVStore(), t)
+	})
+
+	path := "test-snapshot.bolt"
 	cfg.DbPath = path
+	cfg.UseBadgerDB = false
 	t.Run("Bolt DB", func(t *testing.T) {
 		testutil.CleanupPath(t, path)
 		defer testutil.CleanupPath(t, path)
-		testBatchRollback(NewOnDiskDB(cfg), t)
+		testSnapshot(NewOnDiskDB(cfg), t)
 	})
 
-	path = "test-batch-rollback.badger"
+	path = "test-snapshot.badger"
 	cfg.DbPath = path
 	cfg.UseBadgerDB = true
 	t.Run("Badger DB", func(t *testing.T) {
 		testutil.CleanupPath(t, path)
 		defer testutil.CleanupPath(t, path)
-		testBatchRollback(NewOnDiskDB(cfg), t)
+		testSnapshot(NewOnDiskDB(cfg), t)
 	})
 }
 
-func TestDBInMemBatchCommit(t *testing.T) {
+// badgerForEach calls fn on each record of the namespace, serially in key order
+func badgerForEach(db *badger.DB, namespace string, fn func([]byte, []byte) error) error {
+	prefix := []byte(namespace)
+	return db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get value from key = %x", item.Key())
+			}
+			if err := fn(item.KeyCopy(nil)[len(prefix):], value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func TestKVError(t *testing.T) {
+	testKVError := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+
+		// the errors name the operation and the record, and keep their cause
+		_, err := kvStore.Get(bucket1, testK1[1])
+		require.Equal(ErrNotExist, errors.Cause(err))
+		kvErr, ok := KVErrorOf(err)
+		require.True(ok)
+		require.Equal(&KVError{Op: "Get", Namespace: bucket1, Key: testK1[1], Err: ErrNotExist}, kvErr)
+		require.Contains(err.Error(), fmt.Sprintf("%x", testK1[1]))
+
+		err = kvStore.PutIfNotExists(bucket1, testK1[0], testV1[1])
+		require.Equal(ErrAlreadyExist, errors.Cause(err))
+		kvErr, ok = KVErrorOf(errors.Wrap(err, "wrapped"))
+		require.True(ok)
+		require.Equal("PutIfNotExists", kvErr.Op)
+		require.Equal(bucket1, kvErr.Namespace)
+		require.Equal(testK1[0], kvErr.Key)
+
+		// other errors are not KVError
+		_, ok = KVErrorOf(ErrDBClosed)
+		require.False(ok)
+		_, ok = KVErrorOf(nil)
+		require.False(ok)
+
+		require.NoError(kvStore.Stop(ctx))
+		if _, ok := kvStore.(*memKVStore); ok {
+			// the in-memory KV store is usable after Stop
+			return
+		}
+		for op, err := range map[string]error{
+			"Put":    kvStore.Put(bucket2, testK2[0], testV2[0]),
+			"Delete": kvStore.Delete(bucket2, testK2[0]),
+		} {
+			require.Equal(ErrDBClosed, errors.Cause(err))
+			kvErr, ok = KVErrorOf(err)
+			require.True(ok)
+			require.Equal(&KVError{Op: op, Namespace: bucket2, Key: testK2[0], Err: ErrDBClosed}, kvErr)
+		}
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testKVError(NewMemKVStore(), t)
+	})
+
+	dbCfg := cfg
+	path := "test-kv-error.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testKVError(NewOnDiskDB(dbCfg), t)
+	})
+
+	path = "test-kv-error.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testKVError(NewOnDiskDB(dbCfg), t)
+	})
+}
+
+func TestOpenWithRetries(t *testing.T) {
+	require := require.New(t)
+
+	dbCfg := cfg
+	dbCfg.OpenRetries = 3
+	dbCfg.OpenRetryBackoff = time.Millisecond
+	// open fails the first failures attempts with err
+	opener := func(failures int, err error) (func() error, *int) {
+		attempts := 0
+		return func() error {
+			attempts++
+			if attempts <= failures {
+				return err
+			}
+			return nil
+		}, &attempts
+	}
+	stale := &os.PathError{Op: "open", Path: "test.db", Err: syscall.ESTALE}
+
+	// succeeds within the retry budget
+	open, attempts := opener(3, stale)
+	require.NoError(openWithRetries(dbCfg, "test.db", clock.New(), open))
+	require.Equal(4, *attempts)
+	open, attempts = opener(2, errors.Wrap(bolt.ErrTimeout, "failed to lock"))
+	require.NoError(openWithRetries(dbCfg, "test.db", clock.New(), open))
+	require.Equal(3, *attempts)
+
+	// gives up beyond it with the last error
+	open, attempts = opener(4, stale)
+	require.Equal(stale, openWithRetries(dbCfg, "test.db", clock.New(), open))
+	require.Equal(4, *attempts)
+	dbCfg.OpenRetries = 0
+	open, attempts = opener(1, stale)
+	require.Equal(stale, openWithRetries(dbCfg, "test.db", clock.New(), open))
+	require.Equal(1, *attempts)
+
+	// a corrupted DB is not retried
+	dbCfg.OpenRetries = 3
+	open, attempts = opener(1, bolt.ErrInvalid)
+	require.Equal(bolt.ErrInvalid, openWithRetries(dbCfg, "test.db", clock.New(), open))
+	require.Equal(1, *attempts)
+	open, attempts = opener(1, &os.PathError{Op: "open", Path: "test.db", Err: syscall.EACCES})
+	require.Error(openWithRetries(dbCfg, "test.db", clock.New(), open))
+	require.Equal(1, *attempts)
+}
+
+func TestStartRetriesOpen(t *testing.T) {
 	require := require.New(t)
-	kvStore := NewMemKVStore()
 	ctx := context.Background()
-	batch := NewBatch()
 
-	require.Nil(kvStore.Start(ctx))
+	path := "test-open-retries.badger"
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+	dbCfg := cfg
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	holder := NewOnDiskDB(dbCfg)
+	require.NoError(holder.Start(ctx))
+
+	// the directory is locked by the other instance, which fails without retries
+	kvStore := NewOnDiskDB(dbCfg)
+	require.Error(kvStore.Start(ctx))
+
+	// the lock is released while retrying
+	dbCfg.OpenRetries = 10
+	dbCfg.OpenRetryBackoff = 10 * time.Millisecond
+	kvStore = NewOnDiskDB(dbCfg)
+	stopped := make(chan error, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		stopped <- holder.Stop(ctx)
+	}()
+	require.NoError(kvStore.Start(ctx))
+	require.NoError(<-stopped)
+	require.NoError(kvStore.Stop(ctx))
+}
+
+func TestBadgerCommitSplit(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	path := "test-commit-split.badger"
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+	dbCfg := cfg
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	kvStore := NewOnDiskDB(dbCfg)
+	require.NoError(kvStore.Start(ctx))
 	defer func() {
-		err := kvStore.Stop(ctx)
-		require.Nil(err)
+		require.NoError(kvStore.Stop(ctx))
 	}()
+	committer, ok := kvStore.(SplitCommitter)
+	require.True(ok)
 
-	require.Nil(kvStore.Put(bucket1, testK1[0], testV1[1]))
-	require.Nil(kvStore.Put(bucket2, testK2[1], testV2[0]))
-	require.Nil(kvStore.Put(bucket1, testK1[2], testV1[0]))
-	batch.Put(bucket1, testK1[0], testV1[0], "")
-	require.Nil(batch.PutIfNotExists(bucket2, []byte("test"), []byte("test"), ""))
-	value, err := kvStore.Get(bucket1, testK1[0])
-	require.Nil(err)
-	require.Equal(testV1[1], value)
-	value, err = kvStore.Get(bucket2, testK2[1])
-	require.Nil(err)
+	// long keys make a batch of moderate count exceed the size limit of a transaction
+	maxBatchSize := int(kvStore.(*badgerDB).db.MaxBatchSize())
+	padding := bytes.Repeat([]byte{'k'}, 1000)
+	n := maxBatchSize/len(padding)*2 + 100
+	keyOf := func(i int) []byte {
+		return append([]byte(fmt.Sprintf("%06d", i)), padding...)
+	}
+	require.NoError(kvStore.Put(bucket1, keyOf(n-1), testV1[0]))
+	batch := NewBatch()
+	for i := 0; i < n; i++ {
+		batch.Put(bucket1, keyOf(i), []byte(fmt.Sprintf("value_%d", i)), "")
+	}
+	batch.Delete(bucket1, keyOf(n-1), "")
+	batch.Put(bucket2, testK2[0], testV2[0], "")
+
+	// Commit is atomic, so the batch fails as a whole
+	require.Equal(badger.ErrTxnTooBig, errors.Cause(kvStore.Commit(batch)))
+	_, err := kvStore.Get(bucket1, keyOf(0))
+	require.Equal(ErrNotExist, errors.Cause(err))
+
+	txns, err := committer.CommitSplit(batch)
+	require.NoError(err)
+	require.Equal(3, txns)
+	require.Equal(0, batch.Size())
+	for i := 0; i < n-1; i++ {
+		value, err := kvStore.Get(bucket1, keyOf(i))
+		require.NoError(err)
+		require.Equal([]byte(fmt.Sprintf("value_%d", i)), value)
+	}
+	// the entries are applied in order across the transactions
+	_, err = kvStore.Get(bucket1, keyOf(n-1))
+	require.Equal(ErrNotExist, errors.Cause(err))
+	value, err := kvStore.Get(bucket2, testK2[0])
+	require.NoError(err)
 	require.Equal(testV2[0], value)
-	require.Nil(kvStore.Commit(batch))
-	value, err = kvStore.Get(bucket1, testK1[0])
-	require.Nil(err)
-	require.Equal(testV1[0], value)
+
+	// a batch within the limits takes a single transaction
+	batch.Put(bucket1, testK1[0], testV1[0], "")
+	txns, err = committer.CommitSplit(batch)
+	require.NoError(err)
+	require.Equal(1, txns)
+
+	// the transactions before a failing one stay committed, and the batch is left as is
+	for i := 0; i < n; i++ {
+		batch.Put(bucket2, keyOf(i), testV2[1], "")
+	}
+	require.NoError(batch.PutIfNotExists(bucket1, testK1[0], testV1[1], ""))
+	txns, err = committer.CommitSplit(batch)
+	require.Equal(ErrAlreadyExist, errors.Cause(err))
+	require.Equal(2, txns)
+	require.Equal(n+1, batch.Size())
+	value, err = kvStore.Get(bucket2, keyOf(0))
+	require.NoError(err)
+	require.Equal(testV2[1], value)
 }
 
-func TestDBBatch(t *testing.T) {
-	testBatchRollback := func(kvStore KVStore, t *testing.T) {
+func TestKeyValidator(t *testing.T) {
+	errKeyLength := errors.New("key is not 8 bytes")
+	heightKey := WithKeyValidator(bucket2, func(key []byte) error {
+		if len(key) != 8 {
+			return errKeyLength
+		}
+		return nil
+	})
+
+	testKeyValidator := func(kvStore KVStore, t *testing.T) {
 		require := require.New(t)
 		ctx := context.Background()
-		batch := NewBatch()
 
-		require.Nil(kvStore.Start(ctx))
+		require.NoError(kvStore.Start(ctx))
 		defer func() {
-			err := kvStore.Stop(ctx)
-			require.Nil(err)
+			require.NoError(kvStore.Stop(ctx))
 		}()
+		height := make([]byte, 8)
+		binary.BigEndian.PutUint64(height, 1)
 
-		require.Nil(kvStore.Put(bucket1, testK1[0], testV1[1]))
-		require.Nil(kvStore.Put(bucket2, testK2[1], testV2[0]))
-		require.Nil(kvStore.Put(bucket1, testK1[2], testV1[0]))
-
-		batch.Put(bucket1, testK1[0], testV1[0], "")
-		batch.Put(bucket2, testK2[1], testV2[1], "")
-		value, err := kvStore.Get(bucket1, testK1[0])
-		require.Nil(err)
-		require.Equal(testV1[1], value)
+		// a correct key is written, a wrong-sized one is rejected with the error of the validator
+		require.NoError(kvStore.Put(bucket2, height, testV2[0]))
+		err := kvStore.Put(bucket2, height[:4], testV2[0])
+		require.Equal(errKeyLength, errors.Cause(err))
+		_, err = kvStore.Get(bucket2, height[:4])
+		require.True(isNotExist(err))
+		require.Equal(errKeyLength, errors.Cause(kvStore.PutIfNotExists(bucket2, height[:4], testV2[0])))
+		require.Equal(errKeyLength, errors.Cause(kvStore.Delete(bucket2, height[:4])))
 
-		value, err = kvStore.Get(bucket2, testK2[1])
-		require.Nil(err)
+		// a batch with a rejected key writes nothing
+		batch := NewBatch()
+		batch.Put(bucket2, height, testV2[1], "")
+		batch.Put(bucket2, height[:4], testV2[1], "")
+		require.Equal(errKeyLength, errors.Cause(kvStore.Commit(batch)))
+		value, err := kvStore.Get(bucket2, height)
+		require.NoError(err)
 		require.Equal(testV2[0], value)
-		require.Nil(kvStore.Commit(batch))
-
-		value, err = kvStore.Get(bucket1, testK1[0])
-		require.Nil(err)
-		require.Equal(testV1[0], value)
-
-		value, err = kvStore.Get(bucket2, testK2[1])
-		require.Nil(err)
-		require.Equal(testV2[1], value)
-
-		value, err = kvStore.Get(bucket1, testK1[2])
-		require.Nil(err)
-		require.Equal(testV1[0], value)
-
-		batch.Put(bucket1, testK1[0], testV1[1], "")
-		require.Nil(batch.PutIfNotExists(bucket2, testK2[1], testV2[0], ""))
-		err = kvStore.Commit(batch)
-		require.Equal(err, ErrAlreadyExist)
-		// need to clear the batch in case of commit error
-		batch.Clear()
-		require.Equal(0, batch.Size())
 
-		value, err = kvStore.Get(bucket2, testK2[1])
-		require.Nil(err)
-		require.Equal(testV2[1], value)
+		// a rename to a rejected key leaves the record under its old key
+		require.Equal(errKeyLength, errors.Cause(kvStore.(Renamer).Rename(bucket2, height, height[:4])))
+		value, err = kvStore.Get(bucket2, height)
+		require.NoError(err)
+		require.Equal(testV2[0], value)
+		_, err = kvStore.Get(bucket2, height[:4])
+		require.True(isNotExist(err))
 
-		value, err = kvStore.Get(bucket1, testK1[0])
-		require.Nil(err)
-		require.Equal(testV1[0], value)
+		// the keys of the namespaces without a validator are not checked
+		require.NoError(kvStore.Put(bucket1, height[:4], testV1[0]))
+		require.NoError(kvStore.Delete(bucket2, height))
+	}
 
-		require.Nil(batch.PutIfNotExists(bucket3, testK2[0], testV2[0], ""))
-		require.Nil(kvStore.Commit(batch))
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testKeyValidator(NewMemKVStore(heightKey), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-key-validator.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testKeyValidator(NewOnDiskDB(dbCfg, heightKey), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-key-validator.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testKeyValidator(NewOnDiskDB(dbCfg, heightKey), t)
+	})
+}
 
-		value, err = kvStore.Get(bucket3, testK2[0])
-		require.Nil(err)
-		require.Equal(testV2[0], value)
+func TestSwap(t *testing.T) {
+	testSwap := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
 
-		batch.Put(bucket1, testK1[2], testV1[2], "")
-		// we did not set key in bucket3 yet, so this operation will fail and
-		// cause transaction rollback
-		require.Nil(batch.PutIfNotExists(bucket3, testK2[0], testV2[1], ""))
-		require.NotNil(kvStore.Commit(batch))
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		swapper, ok := kvStore.(Swapper)
+		require.True(ok)
 
-		value, err = kvStore.Get(bucket1, testK1[2])
-		require.Nil(err)
+		// an absent key has no old value, and is written
+		old, existed, err := swapper.Swap(bucket1, testK1[0], testV1[0])
+		require.NoError(err)
+		require.False(existed)
+		require.Nil(old)
+		value, err := kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
 		require.Equal(testV1[0], value)
 
-		value, err = kvStore.Get(bucket2, testK2[1])
-		require.Nil(err)
-		require.Equal(testV2[1], value)
-
-		batch.Clear()
-		batch.Put(bucket1, testK1[2], testV1[2], "")
-		batch.Delete(bucket2, testK2[1], "")
-		require.Nil(kvStore.Commit(batch))
-
-		value, err = kvStore.Get(bucket1, testK1[2])
-		require.Nil(err)
+		// a present key returns the value it holds before, and is overwritten
+		old, existed, err = swapper.Swap(bucket1, testK1[0], testV1[1])
+		require.NoError(err)
+		require.True(existed)
+		require.Equal(testV1[0], old)
+		old, existed, err = swapper.Swap(bucket1, testK1[0], testV1[2])
+		require.NoError(err)
+		require.True(existed)
+		require.Equal(testV1[1], old)
+		value, err = kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
 		require.Equal(testV1[2], value)
 
-		_, err = kvStore.Get(bucket2, testK2[1])
-		require.NotNil(err)
+		// a deleted key is absent again
+		require.NoError(kvStore.Delete(bucket1, testK1[0]))
+		_, existed, err = swapper.Swap(bucket1, testK1[0], testV1[0])
+		require.NoError(err)
+		require.False(existed)
 	}
 
-	path := "test-batch-commit.bolt"
-	cfg.DbPath = path
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testSwap(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
 	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-swap.bolt"
 		testutil.CleanupPath(t, path)
 		defer testutil.CleanupPath(t, path)
-		testBatchRollback(NewOnDiskDB(cfg), t)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testSwap(NewOnDiskDB(dbCfg), t)
 	})
-
-	path = "test-batch-commit.badger"
-	cfg.DbPath = path
-	cfg.UseBadgerDB = true
 	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-swap.badger"
 		testutil.CleanupPath(t, path)
 		defer testutil.CleanupPath(t, path)
-		testBatchRollback(NewOnDiskDB(cfg), t)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testSwap(NewOnDiskDB(dbCfg), t)
 	})
 }
 
-func TestCacheKV(t *testing.T) {
-	testFunc := func(kv KVStore, t *testing.T) {
+func TestCompareAndDelete(t *testing.T) {
+	testCompareAndDelete := func(kvStore KVStore, t *testing.T) {
 		require := require.New(t)
+		ctx := context.Background()
 
-		require.Nil(kv.Start(context.Background()))
+		require.NoError(kvStore.Start(ctx))
 		defer func() {
-			err := kv.Stop(context.Background())
-			require.Nil(err)
+			require.NoError(kvStore.Stop(ctx))
 		}()
+		deleter, ok := kvStore.(ConditionalDeleter)
+		require.True(ok)
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
 
-		cb := NewCachedBatch()
-		cb.Put(bucket1, testK1[0], testV1[0], "")
-		v, _ := cb.Get(bucket1, testK1[0])
-		require.Equal(testV1[0], v)
-		cb.Clear()
-		require.Equal(0, cb.Size())
-		_, err := cb.Get(bucket1, testK1[0])
-		require.Error(err)
-		cb.Put(bucket2, testK2[2], testV2[2], "")
-		v, _ = cb.Get(bucket2, testK2[2])
-		require.Equal(testV2[2], v)
-		// <k1[0], v1[0]> is gone
-		require.Nil(cb.PutIfNotExists(bucket1, testK1[0], testV1[0], ""))
-		require.Nil(cb.PutIfNotExists(bucket1, testK1[2], testV1[2], ""))
-		require.Nil(cb.PutIfNotExists(bucket1, testK1[1], testV1[1], ""))
-		v, _ = cb.Get(bucket1, testK1[0])
-		require.Equal(testV1[0], v)
-		v, _ = cb.Get(bucket1, testK1[1])
-		require.Equal(testV1[1], v)
-		v, _ = cb.Get(bucket1, testK1[2])
-		require.Equal(testV1[2], v)
-		// put testK1[1] with a new value
-		cb.Put(bucket1, testK1[1], testV1[2], "")
-		v, _ = cb.Get(bucket1, testK1[1])
-		require.Equal(testV1[2], v)
-		// cannot put same entry again
-		require.Equal(ErrAlreadyExist, errors.Cause(cb.PutIfNotExists(bucket1, testK1[1], testV1[0], "")))
-		// same key but diff bucket name is OK
-		require.Nil(cb.PutIfNotExists(bucket2, testK1[0], testV1[0], ""))
-		// delete a non-existing entry is OK
-		cb.Delete(bucket2, []byte("notexist"), "")
-		require.Nil(kv.Commit(cb))
+		// a mismatched value is kept
+		deleted, err := deleter.CompareAndDelete(bucket1, testK1[0], testV1[1])
+		require.NoError(err)
+		require.False(deleted)
+		value, err := kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[0], value)
 
-		cb = nil
-		cb = NewCachedBatch()
-		v, _ = kv.Get(bucket1, testK1[0])
-		require.Equal(testV1[0], v)
-		v, _ = kv.Get(bucket1, testK1[1])
-		require.Equal(testV1[2], v)
-		v, _ = kv.Get(bucket1, testK1[2])
-		require.Equal(testV1[2], v)
-		v, _ = kv.Get(bucket2, testK1[0])
-		require.Equal(testV1[0], v)
-		require.Nil(cb.PutIfNotExists(bucket2, testK2[0], testV2[0], ""))
-		require.NoError(kv.Commit(cb))
-		// entry exists in DB but not in cache, so OK at this point
-		require.Nil(cb.PutIfNotExists(bucket2, testK1[0], testV1[2], ""))
-		// but would fail upon commit
-		require.Equal(ErrAlreadyExist, errors.Cause(kv.Commit(cb)))
+		// a matched value is deleted
+		deleted, err = deleter.CompareAndDelete(bucket1, testK1[0], testV1[0])
+		require.NoError(err)
+		require.True(deleted)
+		_, err = kvStore.Get(bucket1, testK1[0])
+		require.True(isNotExist(err))
+
+		// a missing key has nothing to delete, neither has a missing namespace
+		deleted, err = deleter.CompareAndDelete(bucket1, testK1[0], testV1[0])
+		require.NoError(err)
+		require.False(deleted)
+		deleted, err = deleter.CompareAndDelete(bucket2, testK2[0], testV2[0])
+		require.NoError(err)
+		require.False(deleted)
 	}
 
 	t.Run("In-memory KV Store", func(t *testing.T) {
-		kv := NewMemKVStore()
-		testFunc(kv, t)
+		testCompareAndDelete(NewMemKVStore(), t)
 	})
-
-	path := "test-cache-kv.bolt"
-	cfg.DbPath = path
+	dbCfg := cfg
 	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-compare-and-delete.bolt"
 		testutil.CleanupPath(t, path)
 		defer testutil.CleanupPath(t, path)
-		testFunc(NewOnDiskDB(cfg), t)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testCompareAndDelete(NewOnDiskDB(dbCfg), t)
 	})
-
-	path = "test-cache-kv.badger"
-	cfg.DbPath = path
-	cfg.UseBadgerDB = true
 	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-compare-and-delete.badger"
 		testutil.CleanupPath(t, path)
 		defer testutil.CleanupPath(t, path)
-		testFunc(NewOnDiskDB(cfg), t)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testCompareAndDelete(NewOnDiskDB(dbCfg), t)
 	})
 }
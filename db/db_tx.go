@@ -0,0 +1,237 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+)
+
+type (
+	// memTx is a transaction of the in-memory KV store, which stages the writes until committed
+	memTx struct {
+		m *memKVStore
+		// writes is the staged writes in order, and staged is the last staged write of each record
+		writes []writeInfo
+		staged map[cacheKey]int
+	}
+
+	// boltTx is a transaction of BoltDB
+	boltTx struct {
+		b  *boltDB
+		tx *bolt.Tx
+	}
+
+	// badgerTx is a transaction of BadgerDB
+	badgerTx struct {
+		b   *badgerDB
+		txn *keyIndexTxn
+	}
+)
+
+// Update calls fn with all shards locked, and applies the staged writes if fn returns nil
+func (m *memKVStore) Update(fn func(Tx) error) error {
+	m.lockAll()
+	defer m.unlockAll()
+
+	tx := &memTx{m: m, staged: make(map[cacheKey]int)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	for _, write := range tx.writes {
+		shard := m.shard(write.namespace, write.key)
+		if write.writeType == Delete {
+			shard.delete(write.namespace, write.key)
+		} else {
+			m.put(shard, write.namespace, write.key, write.value)
+		}
+	}
+	return nil
+}
+
+// Get returns the staged value of the record, or the value in the KV store if the record is not written
+func (t *memTx) Get(namespace string, key []byte) ([]byte, error) {
+	if i, ok := t.staged[cacheKey{namespace: namespace, key: string(key)}]; ok {
+		// a record of nil value is reported as not existing
+		if t.writes[i].writeType == Delete || t.writes[i].value == nil {
+			return nil, errors.Wrapf(ErrNotExist, "key = %x", key)
+		}
+		return t.writes[i].value, nil
+	}
+	// the shards are locked by Update
+	if value := t.m.shard(namespace, key).bucket[namespace][string(key)]; value != nil {
+		return value, nil
+	}
+	if ok, _ := t.m.HasNamespace(namespace); !ok && !t.stagesNamespace(namespace) {
+		return nil, errors.Wrapf(bolt.ErrBucketNotFound, "bucket = %s", namespace)
+	}
+	return nil, errors.Wrapf(ErrNotExist, "key = %x", key)
+}
+
+// Has returns whether the record exists
+func (t *memTx) Has(namespace string, key []byte) (bool, error) {
+	return hasByGet(t, namespace, key)
+}
+
+// Put stages a write of the record
+func (t *memTx) Put(namespace string, key, value []byte) error {
+	if err := t.m.checkNamespace(namespace); err != nil {
+		return err
+	}
+	t.stage(writeInfo{writeType: Put, namespace: namespace, key: key, value: value})
+	return nil
+}
+
+// Delete stages a delete of the record
+func (t *memTx) Delete(namespace string, key []byte) error {
+	if err := t.m.checkNamespace(namespace); err != nil {
+		return err
+	}
+	t.stage(writeInfo{writeType: Delete, namespace: namespace, key: key})
+	return nil
+}
+
+// Update calls fn within a read-write transaction of BoltDB
+func (b *boltDB) Update(fn func(Tx) error) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return fn(&boltTx{b: b, tx: tx})
+	})
+}
+
+// Get retrieves a record, the value is copied so it is valid after the transaction
+func (t *boltTx) Get(namespace string, key []byte) ([]byte, error) {
+	bucket := t.b.wrapBucket(namespace, t.tx.Bucket([]byte(namespace)))
+	if bucket == nil {
+		return nil, errors.Wrapf(bolt.ErrBucketNotFound, "bucket = %s", namespace)
+	}
+	value := bucket.Get(key)
+	if value == nil {
+		return nil, errors.Wrapf(ErrNotExist, "key = %x", key)
+	}
+	return append([]byte{}, value...), nil
+}
+
+// Has returns whether the record exists
+func (t *boltTx) Has(namespace string, key []byte) (bool, error) {
+	return hasByGet(t, namespace, key)
+}
+
+// Put inserts a <key, value> record
+func (t *boltTx) Put(namespace string, key, value []byte) error {
+	bucket, err := t.b.bucketToWrite(t.tx, namespace)
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(bucket.Put(key, value), "failed to put key = %x", key)
+}
+
+// Delete deletes a record
+func (t *boltTx) Delete(namespace string, key []byte) error {
+	bucket, err := t.b.bucketToDelete(t.tx, namespace)
+	if bucket == nil {
+		return err
+	}
+	return errors.Wrapf(bucket.Delete(key), "failed to delete key = %x", key)
+}
+
+// Update calls fn within a read-write transaction of BadgerDB. A transaction writing more than BadgerDB holds in one
+// transaction fails with badger.ErrTxnTooBig
+func (b *badgerDB) Update(fn func(Tx) error) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	err := b.update(func(txn *keyIndexTxn) error {
+		return fn(&badgerTx{b: b, txn: txn})
+	})
+	b.markDirty()
+	return err
+}
+
+// Get retrieves a record
+func (t *badgerTx) Get(namespace string, key []byte) ([]byte, error) {
+	k := append([]byte(namespace), key...)
+	item, err := t.txn.Get(k)
+	if err == badger.ErrKeyNotFound {
+		return nil, errors.Wrapf(ErrNotExist, "key = %x", k)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get key = %x", k)
+	}
+	value, err := valueOf(item)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get value from key = %x", k)
+	}
+	return value, nil
+}
+
+// Has returns whether the record exists
+func (t *badgerTx) Has(namespace string, key []byte) (bool, error) {
+	return hasByGet(t, namespace, key)
+}
+
+// Put inserts a <key, value> record
+func (t *badgerTx) Put(namespace string, key, value []byte) error {
+	if err := t.b.checkNamespace(namespace); err != nil {
+		return err
+	}
+	k := append([]byte(namespace), key...)
+	return errors.Wrapf(t.txn.Set(k, value), "failed to put key = %x", k)
+}
+
+// Delete deletes a record
+func (t *badgerTx) Delete(namespace string, key []byte) error {
+	if err := t.b.checkNamespace(namespace); err != nil {
+		return err
+	}
+	k := append([]byte(namespace), key...)
+	return errors.Wrapf(t.txn.Delete(k), "failed to delete key = %x", k)
+}
+
+//======================================
+// private functions
+//======================================
+
+// stage stages the write, the key and value are copied since they are applied after fn returns
+func (t *memTx) stage(write writeInfo) {
+	write.key = append([]byte(nil), write.key...)
+	if write.value != nil {
+		write.value = append([]byte{}, write.value...)
+	}
+	t.staged[cacheKey{namespace: write.namespace, key: string(write.key)}] = len(t.writes)
+	t.writes = append(t.writes, write)
+}
+
+// stagesNamespace returns whether a record of the namespace is staged to be put
+func (t *memTx) stagesNamespace(namespace string) bool {
+	for _, write := range t.writes {
+		if write.namespace == namespace && write.writeType == Put {
+			return true
+		}
+	}
+	return false
+}
+
+// hasByGet returns whether the record exists by getting it
+func hasByGet(tx Tx, namespace string, key []byte) (bool, error) {
+	_, err := tx.Get(namespace, key)
+	if isNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
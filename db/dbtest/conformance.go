@@ -0,0 +1,538 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package dbtest
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/db"
+)
+
+const (
+	conformanceNS1 = "conformance_ns1"
+	conformanceNS2 = "conformance_ns2"
+)
+
+// conformanceKeys are keys of arbitrary bytes, including zero and delimiter-like bytes
+var conformanceKeys = [][]byte{
+	{0},
+	{0, 0},
+	{0xff},
+	[]byte("a"),
+	[]byte("a\x00b"),
+	[]byte("a.b"),
+	[]byte("a|b"),
+	[]byte("ab"),
+}
+
+// RunKVStoreConformance runs the conformance test suite on the KV store, which checks that every method of
+// db.KVStore, and of the optional capabilities the KV store implements, behaves the same as the other backends.
+// factory must return a new, empty and not yet started KV store on each call
+func RunKVStoreConformance(t *testing.T, factory func() db.KVStore) {
+	run := func(name string, test func(*require.Assertions, db.KVStore)) {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			ctx := context.Background()
+
+			kvStore := factory()
+			require.NoError(kvStore.Start(ctx))
+			defer func() {
+				require.NoError(kvStore.Stop(ctx))
+			}()
+			test(require, kvStore)
+		})
+	}
+
+	run("MissingNamespace", func(require *require.Assertions, kvStore db.KVStore) {
+		_, err := kvStore.Get(conformanceNS1, conformanceKeys[0])
+		require.True(isNotExist(err), "unexpected error %v", err)
+		// deleting from a missing namespace is not an error
+		require.NoError(kvStore.Delete(conformanceNS1, conformanceKeys[0]))
+	})
+
+	run("MissingKey", func(require *require.Assertions, kvStore db.KVStore) {
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v")))
+		_, err := kvStore.Get(conformanceNS1, conformanceKeys[1])
+		require.True(isNotExist(err), "unexpected error %v", err)
+		// the key of the other namespace is missing as well
+		_, err = kvStore.Get(conformanceNS2, conformanceKeys[0])
+		require.True(isNotExist(err), "unexpected error %v", err)
+		// deleting a missing key is not an error
+		require.NoError(kvStore.Delete(conformanceNS1, conformanceKeys[1]))
+	})
+
+	run("PutGet", func(require *require.Assertions, kvStore db.KVStore) {
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v1")))
+		require.NoError(kvStore.Put(conformanceNS2, conformanceKeys[0], []byte("v2")))
+		value, err := kvStore.Get(conformanceNS1, conformanceKeys[0])
+		require.NoError(err)
+		require.Equal([]byte("v1"), value)
+		value, err = kvStore.Get(conformanceNS2, conformanceKeys[0])
+		require.NoError(err)
+		require.Equal([]byte("v2"), value)
+
+		// overwrite
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v3")))
+		value, err = kvStore.Get(conformanceNS1, conformanceKeys[0])
+		require.NoError(err)
+		require.Equal([]byte("v3"), value)
+	})
+
+	run("EmptyValue", func(require *require.Assertions, kvStore db.KVStore) {
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte{}))
+		value, err := kvStore.Get(conformanceNS1, conformanceKeys[0])
+		require.NoError(err)
+		require.Len(value, 0)
+		err = kvStore.PutIfNotExists(conformanceNS1, conformanceKeys[0], []byte("v"))
+		require.Equal(db.ErrAlreadyExist, errors.Cause(err))
+	})
+
+	run("BinaryKeys", func(require *require.Assertions, kvStore db.KVStore) {
+		for i, k := range conformanceKeys {
+			require.NoError(kvStore.Put(conformanceNS1, k, []byte{byte(i)}))
+		}
+		for i, k := range conformanceKeys {
+			value, err := kvStore.Get(conformanceNS1, k)
+			require.NoError(err)
+			require.Equal([]byte{byte(i)}, value, "key = %x", k)
+		}
+	})
+
+	run("PutIfNotExists", func(require *require.Assertions, kvStore db.KVStore) {
+		require.NoError(kvStore.PutIfNotExists(conformanceNS1, conformanceKeys[0], []byte("v1")))
+		err := kvStore.PutIfNotExists(conformanceNS1, conformanceKeys[0], []byte("v2"))
+		require.Equal(db.ErrAlreadyExist, errors.Cause(err))
+		value, err := kvStore.Get(conformanceNS1, conformanceKeys[0])
+		require.NoError(err)
+		require.Equal([]byte("v1"), value)
+		// the same key of another namespace does not exist
+		require.NoError(kvStore.PutIfNotExists(conformanceNS2, conformanceKeys[0], []byte("v2")))
+	})
+
+	run("Delete", func(require *require.Assertions, kvStore db.KVStore) {
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v")))
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[1], []byte("v")))
+		require.NoError(kvStore.Delete(conformanceNS1, conformanceKeys[0]))
+		_, err := kvStore.Get(conformanceNS1, conformanceKeys[0])
+		require.True(isNotExist(err), "unexpected error %v", err)
+		_, err = kvStore.Get(conformanceNS1, conformanceKeys[1])
+		require.NoError(err)
+		// a deleted key can be put again
+		require.NoError(kvStore.PutIfNotExists(conformanceNS1, conformanceKeys[0], []byte("v")))
+	})
+
+	run("Commit", func(require *require.Assertions, kvStore db.KVStore) {
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[2], []byte("v")))
+		batch := db.NewBatch()
+		batch.Put(conformanceNS1, conformanceKeys[0], []byte("v1"), "")
+		require.NoError(batch.PutIfNotExists(conformanceNS1, conformanceKeys[1], []byte("v2"), ""))
+		batch.Delete(conformanceNS1, conformanceKeys[2], "")
+		batch.Put(conformanceNS2, conformanceKeys[0], []byte("v3"), "")
+		// later entries override earlier ones
+		batch.Put(conformanceNS1, conformanceKeys[0], []byte("v4"), "")
+		require.NoError(kvStore.Commit(batch))
+		require.Equal(0, batch.Size())
+
+		value, err := kvStore.Get(conformanceNS1, conformanceKeys[0])
+		require.NoError(err)
+		require.Equal([]byte("v4"), value)
+		value, err = kvStore.Get(conformanceNS1, conformanceKeys[1])
+		require.NoError(err)
+		require.Equal([]byte("v2"), value)
+		_, err = kvStore.Get(conformanceNS1, conformanceKeys[2])
+		require.True(isNotExist(err), "unexpected error %v", err)
+		value, err = kvStore.Get(conformanceNS2, conformanceKeys[0])
+		require.NoError(err)
+		require.Equal([]byte("v3"), value)
+
+		// an empty batch is fine
+		require.NoError(kvStore.Commit(db.NewBatch()))
+	})
+
+	run("CommitAllOrNothing", func(require *require.Assertions, kvStore db.KVStore) {
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v")))
+		batch := db.NewBatch()
+		batch.Put(conformanceNS1, conformanceKeys[1], []byte("v1"), "")
+		batch.Delete(conformanceNS1, conformanceKeys[0], "")
+		batch.Put(conformanceNS1, conformanceKeys[2], []byte("v2"), "")
+		require.NoError(batch.PutIfNotExists(conformanceNS1, conformanceKeys[2], []byte("v3"), ""))
+		require.Equal(db.ErrAlreadyExist, errors.Cause(kvStore.Commit(batch)))
+		// the batch is kept intact
+		require.Equal(4, batch.Size())
+
+		value, err := kvStore.Get(conformanceNS1, conformanceKeys[0])
+		require.NoError(err)
+		require.Equal([]byte("v"), value)
+		for _, k := range conformanceKeys[1:3] {
+			_, err = kvStore.Get(conformanceNS1, k)
+			require.True(isNotExist(err), "unexpected error %v", err)
+		}
+	})
+
+	run("Streamer", func(require *require.Assertions, kvStore db.KVStore) {
+		streamer, ok := kvStore.(db.Streamer)
+		if !ok {
+			return
+		}
+		for i, k := range conformanceKeys {
+			require.NoError(kvStore.Put(conformanceNS1, k, []byte{byte(i)}))
+		}
+		require.NoError(kvStore.Put(conformanceNS2, conformanceKeys[0], []byte("v")))
+		var mutex sync.Mutex
+		var keys [][]byte
+		require.NoError(streamer.StreamAll(conformanceNS1, func(k, v []byte) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			keys = append(keys, append([]byte(nil), k...))
+			return nil
+		}))
+		sort.Slice(keys, func(i, j int) bool { return string(keys[i]) < string(keys[j]) })
+		expected := append([][]byte(nil), conformanceKeys...)
+		sort.Slice(expected, func(i, j int) bool { return string(expected[i]) < string(expected[j]) })
+		require.Equal(expected, keys)
+	})
+
+	run("CountingCommitter", func(require *require.Assertions, kvStore db.KVStore) {
+		committer, ok := kvStore.(db.CountingCommitter)
+		if !ok {
+			return
+		}
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v")))
+		batch := db.NewBatch()
+		require.NoError(batch.PutIfNotExists(conformanceNS1, conformanceKeys[0], []byte("v1"), ""))
+		batch.Put(conformanceNS1, conformanceKeys[1], []byte("v2"), "")
+		batch.Delete(conformanceNS1, conformanceKeys[2], "")
+		applied, skipped, err := committer.CommitCounting(batch)
+		require.NoError(err)
+		require.Equal(uint64(2), applied)
+		require.Equal(uint64(1), skipped)
+		require.Equal(0, batch.Size())
+		value, err := kvStore.Get(conformanceNS1, conformanceKeys[0])
+		require.NoError(err)
+		require.Equal([]byte("v"), value)
+	})
+
+	run("SplitCommitter", func(require *require.Assertions, kvStore db.KVStore) {
+		committer, ok := kvStore.(db.SplitCommitter)
+		if !ok {
+			return
+		}
+		batch := db.NewBatch()
+		batch.Put(conformanceNS1, conformanceKeys[0], []byte("v1"), "")
+		batch.Put(conformanceNS1, conformanceKeys[1], []byte("v2"), "")
+		batch.Delete(conformanceNS1, conformanceKeys[0], "")
+		txns, err := committer.CommitSplit(batch)
+		require.NoError(err)
+		require.Equal(1, txns)
+		require.Equal(0, batch.Size())
+		_, err = kvStore.Get(conformanceNS1, conformanceKeys[0])
+		require.True(isNotExist(err), "unexpected error %v", err)
+		value, err := kvStore.Get(conformanceNS1, conformanceKeys[1])
+		require.NoError(err)
+		require.Equal([]byte("v2"), value)
+	})
+
+	run("Clearable", func(require *require.Assertions, kvStore db.KVStore) {
+		clearable, ok := kvStore.(db.Clearable)
+		if !ok {
+			return
+		}
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v")))
+		require.NoError(kvStore.Put(conformanceNS2, conformanceKeys[0], []byte("v")))
+		require.NoError(clearable.Clear())
+		for _, ns := range []string{conformanceNS1, conformanceNS2} {
+			_, err := kvStore.Get(ns, conformanceKeys[0])
+			require.True(isNotExist(err), "unexpected error %v", err)
+		}
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v")))
+	})
+
+	run("EmptyChecker", func(require *require.Assertions, kvStore db.KVStore) {
+		checker, ok := kvStore.(db.EmptyChecker)
+		if !ok {
+			return
+		}
+		empty, err := checker.IsEmpty()
+		require.NoError(err)
+		require.True(empty)
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v")))
+		empty, err = checker.IsEmpty()
+		require.NoError(err)
+		require.False(empty)
+		require.NoError(kvStore.Delete(conformanceNS1, conformanceKeys[0]))
+		empty, err = checker.IsEmpty()
+		require.NoError(err)
+		require.True(empty)
+	})
+
+	run("NamespaceIterator", func(require *require.Assertions, kvStore db.KVStore) {
+		iterator, ok := kvStore.(db.NamespaceIterator)
+		if !ok {
+			return
+		}
+		for i, k := range conformanceKeys {
+			require.NoError(kvStore.Put(conformanceNS1, k, []byte{byte(i)}))
+		}
+		require.NoError(kvStore.Put(conformanceNS2, conformanceKeys[0], []byte("v")))
+		sorted := append([][]byte(nil), conformanceKeys...)
+		sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+		visited := make(map[string][][]byte)
+		require.NoError(iterator.ForEachNamespace(func(namespace string, it db.Iterator) error {
+			for it.Next() {
+				visited[namespace] = append(visited[namespace], it.Key())
+			}
+			return nil
+		}))
+		require.Equal(sorted, visited[conformanceNS1])
+		require.Equal([][]byte{conformanceKeys[0]}, visited[conformanceNS2])
+	})
+
+	run("Warmer", func(require *require.Assertions, kvStore db.KVStore) {
+		warmer, ok := kvStore.(db.Warmer)
+		if !ok {
+			return
+		}
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v")))
+		require.NoError(warmer.Warmup(context.Background(), []string{conformanceNS1, conformanceNS2}, true))
+		value, err := kvStore.Get(conformanceNS1, conformanceKeys[0])
+		require.NoError(err)
+		require.Equal([]byte("v"), value)
+	})
+
+	run("Syncer", func(require *require.Assertions, kvStore db.KVStore) {
+		syncer, ok := kvStore.(db.Syncer)
+		if !ok {
+			return
+		}
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v")))
+		require.NoError(syncer.Sync())
+	})
+
+	run("Snapshotter", func(require *require.Assertions, kvStore db.KVStore) {
+		snapshotter, ok := kvStore.(db.Snapshotter)
+		if !ok {
+			return
+		}
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v1")))
+		snapshot, err := snapshotter.Snapshot()
+		require.NoError(err)
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v2")))
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[1], []byte("v2")))
+		value, err := snapshot.Get(conformanceNS1, conformanceKeys[0])
+		require.NoError(err)
+		require.Equal([]byte("v1"), value)
+		_, err = snapshot.Get(conformanceNS1, conformanceKeys[1])
+		require.True(isNotExist(err), "unexpected error %v", err)
+		_, err = snapshot.Get(conformanceNS2, conformanceKeys[0])
+		require.True(isNotExist(err), "unexpected error %v", err)
+		require.Equal(db.ErrReadOnlyTxn, errors.Cause(snapshot.Put(conformanceNS1, conformanceKeys[0], []byte("v"))))
+		require.Equal(db.ErrReadOnlyTxn, errors.Cause(snapshot.Delete(conformanceNS1, conformanceKeys[0])))
+		snapshot.Release()
+		_, err = snapshot.Get(conformanceNS1, conformanceKeys[0])
+		require.Equal(db.ErrInvalidDB, errors.Cause(err))
+	})
+
+	run("NamespaceManager", func(require *require.Assertions, kvStore db.KVStore) {
+		manager, ok := kvStore.(db.NamespaceManager)
+		if !ok {
+			return
+		}
+		ok, err := manager.HasNamespace(conformanceNS1)
+		require.NoError(err)
+		require.False(ok)
+		require.NoError(manager.CreateNamespace(conformanceNS1))
+		require.NoError(manager.CreateNamespace(conformanceNS1))
+		ok, err = manager.HasNamespace(conformanceNS1)
+		require.NoError(err)
+		require.True(ok)
+		// a write creates the namespace implicitly
+		require.NoError(kvStore.Put(conformanceNS2, conformanceKeys[0], []byte("v")))
+		ok, err = manager.HasNamespace(conformanceNS2)
+		require.NoError(err)
+		require.True(ok)
+	})
+
+	run("NamespaceSwapper", func(require *require.Assertions, kvStore db.KVStore) {
+		swapper, ok := kvStore.(db.NamespaceSwapper)
+		if !ok {
+			return
+		}
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v1")))
+		require.NoError(kvStore.Put(conformanceNS2, conformanceKeys[1], []byte("v2")))
+		require.NoError(swapper.SwapNamespaces(conformanceNS1, conformanceNS2))
+		value, err := kvStore.Get(conformanceNS1, conformanceKeys[1])
+		require.NoError(err)
+		require.Equal([]byte("v2"), value)
+		value, err = kvStore.Get(conformanceNS2, conformanceKeys[0])
+		require.NoError(err)
+		require.Equal([]byte("v1"), value)
+		_, err = kvStore.Get(conformanceNS1, conformanceKeys[0])
+		require.True(isNotExist(err), "unexpected error %v", err)
+	})
+
+	run("SnapshotGetter", func(require *require.Assertions, kvStore db.KVStore) {
+		getter, ok := kvStore.(db.SnapshotGetter)
+		if !ok {
+			return
+		}
+		values, err := getter.SnapshotGet(conformanceNS1, conformanceKeys[:2])
+		require.NoError(err)
+		require.Equal([][]byte{nil, nil}, values)
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[1], []byte("v")))
+		values, err = getter.SnapshotGet(conformanceNS1, conformanceKeys[:2])
+		require.NoError(err)
+		require.Equal([][]byte{nil, []byte("v")}, values)
+	})
+
+	run("SnapshotOpener", func(require *require.Assertions, kvStore db.KVStore) {
+		opener, ok := kvStore.(db.SnapshotOpener)
+		if !ok {
+			return
+		}
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v1")))
+		snapshot, err := opener.OpenSnapshot()
+		require.NoError(err)
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v2")))
+		value, err := snapshot.Get(conformanceNS1, conformanceKeys[0])
+		require.NoError(err)
+		require.Equal([]byte("v1"), value)
+		require.Equal(db.ErrReadOnlyTxn, snapshot.Put(conformanceNS1, conformanceKeys[0], []byte("v3")))
+		require.NoError(snapshot.Stop(context.Background()))
+		_, err = snapshot.Get(conformanceNS1, conformanceKeys[0])
+		require.Equal(db.ErrDBClosed, errors.Cause(err))
+	})
+
+	run("KeyPager", func(require *require.Assertions, kvStore db.KVStore) {
+		pager, ok := kvStore.(db.KeyPager)
+		if !ok {
+			return
+		}
+		for _, key := range conformanceKeys {
+			require.NoError(kvStore.Put(conformanceNS1, key, []byte("v")))
+		}
+		var listed [][]byte
+		var after []byte
+		for {
+			keys, cursor, err := pager.KeysPaged(conformanceNS1, after, 3)
+			require.NoError(err)
+			listed = append(listed, keys...)
+			if cursor == nil {
+				break
+			}
+			after = cursor
+		}
+		expected := append([][]byte(nil), conformanceKeys...)
+		sort.Slice(expected, func(i, j int) bool { return bytes.Compare(expected[i], expected[j]) < 0 })
+		require.Equal(expected, listed)
+	})
+
+	run("BulkInserter", func(require *require.Assertions, kvStore db.KVStore) {
+		inserter, ok := kvStore.(db.BulkInserter)
+		if !ok {
+			return
+		}
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[1], []byte("old")))
+		inserted, err := inserter.PutIfNotExistsBatch(conformanceNS1, []db.KeyValue{
+			{Key: conformanceKeys[0], Value: []byte("new")},
+			{Key: conformanceKeys[1], Value: []byte("new")},
+			{Key: conformanceKeys[0], Value: []byte("again")},
+		})
+		require.NoError(err)
+		require.Equal([]bool{true, false, false}, inserted)
+		value, err := kvStore.Get(conformanceNS1, conformanceKeys[0])
+		require.NoError(err)
+		require.Equal([]byte("new"), value)
+		value, err = kvStore.Get(conformanceNS1, conformanceKeys[1])
+		require.NoError(err)
+		require.Equal([]byte("old"), value)
+	})
+
+	run("UnsafeGetter", func(require *require.Assertions, kvStore db.KVStore) {
+		getter, ok := kvStore.(db.UnsafeGetter)
+		if !ok {
+			return
+		}
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v")))
+		value, release, err := getter.UnsafeGet(conformanceNS1, conformanceKeys[0])
+		require.NoError(err)
+		require.Equal([]byte("v"), value)
+		release()
+		_, _, err = getter.UnsafeGet(conformanceNS1, conformanceKeys[1])
+		require.True(isNotExist(err), "unexpected error %v", err)
+	})
+
+	run("MappedGetter", func(require *require.Assertions, kvStore db.KVStore) {
+		getter, ok := kvStore.(db.MappedGetter)
+		if !ok {
+			return
+		}
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v")))
+		value, err := getter.GetMapped(conformanceNS1, conformanceKeys[0])
+		require.NoError(err)
+		require.Equal([]byte("v"), value.Bytes())
+		require.NoError(value.Close())
+		_, err = getter.GetMapped(conformanceNS1, conformanceKeys[1])
+		require.True(isNotExist(err), "unexpected error %v", err)
+	})
+
+	run("Renamer", func(require *require.Assertions, kvStore db.KVStore) {
+		renamer, ok := kvStore.(db.Renamer)
+		if !ok {
+			return
+		}
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[0], []byte("v")))
+		require.NoError(kvStore.Put(conformanceNS1, conformanceKeys[1], []byte("w")))
+		err := renamer.Rename(conformanceNS1, conformanceKeys[0], conformanceKeys[1])
+		require.Equal(db.ErrAlreadyExist, errors.Cause(err))
+		require.NoError(renamer.Rename(conformanceNS1, conformanceKeys[0], conformanceKeys[2]))
+		value, err := kvStore.Get(conformanceNS1, conformanceKeys[2])
+		require.NoError(err)
+		require.Equal([]byte("v"), value)
+		require.Equal(db.ErrNotExist, errors.Cause(renamer.Rename(conformanceNS1, conformanceKeys[0], conformanceKeys[3])))
+	})
+
+	run("Updater", func(require *require.Assertions, kvStore db.KVStore) {
+		updater, ok := kvStore.(db.Updater)
+		if !ok {
+			return
+		}
+		errRollback := errors.New("roll back")
+		require.Equal(errRollback, updater.Update(func(tx db.Tx) error {
+			require.NoError(tx.Put(conformanceNS1, conformanceKeys[0], []byte("v")))
+			return errRollback
+		}))
+		_, err := kvStore.Get(conformanceNS1, conformanceKeys[0])
+		require.True(isNotExist(err), "unexpected error %v", err)
+		require.NoError(updater.Update(func(tx db.Tx) error {
+			return tx.Put(conformanceNS1, conformanceKeys[0], []byte("v"))
+		}))
+		value, err := kvStore.Get(conformanceNS1, conformanceKeys[0])
+		require.NoError(err)
+		require.Equal([]byte("v"), value)
+	})
+}
+
+//======================================
+// private functions
+//======================================
+
+// isNotExist returns whether err is the error a KV store returns for a key or a namespace which does not exist
+func isNotExist(err error) bool {
+	switch errors.Cause(err) {
+	case db.ErrNotExist, bolt.ErrBucketNotFound:
+		return true
+	}
+	return false
+}
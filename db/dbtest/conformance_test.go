@@ -0,0 +1,47 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package dbtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/config"
+	"github.com/iotexproject/iotex-core/db"
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestKVStoreConformance(t *testing.T) {
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		RunKVStoreConformance(t, func() db.KVStore { return db.NewMemKVStore() })
+	})
+
+	for _, useBadgerDB := range []bool{false, true} {
+		name := "Bolt DB"
+		if useBadgerDB {
+			name = "Badger DB"
+		}
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "test-conformance")
+			require.NoError(t, err)
+			defer testutil.CleanupPath(t, dir)
+
+			var count int
+			RunKVStoreConformance(t, func() db.KVStore {
+				count++
+				dbCfg := config.Default.DB
+				dbCfg.DbPath = filepath.Join(dir, fmt.Sprintf("db-%d", count))
+				dbCfg.UseBadgerDB = useBadgerDB
+				return db.NewOnDiskDB(dbCfg)
+			})
+		})
+	}
+}
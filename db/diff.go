@@ -0,0 +1,167 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+)
+
+// diffPageSize is the number of keys of each KV store read at a time while comparing them
+const diffPageSize = 256
+
+type (
+	// DiffResult is the differences between the records of two KV stores
+	DiffResult struct {
+		// Namespaces is the differences of each namespace compared, by name, with no entry for a namespace which is
+		// the same in both KV stores
+		Namespaces map[string]*NamespaceDiff
+		// Truncated is true if the comparison stopped at the maximum number of differences, so there may be more
+		Truncated bool
+	}
+
+	// NamespaceDiff is the differences between the records of a namespace in two KV stores, each in key order
+	NamespaceDiff struct {
+		// OnlyInA is the keys existing only in the first KV store
+		OnlyInA [][]byte
+		// OnlyInB is the keys existing only in the second KV store
+		OnlyInB [][]byte
+		// Mismatched is the keys existing in both KV stores with different values
+		Mismatched [][]byte
+	}
+
+	// DiffOption sets an option of Diff
+	DiffOption func(*diffOptions)
+
+	// diffOptions is the collection of options of Diff
+	diffOptions struct {
+		// maxDiffs is the number of differences Diff stops at, 0 means all of them are reported
+		maxDiffs int
+	}
+
+	// diffCursor walks the keys of a namespace in sorted order, page by page
+	diffCursor struct {
+		pager     KeyPager
+		namespace string
+		keys      [][]byte
+		after     []byte
+		done      bool
+	}
+)
+
+// WithMaxDiffs makes Diff stop once it finds max differences in total, and report the result as truncated
+func WithMaxDiffs(max int) DiffOption {
+	return func(opts *diffOptions) {
+		opts.maxDiffs = max
+	}
+}
+
+// Diff compares the records of the namespaces in the two KV stores, and reports the keys existing in only one of
+// them and those whose values differ, e.g. to verify a migration or a restore from backup. Both KV stores must
+// implement KeyPager. The keys of both are merged in sorted order page by page, and only the values of the keys
+// existing in both are read, so neither is loaded into memory as a whole. The KV stores are not read at a single point
+// in time, so a KV store written to during the comparison may be reported with differences it never had
+func Diff(a, b KVStore, namespaces []string, opts ...DiffOption) (DiffResult, error) {
+	var options diffOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	pagerA, okA := a.(KeyPager)
+	pagerB, okB := b.(KeyPager)
+	if !okA || !okB {
+		return DiffResult{}, errors.Wrap(ErrInvalidDB, "KV store is unable to list keys in order")
+	}
+
+	result := DiffResult{Namespaces: make(map[string]*NamespaceDiff)}
+	count := 0
+	for _, namespace := range namespaces {
+		diff := &NamespaceDiff{}
+		cursorA := &diffCursor{pager: pagerA, namespace: namespace}
+		cursorB := &diffCursor{pager: pagerB, namespace: namespace}
+		for options.maxDiffs == 0 || count < options.maxDiffs {
+			keyA, err := cursorA.key()
+			if err != nil {
+				return DiffResult{}, err
+			}
+			keyB, err := cursorB.key()
+			if err != nil {
+				return DiffResult{}, err
+			}
+			if keyA == nil && keyB == nil {
+				break
+			}
+			switch {
+			case keyB == nil || keyA != nil && bytes.Compare(keyA, keyB) < 0:
+				diff.OnlyInA = append(diff.OnlyInA, keyA)
+				cursorA.next()
+				count++
+			case keyA == nil || bytes.Compare(keyA, keyB) > 0:
+				diff.OnlyInB = append(diff.OnlyInB, keyB)
+				cursorB.next()
+				count++
+			default:
+				same, err := sameValue(a, b, namespace, keyA)
+				if err != nil {
+					return DiffResult{}, err
+				}
+				if !same {
+					diff.Mismatched = append(diff.Mismatched, keyA)
+					count++
+				}
+				cursorA.next()
+				cursorB.next()
+			}
+		}
+		if len(diff.OnlyInA)+len(diff.OnlyInB)+len(diff.Mismatched) > 0 {
+			result.Namespaces[namespace] = diff
+		}
+		if options.maxDiffs > 0 && count >= options.maxDiffs {
+			result.Truncated = true
+			break
+		}
+	}
+	return result, nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// key returns the key the cursor is at, reading the next page once the keys read are all walked, or nil once there
+// is no key left
+func (c *diffCursor) key() ([]byte, error) {
+	for len(c.keys) == 0 && !c.done {
+		keys, cursor, err := c.pager.KeysPaged(c.namespace, c.after, diffPageSize)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list keys of namespace %s", c.namespace)
+		}
+		c.keys, c.after, c.done = keys, cursor, cursor == nil
+	}
+	if len(c.keys) == 0 {
+		return nil, nil
+	}
+	return c.keys[0], nil
+}
+
+// next moves the cursor to the next key
+func (c *diffCursor) next() {
+	c.keys = c.keys[1:]
+}
+
+// sameValue returns true if the key has the same value in both KV stores
+func sameValue(a, b KVStore, namespace string, key []byte) (bool, error) {
+	valueA, err := a.Get(namespace, key)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to get key = %x", key)
+	}
+	valueB, err := b.Get(namespace, key)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to get key = %x", key)
+	}
+	return bytes.Equal(valueA, valueB), nil
+}
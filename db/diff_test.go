@@ -0,0 +1,106 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestDiff(t *testing.T) {
+	testDiff := func(a KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		b := NewMemKVStore()
+		require.NoError(a.Start(ctx))
+		require.NoError(b.Start(ctx))
+		defer func() {
+			require.NoError(a.Stop(ctx))
+			require.NoError(b.Stop(ctx))
+		}()
+
+		// the same records across several pages of keys, but for a few in each category
+		key := func(i int) []byte { return []byte(fmt.Sprintf("key-%04d", i)) }
+		batchA, batchB := NewBatch(), NewBatch()
+		for i := 0; i < 3*diffPageSize; i++ {
+			value := []byte(fmt.Sprintf("value-%d", i))
+			switch {
+			case i%200 == 7:
+				require.NoError(batchA.Put(bucket1, key(i), value, ""))
+			case i%300 == 11:
+				require.NoError(batchB.Put(bucket1, key(i), value, ""))
+			case i == 500:
+				require.NoError(batchA.Put(bucket1, key(i), value, ""))
+				require.NoError(batchB.Put(bucket1, key(i), []byte("other"), ""))
+			default:
+				require.NoError(batchA.Put(bucket1, key(i), value, ""))
+				require.NoError(batchB.Put(bucket1, key(i), value, ""))
+			}
+		}
+		require.NoError(batchA.Put(bucket2, testK2[0], testV2[0], ""))
+		require.NoError(batchB.Put(bucket2, testK2[0], testV2[0], ""))
+		require.NoError(a.Commit(batchA))
+		require.NoError(b.Commit(batchB))
+
+		result, err := Diff(a, b, []string{bucket1, bucket2, "test_ns3"})
+		require.NoError(err)
+		require.False(result.Truncated)
+		require.Len(result.Namespaces, 1)
+		require.Equal(&NamespaceDiff{
+			OnlyInA:    [][]byte{key(7), key(207), key(407), key(607)},
+			OnlyInB:    [][]byte{key(11), key(311), key(611)},
+			Mismatched: [][]byte{key(500)},
+		}, result.Namespaces[bucket1])
+
+		// the same stores have no differences
+		result, err = Diff(a, a, []string{bucket1, bucket2})
+		require.NoError(err)
+		require.False(result.Truncated)
+		require.Empty(result.Namespaces)
+
+		// the differences are cut at the maximum
+		result, err = Diff(a, b, []string{bucket1, bucket2}, WithMaxDiffs(3))
+		require.NoError(err)
+		require.True(result.Truncated)
+		require.Equal(&NamespaceDiff{
+			OnlyInA: [][]byte{key(7), key(207)},
+			OnlyInB: [][]byte{key(11)},
+		}, result.Namespaces[bucket1])
+
+		// a KV store unable to list its keys in order is rejected
+		_, err = Diff(a, NewHookedKVStore(b), []string{bucket1})
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testDiff(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-diff.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testDiff(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-diff.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testDiff(NewOnDiskDB(dbCfg), t)
+	})
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// dumpValueLimit is the number of bytes of a value Dump prints before truncating it
+const dumpValueLimit = 32
+
+// namespaceLister is implemented by KV stores which are able to list their namespaces
+type namespaceLister interface {
+	namespaceNames() ([]string, error)
+}
+
+// Dump writes a human-readable listing of the records of the namespaces to w, sorted by namespace and key, one record
+// per line as "<namespace> <hex key> <hex value>", with values longer than 32 bytes truncated. If no namespace is
+// given, all namespaces are listed; BadgerDB has no namespaces of its own, so its records are listed with an empty
+// namespace and keys of namespace||key instead.
+//
+// Dump is a diagnostic for debugging tests, it visits every record and must not be used in regular code paths. The
+// KV store must implement Streamer
+func Dump(kvStore KVStore, w io.Writer, namespaces ...string) error {
+	streamer, ok := kvStore.(Streamer)
+	if !ok {
+		return errors.Wrap(ErrInvalidDB, "KV store is unable to stream records")
+	}
+	if len(namespaces) == 0 {
+		if lister, ok := kvStore.(namespaceLister); ok {
+			var err error
+			if namespaces, err = lister.namespaceNames(); err != nil {
+				return err
+			}
+		} else {
+			namespaces = []string{""}
+		}
+	}
+	namespaces = append([]string(nil), namespaces...)
+	sort.Strings(namespaces)
+
+	for _, namespace := range namespaces {
+		var mutex sync.Mutex
+		var records [][2][]byte
+		// fn may be called concurrently, and k and v may be reused after it returns
+		if err := streamer.StreamAll(namespace, func(k, v []byte) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			records = append(records, [2][]byte{append([]byte(nil), k...), append([]byte(nil), v...)})
+			return nil
+		}); err != nil {
+			return errors.Wrapf(err, "failed to stream namespace %s", namespace)
+		}
+		sort.Slice(records, func(i, j int) bool {
+			return bytes.Compare(records[i][0], records[j][0]) < 0
+		})
+		for _, r := range records {
+			value := fmt.Sprintf("%x", r[1])
+			if len(r[1]) > dumpValueLimit {
+				value = fmt.Sprintf("%x...(%d bytes)", r[1][:dumpValueLimit], len(r[1]))
+			}
+			if _, err := fmt.Fprintf(w, "%s %x %s\n", namespace, r[0], value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
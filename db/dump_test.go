@@ -0,0 +1,59 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestDump(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	kvStore := NewMemKVStore()
+	require.NoError(kvStore.Put(bucket2, []byte{0x02}, []byte("v2")))
+	require.NoError(kvStore.Put(bucket1, []byte{0x01, 0xff}, []byte{}))
+	require.NoError(kvStore.Put(bucket1, []byte{0x01}, bytes.Repeat([]byte{0xab}, 40)))
+
+	var buf bytes.Buffer
+	require.NoError(Dump(kvStore, &buf))
+	require.Equal(
+		"test_ns1 01 abababababababababababababababababababababababababababababababab...(40 bytes)\n"+
+			"test_ns1 01ff \n"+
+			"test_ns2 02 7632\n",
+		buf.String(),
+	)
+	buf.Reset()
+	require.NoError(Dump(kvStore, &buf, bucket2, bucket3))
+	require.Equal("test_ns2 02 7632\n", buf.String())
+
+	// BadgerDB lists raw keys under the empty namespace
+	dbCfg := cfg
+	path := "test-dump.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+	kvStore = NewOnDiskDB(dbCfg)
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	require.NoError(kvStore.Put("ns", []byte{0x01}, []byte("v")))
+	buf.Reset()
+	require.NoError(Dump(kvStore, &buf))
+	require.Equal(" 6e7301 76\n", buf.String())
+	buf.Reset()
+	require.NoError(Dump(kvStore, &buf, "ns"))
+	require.Equal("ns 01 76\n", buf.String())
+}
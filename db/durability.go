@@ -0,0 +1,184 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"github.com/boltdb/bolt"
+)
+
+// Durability is how durable a commit is once it returns, from the least to the most durable. It is the least a
+// commit gets: a KV store may make it more durable, e.g. BadgerDB fsyncs each commit unless WithGroupCommit is set
+type Durability int
+
+const (
+	// DurabilitySync makes the commit fsynced before it returns, so it survives both a crash of the process and a
+	// power loss. It is the durability of Commit
+	DurabilitySync Durability = iota
+	// DurabilityGroupCommit lets the commit be fsynced together with others. On BoltDB it is merged into one
+	// transaction with the commits made concurrently, which is fsynced before they return, so it is as durable as
+	// DurabilitySync but may wait a few milliseconds for the others. On BadgerDB with WithGroupCommit it is fsynced
+	// by the next group, so it is lost upon a power loss within the interval of the group after it returns
+	DurabilityGroupCommit
+	// DurabilityNoSync asks for no fsync, and the commit may be lost upon a power loss until the KV store is synced
+	// or stopped. BoltDB with fsync off may be corrupted upon a power loss rather than only lose the commit, so it
+	// commits as DurabilityGroupCommit instead, and so does BadgerDB, whose fsync applies to the whole DB
+	DurabilityNoSync
+)
+
+// CommitPriority is how urgent a commit is
+type CommitPriority int
+
+const (
+	// PriorityNormal lets the commit wait to be merged with others
+	PriorityNormal CommitPriority = iota
+	// PriorityHigh makes the commit never wait for others, so it is committed on its own as DurabilitySync on BoltDB
+	PriorityHigh
+)
+
+type (
+	// DurableCommitter is the interface of KV store which is able to commit a batch at a durability of its own, so
+	// that one KV store serves both the commits which must be durable and those which may be lost upon a crash
+	DurableCommitter interface {
+		// CommitWithOptions commits the batch as Commit does, at the durability and priority of the options
+		CommitWithOptions(KVStoreBatch, ...CommitOption) error
+	}
+
+	// CommitBarrier is the interface of KV store which is able to fence the commits made so far from those made after,
+	// e.g. to write the data, then a pointer to it only once the data survives a crash
+	CommitBarrier interface {
+		// Barrier returns once all commits returned before it are durable. Unlike Sync, it does nothing if they are
+		// durable already, and does not block the reads meanwhile
+		Barrier() error
+	}
+
+	// CommitOption sets an option of a commit
+	CommitOption func(*commitOptions)
+
+	// commitOptions is the collection of options of a commit
+	commitOptions struct {
+		durability Durability
+		priority   CommitPriority
+	}
+)
+
+// WithDurability sets the durability of the commit, DurabilitySync by default
+func WithDurability(durability Durability) CommitOption {
+	return func(opts *commitOptions) {
+		opts.durability = durability
+	}
+}
+
+// WithPriority sets the priority of the commit, PriorityNormal by default
+func WithPriority(priority CommitPriority) CommitOption {
+	return func(opts *commitOptions) {
+		opts.priority = priority
+	}
+}
+
+// CommitWithOptions commits the batch on its own if it is to be fsynced or of high priority, otherwise it is merged
+// into one transaction with the commits made concurrently, sharing one fsync
+func (b *boltDB) CommitWithOptions(batch KVStoreBatch, opts ...CommitOption) error {
+	options := newCommitOptions(opts)
+	if options.durability == DurabilitySync || options.priority == PriorityHigh {
+		return b.Commit(batch)
+	}
+	// the merged commits take the read lock, so that they run concurrently for BoltDB to merge them, while any other
+	// write is still made on its own
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	succeed := false
+	batch.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			batch.ClearAndUnlock()
+		} else {
+			batch.Unlock()
+		}
+	}()
+
+	if batch.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	if err := validateBatchKeys(b.options, batch); err != nil {
+		return err
+	}
+
+	var err error
+	numRetries := b.config.NumRetries
+	for c := uint8(0); c < numRetries; c++ {
+		// a batch failing within the merged transaction is committed again on its own, so its error is its own
+		err = b.db.Batch(func(tx *bolt.Tx) error {
+			return b.writeBatch(tx, batch)
+		})
+		if err == nil || err == ErrAlreadyExist {
+			break
+		}
+	}
+	succeed = (err == nil)
+	return err
+}
+
+// CommitWithOptions commits the batch, and fsyncs it right away if it is to be fsynced in group commit mode
+func (b *badgerDB) CommitWithOptions(batch KVStoreBatch, opts ...CommitOption) error {
+	if err := b.Commit(batch); err != nil {
+		return err
+	}
+	if newCommitOptions(opts).durability != DurabilitySync || b.options.groupCommitInterval == 0 {
+		return nil
+	}
+	return b.Sync()
+}
+
+// CommitWithOptions commits the batch, the in-memory KV store keeps nothing durable whatever the durability
+func (m *memKVStore) CommitWithOptions(batch KVStoreBatch, _ ...CommitOption) error {
+	return m.Commit(batch)
+}
+
+// Barrier does nothing but check BoltDB is open, as each commit is fsynced before it returns
+func (b *boltDB) Barrier() error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+	return nil
+}
+
+// Barrier fsyncs the commits pending in group commit mode, after the commit in progress if any, otherwise each commit
+// is fsynced on its own already
+func (b *badgerDB) Barrier() error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+	return b.flush()
+}
+
+// Barrier does nothing, the in-memory KV store keeps nothing durable
+func (m *memKVStore) Barrier() error { return nil }
+
+//======================================
+// private functions
+//======================================
+
+// newCommitOptions returns the options of a commit set by opts
+func newCommitOptions(opts []CommitOption) commitOptions {
+	var options commitOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
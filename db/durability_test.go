@@ -0,0 +1,202 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestCommitWithOptions(t *testing.T) {
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		path := "test-commit-with-options.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		kvStore := NewOnDiskDB(dbCfg)
+		require.NoError(kvStore.Start(ctx))
+		committer, ok := kvStore.(DurableCommitter)
+		require.True(ok)
+		require.NoError(kvStore.Put(bucket2, testK2[0], testV2[0]))
+
+		// the concurrent commits are merged, and the one failing in the merged transaction fails on its own
+		var wg sync.WaitGroup
+		errs := make([]error, 8)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				batch := NewBatch()
+				if errs[i] = batch.Put(bucket1, []byte(fmt.Sprintf("key_%d", i)), testV1[i%3], ""); errs[i] != nil {
+					return
+				}
+				if i == 0 {
+					if errs[i] = batch.PutIfNotExists(bucket2, testK2[0], testV2[1], ""); errs[i] != nil {
+						return
+					}
+				}
+				durability := DurabilityGroupCommit
+				if i%2 == 1 {
+					durability = DurabilityNoSync
+				}
+				errs[i] = committer.CommitWithOptions(batch, WithDurability(durability))
+			}(i)
+		}
+		wg.Wait()
+		require.Equal(ErrAlreadyExist, errors.Cause(errs[0]))
+		for _, err := range errs[1:] {
+			require.NoError(err)
+		}
+		batch := NewBatch()
+		require.NoError(batch.Put(bucket2, testK2[1], testV2[1], ""))
+		require.NoError(committer.CommitWithOptions(batch, WithDurability(DurabilityNoSync), WithPriority(PriorityHigh)))
+		batch = NewBatch()
+		require.NoError(batch.Put(bucket2, testK2[2], testV2[2], ""))
+		require.NoError(committer.CommitWithOptions(batch))
+
+		// BoltDB fsyncs each of them before returning, so all survive a reopen
+		require.NoError(kvStore.Stop(ctx))
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		_, err := kvStore.Get(bucket1, []byte("key_0"))
+		require.True(isNotExist(err))
+		for i := 1; i < len(errs); i++ {
+			value, err := kvStore.Get(bucket1, []byte(fmt.Sprintf("key_%d", i)))
+			require.NoError(err)
+			require.Equal(testV1[i%3], value)
+		}
+		for i := 0; i < 3; i++ {
+			value, err := kvStore.Get(bucket2, testK2[i])
+			require.NoError(err)
+			require.Equal(testV2[i], value)
+		}
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		path := "test-commit-with-options.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		kvStore := NewOnDiskDB(dbCfg, WithGroupCommit(time.Minute), WithClock(clock.NewMock()))
+		require.NoError(kvStore.Start(ctx))
+		committer, ok := kvStore.(DurableCommitter)
+		require.True(ok)
+		badgerStore := kvStore.(*badgerDB)
+
+		// a commit not to be fsynced waits for the group, which a power loss meanwhile would lose
+		batch := NewBatch()
+		require.NoError(batch.Put(bucket1, testK1[0], testV1[0], ""))
+		require.NoError(committer.CommitWithOptions(batch, WithDurability(DurabilityNoSync)))
+		require.Equal(int32(1), atomic.LoadInt32(&badgerStore.dirty))
+		require.Equal(uint64(0), atomic.LoadUint64(&badgerStore.syncs))
+
+		// a commit to be fsynced is fsynced before it returns, together with those pending
+		batch = NewBatch()
+		require.NoError(batch.Put(bucket1, testK1[1], testV1[1], ""))
+		require.NoError(committer.CommitWithOptions(batch, WithDurability(DurabilitySync)))
+		require.Equal(int32(0), atomic.LoadInt32(&badgerStore.dirty))
+		require.Equal(uint64(1), atomic.LoadUint64(&badgerStore.syncs))
+
+		require.NoError(kvStore.Stop(ctx))
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		for i := 0; i < 2; i++ {
+			value, err := kvStore.Get(bucket1, testK1[i])
+			require.NoError(err)
+			require.Equal(testV1[i], value)
+		}
+	})
+}
+
+func TestBarrier(t *testing.T) {
+	dbCfg := cfg
+	t.Run("Badger DB group commit", func(t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		path := "test-barrier.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		// the group never fires on its own, as the mock clock does not move
+		kvStore := NewOnDiskDB(dbCfg, WithGroupCommit(time.Minute), WithClock(clock.NewMock()))
+		require.NoError(kvStore.Start(ctx))
+		badgerStore := kvStore.(*badgerDB)
+		barrier := kvStore.(CommitBarrier)
+
+		// the barrier makes the data durable before the pointer to it is written
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		require.Equal(int32(1), atomic.LoadInt32(&badgerStore.dirty))
+		require.NoError(barrier.Barrier())
+		require.Equal(int32(0), atomic.LoadInt32(&badgerStore.dirty))
+		require.Equal(uint64(1), atomic.LoadUint64(&badgerStore.syncs))
+		require.NoError(kvStore.Put(bucket1, testK1[1], testK1[0]))
+		// the pointer is pending in the group, independent of the data durable already
+		require.Equal(int32(1), atomic.LoadInt32(&badgerStore.dirty))
+		require.Equal(uint64(1), atomic.LoadUint64(&badgerStore.syncs))
+
+		// a barrier with nothing pending does not fsync
+		require.NoError(barrier.Barrier())
+		require.NoError(barrier.Barrier())
+		require.Equal(uint64(2), atomic.LoadUint64(&badgerStore.syncs))
+		require.NoError(kvStore.Stop(ctx))
+		require.Equal(ErrDBClosed, errors.Cause(barrier.Barrier()))
+
+		kvStore = NewOnDiskDB(dbCfg)
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		pointer, err := kvStore.Get(bucket1, testK1[1])
+		require.NoError(err)
+		value, err := kvStore.Get(bucket1, pointer)
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+	})
+	t.Run("Bolt DB", func(t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		path := "test-barrier.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		kvStore := NewOnDiskDB(dbCfg)
+		require.NoError(kvStore.Start(ctx))
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		require.NoError(kvStore.(CommitBarrier).Barrier())
+		require.NoError(kvStore.Stop(ctx))
+		require.Equal(ErrDBClosed, errors.Cause(kvStore.(CommitBarrier).Barrier()))
+	})
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		require.NoError(t, NewMemKVStore().(CommitBarrier).Barrier())
+	})
+}
@@ -0,0 +1,319 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+)
+
+// snapshotImportBatchSize is the number of records ImportSnapshot commits at a time
+const snapshotImportBatchSize = 1024
+
+// snapshotMagic starts an exported snapshot, and tells its format version
+var snapshotMagic = []byte("KVSNAP01")
+
+const (
+	// snapshotTagEnd, snapshotTagNamespace and snapshotTagRecord tag the end of the snapshot, the start of a
+	// namespace, and a record of the namespace started last
+	snapshotTagEnd = iota
+	snapshotTagNamespace
+	snapshotTagRecord
+)
+
+// SnapshotExporter is the interface of KV store which is able to export several namespaces as of a single point in
+// time, e.g. for a backup consistent across the namespaces
+type SnapshotExporter interface {
+	// SnapshotExport writes the records of the namespaces to w as of a single point in time, unaffected by the
+	// writes made concurrently. A namespace which does not exist is exported with no record. ImportSnapshot reads the
+	// export back.
+	//
+	// The export starts with the magic "KVSNAP01", followed by each namespace as the tag 1 and its name, each record
+	// of the namespace in key order as the tag 2, its key and its value, and the tag 0 ending the export along with
+	// the big-endian CRC-32 of all bytes before it. The tags are bytes, and the names, keys and values are prefixed
+	// with their length as uvarint
+	SnapshotExport(io.Writer, []string) error
+}
+
+type (
+	// snapshotEncoder writes a snapshot export
+	snapshotEncoder struct {
+		w   *bufio.Writer
+		crc hash.Hash32
+		n   []byte
+	}
+
+	// snapshotDecoder reads a snapshot export, keeping the CRC-32 of the bytes read
+	snapshotDecoder struct {
+		r   *bufio.Reader
+		crc hash.Hash32
+	}
+)
+
+// SnapshotExport writes the namespaces within one read transaction of BoltDB, which is held open for the whole export,
+// so that a slow writer keeps the BoltDB file from reusing the pages freed meanwhile
+func (b *boltDB) SnapshotExport(w io.Writer, namespaces []string) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	e := newSnapshotEncoder(w)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		defer b.readTxns.hold("SnapshotExport")()
+		for _, namespace := range namespaces {
+			e.namespace(namespace)
+			bucket := b.wrapBucket(namespace, tx.Bucket([]byte(namespace)))
+			if bucket == nil {
+				continue
+			}
+			if err := bucket.ForEach(func(k, v []byte) error {
+				return e.record(k, v)
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to export snapshot")
+	}
+	return e.close()
+}
+
+// SnapshotExport writes the namespaces within one read transaction of BadgerDB, which reads as of its timestamp.
+// BadgerDB has no namespaces of its own, so a namespace also exports the records of the namespaces it is a prefix of,
+// keyed by the rest of their names and their keys
+func (b *badgerDB) SnapshotExport(w io.Writer, namespaces []string) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	e := newSnapshotEncoder(w)
+	err := b.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for _, namespace := range namespaces {
+			e.namespace(namespace)
+			prefix := []byte(namespace)
+			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+				item := it.Item()
+				value, err := item.Value()
+				if err != nil {
+					return errors.Wrapf(err, "failed to get value from key = %x", item.Key())
+				}
+				if err := e.record(item.Key()[len(prefix):], value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to export snapshot")
+	}
+	return e.close()
+}
+
+// SnapshotExport writes the namespaces with all shards read locked for the whole export
+func (m *memKVStore) SnapshotExport(w io.Writer, namespaces []string) error {
+	m.rlockAll()
+	defer m.runlockAll()
+
+	e := newSnapshotEncoder(w)
+	for _, namespace := range namespaces {
+		e.namespace(namespace)
+		var keys []string
+		for _, shard := range m.shards {
+			for k, v := range shard.bucket[namespace] {
+				// a record of nil value is reported as not existing
+				if v != nil {
+					keys = append(keys, k)
+				}
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := e.record([]byte(k), m.shard(namespace, []byte(k)).bucket[namespace][k]); err != nil {
+				return errors.Wrap(err, "failed to export snapshot")
+			}
+		}
+	}
+	return e.close()
+}
+
+// ImportSnapshot writes the records of a snapshot exported by SnapshotExporter.SnapshotExport to the KV store,
+// creating the namespaces which do not exist. The records are committed a batch at a time, and the CRC-32 of the
+// export is only checked at its end, so an export failing its checksum or cut short returns ErrChecksumMismatch or
+// ErrInvalidDB with the records before the failure imported already; import into a new KV store to discard them
+func ImportSnapshot(kvStore KVStore, r io.Reader) error {
+	d := &snapshotDecoder{r: bufio.NewReader(r), crc: crc32.NewIEEE()}
+	magic := make([]byte, len(snapshotMagic))
+	if err := d.read(magic); err != nil || !bytes.Equal(magic, snapshotMagic) {
+		return errors.Wrap(ErrInvalidDB, "not a snapshot export")
+	}
+	batch := NewBatch()
+	namespace, started := "", false
+	for {
+		tag, err := d.readByte()
+		if err != nil {
+			return err
+		}
+		switch tag {
+		case snapshotTagNamespace:
+			name, err := d.readBytes()
+			if err != nil {
+				return err
+			}
+			namespace, started = string(name), true
+			if err := createReservedNamespace(kvStore, namespace); err != nil {
+				return errors.Wrapf(err, "failed to create namespace %s", namespace)
+			}
+		case snapshotTagRecord:
+			if !started {
+				return errors.Wrap(ErrInvalidDB, "malformed snapshot export: record out of namespace")
+			}
+			key, err := d.readBytes()
+			if err != nil {
+				return err
+			}
+			value, err := d.readBytes()
+			if err != nil {
+				return err
+			}
+			batch.Put(namespace, key, value, "failed to import key = %x", key)
+			if batch.Size() < snapshotImportBatchSize {
+				continue
+			}
+			if err := kvStore.Commit(batch); err != nil {
+				return errors.Wrap(err, "failed to import snapshot")
+			}
+			batch = NewBatch()
+		case snapshotTagEnd:
+			sum := d.crc.Sum32()
+			crc := make([]byte, 4)
+			if _, err := io.ReadFull(d.r, crc); err != nil {
+				return errors.Wrap(ErrInvalidDB, "malformed snapshot export: cut short")
+			}
+			if binary.BigEndian.Uint32(crc) != sum {
+				return errors.Wrap(ErrChecksumMismatch, "snapshot export")
+			}
+			return errors.Wrap(kvStore.Commit(batch), "failed to import snapshot")
+		default:
+			return errors.Wrapf(ErrInvalidDB, "malformed snapshot export: unknown tag %d", tag)
+		}
+	}
+}
+
+//======================================
+// private functions
+//======================================
+
+// newSnapshotEncoder returns an encoder writing a snapshot export to w, which starts with the magic
+func newSnapshotEncoder(w io.Writer) *snapshotEncoder {
+	e := &snapshotEncoder{
+		w:   bufio.NewWriter(w),
+		crc: crc32.NewIEEE(),
+		n:   make([]byte, binary.MaxVarintLen64),
+	}
+	e.write(snapshotMagic)
+	return e
+}
+
+// write writes b, the error of the writer is kept by it and returned by close
+func (e *snapshotEncoder) write(b []byte) {
+	e.w.Write(b)
+	e.crc.Write(b)
+}
+
+// writeBytes writes b prefixed with its length
+func (e *snapshotEncoder) writeBytes(b []byte) {
+	e.write(e.n[:binary.PutUvarint(e.n, uint64(len(b)))])
+	e.write(b)
+}
+
+// namespace starts a namespace
+func (e *snapshotEncoder) namespace(namespace string) {
+	e.write([]byte{snapshotTagNamespace})
+	e.writeBytes([]byte(namespace))
+}
+
+// record writes a record of the namespace started last, and returns the error of the writer so far, which stops the
+// export early
+func (e *snapshotEncoder) record(key, value []byte) error {
+	e.write([]byte{snapshotTagRecord})
+	e.writeBytes(key)
+	e.writeBytes(value)
+	_, err := e.w.Write(nil)
+	return err
+}
+
+// close ends the export with its checksum, and flushes it
+func (e *snapshotEncoder) close() error {
+	e.write([]byte{snapshotTagEnd})
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, e.crc.Sum32())
+	e.w.Write(crc)
+	return errors.Wrap(e.w.Flush(), "failed to write snapshot export")
+}
+
+// read reads len(b) bytes
+func (d *snapshotDecoder) read(b []byte) error {
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return errors.Wrap(ErrInvalidDB, "malformed snapshot export: cut short")
+	}
+	d.crc.Write(b)
+	return nil
+}
+
+// readByte reads a byte
+func (d *snapshotDecoder) readByte() (byte, error) {
+	b := make([]byte, 1)
+	if err := d.read(b); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// ReadByte reads a byte for binary.ReadUvarint
+func (d *snapshotDecoder) ReadByte() (byte, error) {
+	return d.readByte()
+}
+
+// readBytes reads bytes prefixed with their length, an empty value is kept non-nil, since a nil value is reported as
+// not existing by the in-memory KV store
+func (d *snapshotDecoder) readBytes() ([]byte, error) {
+	l, err := binary.ReadUvarint(d)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidDB, "malformed snapshot export: bad length")
+	}
+	// the bytes are read as they come rather than allocated upfront, so a corrupted length only fails on the end
+	var buf bytes.Buffer
+	if n, err := io.CopyN(&buf, d.r, int64(l)); err != nil || uint64(n) != l {
+		return nil, errors.Wrap(ErrInvalidDB, "malformed snapshot export: cut short")
+	}
+	b := buf.Bytes()
+	if b == nil {
+		b = []byte{}
+	}
+	d.crc.Write(b)
+	return b, nil
+}
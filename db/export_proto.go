@@ -0,0 +1,217 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// protoExportPageSize is the number of keys ExportProto and ExportFiltered list at a time
+const protoExportPageSize = 1024
+
+// ExportProto writes the records of the namespace to w in key order, as a stream of protobuf messages recordPb defined
+// in record.proto, each prefixed with its length as uvarint, the same as writeDelimitedTo of the Java protobuf library
+// and parseDelimitedFrom of the others, so that the export is readable by the tools of any language. The timestamp of
+// a record is set if the KV store implements TimestampGetter and the namespace is timestamped, and 0 otherwise.
+//
+// The records are read one at a time rather than as of a single point in time. The KV store must implement KeyPager
+func ExportProto(kvStore KVStore, namespace string, w io.Writer) error {
+	pager, ok := kvStore.(KeyPager)
+	if !ok {
+		return errors.Wrap(ErrInvalidDB, "KV store is unable to list keys")
+	}
+	stamps, _ := kvStore.(TimestampGetter)
+	bw := bufio.NewWriter(w)
+	n := make([]byte, binary.MaxVarintLen64)
+	after := []byte{}
+	for after != nil {
+		keys, next, err := pager.KeysPaged(namespace, after, protoExportPageSize)
+		if isNotExist(err) {
+			break
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to list keys of namespace %s", namespace)
+		}
+		for _, key := range keys {
+			record := &RecordPb{Namespace: namespace, Key: key}
+			if stamps != nil {
+				var ts time.Time
+				record.Value, ts, err = stamps.GetWithTimestamp(namespace, key)
+				if err == nil && !ts.IsZero() {
+					record.Timestamp = ts.UnixNano()
+				}
+			} else {
+				record.Value, err = kvStore.Get(namespace, key)
+			}
+			if isNotExist(err) {
+				// deleted since listed
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed to get key = %x", key)
+			}
+			if err := writeDelimited(bw, n, record); err != nil {
+				return err
+			}
+		}
+		after = next
+	}
+	return bw.Flush()
+}
+
+// ExportFiltered writes the records of the namespace for which pred returns true to w in key order, in the format of
+// ExportProto with no timestamp, and returns the number written, e.g. to archive the blocks below a height. If
+// deleteExported is true, the records written are deleted as well, a page of 1024 keys at a time: the export is
+// flushed to w first, and the records of the page are then deleted in one transaction, each only if its value is still
+// the one written, so that a record never leaves the KV store unless it is in the export, and a record overwritten
+// meanwhile is kept. If ExportFiltered fails, the records of the pages done before are deleted already, while those
+// written to w since are not.
+//
+// pred must not retain key and value. The KV store must implement KeyPager, and Updater to delete the records
+func ExportFiltered(kvStore KVStore, namespace string, pred func(key, value []byte) bool, w io.Writer,
+	deleteExported bool) (uint64, error) {
+	pager, ok := kvStore.(KeyPager)
+	if !ok {
+		return 0, errors.Wrap(ErrInvalidDB, "KV store is unable to list keys")
+	}
+	updater, ok := kvStore.(Updater)
+	if deleteExported && !ok {
+		return 0, errors.Wrap(ErrInvalidDB, "KV store is unable to delete in a transaction")
+	}
+	bw := bufio.NewWriter(w)
+	n := make([]byte, binary.MaxVarintLen64)
+	var exported uint64
+	after := []byte{}
+	for after != nil {
+		keys, next, err := pager.KeysPaged(namespace, after, protoExportPageSize)
+		if isNotExist(err) {
+			break
+		}
+		if err != nil {
+			return exported, errors.Wrapf(err, "failed to list keys of namespace %s", namespace)
+		}
+		var written []KeyValue
+		for _, key := range keys {
+			value, err := kvStore.Get(namespace, key)
+			if isNotExist(err) {
+				// deleted since listed
+				continue
+			}
+			if err != nil {
+				return exported, errors.Wrapf(err, "failed to get key = %x", key)
+			}
+			if !pred(key, value) {
+				continue
+			}
+			if err := writeDelimited(bw, n, &RecordPb{Namespace: namespace, Key: key, Value: value}); err != nil {
+				return exported, err
+			}
+			exported++
+			written = append(written, KeyValue{Key: key, Value: value})
+		}
+		if deleteExported && len(written) > 0 {
+			if err := bw.Flush(); err != nil {
+				return exported, err
+			}
+			if err := deleteUnchanged(updater, namespace, written); err != nil {
+				return exported, errors.Wrapf(err, "failed to delete exported records of namespace %s", namespace)
+			}
+		}
+		after = next
+	}
+	return exported, bw.Flush()
+}
+
+// ImportProto reads the records of a stream written by ExportProto, or by any tool writing length-delimited protobuf
+// messages recordPb, and puts each into its namespace, committing 1024 records at a time. The timestamps are not
+// restored, a timestamped namespace stamps the records with the time they are imported at
+func ImportProto(kvStore KVStore, r io.Reader) error {
+	br := bufio.NewReader(r)
+	batch := NewBatch()
+	created := make(map[string]struct{})
+	for {
+		size, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(ErrInvalidDB, "malformed protobuf export: cut short")
+		}
+		b := make([]byte, size)
+		if _, err := io.ReadFull(br, b); err != nil {
+			return errors.Wrap(ErrInvalidDB, "malformed protobuf export: cut short")
+		}
+		record := &RecordPb{}
+		if err := proto.Unmarshal(b, record); err != nil {
+			return errors.Wrapf(ErrInvalidDB, "malformed protobuf export: %v", err)
+		}
+		if record.Namespace == "" {
+			return errors.Wrap(ErrInvalidDB, "malformed protobuf export: record out of namespace")
+		}
+		if _, ok := created[record.Namespace]; !ok {
+			if err := createReservedNamespace(kvStore, record.Namespace); err != nil {
+				return errors.Wrapf(err, "failed to create namespace %s", record.Namespace)
+			}
+			created[record.Namespace] = struct{}{}
+		}
+		batch.Put(record.Namespace, record.Key, record.Value, "failed to import key = %x", record.Key)
+		if batch.Size() < snapshotImportBatchSize {
+			continue
+		}
+		if err := kvStore.Commit(batch); err != nil {
+			return errors.Wrap(err, "failed to import protobuf export")
+		}
+		batch = NewBatch()
+	}
+	return errors.Wrap(kvStore.Commit(batch), "failed to import protobuf export")
+}
+
+//======================================
+// private functions
+//======================================
+
+// writeDelimited writes the record to w prefixed with its length as uvarint, n being a buffer of the length
+func writeDelimited(w *bufio.Writer, n []byte, record *RecordPb) error {
+	b, err := proto.Marshal(record)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal key = %x", record.Key)
+	}
+	if _, err := w.Write(n[:binary.PutUvarint(n, uint64(len(b)))]); err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// deleteUnchanged deletes the records of the namespace whose value is still the one given, in one transaction
+func deleteUnchanged(updater Updater, namespace string, records []KeyValue) error {
+	return updater.Update(func(tx Tx) error {
+		for _, kv := range records {
+			value, err := tx.Get(namespace, kv.Key)
+			if isNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(value, kv.Value) {
+				continue
+			}
+			if err := tx.Delete(namespace, kv.Key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
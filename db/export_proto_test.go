@@ -0,0 +1,188 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestExportProto(t *testing.T) {
+	testExportProto := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		key := func(i int) []byte { return []byte(fmt.Sprintf("key-%04d", i)) }
+		// the records span several pages of keys
+		const numRecords = 2*protoExportPageSize + 1
+		batch := NewBatch()
+		for i := 0; i < numRecords; i++ {
+			require.NoError(batch.Put(bucket1, key(i), []byte(fmt.Sprintf("value-%d", i)), ""))
+		}
+		require.NoError(kvStore.Put(bucket2, testK2[0], testV2[0]))
+		require.NoError(kvStore.Commit(batch))
+
+		var export bytes.Buffer
+		require.NoError(ExportProto(kvStore, bucket1, &export))
+
+		// the stream decodes with the standard reader of length-delimited messages
+		buf := proto.NewBuffer(export.Bytes())
+		for i := 0; i < numRecords; i++ {
+			record := &RecordPb{}
+			require.NoError(buf.DecodeMessage(record))
+			require.Equal(bucket1, record.GetNamespace())
+			require.Equal(key(i), record.GetKey())
+			require.Equal([]byte(fmt.Sprintf("value-%d", i)), record.GetValue())
+			require.Equal(int64(0), record.GetTimestamp())
+		}
+		// and holds nothing more
+		require.Error(buf.DecodeMessage(&RecordPb{}))
+
+		// a namespace which does not exist is exported with no record
+		var empty bytes.Buffer
+		require.NoError(ExportProto(kvStore, "nonexistent", &empty))
+		require.Equal(0, empty.Len())
+
+		// the records are imported back into their namespace
+		imported := NewMemKVStore()
+		require.NoError(imported.Start(ctx))
+		defer func() {
+			require.NoError(imported.Stop(ctx))
+		}()
+		require.NoError(ImportProto(imported, bytes.NewReader(export.Bytes())))
+		for i := 0; i < numRecords; i++ {
+			value, err := imported.Get(bucket1, key(i))
+			require.NoError(err)
+			require.Equal([]byte(fmt.Sprintf("value-%d", i)), value)
+		}
+		_, err := imported.Get(bucket2, testK2[0])
+		require.True(isNotExist(err))
+
+		// a stream cut short is rejected
+		err = ImportProto(NewMemKVStore(), bytes.NewReader(export.Bytes()[:export.Len()-1]))
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testExportProto(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-export-proto.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testExportProto(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-export-proto.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testExportProto(NewOnDiskDB(dbCfg), t)
+	})
+}
+
+func TestExportFiltered(t *testing.T) {
+	testExportFiltered := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		height := func(h uint64) []byte {
+			key := make([]byte, 8)
+			binary.BigEndian.PutUint64(key, h)
+			return key
+		}
+		// the blocks below the threshold span several pages of keys
+		const numBlocks, threshold = 3 * protoExportPageSize, 2*protoExportPageSize + 10
+		batch := NewBatch()
+		for h := uint64(0); h < numBlocks; h++ {
+			require.NoError(batch.Put(bucket1, height(h), []byte(fmt.Sprintf("block-%d", h)), ""))
+		}
+		require.NoError(kvStore.Commit(batch))
+		below := func(key, _ []byte) bool { return binary.BigEndian.Uint64(key) < threshold }
+		checkExport := func(export []byte) {
+			buf := proto.NewBuffer(export)
+			for h := uint64(0); h < threshold; h++ {
+				record := &RecordPb{}
+				require.NoError(buf.DecodeMessage(record))
+				require.Equal(bucket1, record.GetNamespace())
+				require.Equal(height(h), record.GetKey())
+				require.Equal([]byte(fmt.Sprintf("block-%d", h)), record.GetValue())
+			}
+			require.Error(buf.DecodeMessage(&RecordPb{}))
+		}
+
+		// export only leaves the records as they are
+		var export bytes.Buffer
+		count, err := ExportFiltered(kvStore, bucket1, below, &export, false)
+		require.NoError(err)
+		require.Equal(uint64(threshold), count)
+		checkExport(export.Bytes())
+		for _, h := range []uint64{0, threshold - 1, threshold, numBlocks - 1} {
+			_, err := kvStore.Get(bucket1, height(h))
+			require.NoError(err)
+		}
+
+		// export and delete removes the records exported only
+		export.Reset()
+		count, err = ExportFiltered(kvStore, bucket1, below, &export, true)
+		require.NoError(err)
+		require.Equal(uint64(threshold), count)
+		checkExport(export.Bytes())
+		for h := uint64(0); h < numBlocks; h++ {
+			_, err := kvStore.Get(bucket1, height(h))
+			require.Equal(h < threshold, isNotExist(err))
+		}
+
+		// the export imports back the records deleted
+		require.NoError(ImportProto(kvStore, bytes.NewReader(export.Bytes())))
+		value, err := kvStore.Get(bucket1, height(0))
+		require.NoError(err)
+		require.Equal([]byte("block-0"), value)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testExportFiltered(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-export-filtered.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testExportFiltered(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-export-filtered.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testExportFiltered(NewOnDiskDB(dbCfg), t)
+	})
+}
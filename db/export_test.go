@@ -0,0 +1,118 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestSnapshotExport(t *testing.T) {
+	testExport := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		exporter := kvStore.(SnapshotExporter)
+
+		// the records round-trip, an empty value included
+		batch := NewBatch()
+		for i := 0; i < 100; i++ {
+			require.NoError(batch.Put(bucket1, []byte(fmt.Sprintf("key-%03d", i)), []byte(fmt.Sprintf("v%d", i)), ""))
+		}
+		require.NoError(batch.Put(bucket2, testK2[0], []byte{}, ""))
+		require.NoError(kvStore.Commit(batch))
+		var buf bytes.Buffer
+		require.NoError(exporter.SnapshotExport(&buf, []string{bucket1, bucket2, "test_ns3"}))
+		imported := NewMemKVStore()
+		require.NoError(ImportSnapshot(imported, bytes.NewReader(buf.Bytes())))
+		result, err := Diff(kvStore, imported, []string{bucket1, bucket2})
+		require.NoError(err)
+		require.Empty(result.Namespaces)
+		value, err := imported.Get(bucket2, testK2[0])
+		require.NoError(err)
+		require.Equal([]byte{}, value)
+
+		// a corrupted or cut short export is rejected
+		corrupted := append([]byte(nil), buf.Bytes()...)
+		corrupted[len(corrupted)/2] ^= 0x01
+		err = ImportSnapshot(NewMemKVStore(), bytes.NewReader(corrupted))
+		require.Error(err)
+		require.Contains([]error{ErrChecksumMismatch, ErrInvalidDB}, errors.Cause(err))
+		err = ImportSnapshot(NewMemKVStore(), bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+		err = ImportSnapshot(NewMemKVStore(), bytes.NewReader([]byte("not a snapshot")))
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+
+		// each commit moves a counter kept in both namespaces, so an export of a single point in time has them equal
+		done := make(chan error, 1)
+		stop := make(chan struct{})
+		go func() {
+			for i := uint64(1); ; i++ {
+				select {
+				case <-stop:
+					done <- nil
+					return
+				default:
+				}
+				counter := make([]byte, 8)
+				binary.BigEndian.PutUint64(counter, i)
+				batch := NewBatch()
+				batch.Put(bucket1, testK1[0], counter, "")
+				batch.Put(bucket2, testK2[1], counter, "")
+				if err := kvStore.Commit(batch); err != nil {
+					done <- err
+					return
+				}
+			}
+		}()
+		for i := 0; i < 20; i++ {
+			var buf bytes.Buffer
+			require.NoError(exporter.SnapshotExport(&buf, []string{bucket1, bucket2}))
+			imported := NewMemKVStore()
+			require.NoError(ImportSnapshot(imported, &buf))
+			counter1, err1 := imported.Get(bucket1, testK1[0])
+			counter2, err2 := imported.Get(bucket2, testK2[1])
+			require.Equal(err1 == nil, err2 == nil)
+			require.Equal(counter1, counter2)
+		}
+		close(stop)
+		require.NoError(<-done)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testExport(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-export.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testExport(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-export.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testExport(NewOnDiskDB(dbCfg), t)
+	})
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+// NamespaceFlusher is the interface of KV store which is able to make the recent writes to a namespace durable on disk
+// on demand, e.g. for the block store to have its latest blocks durable on disk right after a bulk of writes. BadgerDB
+// does not implement it, since v1.5 has no API to flush its memtables to tables on demand, short of closing the DB;
+// Sync makes its recent writes durable in the value log instead
+type NamespaceFlusher interface {
+	// FlushNamespace makes the writes made so far to the namespace durable on disk
+	FlushNamespace(string) error
+}
+
+// FlushNamespace fsyncs the file of BoltDB, whose writes go straight to the B+tree of their namespace
+func (b *boltDB) FlushNamespace(string) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+	return b.db.Sync()
+}
+
+// FlushNamespace does nothing, the in-memory KV store has nothing to flush
+func (m *memKVStore) FlushNamespace(string) error { return nil }
@@ -0,0 +1,63 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestFlushNamespace(t *testing.T) {
+	key := func(i int) []byte { return []byte(fmt.Sprintf("block-%04d", i)) }
+
+	testFlush := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		for i := 0; i < 100; i++ {
+			require.NoError(kvStore.Put(bucket1, key(i), testV1[i%3]))
+		}
+		require.NoError(kvStore.(NamespaceFlusher).FlushNamespace(bucket1))
+		for i := 0; i < 100; i++ {
+			value, err := kvStore.Get(bucket1, key(i))
+			require.NoError(err)
+			require.Equal(testV1[i%3], value)
+		}
+		require.NoError(kvStore.Put(bucket1, key(100), testV1[0]))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testFlush(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-flush-namespace.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testFlush(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-flush-namespace.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		_, ok := NewOnDiskDB(dbCfg).(NamespaceFlusher)
+		require.False(t, ok)
+	})
+}
@@ -0,0 +1,291 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// frontCodingBlockSize is the maximum number of records of a front-coded block
+const frontCodingBlockSize = 16
+
+// errStopIteration stops ForEachFrom without failing it
+var errStopIteration = errors.New("stop iteration")
+
+type (
+	// kvBucket is the record level access to a bucket of BoltDB
+	kvBucket interface {
+		// Get returns the value of the key, or nil if not existing
+		Get([]byte) []byte
+		// Put sets the value of the key
+		Put([]byte, []byte) error
+		// Delete deletes the key
+		Delete([]byte) error
+		// ForEach calls fn on each record in key order
+		ForEach(func([]byte, []byte) error) error
+		// ForEachFrom calls fn on each record whose key is not less than start in key order, until fn returns
+		// errStopIteration
+		ForEachFrom([]byte, func([]byte, []byte) error) error
+	}
+
+	// plainBucket keeps each record as a record of the bucket
+	plainBucket struct {
+		*bolt.Bucket
+	}
+
+	// frontCodedBucket keeps the records in blocks of up to frontCodingBlockSize sorted records. A block is a record
+	// of the bucket whose key is the first key of the block, and whose value is the records, each key delta-encoded
+	// against the previous key as the length of the shared prefix followed by the rest of the key
+	frontCodedBucket struct {
+		bucket *bolt.Bucket
+	}
+
+	// frontCodedRecord is a decoded record of a front-coded block
+	frontCodedRecord struct {
+		key   []byte
+		value []byte
+	}
+)
+
+// ForEachFrom calls fn on each record whose key is not less than start
+func (b plainBucket) ForEachFrom(start []byte, fn func([]byte, []byte) error) error {
+	c := b.Cursor()
+	for k, v := c.Seek(start); k != nil; k, v = c.Next() {
+		if err := fn(k, v); err != nil {
+			if err == errStopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the value of the key by decoding the block the key falls into
+func (b frontCodedBucket) Get(key []byte) []byte {
+	_, records, err := b.block(key)
+	if err != nil {
+		return nil
+	}
+	i, found := searchRecords(records, key)
+	if !found {
+		return nil
+	}
+	return records[i].value
+}
+
+// Put inserts the record into the block the key falls into, which is split in half if it gets too large
+func (b frontCodedBucket) Put(key, value []byte) error {
+	blockKey, records, err := b.block(key)
+	if err != nil {
+		return err
+	}
+	if blockKey == nil {
+		// the key is before the first block, or the bucket is empty
+		if k, v := b.bucket.Cursor().First(); k != nil {
+			blockKey = append([]byte(nil), k...)
+			if records, err = decodeFrontCodedBlock(v); err != nil {
+				return err
+			}
+		}
+	}
+	record := frontCodedRecord{key: append([]byte(nil), key...), value: append([]byte{}, value...)}
+	i, found := searchRecords(records, key)
+	if found {
+		records[i] = record
+	} else {
+		records = append(records, frontCodedRecord{})
+		copy(records[i+1:], records[i:])
+		records[i] = record
+	}
+
+	if blockKey != nil && !bytes.Equal(blockKey, records[0].key) {
+		if err := b.bucket.Delete(blockKey); err != nil {
+			return err
+		}
+	}
+	if len(records) > frontCodingBlockSize {
+		half := len(records) / 2
+		if err := b.bucket.Put(records[half].key, encodeFrontCodedBlock(records[half:])); err != nil {
+			return err
+		}
+		records = records[:half]
+	}
+	return b.bucket.Put(records[0].key, encodeFrontCodedBlock(records))
+}
+
+// Delete removes the record from the block the key falls into
+func (b frontCodedBucket) Delete(key []byte) error {
+	blockKey, records, err := b.block(key)
+	if err != nil || blockKey == nil {
+		return err
+	}
+	i, found := searchRecords(records, key)
+	if !found {
+		return nil
+	}
+	records = append(records[:i], records[i+1:]...)
+	if len(records) == 0 || !bytes.Equal(blockKey, records[0].key) {
+		if err := b.bucket.Delete(blockKey); err != nil {
+			return err
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return b.bucket.Put(records[0].key, encodeFrontCodedBlock(records))
+}
+
+// ForEach calls fn on each record in key order
+func (b frontCodedBucket) ForEach(fn func([]byte, []byte) error) error {
+	return b.ForEachFrom(nil, fn)
+}
+
+// ForEachFrom calls fn on each record whose key is not less than start
+func (b frontCodedBucket) ForEachFrom(start []byte, fn func([]byte, []byte) error) error {
+	c := b.bucket.Cursor()
+	k, v := c.Seek(start)
+	if k == nil || !bytes.Equal(k, start) {
+		// the block before may hold keys not less than start
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		if k == nil {
+			k, v = c.First()
+		}
+	}
+	for ; k != nil; k, v = c.Next() {
+		records, err := decodeFrontCodedBlock(v)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			if bytes.Compare(r.key, start) < 0 {
+				continue
+			}
+			if err := fn(r.key, r.value); err != nil {
+				if err == errStopIteration {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// wrapBucket returns the record level access to the bucket of the namespace
+func (b *boltDB) wrapBucket(namespace string, bucket *bolt.Bucket) kvBucket {
+	if bucket == nil {
+		return nil
+	}
+	for _, ns := range b.options.frontCodedNamespaces {
+		if ns == namespace {
+			return frontCodedBucket{bucket: bucket}
+		}
+	}
+	return plainBucket{bucket}
+}
+
+// block returns the key and records of the block the key falls into, which is the last block whose first key is not
+// greater than the key, or nil if there is none
+func (b frontCodedBucket) block(key []byte) ([]byte, []frontCodedRecord, error) {
+	c := b.bucket.Cursor()
+	k, v := c.Seek(key)
+	if k == nil {
+		k, v = c.Last()
+	} else if !bytes.Equal(k, key) {
+		k, v = c.Prev()
+	}
+	if k == nil || bytes.Compare(k, key) > 0 {
+		return nil, nil, nil
+	}
+	records, err := decodeFrontCodedBlock(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the cursor's key is only valid until the bucket is modified
+	return append([]byte(nil), k...), records, nil
+}
+
+// searchRecords returns the index where the key is or would be inserted, and whether the key is found
+func searchRecords(records []frontCodedRecord, key []byte) (int, bool) {
+	i := sort.Search(len(records), func(i int) bool {
+		return bytes.Compare(records[i].key, key) >= 0
+	})
+	return i, i < len(records) && bytes.Equal(records[i].key, key)
+}
+
+// encodeFrontCodedBlock encodes the sorted records as the value of a block
+func encodeFrontCodedBlock(records []frontCodedRecord) []byte {
+	var buf bytes.Buffer
+	n := make([]byte, binary.MaxVarintLen64)
+	var prev []byte
+	for _, r := range records {
+		shared := 0
+		for shared < len(prev) && shared < len(r.key) && prev[shared] == r.key[shared] {
+			shared++
+		}
+		buf.Write(n[:binary.PutUvarint(n, uint64(shared))])
+		buf.Write(n[:binary.PutUvarint(n, uint64(len(r.key)-shared))])
+		buf.Write(r.key[shared:])
+		buf.Write(n[:binary.PutUvarint(n, uint64(len(r.value)))])
+		buf.Write(r.value)
+		prev = r.key
+	}
+	return buf.Bytes()
+}
+
+// decodeFrontCodedBlock decodes the value of a block into copies of its records
+func decodeFrontCodedBlock(block []byte) ([]frontCodedRecord, error) {
+	var records []frontCodedRecord
+	var prev []byte
+	r := bytes.NewReader(block)
+	for r.Len() > 0 {
+		shared, err := binary.ReadUvarint(r)
+		if err != nil || shared > uint64(len(prev)) {
+			return nil, errors.Wrap(ErrInvalidDB, "malformed front-coded block")
+		}
+		suffix, err := readFrontCodedBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readFrontCodedBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		key := make([]byte, 0, int(shared)+len(suffix))
+		key = append(append(key, prev[:shared]...), suffix...)
+		records = append(records, frontCodedRecord{key: key, value: value})
+		prev = key
+	}
+	return records, nil
+}
+
+// readFrontCodedBytes reads a length-prefixed byte slice
+func readFrontCodedBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return nil, errors.Wrap(ErrInvalidDB, "malformed front-coded block")
+	}
+	b := make([]byte, n)
+	if _, err := r.Read(b); err != nil && n > 0 {
+		return nil, errors.Wrap(ErrInvalidDB, "malformed front-coded block")
+	}
+	return b, nil
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestFrontCoding(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	dbCfg := cfg
+	path := "test-front-coding.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+
+	kvStore := NewOnDiskDB(dbCfg, WithFrontCoding(bucket1))
+	require.NoError(kvStore.Start(ctx))
+
+	// insert in random order, so that blocks are split and re-keyed in all positions
+	expected := make(map[string][]byte)
+	var keys []string
+	for i := 0; i < 200; i++ {
+		keys = append(keys, fmt.Sprintf("common/prefix/of/key_%03d", i))
+	}
+	for _, i := range rand.Perm(len(keys)) {
+		expected[keys[i]] = []byte(fmt.Sprintf("value_%d", i))
+		require.NoError(kvStore.Put(bucket1, []byte(keys[i]), expected[keys[i]]))
+	}
+	// a key before all others, an overwrite, and deletes of the first, a middle and the last key
+	keys = append([]string{"a"}, keys...)
+	expected["a"] = testV1[0]
+	require.NoError(kvStore.Put(bucket1, []byte("a"), testV1[0]))
+	expected[keys[100]] = testV1[1]
+	require.NoError(kvStore.Put(bucket1, []byte(keys[100]), testV1[1]))
+	var deleted []string
+	for _, i := range []int{len(keys) - 1, 50, 1} {
+		deleted = append(deleted, keys[i])
+		delete(expected, keys[i])
+		require.NoError(kvStore.Delete(bucket1, []byte(keys[i])))
+		keys = append(keys[:i], keys[i+1:]...)
+	}
+	require.NoError(kvStore.Delete(bucket1, []byte("not_existing")))
+	// an empty value is kept as such
+	expected[keys[10]] = []byte{}
+	require.NoError(kvStore.Put(bucket1, []byte(keys[10]), []byte{}))
+
+	check := func(kvStore KVStore) {
+		for key, value := range expected {
+			v, err := kvStore.Get(bucket1, []byte(key))
+			require.NoError(err)
+			require.Equal(value, v)
+		}
+		for _, key := range append(deleted, "0") {
+			_, err := kvStore.Get(bucket1, []byte(key))
+			require.Equal(ErrNotExist, errors.Cause(err))
+		}
+
+		var streamed []string
+		require.NoError(kvStore.(Streamer).StreamAll(bucket1, func(k, v []byte) error {
+			require.Equal(expected[string(k)], v)
+			streamed = append(streamed, string(k))
+			return nil
+		}))
+		require.True(sort.StringsAreSorted(streamed))
+		require.Equal(keys, streamed)
+
+		var paged []string
+		var after []byte
+		for {
+			page, cursor, err := kvStore.(KeyPager).KeysPaged(bucket1, after, 7)
+			require.NoError(err)
+			for _, key := range page {
+				paged = append(paged, string(key))
+			}
+			if cursor == nil {
+				break
+			}
+			after = cursor
+		}
+		require.Equal(keys, paged)
+	}
+	check(kvStore)
+
+	// the records are kept in far fewer blocks
+	blocks := 0
+	require.NoError(kvStore.(*boltDB).db.View(func(tx *bolt.Tx) error {
+		blocks = tx.Bucket([]byte(bucket1)).Stats().KeyN
+		return nil
+	}))
+	require.True(blocks*frontCodingBlockSize/2 <= len(keys)+frontCodingBlockSize)
+
+	// the records are re-encoded when swapped with a plain namespace
+	swapper := kvStore.(NamespaceSwapper)
+	require.NoError(kvStore.Put(bucket2, testK2[0], testV2[0]))
+	require.NoError(swapper.SwapNamespaces(bucket1, bucket2))
+	value, err := kvStore.Get(bucket1, testK2[0])
+	require.NoError(err)
+	require.Equal(testV2[0], value)
+	value, err = kvStore.Get(bucket2, []byte(keys[0]))
+	require.NoError(err)
+	require.Equal(expected[keys[0]], value)
+	require.NoError(swapper.SwapNamespaces(bucket1, bucket2))
+	require.NoError(kvStore.Stop(ctx))
+
+	// the records survive reopening
+	kvStore = NewOnDiskDB(dbCfg, WithFrontCoding(bucket1))
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	check(kvStore)
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+)
+
+// RangeGetter is the interface of KV store which is able to read part of a value, e.g. the header of a large value
+type RangeGetter interface {
+	// GetRange gets length bytes of the value of (namespace, key) from offset on. It returns ErrOutOfRange if the
+	// range is not within the value, and ErrNotExist if the key is missing
+	GetRange(string, []byte, int, int) ([]byte, error)
+}
+
+// GetRange copies the range out of the memory-mapped value, leaving the rest of it unread
+func (b *boltDB) GetRange(namespace string, key []byte, offset, length int) ([]byte, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	var value []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := b.wrapBucket(namespace, tx.Bucket([]byte(namespace)))
+		if bucket == nil {
+			return bolt.ErrBucketNotFound
+		}
+		v := bucket.Get(key)
+		if v == nil {
+			return errors.Wrapf(ErrNotExist, "key = %x", key)
+		}
+		if err := checkRange(v, offset, length); err != nil {
+			return err
+		}
+		// the value is only valid during the transaction
+		value = append([]byte{}, v[offset:offset+length]...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// GetRange copies the range out of the value read within the transaction
+func (b *badgerDB) GetRange(namespace string, key []byte, offset, length int) ([]byte, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	var value []byte
+	err := b.db.View(func(txn *badger.Txn) error {
+		k := append([]byte(namespace), key...)
+		item, err := txn.Get(k)
+		if err == badger.ErrKeyNotFound {
+			return errors.Wrapf(ErrNotExist, "key = %x", k)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to get key = %x", k)
+		}
+		// the value is only valid during the transaction
+		v, err := item.Value()
+		if err != nil {
+			return errors.Wrapf(err, "failed to get value from key = %x", k)
+		}
+		if err := checkRange(v, offset, length); err != nil {
+			return err
+		}
+		value = append([]byte{}, v[offset:offset+length]...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// GetRange copies the range out of the value
+func (m *memKVStore) GetRange(namespace string, key []byte, offset, length int) ([]byte, error) {
+	shard := m.shard(namespace, key)
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+
+	// a record of nil value is reported as not existing
+	v := shard.bucket[namespace][string(key)]
+	if v == nil {
+		return nil, errors.Wrapf(ErrNotExist, "key = %x", key)
+	}
+	if err := checkRange(v, offset, length); err != nil {
+		return nil, err
+	}
+	return append([]byte{}, v[offset:offset+length]...), nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// checkRange returns ErrOutOfRange if the range of length bytes from offset on is not within the value
+func checkRange(value []byte, offset, length int) error {
+	if offset < 0 || length < 0 || offset > len(value) || length > len(value)-offset {
+		return errors.Wrapf(ErrOutOfRange, "offset %d and length %d for value of %d bytes", offset, length, len(value))
+	}
+	return nil
+}
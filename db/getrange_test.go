@@ -0,0 +1,86 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestGetRange(t *testing.T) {
+	testGetRange := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		getter := kvStore.(RangeGetter)
+
+		value := []byte("tag:0123456789")
+		require.NoError(kvStore.Put(bucket1, testK1[0], value))
+		require.NoError(kvStore.Put(bucket1, testK1[1], []byte{}))
+
+		for _, c := range []struct {
+			offset, length int
+			expected       []byte
+		}{
+			{0, 4, []byte("tag:")},
+			{4, 10, []byte("0123456789")},
+			{13, 1, []byte("9")},
+			{0, len(value), value},
+			{5, 0, []byte{}},
+			{len(value), 0, []byte{}},
+		} {
+			v, err := getter.GetRange(bucket1, testK1[0], c.offset, c.length)
+			require.NoError(err)
+			require.Equal(c.expected, v)
+		}
+		v, err := getter.GetRange(bucket1, testK1[1], 0, 0)
+		require.NoError(err)
+		require.Equal([]byte{}, v)
+
+		// a range not within the value is rejected
+		for _, c := range [][2]int{{-1, 2}, {0, -1}, {0, len(value) + 1}, {10, 5}, {len(value) + 1, 0}} {
+			_, err := getter.GetRange(bucket1, testK1[0], c[0], c[1])
+			require.Equal(ErrOutOfRange, errors.Cause(err), "offset %d length %d", c[0], c[1])
+		}
+		_, err = getter.GetRange(bucket1, testK1[1], 0, 1)
+		require.Equal(ErrOutOfRange, errors.Cause(err))
+
+		// a missing key is not a range error
+		_, err = getter.GetRange(bucket1, testK1[2], 0, 0)
+		require.Equal(ErrNotExist, errors.Cause(err))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testGetRange(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-get-range.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testGetRange(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-get-range.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testGetRange(NewOnDiskDB(dbCfg), t)
+	})
+}
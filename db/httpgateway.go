@@ -0,0 +1,243 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/logger"
+)
+
+const (
+	// httpCountPath is the path under a namespace counting its keys, which is never the hex of a key
+	httpCountPath = "_count"
+	// httpDefaultLimit is the number of keys listed per page if the request does not set it
+	httpDefaultLimit = 100
+	// httpMaxLimit is the largest number of keys listed per page
+	httpMaxLimit = 1000
+)
+
+type (
+	// httpGateway is a read-only HTTP handler serving the records of a KV store
+	httpGateway struct {
+		kvStore KVStore
+	}
+
+	// httpRecord is the JSON encoding of a record, with the value in base64
+	httpRecord struct {
+		Key   string `json:"key"`
+		Value []byte `json:"value"`
+	}
+
+	// httpKeyPage is the JSON encoding of a page of keys, with the cursor to the next page, empty on the last one
+	httpKeyPage struct {
+		Keys []string `json:"keys"`
+		Next string   `json:"next,omitempty"`
+	}
+
+	// httpCount is the JSON encoding of the number of keys of a namespace
+	httpCount struct {
+		Count uint64 `json:"count"`
+	}
+)
+
+// NewReadOnlyHTTPHandler returns an HTTP handler serving the records of the KV store read-only, for inspecting them
+// with curl. GET /{namespace}/{hexkey} returns the value of the key, raw, or as a JSON object of the key and the value
+// in base64 if the request accepts application/json. GET /{namespace}?prefix={hexprefix}&limit={n} returns a JSON page
+// of up to n keys with the prefix in key order, and the cursor to pass as after={hexcursor} for the next page. GET
+// /{namespace}/_count returns the number of keys of the namespace as JSON. The keys are hex encoded, and a namespace
+// containing "/" is escaped as "%2F". Listing and counting the keys requires the KV store to implement KeyPager, and
+// counting walks all keys of the namespace. Any method other than GET and HEAD is rejected with 405, and a missing key
+// or namespace is 404
+func NewReadOnlyHTTPHandler(kvStore KVStore) http.Handler {
+	return &httpGateway{kvStore: kvStore}
+}
+
+// ServeHTTP serves a request
+func (g *httpGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "read-only KV store", http.StatusMethodNotAllowed)
+		return
+	}
+	// the escaped path is split, so that an escaped "/" within a namespace is kept
+	parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+	if len(parts) > 2 || parts[0] == "" {
+		http.Error(w, "path is not /{namespace} or /{namespace}/{hexkey}", http.StatusNotFound)
+		return
+	}
+	namespace, err := url.PathUnescape(parts[0])
+	if err != nil {
+		httpError(w, errors.Wrapf(ErrInvalidDB, "malformed namespace %s", parts[0]))
+		return
+	}
+	switch {
+	case len(parts) == 1:
+		g.serveKeys(w, r, namespace)
+	case parts[1] == httpCountPath:
+		g.serveCount(w, namespace)
+	default:
+		g.serveValue(w, r, namespace, parts[1])
+	}
+}
+
+//======================================
+// private functions
+//======================================
+
+// serveValue writes the value of the key
+func (g *httpGateway) serveValue(w http.ResponseWriter, r *http.Request, namespace, hexKey string) {
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		httpError(w, errors.Wrapf(ErrInvalidDB, "malformed key %s", hexKey))
+		return
+	}
+	value, err := g.kvStore.Get(namespace, key)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		httpJSON(w, httpRecord{Key: hexKey, Value: value})
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+	w.Write(value)
+}
+
+// serveKeys writes a page of the keys with the prefix of the request
+func (g *httpGateway) serveKeys(w http.ResponseWriter, r *http.Request, namespace string) {
+	pager, ok := g.pager(w, namespace)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	prefix, err := hex.DecodeString(query.Get("prefix"))
+	if err != nil {
+		httpError(w, errors.Wrapf(ErrInvalidDB, "malformed prefix %s", query.Get("prefix")))
+		return
+	}
+	after, err := hex.DecodeString(query.Get("after"))
+	if err != nil {
+		httpError(w, errors.Wrapf(ErrInvalidDB, "malformed cursor %s", query.Get("after")))
+		return
+	}
+	limit := httpDefaultLimit
+	if s := query.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 || limit > httpMaxLimit {
+			httpError(w, errors.Wrapf(ErrInvalidDB, "limit %s is not within [1, %d]", s, httpMaxLimit))
+			return
+		}
+	}
+
+	page := httpKeyPage{Keys: []string{}}
+	if bytes.Compare(after, prefix) < 0 {
+		// KeysPaged lists the keys after the cursor, so the key equal to the prefix is looked up on its own
+		after = prefix
+		if _, err := g.kvStore.Get(namespace, prefix); err == nil {
+			page.Keys = append(page.Keys, hex.EncodeToString(prefix))
+		} else if !isNotExist(err) {
+			httpError(w, err)
+			return
+		}
+	}
+	for len(page.Keys) < limit {
+		keys, cursor, err := pager.KeysPaged(namespace, after, limit-len(page.Keys))
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		for _, key := range keys {
+			if !bytes.HasPrefix(key, prefix) {
+				// the keys with the prefix are all listed
+				httpJSON(w, page)
+				return
+			}
+			page.Keys = append(page.Keys, hex.EncodeToString(key))
+			after = key
+		}
+		if cursor == nil {
+			httpJSON(w, page)
+			return
+		}
+	}
+	page.Next = hex.EncodeToString(after)
+	httpJSON(w, page)
+}
+
+// serveCount writes the number of keys of the namespace
+func (g *httpGateway) serveCount(w http.ResponseWriter, namespace string) {
+	pager, ok := g.pager(w, namespace)
+	if !ok {
+		return
+	}
+	var count uint64
+	var after []byte
+	for {
+		keys, cursor, err := pager.KeysPaged(namespace, after, httpMaxLimit)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		count += uint64(len(keys))
+		if cursor == nil {
+			break
+		}
+		after = cursor
+	}
+	httpJSON(w, httpCount{Count: count})
+}
+
+// pager returns the KV store as a KeyPager, or writes the error if it is not one or the namespace does not exist
+func (g *httpGateway) pager(w http.ResponseWriter, namespace string) (KeyPager, bool) {
+	pager, ok := g.kvStore.(KeyPager)
+	if !ok {
+		http.Error(w, "KV store is unable to list keys", http.StatusNotImplemented)
+		return nil, false
+	}
+	if manager, ok := g.kvStore.(NamespaceManager); ok {
+		exists, err := manager.HasNamespace(namespace)
+		if err != nil {
+			httpError(w, err)
+			return nil, false
+		}
+		if !exists {
+			httpError(w, errors.Wrapf(ErrNotExist, "namespace %s", namespace))
+			return nil, false
+		}
+	}
+	return pager, true
+}
+
+// httpJSON writes v as JSON
+func httpJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Warn().Err(err).Msg("Failed to write HTTP response.")
+	}
+}
+
+// httpError writes the error with the status of its cause
+func httpError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case isNotExist(err):
+		status = http.StatusNotFound
+	case errors.Cause(err) == ErrInvalidDB:
+		status = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestReadOnlyHTTPHandler(t *testing.T) {
+	testHandler := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		batch := NewBatch()
+		for _, key := range []string{"aa00", "aa01", "aa01ff", "aa02", "aa03", "bb00"} {
+			k, err := hex.DecodeString(key)
+			require.NoError(err)
+			require.NoError(batch.Put(bucket1, k, append([]byte("value-"), k...), ""))
+		}
+		require.NoError(kvStore.Commit(batch))
+		handler := NewReadOnlyHTTPHandler(kvStore)
+		serve := func(method, target, accept string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest(method, target, nil)
+			if accept != "" {
+				r.Header.Set("Accept", accept)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			return w
+		}
+
+		// a value is returned raw, or as JSON if accepted
+		w := serve(http.MethodGet, "/test_ns1/aa01ff", "")
+		require.Equal(http.StatusOK, w.Code)
+		require.Equal("application/octet-stream", w.Header().Get("Content-Type"))
+		require.Equal([]byte("value-\xaa\x01\xff"), w.Body.Bytes())
+		w = serve(http.MethodGet, "/test_ns1/aa01ff", "application/json")
+		require.Equal(http.StatusOK, w.Code)
+		var record httpRecord
+		require.NoError(json.Unmarshal(w.Body.Bytes(), &record))
+		require.Equal(httpRecord{Key: "aa01ff", Value: []byte("value-\xaa\x01\xff")}, record)
+
+		// the keys with the prefix are listed page by page
+		list := func(target string) httpKeyPage {
+			w := serve(http.MethodGet, target, "")
+			require.Equal(http.StatusOK, w.Code)
+			var page httpKeyPage
+			require.NoError(json.Unmarshal(w.Body.Bytes(), &page))
+			return page
+		}
+		require.Equal(httpKeyPage{Keys: []string{"aa01", "aa01ff"}}, list("/test_ns1?prefix=aa01"))
+		page := list("/test_ns1?prefix=aa&limit=2")
+		require.Equal(httpKeyPage{Keys: []string{"aa00", "aa01"}, Next: "aa01"}, page)
+		page = list("/test_ns1?prefix=aa&limit=2&after=" + page.Next)
+		require.Equal(httpKeyPage{Keys: []string{"aa01ff", "aa02"}, Next: "aa02"}, page)
+		page = list("/test_ns1?prefix=aa&limit=2&after=" + page.Next)
+		require.Equal(httpKeyPage{Keys: []string{"aa03"}}, page)
+		require.Equal(httpKeyPage{Keys: []string{"aa00", "aa01", "aa01ff", "aa02", "aa03", "bb00"}}, list("/test_ns1"))
+		require.Equal(httpKeyPage{Keys: []string{}}, list("/test_ns1?prefix=cc"))
+
+		// the keys are counted
+		w = serve(http.MethodGet, "/test_ns1/_count", "")
+		require.Equal(http.StatusOK, w.Code)
+		require.JSONEq(`{"count": 6}`, w.Body.String())
+
+		// a missing key or namespace is not found, and a malformed request is rejected
+		require.Equal(http.StatusNotFound, serve(http.MethodGet, "/test_ns1/cc00", "").Code)
+		require.Equal(http.StatusNotFound, serve(http.MethodGet, "/missing/aa00", "").Code)
+		require.Equal(http.StatusNotFound, serve(http.MethodGet, "/missing", "").Code)
+		require.Equal(http.StatusNotFound, serve(http.MethodGet, "/missing/_count", "").Code)
+		require.Equal(http.StatusBadRequest, serve(http.MethodGet, "/test_ns1/xyz", "").Code)
+		require.Equal(http.StatusBadRequest, serve(http.MethodGet, "/test_ns1?limit=0", "").Code)
+
+		// a write is not allowed, and writes nothing
+		for _, method := range []string{http.MethodPut, http.MethodPost, http.MethodDelete, http.MethodPatch} {
+			w := serve(method, "/test_ns1/aa00", "")
+			require.Equal(http.StatusMethodNotAllowed, w.Code)
+			require.Equal("GET, HEAD", w.Header().Get("Allow"))
+		}
+		value, err := kvStore.Get(bucket1, []byte{0xaa, 0x00})
+		require.NoError(err)
+		require.Equal([]byte("value-\xaa\x00"), value)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testHandler(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-http.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testHandler(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-http.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testHandler(NewOnDiskDB(dbCfg), t)
+	})
+}
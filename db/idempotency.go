@@ -0,0 +1,152 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// idempotencyNamespace is the namespace keeping the idempotency keys of the batches committed, each with the time it
+// is committed at
+const idempotencyNamespace = "idempotencyKeys"
+
+// idempotencyPageSize is the number of idempotency keys listed at a time to trim them
+const idempotencyPageSize = 1024
+
+// IdempotentCommitter is the interface of KV store which is able to commit a batch at most once per idempotency key,
+// so that a commit retried after an unknown outcome, e.g. a timeout of a remote caller, is never applied twice, even if
+// the batch is not idempotent itself, such as one with AddCounter or PutIfNotExists
+type IdempotentCommitter interface {
+	// CommitIdempotent commits the batch along with its idempotency key in the reserved namespace "idempotencyKeys",
+	// in the same commit, and returns true. If the key is committed already, it commits nothing and returns false. The
+	// batch is cleared either way, as by Commit
+	CommitIdempotent(KVStoreBatch, []byte) (bool, error)
+	// TrimIdempotencyKeys deletes the idempotency keys committed before the time, and returns the number deleted. A
+	// batch retried with a key trimmed is applied again, so the keys must be kept for longer than a retry may take
+	TrimIdempotencyKeys(time.Time) (int, error)
+}
+
+// CommitIdempotent commits the batch and its idempotency key in one transaction of BoltDB
+func (b *boltDB) CommitIdempotent(batch KVStoreBatch, idempotencyKey []byte) (bool, error) {
+	return commitIdempotent(b, b.options, batch, idempotencyKey)
+}
+
+// TrimIdempotencyKeys deletes the idempotency keys committed to BoltDB before the time
+func (b *boltDB) TrimIdempotencyKeys(before time.Time) (int, error) {
+	return trimIdempotencyKeys(b, b, before)
+}
+
+// CommitIdempotent commits the batch and its idempotency key in one transaction of BadgerDB
+func (b *badgerDB) CommitIdempotent(batch KVStoreBatch, idempotencyKey []byte) (bool, error) {
+	return commitIdempotent(b, b.options, batch, idempotencyKey)
+}
+
+// TrimIdempotencyKeys deletes the idempotency keys committed to BadgerDB before the time
+func (b *badgerDB) TrimIdempotencyKeys(before time.Time) (int, error) {
+	return trimIdempotencyKeys(b, b, before)
+}
+
+// CommitIdempotent commits the batch and its idempotency key to the in-memory KV store at once
+func (m *memKVStore) CommitIdempotent(batch KVStoreBatch, idempotencyKey []byte) (bool, error) {
+	return commitIdempotent(m, m.options, batch, idempotencyKey)
+}
+
+// TrimIdempotencyKeys deletes the idempotency keys committed to the in-memory KV store before the time
+func (m *memKVStore) TrimIdempotencyKeys(before time.Time) (int, error) {
+	return trimIdempotencyKeys(m, m, before)
+}
+
+//======================================
+// private functions
+//======================================
+
+// commitIdempotent commits a copy of the batch with the idempotency key put if not existing, so that the commit fails
+// as a whole with ErrAlreadyExist if the key is committed already, and clears the batch once it is committed either
+// now or before
+func commitIdempotent(kvStore KVStore, options kvStoreOptions, batch KVStoreBatch, key []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, errors.Wrap(ErrInvalidDB, "idempotency key is empty")
+	}
+	batch.Lock()
+	committed := batch.committed()
+	batch.Unlock()
+	if committed {
+		return false, ErrBatchAlreadyCommitted
+	}
+	if manager, ok := kvStore.(NamespaceManager); ok && options.explicitNamespaces {
+		if err := manager.CreateNamespace(idempotencyNamespace); err != nil {
+			return false, err
+		}
+	}
+
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(options.clk.Now().UnixNano()))
+	withKey := NewBatch()
+	if err := withKey.PutIfNotExists(idempotencyNamespace, key, value,
+		"idempotency key = %x is committed already", key); err != nil {
+		return false, err
+	}
+	if err := withKey.Merge(batch); err != nil {
+		return false, err
+	}
+	err := kvStore.Commit(withKey)
+	applied := err == nil
+	if errors.Cause(err) == ErrAlreadyExist {
+		// the error may be of a PutIfNotExists of the batch rather than of the idempotency key
+		if _, getErr := kvStore.Get(idempotencyNamespace, key); getErr == nil {
+			err = nil
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	batch.Lock()
+	batch.ClearAndUnlock()
+	return applied, nil
+}
+
+// trimIdempotencyKeys deletes the idempotency keys listed by the pager committed before the time, a page at a time
+func trimIdempotencyKeys(kvStore KVStore, pager KeyPager, before time.Time) (int, error) {
+	trimmed := 0
+	after := []byte{}
+	for after != nil {
+		keys, next, err := pager.KeysPaged(idempotencyNamespace, after, idempotencyPageSize)
+		if isNotExist(err) {
+			break
+		}
+		if err != nil {
+			return trimmed, errors.Wrap(err, "failed to list idempotency keys")
+		}
+		batch := NewBatch()
+		for _, key := range keys {
+			value, err := kvStore.Get(idempotencyNamespace, key)
+			if isNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return trimmed, errors.Wrapf(err, "failed to get idempotency key = %x", key)
+			}
+			if len(value) != 8 {
+				return trimmed, errors.Wrapf(ErrInvalidDB, "malformed time of idempotency key = %x", key)
+			}
+			if time.Unix(0, int64(binary.BigEndian.Uint64(value))).Before(before) {
+				batch.Delete(idempotencyNamespace, key, "failed to trim idempotency key = %x", key)
+			}
+		}
+		if size := batch.Size(); size > 0 {
+			if err := kvStore.Commit(batch); err != nil {
+				return trimmed, err
+			}
+			trimmed += size
+		}
+		after = next
+	}
+	return trimmed, nil
+}
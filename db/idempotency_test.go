@@ -0,0 +1,109 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestCommitIdempotent(t *testing.T) {
+	testIdempotent := func(newKVStore func(...KVStoreOption) KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		clk := clock.NewMock()
+		kvStore := newKVStore(WithClock(clk))
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		committer := kvStore.(IdempotentCommitter)
+		counter := func() uint64 {
+			value, err := kvStore.Get(bucket1, testK1[0])
+			require.NoError(err)
+			return binary.BigEndian.Uint64(value)
+		}
+		newBatch := func() KVStoreBatch {
+			batch := NewBatch()
+			require.NoError(batch.AddCounter(bucket1, testK1[0], 1))
+			return batch
+		}
+
+		// a batch retried with the same key is applied once
+		batch := newBatch()
+		applied, err := committer.CommitIdempotent(batch, []byte("request-1"))
+		require.NoError(err)
+		require.True(applied)
+		require.Equal(0, batch.Size())
+		require.Equal(uint64(1), counter())
+		applied, err = committer.CommitIdempotent(newBatch(), []byte("request-1"))
+		require.NoError(err)
+		require.False(applied)
+		require.Equal(uint64(1), counter())
+		_, err = committer.CommitIdempotent(batch, []byte("request-1"))
+		require.Equal(ErrBatchAlreadyCommitted, errors.Cause(err))
+
+		// a different key applies the batch again
+		clk.Add(time.Hour)
+		applied, err = committer.CommitIdempotent(newBatch(), []byte("request-2"))
+		require.NoError(err)
+		require.True(applied)
+		require.Equal(uint64(2), counter())
+
+		// a batch failing on its own commits neither its records nor its key
+		batch = newBatch()
+		require.NoError(batch.PutIfNotExists(bucket1, testK1[0], testV1[0], ""))
+		_, err = committer.CommitIdempotent(batch, []byte("request-3"))
+		require.Equal(ErrAlreadyExist, errors.Cause(err))
+		require.Equal(2, batch.Size())
+		require.Equal(uint64(2), counter())
+		_, err = kvStore.Get(idempotencyNamespace, []byte("request-3"))
+		require.True(isNotExist(err))
+
+		// the keys committed before the time are trimmed, and their batches may be applied again
+		trimmed, err := committer.TrimIdempotencyKeys(clk.Now())
+		require.NoError(err)
+		require.Equal(1, trimmed)
+		applied, err = committer.CommitIdempotent(newBatch(), []byte("request-1"))
+		require.NoError(err)
+		require.True(applied)
+		applied, err = committer.CommitIdempotent(newBatch(), []byte("request-2"))
+		require.NoError(err)
+		require.False(applied)
+		require.Equal(uint64(3), counter())
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testIdempotent(NewMemKVStore, t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-idempotent.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testIdempotent(func(opts ...KVStoreOption) KVStore { return NewOnDiskDB(dbCfg, opts...) }, t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-idempotent.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testIdempotent(func(opts ...KVStoreOption) KVStore { return NewOnDiskDB(dbCfg, opts...) }, t)
+	})
+}
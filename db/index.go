@@ -0,0 +1,186 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/pkg/enc"
+	"github.com/iotexproject/iotex-core/pkg/util/byteutil"
+)
+
+// IndexExtractor extracts the index key from a record of the primary namespace. A nil index key means the record
+// is not indexed
+type IndexExtractor func(key, value []byte) []byte
+
+// Index maintains a secondary index namespace of a primary namespace. Each index key maps to the list of primary
+// keys of the records having that index key. Records must be written through the Index so that the primary
+// namespace and the index namespace are always updated together in one atomic batch
+type Index struct {
+	mutex          sync.Mutex
+	kvStore        KVStore
+	namespace      string
+	indexNamespace string
+	extract        IndexExtractor
+}
+
+// NewIndex creates an index of the primary namespace, which is stored in the index namespace
+func NewIndex(kvStore KVStore, namespace, indexNamespace string, extract IndexExtractor) *Index {
+	return &Index{
+		kvStore:        kvStore,
+		namespace:      namespace,
+		indexNamespace: indexNamespace,
+		extract:        extract,
+	}
+}
+
+// Put inserts or updates a record of the primary namespace, and its index entry
+func (idx *Index) Put(key, value []byte) error {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	oldIndexKey, err := idx.indexKeyOf(key)
+	if err != nil {
+		return err
+	}
+	newIndexKey := idx.extract(key, value)
+	batch := NewBatch()
+	// an empty index key is a valid key, only a nil index key means the record is not indexed
+	if (oldIndexKey == nil) != (newIndexKey == nil) || !bytes.Equal(oldIndexKey, newIndexKey) {
+		if err := idx.removeFromIndex(batch, oldIndexKey, key); err != nil {
+			return err
+		}
+		if err := idx.addToIndex(batch, newIndexKey, key); err != nil {
+			return err
+		}
+	}
+	batch.Put(idx.namespace, key, value, "failed to put key %x", key)
+	return idx.kvStore.Commit(batch)
+}
+
+// Get retrieves a record of the primary namespace
+func (idx *Index) Get(key []byte) ([]byte, error) {
+	return idx.kvStore.Get(idx.namespace, key)
+}
+
+// Delete deletes a record of the primary namespace, and its index entry
+func (idx *Index) Delete(key []byte) error {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	indexKey, err := idx.indexKeyOf(key)
+	if err != nil {
+		return err
+	}
+	batch := NewBatch()
+	if err := idx.removeFromIndex(batch, indexKey, key); err != nil {
+		return err
+	}
+	batch.Delete(idx.namespace, key, "failed to delete key %x", key)
+	return idx.kvStore.Commit(batch)
+}
+
+// LookupByIndex returns the primary keys of the records having the index key
+func (idx *Index) LookupByIndex(indexKey []byte) ([][]byte, error) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	return idx.primaryKeys(indexKey)
+}
+
+//======================================
+// private functions
+//======================================
+
+// indexKeyOf returns the index key of the existing record, or nil if the record doesn't exist
+func (idx *Index) indexKeyOf(key []byte) ([]byte, error) {
+	value, err := idx.kvStore.Get(idx.namespace, key)
+	if isNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get key %x", key)
+	}
+	return idx.extract(key, value), nil
+}
+
+func (idx *Index) primaryKeys(indexKey []byte) ([][]byte, error) {
+	value, err := idx.kvStore.Get(idx.indexNamespace, indexKey)
+	if isNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get index key %x", indexKey)
+	}
+	return decodeKeyList(value)
+}
+
+func (idx *Index) addToIndex(batch KVStoreBatch, indexKey, key []byte) error {
+	if indexKey == nil {
+		return nil
+	}
+	keys, err := idx.primaryKeys(indexKey)
+	if err != nil {
+		return err
+	}
+	keys = append(keys, key)
+	batch.Put(idx.indexNamespace, indexKey, encodeKeyList(keys), "failed to put index key %x", indexKey)
+	return nil
+}
+
+func (idx *Index) removeFromIndex(batch KVStoreBatch, indexKey, key []byte) error {
+	if indexKey == nil {
+		return nil
+	}
+	keys, err := idx.primaryKeys(indexKey)
+	if err != nil {
+		return err
+	}
+	for i, k := range keys {
+		if bytes.Equal(k, key) {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	if len(keys) == 0 {
+		batch.Delete(idx.indexNamespace, indexKey, "failed to delete index key %x", indexKey)
+		return nil
+	}
+	batch.Put(idx.indexNamespace, indexKey, encodeKeyList(keys), "failed to put index key %x", indexKey)
+	return nil
+}
+
+// encodeKeyList serializes a list of keys, each prefixed by its 4-byte length
+func encodeKeyList(keys [][]byte) []byte {
+	var buf bytes.Buffer
+	for _, k := range keys {
+		buf.Write(byteutil.Uint32ToBytes(uint32(len(k))))
+		buf.Write(k)
+	}
+	return buf.Bytes()
+}
+
+// decodeKeyList deserializes a list of keys serialized by encodeKeyList
+func decodeKeyList(data []byte) ([][]byte, error) {
+	var keys [][]byte
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errors.Wrap(ErrInvalidDB, "corrupted key list")
+		}
+		size := enc.MachineEndian.Uint32(data[:4])
+		data = data[4:]
+		if uint32(len(data)) < size {
+			return nil, errors.Wrap(ErrInvalidDB, "corrupted key list")
+		}
+		keys = append(keys, data[:size])
+		data = data[size:]
+	}
+	return keys, nil
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestIndex(t *testing.T) {
+	testIndex := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+
+		// index records by the first byte of value
+		idx := NewIndex(kvStore, bucket1, bucket2, func(key, value []byte) []byte {
+			return value[:1]
+		})
+
+		// insert
+		require.NoError(idx.Put(testK1[0], []byte("a1")))
+		require.NoError(idx.Put(testK1[1], []byte("a2")))
+		require.NoError(idx.Put(testK1[2], []byte("b1")))
+		keys, err := idx.LookupByIndex([]byte("a"))
+		require.NoError(err)
+		require.Equal([][]byte{testK1[0], testK1[1]}, keys)
+		keys, err = idx.LookupByIndex([]byte("b"))
+		require.NoError(err)
+		require.Equal([][]byte{testK1[2]}, keys)
+		value, err := idx.Get(testK1[2])
+		require.NoError(err)
+		require.Equal([]byte("b1"), value)
+
+		// update without changing the index key
+		require.NoError(idx.Put(testK1[0], []byte("a3")))
+		keys, err = idx.LookupByIndex([]byte("a"))
+		require.NoError(err)
+		require.Equal([][]byte{testK1[0], testK1[1]}, keys)
+
+		// update changing the index key
+		require.NoError(idx.Put(testK1[0], []byte("b2")))
+		keys, err = idx.LookupByIndex([]byte("a"))
+		require.NoError(err)
+		require.Equal([][]byte{testK1[1]}, keys)
+		keys, err = idx.LookupByIndex([]byte("b"))
+		require.NoError(err)
+		require.Equal([][]byte{testK1[2], testK1[0]}, keys)
+
+		// delete
+		require.NoError(idx.Delete(testK1[1]))
+		keys, err = idx.LookupByIndex([]byte("a"))
+		require.NoError(err)
+		require.Empty(keys)
+		_, err = kvStore.Get(bucket2, []byte("a"))
+		require.Error(err)
+		_, err = idx.Get(testK1[1])
+		require.Error(err)
+		require.NoError(idx.Delete(testK1[0]))
+		keys, err = idx.LookupByIndex([]byte("b"))
+		require.NoError(err)
+		require.Equal([][]byte{testK1[2]}, keys)
+
+		// delete a non-existing record is OK
+		require.NoError(idx.Delete(testK2[0]))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testIndex(NewMemKVStore(), t)
+	})
+
+	path := "test-index.bolt"
+	cfg.DbPath = path
+	cfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testIndex(NewOnDiskDB(cfg), t)
+	})
+
+	path = "test-index.badger"
+	cfg.DbPath = path
+	cfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testIndex(NewOnDiskDB(cfg), t)
+	})
+}
+
+func TestIndexEmptyIndexKey(t *testing.T) {
+	testEmptyIndexKey := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+
+		idx := NewIndex(kvStore, bucket1, bucket2, func(key, value []byte) []byte {
+			return []byte{}
+		})
+		require.NoError(idx.Put(testK1[0], testV1[0]))
+		keys, err := idx.LookupByIndex([]byte{})
+		require.NoError(err)
+		require.Equal([][]byte{testK1[0]}, keys)
+		require.NoError(idx.Delete(testK1[0]))
+		keys, err = idx.LookupByIndex([]byte{})
+		require.NoError(err)
+		require.Empty(keys)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testEmptyIndexKey(NewMemKVStore(), t)
+	})
+
+	// BoltDB does not allow empty keys
+	path := "test-index-empty.badger"
+	cfg.DbPath = path
+	cfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testEmptyIndexKey(NewOnDiskDB(cfg), t)
+	})
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+)
+
+// SortedIngester is the interface of KV store which is able to load records already sorted by key faster than in
+// arbitrary order, such as at genesis or an import from a sorted dump
+type SortedIngester interface {
+	// IngestSorted puts the records received from the channel into the namespace until it is closed. The keys must be
+	// in strictly ascending order, and the first key out of order fails the ingestion with ErrInvalidDB, after the
+	// records before it are loaded. The channel is drained until closed even if the ingestion fails, so the sender is
+	// never blocked. As with BulkLoader, the records are durable only once IngestSorted returns nil, and a failed
+	// ingestion must start over from an empty namespace
+	IngestSorted(string, <-chan KeyValue) error
+}
+
+// IngestSorted appends the records to the bucket in chunks of a single Update each with fsync off, filling up the
+// pages rather than splitting them half full, since no record is ever inserted before those put already
+func (b *boltDB) IngestSorted(namespace string, sorted <-chan KeyValue) error {
+	return ingestSorted(&boltBulkLoader{db: b, sorted: true}, namespace, sorted)
+}
+
+// IngestSorted loads the records as the bulk loader of BadgerDB does. BadgerDB of this version has no stream writer
+// to build the tables from sorted records directly, but the memtables are written to the tables in key order anyway
+func (b *badgerDB) IngestSorted(namespace string, sorted <-chan KeyValue) error {
+	return ingestSorted(NewBulkLoader(b), namespace, sorted)
+}
+
+// IngestSorted loads the records in regular batches, as the in-memory KV store keeps no order to benefit from
+func (m *memKVStore) IngestSorted(namespace string, sorted <-chan KeyValue) error {
+	return ingestSorted(NewBulkLoader(m), namespace, sorted)
+}
+
+//======================================
+// private functions
+//======================================
+
+// ingestSorted adds the records to the loader while their keys are in ascending order, and finishes the load
+func ingestSorted(loader BulkLoader, namespace string, sorted <-chan KeyValue) error {
+	var last []byte
+	first := true
+	for record := range sorted {
+		if !first && bytes.Compare(record.Key, last) <= 0 {
+			for range sorted {
+			}
+			if err := loader.Finish(); err != nil {
+				return err
+			}
+			return errors.Wrapf(ErrInvalidDB, "key = %x is not after key = %x", record.Key, last)
+		}
+		loader.Add(namespace, record.Key, record.Value)
+		last, first = record.Key, false
+	}
+	return loader.Finish()
+}
+
+// fillUp makes BoltDB fill the pages of the bucket up before splitting them
+func fillUp(bucket kvBucket) {
+	switch b := bucket.(type) {
+	case plainBucket:
+		b.FillPercent = 1.0
+	case frontCodedBucket:
+		b.bucket.FillPercent = 1.0
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+// sortedRecords sends the records of the keys to the channel returned, and closes it once they are all sent
+func sortedRecords(keys []string, value []byte) <-chan KeyValue {
+	sorted := make(chan KeyValue)
+	go func() {
+		defer close(sorted)
+		for _, key := range keys {
+			sorted <- KeyValue{Key: []byte(key), Value: value}
+		}
+	}()
+	return sorted
+}
+
+func TestIngestSorted(t *testing.T) {
+	// enough records for more than one chunk of BoltDB and more than one transaction of BadgerDB
+	const numRecords = 1 << 17
+	value := make([]byte, 128)
+	keys := make([]string, numRecords)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key_%06d", i)
+	}
+
+	testIngest := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		ingester := kvStore.(SortedIngester)
+
+		require.NoError(ingester.IngestSorted(bucket1, sortedRecords(keys, value)))
+		for _, i := range []int{0, 1, numRecords / 2, numRecords - 1} {
+			v, err := kvStore.Get(bucket1, []byte(keys[i]))
+			require.NoError(err)
+			require.Equal(value, v)
+		}
+		listed, _, err := kvStore.(KeyPager).KeysPaged(bucket1, nil, numRecords+1)
+		require.NoError(err)
+		require.Len(listed, numRecords)
+
+		// a key out of order or repeated fails the ingestion, and the rest of the channel is drained
+		for _, unsorted := range [][]string{{"a", "c", "b", "d"}, {"a", "b", "b", "d"}} {
+			err := ingester.IngestSorted(bucket2, sortedRecords(unsorted, value))
+			require.Equal(ErrInvalidDB, errors.Cause(err))
+		}
+		require.NoError(ingester.IngestSorted(bucket2, sortedRecords(nil, value)))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testIngest(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-ingest-sorted.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testIngest(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-ingest-sorted.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testIngest(NewOnDiskDB(dbCfg), t)
+	})
+}
+
+func BenchmarkIngestSorted(b *testing.B) {
+	benchmark := func(b *testing.B, useBadger, ingest bool) {
+		require := require.New(b)
+		ctx := context.Background()
+		dbCfg := cfg
+		dbCfg.DbPath = "bench-ingest-sorted.db"
+		dbCfg.UseBadgerDB = useBadger
+		require.NoError(os.RemoveAll(dbCfg.DbPath))
+		defer func() {
+			require.NoError(os.RemoveAll(dbCfg.DbPath))
+		}()
+
+		kvStore := NewOnDiskDB(dbCfg)
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		value := make([]byte, 256)
+		keys := make([]string, b.N)
+		for n := range keys {
+			keys[n] = fmt.Sprintf("key_%010d", n)
+		}
+		b.ResetTimer()
+		if ingest {
+			require.NoError(kvStore.(SortedIngester).IngestSorted(bucket1, sortedRecords(keys, value)))
+			return
+		}
+		loader := NewBulkLoader(kvStore)
+		for _, key := range keys {
+			loader.Add(bucket1, []byte(key), value)
+		}
+		require.NoError(loader.Finish())
+	}
+
+	for _, useBadger := range []bool{false, true} {
+		name := "Bolt"
+		if useBadger {
+			name = "Badger"
+		}
+		b.Run(name+"BulkLoader", func(b *testing.B) {
+			benchmark(b, useBadger, false)
+		})
+		b.Run(name+"IngestSorted", func(b *testing.B) {
+			benchmark(b, useBadger, true)
+		})
+	}
+}
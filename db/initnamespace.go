@@ -0,0 +1,139 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+)
+
+// emptyChecker is a transaction which is able to tell if a namespace has no record
+type emptyChecker interface {
+	isNamespaceEmpty(string) (bool, error)
+}
+
+// InitNamespaceIfEmpty populates the namespace in one transaction of BoltDB if it has no record
+func (b *boltDB) InitNamespaceIfEmpty(namespace string, fn func(KVStoreBatch) error) (bool, error) {
+	return initNamespaceIfEmpty(b, namespace, fn)
+}
+
+// InitNamespaceIfEmpty populates the namespace in one transaction of BadgerDB if it has no record
+func (b *badgerDB) InitNamespaceIfEmpty(namespace string, fn func(KVStoreBatch) error) (bool, error) {
+	return initNamespaceIfEmpty(b, namespace, fn)
+}
+
+// InitNamespaceIfEmpty populates the namespace with all shards of the in-memory KV store locked if it has no record
+func (m *memKVStore) InitNamespaceIfEmpty(namespace string, fn func(KVStoreBatch) error) (bool, error) {
+	return initNamespaceIfEmpty(m, namespace, fn)
+}
+
+//======================================
+// private functions
+//======================================
+
+// initNamespaceIfEmpty checks the namespace is empty and applies the batch staged by fn within a read-write
+// transaction of the KV store
+func initNamespaceIfEmpty(updater Updater, namespace string, fn func(KVStoreBatch) error) (bool, error) {
+	initialized := false
+	err := updater.Update(func(tx Tx) error {
+		empty, err := tx.(emptyChecker).isNamespaceEmpty(namespace)
+		if err != nil || !empty {
+			return err
+		}
+		batch := NewBatch()
+		if err := fn(batch); err != nil {
+			return err
+		}
+		batch.Lock()
+		defer batch.Unlock()
+		for i := 0; i < batch.Size(); i++ {
+			write, err := batch.Entry(i)
+			if err != nil {
+				return err
+			}
+			if err := applyToTx(tx, write); err != nil {
+				return errors.Wrapf(err, write.errorFormat, write.errorArgs)
+			}
+		}
+		initialized = true
+		return nil
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to initialize namespace %s", namespace)
+	}
+	return initialized, nil
+}
+
+// applyToTx applies the entry of a batch within the transaction
+func applyToTx(tx Tx, write *writeInfo) error {
+	switch write.writeType {
+	case Put:
+		return tx.Put(write.namespace, write.key, write.value)
+	case PutIfNotExists:
+		exists, err := tx.Has(write.namespace, write.key)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrAlreadyExist
+		}
+		return tx.Put(write.namespace, write.key, write.value)
+	case Delete:
+		return tx.Delete(write.namespace, write.key)
+	case AddCounter:
+		counter, err := tx.Get(write.namespace, write.key)
+		if err != nil && !isNotExist(err) {
+			return err
+		}
+		if counter, err = addToCounter(counter, write.value); err != nil {
+			return err
+		}
+		return tx.Put(write.namespace, write.key, counter)
+	}
+	return errors.Wrapf(ErrInvalidDB, "unknown write type %d", write.writeType)
+}
+
+// isNamespaceEmpty returns whether the namespace has no record, the shards being locked by Update
+func (t *memTx) isNamespaceEmpty(namespace string) (bool, error) {
+	for _, shard := range t.m.shards {
+		for _, v := range shard.bucket[namespace] {
+			// a record of nil value is reported as not existing
+			if v != nil {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// isNamespaceEmpty returns whether the bucket of the namespace has no record or does not exist
+func (t *boltTx) isNamespaceEmpty(namespace string) (bool, error) {
+	bucket := t.b.wrapBucket(namespace, t.tx.Bucket([]byte(namespace)))
+	if bucket == nil {
+		return true, nil
+	}
+	empty := true
+	err := bucket.ForEach(func([]byte, []byte) error {
+		empty = false
+		return errStopIteration
+	})
+	if err != nil && err != errStopIteration {
+		return false, err
+	}
+	return empty, nil
+}
+
+// isNamespaceEmpty returns whether no key is prefixed with the namespace
+func (t *badgerTx) isNamespaceEmpty(namespace string) (bool, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	it := t.txn.NewIterator(opts)
+	defer it.Close()
+	prefix := []byte(namespace)
+	it.Seek(prefix)
+	return !it.ValidForPrefix(prefix), nil
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestInitNamespaceIfEmpty(t *testing.T) {
+	testInitNamespace := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		initializer, ok := kvStore.(NamespaceInitializer)
+		require.True(ok)
+
+		// a failing initialization writes nothing
+		errInit := errors.New("failed to stage")
+		initialized, err := initializer.InitNamespaceIfEmpty(bucket1, func(batch KVStoreBatch) error {
+			batch.Put(bucket1, testK1[0], testV1[0], "")
+			return errInit
+		})
+		require.Equal(errInit, errors.Cause(err))
+		require.False(initialized)
+		_, err = kvStore.Get(bucket1, testK1[0])
+		require.True(isNotExist(err))
+
+		// exactly one of the racing callers initializes the namespace
+		const callers = 16
+		var wg sync.WaitGroup
+		var winners, calls int32
+		errs := make(chan error, callers)
+		for i := 0; i < callers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				initialized, err := initializer.InitNamespaceIfEmpty(bucket1, func(batch KVStoreBatch) error {
+					atomic.AddInt32(&calls, 1)
+					for j := 0; j < 10; j++ {
+						key := []byte(fmt.Sprintf("key_%d", j))
+						batch.Put(bucket1, key, []byte(fmt.Sprintf("value_%d_%d", i, j)), "")
+					}
+					return nil
+				})
+				if initialized {
+					atomic.AddInt32(&winners, 1)
+				}
+				errs <- err
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(err)
+		}
+		require.Equal(int32(1), winners)
+		require.Equal(int32(1), calls)
+
+		// the full initial state of the one caller is present
+		value, err := kvStore.Get(bucket1, []byte("key_0"))
+		require.NoError(err)
+		var winner int
+		_, err = fmt.Sscanf(string(value), "value_%d_0", &winner)
+		require.NoError(err)
+		for j := 0; j < 10; j++ {
+			value, err := kvStore.Get(bucket1, []byte(fmt.Sprintf("key_%d", j)))
+			require.NoError(err)
+			require.Equal([]byte(fmt.Sprintf("value_%d_%d", winner, j)), value)
+		}
+
+		// a namespace emptied again is initialized again
+		for j := 0; j < 10; j++ {
+			require.NoError(kvStore.Delete(bucket1, []byte(fmt.Sprintf("key_%d", j))))
+		}
+		initialized, err = initializer.InitNamespaceIfEmpty(bucket1, func(batch KVStoreBatch) error {
+			batch.Put(bucket1, testK1[0], testV1[0], "")
+			return nil
+		})
+		require.NoError(err)
+		require.True(initialized)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testInitNamespace(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-init-namespace.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testInitNamespace(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-init-namespace.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testInitNamespace(NewOnDiskDB(dbCfg), t)
+	})
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"encoding/binary"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+)
+
+// inspectLockTimeout is how long InspectDB waits for the lock of a BoltDB file another process has open for writing
+const inspectLockTimeout = time.Second
+
+// DBInfo is the metadata of a DB on disk, as read by InspectDB
+type DBInfo struct {
+	// Badger is whether the DB is a BadgerDB directory rather than a BoltDB file
+	Badger bool
+	// SchemaVersion is the schema version recorded by WithSchema, 0 if none is recorded
+	SchemaVersion uint32
+	// Namespaces is the namespaces of BoltDB in byte order, nil for BadgerDB, whose keys keep no boundary between the
+	// namespace and the key
+	Namespaces []string
+	// Sequences is the sequence of each namespace of BoltDB, as kept by the bucket of the namespace
+	Sequences map[string]uint64
+	// Size is the size of the BoltDB file, or of the tables and value logs of BadgerDB
+	Size int64
+}
+
+// InspectDB reads the metadata of the DB at the path without starting a KV store on it, for tooling such as a
+// monitoring script. The DB is opened read-only and closed before InspectDB returns: nothing is written, no schema is
+// upgraded, and BadgerDB neither truncates a corrupted value log nor runs the value log GC. The DB need not be closed
+// by its owner, but the read-only open still takes a shared lock. A BoltDB file open for writing by another process
+// fails the inspection with bolt.ErrTimeout after inspectLockTimeout, and BadgerDB fails to open read-only while
+// another process holds it or while its value log needs a replay after a crash
+func InspectDB(path string) (DBInfo, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return DBInfo{}, errors.Wrapf(err, "failed to stat DB %s", path)
+	}
+	if stat.IsDir() {
+		return inspectBadger(path)
+	}
+	return inspectBolt(path, stat.Size())
+}
+
+//======================================
+// private functions
+//======================================
+
+// inspectBolt reads the metadata of the BoltDB file within one read transaction
+func inspectBolt(path string, size int64) (DBInfo, error) {
+	db, err := bolt.Open(path, fileMode, &bolt.Options{ReadOnly: true, Timeout: inspectLockTimeout})
+	if err != nil {
+		return DBInfo{}, errors.Wrapf(err, "failed to open BoltDB %s read-only", path)
+	}
+	defer db.Close()
+
+	info := DBInfo{Sequences: make(map[string]uint64), Size: size}
+	if err := db.View(func(tx *bolt.Tx) error {
+		if err := tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			info.Namespaces = append(info.Namespaces, string(name))
+			info.Sequences[string(name)] = bucket.Sequence()
+			return nil
+		}); err != nil {
+			return err
+		}
+		if bucket := tx.Bucket([]byte(schemaNamespace)); bucket != nil {
+			info.SchemaVersion, err = decodeSchemaVersion(bucket.Get(schemaVersionKey))
+			return err
+		}
+		return nil
+	}); err != nil {
+		return DBInfo{}, err
+	}
+	return info, nil
+}
+
+// inspectBadger reads the schema version of the BadgerDB directory, and sums up the size of its files
+func inspectBadger(path string) (DBInfo, error) {
+	opts := badger.DefaultOptions
+	opts.Dir = path
+	opts.ValueDir = path
+	opts.ReadOnly = true
+	db, err := badger.Open(opts)
+	if err != nil {
+		return DBInfo{}, errors.Wrapf(err, "failed to open BadgerDB %s read-only", path)
+	}
+	defer db.Close()
+
+	info := DBInfo{Badger: true, Size: filesSize(path, "*.sst") + valueLogSize(path)}
+	if err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(append([]byte(schemaNamespace), schemaVersionKey...))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		value, err := item.Value()
+		if err != nil {
+			return err
+		}
+		info.SchemaVersion, err = decodeSchemaVersion(value)
+		return err
+	}); err != nil {
+		return DBInfo{}, err
+	}
+	return info, nil
+}
+
+// decodeSchemaVersion decodes the schema version recorded, 0 if none is recorded
+func decodeSchemaVersion(value []byte) (uint32, error) {
+	if value == nil {
+		return 0, nil
+	}
+	if len(value) != 4 {
+		return 0, errors.Wrap(ErrInvalidDB, "malformed schema version")
+	}
+	return binary.BigEndian.Uint32(value), nil
+}
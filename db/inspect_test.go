@@ -0,0 +1,71 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestInspectDB(t *testing.T) {
+	testInspect := func(path string, useBadger bool, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg := cfg
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = useBadger
+
+		_, err := InspectDB(path)
+		require.Error(err)
+
+		kvStore := NewOnDiskDB(dbCfg, WithSchema(3, nil))
+		require.NoError(kvStore.Start(ctx))
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		require.NoError(kvStore.Put(bucket2, testK2[0], testV2[0]))
+		if !useBadger {
+			require.NoError(kvStore.(*boltDB).db.Update(func(tx *bolt.Tx) error {
+				return tx.Bucket([]byte(bucket1)).SetSequence(7)
+			}))
+		}
+		require.NoError(kvStore.Stop(ctx))
+
+		info, err := InspectDB(path)
+		require.NoError(err)
+		require.Equal(useBadger, info.Badger)
+		require.Equal(uint32(3), info.SchemaVersion)
+		require.True(info.Size > 0)
+		if useBadger {
+			require.Nil(info.Namespaces)
+		} else {
+			require.Equal([]string{schemaNamespace, bucket1, bucket2}, info.Namespaces)
+			require.Equal(uint64(7), info.Sequences[bucket1])
+			require.Equal(uint64(0), info.Sequences[bucket2])
+		}
+
+		// the inspection leaves the DB as it is
+		require.NoError(kvStore.Start(ctx))
+		value, err := kvStore.Get(bucket2, testK2[0])
+		require.NoError(err)
+		require.Equal(testV2[0], value)
+		require.NoError(kvStore.Stop(ctx))
+	}
+
+	t.Run("Bolt DB", func(t *testing.T) {
+		testInspect("test-inspect.bolt", false, t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		testInspect("test-inspect.badger", true, t)
+	})
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// iteratePageSize is the number of keys listed at a time by IterateResumable
+const iteratePageSize = 256
+
+// IterateResumable calls fn on each record of the namespace after the key resumeFrom in key order, or on each record
+// if resumeFrom is empty, so that a long maintenance task over a whole namespace, e.g. a reindex or a verification, is
+// interruptible and resumes where it stopped rather than starting over. The last key processed is passed to
+// checkpoint, if not nil, every checkpointEvery records and once more when the iteration stops, so that a checkpoint
+// persisted by it resumes the next run without processing a record twice. The iteration stops once ctx is done, which
+// is checked before each record, or fn or checkpoint returns an error, which is returned along with the last key
+// processed, resumeFrom if none is. A record deleted while the namespace is iterated is skipped, and a record written
+// after the key processed last is processed if the iteration reaches it. The KV store must implement KeyPager
+func IterateResumable(
+	ctx context.Context,
+	kvStore KVStore,
+	namespace string,
+	resumeFrom []byte,
+	fn func(key, value []byte) error,
+	checkpoint func(key []byte) error,
+	checkpointEvery int,
+) ([]byte, error) {
+	pager, ok := kvStore.(KeyPager)
+	if !ok {
+		return resumeFrom, errors.Wrap(ErrInvalidDB, "KV store is unable to list keys in order")
+	}
+	if checkpointEvery <= 0 {
+		return resumeFrom, errors.Wrapf(ErrInvalidDB, "invalid checkpoint interval %d", checkpointEvery)
+	}
+
+	last, pending := resumeFrom, 0
+	err := func() error {
+		after := resumeFrom
+		if after == nil {
+			after = []byte{}
+		}
+		for after != nil {
+			keys, cursor, err := pager.KeysPaged(namespace, after, iteratePageSize)
+			if isNotExist(err) {
+				return nil
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed to list the keys of namespace %s", namespace)
+			}
+			for _, key := range keys {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				value, err := kvStore.Get(namespace, key)
+				if isNotExist(err) {
+					continue
+				}
+				if err != nil {
+					return errors.Wrapf(err, "failed to get key = %x", key)
+				}
+				if err := fn(key, value); err != nil {
+					return err
+				}
+				last = key
+				if pending++; pending < checkpointEvery || checkpoint == nil {
+					continue
+				}
+				pending = 0
+				if err := checkpoint(last); err != nil {
+					return err
+				}
+			}
+			after = cursor
+		}
+		return nil
+	}()
+	if pending > 0 && checkpoint != nil {
+		if checkpointErr := checkpoint(last); err == nil {
+			err = checkpointErr
+		}
+	}
+	return last, err
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestIterateResumable(t *testing.T) {
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key-%04d", i)) }
+
+	testIterate := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		batch := NewBatch()
+		for i := 0; i < 1000; i++ {
+			batch.Put(bucket1, key(i), testV1[i%3], "")
+		}
+		require.NoError(kvStore.Commit(batch))
+
+		processed := make(map[string]int)
+		var checkpoints [][]byte
+		process := func(k, v []byte) error {
+			processed[string(k)]++
+			return nil
+		}
+		saveCheckpoint := func(k []byte) error {
+			checkpoints = append(checkpoints, k)
+			return nil
+		}
+
+		// the first run is canceled after 400 records, and checkpoints every 64 records and where it stops
+		cancelCtx, cancel := context.WithCancel(ctx)
+		last, err := IterateResumable(cancelCtx, kvStore, bucket1, nil, func(k, v []byte) error {
+			require.NoError(process(k, v))
+			if len(processed) == 400 {
+				cancel()
+			}
+			return nil
+		}, saveCheckpoint, 64)
+		require.Equal(context.Canceled, errors.Cause(err))
+		require.Equal(key(399), last)
+		require.Len(checkpoints, 7)
+		require.Equal(key(63), checkpoints[0])
+		require.Equal(key(383), checkpoints[5])
+		require.Equal(last, checkpoints[6])
+
+		// the second run resumes from the checkpoint, and processes each record exactly once across both runs
+		last, err = IterateResumable(ctx, kvStore, bucket1, checkpoints[len(checkpoints)-1], process, saveCheckpoint, 64)
+		require.NoError(err)
+		require.Equal(key(999), last)
+		require.Equal(last, checkpoints[len(checkpoints)-1])
+		require.Len(processed, 1000)
+		for i := 0; i < 1000; i++ {
+			require.Equal(1, processed[string(key(i))])
+		}
+
+		// resuming from the last key, or iterating a namespace which does not exist, processes nothing
+		last, err = IterateResumable(ctx, kvStore, bucket1, key(999), process, nil, 64)
+		require.NoError(err)
+		require.Equal(key(999), last)
+		last, err = IterateResumable(ctx, kvStore, "test_ns3", nil, process, nil, 64)
+		require.NoError(err)
+		require.Nil(last)
+		require.Len(processed, 1000)
+
+		// an error of fn stops the iteration at the record before it
+		failure := errors.New("failed to process")
+		last, err = IterateResumable(ctx, kvStore, bucket1, key(9), func(k, v []byte) error {
+			if string(k) == string(key(20)) {
+				return failure
+			}
+			return nil
+		}, nil, 64)
+		require.Equal(failure, errors.Cause(err))
+		require.Equal(key(19), last)
+
+		_, err = IterateResumable(ctx, kvStore, bucket1, nil, process, nil, 0)
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testIterate(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-iterate-resumable.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testIterate(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-iterate-resumable.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testIterate(NewOnDiskDB(dbCfg), t)
+	})
+}
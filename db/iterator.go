@@ -0,0 +1,181 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"sort"
+
+	"github.com/boltdb/bolt"
+)
+
+type (
+	// sliceIterator iterates over records sorted by key
+	sliceIterator struct {
+		records []memRecord
+		current int
+		// key is the key of the current record, in a buffer reused throughout the iteration
+		key []byte
+	}
+
+	// memRecord is a record of the in-memory KV store, referencing its key and value
+	memRecord struct {
+		key   string
+		value []byte
+	}
+
+	// boltIterator iterates over the records of a bucket of BoltDB by its cursor, decoding the blocks of a
+	// front-coded bucket one at a time
+	boltIterator struct {
+		cursor     *bolt.Cursor
+		started    bool
+		frontCoded bool
+		// block is the records of the current block of a front-coded bucket, starting from the current record
+		block []frontCodedRecord
+		key   []byte
+		value []byte
+		err   error
+	}
+)
+
+// ForEachNamespace calls fn on each namespace with the iterator over its records sorted by key, with all shards
+// read-locked until it returns. The records of nil value are skipped, as Get reports them as not existing
+func (m *memKVStore) ForEachNamespace(fn func(string, Iterator) error) error {
+	m.rlockAll()
+	defer m.runlockAll()
+
+	names, err := m.namespaceNames()
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, namespace := range names {
+		var records []memRecord
+		for _, shard := range m.shards {
+			for k, v := range shard.bucket[namespace] {
+				if v != nil {
+					records = append(records, memRecord{key: k, value: v})
+				}
+			}
+		}
+		sort.Slice(records, func(i, j int) bool { return records[i].key < records[j].key })
+		if err := fn(namespace, &sliceIterator{records: records, current: -1}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachNamespace calls fn on each bucket with the iterator over its cursor, within one read transaction
+func (b *boltDB) ForEachNamespace(fn func(string, Iterator) error) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	return b.db.View(func(tx *bolt.Tx) error {
+		defer b.readTxns.hold("ForEachNamespace")()
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			it := &boltIterator{cursor: bucket.Cursor()}
+			_, it.frontCoded = b.wrapBucket(string(name), bucket).(frontCodedBucket)
+			if err := fn(string(name), it); err != nil {
+				return err
+			}
+			return it.err
+		})
+	})
+}
+
+// Next moves to the next record
+func (it *sliceIterator) Next() bool {
+	if it.current < len(it.records) {
+		it.current++
+	}
+	if it.current == len(it.records) {
+		return false
+	}
+	it.key = append(it.key[:0], it.records[it.current].key...)
+	return true
+}
+
+// Key returns a copy of the key of the current record
+func (it *sliceIterator) Key() []byte {
+	return []byte(it.records[it.current].key)
+}
+
+// Value returns a copy of the value of the current record
+func (it *sliceIterator) Value() []byte {
+	return append([]byte{}, it.records[it.current].value...)
+}
+
+// KeyUnsafe returns the key of the current record in the buffer of the iterator, which the next record overwrites
+func (it *sliceIterator) KeyUnsafe() []byte {
+	return it.key
+}
+
+// ValueUnsafe returns the value of the current record as held by the in-memory KV store
+func (it *sliceIterator) ValueUnsafe() []byte {
+	return it.records[it.current].value
+}
+
+// Next moves to the next record. A malformed front-coded block ends the iteration, and fails ForEachNamespace
+func (it *boltIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.frontCoded && len(it.block) > 1 {
+		it.block = it.block[1:]
+		it.key, it.value = it.block[0].key, it.block[0].value
+		return true
+	}
+	for {
+		var k, v []byte
+		if it.started {
+			k, v = it.cursor.Next()
+		} else {
+			k, v = it.cursor.First()
+			it.started = true
+		}
+		if k == nil {
+			it.key, it.value, it.block = nil, nil, nil
+			return false
+		}
+		if !it.frontCoded {
+			it.key, it.value = k, v
+			return true
+		}
+		if it.block, it.err = decodeFrontCodedBlock(v); it.err != nil {
+			return false
+		}
+		// an empty block is skipped
+		if len(it.block) > 0 {
+			it.key, it.value = it.block[0].key, it.block[0].value
+			return true
+		}
+	}
+}
+
+// Key returns a copy of the key of the current record
+func (it *boltIterator) Key() []byte {
+	return append([]byte{}, it.key...)
+}
+
+// Value returns a copy of the value of the current record
+func (it *boltIterator) Value() []byte {
+	return append([]byte{}, it.value...)
+}
+
+// KeyUnsafe returns the key of the current record as mapped by BoltDB, or as decoded from a front-coded block
+func (it *boltIterator) KeyUnsafe() []byte {
+	return it.key
+}
+
+// ValueUnsafe returns the value of the current record as mapped by BoltDB, or as decoded from a front-coded block
+func (it *boltIterator) ValueUnsafe() []byte {
+	return it.value
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestForEachNamespace(t *testing.T) {
+	testForEachNamespace := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		iterator, ok := kvStore.(NamespaceIterator)
+		require.True(ok)
+
+		expected := make(map[string][]KeyValue)
+		batch := NewBatch()
+		// more records than a front-coded block, put in reverse order
+		for i := 99; i >= 0; i-- {
+			key := []byte(fmt.Sprintf("key_%03d", i))
+			batch.Put(bucket1, key, []byte{byte(i)}, "")
+		}
+		for i := 0; i < 100; i++ {
+			expected[bucket1] = append(expected[bucket1], KeyValue{
+				Key:   []byte(fmt.Sprintf("key_%03d", i)),
+				Value: []byte{byte(i)},
+			})
+		}
+		batch.Put(bucket2, testK2[1], testV2[1], "")
+		batch.Put(bucket2, testK2[0], []byte{}, "")
+		expected[bucket2] = []KeyValue{{Key: testK2[0], Value: []byte{}}, {Key: testK2[1], Value: testV2[1]}}
+		require.NoError(kvStore.Commit(batch))
+		require.NoError(kvStore.(NamespaceManager).CreateNamespace(bucket3))
+
+		var names []string
+		visited := make(map[string][]KeyValue)
+		require.NoError(iterator.ForEachNamespace(func(namespace string, it Iterator) error {
+			names = append(names, namespace)
+			for it.Next() {
+				visited[namespace] = append(visited[namespace], KeyValue{
+					Key:   append([]byte(nil), it.Key()...),
+					Value: append([]byte{}, it.Value()...),
+				})
+			}
+			// the end is sticky
+			require.False(it.Next())
+			return nil
+		}))
+		// each namespace is visited once in name order, with all its records in key order
+		require.Equal([]string{bucket1, bucket2, bucket3}, names)
+		require.Equal(expected, visited)
+
+		// the error of fn stops the iteration
+		names = nil
+		err := iterator.ForEachNamespace(func(namespace string, it Iterator) error {
+			names = append(names, namespace)
+			require.True(it.Next())
+			return errWriteFailed
+		})
+		require.Equal(errWriteFailed, errors.Cause(err))
+		require.Equal([]string{bucket1}, names)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testForEachNamespace(NewMemKVStore(WithMemShards(4)), t)
+	})
+
+	dbCfg := cfg
+	path := "test-for-each-namespace.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testForEachNamespace(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Bolt DB front-coded", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testForEachNamespace(NewOnDiskDB(dbCfg, WithFrontCoding(bucket1)), t)
+	})
+
+	path = "test-for-each-namespace.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		_, ok := NewOnDiskDB(dbCfg).(NamespaceIterator)
+		require.False(t, ok)
+	})
+}
+
+func TestIteratorUnsafe(t *testing.T) {
+	testUnsafe := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		batch := NewBatch()
+		for i := 0; i < 100; i++ {
+			batch.Put(bucket1, []byte(fmt.Sprintf("key_%03d", i)), []byte{byte(i)}, "")
+		}
+		require.NoError(kvStore.Commit(batch))
+
+		_, reused := kvStore.(*memKVStore)
+		var previous, previousCopy []byte
+		require.NoError(kvStore.(NamespaceIterator).ForEachNamespace(func(namespace string, it Iterator) error {
+			i := 0
+			for it.Next() {
+				if reused && previous != nil {
+					// the key returned by the previous step is overwritten by the current one
+					require.Equal(it.KeyUnsafe(), previous)
+					require.NotEqual(previousCopy, previous)
+				}
+				require.Equal([]byte(fmt.Sprintf("key_%03d", i)), it.KeyUnsafe())
+				require.Equal([]byte{byte(i)}, it.ValueUnsafe())
+				// the copies are the caller's to keep and modify
+				key, value := it.Key(), it.Value()
+				require.Equal(it.KeyUnsafe(), key)
+				require.Equal(it.ValueUnsafe(), value)
+				key[0], value[0] = 'x', 'x'
+				require.Equal([]byte(fmt.Sprintf("key_%03d", i)), it.KeyUnsafe())
+				require.Equal([]byte{byte(i)}, it.ValueUnsafe())
+				if previousCopy != nil {
+					require.Equal([]byte(fmt.Sprintf("key_%03d", i-1)), previousCopy)
+				}
+				previous, previousCopy = it.KeyUnsafe(), append([]byte(nil), it.KeyUnsafe()...)
+				i++
+			}
+			require.Equal(100, i)
+			return nil
+		}))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testUnsafe(NewMemKVStore(), t)
+	})
+
+	dbCfg := cfg
+	path := "test-iterator-unsafe.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testUnsafe(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Bolt DB front-coded", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testUnsafe(NewOnDiskDB(dbCfg, WithFrontCoding(bucket1)), t)
+	})
+}
+
+func BenchmarkIterator(b *testing.B) {
+	benchmarkIterator := func(kvStore KVStore, b *testing.B) {
+		ctx := context.Background()
+		require.NoError(b, kvStore.Start(ctx))
+		defer func() {
+			require.NoError(b, kvStore.Stop(ctx))
+		}()
+		batch := NewBatch()
+		for i := 0; i < 10000; i++ {
+			batch.Put(bucket1, []byte(fmt.Sprintf("key_%05d", i)), testV1[0], "")
+		}
+		require.NoError(b, kvStore.Commit(batch))
+		iterator := kvStore.(NamespaceIterator)
+
+		b.Run("Copy", func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				iterator.ForEachNamespace(func(namespace string, it Iterator) error {
+					for it.Next() {
+						_, _ = it.Key(), it.Value()
+					}
+					return nil
+				})
+			}
+		})
+		b.Run("Unsafe", func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				iterator.ForEachNamespace(func(namespace string, it Iterator) error {
+					for it.Next() {
+						_, _ = it.KeyUnsafe(), it.ValueUnsafe()
+					}
+					return nil
+				})
+			}
+		})
+	}
+
+	b.Run("In-memory KV Store", func(b *testing.B) {
+		benchmarkIterator(NewMemKVStore(), b)
+	})
+	dbCfg := cfg
+	path := "bench-iterator.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	b.Run("Bolt DB", func(b *testing.B) {
+		require.NoError(b, os.RemoveAll(path))
+		defer func() {
+			require.NoError(b, os.RemoveAll(path))
+		}()
+		benchmarkIterator(NewOnDiskDB(dbCfg), b)
+	})
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dgraph-io/badger"
+
+	"github.com/iotexproject/iotex-core/logger"
+)
+
+// keyIndexMaxKeys is the number of keys of a namespace above which its in-memory key index is dropped
+const keyIndexMaxKeys = 1 << 22
+
+type (
+	// keyIndex is the sorted keys of the namespaces of BadgerDB mirrored in memory. As BadgerDB keeps a record under the
+	// namespace followed by the key, a namespace holds the keys of every record whose namespace and key start with it,
+	// as the iteration of BadgerDB does
+	keyIndex struct {
+		mutex   sync.RWMutex
+		maxKeys int
+		// namespaces is the namespaces to index
+		namespaces []string
+		// keys is the sorted keys of each namespace indexed, a namespace whose index is dropped is absent
+		keys map[string][]string
+	}
+
+	// keyWrite is a key put or deleted by a transaction
+	keyWrite struct {
+		key     []byte
+		deleted bool
+	}
+
+	// keyIndexTxn is a read-write transaction of BadgerDB recording the keys it writes for the key index
+	keyIndexTxn struct {
+		*badger.Txn
+		record bool
+		writes []keyWrite
+	}
+)
+
+// newKeyIndex returns the key index of the namespaces, or nil if there is none
+func newKeyIndex(namespaces []string) *keyIndex {
+	if len(namespaces) == 0 {
+		return nil
+	}
+	return &keyIndex{maxKeys: keyIndexMaxKeys, namespaces: namespaces}
+}
+
+// Set puts the <key, value> record, and records the key
+func (t *keyIndexTxn) Set(key, value []byte) error {
+	if err := t.Txn.Set(key, value); err != nil {
+		return err
+	}
+	if t.record {
+		t.writes = append(t.writes, keyWrite{key: key})
+	}
+	return nil
+}
+
+// Delete deletes the record, and records the key
+func (t *keyIndexTxn) Delete(key []byte) error {
+	if err := t.Txn.Delete(key); err != nil {
+		return err
+	}
+	if t.record {
+		t.writes = append(t.writes, keyWrite{key: key, deleted: true})
+	}
+	return nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// update calls fn within a read-write transaction, and applies the keys it writes to the key index once committed
+func (b *badgerDB) update(fn func(*keyIndexTxn) error) error {
+	var txn *keyIndexTxn
+	err := b.db.Update(func(t *badger.Txn) error {
+		txn = &keyIndexTxn{Txn: t, record: b.index != nil}
+		return fn(txn)
+	})
+	if err == nil {
+		b.index.apply(txn.writes)
+	}
+	return err
+}
+
+// rebuild reads the keys of the namespaces from the DB
+func (x *keyIndex) rebuild(db *badger.DB) error {
+	if x == nil {
+		return nil
+	}
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	x.keys = make(map[string][]string)
+	return db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for _, namespace := range x.namespaces {
+			var keys []string
+			prefix := []byte(namespace)
+			for it.Seek(prefix); it.ValidForPrefix(prefix) && len(keys) <= x.maxKeys; it.Next() {
+				keys = append(keys, string(it.Item().Key()[len(prefix):]))
+			}
+			if len(keys) > x.maxKeys {
+				x.drop(namespace)
+				continue
+			}
+			x.keys[namespace] = keys
+		}
+		return nil
+	})
+}
+
+// apply puts and deletes the keys written by a committed transaction
+func (x *keyIndex) apply(writes []keyWrite) {
+	if x == nil || len(writes) == 0 {
+		return
+	}
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	for _, write := range writes {
+		for namespace, keys := range x.keys {
+			if !strings.HasPrefix(string(write.key), namespace) {
+				continue
+			}
+			key := string(write.key[len(namespace):])
+			i := sort.SearchStrings(keys, key)
+			exists := i < len(keys) && keys[i] == key
+			switch {
+			case write.deleted && exists:
+				x.keys[namespace] = append(keys[:i], keys[i+1:]...)
+			case !write.deleted && !exists:
+				if len(keys) == x.maxKeys {
+					x.drop(namespace)
+					continue
+				}
+				keys = append(keys, "")
+				copy(keys[i+1:], keys[i:])
+				keys[i] = key
+				x.keys[namespace] = keys
+			}
+		}
+	}
+}
+
+// keysPaged returns a page of keys as KeyPager.KeysPaged, or false if the namespace is not indexed
+func (x *keyIndex) keysPaged(namespace string, after []byte, limit int) ([][]byte, []byte, bool) {
+	if x == nil {
+		return nil, nil, false
+	}
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+
+	keys, ok := x.keys[namespace]
+	if !ok {
+		return nil, nil, false
+	}
+	i := sort.SearchStrings(keys, string(after))
+	if len(after) > 0 && i < len(keys) && keys[i] == string(after) {
+		i++
+	}
+	// one more key is taken to tell if there are more
+	end := i + limit + 1
+	if end > len(keys) {
+		end = len(keys)
+	}
+	page, cursor, _ := pageOf(keys[i:end], limit)
+	return page, cursor, true
+}
+
+// drop drops the index of the namespace, whose reads go to the DB afterwards, which the mutex must be locked for
+func (x *keyIndex) drop(namespace string) {
+	delete(x.keys, namespace)
+	logger.Warn().
+		Str("namespace", namespace).
+		Int("maxKeys", x.maxKeys).
+		Msg("Too many keys to index in memory, the in-memory key index of the namespace is dropped.")
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestInMemoryKeyIndex(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	// "index_ns" also holds the keys of "index_ns2", as BadgerDB lists them together
+	const ns1, ns2 = "index_ns", "index_ns2"
+	dbCfg := cfg
+	dbCfg.UseBadgerDB = true
+	diskPath, indexPath := "test-key-index-disk.badger", "test-key-index.badger"
+	testutil.CleanupPath(t, diskPath)
+	testutil.CleanupPath(t, indexPath)
+	defer testutil.CleanupPath(t, diskPath)
+	defer testutil.CleanupPath(t, indexPath)
+	dbCfg.DbPath = diskPath
+	diskStore := NewOnDiskDB(dbCfg)
+	dbCfg.DbPath = indexPath
+	indexStore := NewOnDiskDB(dbCfg, WithInMemoryKeyIndex(ns1, ns2))
+	kvStores := []KVStore{diskStore, indexStore}
+	for _, kvStore := range kvStores {
+		require.NoError(kvStore.Start(ctx))
+	}
+	defer func() {
+		for _, kvStore := range kvStores {
+			require.NoError(kvStore.Stop(ctx))
+		}
+	}()
+	index := indexStore.(*badgerDB).index
+
+	// both KV stores list the same keys, page by page from any key on
+	compare := func() {
+		for _, ns := range []string{ns1, ns2} {
+			for _, limit := range []int{1, 7, 1000} {
+				for _, after := range [][]byte{nil, []byte("key_"), []byte("key_050"), []byte("key_0505"), []byte("~")} {
+					var pages [2][][]byte
+					for i, kvStore := range kvStores {
+						cursor := after
+						for {
+							keys, next, err := kvStore.(KeyPager).KeysPaged(ns, cursor, limit)
+							require.NoError(err)
+							require.True(len(keys) <= limit)
+							pages[i] = append(pages[i], keys...)
+							if next == nil {
+								break
+							}
+							cursor = next
+						}
+					}
+					require.Equal(pages[0], pages[1], "namespace %s after %s limit %d", ns, after, limit)
+				}
+			}
+		}
+	}
+
+	r := rand.New(rand.NewSource(1))
+	randomKey := func() []byte {
+		return []byte(fmt.Sprintf("key_%03d", r.Intn(200)))
+	}
+	randomNamespace := func() string {
+		return []string{ns1, ns2, "other"}[r.Intn(3)]
+	}
+	for i := 0; i < 2000; i++ {
+		ns, key, value := randomNamespace(), randomKey(), []byte{byte(i)}
+		op := r.Intn(7)
+		newKey := randomKey()
+		batch := NewBatch()
+		batch.Put(ns, key, value, "")
+		batch.Delete(ns, newKey, "")
+		for _, kvStore := range kvStores {
+			switch op {
+			case 0, 1:
+				require.NoError(kvStore.Put(ns, key, value))
+			case 2:
+				require.NoError(kvStore.Delete(ns, key))
+			case 3:
+				kvStore.PutIfNotExists(ns, key, value)
+			case 4:
+				kvStore.(Renamer).Rename(ns, key, newKey)
+			case 5:
+				require.NoError(kvStore.Commit(batch.CloneBatch()))
+			case 6:
+				require.NoError(kvStore.(Updater).Update(func(tx Tx) error {
+					if err := tx.Put(ns, newKey, value); err != nil {
+						return err
+					}
+					return tx.Delete(ns, key)
+				}))
+			}
+		}
+	}
+	compare()
+	for _, kvStore := range kvStores {
+		loader := NewBulkLoader(kvStore)
+		for i := 0; i < 100; i++ {
+			loader.Add(ns1, []byte(fmt.Sprintf("key_%04d", i)), []byte("bulk"))
+		}
+		require.NoError(loader.Finish())
+	}
+	compare()
+
+	// the index is rebuilt on start
+	require.NoError(indexStore.Stop(ctx))
+	require.NoError(indexStore.Start(ctx))
+	require.Contains(index.keys, ns1)
+	require.Contains(index.keys, ns2)
+	compare()
+
+	// the index of a namespace growing beyond the bound is dropped, and the disk is read instead
+	require.True(len(index.keys[ns2]) > 1)
+	index.maxKeys = len(index.keys[ns2]) + 1
+	for _, kvStore := range kvStores {
+		require.NoError(kvStore.Put(ns2, []byte("key_new1"), testV1[0]))
+	}
+	require.Contains(index.keys, ns2)
+	for _, kvStore := range kvStores {
+		require.NoError(kvStore.Put(ns2, []byte("key_new2"), testV1[0]))
+	}
+	require.NotContains(index.keys, ns2)
+	compare()
+	index.maxKeys = keyIndexMaxKeys
+
+	for _, kvStore := range kvStores {
+		require.NoError(kvStore.(Clearable).Clear())
+	}
+	require.Empty(index.keys[ns1])
+	compare()
+}
+
+func BenchmarkBadgerKeysPaged(b *testing.B) {
+	benchmark := func(b *testing.B, opts ...KVStoreOption) {
+		require := require.New(b)
+		ctx := context.Background()
+		dbCfg := cfg
+		dbCfg.DbPath = "bench-keys-paged.badger"
+		dbCfg.UseBadgerDB = true
+		require.NoError(os.RemoveAll(dbCfg.DbPath))
+		defer func() {
+			require.NoError(os.RemoveAll(dbCfg.DbPath))
+		}()
+
+		kvStore := NewOnDiskDB(dbCfg, opts...)
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		const numKeys = 100000
+		loader := NewBulkLoader(kvStore)
+		for i := 0; i < numKeys; i++ {
+			loader.Add(bucket1, []byte(fmt.Sprintf("key_%06d", i)), make([]byte, 64))
+		}
+		require.NoError(loader.Finish())
+		pager := kvStore.(KeyPager)
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			after := []byte(fmt.Sprintf("key_%06d", n%numKeys))
+			_, _, err := pager.KeysPaged(bucket1, after, 100)
+			require.NoError(err)
+		}
+	}
+
+	b.Run("Disk", func(b *testing.B) {
+		benchmark(b)
+	})
+	b.Run("InMemoryKeyIndex", func(b *testing.B) {
+		benchmark(b, WithInMemoryKeyIndex(bucket1))
+	})
+}
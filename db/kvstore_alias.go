@@ -0,0 +1,133 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// NamespaceAliaser is the interface of KV store which is able to route a namespace to another one
+type NamespaceAliaser interface {
+	// AddNamespaceAlias makes the operations on alias apply to target instead, or re-points alias if it is an alias
+	// already. target may be an alias itself. It returns ErrInvalidDB if alias would end up routed to itself
+	AddNamespaceAlias(alias, target string) error
+}
+
+// aliasKVStore is a KV store routing the aliases of namespaces to their targets
+type aliasKVStore struct {
+	kvStore KVStore
+	mutex   sync.RWMutex
+	aliases map[string]string
+}
+
+// NewAliasKVStore wraps the KV store to support aliases of namespaces, so that a namespace can be renamed without
+// moving its records: the records are kept under the new name, and the old name is added as an alias of it for the
+// code not migrated yet. Aliases are kept in memory, and resolved at the start of every operation
+func NewAliasKVStore(kvStore KVStore) KVStore {
+	return &aliasKVStore{
+		kvStore: kvStore,
+		aliases: make(map[string]string),
+	}
+}
+
+// Start starts the underlying KV store
+func (s *aliasKVStore) Start(ctx context.Context) error {
+	return s.kvStore.Start(ctx)
+}
+
+// Stop stops the underlying KV store
+func (s *aliasKVStore) Stop(ctx context.Context) error {
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record
+func (s *aliasKVStore) Put(namespace string, key, value []byte) error {
+	return s.kvStore.Put(s.resolve(namespace), key, value)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (s *aliasKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	return s.kvStore.PutIfNotExists(s.resolve(namespace), key, value)
+}
+
+// Get retrieves a record
+func (s *aliasKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	return s.kvStore.Get(s.resolve(namespace), key)
+}
+
+// Delete deletes a record
+func (s *aliasKVStore) Delete(namespace string, key []byte) error {
+	return s.kvStore.Delete(s.resolve(namespace), key)
+}
+
+// Commit commits the batch with the aliases of its entries resolved
+func (s *aliasKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	entries := make([]writeInfo, b.Size())
+	for i := range entries {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		entries[i] = *write
+		entries[i].namespace = s.resolve(write.namespace)
+	}
+	if err := s.kvStore.Commit(newBatchOf(entries)); err != nil {
+		return err
+	}
+	succeed = true
+	return nil
+}
+
+// AddNamespaceAlias routes alias to target
+func (s *aliasKVStore) AddNamespaceAlias(alias, target string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// the chain from target must not lead back to alias
+	for ns, ok := target, true; ok; ns, ok = s.aliases[ns] {
+		if ns == alias {
+			return errors.Wrapf(ErrInvalidDB, "alias %s of %s creates a cycle", alias, target)
+		}
+	}
+	s.aliases[alias] = target
+	return nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// resolve follows the chain of aliases from the namespace to the namespace keeping the records
+func (s *aliasKVStore) resolve(namespace string) string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for {
+		target, ok := s.aliases[namespace]
+		if !ok {
+			return namespace
+		}
+		namespace = target
+	}
+}
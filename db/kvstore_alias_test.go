@@ -0,0 +1,81 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAliasKVStore(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	const (
+		bucket3 = "test_ns3"
+		bucket4 = "test_ns4"
+	)
+	inner := NewMemKVStore()
+	kvStore := NewAliasKVStore(inner)
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	aliaser, ok := kvStore.(NamespaceAliaser)
+	require.True(ok)
+	require.NoError(inner.Put(bucket2, testK2[0], testV2[0]))
+
+	// reads and writes through an alias apply to the target
+	require.NoError(aliaser.AddNamespaceAlias(bucket1, bucket2))
+	value, err := kvStore.Get(bucket1, testK2[0])
+	require.NoError(err)
+	require.Equal(testV2[0], value)
+	require.NoError(kvStore.Put(bucket1, testK2[1], testV2[1]))
+	require.Equal(ErrAlreadyExist, errors.Cause(kvStore.PutIfNotExists(bucket1, testK2[1], testV2[2])))
+	value, err = inner.Get(bucket2, testK2[1])
+	require.NoError(err)
+	require.Equal(testV2[1], value)
+	_, err = inner.Get(bucket1, testK2[1])
+	require.True(isNotExist(err))
+	require.NoError(kvStore.Delete(bucket1, testK2[0]))
+	_, err = inner.Get(bucket2, testK2[0])
+	require.Equal(ErrNotExist, errors.Cause(err))
+
+	// a chain of aliases resolves to the last target
+	require.NoError(aliaser.AddNamespaceAlias(bucket3, bucket1))
+	batch := NewBatch()
+	batch.Put(bucket3, testK2[2], testV2[2], "")
+	batch.Put(bucket4, testK1[0], testV1[0], "")
+	require.NoError(kvStore.Commit(batch))
+	require.Equal(0, batch.Size())
+	value, err = inner.Get(bucket2, testK2[2])
+	require.NoError(err)
+	require.Equal(testV2[2], value)
+	value, err = inner.Get(bucket4, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], value)
+	value, err = kvStore.Get(bucket3, testK2[1])
+	require.NoError(err)
+	require.Equal(testV2[1], value)
+
+	// an alias creating a cycle is rejected
+	require.Equal(ErrInvalidDB, errors.Cause(aliaser.AddNamespaceAlias(bucket2, bucket3)))
+	require.Equal(ErrInvalidDB, errors.Cause(aliaser.AddNamespaceAlias(bucket2, bucket2)))
+	require.Equal(ErrInvalidDB, errors.Cause(aliaser.AddNamespaceAlias(bucket1, bucket3)))
+	value, err = kvStore.Get(bucket3, testK2[1])
+	require.NoError(err)
+	require.Equal(testV2[1], value)
+
+	// an alias can be re-pointed
+	require.NoError(aliaser.AddNamespaceAlias(bucket3, bucket4))
+	value, err = kvStore.Get(bucket3, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], value)
+}
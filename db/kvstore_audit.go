@@ -0,0 +1,456 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/pkg/hash"
+)
+
+// auditNamespace is the namespace keeping the audit log, by sequence of the commit
+const auditNamespace = "auditLog"
+
+// auditHistoryNamespace is the namespace keeping the values overwritten by each commit, by sequence of the commit
+const auditHistoryNamespace = "auditHistory"
+
+// the states of the prior value of a mutation in the history
+const (
+	// priorAbsent is the state of a record not existing before the commit
+	priorAbsent = iota
+	// priorPresent is the state of a record existing before the commit, followed by its value
+	priorPresent
+	// priorStaged is the state of a record written by a mutation before in the same commit, whose prior value is
+	// kept with that mutation
+	priorStaged
+)
+
+// auditMetaKey is the key of the oldest and the next sequence in auditNamespace, which never collides with a sequence
+// of 8 bytes
+var auditMetaKey = []byte("meta")
+
+type (
+	// AuditMutation is a write applied by a commit
+	AuditMutation struct {
+		// Type is Put, PutIfNotExists or Delete
+		Type int32
+		// Namespace is the namespace of the record
+		Namespace string
+		// Key is the key of the record
+		Key []byte
+		// ValueHash is the hash of the value written, nil for Delete or if value hashes are not recorded
+		ValueHash []byte
+	}
+
+	// AuditRecord is the record of a commit in the audit log
+	AuditRecord struct {
+		// Sequence is the sequence of the commit, which increases by 1 for every commit
+		Sequence uint64
+		// Timestamp is the time of the commit
+		Timestamp time.Time
+		// Mutations is the writes of the commit in the order the batch is staged
+		Mutations []AuditMutation
+	}
+
+	// AuditLogReader is the interface of KV store which is able to replay the audit log of its commits
+	AuditLogReader interface {
+		// AuditLog returns the records kept in the audit log from the sequence on, in sequence order
+		AuditLog(uint64) ([]AuditRecord, error)
+	}
+
+	// HistoryReader is the interface of KV store which is able to read a record as of a past commit, e.g. to debug
+	HistoryReader interface {
+		// GetAsOf retrieves a record by (namespace, key) as of right after the commit of the sequence, 0 being before
+		// the first commit. It returns ErrSequencePruned if the history of the commits after the sequence is not kept
+		GetAsOf(string, []byte, uint64) ([]byte, error)
+	}
+
+	// auditKVStore is a KV store recording each commit in the audit log, in the same commit
+	auditKVStore struct {
+		kvStore    KVStore
+		retention  uint64
+		hashValues bool
+		history    bool
+		clk        clock.Clock
+		// mutex serializes the commits, so that sequences are assigned in commit order, and guards the sequences
+		mutex  sync.Mutex
+		oldest uint64
+		next   uint64
+	}
+)
+
+// newAuditKVStore wraps the KV store to keep the audit log of up to retention latest commits, 0 means unbounded, and
+// the history of the values overwritten by them if history is set
+func newAuditKVStore(kvStore KVStore, retention uint64, hashValues, history bool, clk clock.Clock) KVStore {
+	return &auditKVStore{
+		kvStore:    kvStore,
+		retention:  retention,
+		hashValues: hashValues,
+		history:    history,
+		clk:        clk,
+	}
+}
+
+// Start starts the underlying KV store, and resumes the sequences of the audit log kept in it
+func (s *auditKVStore) Start(ctx context.Context) error {
+	if err := s.kvStore.Start(ctx); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.oldest, s.next = 1, 1
+	meta, err := s.kvStore.Get(auditNamespace, auditMetaKey)
+	if isNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(meta) != 16 {
+		return errors.Wrap(ErrInvalidDB, "malformed audit log sequences")
+	}
+	s.oldest = binary.BigEndian.Uint64(meta[:8])
+	s.next = binary.BigEndian.Uint64(meta[8:])
+	return nil
+}
+
+// Stop stops the underlying KV store
+func (s *auditKVStore) Stop(ctx context.Context) error {
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record
+func (s *auditKVStore) Put(namespace string, key, value []byte) error {
+	batch := NewBatch()
+	batch.Put(namespace, key, value, "failed to put key = %x", key)
+	return s.Commit(batch)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (s *auditKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	batch := NewBatch()
+	if err := batch.PutIfNotExists(namespace, key, value, "failed to put key = %x", key); err != nil {
+		return err
+	}
+	return s.Commit(batch)
+}
+
+// Get retrieves a record
+func (s *auditKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	return s.kvStore.Get(namespace, key)
+}
+
+// Delete deletes a record
+func (s *auditKVStore) Delete(namespace string, key []byte) error {
+	batch := NewBatch()
+	batch.Delete(namespace, key, "failed to delete key = %x", key)
+	return s.Commit(batch)
+}
+
+// Commit commits the batch together with its record in the audit log, and the removal of the records beyond the
+// retention, so the audit log never diverges from the records
+func (s *auditKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record := AuditRecord{
+		Sequence:  s.next,
+		Timestamp: s.clk.Now(),
+		Mutations: make([]AuditMutation, b.Size()),
+	}
+	entries := make([]writeInfo, b.Size(), b.Size()+2)
+	for i := range entries {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		entries[i] = *write
+		record.Mutations[i] = AuditMutation{Type: write.writeType, Namespace: write.namespace, Key: write.key}
+		if s.hashValues && write.writeType != Delete {
+			record.Mutations[i].ValueHash = hash.Hash256b(write.value)
+		}
+	}
+	entries = append(entries, writeInfo{
+		writeType: Put,
+		namespace: auditNamespace,
+		key:       auditSequenceKey(record.Sequence),
+		value:     encodeAuditRecord(record),
+	})
+	if s.history {
+		history, err := s.priorValues(record.Mutations)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, writeInfo{
+			writeType: Put,
+			namespace: auditHistoryNamespace,
+			key:       auditSequenceKey(record.Sequence),
+			value:     history,
+		})
+	}
+	oldest := s.oldest
+	for s.retention > 0 && s.next+1-oldest > s.retention {
+		entries = append(entries, writeInfo{
+			writeType: Delete,
+			namespace: auditNamespace,
+			key:       auditSequenceKey(oldest),
+		})
+		if s.history {
+			entries = append(entries, writeInfo{
+				writeType: Delete,
+				namespace: auditHistoryNamespace,
+				key:       auditSequenceKey(oldest),
+			})
+		}
+		oldest++
+	}
+	meta := make([]byte, 16)
+	binary.BigEndian.PutUint64(meta[:8], oldest)
+	binary.BigEndian.PutUint64(meta[8:], s.next+1)
+	entries = append(entries, writeInfo{writeType: Put, namespace: auditNamespace, key: auditMetaKey, value: meta})
+
+	if err := s.kvStore.Commit(newBatchOf(entries)); err != nil {
+		return err
+	}
+	s.oldest = oldest
+	s.next++
+	succeed = true
+	return nil
+}
+
+// AuditLog returns the records kept in the audit log from the sequence on. The records older than the retention are
+// trimmed, so the first record returned may be after the sequence
+func (s *auditKVStore) AuditLog(from uint64) ([]AuditRecord, error) {
+	// the records must not be trimmed while being read
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if from < s.oldest {
+		from = s.oldest
+	}
+	return s.records(from)
+}
+
+// GetAsOf retrieves a record as of right after the commit of the sequence. The first write to the record by a later
+// commit kept the value it overwrote in the history, otherwise the record is as it is now. The audit log is read from
+// the sequence on, so it takes longer for an older sequence
+func (s *auditKVStore) GetAsOf(namespace string, key []byte, seq uint64) ([]byte, error) {
+	// the records must not be trimmed while being read
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.history {
+		return nil, errors.Wrap(ErrInvalidDB, "history of the audit log is not kept")
+	}
+	if seq >= s.next {
+		return nil, errors.Wrapf(ErrInvalidDB, "commit %d is not made yet", seq)
+	}
+	if seq+1 < s.oldest {
+		return nil, errors.Wrapf(ErrSequencePruned, "commit %d is trimmed from the audit log", seq+1)
+	}
+	for later := seq + 1; later < s.next; later++ {
+		value, err := s.kvStore.Get(auditNamespace, auditSequenceKey(later))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get audit record %d", later)
+		}
+		record, err := decodeAuditRecord(later, value)
+		if err != nil {
+			return nil, err
+		}
+		for i, m := range record.Mutations {
+			if m.Namespace == namespace && bytes.Equal(m.Key, key) {
+				return s.priorValue(later, i, key)
+			}
+		}
+	}
+	return s.kvStore.Get(namespace, key)
+}
+
+//======================================
+// private functions
+//======================================
+
+// underlying returns the KV store wrapped
+func (s *auditKVStore) underlying() KVStore { return s.kvStore }
+
+// records reads the records of the audit log from the sequence on, which the mutex must be locked for
+func (s *auditKVStore) records(from uint64) ([]AuditRecord, error) {
+	var records []AuditRecord
+	for seq := from; seq < s.next; seq++ {
+		value, err := s.kvStore.Get(auditNamespace, auditSequenceKey(seq))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get audit record %d", seq)
+		}
+		record, err := decodeAuditRecord(seq, value)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// priorValues reads the values the mutations overwrite, and encodes the state of each mutation, followed by the
+// value prefixed with its length if the record exists
+func (s *auditKVStore) priorValues(mutations []AuditMutation) ([]byte, error) {
+	var buf bytes.Buffer
+	n := make([]byte, binary.MaxVarintLen64)
+	staged := make(map[cacheKey]struct{})
+	for _, m := range mutations {
+		k := cacheKey{namespace: m.Namespace, key: string(m.Key)}
+		if _, ok := staged[k]; ok {
+			buf.Write(n[:binary.PutUvarint(n, priorStaged)])
+			continue
+		}
+		staged[k] = struct{}{}
+		value, err := s.kvStore.Get(m.Namespace, m.Key)
+		if isNotExist(err) {
+			buf.Write(n[:binary.PutUvarint(n, priorAbsent)])
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get the prior value of key = %x", m.Key)
+		}
+		buf.Write(n[:binary.PutUvarint(n, priorPresent)])
+		buf.Write(n[:binary.PutUvarint(n, uint64(len(value)))])
+		buf.Write(value)
+	}
+	return buf.Bytes(), nil
+}
+
+// priorValue returns the value of the key overwritten by the mutation at the index of the commit of the sequence
+func (s *auditKVStore) priorValue(seq uint64, index int, key []byte) ([]byte, error) {
+	history, err := s.kvStore.Get(auditHistoryNamespace, auditSequenceKey(seq))
+	if isNotExist(err) {
+		return nil, errors.Wrapf(ErrSequencePruned, "commit %d is made before the history is kept", seq)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get the history of commit %d", seq)
+	}
+	malformed := errors.Wrapf(ErrInvalidDB, "malformed history of commit %d", seq)
+	r := bytes.NewReader(history)
+	for i := 0; ; i++ {
+		state, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, malformed
+		}
+		var value []byte
+		if state == priorPresent {
+			l, err := binary.ReadUvarint(r)
+			if err != nil || l > uint64(r.Len()) {
+				return nil, malformed
+			}
+			value = make([]byte, l)
+			r.Read(value)
+		}
+		if i < index {
+			continue
+		}
+		switch state {
+		case priorAbsent:
+			return nil, errors.Wrapf(ErrNotExist, "key = %x", key)
+		case priorPresent:
+			return value, nil
+		}
+		return nil, malformed
+	}
+}
+
+// auditSequenceKey returns the key of the audit record of the sequence, which sorts in sequence order
+func auditSequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// encodeAuditRecord encodes the record as the timestamp and the number of mutations, followed by the type, namespace,
+// key and value hash of each mutation, the variable-length ones prefixed with their length
+func encodeAuditRecord(record AuditRecord) []byte {
+	var buf bytes.Buffer
+	n := make([]byte, binary.MaxVarintLen64)
+	writeBytes := func(b []byte) {
+		buf.Write(n[:binary.PutUvarint(n, uint64(len(b)))])
+		buf.Write(b)
+	}
+	buf.Write(n[:binary.PutVarint(n, record.Timestamp.UnixNano())])
+	buf.Write(n[:binary.PutUvarint(n, uint64(len(record.Mutations)))])
+	for _, m := range record.Mutations {
+		buf.Write(n[:binary.PutUvarint(n, uint64(m.Type))])
+		writeBytes([]byte(m.Namespace))
+		writeBytes(m.Key)
+		writeBytes(m.ValueHash)
+	}
+	return buf.Bytes()
+}
+
+// decodeAuditRecord decodes the audit record of the sequence
+func decodeAuditRecord(seq uint64, value []byte) (AuditRecord, error) {
+	malformed := errors.Wrapf(ErrInvalidDB, "malformed audit record %d", seq)
+	r := bytes.NewReader(value)
+	readBytes := func() ([]byte, error) {
+		l, err := binary.ReadUvarint(r)
+		if err != nil || l > uint64(r.Len()) {
+			return nil, malformed
+		}
+		if l == 0 {
+			return nil, nil
+		}
+		b := make([]byte, l)
+		r.Read(b)
+		return b, nil
+	}
+	ts, err := binary.ReadVarint(r)
+	if err != nil {
+		return AuditRecord{}, malformed
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil || count > uint64(r.Len()) {
+		return AuditRecord{}, malformed
+	}
+	record := AuditRecord{Sequence: seq, Timestamp: time.Unix(0, ts), Mutations: make([]AuditMutation, count)}
+	for i := range record.Mutations {
+		writeType, err := binary.ReadUvarint(r)
+		if err != nil {
+			return AuditRecord{}, malformed
+		}
+		var namespace, key, valueHash []byte
+		for _, field := range []*[]byte{&namespace, &key, &valueHash} {
+			if *field, err = readBytes(); err != nil {
+				return AuditRecord{}, err
+			}
+		}
+		record.Mutations[i] = AuditMutation{
+			Type:      int32(writeType),
+			Namespace: string(namespace),
+			Key:       key,
+			ValueHash: valueHash,
+		}
+	}
+	return record, nil
+}
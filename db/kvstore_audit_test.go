@@ -0,0 +1,252 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/pkg/hash"
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestAuditKVStore(t *testing.T) {
+	testAudit := func(newKVStore func(...KVStoreOption) KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		clk := clock.NewMock()
+		kvStore := newKVStore(WithAuditLog(0, true), WithClock(clk))
+		require.NoError(kvStore.Start(ctx))
+		reader, ok := kvStore.(AuditLogReader)
+		require.True(ok)
+
+		clk.Add(time.Hour)
+		t1 := clk.Now()
+		batch := NewBatch()
+		batch.Put(bucket1, testK1[0], testV1[0], "")
+		batch.Put(bucket1, testK1[1], testV1[1], "")
+		batch.Put(bucket2, testK2[0], testV2[0], "")
+		require.NoError(kvStore.Commit(batch))
+		clk.Add(time.Minute)
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[2]))
+		require.NoError(kvStore.PutIfNotExists(bucket1, testK1[2], testV1[2]))
+		batch.Delete(bucket1, testK1[1], "")
+		batch.Put(bucket2, testK2[1], testV2[1], "")
+		require.NoError(kvStore.Commit(batch))
+
+		// a failed commit is not recorded
+		require.Equal(ErrAlreadyExist, errors.Cause(kvStore.PutIfNotExists(bucket1, testK1[2], testV1[0])))
+
+		// replaying the audit log reconstructs the mutations
+		records, err := reader.AuditLog(0)
+		require.NoError(err)
+		require.Len(records, 4)
+		for i, record := range records {
+			require.Equal(uint64(i+1), record.Sequence)
+		}
+		require.True(t1.Equal(records[0].Timestamp))
+		require.True(t1.Add(time.Minute).Equal(records[3].Timestamp))
+		require.Equal([]AuditMutation{
+			{Type: Delete, Namespace: bucket1, Key: testK1[1]},
+			{Type: Put, Namespace: bucket2, Key: testK2[1], ValueHash: hash.Hash256b(testV2[1])},
+		}, records[3].Mutations)
+		require.Equal(PutIfNotExists, records[2].Mutations[0].Type)
+		state := make(map[cacheKey][]byte)
+		for _, record := range records {
+			for _, m := range record.Mutations {
+				k := cacheKey{namespace: m.Namespace, key: string(m.Key)}
+				if m.Type == Delete {
+					delete(state, k)
+				} else {
+					state[k] = m.ValueHash
+				}
+			}
+		}
+		require.Len(state, 4)
+		for k, h := range state {
+			value, err := kvStore.Get(k.namespace, []byte(k.key))
+			require.NoError(err)
+			require.Equal(hash.Hash256b(value), h)
+		}
+		_, err = kvStore.Get(bucket1, testK1[1])
+		require.Equal(ErrNotExist, errors.Cause(err))
+		records, err = reader.AuditLog(4)
+		require.NoError(err)
+		require.Len(records, 1)
+		require.NoError(kvStore.Stop(ctx))
+
+		// the sequences resume after restart, and the records beyond the retention are trimmed
+		kvStore = newKVStore(WithAuditLog(2, false), WithClock(clk))
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		reader = kvStore.(AuditLogReader)
+		require.NoError(kvStore.Delete(bucket2, testK2[0]))
+		records, err = reader.AuditLog(0)
+		require.NoError(err)
+		require.Len(records, 2)
+		require.Equal(uint64(4), records[0].Sequence)
+		require.Equal(uint64(5), records[1].Sequence)
+		require.Equal([]AuditMutation{{Type: Delete, Namespace: bucket2, Key: testK2[0]}}, records[1].Mutations)
+		_, err = kvStore.Get(auditNamespace, auditSequenceKey(3))
+		require.Equal(ErrNotExist, errors.Cause(err))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		// the records are kept by the same instance across restarts
+		kvStore := newMemKVStore(kvStoreOptions{memShards: defaultMemShards})
+		testAudit(func(opts ...KVStoreOption) KVStore {
+			options := kvStoreOptions{}
+			for _, opt := range opts {
+				opt(&options)
+			}
+			return newAuditKVStore(kvStore, options.auditRetention, options.auditValueHashes, options.auditHistory, options.clk)
+		}, t)
+	})
+
+	dbCfg := cfg
+	path := "test-audit.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testAudit(func(opts ...KVStoreOption) KVStore {
+			return NewOnDiskDB(dbCfg, opts...)
+		}, t)
+	})
+
+	path = "test-audit.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testAudit(func(opts ...KVStoreOption) KVStore {
+			return NewOnDiskDB(dbCfg, opts...)
+		}, t)
+	})
+}
+
+func TestAuditHistory(t *testing.T) {
+	testHistory := func(newKVStore func(...KVStoreOption) KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		// commit 1 is made before the history is kept
+		kvStore := newKVStore(WithAuditLog(5, false))
+		require.NoError(kvStore.Start(ctx))
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		_, err := kvStore.(HistoryReader).GetAsOf(bucket1, testK1[0], 1)
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+		require.NoError(kvStore.Stop(ctx))
+
+		kvStore = newKVStore(WithAuditLog(5, false), WithAuditHistory())
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		reader := kvStore.(HistoryReader)
+		batch := NewBatch()
+		// commit 2
+		batch.Put(bucket1, testK1[0], testV1[1], "")
+		batch.Put(bucket1, testK1[0], testV1[2], "")
+		batch.Put(bucket1, testK1[1], testV1[0], "")
+		require.NoError(kvStore.Commit(batch))
+		// commit 3
+		require.NoError(kvStore.Delete(bucket1, testK1[1]))
+		// commit 4
+		batch.Put(bucket1, testK1[1], testV1[1], "")
+		batch.Delete(bucket1, testK1[0], "")
+		require.NoError(kvStore.Commit(batch))
+
+		getAsOf := func(key []byte, seq uint64) ([]byte, error) {
+			value, err := reader.GetAsOf(bucket1, key, seq)
+			return value, errors.Cause(err)
+		}
+		for _, c := range []struct {
+			key   []byte
+			seq   uint64
+			value []byte
+			err   error
+		}{
+			{testK1[0], 0, nil, ErrSequencePruned},
+			{testK1[0], 1, testV1[0], nil},
+			{testK1[0], 2, testV1[2], nil},
+			{testK1[0], 3, testV1[2], nil},
+			{testK1[0], 4, nil, ErrNotExist},
+			{testK1[1], 1, nil, ErrNotExist},
+			{testK1[1], 2, testV1[0], nil},
+			{testK1[1], 3, nil, ErrNotExist},
+			{testK1[1], 4, testV1[1], nil},
+			{testK1[2], 2, nil, ErrNotExist},
+			{testK1[0], 5, nil, ErrInvalidDB},
+		} {
+			value, err := getAsOf(c.key, c.seq)
+			require.Equal(c.err, err, "key %x as of %d", c.key, c.seq)
+			require.Equal(c.value, value, "key %x as of %d", c.key, c.seq)
+		}
+
+		// the history is trimmed along with the audit log
+		require.NoError(kvStore.Put(bucket2, testK2[0], testV2[0]))
+		require.NoError(kvStore.Put(bucket2, testK2[1], testV2[1]))
+		value, err := getAsOf(testK1[0], 1)
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+		require.NoError(kvStore.Put(bucket2, testK2[2], testV2[2]))
+		_, err = getAsOf(testK1[0], 1)
+		require.Equal(ErrSequencePruned, err)
+		value, err = getAsOf(testK1[0], 2)
+		require.NoError(err)
+		require.Equal(testV1[2], value)
+		_, err = kvStore.Get(auditHistoryNamespace, auditSequenceKey(2))
+		require.Equal(ErrNotExist, errors.Cause(err))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		// the records are kept by the same instance across restarts
+		kvStore := newMemKVStore(kvStoreOptions{memShards: defaultMemShards})
+		testHistory(func(opts ...KVStoreOption) KVStore {
+			options := kvStoreOptions{clk: clock.New()}
+			for _, opt := range opts {
+				opt(&options)
+			}
+			return newAuditKVStore(kvStore, options.auditRetention, options.auditValueHashes, options.auditHistory,
+				options.clk)
+		}, t)
+	})
+
+	dbCfg := cfg
+	path := "test-audit-history.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testHistory(func(opts ...KVStoreOption) KVStore {
+			return NewOnDiskDB(dbCfg, opts...)
+		}, t)
+	})
+
+	path = "test-audit-history.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testHistory(func(opts ...KVStoreOption) KVStore {
+			return NewOnDiskDB(dbCfg, opts...)
+		}, t)
+	})
+}
@@ -0,0 +1,306 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/pkg/hash"
+	"github.com/iotexproject/iotex-core/pkg/util/byteutil"
+)
+
+const (
+	// blobNamespace is the namespace keeping the number of references to each blob, by hash of the blob
+	blobNamespace = "externalBlobRefs"
+	// dedupNamespace is the namespace keeping the blobs by hash, when they are not kept in files
+	dedupNamespace = "dedupBlobs"
+	// inlineValue tags a value kept in the KV store
+	inlineValue byte = 0
+	// blobReference tags a reference to a value kept in a blob file
+	blobReference byte = 1
+)
+
+// blobKVStore is a KV store keeping values larger than the threshold in content-addressed blobs, and only references
+// to them in the underlying KV store. The blobs are kept in files under dir, or in dedupNamespace if dir is empty
+type blobKVStore struct {
+	// mutex serializes the writes, which read-modify-write the reference counts, against reads resolving references
+	mutex     sync.RWMutex
+	kvStore   KVStore
+	threshold int
+	dir       string
+}
+
+// newBlobKVStore wraps the KV store to keep values larger than threshold in files under dir, or in the KV store itself
+// if dir is empty
+func newBlobKVStore(kvStore KVStore, threshold int, dir string) KVStore {
+	return &blobKVStore{
+		kvStore:   kvStore,
+		threshold: threshold,
+		dir:       dir,
+	}
+}
+
+// Start creates the directory of blob files and starts the underlying KV store
+func (s *blobKVStore) Start(ctx context.Context) error {
+	if s.dir == "" {
+		return s.kvStore.Start(ctx)
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return errors.Wrapf(err, "failed to create blob directory %s", s.dir)
+	}
+	return s.kvStore.Start(ctx)
+}
+
+// Stop stops the underlying KV store
+func (s *blobKVStore) Stop(ctx context.Context) error {
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record
+func (s *blobKVStore) Put(namespace string, key, value []byte) error {
+	batch := NewBatch()
+	batch.Put(namespace, key, value, "failed to put key = %x", key)
+	return s.Commit(batch)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (s *blobKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	batch := NewBatch()
+	if err := batch.PutIfNotExists(namespace, key, value, "failed to put key = %x", key); err != nil {
+		return err
+	}
+	return s.Commit(batch)
+}
+
+// Get retrieves a record, reading the blob if the value is kept in one
+func (s *blobKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	stored, err := s.kvStore.Get(namespace, key)
+	if err != nil {
+		return nil, err
+	}
+	value, h, err := decodeBlobValue(stored)
+	if err != nil || h == nil {
+		return value, err
+	}
+	if s.dir == "" {
+		value, err = s.kvStore.Get(dedupNamespace, h)
+	} else {
+		value, err = ioutil.ReadFile(s.blobPath(h))
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read blob of key = %x", key)
+	}
+	return value, nil
+}
+
+// Delete deletes a record, and removes its blob if no other record references it
+func (s *blobKVStore) Delete(namespace string, key []byte) error {
+	batch := NewBatch()
+	batch.Delete(namespace, key, "failed to delete key = %x", key)
+	return s.Commit(batch)
+}
+
+// Commit writes the blob files of the large values, then commits the batch with the values replaced by references
+// and the reference counts updated, and finally removes the blob files no longer referenced. Without a directory of
+// blob files, the blobs newly referenced are written and those no longer referenced deleted in the batch itself
+func (s *blobKVStore) Commit(b KVStoreBatch) (e error) {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// stored is the value of each key written so far, as stored in the underlying KV store
+	stored := make(map[cacheKey][]byte)
+	deltas := make(map[string]int64)
+	// blobs is the value of each blob referenced by the batch
+	blobs := make(map[string][]byte)
+	entries := make([]writeInfo, 0, b.Size())
+	for i := 0; i < b.Size(); i++ {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		if write.writeType == AddCounter {
+			return errors.Wrap(ErrInvalidDB, "counters are not supported by the blob KV store")
+		}
+		k := cacheKey{namespace: write.namespace, key: string(write.key)}
+		old, ok := stored[k]
+		if !ok {
+			if old, err = s.kvStore.Get(write.namespace, write.key); err != nil && !isNotExist(err) {
+				return err
+			}
+		}
+		if _, h, err := decodeBlobValue(old); err == nil && h != nil {
+			deltas[string(h)]--
+		}
+
+		entry := *write
+		if write.writeType == Delete {
+			stored[k] = nil
+		} else {
+			value, h, err := s.encode(write.value)
+			if err != nil {
+				return err
+			}
+			if h != nil {
+				deltas[string(h)]++
+				blobs[string(h)] = write.value
+			}
+			stored[k] = value
+			entry.value = value
+		}
+		entries = append(entries, entry)
+	}
+
+	// the blob files written for this batch are left behind if the commit fails, unless removed
+	counts := make(map[string]uint64, len(deltas))
+	for h, delta := range deltas {
+		count, err := s.refCount([]byte(h))
+		if err != nil {
+			return err
+		}
+		counts[h] = count
+		if delta == 0 {
+			continue
+		}
+		newCount := int64(count) + delta
+		entry := writeInfo{writeType: Delete, namespace: blobNamespace, key: []byte(h)}
+		if newCount > 0 {
+			entry.writeType = Put
+			entry.value = byteutil.Uint64ToBytes(uint64(newCount))
+		}
+		entries = append(entries, entry)
+		if s.dir == "" {
+			if newCount <= 0 {
+				entries = append(entries, writeInfo{writeType: Delete, namespace: dedupNamespace, key: []byte(h)})
+			} else if count == 0 {
+				entries = append(entries, writeInfo{
+					writeType: Put,
+					namespace: dedupNamespace,
+					key:       []byte(h),
+					value:     blobs[h],
+				})
+			}
+		}
+	}
+	defer func() {
+		if s.dir == "" {
+			succeed = e == nil
+			return
+		}
+		for h, delta := range deltas {
+			count := int64(counts[h])
+			if e == nil {
+				count += delta
+			}
+			if count > 0 {
+				continue
+			}
+			if err := os.Remove(s.blobPath([]byte(h))); err != nil && !os.IsNotExist(err) && e == nil {
+				e = errors.Wrapf(err, "failed to remove blob %x", h)
+			}
+		}
+		succeed = e == nil
+	}()
+	return s.kvStore.Commit(newBatchOf(entries))
+}
+
+//======================================
+// private functions
+//======================================
+
+// underlying returns the KV store wrapped
+func (s *blobKVStore) underlying() KVStore { return s.kvStore }
+
+// encode returns the value to store in the underlying KV store, and the hash of the blob if the value is larger than
+// the threshold. The blob file is written right away, while a blob kept in the KV store is left to Commit
+func (s *blobKVStore) encode(value []byte) ([]byte, []byte, error) {
+	if len(value) <= s.threshold {
+		return append([]byte{inlineValue}, value...), nil, nil
+	}
+	h := hash.Hash256b(value)
+	if s.dir == "" {
+		return append([]byte{blobReference}, h...), h, nil
+	}
+	path := s.blobPath(h)
+	// the file is content-addressed, so an existing one holds the same value
+	if _, err := os.Stat(path); err == nil {
+		return append([]byte{blobReference}, h...), h, nil
+	}
+	f, err := ioutil.TempFile(s.dir, "blob")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create blob file")
+	}
+	_, err = f.Write(value)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		// best effort, the temporary file is garbage either way
+		os.Remove(f.Name())
+		return nil, nil, errors.Wrap(err, "failed to write blob file")
+	}
+	return append([]byte{blobReference}, h...), h, nil
+}
+
+// refCount returns the number of references to the blob
+func (s *blobKVStore) refCount(h []byte) (uint64, error) {
+	value, err := s.kvStore.Get(blobNamespace, h)
+	if isNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return byteutil.BytesToUint64(value), nil
+}
+
+func (s *blobKVStore) blobPath(h []byte) string {
+	return filepath.Join(s.dir, hex.EncodeToString(h))
+}
+
+// decodeBlobValue returns the value kept in the KV store, or the hash of the blob keeping the value
+func decodeBlobValue(stored []byte) ([]byte, []byte, error) {
+	if len(stored) == 0 {
+		return nil, nil, errors.Wrap(ErrInvalidDB, "value is not tagged")
+	}
+	switch stored[0] {
+	case inlineValue:
+		return stored[1:], nil, nil
+	case blobReference:
+		return nil, stored[1:], nil
+	}
+	return nil, nil, errors.Wrapf(ErrInvalidDB, "unknown tag of value %d", stored[0])
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/config"
+	"github.com/iotexproject/iotex-core/pkg/hash"
+)
+
+func TestExternalBlobs(t *testing.T) {
+	testExternalBlobs := func(dbCfg config.DB, blobDir string, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		kvStore := NewOnDiskDB(dbCfg, WithExternalBlobs(16, blobDir))
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		blobs := func() int {
+			files, err := ioutil.ReadDir(blobDir)
+			require.NoError(err)
+			return len(files)
+		}
+		large1 := bytes.Repeat([]byte{1}, 100)
+		large2 := bytes.Repeat([]byte{2}, 100)
+
+		// round trip, only the large value is kept in a blob file
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		require.NoError(kvStore.Put(bucket1, testK1[1], large1))
+		require.Equal(1, blobs())
+		value, err := kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+		value, err = kvStore.Get(bucket1, testK1[1])
+		require.NoError(err)
+		require.Equal(large1, value)
+
+		// overwriting removes the old blob
+		require.NoError(kvStore.Put(bucket1, testK1[1], large2))
+		require.Equal(1, blobs())
+		value, err = kvStore.Get(bucket1, testK1[1])
+		require.NoError(err)
+		require.Equal(large2, value)
+
+		// a blob shared by multiple records is removed with the last of them
+		batch := NewBatch()
+		batch.Put(bucket2, testK1[0], large2, "")
+		batch.Put(bucket2, testK1[1], large2, "")
+		require.NoError(kvStore.Commit(batch))
+		require.Equal(1, blobs())
+		require.NoError(kvStore.Delete(bucket1, testK1[1]))
+		require.NoError(kvStore.Delete(bucket2, testK1[0]))
+		require.Equal(1, blobs())
+		value, err = kvStore.Get(bucket2, testK1[1])
+		require.NoError(err)
+		require.Equal(large2, value)
+		require.NoError(kvStore.Delete(bucket2, testK1[1]))
+		require.Equal(0, blobs())
+		_, err = kvStore.Get(bucket2, testK1[1])
+		require.True(isNotExist(err))
+
+		// a failed commit leaves no blob behind
+		err = kvStore.PutIfNotExists(bucket1, testK1[0], large1)
+		require.Equal(ErrAlreadyExist, errors.Cause(err))
+		require.Equal(0, blobs())
+		value, err = kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+	}
+
+	dir, err := ioutil.TempDir("", "test-external-blobs")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		dbCfg.DbPath = filepath.Join(dir, "test.bolt")
+		dbCfg.UseBadgerDB = false
+		testExternalBlobs(dbCfg, filepath.Join(dir, "bolt-blobs"), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		dbCfg.DbPath = filepath.Join(dir, "test.badger")
+		dbCfg.UseBadgerDB = true
+		testExternalBlobs(dbCfg, filepath.Join(dir, "badger-blobs"), t)
+	})
+}
+
+func TestDedup(t *testing.T) {
+	testDedup := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		s := kvStore.(*blobKVStore)
+		large := bytes.Repeat([]byte{1}, 100)
+		h := hash.Hash256b(large)
+		refCount := func() uint64 {
+			count, err := s.refCount(h)
+			require.NoError(err)
+			return count
+		}
+		blob := func() []byte {
+			value, err := s.kvStore.Get(dedupNamespace, h)
+			if isNotExist(err) {
+				return nil
+			}
+			require.NoError(err)
+			return value
+		}
+
+		// the small value is kept in its record
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		value, err := kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+
+		// two keys sharing a value reference a single blob
+		require.NoError(kvStore.Put(bucket1, testK1[1], large))
+		require.NoError(kvStore.Put(bucket2, testK1[1], large))
+		require.Equal(uint64(2), refCount())
+		require.Equal(large, blob())
+		stored, err := s.kvStore.Get(bucket1, testK1[1])
+		require.NoError(err)
+		require.Equal(append([]byte{blobReference}, h...), stored)
+		for _, ns := range []string{bucket1, bucket2} {
+			value, err := kvStore.Get(ns, testK1[1])
+			require.NoError(err)
+			require.Equal(large, value)
+		}
+
+		// deleting one of them keeps the blob
+		require.NoError(kvStore.Delete(bucket1, testK1[1]))
+		require.Equal(uint64(1), refCount())
+		require.Equal(large, blob())
+		_, err = kvStore.Get(bucket1, testK1[1])
+		require.True(isNotExist(err))
+		value, err = kvStore.Get(bucket2, testK1[1])
+		require.NoError(err)
+		require.Equal(large, value)
+
+		// deleting both of them removes the blob
+		require.NoError(kvStore.Delete(bucket2, testK1[1]))
+		require.Equal(uint64(0), refCount())
+		require.Nil(blob())
+
+		// a failed commit writes no blob
+		err = kvStore.PutIfNotExists(bucket1, testK1[0], large)
+		require.Equal(ErrAlreadyExist, errors.Cause(err))
+		require.Equal(uint64(0), refCount())
+		require.Nil(blob())
+	}
+
+	dir, err := ioutil.TempDir("", "test-dedup")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testDedup(NewMemKVStore(WithDedup(16)), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		dbCfg.DbPath = filepath.Join(dir, "test.bolt")
+		dbCfg.UseBadgerDB = false
+		testDedup(NewOnDiskDB(dbCfg, WithDedup(16)), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		dbCfg.DbPath = filepath.Join(dir, "test.badger")
+		dbCfg.UseBadgerDB = true
+		testDedup(NewOnDiskDB(dbCfg, WithDedup(16)), t)
+	})
+}
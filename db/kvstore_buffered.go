@@ -0,0 +1,290 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/logger"
+)
+
+type (
+	// BufferedWriter commits batches to a KV store on a background goroutine
+	BufferedWriter interface {
+		// Start starts the KV store and the goroutine committing the batches
+		Start(context.Context) error
+		// Stop commits all batches queued, and then stops the KV store. It returns ErrDataLoss if a batch accepted by
+		// Write failed to commit since the writer started, even if the error was received from Errors
+		Stop(context.Context) error
+		// Write queues the batch to be committed, and blocks while the queue is full. The batch must not be used
+		// after being queued. It returns ErrInvalidDB if the writer is not started, or already stopped
+		Write(KVStoreBatch) error
+		// QueueDepth returns the number of batches waiting in the queue, excluding the one being committed
+		QueueDepth() int
+		// Errors returns the channel of the errors of failed commits, which is closed once the writer is stopped. An
+		// error is dropped if the channel is full, so it should be drained continuously
+		Errors() <-chan error
+		// Stats returns the throughput of the commits and whether the writer is under backpressure
+		Stats() WriterStats
+	}
+
+	// WriterStats is the statistics of a BufferedWriter
+	WriterStats struct {
+		// WritesPerSec is the number of batches committed per second over the last one to two seconds
+		WritesPerSec float64
+		// BytesPerSec is the ByteSize of the batches committed per second over the last one to two seconds
+		BytesPerSec float64
+		// QueueDepth is the number of batches waiting in the queue, excluding the one being committed
+		QueueDepth int
+		// Backpressure is whether the writer is under backpressure: from when a Write finds the queue full, until the
+		// queue drains to half of its size
+		Backpressure bool
+	}
+
+	// BufferedWriterOption sets an option of the buffered writer
+	BufferedWriterOption func(*bufferedWriter)
+
+	// bufferedWriter implements BufferedWriter with a buffered channel
+	bufferedWriter struct {
+		// mutex guards queue from being closed while a batch is being sent
+		mutex   sync.RWMutex
+		kvStore KVStore
+		queue   chan KVStoreBatch
+		errs    chan error
+		started bool
+		stopped bool
+		// failed is the number of batches failed to commit, only accessed by the goroutine committing the batches
+		// until it is done
+		failed uint64
+		wg     sync.WaitGroup
+		meter  rateMeter
+		// pressureMutex guards backpressure, and orders the calls of onBackpressure
+		pressureMutex  sync.Mutex
+		backpressure   bool
+		onBackpressure func(bool)
+	}
+
+	// rateMeter measures the rates of the commits over the current window and the one before, so that they are
+	// measured over one to two windows while a commit only adds to the counters
+	rateMeter struct {
+		mutex                 sync.Mutex
+		clk                   clock.Clock
+		start                 time.Time
+		writes, bytes         uint64
+		prevWrites, prevBytes uint64
+		prevDuration          time.Duration
+	}
+)
+
+// rateWindow is the window the rates of the commits of a BufferedWriter are measured over
+const rateWindow = time.Second
+
+// WithBackpressureHandler calls fn with true once the writer comes under backpressure, and with false once it is
+// relieved, so that the producers throttle themselves rather than block on Write. fn is called in order from the
+// goroutines writing and committing the batches, so it must return quickly and must not call Write
+func WithBackpressureHandler(fn func(bool)) BufferedWriterOption {
+	return func(w *bufferedWriter) {
+		w.onBackpressure = fn
+	}
+}
+
+// WithWriterClock sets the clock the rates of the commits are measured by, the real clock by default
+func WithWriterClock(clk clock.Clock) BufferedWriterOption {
+	return func(w *bufferedWriter) {
+		w.meter.clk = clk
+	}
+}
+
+// NewBufferedWriter returns a writer committing batches to the KV store in the order they are written, with up to
+// queueSize batches queued. This decouples the latency of producing batches from the latency of committing them,
+// while bounding the memory they take. A producer blocks while the queue is full, so a slow disk slows the producers
+// down instead of making the queue grow
+func NewBufferedWriter(kvStore KVStore, queueSize int, opts ...BufferedWriterOption) BufferedWriter {
+	w := &bufferedWriter{
+		kvStore: kvStore,
+		queue:   make(chan KVStoreBatch, queueSize),
+		errs:    make(chan error, queueSize+1),
+		meter:   rateMeter{clk: clock.New()},
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Start starts the KV store and the goroutine committing the batches
+func (w *bufferedWriter) Start(ctx context.Context) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.started {
+		return nil
+	}
+	if err := w.kvStore.Start(ctx); err != nil {
+		return err
+	}
+	w.started = true
+	w.meter.reset()
+	w.wg.Add(1)
+	go w.commit()
+	return nil
+}
+
+// Stop commits all batches queued, and then stops the KV store
+func (w *bufferedWriter) Stop(ctx context.Context) error {
+	// the producers blocked on a full queue hold the read lock, and are unblocked as the queue drains
+	w.mutex.Lock()
+	if !w.started || w.stopped {
+		w.mutex.Unlock()
+		return nil
+	}
+	w.stopped = true
+	close(w.queue)
+	w.mutex.Unlock()
+
+	w.wg.Wait()
+	close(w.errs)
+	err := w.kvStore.Stop(ctx)
+	if w.failed > 0 {
+		return stopError(errors.Wrapf(ErrDataLoss, "%d queued batches failed to commit", w.failed), err)
+	}
+	return err
+}
+
+// Write queues the batch to be committed
+func (w *bufferedWriter) Write(b KVStoreBatch) error {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	if !w.started || w.stopped {
+		return errors.Wrap(ErrInvalidDB, "buffered writer is not running")
+	}
+	if len(w.queue) == cap(w.queue) {
+		// it is cleared by the goroutine committing the batches once the queue drains
+		w.setBackpressure(true)
+	}
+	w.queue <- b
+	return nil
+}
+
+// QueueDepth returns the number of batches waiting in the queue, excluding the one being committed
+func (w *bufferedWriter) QueueDepth() int {
+	return len(w.queue)
+}
+
+// Errors returns the channel of the errors of failed commits
+func (w *bufferedWriter) Errors() <-chan error {
+	return w.errs
+}
+
+// Stats returns the throughput of the commits and whether the writer is under backpressure
+func (w *bufferedWriter) Stats() WriterStats {
+	w.pressureMutex.Lock()
+	backpressure := w.backpressure
+	w.pressureMutex.Unlock()
+	writes, bytes := w.meter.rates()
+	return WriterStats{
+		WritesPerSec: writes,
+		BytesPerSec:  bytes,
+		QueueDepth:   len(w.queue),
+		Backpressure: backpressure,
+	}
+}
+
+//======================================
+// private functions
+//======================================
+
+// commit commits the queued batches until the queue is closed and drained
+func (w *bufferedWriter) commit() {
+	defer w.wg.Done()
+	for b := range w.queue {
+		if len(w.queue) <= cap(w.queue)/2 {
+			w.setBackpressure(false)
+		}
+		// the batch is cleared once committed
+		size := b.ByteSize()
+		err := w.kvStore.Commit(b)
+		if err == nil {
+			w.meter.add(size)
+			continue
+		}
+		w.failed++
+		select {
+		case w.errs <- err:
+		default:
+			logger.Error().Err(err).Msg("Failed to commit queued batch, error channel is full.")
+		}
+	}
+}
+
+// setBackpressure sets whether the writer is under backpressure, and notifies the handler if it changes
+func (w *bufferedWriter) setBackpressure(backpressure bool) {
+	w.pressureMutex.Lock()
+	defer w.pressureMutex.Unlock()
+
+	if w.backpressure == backpressure {
+		return
+	}
+	w.backpressure = backpressure
+	if w.onBackpressure != nil {
+		w.onBackpressure(backpressure)
+	}
+}
+
+// reset starts measuring from now on
+func (m *rateMeter) reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.start = m.clk.Now()
+	m.writes, m.bytes, m.prevWrites, m.prevBytes, m.prevDuration = 0, 0, 0, 0, 0
+}
+
+// add counts a commit of the batch of the size
+func (m *rateMeter) add(size int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.roll(m.clk.Now())
+	m.writes++
+	m.bytes += uint64(size)
+}
+
+// rates returns the numbers of commits and of bytes committed per second
+func (m *rateMeter) rates() (float64, float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.clk.Now()
+	m.roll(now)
+	elapsed := (now.Sub(m.start) + m.prevDuration).Seconds()
+	if elapsed <= 0 {
+		return 0, 0
+	}
+	return float64(m.writes+m.prevWrites) / elapsed, float64(m.bytes+m.prevBytes) / elapsed
+}
+
+// roll starts a new window if the current one is over. A window over long ago is followed by idle ones, so the one
+// before the new window counts nothing
+func (m *rateMeter) roll(now time.Time) {
+	elapsed := now.Sub(m.start)
+	if elapsed < rateWindow {
+		return
+	}
+	if elapsed < 2*rateWindow {
+		m.prevWrites, m.prevBytes, m.prevDuration = m.writes, m.bytes, elapsed
+	} else {
+		m.prevWrites, m.prevBytes, m.prevDuration = 0, 0, rateWindow
+	}
+	m.writes, m.bytes, m.start = 0, 0, now
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/config"
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestBufferedWriter(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	inner := &slowKVStore{
+		KVStore: NewMemKVStore(),
+		resume:  make(chan struct{}),
+	}
+	writer := NewBufferedWriter(inner, 2)
+	require.Equal(ErrInvalidDB, errors.Cause(writer.Write(NewBatch())))
+	require.NoError(writer.Start(ctx))
+
+	batchOf := func(i int) KVStoreBatch {
+		batch := NewBatch()
+		batch.Put(bucket1, []byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i)), "")
+		return batch
+	}
+	// the first batch is being committed, and the next two fill the queue
+	require.NoError(writer.Write(batchOf(0)))
+	for writer.QueueDepth() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(writer.Write(batchOf(1)))
+	require.NoError(writer.Write(batchOf(2)))
+	require.Equal(2, writer.QueueDepth())
+
+	// the producer blocks while the queue is full
+	written := make(chan error)
+	go func() {
+		written <- writer.Write(batchOf(3))
+	}()
+	select {
+	case <-written:
+		require.Fail("write is not blocked by a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+	inner.resume <- struct{}{}
+	require.NoError(<-written)
+
+	// a failed commit is reported
+	close(inner.resume)
+	batch := NewBatch()
+	require.NoError(batch.PutIfNotExists(bucket1, []byte("key_0"), testV1[0], ""))
+	require.NoError(writer.Write(batch))
+
+	// stop commits all batches queued, and reports the batch failed to commit as lost
+	require.Equal(ErrDataLoss, errors.Cause(writer.Stop(ctx)))
+	for i := 0; i < 4; i++ {
+		value, err := inner.Get(bucket1, []byte(fmt.Sprintf("key_%d", i)))
+		require.NoError(err)
+		require.Equal([]byte(fmt.Sprintf("value_%d", i)), value)
+	}
+	err, ok := <-writer.Errors()
+	require.True(ok)
+	require.Equal(ErrAlreadyExist, errors.Cause(err))
+	_, ok = <-writer.Errors()
+	require.False(ok)
+
+	require.Equal(ErrInvalidDB, errors.Cause(writer.Write(batchOf(4))))
+	require.NoError(writer.Stop(ctx))
+}
+
+func TestBufferedWriterBackpressure(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	inner := &slowKVStore{
+		KVStore: NewMemKVStore(),
+		resume:  make(chan struct{}),
+	}
+	signals := make(chan bool, 8)
+	clk := clock.NewMock()
+	writer := NewBufferedWriter(inner, 4, WithBackpressureHandler(func(backpressure bool) {
+		signals <- backpressure
+	}), WithWriterClock(clk))
+	require.NoError(writer.Start(ctx))
+	require.Equal(WriterStats{}, writer.Stats())
+
+	batchOf := func(i int) KVStoreBatch {
+		batch := NewBatch()
+		batch.Put(bucket1, []byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i)), "")
+		return batch
+	}
+	// the first batch is being committed, the next four fill the queue, and the one after finds it full
+	require.NoError(writer.Write(batchOf(0)))
+	require.NoError(testutil.WaitUntil(time.Millisecond, time.Second, func() (bool, error) {
+		return writer.QueueDepth() == 0, nil
+	}))
+	for i := 1; i < 5; i++ {
+		require.NoError(writer.Write(batchOf(i)))
+	}
+	require.False(writer.Stats().Backpressure)
+	written := make(chan error)
+	go func() {
+		written <- writer.Write(batchOf(5))
+	}()
+	require.True(<-signals)
+	require.True(writer.Stats().Backpressure)
+
+	// the backpressure is relieved once the queue drains to half of its size
+	inner.resume <- struct{}{}
+	require.NoError(<-written)
+	inner.resume <- struct{}{}
+	require.NoError(testutil.WaitUntil(time.Millisecond, time.Second, func() (bool, error) {
+		return writer.QueueDepth() == 3, nil
+	}))
+	require.True(writer.Stats().Backpressure)
+	inner.resume <- struct{}{}
+	require.False(<-signals)
+	require.False(writer.Stats().Backpressure)
+
+	// the rates are of the batches committed over the time since the start
+	close(inner.resume)
+	clk.Add(500 * time.Millisecond)
+	size := float64(len(bucket1) + len("key_0") + len("value_0"))
+	require.NoError(testutil.WaitUntil(time.Millisecond, time.Second, func() (bool, error) {
+		return writer.Stats().WritesPerSec == 12, nil
+	}))
+	require.Equal(WriterStats{WritesPerSec: 12, BytesPerSec: 12 * size}, writer.Stats())
+	require.NoError(writer.Stop(ctx))
+	require.Empty(signals)
+}
+
+func TestBufferedWriterStopDurability(t *testing.T) {
+	testStopDurability := func(dbCfg config.DB, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		// the commits of BadgerDB are only fsynced by Stop
+		writer := NewBufferedWriter(NewOnDiskDB(dbCfg, WithGroupCommit(time.Hour)), 4)
+		require.NoError(writer.Start(ctx))
+		for i := 0; i < 100; i++ {
+			batch := NewBatch()
+			batch.Put(bucket1, []byte(fmt.Sprintf("key_%d", i)), []byte(fmt.Sprintf("value_%d", i)), "")
+			require.NoError(writer.Write(batch))
+		}
+		require.NoError(writer.Stop(ctx))
+
+		// every batch accepted is kept once Stop returns nil
+		kvStore := NewOnDiskDB(dbCfg)
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		for i := 0; i < 100; i++ {
+			value, err := kvStore.Get(bucket1, []byte(fmt.Sprintf("key_%d", i)))
+			require.NoError(err)
+			require.Equal([]byte(fmt.Sprintf("value_%d", i)), value)
+		}
+	}
+
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-stop-durability.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testStopDurability(dbCfg, t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-stop-durability.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testStopDurability(dbCfg, t)
+	})
+}
+
+func TestStopError(t *testing.T) {
+	require := require.New(t)
+
+	errClose := errors.New("failed to close")
+	errLoss := errors.Wrap(ErrDataLoss, "failed to fsync")
+	require.NoError(stopError(nil, nil))
+	require.Equal(errClose, stopError(nil, errClose))
+	require.Equal(errClose, stopError(errClose, errors.New("failed to close another")))
+	// a possible loss of data is not hidden by an earlier error
+	require.Equal(errLoss, stopError(errClose, errLoss))
+	require.Equal(errLoss, stopError(errLoss, errClose))
+}
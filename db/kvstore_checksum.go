@@ -0,0 +1,192 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/pkg/errors"
+)
+
+// checksumSize is the length of the checksum prefixed to each value of a checksummed namespace
+const checksumSize = 4
+
+// checksumTable is the table of the CRC-32 checksums of the values, Castagnoli being accelerated by most CPUs
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// checksumKVStore is a KV store prefixing each value of the checksummed namespaces with its checksum, which is
+// verified on every read
+type checksumKVStore struct {
+	kvStore    KVStore
+	namespaces map[string]struct{}
+}
+
+// newChecksumKVStore wraps the KV store to checksum the values of the namespaces
+func newChecksumKVStore(kvStore KVStore, namespaces []string) KVStore {
+	s := &checksumKVStore{
+		kvStore:    kvStore,
+		namespaces: make(map[string]struct{}, len(namespaces)),
+	}
+	for _, namespace := range namespaces {
+		s.namespaces[namespace] = struct{}{}
+	}
+	return s
+}
+
+// Start starts the underlying KV store
+func (s *checksumKVStore) Start(ctx context.Context) error {
+	return s.kvStore.Start(ctx)
+}
+
+// Stop stops the underlying KV store
+func (s *checksumKVStore) Stop(ctx context.Context) error {
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record
+func (s *checksumKVStore) Put(namespace string, key, value []byte) error {
+	return s.kvStore.Put(namespace, key, s.encode(namespace, value))
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (s *checksumKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	return s.kvStore.PutIfNotExists(namespace, key, s.encode(namespace, value))
+}
+
+// Get retrieves a record, and returns ErrChecksumMismatch if its value is corrupted
+func (s *checksumKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	stored, err := s.kvStore.Get(namespace, key)
+	if err != nil {
+		return nil, err
+	}
+	return s.decode(namespace, key, stored)
+}
+
+// Delete deletes a record
+func (s *checksumKVStore) Delete(namespace string, key []byte) error {
+	return s.kvStore.Delete(namespace, key)
+}
+
+// Commit commits the batch with the values of the checksummed namespaces prefixed with their checksums
+func (s *checksumKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	entries := make([]writeInfo, b.Size())
+	for i := range entries {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		_, checksummed := s.namespaces[write.namespace]
+		if write.writeType == AddCounter && checksummed {
+			return errors.Wrapf(ErrInvalidDB, "counters are not supported by checksummed namespace %s", write.namespace)
+		}
+		entries[i] = *write
+		if write.writeType != Delete && write.writeType != AddCounter {
+			entries[i].value = s.encode(write.namespace, write.value)
+		}
+	}
+	if err := s.kvStore.Commit(newBatchOf(entries)); err != nil {
+		return err
+	}
+	succeed = true
+	return nil
+}
+
+// SnapshotGet retrieves the records of the keys at the same point in time, and returns ErrChecksumMismatch if any of
+// their values is corrupted
+func (s *checksumKVStore) SnapshotGet(namespace string, keys [][]byte) ([][]byte, error) {
+	getter, ok := s.kvStore.(SnapshotGetter)
+	if !ok {
+		return nil, errors.Wrap(ErrInvalidDB, "KV store does not support snapshot reads")
+	}
+	values, err := getter.SnapshotGet(namespace, keys)
+	if err != nil {
+		return nil, err
+	}
+	for i, stored := range values {
+		if stored == nil {
+			continue
+		}
+		if values[i], err = s.decode(namespace, keys[i], stored); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// StreamAll calls fn on each record of the namespace, and returns ErrChecksumMismatch once a corrupted value is met
+func (s *checksumKVStore) StreamAll(namespace string, fn func([]byte, []byte) error) error {
+	streamer, ok := s.kvStore.(Streamer)
+	if !ok {
+		return errors.Wrap(ErrInvalidDB, "KV store does not support streaming")
+	}
+	return streamer.StreamAll(namespace, func(key, stored []byte) error {
+		value, err := s.decode(namespace, key, stored)
+		if err != nil {
+			return err
+		}
+		return fn(key, value)
+	})
+}
+
+// KeysPaged returns up to limit keys of the namespace after the cursor, which are not checksummed
+func (s *checksumKVStore) KeysPaged(namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	pager, ok := s.kvStore.(KeyPager)
+	if !ok {
+		return nil, nil, errors.Wrap(ErrInvalidDB, "KV store does not support listing keys")
+	}
+	return pager.KeysPaged(namespace, after, limit)
+}
+
+//======================================
+// private functions
+//======================================
+
+// underlying returns the KV store wrapped
+func (s *checksumKVStore) underlying() KVStore { return s.kvStore }
+
+// encode returns the value prefixed with its checksum if the namespace is checksummed
+func (s *checksumKVStore) encode(namespace string, value []byte) []byte {
+	if _, ok := s.namespaces[namespace]; !ok {
+		return value
+	}
+	stored := make([]byte, checksumSize, checksumSize+len(value))
+	binary.BigEndian.PutUint32(stored, crc32.Checksum(value, checksumTable))
+	return append(stored, value...)
+}
+
+// decode returns the value without its checksum if the namespace is checksummed, or ErrChecksumMismatch if the
+// checksum does not match the value
+func (s *checksumKVStore) decode(namespace string, key, stored []byte) ([]byte, error) {
+	if _, ok := s.namespaces[namespace]; !ok {
+		return stored, nil
+	}
+	if len(stored) < checksumSize {
+		return nil, errors.Wrapf(ErrChecksumMismatch, "value of key = %x of namespace %s has no checksum", key,
+			namespace)
+	}
+	value := stored[checksumSize:]
+	if crc32.Checksum(value, checksumTable) != binary.BigEndian.Uint32(stored) {
+		return nil, errors.Wrapf(ErrChecksumMismatch, "value of key = %x of namespace %s is corrupted", key, namespace)
+	}
+	return value, nil
+}
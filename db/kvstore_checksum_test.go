@@ -0,0 +1,98 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestChecksumKVStore(t *testing.T) {
+	testChecksum := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		raw := kvStore.(*checksumKVStore).kvStore
+
+		// the checksum round-trips, and only the values of the checksummed namespace carry one
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		batch := NewBatch()
+		batch.Put(bucket1, testK1[1], testV1[1], "")
+		batch.Put(bucket2, testK2[0], testV2[0], "")
+		require.NoError(kvStore.Commit(batch))
+		for i := 0; i < 2; i++ {
+			value, err := kvStore.Get(bucket1, testK1[i])
+			require.NoError(err)
+			require.Equal(testV1[i], value)
+			stored, err := raw.Get(bucket1, testK1[i])
+			require.NoError(err)
+			require.Len(stored, checksumSize+len(testV1[i]))
+		}
+		stored, err := raw.Get(bucket2, testK2[0])
+		require.NoError(err)
+		require.Equal(testV2[0], stored)
+
+		// a byte flipped in the stored value is detected by every read
+		stored, err = raw.Get(bucket1, testK1[1])
+		require.NoError(err)
+		corrupted := append([]byte(nil), stored...)
+		corrupted[len(corrupted)-1] ^= 0x01
+		require.NoError(raw.Put(bucket1, testK1[1], corrupted))
+		_, err = kvStore.Get(bucket1, testK1[1])
+		require.Equal(ErrChecksumMismatch, errors.Cause(err))
+		_, err = kvStore.(SnapshotGetter).SnapshotGet(bucket1, [][]byte{testK1[0], testK1[1]})
+		require.Equal(ErrChecksumMismatch, errors.Cause(err))
+		err = kvStore.(Streamer).StreamAll(bucket1, func([]byte, []byte) error { return nil })
+		require.Equal(ErrChecksumMismatch, errors.Cause(err))
+		require.NoError(raw.Put(bucket1, testK1[2], []byte{1}))
+		_, err = kvStore.Get(bucket1, testK1[2])
+		require.Equal(ErrChecksumMismatch, errors.Cause(err))
+
+		// the intact values are still read
+		values, err := kvStore.(SnapshotGetter).SnapshotGet(bucket1, [][]byte{testK1[0], testK2[1]})
+		require.NoError(err)
+		require.Equal([][]byte{testV1[0], nil}, values)
+
+		// counters are rejected in the checksummed namespace only
+		batch = NewBatch()
+		require.NoError(batch.AddCounter(bucket1, testK2[2], 1))
+		require.Equal(ErrInvalidDB, errors.Cause(kvStore.Commit(batch)))
+		batch = NewBatch()
+		require.NoError(batch.AddCounter(bucket2, testK2[1], 1))
+		require.NoError(kvStore.Commit(batch))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testChecksum(NewMemKVStore(WithChecksums(bucket1)), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-checksum.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testChecksum(NewOnDiskDB(dbCfg, WithChecksums(bucket1)), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-checksum.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testChecksum(NewOnDiskDB(dbCfg, WithChecksums(bucket1)), t)
+	})
+}
@@ -0,0 +1,405 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/iotexproject/iotex-core/logger"
+)
+
+// evictBatchSize is the number of records evicted in one commit
+const evictBatchSize = 64
+
+// evictPageSize is the number of keys listed at a time to track the records found on start
+const evictPageSize = 1024
+
+var evictedMtc = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "iotex_db_evicted_entries",
+		Help: "Number of records evicted to keep the DB within its size budget.",
+	},
+	[]string{"namespace"},
+)
+
+func init() {
+	prometheus.MustRegister(evictedMtc)
+}
+
+// EvictionPolicy is the order the records of the evictable namespaces are evicted in
+type EvictionPolicy int
+
+const (
+	// EvictLRU evicts the record least recently read or written first
+	EvictLRU EvictionPolicy = iota
+	// EvictOldest evicts the record written longest ago first
+	EvictOldest
+)
+
+type (
+	// evictKVStore is a KV store evicting the records of the evictable namespaces in the background once the DB grows
+	// beyond its budget
+	evictKVStore struct {
+		kvStore    KVStore
+		sizer      Sizer
+		pager      KeyPager
+		stamps     TimestampGetter
+		budget     int64
+		policy     EvictionPolicy
+		namespaces map[string]struct{}
+		// writeMutex is read locked by the writes and locked by an eviction, so that a record written meanwhile is
+		// never evicted by a commit choosing it before the write
+		writeMutex sync.RWMutex
+		// mutex guards the order the records are evicted in, front first
+		mutex   sync.Mutex
+		order   *list.List
+		entries map[cacheKey]*list.Element
+		// warned is whether the DB is warned of being beyond the budget with nothing left to evict
+		warned bool
+		check  chan struct{}
+		done   chan struct{}
+		wg     sync.WaitGroup
+	}
+
+	// evictSeed is a record found on start, with the time it is written at if known
+	evictSeed struct {
+		key cacheKey
+		ts  time.Time
+	}
+)
+
+// newEvictKVStore wraps the KV store to keep the DB of the backend within the budget of the options. The keys found
+// on start are listed from the backend, and their timestamps read from stamps if not nil
+func newEvictKVStore(kvStore, backend KVStore, stamps TimestampGetter, options kvStoreOptions) KVStore {
+	s := &evictKVStore{
+		kvStore:    kvStore,
+		stamps:     stamps,
+		budget:     options.sizeBudget,
+		policy:     options.evictionPolicy,
+		namespaces: make(map[string]struct{}, len(options.evictableNamespaces)),
+		order:      list.New(),
+		entries:    make(map[cacheKey]*list.Element),
+	}
+	s.sizer, _ = backend.(Sizer)
+	s.pager, _ = backend.(KeyPager)
+	for _, namespace := range options.evictableNamespaces {
+		s.namespaces[namespace] = struct{}{}
+	}
+	return s
+}
+
+// Start starts the underlying KV store, tracks the records of the evictable namespaces in it, and starts the
+// background eviction, checking the size right away
+func (s *evictKVStore) Start(ctx context.Context) error {
+	if s.sizer == nil || s.pager == nil {
+		return errors.Wrap(ErrInvalidDB, "KV store does not support size limit")
+	}
+	if err := s.kvStore.Start(ctx); err != nil {
+		return err
+	}
+	if err := s.seed(); err != nil {
+		if stopErr := s.kvStore.Stop(ctx); stopErr != nil {
+			logger.Error().Err(stopErr).Msg("Failed to stop the KV store failing to track its evictable records.")
+		}
+		return err
+	}
+	s.check = make(chan struct{}, 1)
+	s.done = make(chan struct{})
+	s.wg.Add(1)
+	go s.evictLoop()
+	s.signal()
+	return nil
+}
+
+// Stop stops the background eviction and the underlying KV store
+func (s *evictKVStore) Stop(ctx context.Context) error {
+	if s.done != nil {
+		close(s.done)
+		s.wg.Wait()
+		s.done = nil
+	}
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record
+func (s *evictKVStore) Put(namespace string, key, value []byte) error {
+	s.writeMutex.RLock()
+	defer s.writeMutex.RUnlock()
+
+	if err := s.kvStore.Put(namespace, key, value); err != nil {
+		return err
+	}
+	s.touch(namespace, key)
+	s.signal()
+	return nil
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (s *evictKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	s.writeMutex.RLock()
+	defer s.writeMutex.RUnlock()
+
+	if err := s.kvStore.PutIfNotExists(namespace, key, value); err != nil {
+		return err
+	}
+	s.touch(namespace, key)
+	s.signal()
+	return nil
+}
+
+// Get retrieves a record, which makes it the most recently used one in EvictLRU
+func (s *evictKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	value, err := s.kvStore.Get(namespace, key)
+	if err != nil {
+		return nil, err
+	}
+	if s.policy == EvictLRU {
+		s.touch(namespace, key)
+	}
+	return value, nil
+}
+
+// Delete deletes a record
+func (s *evictKVStore) Delete(namespace string, key []byte) error {
+	s.writeMutex.RLock()
+	defer s.writeMutex.RUnlock()
+
+	if err := s.kvStore.Delete(namespace, key); err != nil {
+		return err
+	}
+	s.forget(namespace, key)
+	return nil
+}
+
+// Commit commits the batch, and tracks the records of the evictable namespaces it writes
+func (s *evictKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	entries := make([]writeInfo, b.Size())
+	for i := range entries {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		entries[i] = *write
+	}
+	s.writeMutex.RLock()
+	defer s.writeMutex.RUnlock()
+
+	if err := s.kvStore.Commit(newBatchOf(entries)); err != nil {
+		return err
+	}
+	for _, write := range entries {
+		if write.writeType == Delete {
+			s.forget(write.namespace, write.key)
+		} else {
+			s.touch(write.namespace, write.key)
+		}
+	}
+	succeed = true
+	s.signal()
+	return nil
+}
+
+// Size returns the size of the DB of the backend
+func (s *evictKVStore) Size() (int64, error) {
+	return s.sizer.Size()
+}
+
+//======================================
+// private functions
+//======================================
+
+// underlying returns the KV store wrapped
+func (s *evictKVStore) underlying() KVStore { return s.kvStore }
+
+// seed tracks the records of the evictable namespaces found on start ahead of those written afterwards. In
+// EvictOldest they are ordered by the time they are written at if the namespace is timestamped, otherwise the order of
+// their last use is unknown, and they are taken in key order
+func (s *evictKVStore) seed() error {
+	namespaces := make([]string, 0, len(s.namespaces))
+	for namespace := range s.namespaces {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	var seeds []evictSeed
+	for _, namespace := range namespaces {
+		after := []byte{}
+		for after != nil {
+			keys, next, err := s.pager.KeysPaged(namespace, after, evictPageSize)
+			if isNotExist(err) {
+				break
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed to list keys of namespace %s", namespace)
+			}
+			for _, key := range keys {
+				seed := evictSeed{key: cacheKey{namespace: namespace, key: string(key)}}
+				if s.policy == EvictOldest && s.stamps != nil {
+					if _, seed.ts, err = s.stamps.GetWithTimestamp(namespace, key); err != nil {
+						return errors.Wrapf(err, "failed to get timestamp of key = %x", key)
+					}
+				}
+				seeds = append(seeds, seed)
+			}
+			after = next
+		}
+	}
+	sort.SliceStable(seeds, func(i, j int) bool {
+		return seeds[i].ts.Before(seeds[j].ts)
+	})
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.order.Init()
+	s.entries = make(map[cacheKey]*list.Element, len(seeds))
+	for _, seed := range seeds {
+		s.entries[seed.key] = s.order.PushBack(seed.key)
+	}
+	return nil
+}
+
+// touch makes the record of an evictable namespace the last to evict
+func (s *evictKVStore) touch(namespace string, key []byte) {
+	if _, ok := s.namespaces[namespace]; !ok {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	k := cacheKey{namespace: namespace, key: string(key)}
+	if elem, ok := s.entries[k]; ok {
+		s.order.MoveToBack(elem)
+		return
+	}
+	s.entries[k] = s.order.PushBack(k)
+}
+
+// forget stops tracking the deleted record
+func (s *evictKVStore) forget(namespace string, key []byte) {
+	if _, ok := s.namespaces[namespace]; !ok {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	k := cacheKey{namespace: namespace, key: string(key)}
+	if elem, ok := s.entries[k]; ok {
+		s.order.Remove(elem)
+		delete(s.entries, k)
+	}
+}
+
+// signal asks the background eviction to check the size, unless a check is pending already
+func (s *evictKVStore) signal() {
+	select {
+	case s.check <- struct{}{}:
+	default:
+	}
+}
+
+// evictLoop checks the size each time it is signaled until the KV store is stopped
+func (s *evictKVStore) evictLoop() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.check:
+			if err := s.evict(); err != nil {
+				logger.Error().Err(err).Msg("Failed to evict records to keep the DB within its size budget.")
+			}
+		}
+	}
+}
+
+// evict evicts the records in order, a batch at a time, until the DB is within the budget or there is nothing left
+// to evict
+func (s *evictKVStore) evict() error {
+	for {
+		select {
+		case <-s.done:
+			return nil
+		default:
+		}
+		size, err := s.sizer.Size()
+		if err != nil {
+			return err
+		}
+		if size <= s.budget {
+			s.warned = false
+			return nil
+		}
+		evicted, err := s.evictBatch()
+		if err != nil {
+			return err
+		}
+		if evicted == 0 {
+			if !s.warned {
+				s.warned = true
+				logger.Warn().
+					Int64("size", size).
+					Int64("budget", s.budget).
+					Msg("DB is beyond its size budget with no evictable record left.")
+			}
+			return nil
+		}
+	}
+}
+
+// evictBatch deletes the first records in order in one commit, and returns the number of them
+func (s *evictKVStore) evictBatch() (int, error) {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	s.mutex.Lock()
+	victims := make([]cacheKey, 0, evictBatchSize)
+	for elem := s.order.Front(); elem != nil && len(victims) < evictBatchSize; elem = elem.Next() {
+		victims = append(victims, elem.Value.(cacheKey))
+	}
+	s.mutex.Unlock()
+	if len(victims) == 0 {
+		return 0, nil
+	}
+
+	batch := NewBatch()
+	for _, victim := range victims {
+		if err := batch.Delete(victim.namespace, []byte(victim.key), "failed to evict key = %x",
+			[]byte(victim.key)); err != nil {
+			return 0, err
+		}
+	}
+	if err := s.kvStore.Commit(batch); err != nil {
+		return 0, errors.Wrap(err, "failed to commit eviction")
+	}
+	for _, victim := range victims {
+		s.forget(victim.namespace, []byte(victim.key))
+		evictedMtc.WithLabelValues(victim.namespace).Inc()
+	}
+	return len(victims), nil
+}
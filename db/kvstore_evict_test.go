@@ -0,0 +1,125 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestSizeLimit(t *testing.T) {
+	const budget, records = 256 << 10, 1024
+	value := bytes.Repeat([]byte{0xab}, 1024)
+
+	// shrinks is whether the size of the DB shrinks as soon as records are evicted
+	testSizeLimit := func(kvStore KVStore, shrinks bool, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		sizer, ok := kvStore.(Sizer)
+		require.True(ok)
+
+		for i := 0; i < 16; i++ {
+			require.NoError(kvStore.Put(bucket2, []byte(fmt.Sprintf("protected_%02d", i)), value))
+		}
+		for i := 0; i < records; i++ {
+			require.NoError(kvStore.Put(bucket1, []byte(fmt.Sprintf("evictable_%04d", i)), value))
+		}
+		last := []byte(fmt.Sprintf("evictable_%04d", records-1))
+
+		require.NoError(testutil.WaitUntil(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+			if !shrinks {
+				// the evictable namespace is emptied, but the files only shrink once compacted
+				_, err := kvStore.Get(bucket1, last)
+				return isNotExist(err), nil
+			}
+			size, err := sizer.Size()
+			return size <= budget, err
+		}))
+
+		// the records written first are evicted first, and the protected records are all kept
+		_, err := kvStore.Get(bucket1, []byte("evictable_0000"))
+		require.True(isNotExist(err))
+		if shrinks {
+			v, err := kvStore.Get(bucket1, last)
+			require.NoError(err)
+			require.Equal(value, v)
+		}
+		for i := 0; i < 16; i++ {
+			v, err := kvStore.Get(bucket2, []byte(fmt.Sprintf("protected_%02d", i)))
+			require.NoError(err)
+			require.Equal(value, v)
+		}
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testSizeLimit(NewMemKVStore(WithSizeLimit(budget, EvictOldest, bucket1)), true, t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-size-limit.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testSizeLimit(NewOnDiskDB(dbCfg, WithSizeLimit(budget, EvictOldest, bucket1)), true, t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-size-limit.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testSizeLimit(NewOnDiskDB(dbCfg, WithSizeLimit(budget, EvictOldest, bucket1)), false, t)
+	})
+}
+
+func TestSizeLimitLRU(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	// the budget holds 200 records of the evictable namespace besides the protected one
+	value := bytes.Repeat([]byte{0xcd}, 100)
+	budget := int64(200*(len("key_000")+len(value)) + len(testK2[0]) + len(value))
+	kvStore := NewMemKVStore(WithSizeLimit(budget, EvictLRU, bucket1))
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	require.NoError(kvStore.Put(bucket2, testK2[0], value))
+	for i := 0; i < 200; i++ {
+		require.NoError(kvStore.Put(bucket1, []byte(fmt.Sprintf("key_%03d", i)), value))
+	}
+
+	// a record read recently survives the eviction of those written after it
+	_, err := kvStore.Get(bucket1, []byte("key_000"))
+	require.NoError(err)
+	for i := 200; i < 300; i++ {
+		require.NoError(kvStore.Put(bucket1, []byte(fmt.Sprintf("key_%03d", i)), value))
+	}
+	require.NoError(testutil.WaitUntil(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		size, err := kvStore.(Sizer).Size()
+		return size <= budget, err
+	}))
+	_, err = kvStore.Get(bucket1, []byte("key_001"))
+	require.True(isNotExist(err))
+	_, err = kvStore.Get(bucket1, []byte("key_000"))
+	require.NoError(err)
+	_, err = kvStore.Get(bucket2, testK2[0])
+	require.NoError(err)
+}
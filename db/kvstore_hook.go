@@ -0,0 +1,124 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// HookedKVStore is a KV store running hooks around every commit
+	HookedKVStore interface {
+		KVStore
+		// RegisterCommitHook registers a pair of hooks, either of which may be nil. pre runs before the batch is
+		// written, and aborts the commit if it returns an error. post runs after the batch is committed successfully,
+		// with a copy of the committed entries. Hooks run in registration order, and both run under the commit lock,
+		// so commits are seen by the hooks in the order they are applied. Hooks must not write to the KV store, and
+		// pre must not modify the batch
+		RegisterCommitHook(pre func(KVStoreBatch) error, post func(KVStoreBatch))
+	}
+
+	// commitHook is a pair of hooks registered by RegisterCommitHook
+	commitHook struct {
+		pre  func(KVStoreBatch) error
+		post func(KVStoreBatch)
+	}
+
+	// hookedKVStore implements HookedKVStore on top of a KV store
+	hookedKVStore struct {
+		KVStore
+		// mutex is the commit lock, which serializes the writes
+		mutex      sync.Mutex
+		hooksMutex sync.RWMutex
+		hooks      []commitHook
+	}
+)
+
+// NewHookedKVStore wraps the KV store to run commit hooks. Put, PutIfNotExists and Delete are committed as batches of
+// one entry, so the hooks see every write made through the KV store
+func NewHookedKVStore(kvStore KVStore) HookedKVStore {
+	return &hookedKVStore{KVStore: kvStore}
+}
+
+// RegisterCommitHook registers a pair of hooks
+func (h *hookedKVStore) RegisterCommitHook(pre func(KVStoreBatch) error, post func(KVStoreBatch)) {
+	h.hooksMutex.Lock()
+	defer h.hooksMutex.Unlock()
+	h.hooks = append(h.hooks, commitHook{pre: pre, post: post})
+}
+
+// Put inserts a <key, value> record
+func (h *hookedKVStore) Put(namespace string, key, value []byte) error {
+	batch := NewBatch()
+	batch.Put(namespace, key, value, "failed to put key = %x", key)
+	return h.Commit(batch)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (h *hookedKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	batch := NewBatch()
+	if err := batch.PutIfNotExists(namespace, key, value, "failed to put key = %x", key); err != nil {
+		return err
+	}
+	return h.Commit(batch)
+}
+
+// Delete deletes a record
+func (h *hookedKVStore) Delete(namespace string, key []byte) error {
+	batch := NewBatch()
+	batch.Delete(namespace, key, "failed to delete key = %x", key)
+	return h.Commit(batch)
+}
+
+// Commit runs the pre hooks, commits the batch, and runs the post hooks upon success. The batch must not be modified
+// while being committed
+func (h *hookedKVStore) Commit(b KVStoreBatch) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.hooksMutex.RLock()
+	hooks := h.hooks
+	h.hooksMutex.RUnlock()
+
+	b.Lock()
+	if b.committed() {
+		b.Unlock()
+		return ErrBatchAlreadyCommitted
+	}
+	for _, hook := range hooks {
+		if hook.pre == nil {
+			continue
+		}
+		if err := hook.pre(b); err != nil {
+			b.Unlock()
+			return errors.Wrap(err, "commit is aborted by pre-commit hook")
+		}
+	}
+	// the batch is cleared once committed, so the post hooks see a copy
+	entries := make([]writeInfo, b.Size())
+	for i := range entries {
+		write, err := b.Entry(i)
+		if err != nil {
+			b.Unlock()
+			return err
+		}
+		entries[i] = *write
+	}
+	b.Unlock()
+
+	if err := h.KVStore.Commit(b); err != nil {
+		return err
+	}
+	committed := newBatchOf(entries)
+	for _, hook := range hooks {
+		if hook.post != nil {
+			hook.post(committed)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitHooks(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	inner := NewMemKVStore()
+	kvStore := NewHookedKVStore(inner)
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+
+	var calls []string
+	errAbort := errors.New("abort")
+	abort := false
+	kvStore.RegisterCommitHook(func(b KVStoreBatch) error {
+		calls = append(calls, "pre1")
+		if abort {
+			return errAbort
+		}
+		return nil
+	}, func(b KVStoreBatch) {
+		calls = append(calls, "post1")
+		// the post hook sees the committed state and entries
+		require.Equal(2, b.Size())
+		for i := 0; i < b.Size(); i++ {
+			write, err := b.Entry(i)
+			require.NoError(err)
+			value, err := inner.Get(write.namespace, write.key)
+			require.NoError(err)
+			require.Equal(write.value, value)
+		}
+	})
+	kvStore.RegisterCommitHook(func(b KVStoreBatch) error {
+		calls = append(calls, "pre2")
+		return nil
+	}, nil)
+	kvStore.RegisterCommitHook(nil, func(b KVStoreBatch) {
+		calls = append(calls, "post3")
+	})
+
+	batch := NewBatch()
+	batch.Put(bucket1, testK1[0], testV1[0], "")
+	batch.Put(bucket1, testK1[1], testV1[1], "")
+	require.NoError(kvStore.Commit(batch))
+	require.Equal([]string{"pre1", "pre2", "post1", "post3"}, calls)
+	require.Equal(0, batch.Size())
+
+	// a failing pre hook aborts the commit, and the later hooks do not run
+	calls = nil
+	abort = true
+	batch.Put(bucket1, testK1[0], testV1[2], "")
+	batch.Put(bucket1, testK1[2], testV1[2], "")
+	require.Equal(errAbort, errors.Cause(kvStore.Commit(batch)))
+	require.Equal([]string{"pre1"}, calls)
+	require.Equal(2, batch.Size())
+	value, err := inner.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], value)
+	_, err = inner.Get(bucket1, testK1[2])
+	require.Error(err)
+
+	// a failed commit does not run the post hooks
+	calls = nil
+	abort = false
+	require.Equal(ErrAlreadyExist, errors.Cause(kvStore.PutIfNotExists(bucket1, testK1[0], testV1[1])))
+	require.Equal([]string{"pre1", "pre2"}, calls)
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+)
+
+const (
+	// hotKeySlots is the number of slots the window is divided into, the oldest of which is dropped as a whole when
+	// the window slides past it
+	hotKeySlots = 8
+	// hotKeyMaxTracked is the number of distinct keys counted per slot, the keys first accessed beyond it in the slot
+	// are not counted, so that the memory taken is bounded however many keys are accessed
+	hotKeyMaxTracked = 4096
+)
+
+type (
+	// HotKeyReporter is the interface of KV store which reports the keys accessed the most
+	HotKeyReporter interface {
+		// HotKeys returns up to n keys of the namespace accessed the most within the window, by decreasing count
+		HotKeys(namespace string, n int) ([]KeyStat, error)
+	}
+
+	// KeyStat is the number of accesses of a key
+	KeyStat struct {
+		Key []byte
+		// Count is the estimated number of accesses within the window, i.e. the accesses sampled times the sample rate
+		Count uint64
+	}
+
+	// hotKeySlot is the accesses sampled within a slot of the window
+	hotKeySlot struct {
+		// epoch is the number of slot lengths from the zero time to the start of the slot
+		epoch  int64
+		counts map[cacheKey]uint64
+	}
+
+	// hotKeyKVStore is a KV store counting a sample of the accesses of each key over a sliding window
+	hotKeyKVStore struct {
+		kvStore    KVStore
+		clk        clock.Clock
+		slotLength time.Duration
+		sampleRate uint64
+		// accesses is the number of accesses so far, every sampleRate-th of which is sampled
+		accesses uint64
+		// mutex guards the slots, which are used as a ring indexed by epoch
+		mutex sync.Mutex
+		slots [hotKeySlots]hotKeySlot
+	}
+)
+
+// newHotKeyKVStore wraps the KV store to count one in sampleRate accesses of each key over the window
+func newHotKeyKVStore(kvStore KVStore, window time.Duration, sampleRate int, clk clock.Clock) KVStore {
+	if sampleRate < 1 {
+		sampleRate = 1
+	}
+	slotLength := window / hotKeySlots
+	if slotLength <= 0 {
+		slotLength = 1
+	}
+	return &hotKeyKVStore{
+		kvStore:    kvStore,
+		clk:        clk,
+		slotLength: slotLength,
+		sampleRate: uint64(sampleRate),
+	}
+}
+
+// Start starts the underlying KV store
+func (s *hotKeyKVStore) Start(ctx context.Context) error {
+	return s.kvStore.Start(ctx)
+}
+
+// Stop stops the underlying KV store
+func (s *hotKeyKVStore) Stop(ctx context.Context) error {
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record
+func (s *hotKeyKVStore) Put(namespace string, key, value []byte) error {
+	s.sample(namespace, key)
+	return s.kvStore.Put(namespace, key, value)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (s *hotKeyKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	s.sample(namespace, key)
+	return s.kvStore.PutIfNotExists(namespace, key, value)
+}
+
+// Get retrieves a record
+func (s *hotKeyKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	s.sample(namespace, key)
+	return s.kvStore.Get(namespace, key)
+}
+
+// Delete deletes a record
+func (s *hotKeyKVStore) Delete(namespace string, key []byte) error {
+	s.sample(namespace, key)
+	return s.kvStore.Delete(namespace, key)
+}
+
+// Commit commits a batch, each entry of which is an access of its key
+func (s *hotKeyKVStore) Commit(b KVStoreBatch) error {
+	b.Lock()
+	for i := 0; i < b.Size(); i++ {
+		write, err := b.Entry(i)
+		if err != nil {
+			b.Unlock()
+			return err
+		}
+		s.sample(write.namespace, write.key)
+	}
+	b.Unlock()
+	return s.kvStore.Commit(b)
+}
+
+// HotKeys sums up the accesses of the keys of the namespace sampled within the slots of the window
+func (s *hotKeyKVStore) HotKeys(namespace string, n int) ([]KeyStat, error) {
+	if n <= 0 {
+		return nil, errors.Wrapf(ErrInvalidDB, "invalid number of hot keys %d", n)
+	}
+	s.mutex.Lock()
+	epoch := s.epoch()
+	totals := make(map[string]uint64)
+	for _, slot := range s.slots {
+		if slot.epoch <= epoch-hotKeySlots || slot.epoch > epoch {
+			continue
+		}
+		for k, count := range slot.counts {
+			if k.namespace == namespace {
+				totals[k.key] += count
+			}
+		}
+	}
+	s.mutex.Unlock()
+
+	stats := make([]KeyStat, 0, len(totals))
+	for key, count := range totals {
+		stats = append(stats, KeyStat{Key: []byte(key), Count: count * s.sampleRate})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count
+		}
+		return bytes.Compare(stats[i].Key, stats[j].Key) < 0
+	})
+	if len(stats) > n {
+		stats = stats[:n]
+	}
+	return stats, nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// underlying returns the KV store wrapped
+func (s *hotKeyKVStore) underlying() KVStore { return s.kvStore }
+
+// sample counts the access of the key if it is the sampleRate-th since the last one counted
+func (s *hotKeyKVStore) sample(namespace string, key []byte) {
+	if atomic.AddUint64(&s.accesses, 1)%s.sampleRate != 0 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	epoch := s.epoch()
+	slot := &s.slots[epoch%hotKeySlots]
+	if slot.epoch != epoch || slot.counts == nil {
+		// the slot is of a window slid past, or never used
+		slot.epoch = epoch
+		slot.counts = make(map[cacheKey]uint64)
+	}
+	k := cacheKey{namespace: namespace, key: string(key)}
+	if _, ok := slot.counts[k]; ok || len(slot.counts) < hotKeyMaxTracked {
+		slot.counts[k]++
+	}
+}
+
+// epoch returns the epoch of the slot of the current time
+func (s *hotKeyKVStore) epoch() int64 {
+	return s.clk.Now().UnixNano() / int64(s.slotLength)
+}
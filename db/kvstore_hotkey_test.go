@@ -0,0 +1,100 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestHotKeys(t *testing.T) {
+	testHotKeys := func(newKVStore func(...KVStoreOption) KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		clk := clock.NewMock()
+		kvStore := newKVStore(WithHotKeyTracking(8*time.Second, 3), WithClock(clk))
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		reporter := kvStore.(HotKeyReporter)
+		key := func(i int) []byte { return []byte(fmt.Sprintf("key-%d", i)) }
+
+		// a few keys are hammered among many accessed once, over most of the window
+		require.NoError(kvStore.Put(bucket1, key(0), testV1[0]))
+		for i := 0; i < 100; i++ {
+			require.NoError(kvStore.Put(bucket1, key(100+i), testV1[0]))
+		}
+		for round := 0; round < 6; round++ {
+			for i := 0; i < 200; i++ {
+				_, err := kvStore.Get(bucket1, key(0))
+				require.NoError(err)
+			}
+			for i := 0; i < 100; i++ {
+				require.NoError(kvStore.Put(bucket1, key(1), testV1[0]))
+			}
+			batch := NewBatch()
+			for i := 0; i < 50; i++ {
+				require.NoError(batch.Put(bucket1, key(2), testV1[1], ""))
+			}
+			require.NoError(kvStore.Commit(batch))
+			clk.Add(time.Second)
+		}
+		require.NoError(kvStore.Put(bucket2, key(0), testV2[0]))
+
+		hot, err := reporter.HotKeys(bucket1, 3)
+		require.NoError(err)
+		require.Len(hot, 3)
+		require.Equal(key(0), hot[0].Key)
+		require.Equal(key(1), hot[1].Key)
+		require.Equal(key(2), hot[2].Key)
+		// the counts are estimated from one in three accesses
+		require.InDelta(1200, float64(hot[0].Count), 18)
+		require.InDelta(600, float64(hot[1].Count), 18)
+		require.InDelta(300, float64(hot[2].Count), 18)
+		hot, err = reporter.HotKeys(bucket2, 10)
+		require.NoError(err)
+		require.True(len(hot) <= 1)
+
+		// the accesses age out once the window slides past them
+		clk.Add(8 * time.Second)
+		hot, err = reporter.HotKeys(bucket1, 3)
+		require.NoError(err)
+		require.Empty(hot)
+		_, err = reporter.HotKeys(bucket1, 0)
+		require.Error(err)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testHotKeys(NewMemKVStore, t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-hot-keys.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testHotKeys(func(opts ...KVStoreOption) KVStore { return NewOnDiskDB(dbCfg, opts...) }, t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-hot-keys.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testHotKeys(func(opts ...KVStoreOption) KVStore { return NewOnDiskDB(dbCfg, opts...) }, t)
+	})
+}
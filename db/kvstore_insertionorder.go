@@ -0,0 +1,322 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// insertionOrderNamespace is the namespace keeping the key written at each sequence of each ordered namespace,
+	// keyed by the tag of the namespace and the sequence, and the next sequence of each, keyed by the tag alone
+	insertionOrderNamespace = "insertionOrder"
+	// insertionPositionNamespace is the namespace keeping the sequence of each key of each ordered namespace, keyed
+	// by the tag of the namespace and the key
+	insertionPositionNamespace = "insertionPosition"
+	// insertionOrderPageSize is the number of sequences listed at once when iterating in insertion order
+	insertionOrderPageSize = 256
+)
+
+// OverwritePosition is the position in insertion order a key takes when it is written again
+type OverwritePosition int
+
+const (
+	// KeepPosition keeps an overwritten key at the position it is first written at
+	KeepPosition OverwritePosition = iota
+	// MoveToEnd moves an overwritten key to the end, as if it is written for the first time
+	MoveToEnd
+)
+
+// InsertionOrderIterator is the interface of KV store which is able to visit the records of a namespace in the
+// order they are written rather than in the order of their keys
+type InsertionOrderIterator interface {
+	// IterateInsertionOrder calls fn on each record of the namespace in the order it is written, until fn returns an
+	// error, which IterateInsertionOrder returns. The records are read page by page rather than at a single point in
+	// time, so a record deleted meanwhile may be skipped, and one written meanwhile may be visited
+	IterateInsertionOrder(string, func([]byte, []byte) error) error
+}
+
+// insertionOrderKVStore is a KV store keeping the order the keys of the ordered namespaces are written in, as a
+// shadow index of sequences to keys written in the same commit as the records
+type insertionOrderKVStore struct {
+	kvStore KVStore
+	pager   KeyPager
+	// mutex serializes the writes to the ordered namespaces, so that two commits never take the same sequence or
+	// both move the same key
+	mutex     sync.Mutex
+	overwrite map[string]OverwritePosition
+	next      map[string]uint64
+}
+
+// newInsertionOrderKVStore wraps the KV store to keep the insertion order of the namespaces, listing the shadow index
+// from the backend
+func newInsertionOrderKVStore(kvStore, backend KVStore, overwrite map[string]OverwritePosition) KVStore {
+	s := &insertionOrderKVStore{
+		kvStore:   kvStore,
+		overwrite: overwrite,
+		next:      make(map[string]uint64, len(overwrite)),
+	}
+	s.pager, _ = backend.(KeyPager)
+	return s
+}
+
+// Start starts the underlying KV store, creates the namespaces of the shadow index, and reads the next sequence of
+// each ordered namespace
+func (s *insertionOrderKVStore) Start(ctx context.Context) error {
+	if s.pager == nil {
+		return errors.Wrap(ErrInvalidDB, "KV store does not support insertion order")
+	}
+	if err := s.kvStore.Start(ctx); err != nil {
+		return err
+	}
+	for _, namespace := range []string{insertionOrderNamespace, insertionPositionNamespace} {
+		if err := createReservedNamespace(s.kvStore, namespace); err != nil {
+			return err
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for namespace := range s.overwrite {
+		value, err := s.kvStore.Get(insertionOrderNamespace, insertionOrderTag(namespace))
+		if isNotExist(err) {
+			s.next[namespace] = 0
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to read next sequence of namespace %s", namespace)
+		}
+		if len(value) != 8 {
+			return errors.Wrapf(ErrInvalidDB, "malformed next sequence of namespace %s", namespace)
+		}
+		s.next[namespace] = binary.BigEndian.Uint64(value)
+	}
+	return nil
+}
+
+// Stop stops the underlying KV store
+func (s *insertionOrderKVStore) Stop(ctx context.Context) error {
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record
+func (s *insertionOrderKVStore) Put(namespace string, key, value []byte) error {
+	batch := NewBatch()
+	batch.Put(namespace, key, value, "failed to put key = %x", key)
+	return s.Commit(batch)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (s *insertionOrderKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	batch := NewBatch()
+	batch.PutIfNotExists(namespace, key, value, "failed to put key = %x", key)
+	return s.Commit(batch)
+}
+
+// Get retrieves a record
+func (s *insertionOrderKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	return s.kvStore.Get(namespace, key)
+}
+
+// Delete deletes a record along with its position in insertion order
+func (s *insertionOrderKVStore) Delete(namespace string, key []byte) error {
+	batch := NewBatch()
+	batch.Delete(namespace, key, "failed to delete key = %x", key)
+	return s.Commit(batch)
+}
+
+// Commit commits the batch along with the updates of the insertion order of the ordered namespaces it writes, so that
+// the shadow index never diverges from the records
+func (s *insertionOrderKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	entries := make([]writeInfo, b.Size())
+	for i := range entries {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		entries[i] = *write
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	next := make(map[string]uint64)
+	// positions is the sequence of each key written by the batch so far, absent if it has none left
+	positions := make(map[cacheKey][]byte)
+	ordered := len(entries)
+	for i := 0; i < ordered; i++ {
+		write := entries[i]
+		overwrite, ok := s.overwrite[write.namespace]
+		if !ok {
+			continue
+		}
+		k := cacheKey{namespace: write.namespace, key: string(write.key)}
+		seq, ok := positions[k]
+		if !ok {
+			var err error
+			if seq, err = s.position(write.namespace, write.key); err != nil {
+				return err
+			}
+		}
+		tag := insertionOrderTag(write.namespace)
+		if seq != nil && (write.writeType == Delete || overwrite == MoveToEnd) {
+			entries = append(entries,
+				writeInfo{
+					writeType:   Delete,
+					namespace:   insertionOrderNamespace,
+					key:         append(tag, seq...),
+					errorFormat: "failed to delete insertion order of key = %x",
+					errorArgs:   write.key,
+				},
+				writeInfo{
+					writeType:   Delete,
+					namespace:   insertionPositionNamespace,
+					key:         append(tag, write.key...),
+					errorFormat: "failed to delete insertion order of key = %x",
+					errorArgs:   write.key,
+				},
+			)
+			seq = nil
+		}
+		if seq == nil && write.writeType != Delete {
+			n, ok := next[write.namespace]
+			if !ok {
+				n = s.next[write.namespace]
+			}
+			seq = make([]byte, 8)
+			binary.BigEndian.PutUint64(seq, n)
+			next[write.namespace] = n + 1
+			entries = append(entries,
+				writeInfo{
+					writeType:   Put,
+					namespace:   insertionOrderNamespace,
+					key:         append(tag, seq...),
+					value:       write.key,
+					errorFormat: "failed to write insertion order of key = %x",
+					errorArgs:   write.key,
+				},
+				writeInfo{
+					writeType:   Put,
+					namespace:   insertionPositionNamespace,
+					key:         append(tag, write.key...),
+					value:       seq,
+					errorFormat: "failed to write insertion order of key = %x",
+					errorArgs:   write.key,
+				},
+			)
+		}
+		positions[k] = seq
+	}
+	for namespace, n := range next {
+		value := make([]byte, 8)
+		binary.BigEndian.PutUint64(value, n)
+		entries = append(entries, writeInfo{
+			writeType:   Put,
+			namespace:   insertionOrderNamespace,
+			key:         insertionOrderTag(namespace),
+			value:       value,
+			errorFormat: "failed to write next sequence of namespace %s",
+			errorArgs:   namespace,
+		})
+	}
+	if err := s.kvStore.Commit(newBatchOf(entries)); err != nil {
+		return err
+	}
+	for namespace, n := range next {
+		s.next[namespace] = n
+	}
+	succeed = true
+	return nil
+}
+
+// IterateInsertionOrder calls fn on each record of the namespace in the order it is written
+func (s *insertionOrderKVStore) IterateInsertionOrder(namespace string, fn func([]byte, []byte) error) error {
+	if _, ok := s.overwrite[namespace]; !ok {
+		return errors.Wrapf(ErrInvalidDB, "namespace %s is not in insertion order", namespace)
+	}
+	tag := insertionOrderTag(namespace)
+	after := tag
+	for after != nil {
+		seqs, cursor, err := s.pager.KeysPaged(insertionOrderNamespace, after, insertionOrderPageSize)
+		if err != nil {
+			return err
+		}
+		after = cursor
+		for _, seq := range seqs {
+			if !bytes.HasPrefix(seq, tag) {
+				// the sequences of the namespace are all listed
+				return nil
+			}
+			key, err := s.kvStore.Get(insertionOrderNamespace, seq)
+			if isNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			value, err := s.kvStore.Get(namespace, key)
+			if isNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := fn(key, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// underlying returns the KV store wrapped
+func (s *insertionOrderKVStore) underlying() KVStore { return s.kvStore }
+
+// position returns the sequence of the key in the shadow index, or nil if it has none
+func (s *insertionOrderKVStore) position(namespace string, key []byte) ([]byte, error) {
+	seq, err := s.kvStore.Get(insertionPositionNamespace, append(insertionOrderTag(namespace), key...))
+	if isNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read insertion order of key = %x", key)
+	}
+	return seq, nil
+}
+
+// insertionOrderTag returns the length of the namespace followed by the namespace, which prefixes the keys of its
+// shadow index, so that the keys of a namespace never run into those of another whose name starts with it. The tag
+// has no spare capacity, so the keys appended to it never share memory
+func insertionOrderTag(namespace string) []byte {
+	n := make([]byte, binary.MaxVarintLen64)
+	n = n[:binary.PutUvarint(n, uint64(len(namespace)))]
+	tag := make([]byte, len(n)+len(namespace))
+	copy(tag[copy(tag, n):], namespace)
+	return tag
+}
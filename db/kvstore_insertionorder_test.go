@@ -0,0 +1,111 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestInsertionOrder(t *testing.T) {
+	// open opens the KV store of the given overwrite position, and reopens tells whether it keeps its records on restart
+	testOrder := func(open func(OverwritePosition) KVStore, reopens bool, cleanup func(), t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		for overwrite, expected := range map[OverwritePosition][]string{
+			KeepPosition: {"c", "a", "b", "e", "f"},
+			MoveToEnd:    {"c", "b", "a", "e", "f"},
+		} {
+			cleanup()
+			kvStore := open(overwrite)
+			require.NoError(kvStore.Start(ctx))
+			order := func() []string {
+				var keys []string
+				require.NoError(kvStore.(InsertionOrderIterator).IterateInsertionOrder(bucket1, func(k, v []byte) error {
+					require.Equal(append([]byte("value-"), k...), v)
+					keys = append(keys, string(k))
+					return nil
+				}))
+				return keys
+			}
+			write := func(key string) []byte { return []byte("value-" + key) }
+
+			// the keys are written out of byte order, to an ordered namespace and another one
+			require.NoError(kvStore.Put(bucket1, []byte("c"), write("c")))
+			require.NoError(kvStore.PutIfNotExists(bucket1, []byte("a"), write("a")))
+			require.NoError(kvStore.Put(bucket2, []byte("z"), write("z")))
+			batch := NewBatch()
+			require.NoError(batch.Put(bucket1, []byte("d"), write("d"), ""))
+			require.NoError(batch.Put(bucket1, []byte("b"), write("b"), ""))
+			require.NoError(kvStore.Commit(batch))
+			require.Equal([]string{"c", "a", "d", "b"}, order())
+
+			// a key failing to be written takes no position
+			require.Equal(ErrAlreadyExist, errors.Cause(kvStore.PutIfNotExists(bucket1, []byte("c"), write("c"))))
+			require.Equal([]string{"c", "a", "d", "b"}, order())
+
+			// an overwritten key keeps its position or moves to the end, and a deleted key gives up its position
+			require.NoError(kvStore.Put(bucket1, []byte("a"), write("a")))
+			require.NoError(kvStore.Delete(bucket1, []byte("d")))
+			batch = NewBatch()
+			require.NoError(batch.Put(bucket1, []byte("e"), write("e"), ""))
+			require.NoError(batch.Put(bucket1, []byte("e"), write("e"), ""))
+			require.NoError(kvStore.Commit(batch))
+
+			if reopens {
+				// the next sequence is kept across restarts
+				require.NoError(kvStore.Stop(ctx))
+				kvStore = open(overwrite)
+				require.NoError(kvStore.Start(ctx))
+			}
+			require.NoError(kvStore.Put(bucket1, []byte("f"), write("f")))
+			require.Equal(expected, order())
+
+			// the iteration stops at the error of fn
+			visited := 0
+			err := kvStore.(InsertionOrderIterator).IterateInsertionOrder(bucket1, func(_, _ []byte) error {
+				visited++
+				return errWriteFailed
+			})
+			require.Equal(errWriteFailed, errors.Cause(err))
+			require.Equal(1, visited)
+			err = kvStore.(InsertionOrderIterator).IterateInsertionOrder(bucket2, func(_, _ []byte) error { return nil })
+			require.Equal(ErrInvalidDB, errors.Cause(err))
+			require.NoError(kvStore.Stop(ctx))
+		}
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testOrder(func(overwrite OverwritePosition) KVStore {
+			return NewMemKVStore(WithInsertionOrder(bucket1, overwrite))
+		}, false, func() {}, t)
+	})
+	dbCfg := cfg
+	open := func(overwrite OverwritePosition) KVStore {
+		return NewOnDiskDB(dbCfg, WithInsertionOrder(bucket1, overwrite))
+	}
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-insertion-order.bolt"
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testOrder(open, true, func() { testutil.CleanupPath(t, path) }, t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-insertion-order.badger"
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testOrder(open, true, func() { testutil.CleanupPath(t, path) }, t)
+	})
+}
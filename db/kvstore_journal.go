@@ -0,0 +1,282 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/logger"
+)
+
+// journalNamespace is the namespace keeping the rollback journal of the commit in progress
+const journalNamespace = "rollbackJournal"
+
+// journalKey is the key of the rollback journal
+var journalKey = []byte("journal")
+
+type (
+	// journaledKVStore is a KV store making each commit atomic over a KV store whose commits are not, by journaling
+	// the values the commit overwrites before applying it
+	journaledKVStore struct {
+		// mutex serializes the writes, so that a rollback never undoes a write made after the commit it rolls back
+		mutex   sync.Mutex
+		kvStore KVStore
+	}
+
+	// journalEntry is the value of a record before a commit, absent if the record did not exist
+	journalEntry struct {
+		namespace string
+		key       []byte
+		value     []byte
+		present   bool
+	}
+)
+
+// NewJournaledKVStore wraps the KV store to make its commits atomic, for a KV store which writes a single record
+// atomically but may apply a batch partially, e.g. one sharded over several KV stores. Before a batch is applied, the
+// values it overwrites are written as one record of the rollback journal, which is deleted once the batch is applied.
+// A batch failing to apply is rolled back from the journal right away, and a journal left by a crash in the middle of
+// a commit is rolled back on Start, so the records are either all written by a commit or as they were before it
+func NewJournaledKVStore(kvStore KVStore) KVStore {
+	return &journaledKVStore{kvStore: kvStore}
+}
+
+// Start starts the underlying KV store, and rolls back the commit left incomplete by a crash, if any
+func (s *journaledKVStore) Start(ctx context.Context) error {
+	if err := s.kvStore.Start(ctx); err != nil {
+		return err
+	}
+	if err := s.recover(); err != nil {
+		if stopErr := s.kvStore.Stop(ctx); stopErr != nil {
+			logger.Error().Err(stopErr).Msg("Failed to stop the KV store failing to roll back an incomplete commit.")
+		}
+		return err
+	}
+	return nil
+}
+
+// Stop stops the underlying KV store
+func (s *journaledKVStore) Stop(ctx context.Context) error {
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record
+func (s *journaledKVStore) Put(namespace string, key, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.kvStore.Put(namespace, key, value)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (s *journaledKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.kvStore.PutIfNotExists(namespace, key, value)
+}
+
+// Get retrieves a record
+func (s *journaledKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	return s.kvStore.Get(namespace, key)
+}
+
+// Delete deletes a record
+func (s *journaledKVStore) Delete(namespace string, key []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.kvStore.Delete(namespace, key)
+}
+
+// Commit journals the values the batch overwrites, applies the batch, and deletes the journal. The batch is rolled
+// back from the journal if it fails to apply
+func (s *journaledKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	entries := make([]writeInfo, b.Size())
+	for i := range entries {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		entries[i] = *write
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	journal, err := s.journal(entries)
+	if err != nil {
+		return err
+	}
+	if err := createReservedNamespace(s.kvStore, journalNamespace); err != nil {
+		return err
+	}
+	if err := s.kvStore.Put(journalNamespace, journalKey, encodeJournal(journal)); err != nil {
+		return errors.Wrap(err, "failed to write rollback journal")
+	}
+	if err := s.kvStore.Commit(newBatchOf(entries)); err != nil {
+		if rollbackErr := s.rollback(journal); rollbackErr != nil {
+			// the journal is kept, and rolled back again on Start
+			logger.Error().Err(rollbackErr).Msg("Failed to roll back a failed commit.")
+		}
+		return err
+	}
+	if err := s.kvStore.Delete(journalNamespace, journalKey); err != nil {
+		return errors.Wrap(err, "failed to delete rollback journal")
+	}
+	succeed = true
+	return nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// journal reads the values of the records the entries write, before any of them is applied
+func (s *journaledKVStore) journal(entries []writeInfo) ([]journalEntry, error) {
+	journaled := make(map[cacheKey]struct{}, len(entries))
+	var journal []journalEntry
+	for _, write := range entries {
+		k := cacheKey{namespace: write.namespace, key: string(write.key)}
+		if _, ok := journaled[k]; ok {
+			continue
+		}
+		journaled[k] = struct{}{}
+		value, err := s.kvStore.Get(write.namespace, write.key)
+		if err != nil && !isNotExist(err) {
+			return nil, errors.Wrapf(err, "failed to journal key = %x", write.key)
+		}
+		journal = append(journal, journalEntry{
+			namespace: write.namespace,
+			key:       write.key,
+			value:     value,
+			present:   err == nil,
+		})
+	}
+	return journal, nil
+}
+
+// recover rolls back the commit of the journal left, if any
+func (s *journaledKVStore) recover() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	value, err := s.kvStore.Get(journalNamespace, journalKey)
+	if isNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read rollback journal")
+	}
+	journal, err := decodeJournal(value)
+	if err != nil {
+		return err
+	}
+	logger.Warn().Int("records", len(journal)).Msg("Rolling back a commit left incomplete by a crash.")
+	return s.rollback(journal)
+}
+
+// rollback restores the records of the journal, and deletes the journal once they are restored. It may be repeated
+// until it succeeds, as the journal is kept until then
+func (s *journaledKVStore) rollback(journal []journalEntry) error {
+	batch := NewBatch()
+	for _, entry := range journal {
+		var err error
+		if entry.present {
+			err = batch.Put(entry.namespace, entry.key, entry.value, "failed to restore key = %x", entry.key)
+		} else {
+			err = batch.Delete(entry.namespace, entry.key, "failed to restore key = %x", entry.key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := s.kvStore.Commit(batch); err != nil {
+		return errors.Wrap(err, "failed to restore records from rollback journal")
+	}
+	return errors.Wrap(s.kvStore.Delete(journalNamespace, journalKey), "failed to delete rollback journal")
+}
+
+// encodeJournal encodes the journal as the number of entries, followed by the namespace, key, whether the record
+// exists and value of each entry, the variable-length ones prefixed with their length
+func encodeJournal(journal []journalEntry) []byte {
+	var buf bytes.Buffer
+	n := make([]byte, binary.MaxVarintLen64)
+	writeBytes := func(b []byte) {
+		buf.Write(n[:binary.PutUvarint(n, uint64(len(b)))])
+		buf.Write(b)
+	}
+	buf.Write(n[:binary.PutUvarint(n, uint64(len(journal)))])
+	for _, entry := range journal {
+		writeBytes([]byte(entry.namespace))
+		writeBytes(entry.key)
+		if entry.present {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+		writeBytes(entry.value)
+	}
+	return buf.Bytes()
+}
+
+// decodeJournal decodes the rollback journal
+func decodeJournal(value []byte) ([]journalEntry, error) {
+	malformed := errors.Wrap(ErrInvalidDB, "malformed rollback journal")
+	r := bytes.NewReader(value)
+	readBytes := func() ([]byte, error) {
+		l, err := binary.ReadUvarint(r)
+		if err != nil || l > uint64(r.Len()) {
+			return nil, malformed
+		}
+		// an empty value is kept non-nil, since a nil value is reported as not existing by the in-memory KV store
+		b := make([]byte, l)
+		r.Read(b)
+		return b, nil
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil || count > uint64(r.Len()) {
+		return nil, malformed
+	}
+	journal := make([]journalEntry, count)
+	for i := range journal {
+		namespace, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+		if journal[i].key, err = readBytes(); err != nil {
+			return nil, err
+		}
+		present, err := r.ReadByte()
+		if err != nil || present > 1 {
+			return nil, malformed
+		}
+		if journal[i].value, err = readBytes(); err != nil {
+			return nil, err
+		}
+		journal[i].namespace, journal[i].present = string(namespace), present == 1
+	}
+	return journal, nil
+}
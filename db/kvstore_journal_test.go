@@ -0,0 +1,114 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+var errCrash = errors.New("crash")
+
+// journalCrashingKVStore crashes before the rollback journal is deleted
+type journalCrashingKVStore struct {
+	KVStore
+}
+
+func (s *journalCrashingKVStore) Delete(namespace string, key []byte) error {
+	if namespace == journalNamespace {
+		return errCrash
+	}
+	return s.KVStore.Delete(namespace, key)
+}
+
+func TestJournaledKVStoreCrash(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	path := "test-journaled-kv-store.bolt"
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+	dbCfg := cfg
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+
+	// the batch is journaled and applied, but the process crashes before the journal is deleted
+	kvStore := NewJournaledKVStore(&journalCrashingKVStore{KVStore: NewOnDiskDB(dbCfg)})
+	require.NoError(kvStore.Start(ctx))
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+	batch := NewBatch()
+	require.NoError(batch.Put(bucket1, testK1[0], testV1[1], ""))
+	require.NoError(batch.Put(bucket1, testK1[1], testV1[1], ""))
+	require.NoError(batch.Delete(bucket1, testK1[0], ""))
+	require.NoError(batch.Put(bucket2, testK2[0], testV2[0], ""))
+	require.Equal(errCrash, errors.Cause(kvStore.Commit(batch)))
+	_, err := kvStore.Get(bucket1, testK1[0])
+	require.True(isNotExist(err))
+	require.NoError(kvStore.Stop(ctx))
+
+	// the store rolls back to the state before the batch on reopen
+	kvStore = NewJournaledKVStore(NewOnDiskDB(dbCfg))
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	value, err := kvStore.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], value)
+	_, err = kvStore.Get(bucket1, testK1[1])
+	require.True(isNotExist(err))
+	_, err = kvStore.Get(bucket2, testK2[0])
+	require.True(isNotExist(err))
+	_, err = kvStore.Get(journalNamespace, journalKey)
+	require.True(isNotExist(err))
+
+	// a commit completing deletes its journal
+	batch = NewBatch()
+	require.NoError(batch.Put(bucket1, testK1[1], testV1[1], ""))
+	require.NoError(kvStore.Commit(batch))
+	value, err = kvStore.Get(bucket1, testK1[1])
+	require.NoError(err)
+	require.Equal(testV1[1], value)
+	_, err = kvStore.Get(journalNamespace, journalKey)
+	require.True(isNotExist(err))
+}
+
+func TestJournaledKVStoreFailedCommit(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	// a batch over several shards is committed one shard after another, so it may be applied partially
+	kvStore := NewJournaledKVStore(NewShardedKVStore([]KVStore{NewMemKVStore(), NewMemKVStore()}, 16))
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	require.NoError(kvStore.Put(bucket1, []byte("taken"), testV1[0]))
+	batch := NewBatch()
+	for i := 0; i < 16; i++ {
+		require.NoError(batch.Put(bucket1, []byte(fmt.Sprintf("key_%02d", i)), testV1[1], ""))
+	}
+	require.NoError(batch.PutIfNotExists(bucket1, []byte("taken"), testV1[1], ""))
+	require.Equal(ErrAlreadyExist, errors.Cause(kvStore.Commit(batch)))
+
+	// the shards committed before the failure are rolled back
+	for i := 0; i < 16; i++ {
+		_, err := kvStore.Get(bucket1, []byte(fmt.Sprintf("key_%02d", i)))
+		require.True(isNotExist(err))
+	}
+	value, err := kvStore.Get(bucket1, []byte("taken"))
+	require.NoError(err)
+	require.Equal(testV1[0], value)
+	_, err = kvStore.Get(journalNamespace, journalKey)
+	require.True(isNotExist(err))
+}
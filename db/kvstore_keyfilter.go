@@ -0,0 +1,459 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/logger"
+)
+
+// keyFilterNamespace is the namespace keeping the key filter of each filtered namespace, as a header keyed by the name
+// of the namespace, and the blocks of bits keyed by the name of the namespace followed by a zero byte and the index of
+// the block
+const keyFilterNamespace = "keyFilters"
+
+const (
+	// keyFilterBlockSize is the number of bytes of a block of the filter, all bits of a key being in the same block
+	// so that a write updates a single block
+	keyFilterBlockSize = 512
+	// keyFilterBitsPerKey is the number of bits of the filter per key it is sized for, which with keyFilterHashes bits
+	// set per key gives a false positive rate of about 1%
+	keyFilterBitsPerKey = 10
+	keyFilterHashes     = 7
+	// keyFilterPageSize is the number of keys listed at a time to rebuild a filter
+	keyFilterPageSize = 1024
+)
+
+type (
+	// keyFilterKVStore is a KV store answering the lookups of absent keys of the filtered namespaces from a bloom
+	// filter persisted along with the records
+	keyFilterKVStore struct {
+		kvStore KVStore
+		// capacities is the number of keys the filter of each namespace is sized for when it is built
+		capacities map[string]int
+		// mutex serializes the writes, so that the filters persisted are updated in commit order
+		mutex sync.Mutex
+		// filters is the filter of each namespace, loaded or built on start
+		filters map[string]*keyFilter
+	}
+
+	// keyFilter is a blocked bloom filter of the keys of a namespace
+	keyFilter struct {
+		// mutex guards blocks and inserted against the reads, the writes being serialized by the KV store already
+		mutex  sync.RWMutex
+		blocks [][]byte
+		// capacity is the number of keys the filter is sized for, and inserted the number of keys which set a bit
+		// since the filter is built, including those deleted since
+		capacity uint64
+		inserted uint64
+	}
+)
+
+// newKeyFilterKVStore wraps the KV store to filter the lookups of the namespaces, sized for their capacities
+func newKeyFilterKVStore(kvStore KVStore, capacities map[string]int) KVStore {
+	s := &keyFilterKVStore{
+		kvStore:    kvStore,
+		capacities: make(map[string]int, len(capacities)),
+		filters:    make(map[string]*keyFilter, len(capacities)),
+	}
+	for namespace, capacity := range capacities {
+		s.capacities[namespace] = capacity
+		s.filters[namespace] = &keyFilter{}
+	}
+	return s
+}
+
+// Start starts the underlying KV store, and loads the filter of each namespace, or builds it from the keys of the
+// namespace if it is not persisted yet or has grown beyond its capacity
+func (s *keyFilterKVStore) Start(ctx context.Context) error {
+	if err := s.kvStore.Start(ctx); err != nil {
+		return err
+	}
+	if err := createReservedNamespace(s.kvStore, keyFilterNamespace); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for namespace, capacity := range s.capacities {
+		if capacity < 1 {
+			return errors.Wrapf(ErrInvalidDB, "invalid key filter capacity %d of namespace %s", capacity, namespace)
+		}
+		loaded, err := s.load(namespace)
+		if err != nil {
+			return err
+		}
+		if loaded == nil || loaded.inserted > loaded.capacity {
+			if loaded, err = s.rebuild(namespace, loaded, uint64(capacity)); err != nil {
+				return err
+			}
+		}
+		s.filters[namespace].reset(loaded)
+	}
+	return nil
+}
+
+// Stop stops the underlying KV store
+func (s *keyFilterKVStore) Stop(ctx context.Context) error {
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record
+func (s *keyFilterKVStore) Put(namespace string, key, value []byte) error {
+	batch := NewBatch()
+	batch.Put(namespace, key, value, "failed to put key = %x", key)
+	return s.Commit(batch)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (s *keyFilterKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	batch := NewBatch()
+	batch.PutIfNotExists(namespace, key, value, "failed to put key = %x", key)
+	return s.Commit(batch)
+}
+
+// Get retrieves a record, without reading the underlying KV store if the filter tells the key does not exist
+func (s *keyFilterKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	if filter, ok := s.filters[namespace]; ok && !filter.mayContain(key) {
+		return nil, errors.Wrapf(ErrNotExist, "key = %x", key)
+	}
+	return s.kvStore.Get(namespace, key)
+}
+
+// Delete deletes a record, whose key is kept in the filter until it is rebuilt
+func (s *keyFilterKVStore) Delete(namespace string, key []byte) error {
+	return s.kvStore.Delete(namespace, key)
+}
+
+// Commit commits the batch along with the blocks of the filters it sets bits of, so that the filter persisted never
+// misses a key committed
+func (s *keyFilterKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries := make([]writeInfo, b.Size())
+	// dirty is the blocks updated of each filter, copied so that the filters are left as they are if the commit fails
+	dirty := make(map[*keyFilter]map[int][]byte)
+	inserted := make(map[*keyFilter]uint64)
+	for i := range entries {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		entries[i] = *write
+		filter, ok := s.filters[write.namespace]
+		if !ok || write.writeType == Delete || len(filter.blocks) == 0 {
+			continue
+		}
+		if dirty[filter] == nil {
+			dirty[filter] = make(map[int][]byte)
+		}
+		if filter.add(dirty[filter], write.key) {
+			inserted[filter]++
+		}
+	}
+	for namespace, filter := range s.filters {
+		for i, block := range dirty[filter] {
+			entries = append(entries, writeInfo{
+				writeType:   Put,
+				namespace:   keyFilterNamespace,
+				key:         keyFilterBlockKey(namespace, i),
+				value:       block,
+				errorFormat: "failed to persist key filter of namespace %s",
+				errorArgs:   namespace,
+			})
+		}
+		if inserted[filter] > 0 {
+			entries = append(entries, writeInfo{
+				writeType:   Put,
+				namespace:   keyFilterNamespace,
+				key:         []byte(namespace),
+				value:       filter.header(filter.inserted + inserted[filter]),
+				errorFormat: "failed to persist key filter of namespace %s",
+				errorArgs:   namespace,
+			})
+		}
+	}
+	if err := s.kvStore.Commit(newBatchOf(entries)); err != nil {
+		return err
+	}
+	for filter, blocks := range dirty {
+		filter.apply(blocks, inserted[filter])
+	}
+	succeed = true
+	return nil
+}
+
+// BulkHas returns whether each of the keys exists, checking only the keys the filter tells may exist against the
+// underlying KV store
+func (s *keyFilterKVStore) BulkHas(namespace string, keys [][]byte) ([]bool, error) {
+	found := make([]bool, len(keys))
+	// maybe is the index of each key the filter tells may exist
+	var maybe []int
+	filter, filtered := s.filters[namespace]
+	for i, key := range keys {
+		if !filtered || filter.mayContain(key) {
+			maybe = append(maybe, i)
+		}
+	}
+	if len(maybe) == 0 {
+		return found, nil
+	}
+	if checker, ok := s.kvStore.(BulkExistenceChecker); ok {
+		checked := make([][]byte, len(maybe))
+		for i, j := range maybe {
+			checked[i] = keys[j]
+		}
+		exist, err := checker.BulkHas(namespace, checked)
+		if err != nil {
+			return nil, err
+		}
+		for i, j := range maybe {
+			found[j] = exist[i]
+		}
+		return found, nil
+	}
+	for _, j := range maybe {
+		_, err := s.kvStore.Get(namespace, keys[j])
+		if err != nil && !isNotExist(err) {
+			return nil, err
+		}
+		found[j] = err == nil
+	}
+	return found, nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// underlying returns the KV store wrapped
+func (s *keyFilterKVStore) underlying() KVStore { return s.kvStore }
+
+// load reads the filter of the namespace persisted, nil if there is none
+func (s *keyFilterKVStore) load(namespace string) (*keyFilter, error) {
+	header, err := s.kvStore.Get(keyFilterNamespace, []byte(namespace))
+	if isNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get key filter of namespace %s", namespace)
+	}
+	if len(header) != 20 || binary.BigEndian.Uint32(header) == 0 {
+		return nil, errors.Wrapf(ErrInvalidDB, "malformed key filter of namespace %s", namespace)
+	}
+	filter := &keyFilter{
+		blocks:   make([][]byte, binary.BigEndian.Uint32(header)),
+		capacity: binary.BigEndian.Uint64(header[4:]),
+		inserted: binary.BigEndian.Uint64(header[12:]),
+	}
+	for i := range filter.blocks {
+		block, err := s.kvStore.Get(keyFilterNamespace, keyFilterBlockKey(namespace, i))
+		switch {
+		case isNotExist(err):
+			// a block none of whose bits is set is not persisted
+			block = make([]byte, keyFilterBlockSize)
+		case err != nil:
+			return nil, errors.Wrapf(err, "failed to get key filter of namespace %s", namespace)
+		case len(block) != keyFilterBlockSize:
+			return nil, errors.Wrapf(ErrInvalidDB, "malformed key filter of namespace %s", namespace)
+		}
+		filter.blocks[i] = block
+	}
+	return filter, nil
+}
+
+// rebuild builds the filter of the namespace from its keys, sized for twice the keys or for capacity, whichever is
+// larger, and persists it in place of the old one in one commit
+func (s *keyFilterKVStore) rebuild(namespace string, old *keyFilter, capacity uint64) (*keyFilter, error) {
+	pager, ok := s.kvStore.(KeyPager)
+	if !ok {
+		return nil, errors.Wrap(ErrInvalidDB, "KV store does not support listing keys")
+	}
+	keys := uint64(0)
+	if err := keyFilterScan(pager, namespace, func([]byte) { keys++ }); err != nil {
+		return nil, err
+	}
+	if 2*keys > capacity {
+		capacity = 2 * keys
+	}
+	filter := newKeyFilter(capacity)
+	blocks := make(map[int][]byte)
+	if err := keyFilterScan(pager, namespace, func(key []byte) {
+		if filter.add(blocks, key) {
+			filter.inserted++
+		}
+	}); err != nil {
+		return nil, err
+	}
+	for i, block := range blocks {
+		filter.blocks[i] = block
+	}
+
+	batch := NewBatch()
+	if old != nil {
+		for i := range old.blocks {
+			batch.Delete(keyFilterNamespace, keyFilterBlockKey(namespace, i), "failed to rebuild key filter")
+		}
+	}
+	for i, block := range blocks {
+		batch.Put(keyFilterNamespace, keyFilterBlockKey(namespace, i), block, "failed to rebuild key filter")
+	}
+	batch.Put(keyFilterNamespace, []byte(namespace), filter.header(filter.inserted), "failed to rebuild key filter")
+	if err := s.kvStore.Commit(batch); err != nil {
+		return nil, errors.Wrapf(err, "failed to persist key filter of namespace %s", namespace)
+	}
+	logger.Info().
+		Str("namespace", namespace).
+		Uint64("keys", keys).
+		Uint64("capacity", capacity).
+		Msg("Built the key filter of the namespace.")
+	return filter, nil
+}
+
+// newKeyFilter returns an empty filter sized for capacity keys
+func newKeyFilter(capacity uint64) *keyFilter {
+	n := (capacity*keyFilterBitsPerKey + keyFilterBlockSize*8 - 1) / (keyFilterBlockSize * 8)
+	filter := &keyFilter{blocks: make([][]byte, n), capacity: capacity}
+	for i := range filter.blocks {
+		filter.blocks[i] = make([]byte, keyFilterBlockSize)
+	}
+	return filter
+}
+
+// reset replaces the filter by the one loaded or built
+func (f *keyFilter) reset(filter *keyFilter) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.blocks, f.capacity, f.inserted = filter.blocks, filter.capacity, filter.inserted
+}
+
+// mayContain returns false if the key is certainly not in the filter, which is never the case before it is loaded
+func (f *keyFilter) mayContain(key []byte) bool {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	if len(f.blocks) == 0 {
+		return true
+	}
+	i, bits := f.locate(key)
+	block := f.blocks[i]
+	for _, bit := range bits {
+		if block[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// add sets the bits of the key in a copy of its block in dirty, made on the first bit set in the block, and returns
+// whether any bit is set
+func (f *keyFilter) add(dirty map[int][]byte, key []byte) bool {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	i, bits := f.locate(key)
+	block, ok := dirty[i]
+	if !ok {
+		block = f.blocks[i]
+	}
+	set := false
+	for _, bit := range bits {
+		if block[bit/8]&(1<<(bit%8)) != 0 {
+			continue
+		}
+		if !set && !ok {
+			block = append([]byte(nil), block...)
+			dirty[i] = block
+		}
+		block[bit/8] |= 1 << (bit % 8)
+		set = true
+	}
+	return set
+}
+
+// apply replaces the blocks by the ones updated by a commit, which set the bits of inserted more keys
+func (f *keyFilter) apply(blocks map[int][]byte, inserted uint64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for i, block := range blocks {
+		f.blocks[i] = block
+	}
+	f.inserted += inserted
+}
+
+// locate returns the block of the key and its bits within the block, by double hashing of a 128-bit FNV-1a hash
+func (f *keyFilter) locate(key []byte) (int, [keyFilterHashes]uint32) {
+	h := fnv.New128a()
+	h.Write(key)
+	sum := h.Sum(nil)
+	i := int(binary.BigEndian.Uint64(sum) % uint64(len(f.blocks)))
+	h1, h2 := binary.BigEndian.Uint32(sum[8:]), binary.BigEndian.Uint32(sum[12:])|1
+	var bits [keyFilterHashes]uint32
+	for j := range bits {
+		bits[j] = (h1 + uint32(j)*h2) % (keyFilterBlockSize * 8)
+	}
+	return i, bits
+}
+
+// header encodes the number of blocks, the capacity and the number of keys inserted of the filter
+func (f *keyFilter) header(inserted uint64) []byte {
+	header := make([]byte, 20)
+	binary.BigEndian.PutUint32(header, uint32(len(f.blocks)))
+	binary.BigEndian.PutUint64(header[4:], f.capacity)
+	binary.BigEndian.PutUint64(header[12:], inserted)
+	return header
+}
+
+// keyFilterBlockKey returns the key of the i-th block of the filter of the namespace
+func keyFilterBlockKey(namespace string, i int) []byte {
+	key := make([]byte, len(namespace)+5)
+	copy(key, namespace)
+	binary.BigEndian.PutUint32(key[len(namespace)+1:], uint32(i))
+	return key
+}
+
+// keyFilterScan calls fn on each key of the namespace
+func keyFilterScan(pager KeyPager, namespace string, fn func([]byte)) error {
+	after := []byte{}
+	for after != nil {
+		keys, next, err := pager.KeysPaged(namespace, after, keyFilterPageSize)
+		if isNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to list the keys of namespace %s", namespace)
+		}
+		for _, key := range keys {
+			fn(key)
+		}
+		after = next
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+// countingKVStore counts the reads of bucket1 and the listings of its keys
+type countingKVStore struct {
+	KVStore
+	gets   int
+	listed int
+}
+
+func (s *countingKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	if namespace == bucket1 {
+		s.gets++
+	}
+	return s.KVStore.Get(namespace, key)
+}
+
+func (s *countingKVStore) KeysPaged(namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	if namespace == bucket1 {
+		s.listed++
+	}
+	return s.KVStore.(KeyPager).KeysPaged(namespace, after, limit)
+}
+
+func TestKeyFilter(t *testing.T) {
+	present := func(i int) []byte { return []byte(fmt.Sprintf("present-%05d", i)) }
+	absent := func(i int) []byte { return []byte(fmt.Sprintf("absent-%05d", i)) }
+	const capacity = 2000
+
+	testKeyFilter := func(newKVStore func() KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		// open wraps a new instance of the DB, which must be stopped after use
+		open := func() (*countingKVStore, KVStore) {
+			counting := &countingKVStore{KVStore: newKVStore()}
+			kvStore := newKeyFilterKVStore(counting, map[string]int{bucket1: capacity})
+			require.NoError(kvStore.Start(ctx))
+			return counting, kvStore
+		}
+		// check asserts that no key present is missed, and that most lookups of absent keys do not reach the DB
+		check := func(counting *countingKVStore, kvStore KVStore, n int) {
+			for i := 0; i < n; i++ {
+				value, err := kvStore.Get(bucket1, present(i))
+				require.NoError(err)
+				require.Equal([]byte{byte(i)}, value)
+			}
+			counting.gets = 0
+			for i := 0; i < 1000; i++ {
+				_, err := kvStore.Get(bucket1, absent(i))
+				require.True(isNotExist(err))
+			}
+			require.True(counting.gets < 50, "%d of 1000 lookups reached the DB", counting.gets)
+
+			keys := [][]byte{absent(0), present(0), absent(1), present(n - 1)}
+			found, err := kvStore.(BulkExistenceChecker).BulkHas(bucket1, keys)
+			require.NoError(err)
+			require.Equal([]bool{false, true, false, true}, found)
+		}
+
+		// the filter is built on the first start, from the records the namespace holds already
+		raw := newKVStore()
+		require.NoError(raw.Start(ctx))
+		require.NoError(raw.Put(bucket1, present(0), []byte{0}))
+		require.NoError(raw.Stop(ctx))
+		counting, kvStore := open()
+		require.NotZero(counting.listed)
+		batch := NewBatch()
+		for i := 1; i < 1000; i++ {
+			require.NoError(batch.Put(bucket1, present(i), []byte{byte(i)}, ""))
+		}
+		require.NoError(kvStore.Commit(batch))
+		require.NoError(kvStore.Delete(bucket1, present(999)))
+		check(counting, kvStore, 999)
+		require.NoError(kvStore.Stop(ctx))
+
+		// the filter persisted is loaded on reopen rather than rebuilt from the keys
+		counting, kvStore = open()
+		require.Zero(counting.listed)
+		check(counting, kvStore, 999)
+
+		// once more keys than its capacity are written, it is rebuilt on the next start
+		for i := 999; i < 3000; i++ {
+			require.NoError(kvStore.Put(bucket1, present(i), []byte{byte(i)}))
+		}
+		check(counting, kvStore, 3000)
+		require.NoError(kvStore.Stop(ctx))
+		counting, kvStore = open()
+		require.NotZero(counting.listed)
+		check(counting, kvStore, 3000)
+		require.NoError(kvStore.Stop(ctx))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		kvStore := NewMemKVStore(WithKeyFilter(bucket1, capacity))
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		require.NoError(kvStore.Put(bucket1, present(0), []byte{0}))
+		value, err := kvStore.Get(bucket1, present(0))
+		require.NoError(err)
+		require.Equal([]byte{0}, value)
+		_, err = kvStore.Get(bucket1, absent(0))
+		require.True(isNotExist(err))
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-key-filter.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testKeyFilter(func() KVStore { return NewOnDiskDB(dbCfg) }, t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-key-filter.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testKeyFilter(func() KVStore { return NewOnDiskDB(dbCfg) }, t)
+	})
+}
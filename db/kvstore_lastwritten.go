@@ -0,0 +1,151 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// lastWrittenNamespace is the namespace keeping the key last written to each tracked namespace, keyed by the namespace
+const lastWrittenNamespace = "lastWritten"
+
+// LastWrittenGetter is the interface of KV store which is able to tell the key last written to a namespace
+type LastWrittenGetter interface {
+	// LastWritten returns the key last written to the namespace and its value, whatever the order of the keys. It
+	// returns ErrNotExist if no key has been written to the namespace, or if the key last written has been deleted
+	// since
+	LastWritten(string) ([]byte, []byte, error)
+}
+
+// lastWrittenKVStore is a KV store tracking the key last written to each of the tracked namespaces
+type lastWrittenKVStore struct {
+	kvStore    KVStore
+	namespaces map[string]struct{}
+}
+
+// newLastWrittenKVStore wraps the KV store to track the key last written to each of the namespaces
+func newLastWrittenKVStore(kvStore KVStore, namespaces []string) KVStore {
+	s := &lastWrittenKVStore{
+		kvStore:    kvStore,
+		namespaces: make(map[string]struct{}, len(namespaces)),
+	}
+	for _, namespace := range namespaces {
+		s.namespaces[namespace] = struct{}{}
+	}
+	return s
+}
+
+// Start starts the underlying KV store, and creates the namespace of the keys last written
+func (s *lastWrittenKVStore) Start(ctx context.Context) error {
+	if err := s.kvStore.Start(ctx); err != nil {
+		return err
+	}
+	return createReservedNamespace(s.kvStore, lastWrittenNamespace)
+}
+
+// Stop stops the underlying KV store
+func (s *lastWrittenKVStore) Stop(ctx context.Context) error {
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record
+func (s *lastWrittenKVStore) Put(namespace string, key, value []byte) error {
+	batch := NewBatch()
+	batch.Put(namespace, key, value, "failed to put key = %x", key)
+	return s.Commit(batch)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (s *lastWrittenKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	batch := NewBatch()
+	batch.PutIfNotExists(namespace, key, value, "failed to put key = %x", key)
+	return s.Commit(batch)
+}
+
+// Get retrieves a record
+func (s *lastWrittenKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	return s.kvStore.Get(namespace, key)
+}
+
+// Delete deletes a record, the key last written is kept even if it is the one deleted
+func (s *lastWrittenKVStore) Delete(namespace string, key []byte) error {
+	return s.kvStore.Delete(namespace, key)
+}
+
+// Commit commits the batch along with the key last written by the batch to each tracked namespace, so that the key
+// tracked never diverges from the records
+func (s *lastWrittenKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	entries := make([]writeInfo, b.Size())
+	last := make(map[string][]byte)
+	for i := range entries {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		entries[i] = *write
+		if _, ok := s.namespaces[write.namespace]; ok && write.writeType != Delete {
+			last[write.namespace] = write.key
+		}
+	}
+	for namespace, key := range last {
+		entries = append(entries, writeInfo{
+			writeType:   Put,
+			namespace:   lastWrittenNamespace,
+			key:         []byte(namespace),
+			value:       key,
+			errorFormat: "failed to track key last written to namespace %s",
+			errorArgs:   namespace,
+		})
+	}
+	if err := s.kvStore.Commit(newBatchOf(entries)); err != nil {
+		return err
+	}
+	succeed = true
+	return nil
+}
+
+// LastWritten returns the key last written to the namespace and its value
+func (s *lastWrittenKVStore) LastWritten(namespace string) ([]byte, []byte, error) {
+	if _, ok := s.namespaces[namespace]; !ok {
+		return nil, nil, errors.Wrapf(ErrInvalidDB, "namespace %s is not tracked", namespace)
+	}
+	key, err := s.kvStore.Get(lastWrittenNamespace, []byte(namespace))
+	if isNotExist(err) {
+		return nil, nil, errors.Wrapf(ErrNotExist, "no key written to namespace %s", namespace)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	value, err := s.kvStore.Get(namespace, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, value, nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// underlying returns the KV store wrapped
+func (s *lastWrittenKVStore) underlying() KVStore { return s.kvStore }
@@ -0,0 +1,89 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestLastWritten(t *testing.T) {
+	testLastWritten := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		getter, ok := kvStore.(LastWrittenGetter)
+		require.True(ok)
+
+		_, _, err := getter.LastWritten(bucket1)
+		require.Equal(ErrNotExist, errors.Cause(err))
+		_, _, err = getter.LastWritten(bucket2)
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+
+		// the key last written is returned rather than the largest one
+		keys := [][]byte{[]byte("key-5"), []byte("key-9"), []byte("key-1")}
+		for i, key := range keys {
+			require.NoError(kvStore.Put(bucket1, key, testV1[i]))
+			last, value, err := getter.LastWritten(bucket1)
+			require.NoError(err)
+			require.Equal(key, last)
+			require.Equal(testV1[i], value)
+		}
+
+		// the last entry of a batch to the namespace is the key last written, writes to others are not tracked
+		batch := NewBatch()
+		require.NoError(batch.Put(bucket1, []byte("key-7"), testV2[0], ""))
+		require.NoError(batch.Put(bucket1, []byte("key-3"), testV2[1], ""))
+		require.NoError(batch.Put(bucket2, []byte("key-8"), testV2[2], ""))
+		require.NoError(kvStore.Commit(batch))
+		last, value, err := getter.LastWritten(bucket1)
+		require.NoError(err)
+		require.Equal([]byte("key-3"), last)
+		require.Equal(testV2[1], value)
+
+		// a write failing leaves the key tracked as is
+		require.Equal(ErrAlreadyExist, errors.Cause(kvStore.PutIfNotExists(bucket1, []byte("key-9"), testV2[2])))
+		last, _, err = getter.LastWritten(bucket1)
+		require.NoError(err)
+		require.Equal([]byte("key-3"), last)
+
+		// the key last written is not existing once deleted
+		require.NoError(kvStore.Delete(bucket1, []byte("key-3")))
+		_, _, err = getter.LastWritten(bucket1)
+		require.Error(err)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testLastWritten(NewMemKVStore(WithLastWritten(bucket1)), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-last-written.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testLastWritten(NewOnDiskDB(dbCfg, WithLastWritten(bucket1)), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-last-written.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testLastWritten(NewOnDiskDB(dbCfg, WithLastWritten(bucket1)), t)
+	})
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// latencyOpWrite and latencyOpCommit label the latency of a single write and of a commit
+	latencyOpWrite  = "write"
+	latencyOpCommit = "commit"
+	// latencyLabelMixed labels a batch of several namespaces, and latencyLabelOther the namespaces beyond the limit
+	latencyLabelMixed = "mixed"
+	latencyLabelOther = "other"
+)
+
+var namespaceLatencyMtc = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "iotex_db_namespace_latency_seconds",
+		Help:    "Latency of the writes and the commits to each namespace.",
+		Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+	},
+	[]string{"namespace", "op"},
+)
+
+func init() {
+	prometheus.MustRegister(namespaceLatencyMtc)
+}
+
+// latencyKVStore is a KV store observing the latency of the writes and the commits of each namespace
+type latencyKVStore struct {
+	kvStore KVStore
+	clk     clock.Clock
+	limit   int
+	// mutex guards the namespaces given a label of their own
+	mutex  sync.Mutex
+	labels map[string]struct{}
+}
+
+// newLatencyKVStore wraps the KV store to observe its latency, with up to limit namespaces labeled on their own
+func newLatencyKVStore(kvStore KVStore, limit int, clk clock.Clock) KVStore {
+	return &latencyKVStore{
+		kvStore: kvStore,
+		clk:     clk,
+		limit:   limit,
+		labels:  make(map[string]struct{}),
+	}
+}
+
+// Start starts the underlying KV store
+func (s *latencyKVStore) Start(ctx context.Context) error {
+	return s.kvStore.Start(ctx)
+}
+
+// Stop stops the underlying KV store
+func (s *latencyKVStore) Stop(ctx context.Context) error {
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record
+func (s *latencyKVStore) Put(namespace string, key, value []byte) error {
+	defer s.observe(s.label(namespace), latencyOpWrite, s.clk.Now())
+	return s.kvStore.Put(namespace, key, value)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (s *latencyKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	defer s.observe(s.label(namespace), latencyOpWrite, s.clk.Now())
+	return s.kvStore.PutIfNotExists(namespace, key, value)
+}
+
+// Get retrieves a record, whose latency is not observed
+func (s *latencyKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	return s.kvStore.Get(namespace, key)
+}
+
+// Delete deletes a record
+func (s *latencyKVStore) Delete(namespace string, key []byte) error {
+	defer s.observe(s.label(namespace), latencyOpWrite, s.clk.Now())
+	return s.kvStore.Delete(namespace, key)
+}
+
+// Commit commits a batch, labeled by its namespace if it has only one
+func (s *latencyKVStore) Commit(b KVStoreBatch) error {
+	counts, err := batchNamespaceCounts(b)
+	if err != nil {
+		return err
+	}
+	label := latencyLabelMixed
+	if len(counts) == 1 {
+		for namespace := range counts {
+			label = s.label(namespace)
+		}
+	}
+	defer s.observe(label, latencyOpCommit, s.clk.Now())
+	return s.kvStore.Commit(b)
+}
+
+//======================================
+// private functions
+//======================================
+
+// underlying returns the KV store wrapped
+func (s *latencyKVStore) underlying() KVStore { return s.kvStore }
+
+// label returns the label of the namespace, giving it a label of its own if the limit is not reached yet
+func (s *latencyKVStore) label(namespace string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.labels[namespace]; ok {
+		return namespace
+	}
+	if len(s.labels) >= s.limit {
+		return latencyLabelOther
+	}
+	s.labels[namespace] = struct{}{}
+	return namespace
+}
+
+// observe observes the latency of the op since start
+func (s *latencyKVStore) observe(label, op string, start time.Time) {
+	namespaceLatencyMtc.WithLabelValues(label, op).Observe(s.clk.Now().Sub(start).Seconds())
+}
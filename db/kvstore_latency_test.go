@@ -0,0 +1,119 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestLatencyMetrics(t *testing.T) {
+	// latencyCount returns the number of latencies observed of the op under the label
+	latencyCount := func(require *require.Assertions, label, op string) uint64 {
+		families, err := prometheus.DefaultGatherer.Gather()
+		require.NoError(err)
+		for _, family := range families {
+			if family.GetName() != "iotex_db_namespace_latency_seconds" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				labels := make(map[string]string)
+				for _, pair := range metric.GetLabel() {
+					labels[pair.GetName()] = pair.GetValue()
+				}
+				if labels["namespace"] == label && labels["op"] == op {
+					return metric.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+		return 0
+	}
+
+	testLatency := func(newKVStore func(...KVStoreOption) KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		kvStore := newKVStore(WithLatencyMetrics(2))
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		labels := []string{bucket1, bucket2, latencyLabelMixed, latencyLabelOther}
+		counts := func(op string) map[string]uint64 {
+			counts := make(map[string]uint64)
+			for _, label := range labels {
+				counts[label] = latencyCount(require, label, op)
+			}
+			return counts
+		}
+		writes, commits := counts(latencyOpWrite), counts(latencyOpCommit)
+
+		// the commits of a single namespace are observed under its label
+		for i := 0; i < 3; i++ {
+			batch := NewBatch()
+			require.NoError(batch.Put(bucket1, testK1[i], testV1[i], ""))
+			require.NoError(batch.Put(bucket1, testK1[(i+1)%3], testV1[i], ""))
+			require.NoError(kvStore.Commit(batch))
+		}
+		batch := NewBatch()
+		require.NoError(batch.Put(bucket2, testK2[0], testV2[0], ""))
+		require.NoError(kvStore.Commit(batch))
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[1]))
+		require.NoError(kvStore.Delete(bucket2, testK2[0]))
+
+		// a batch of several namespaces is observed as mixed
+		batch = NewBatch()
+		require.NoError(batch.Put(bucket1, testK1[0], testV1[0], ""))
+		require.NoError(batch.Put(bucket2, testK2[0], testV2[0], ""))
+		require.NoError(kvStore.Commit(batch))
+
+		// the namespaces beyond the limit are observed as other
+		require.NoError(kvStore.Put("overflow1", testK1[0], testV1[0]))
+		require.NoError(kvStore.Put("overflow2", testK1[0], testV1[0]))
+		batch = NewBatch()
+		require.NoError(batch.Put("overflow1", testK1[1], testV1[1], ""))
+		require.NoError(kvStore.Commit(batch))
+
+		diff := func(before, after map[string]uint64) map[string]uint64 {
+			for label := range after {
+				after[label] -= before[label]
+			}
+			return after
+		}
+		require.Equal(map[string]uint64{bucket1: 1, bucket2: 1, latencyLabelMixed: 0, latencyLabelOther: 2},
+			diff(writes, counts(latencyOpWrite)))
+		require.Equal(map[string]uint64{bucket1: 3, bucket2: 1, latencyLabelMixed: 1, latencyLabelOther: 1},
+			diff(commits, counts(latencyOpCommit)))
+		require.Equal(uint64(0), latencyCount(require, "overflow1", latencyOpWrite))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testLatency(NewMemKVStore, t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-latency.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testLatency(func(opts ...KVStoreOption) KVStore { return NewOnDiskDB(dbCfg, opts...) }, t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-latency.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testLatency(func(opts ...KVStoreOption) KVStore { return NewOnDiskDB(dbCfg, opts...) }, t)
+	})
+}
@@ -0,0 +1,343 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+)
+
+type (
+	// CachedKVStore is a KV store with a read cache
+	CachedKVStore interface {
+		KVStore
+		// Stats returns the statistics of the cache
+		Stats() CacheStats
+	}
+
+	// CacheStats is the statistics of the read cache
+	CacheStats struct {
+		// Hits is the number of Get served from the cache
+		Hits uint64
+		// Misses is the number of Get served from the underlying KV store
+		Misses uint64
+		// Evictions is the number of records evicted to make room for new ones
+		Evictions uint64
+		// Size is the current number of records in the cache
+		Size int
+		// NegativeHits is the number of Get of absent keys served from the negative cache
+		NegativeHits uint64
+		// NegativeSize is the current number of absent keys in the negative cache, including those expired but not
+		// removed yet
+		NegativeSize int
+	}
+
+	// CacheOption sets an option of the cached KV store
+	CacheOption func(*cachedKVStore)
+
+	// cacheKey identifies a record in the cache
+	cacheKey struct {
+		namespace string
+		key       string
+	}
+
+	// cacheEntry is an element of the LRU list
+	cacheEntry struct {
+		key   cacheKey
+		value []byte
+	}
+
+	// negativeEntry is an element of the LRU list of the negative cache
+	negativeEntry struct {
+		key     cacheKey
+		expires time.Time
+		// cause is the cause of the error the key is found absent with, ErrNotExist or bolt.ErrBucketNotFound
+		cause error
+	}
+
+	// cacheFill tracks the Get misses of a key reading from the underlying KV store
+	cacheFill struct {
+		// readers is the number of Get misses in flight
+		readers int
+		// version is bumped by every write of the key, a miss only fills the cache if it is unchanged
+		version uint64
+	}
+
+	// cachedKVStore is a KV store with a LRU read-through cache in front of the underlying KV store
+	cachedKVStore struct {
+		mutex     sync.Mutex
+		kvStore   KVStore
+		size      int
+		lru       *list.List
+		entries   map[cacheKey]*list.Element
+		fills     map[cacheKey]*cacheFill
+		hits      uint64
+		misses    uint64
+		evictions uint64
+		// absent is the LRU list of the keys found absent, at most absentSize of them for absentTTL each
+		absent        *list.List
+		absentEntries map[cacheKey]*list.Element
+		absentSize    int
+		absentTTL     time.Duration
+		negativeHits  uint64
+		clk           clock.Clock
+	}
+)
+
+// WithNegativeCache makes the cached KV store also remember up to size keys found absent, for ttl each, so that a Get
+// of a key which mostly does not exist, such as an existence check, returns ErrNotExist without reading the underlying
+// KV store again. A write of the key through the cached KV store forgets it right away, while a write bypassing the
+// cached KV store may go unseen for up to ttl. A key remembered absent returns the same cause of error as the
+// underlying KV store did
+func WithNegativeCache(size int, ttl time.Duration) CacheOption {
+	return func(c *cachedKVStore) {
+		c.absentSize = size
+		c.absentTTL = ttl
+	}
+}
+
+// WithCacheClock sets the clock the entries of the negative cache expire by, the real clock by default
+func WithCacheClock(clk clock.Clock) CacheOption {
+	return func(c *cachedKVStore) {
+		c.clk = clk
+	}
+}
+
+// NewCachedKVStore wraps the KV store with a LRU read-through cache holding at most size records. Writes go through
+// to the underlying KV store and evict the written records from the cache
+func NewCachedKVStore(kvStore KVStore, size int, opts ...CacheOption) CachedKVStore {
+	c := &cachedKVStore{
+		kvStore:       kvStore,
+		size:          size,
+		lru:           list.New(),
+		entries:       make(map[cacheKey]*list.Element),
+		fills:         make(map[cacheKey]*cacheFill),
+		absent:        list.New(),
+		absentEntries: make(map[cacheKey]*list.Element),
+		clk:           clock.New(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Start starts the underlying KV store
+func (c *cachedKVStore) Start(ctx context.Context) error {
+	return c.kvStore.Start(ctx)
+}
+
+// Stop purges the cache and stops the underlying KV store
+func (c *cachedKVStore) Stop(ctx context.Context) error {
+	c.mutex.Lock()
+	c.lru.Init()
+	c.entries = make(map[cacheKey]*list.Element)
+	c.absent.Init()
+	c.absentEntries = make(map[cacheKey]*list.Element)
+	c.mutex.Unlock()
+	return c.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record
+func (c *cachedKVStore) Put(namespace string, key, value []byte) error {
+	defer c.invalidate(cacheKey{namespace: namespace, key: string(key)})
+	return c.kvStore.Put(namespace, key, value)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (c *cachedKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	defer c.invalidate(cacheKey{namespace: namespace, key: string(key)})
+	return c.kvStore.PutIfNotExists(namespace, key, value)
+}
+
+// Get retrieves a record from the cache, or from the underlying KV store upon a miss. A key remembered absent by the
+// negative cache returns its error right away
+func (c *cachedKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	k := cacheKey{namespace: namespace, key: string(key)}
+	c.mutex.Lock()
+	if elem, ok := c.entries[k]; ok {
+		c.lru.MoveToFront(elem)
+		value := copyBytes(elem.Value.(*cacheEntry).value)
+		c.mutex.Unlock()
+		atomic.AddUint64(&c.hits, 1)
+		return value, nil
+	}
+	if cause := c.absentCause(k); cause != nil {
+		c.mutex.Unlock()
+		atomic.AddUint64(&c.negativeHits, 1)
+		return nil, kvError("Get", namespace, key, cause)
+	}
+	fill, ok := c.fills[k]
+	if !ok {
+		fill = &cacheFill{}
+		c.fills[k] = fill
+	}
+	fill.readers++
+	version := fill.version
+	c.mutex.Unlock()
+
+	atomic.AddUint64(&c.misses, 1)
+	value, err := c.kvStore.Get(namespace, key)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if fill.readers--; fill.readers == 0 {
+		delete(c.fills, k)
+	}
+	if err != nil {
+		if isNotExist(err) && fill.version == version {
+			c.addAbsent(k, errors.Cause(err))
+		}
+		return nil, err
+	}
+	// the value read is stale if the key has been written meanwhile
+	if fill.version == version {
+		c.add(k, copyBytes(value))
+	}
+	return value, nil
+}
+
+// Delete deletes a record
+func (c *cachedKVStore) Delete(namespace string, key []byte) error {
+	defer c.invalidate(cacheKey{namespace: namespace, key: string(key)})
+	return c.kvStore.Delete(namespace, key)
+}
+
+// Commit commits a batch, and evicts the records written by the batch from the cache. The batch must not be
+// modified while being committed
+func (c *cachedKVStore) Commit(b KVStoreBatch) error {
+	b.Lock()
+	keys := make([]cacheKey, 0, b.Size())
+	for i := 0; i < b.Size(); i++ {
+		write, err := b.Entry(i)
+		if err != nil {
+			b.Unlock()
+			return err
+		}
+		keys = append(keys, cacheKey{namespace: write.namespace, key: string(write.key)})
+	}
+	b.Unlock()
+
+	defer c.invalidate(keys...)
+	return c.kvStore.Commit(b)
+}
+
+// Stats returns the statistics of the cache
+func (c *cachedKVStore) Stats() CacheStats {
+	c.mutex.Lock()
+	size, negativeSize := c.lru.Len(), c.absent.Len()
+	c.mutex.Unlock()
+	return CacheStats{
+		Hits:         atomic.LoadUint64(&c.hits),
+		Misses:       atomic.LoadUint64(&c.misses),
+		Evictions:    atomic.LoadUint64(&c.evictions),
+		Size:         size,
+		NegativeHits: atomic.LoadUint64(&c.negativeHits),
+		NegativeSize: negativeSize,
+	}
+}
+
+//======================================
+// private functions
+//======================================
+
+// add puts a record into the cache, evicting the least recently used record if the cache is full
+func (c *cachedKVStore) add(k cacheKey, value []byte) {
+	if elem, ok := c.entries[k]; ok {
+		elem.Value.(*cacheEntry).value = value
+		c.lru.MoveToFront(elem)
+		return
+	}
+	if c.size <= 0 {
+		return
+	}
+	for c.lru.Len() >= c.size {
+		c.remove(c.lru.Back().Value.(*cacheEntry).key)
+		atomic.AddUint64(&c.evictions, 1)
+	}
+	c.entries[k] = c.lru.PushFront(&cacheEntry{key: k, value: value})
+}
+
+// addAbsent remembers the key absent for the TTL of the negative cache, forgetting the least recently used absent key
+// if the negative cache is full
+func (c *cachedKVStore) addAbsent(k cacheKey, cause error) {
+	if c.absentSize <= 0 {
+		return
+	}
+	expires := c.clk.Now().Add(c.absentTTL)
+	if elem, ok := c.absentEntries[k]; ok {
+		entry := elem.Value.(*negativeEntry)
+		entry.expires, entry.cause = expires, cause
+		c.absent.MoveToFront(elem)
+		return
+	}
+	for c.absent.Len() >= c.absentSize {
+		c.removeAbsent(c.absent.Back().Value.(*negativeEntry).key)
+	}
+	c.absentEntries[k] = c.absent.PushFront(&negativeEntry{key: k, expires: expires, cause: cause})
+}
+
+// absentCause returns the cause of the error the key is found absent with if it is remembered absent and has not
+// expired yet, otherwise nil. An expired key is forgotten
+func (c *cachedKVStore) absentCause(k cacheKey) error {
+	elem, ok := c.absentEntries[k]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*negativeEntry)
+	if !c.clk.Now().Before(entry.expires) {
+		c.removeAbsent(k)
+		return nil
+	}
+	c.absent.MoveToFront(elem)
+	return entry.cause
+}
+
+func (c *cachedKVStore) removeAbsent(k cacheKey) {
+	if elem, ok := c.absentEntries[k]; ok {
+		c.absent.Remove(elem)
+		delete(c.absentEntries, k)
+	}
+}
+
+// invalidate removes the written records from the cache, and makes the Get misses in flight, which may have read
+// the old values, not fill the cache
+func (c *cachedKVStore) invalidate(keys ...cacheKey) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, k := range keys {
+		if fill, ok := c.fills[k]; ok {
+			fill.version++
+		}
+		c.remove(k)
+		c.removeAbsent(k)
+	}
+}
+
+func (c *cachedKVStore) remove(k cacheKey) {
+	if elem, ok := c.entries[k]; ok {
+		c.lru.Remove(elem)
+		delete(c.entries, k)
+	}
+}
+
+// copyBytes returns a copy of the value, so the cached value is never shared with the callers
+func copyBytes(value []byte) []byte {
+	if value == nil {
+		return nil
+	}
+	c := make([]byte, len(value))
+	copy(c, value)
+	return c
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingKVStore blocks Get after reading the underlying KV store, until it is resumed
+type blockingKVStore struct {
+	KVStore
+	read   chan struct{}
+	resume chan struct{}
+}
+
+func (s *blockingKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	value, err := s.KVStore.Get(namespace, key)
+	s.read <- struct{}{}
+	<-s.resume
+	return value, err
+}
+
+func TestCachedKVStore(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	inner := NewMemKVStore()
+	kvStore := NewCachedKVStore(inner, 2)
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	for i := 0; i < 3; i++ {
+		require.NoError(inner.Put(bucket1, testK1[i], testV1[i]))
+	}
+
+	// miss, then hit
+	v, err := kvStore.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], v)
+	v, err = kvStore.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], v)
+	require.Equal(CacheStats{Hits: 1, Misses: 1, Size: 1}, kvStore.Stats())
+
+	// a missing key is not cached
+	_, err = kvStore.Get(bucket2, testK2[0])
+	require.Error(err)
+	require.Equal(CacheStats{Hits: 1, Misses: 2, Size: 1}, kvStore.Stats())
+
+	// the least recently used record is evicted
+	_, err = kvStore.Get(bucket1, testK1[1])
+	require.NoError(err)
+	_, err = kvStore.Get(bucket1, testK1[2])
+	require.NoError(err)
+	require.Equal(CacheStats{Hits: 1, Misses: 4, Evictions: 1, Size: 2}, kvStore.Stats())
+	v, err = kvStore.Get(bucket1, testK1[1])
+	require.NoError(err)
+	require.Equal(testV1[1], v)
+	v, err = kvStore.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], v)
+	require.Equal(CacheStats{Hits: 2, Misses: 5, Evictions: 2, Size: 2}, kvStore.Stats())
+
+	// the cached value is not shared with the callers
+	v, err = kvStore.Get(bucket1, testK1[0])
+	require.NoError(err)
+	v[0] = 'x'
+	v, err = kvStore.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], v)
+	require.Equal(CacheStats{Hits: 4, Misses: 5, Evictions: 2, Size: 2}, kvStore.Stats())
+
+	// writes evict the written records
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[2]))
+	v, err = kvStore.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[2], v)
+	require.NoError(kvStore.Delete(bucket1, testK1[1]))
+	_, err = kvStore.Get(bucket1, testK1[1])
+	require.Error(err)
+	batch := NewBatch()
+	batch.Put(bucket1, testK1[0], testV1[1], "")
+	require.NoError(kvStore.Commit(batch))
+	v, err = kvStore.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[1], v)
+	require.Equal(CacheStats{Hits: 4, Misses: 8, Evictions: 2, Size: 1}, kvStore.Stats())
+}
+
+func TestCachedKVStoreStaleFill(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	inner := &blockingKVStore{
+		KVStore: NewMemKVStore(),
+		read:    make(chan struct{}),
+		resume:  make(chan struct{}),
+	}
+	kvStore := NewCachedKVStore(inner, 2)
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	require.NoError(inner.KVStore.Put(bucket1, testK1[0], testV1[0]))
+
+	for _, write := range []func() error{
+		func() error { return kvStore.Delete(bucket1, testK1[0]) },
+		func() error { return kvStore.Put(bucket1, testK1[0], testV1[1]) },
+		func() error {
+			batch := NewBatch()
+			batch.Put(bucket1, testK1[0], testV1[2], "")
+			return kvStore.Commit(batch)
+		},
+	} {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = kvStore.Get(bucket1, testK1[0])
+		}()
+		// the key is written after the miss reads the old value, and before the miss fills the cache
+		<-inner.read
+		require.NoError(write())
+		inner.resume <- struct{}{}
+		<-done
+
+		// the old value read by the miss is not cached
+		require.Equal(0, kvStore.Stats().Size)
+	}
+}
+
+func TestCachedKVStoreNegativeCache(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	clk := clock.NewMock()
+	inner := NewMemKVStore()
+	kvStore := NewCachedKVStore(inner, 2, WithNegativeCache(2, time.Minute), WithCacheClock(clk))
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+
+	// the repeated lookups of an absent key are served by the negative cache
+	for i := 0; i < 3; i++ {
+		_, err := kvStore.Get(bucket1, testK1[0])
+		require.True(isNotExist(err))
+	}
+	require.Equal(CacheStats{Misses: 1, NegativeHits: 2, NegativeSize: 1}, kvStore.Stats())
+
+	// a write forgets the key is absent, so it is found right away
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+	v, err := kvStore.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], v)
+	require.Equal(CacheStats{Misses: 2, NegativeHits: 2, Size: 1}, kvStore.Stats())
+
+	// a key written bypassing the cached KV store is found once the absent key expires
+	_, err = kvStore.Get(bucket1, testK1[1])
+	require.True(isNotExist(err))
+	require.NoError(inner.Put(bucket1, testK1[1], testV1[1]))
+	_, err = kvStore.Get(bucket1, testK1[1])
+	require.True(isNotExist(err))
+	clk.Add(time.Minute)
+	v, err = kvStore.Get(bucket1, testK1[1])
+	require.NoError(err)
+	require.Equal(testV1[1], v)
+	require.Equal(CacheStats{Misses: 4, NegativeHits: 3, Size: 2}, kvStore.Stats())
+
+	// the least recently used absent key is forgotten to make room for a new one
+	for _, key := range [][]byte{testK2[0], testK2[1], testK2[2]} {
+		_, err = kvStore.Get(bucket2, key)
+		require.True(isNotExist(err))
+	}
+	require.Equal(2, kvStore.Stats().NegativeSize)
+	_, err = kvStore.Get(bucket2, testK2[0])
+	require.True(isNotExist(err))
+	require.Equal(CacheStats{Misses: 8, NegativeHits: 3, Size: 2, NegativeSize: 2}, kvStore.Stats())
+}
@@ -0,0 +1,338 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// overlayFlattenBatchSize is the number of records Flatten commits at a time
+const overlayFlattenBatchSize = 1024
+
+const (
+	// overlayTombstone and overlayValue mark a value of the writable KV store as a delete hiding the record of the
+	// base KV store, or as a value following the mark
+	overlayTombstone byte = iota
+	overlayValue
+)
+
+type (
+	// OverlayKVStore is a KV store writing to a writable layer over a base KV store which is never modified
+	OverlayKVStore interface {
+		KVStore
+		KeyPager
+		// Flatten writes the records of the namespaces as seen through the overlay, i.e. the records of the base KV
+		// store as modified by the writable layer, to dst, 1024 records a commit. If no namespace is given, the
+		// namespaces of both KV stores are flattened, which requires them to list their namespaces, as BadgerDB does
+		// not. The overlay is left as is
+		Flatten(dst KVStore, namespaces ...string) error
+	}
+
+	// overlayKVStore implements OverlayKVStore, keeping each value of the writable KV store prefixed with its mark
+	overlayKVStore struct {
+		base     KVStore
+		writable KVStore
+		// mutex serializes the writes, so that a PutIfNotExists or an AddCounter reads the record it writes over
+		// unchanged meanwhile
+		mutex sync.Mutex
+	}
+)
+
+// NewOverlayKVStore returns a KV store of the records of base as modified by the writes to writable, e.g. to execute a
+// block speculatively on top of the state without touching it. The writes go to writable only, a Delete included,
+// which is kept as a tombstone hiding the record of base. Get and KeysPaged read writable and then base, with the
+// records of writable taking precedence and the tombstones excluded. base and writable must be KeyPagers for
+// KeysPaged and Flatten. Start and Stop start and stop both KV stores. The values of writable are marked, so it must
+// be read through the overlay only
+func NewOverlayKVStore(base, writable KVStore) OverlayKVStore {
+	return &overlayKVStore{base: base, writable: writable}
+}
+
+// Start starts the base and the writable KV stores
+func (s *overlayKVStore) Start(ctx context.Context) error {
+	if err := s.base.Start(ctx); err != nil {
+		return err
+	}
+	return s.writable.Start(ctx)
+}
+
+// Stop stops the writable and the base KV stores
+func (s *overlayKVStore) Stop(ctx context.Context) error {
+	err := s.writable.Stop(ctx)
+	if baseErr := s.base.Stop(ctx); err == nil {
+		err = baseErr
+	}
+	return err
+}
+
+// Put inserts a <key, value> record into the writable KV store
+func (s *overlayKVStore) Put(namespace string, key, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.writable.Put(namespace, key, overlayMark(overlayValue, value))
+}
+
+// PutIfNotExists inserts a <key, value> record into the writable KV store only if it does not exist through the
+// overlay yet, otherwise return ErrAlreadyExist
+func (s *overlayKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.get(namespace, key); err == nil {
+		return errors.Wrapf(ErrAlreadyExist, "key = %x", key)
+	} else if !isNotExist(err) {
+		return err
+	}
+	return s.writable.Put(namespace, key, overlayMark(overlayValue, value))
+}
+
+// Get retrieves a record from the writable KV store, or from the base KV store if the writable one has neither the
+// record nor its tombstone
+func (s *overlayKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	return s.get(namespace, key)
+}
+
+// Delete writes a tombstone of the record into the writable KV store
+func (s *overlayKVStore) Delete(namespace string, key []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.writable.Put(namespace, key, []byte{overlayTombstone})
+}
+
+// Commit applies the entries of the batch on top of the records through the overlay, and commits the outcome to the
+// writable KV store as a batch of puts of values and tombstones, so that it is atomic if the writable KV store commits
+// atomically
+func (s *overlayKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// pending is the value of each record written by the batch so far, nil for a delete
+	pending := make(map[cacheKey][]byte)
+	var order []cacheKey
+	for i := 0; i < b.Size(); i++ {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		k := cacheKey{namespace: write.namespace, key: string(write.key)}
+		value, written := pending[k]
+		if !written && write.writeType != Put && write.writeType != Delete {
+			if value, err = s.get(write.namespace, write.key); err != nil && !isNotExist(err) {
+				return err
+			}
+		}
+		switch write.writeType {
+		case Put:
+			value = write.value
+		case PutIfNotExists:
+			if value != nil {
+				return errors.Wrapf(ErrAlreadyExist, "key = %x", write.key)
+			}
+			value = write.value
+		case Delete:
+			value = nil
+		case AddCounter:
+			if value, err = addToCounter(value, write.value); err != nil {
+				return err
+			}
+		}
+		if !written {
+			order = append(order, k)
+		}
+		pending[k] = value
+	}
+	entries := make([]writeInfo, len(order))
+	for i, k := range order {
+		value := []byte{overlayTombstone}
+		if v := pending[k]; v != nil {
+			value = overlayMark(overlayValue, v)
+		}
+		entries[i] = writeInfo{writeType: Put, namespace: k.namespace, key: []byte(k.key), value: value}
+	}
+	if err := s.writable.Commit(newBatchOf(entries)); err != nil {
+		return err
+	}
+	succeed = true
+	return nil
+}
+
+// KeysPaged merges the pages of keys of the writable and the base KV stores into a page of the keys through the
+// overlay in sorted order, skipping the keys of tombstones
+func (s *overlayKVStore) KeysPaged(namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	if limit <= 0 {
+		return nil, nil, errors.Wrapf(ErrInvalidDB, "invalid limit %d", limit)
+	}
+	page := make([][]byte, 0, limit)
+	for {
+		keys, more, err := s.mergedKeys(namespace, after, limit)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, key := range keys {
+			if _, err := s.get(namespace, key); isNotExist(err) {
+				continue
+			} else if err != nil {
+				return nil, nil, err
+			}
+			page = append(page, key)
+			if len(page) == limit {
+				return page, key, nil
+			}
+		}
+		if !more {
+			return page, nil, nil
+		}
+		after = keys[len(keys)-1]
+	}
+}
+
+// Flatten writes the records of the namespaces through the overlay to dst
+func (s *overlayKVStore) Flatten(dst KVStore, namespaces ...string) error {
+	if len(namespaces) == 0 {
+		var err error
+		if namespaces, err = s.namespaceNames(); err != nil {
+			return err
+		}
+	}
+	for _, namespace := range namespaces {
+		if err := createReservedNamespace(dst, namespace); err != nil {
+			return errors.Wrapf(err, "failed to create namespace %s", namespace)
+		}
+		batch := NewBatch()
+		after := []byte{}
+		for after != nil {
+			keys, next, err := s.KeysPaged(namespace, after, overlayFlattenBatchSize)
+			if err != nil {
+				return errors.Wrapf(err, "failed to list keys of namespace %s", namespace)
+			}
+			for _, key := range keys {
+				value, err := s.get(namespace, key)
+				if isNotExist(err) {
+					// deleted since listed
+					continue
+				}
+				if err != nil {
+					return errors.Wrapf(err, "failed to get key = %x", key)
+				}
+				batch.Put(namespace, key, value, "failed to flatten key = %x", key)
+			}
+			if err := dst.Commit(batch); err != nil {
+				return errors.Wrapf(err, "failed to flatten namespace %s", namespace)
+			}
+			batch = NewBatch()
+			after = next
+		}
+	}
+	return nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// get retrieves a record through the overlay, returning ErrNotExist for a tombstone
+func (s *overlayKVStore) get(namespace string, key []byte) ([]byte, error) {
+	value, err := s.writable.Get(namespace, key)
+	if isNotExist(err) {
+		return s.base.Get(namespace, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(value) == 0 {
+		return nil, errors.Wrapf(ErrInvalidDB, "unmarked overlay value of key = %x", key)
+	}
+	if value[0] == overlayTombstone {
+		return nil, errors.Wrapf(ErrNotExist, "key = %x is deleted in the overlay", key)
+	}
+	return value[1:], nil
+}
+
+// mergedKeys merges the pages of keys of both KV stores after the cursor into up to limit distinct keys in sorted
+// order, tombstones included, and returns whether there are more keys after them
+func (s *overlayKVStore) mergedKeys(namespace string, after []byte, limit int) ([][]byte, bool, error) {
+	var keys [][]byte
+	more := false
+	for _, kvStore := range []KVStore{s.writable, s.base} {
+		pager, ok := kvStore.(KeyPager)
+		if !ok {
+			return nil, false, errors.Wrap(ErrInvalidDB, "KV store of the overlay is not a KeyPager")
+		}
+		page, cursor, err := pager.KeysPaged(namespace, after, limit)
+		if isNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		keys = append(keys, page...)
+		more = more || cursor != nil
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	distinct := keys[:0]
+	for _, key := range keys {
+		if len(distinct) == 0 || !bytes.Equal(distinct[len(distinct)-1], key) {
+			distinct = append(distinct, key)
+		}
+	}
+	// the keys of a KV store beyond its page all sort after its page of limit keys, so the first limit keys are
+	// complete
+	if len(distinct) > limit || more {
+		return distinct[:limit], true, nil
+	}
+	return distinct, false, nil
+}
+
+// namespaceNames returns the namespaces of both KV stores
+func (s *overlayKVStore) namespaceNames() ([]string, error) {
+	seen := make(map[string]struct{})
+	var names []string
+	for _, kvStore := range []KVStore{s.base, s.writable} {
+		lister, ok := kvStore.(namespaceLister)
+		if !ok {
+			return nil, errors.Wrap(ErrInvalidDB, "KV store of the overlay is unable to list its namespaces")
+		}
+		namespaces, err := lister.namespaceNames()
+		if err != nil {
+			return nil, err
+		}
+		for _, namespace := range namespaces {
+			if _, ok := seen[namespace]; !ok {
+				seen[namespace] = struct{}{}
+				names = append(names, namespace)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// overlayMark returns the value prefixed with the mark
+func overlayMark(mark byte, value []byte) []byte {
+	return append([]byte{mark}, value...)
+}
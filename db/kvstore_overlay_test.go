@@ -0,0 +1,133 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestOverlayKVStore(t *testing.T) {
+	testOverlay := func(base KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		key := func(i int) []byte { return []byte(fmt.Sprintf("key-%02d", i)) }
+		overlay := NewOverlayKVStore(base, NewMemKVStore())
+		require.NoError(overlay.Start(ctx))
+		defer func() {
+			require.NoError(overlay.Stop(ctx))
+		}()
+		batch := NewBatch()
+		for i := 0; i < 10; i += 2 {
+			require.NoError(batch.Put(bucket1, key(i), testV1[0], ""))
+		}
+		require.NoError(base.Commit(batch))
+		baseValue := func(k []byte) ([]byte, error) { return base.Get(bucket1, k) }
+
+		// the writes go to the overlay only
+		require.NoError(overlay.Put(bucket1, key(0), testV1[1]))
+		require.NoError(overlay.Put(bucket1, key(1), testV1[1]))
+		value, err := overlay.Get(bucket1, key(0))
+		require.NoError(err)
+		require.Equal(testV1[1], value)
+		value, err = overlay.Get(bucket1, key(2))
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+		value, err = baseValue(key(0))
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+		_, err = baseValue(key(1))
+		require.True(isNotExist(err))
+		require.Equal(ErrAlreadyExist, errors.Cause(overlay.PutIfNotExists(bucket1, key(4), testV1[2])))
+
+		// a delete hides the record of the base, which is kept
+		require.NoError(overlay.Delete(bucket1, key(2)))
+		_, err = overlay.Get(bucket1, key(2))
+		require.Equal(ErrNotExist, errors.Cause(err))
+		_, err = baseValue(key(2))
+		require.NoError(err)
+		require.NoError(overlay.PutIfNotExists(bucket1, key(2), testV1[2]))
+		require.NoError(overlay.Delete(bucket1, key(2)))
+
+		// a batch applies on top of the records through the overlay
+		counter := make([]byte, 8)
+		binary.BigEndian.PutUint64(counter, 5)
+		batch = NewBatch()
+		require.NoError(batch.Delete(bucket1, key(4), ""))
+		require.NoError(batch.PutIfNotExists(bucket1, key(4), counter, ""))
+		require.NoError(batch.AddCounter(bucket1, key(4), 2))
+		require.NoError(batch.Delete(bucket1, key(1), ""))
+		require.NoError(overlay.Commit(batch))
+		value, err = overlay.Get(bucket1, key(4))
+		require.NoError(err)
+		require.Equal(uint64(7), binary.BigEndian.Uint64(value))
+		batch = NewBatch()
+		require.NoError(batch.Put(bucket1, key(5), testV1[2], ""))
+		require.NoError(batch.PutIfNotExists(bucket1, key(6), testV1[2], ""))
+		require.Equal(ErrAlreadyExist, errors.Cause(overlay.Commit(batch)))
+		_, err = overlay.Get(bucket1, key(5))
+		require.True(isNotExist(err))
+
+		// the iteration merges both layers, with the overlay winning and the tombstones excluded
+		expected := [][]byte{key(0), key(4), key(6), key(8)}
+		for _, limit := range []int{1, 2, 3, 10} {
+			var keys [][]byte
+			after := []byte{}
+			for after != nil {
+				page, next, err := overlay.KeysPaged(bucket1, after, limit)
+				require.NoError(err)
+				require.True(len(page) <= limit)
+				keys = append(keys, page...)
+				after = next
+			}
+			require.Equal(expected, keys)
+		}
+
+		// flatten merges the overlay down into a new KV store
+		flat := NewMemKVStore()
+		require.NoError(flat.Start(ctx))
+		defer func() {
+			require.NoError(flat.Stop(ctx))
+		}()
+		require.NoError(overlay.Flatten(flat, bucket1))
+		for _, k := range [][]byte{key(0), key(1), key(2), key(4), key(6), key(8)} {
+			expectedValue, expectedErr := overlay.Get(bucket1, k)
+			value, err := flat.Get(bucket1, k)
+			require.Equal(isNotExist(expectedErr), isNotExist(err))
+			require.Equal(expectedValue, value)
+		}
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testOverlay(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-overlay.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testOverlay(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-overlay.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testOverlay(NewOnDiskDB(dbCfg), t)
+	})
+}
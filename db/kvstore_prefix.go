@@ -0,0 +1,213 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// prefixKVStore is a KV store storing the keys of the prefixed namespaces without the prefix all their keys share
+type prefixKVStore struct {
+	kvStore  KVStore
+	prefixes map[string][]byte
+}
+
+// newPrefixKVStore wraps the KV store to elide the prefix of each namespace from its keys
+func newPrefixKVStore(kvStore KVStore, prefixes map[string][]byte) KVStore {
+	return &prefixKVStore{kvStore: kvStore, prefixes: prefixes}
+}
+
+// Start starts the underlying KV store
+func (s *prefixKVStore) Start(ctx context.Context) error {
+	return s.kvStore.Start(ctx)
+}
+
+// Stop stops the underlying KV store
+func (s *prefixKVStore) Stop(ctx context.Context) error {
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record
+func (s *prefixKVStore) Put(namespace string, key, value []byte) error {
+	stored, err := s.strip(namespace, key)
+	if err != nil {
+		return kvError("Put", namespace, key, err)
+	}
+	return s.kvStore.Put(namespace, stored, value)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (s *prefixKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	stored, err := s.strip(namespace, key)
+	if err != nil {
+		return kvError("PutIfNotExists", namespace, key, err)
+	}
+	return s.kvStore.PutIfNotExists(namespace, stored, value)
+}
+
+// Get retrieves a record, a key without the prefix of its namespace never exists
+func (s *prefixKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	stored, err := s.strip(namespace, key)
+	if err != nil {
+		return nil, kvError("Get", namespace, key, ErrNotExist)
+	}
+	return s.kvStore.Get(namespace, stored)
+}
+
+// Delete deletes a record
+func (s *prefixKVStore) Delete(namespace string, key []byte) error {
+	stored, err := s.strip(namespace, key)
+	if err != nil {
+		return kvError("Delete", namespace, key, err)
+	}
+	return s.kvStore.Delete(namespace, stored)
+}
+
+// Commit commits the batch with the keys of the prefixed namespaces stripped of their prefixes
+func (s *prefixKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	entries := make([]writeInfo, b.Size())
+	for i := range entries {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		entries[i] = *write
+		if entries[i].key, err = s.strip(write.namespace, write.key); err != nil {
+			return errors.Wrapf(err, "key = %x", write.key)
+		}
+	}
+	if err := s.kvStore.Commit(newBatchOf(entries)); err != nil {
+		return err
+	}
+	succeed = true
+	return nil
+}
+
+// SnapshotGet retrieves the records of the keys at the same point in time
+func (s *prefixKVStore) SnapshotGet(namespace string, keys [][]byte) ([][]byte, error) {
+	getter, ok := s.kvStore.(SnapshotGetter)
+	if !ok {
+		return nil, errors.Wrap(ErrInvalidDB, "KV store does not support snapshot reads")
+	}
+	stored := make([][]byte, 0, len(keys))
+	index := make([]int, 0, len(keys))
+	for i, key := range keys {
+		// a key without the prefix never exists, and is left nil
+		if k, err := s.strip(namespace, key); err == nil {
+			stored = append(stored, k)
+			index = append(index, i)
+		}
+	}
+	found, err := getter.SnapshotGet(namespace, stored)
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, len(keys))
+	for i, value := range found {
+		values[index[i]] = value
+	}
+	return values, nil
+}
+
+// StreamAll calls fn on each record of the namespace, with the prefix of the namespace added back to its key
+func (s *prefixKVStore) StreamAll(namespace string, fn func([]byte, []byte) error) error {
+	streamer, ok := s.kvStore.(Streamer)
+	if !ok {
+		return errors.Wrap(ErrInvalidDB, "KV store does not support streaming")
+	}
+	return streamer.StreamAll(namespace, func(stored, value []byte) error {
+		return fn(s.restore(namespace, stored), value)
+	})
+}
+
+// KeysPaged returns up to limit keys of the namespace after the cursor, with the prefix of the namespace added back.
+// The prefix is shared by all keys, so they are listed in the same order as they are stored
+func (s *prefixKVStore) KeysPaged(namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	pager, ok := s.kvStore.(KeyPager)
+	if !ok {
+		return nil, nil, errors.Wrap(ErrInvalidDB, "KV store does not support listing keys")
+	}
+	var stored []byte
+	if prefix, ok := s.prefixes[namespace]; ok && len(after) > 0 {
+		switch {
+		case bytes.HasPrefix(after, prefix):
+			stored = after[len(prefix):]
+		case bytes.Compare(after, prefix) > 0:
+			// the cursor is after all keys with the prefix
+			return [][]byte{}, nil, nil
+		}
+	} else {
+		stored = after
+	}
+	keys, cursor, err := pager.KeysPaged(namespace, stored, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, key := range keys {
+		keys[i] = s.restore(namespace, key)
+	}
+	if cursor != nil {
+		cursor = s.restore(namespace, cursor)
+	}
+	return keys, cursor, nil
+}
+
+// Size returns the size of the DB of the underlying KV store
+func (s *prefixKVStore) Size() (int64, error) {
+	sizer, ok := s.kvStore.(Sizer)
+	if !ok {
+		return 0, errors.Wrap(ErrInvalidDB, "KV store does not support reporting its size")
+	}
+	return sizer.Size()
+}
+
+//======================================
+// private functions
+//======================================
+
+// underlying returns the KV store wrapped
+func (s *prefixKVStore) underlying() KVStore { return s.kvStore }
+
+// strip returns the key without the prefix of the namespace, or ErrInvalidDB if the key does not start with it
+func (s *prefixKVStore) strip(namespace string, key []byte) ([]byte, error) {
+	prefix, ok := s.prefixes[namespace]
+	if !ok {
+		return key, nil
+	}
+	if !bytes.HasPrefix(key, prefix) {
+		return nil, errors.Wrapf(ErrInvalidDB, "key does not start with prefix %x of namespace %s", prefix, namespace)
+	}
+	return key[len(prefix):], nil
+}
+
+// restore returns the stored key with the prefix of the namespace added back
+func (s *prefixKVStore) restore(namespace string, stored []byte) []byte {
+	prefix, ok := s.prefixes[namespace]
+	if !ok {
+		return stored
+	}
+	key := make([]byte, len(prefix), len(prefix)+len(stored))
+	copy(key, prefix)
+	return append(key, stored...)
+}
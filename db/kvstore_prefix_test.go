@@ -0,0 +1,127 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestKeyPrefix(t *testing.T) {
+	prefix := []byte("account.balance.")
+	testPrefix := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		raw := kvStore.(*prefixKVStore).kvStore
+		key := func(i int) []byte { return []byte(fmt.Sprintf("%s%02d", prefix, i)) }
+
+		// the keys are stored without the prefix, and read with it
+		require.NoError(kvStore.Put(bucket1, key(3), testV1[0]))
+		require.NoError(kvStore.PutIfNotExists(bucket1, key(1), testV1[1]))
+		batch := NewBatch()
+		for _, i := range []int{7, 0, 5, 2} {
+			require.NoError(batch.Put(bucket1, key(i), testV1[2], ""))
+		}
+		require.NoError(batch.Put(bucket2, testK2[0], testV2[0], ""))
+		require.NoError(kvStore.Commit(batch))
+		value, err := kvStore.Get(bucket1, key(3))
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+		value, err = raw.Get(bucket1, []byte("03"))
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+		_, err = raw.Get(bucket1, key(3))
+		require.Error(err)
+		require.Equal(ErrAlreadyExist, errors.Cause(kvStore.PutIfNotExists(bucket1, key(1), testV1[0])))
+		require.NoError(kvStore.Delete(bucket1, key(2)))
+		_, err = kvStore.Get(bucket1, key(2))
+		require.Equal(ErrNotExist, errors.Cause(err))
+
+		// the keys of other namespaces are stored as is
+		value, err = raw.Get(bucket2, testK2[0])
+		require.NoError(err)
+		require.Equal(testV2[0], value)
+
+		// a key without the prefix is rejected, and never found
+		require.Equal(ErrInvalidDB, errors.Cause(kvStore.Put(bucket1, testK1[0], testV1[0])))
+		batch = NewBatch()
+		require.NoError(batch.Put(bucket1, testK1[0], testV1[0], ""))
+		require.Equal(ErrInvalidDB, errors.Cause(kvStore.Commit(batch)))
+		_, err = kvStore.Get(bucket1, testK1[0])
+		require.Equal(ErrNotExist, errors.Cause(err))
+		values, err := kvStore.(SnapshotGetter).SnapshotGet(bucket1, [][]byte{key(0), testK1[0], key(3)})
+		require.NoError(err)
+		require.Equal([][]byte{testV1[2], nil, testV1[0]}, values)
+
+		// the keys are listed in order with the prefix, page by page
+		var listed [][]byte
+		var after []byte
+		for {
+			keys, cursor, err := kvStore.(KeyPager).KeysPaged(bucket1, after, 2)
+			require.NoError(err)
+			listed = append(listed, keys...)
+			if cursor == nil {
+				break
+			}
+			after = cursor
+		}
+		expected := [][]byte{key(0), key(1), key(3), key(5), key(7)}
+		require.Equal(expected, listed)
+		keys, _, err := kvStore.(KeyPager).KeysPaged(bucket1, []byte("a"), 10)
+		require.NoError(err)
+		require.Equal(expected, keys)
+		keys, _, err = kvStore.(KeyPager).KeysPaged(bucket1, []byte("z"), 10)
+		require.NoError(err)
+		require.Empty(keys)
+
+		// the keys are streamed with the prefix
+		var mutex sync.Mutex
+		var streamed []string
+		require.NoError(kvStore.(Streamer).StreamAll(bucket1, func(k, _ []byte) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			streamed = append(streamed, string(k))
+			return nil
+		}))
+		sort.Strings(streamed)
+		require.Equal([]string{string(key(0)), string(key(1)), string(key(3)), string(key(5)), string(key(7))}, streamed)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testPrefix(NewMemKVStore(WithKeyPrefix(bucket1, prefix)), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-key-prefix.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testPrefix(NewOnDiskDB(dbCfg, WithKeyPrefix(bucket1, prefix)), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-key-prefix.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testPrefix(NewOnDiskDB(dbCfg, WithKeyPrefix(bucket1, prefix)), t)
+	})
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/logger"
+)
+
+// purgePageSize is the number of keys listed at a time to purge a namespace
+const purgePageSize = 1024
+
+// purgeKVStore is a KV store deleting all records of the purged namespaces in the background on a schedule
+type purgeKVStore struct {
+	kvStore   KVStore
+	pager     KeyPager
+	clk       clock.Clock
+	intervals map[string]time.Duration
+	// writeMutex is read locked by the writes and locked by a purge, so that a record written meanwhile is either
+	// purged along with the others or written after the purge
+	writeMutex sync.RWMutex
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// newPurgeKVStore wraps the KV store to purge each namespace of the intervals every interval, listing the keys to
+// delete from the backend
+func newPurgeKVStore(kvStore, backend KVStore, intervals map[string]time.Duration, clk clock.Clock) KVStore {
+	s := &purgeKVStore{
+		kvStore:   kvStore,
+		clk:       clk,
+		intervals: intervals,
+	}
+	s.pager, _ = backend.(KeyPager)
+	return s
+}
+
+// Start starts the underlying KV store, and the schedule of each purged namespace
+func (s *purgeKVStore) Start(ctx context.Context) error {
+	if s.pager == nil {
+		return errors.Wrap(ErrInvalidDB, "KV store does not support scheduled purge")
+	}
+	if err := s.kvStore.Start(ctx); err != nil {
+		return err
+	}
+	s.done = make(chan struct{})
+	namespaces := make([]string, 0, len(s.intervals))
+	for namespace := range s.intervals {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		// the ticker is started before Start returns, so that the first interval counts from the start
+		ticker := s.clk.Ticker(s.intervals[namespace])
+		s.wg.Add(1)
+		go s.purgeLoop(namespace, ticker)
+	}
+	return nil
+}
+
+// Stop stops the schedules, waiting for a purge in progress, and the underlying KV store
+func (s *purgeKVStore) Stop(ctx context.Context) error {
+	if s.done != nil {
+		close(s.done)
+		s.wg.Wait()
+		s.done = nil
+	}
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record
+func (s *purgeKVStore) Put(namespace string, key, value []byte) error {
+	s.writeMutex.RLock()
+	defer s.writeMutex.RUnlock()
+
+	return s.kvStore.Put(namespace, key, value)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (s *purgeKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	s.writeMutex.RLock()
+	defer s.writeMutex.RUnlock()
+
+	return s.kvStore.PutIfNotExists(namespace, key, value)
+}
+
+// Get retrieves a record, which a purge removes all at once with the others of its namespace
+func (s *purgeKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	return s.kvStore.Get(namespace, key)
+}
+
+// Delete deletes a record
+func (s *purgeKVStore) Delete(namespace string, key []byte) error {
+	s.writeMutex.RLock()
+	defer s.writeMutex.RUnlock()
+
+	return s.kvStore.Delete(namespace, key)
+}
+
+// Commit commits a batch
+func (s *purgeKVStore) Commit(b KVStoreBatch) error {
+	s.writeMutex.RLock()
+	defer s.writeMutex.RUnlock()
+
+	return s.kvStore.Commit(b)
+}
+
+//======================================
+// private functions
+//======================================
+
+// underlying returns the KV store wrapped
+func (s *purgeKVStore) underlying() KVStore { return s.kvStore }
+
+// purgeLoop purges the namespace on every tick of the ticker until stopped
+func (s *purgeKVStore) purgeLoop(namespace string, ticker *clock.Ticker) {
+	defer s.wg.Done()
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.purge(namespace); err != nil {
+				logger.Error().Err(err).Str("namespace", namespace).Msg("Failed to purge the namespace.")
+			}
+		}
+	}
+}
+
+// purge deletes all records of the namespace in a single commit, with the writes held off meanwhile, so that a read
+// sees either all of the records or none of them
+func (s *purgeKVStore) purge(namespace string) error {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	batch := NewBatch()
+	after := []byte{}
+	for after != nil {
+		keys, next, err := s.pager.KeysPaged(namespace, after, purgePageSize)
+		if isNotExist(err) {
+			break
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to list keys of namespace %s", namespace)
+		}
+		for _, key := range keys {
+			batch.Delete(namespace, key, "failed to purge key = %x", key)
+		}
+		after = next
+	}
+	if batch.Size() == 0 {
+		return nil
+	}
+	return s.kvStore.Commit(batch)
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestScheduledPurge(t *testing.T) {
+	testPurge := func(newKVStore func(...KVStoreOption) KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		clk := clock.NewMock()
+		kvStore := newKVStore(WithScheduledPurge(bucket1, 24*time.Hour), WithClock(clk))
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		key := func(i int) []byte { return []byte(fmt.Sprintf("key-%d", i)) }
+		// the records span several pages of keys
+		batch := NewBatch()
+		for i := 0; i < 2*purgePageSize+1; i++ {
+			require.NoError(batch.Put(bucket1, key(i), testV1[0], ""))
+		}
+		require.NoError(kvStore.Commit(batch))
+		require.NoError(kvStore.Put(bucket2, key(0), testV2[0]))
+		purged := func() (bool, error) {
+			_, err := kvStore.Get(bucket1, key(0))
+			return isNotExist(err), nil
+		}
+
+		// nothing is purged before the interval
+		clk.Add(23 * time.Hour)
+		ok, _ := purged()
+		require.False(ok)
+
+		// the namespace is emptied once the clock crosses the interval, and the others are left as they are
+		clk.Add(time.Hour)
+		require.NoError(testutil.WaitUntil(time.Millisecond, time.Second, purged))
+		for i := 0; i < 2*purgePageSize+1; i++ {
+			_, err := kvStore.Get(bucket1, key(i))
+			require.True(isNotExist(err))
+		}
+		value, err := kvStore.Get(bucket2, key(0))
+		require.NoError(err)
+		require.Equal(testV2[0], value)
+
+		// the records written afterwards are kept until the next interval
+		require.NoError(kvStore.Put(bucket1, key(0), testV1[1]))
+		value, err = kvStore.Get(bucket1, key(0))
+		require.NoError(err)
+		require.Equal(testV1[1], value)
+		clk.Add(24 * time.Hour)
+		require.NoError(testutil.WaitUntil(time.Millisecond, time.Second, purged))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testPurge(NewMemKVStore, t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-scheduled-purge.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testPurge(func(opts ...KVStoreOption) KVStore { return NewOnDiskDB(dbCfg, opts...) }, t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-scheduled-purge.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testPurge(func(opts ...KVStoreOption) KVStore { return NewOnDiskDB(dbCfg, opts...) }, t)
+	})
+}
@@ -0,0 +1,246 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var rateLimitedMtc = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "iotex_db_rate_limited_writes",
+		Help: "Number of writes rejected by the write rate limit of their namespace.",
+	},
+	[]string{"namespace"},
+)
+
+func init() {
+	prometheus.MustRegister(rateLimitedMtc)
+}
+
+// RateLimitedCommitter is the interface of KV store which is able to wait for the write rate limits of the namespaces
+// of a batch rather than reject it
+type RateLimitedCommitter interface {
+	// WaitCommit commits the batch once the rate limits of its namespaces allow its entries, or returns the error of
+	// ctx if it is done before then
+	WaitCommit(context.Context, KVStoreBatch) error
+}
+
+type (
+	// writeRateLimit is the rate limit of the writes to a namespace
+	writeRateLimit struct {
+		opsPerSec int
+		burst     int
+	}
+
+	// tokenBucket is a token bucket refilled at rate tokens per second up to burst tokens
+	tokenBucket struct {
+		rate  int64
+		burst int64
+		// tokens is the number of tokens in billionths, so that the tokens accrued over any nanoseconds are exact
+		tokens int64
+		last   time.Time
+	}
+
+	// rateLimitKVStore is a KV store limiting the rate of the writes to each of the limited namespaces
+	rateLimitKVStore struct {
+		kvStore KVStore
+		clk     clock.Clock
+		// mutex guards the buckets, so that the tokens of all namespaces of a batch are taken at once
+		mutex   sync.Mutex
+		buckets map[string]*tokenBucket
+	}
+)
+
+// newRateLimitKVStore wraps the KV store to limit the rate of the writes to the namespaces of the limits
+func newRateLimitKVStore(kvStore KVStore, limits map[string]writeRateLimit, clk clock.Clock) KVStore {
+	s := &rateLimitKVStore{
+		kvStore: kvStore,
+		clk:     clk,
+		buckets: make(map[string]*tokenBucket, len(limits)),
+	}
+	now := clk.Now()
+	for namespace, limit := range limits {
+		s.buckets[namespace] = &tokenBucket{
+			rate:   int64(limit.opsPerSec),
+			burst:  int64(limit.burst),
+			tokens: int64(limit.burst) * int64(time.Second),
+			last:   now,
+		}
+	}
+	return s
+}
+
+// Start starts the underlying KV store
+func (s *rateLimitKVStore) Start(ctx context.Context) error {
+	return s.kvStore.Start(ctx)
+}
+
+// Stop stops the underlying KV store
+func (s *rateLimitKVStore) Stop(ctx context.Context) error {
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record, or returns ErrRateLimited if the namespace is limited beyond its rate
+func (s *rateLimitKVStore) Put(namespace string, key, value []byte) error {
+	if _, err := s.take(map[string]int{namespace: 1}); err != nil {
+		return kvError("Put", namespace, key, err)
+	}
+	return s.kvStore.Put(namespace, key, value)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist, or
+// returns ErrRateLimited if the namespace is limited beyond its rate
+func (s *rateLimitKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	if _, err := s.take(map[string]int{namespace: 1}); err != nil {
+		return kvError("PutIfNotExists", namespace, key, err)
+	}
+	return s.kvStore.PutIfNotExists(namespace, key, value)
+}
+
+// Get retrieves a record, reads are never limited
+func (s *rateLimitKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	return s.kvStore.Get(namespace, key)
+}
+
+// Delete deletes a record, or returns ErrRateLimited if the namespace is limited beyond its rate
+func (s *rateLimitKVStore) Delete(namespace string, key []byte) error {
+	if _, err := s.take(map[string]int{namespace: 1}); err != nil {
+		return kvError("Delete", namespace, key, err)
+	}
+	return s.kvStore.Delete(namespace, key)
+}
+
+// Commit commits the batch, or returns ErrRateLimited without committing any entry if a namespace of the batch is
+// limited beyond its rate. A batch takes a token per entry of each limited namespace
+func (s *rateLimitKVStore) Commit(b KVStoreBatch) error {
+	counts, err := batchNamespaceCounts(b)
+	if err != nil {
+		return err
+	}
+	if _, err := s.take(counts); err != nil {
+		return err
+	}
+	return s.kvStore.Commit(b)
+}
+
+// WaitCommit commits the batch once the rate limits of its namespaces allow its entries
+func (s *rateLimitKVStore) WaitCommit(ctx context.Context, b KVStoreBatch) error {
+	counts, err := batchNamespaceCounts(b)
+	if err != nil {
+		return err
+	}
+	for {
+		wait, err := s.take(counts)
+		if err == nil {
+			return s.kvStore.Commit(b)
+		}
+		if wait == 0 {
+			// the batch never fits within the burst
+			return err
+		}
+		// the timer is stopped once ctx is done, rather than left firing with no one to receive it
+		timer := s.clk.Timer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Wrap(ctx.Err(), "rate limit not lifted before ctx is done")
+		}
+	}
+}
+
+//======================================
+// private functions
+//======================================
+
+// underlying returns the KV store wrapped
+func (s *rateLimitKVStore) underlying() KVStore { return s.kvStore }
+
+// take takes the tokens of the counts of entries of each namespace all at once if every limited namespace has enough
+// of them, otherwise it takes none and returns ErrRateLimited along with how long until they are refilled, which is 0
+// if the count of a namespace is beyond its burst
+func (s *rateLimitKVStore) take(counts map[string]int) (time.Duration, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.clk.Now()
+	var wait time.Duration
+	for namespace, count := range counts {
+		bucket, ok := s.buckets[namespace]
+		if !ok {
+			continue
+		}
+		if int64(count) > bucket.burst {
+			rateLimitedMtc.WithLabelValues(namespace).Add(float64(count))
+			return 0, errors.Wrapf(ErrRateLimited, "%d writes to namespace %s exceed its burst", count, namespace)
+		}
+		if w := bucket.refill(now, int64(count)); w > wait {
+			wait = w
+		}
+	}
+	if wait > 0 {
+		for namespace, count := range counts {
+			if _, ok := s.buckets[namespace]; ok {
+				rateLimitedMtc.WithLabelValues(namespace).Add(float64(count))
+			}
+		}
+		return wait, errors.Wrapf(ErrRateLimited, "retry in %v", wait)
+	}
+	for namespace, count := range counts {
+		if bucket, ok := s.buckets[namespace]; ok {
+			bucket.tokens -= int64(count) * int64(time.Second)
+		}
+	}
+	return 0, nil
+}
+
+// refill adds the tokens accrued since the last refill, and returns how long until there are n tokens
+func (t *tokenBucket) refill(now time.Time, n int64) time.Duration {
+	full := t.burst * int64(time.Second)
+	if elapsed := int64(now.Sub(t.last)); elapsed > 0 && t.rate > 0 {
+		// the bucket is full after the time to refill the missing tokens, which bounds the product below
+		if missing := full - t.tokens; elapsed >= (missing+t.rate-1)/t.rate {
+			t.tokens = full
+		} else {
+			t.tokens += elapsed * t.rate
+		}
+		t.last = now
+	}
+	missing := n*int64(time.Second) - t.tokens
+	if missing <= 0 {
+		return 0
+	}
+	if t.rate <= 0 {
+		// a bucket of no rate is never refilled
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration((missing + t.rate - 1) / t.rate)
+}
+
+// batchNamespaceCounts returns the number of entries of each namespace of the batch
+func batchNamespaceCounts(b KVStoreBatch) (map[string]int, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	counts := make(map[string]int)
+	for i := 0; i < b.Size(); i++ {
+		write, err := b.Entry(i)
+		if err != nil {
+			return nil, err
+		}
+		counts[write.namespace]++
+	}
+	return counts, nil
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestWriteRateLimit(t *testing.T) {
+	testRateLimit := func(newKVStore func(...KVStoreOption) KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		clk := clock.NewMock()
+		kvStore := newKVStore(WithWriteRateLimit(bucket1, 10, 5), WithClock(clk))
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		key := func(i int) []byte { return []byte(fmt.Sprintf("key-%d", i)) }
+
+		// the burst is written at once, and the writes beyond it are rejected
+		for i := 0; i < 5; i++ {
+			require.NoError(kvStore.Put(bucket1, key(i), testV1[0]))
+		}
+		require.Equal(ErrRateLimited, errors.Cause(kvStore.Put(bucket1, key(5), testV1[0])))
+		require.Equal(ErrRateLimited, errors.Cause(kvStore.Delete(bucket1, key(0))))
+		_, err := kvStore.Get(bucket1, key(5))
+		require.Error(err)
+		_, err = kvStore.Get(bucket1, key(0))
+		require.NoError(err)
+
+		// the other namespaces are not limited
+		for i := 0; i < 100; i++ {
+			require.NoError(kvStore.Put(bucket2, key(i), testV2[0]))
+		}
+
+		// sustained writes are throttled to the rate
+		written := 0
+		for i := 0; i < 100; i++ {
+			clk.Add(10 * time.Millisecond)
+			if err := kvStore.Put(bucket1, key(i), testV1[1]); err == nil {
+				written++
+			} else {
+				require.Equal(ErrRateLimited, errors.Cause(err))
+			}
+		}
+		require.Equal(10, written)
+
+		// a batch takes a token per entry of the limited namespace, and is committed all or nothing
+		clk.Add(200 * time.Millisecond)
+		batch := NewBatch()
+		for i := 0; i < 3; i++ {
+			require.NoError(batch.Put(bucket1, key(100+i), testV1[2], ""))
+		}
+		require.NoError(batch.Put(bucket2, key(100), testV2[2], ""))
+		require.Equal(ErrRateLimited, errors.Cause(kvStore.Commit(batch)))
+		_, err = kvStore.Get(bucket2, key(100))
+		require.Error(err)
+		clk.Add(100 * time.Millisecond)
+		require.NoError(kvStore.Commit(batch))
+		_, err = kvStore.Get(bucket2, key(100))
+		require.NoError(err)
+
+		// a batch beyond the burst is never committed
+		batch = NewBatch()
+		for i := 0; i < 6; i++ {
+			require.NoError(batch.Put(bucket1, key(200+i), testV1[2], ""))
+		}
+		clk.Add(time.Second)
+		require.Equal(ErrRateLimited, errors.Cause(kvStore.Commit(batch)))
+		require.Equal(ErrRateLimited, errors.Cause(kvStore.(RateLimitedCommitter).WaitCommit(ctx, batch)))
+
+		// WaitCommit waits for the tokens until its context is done
+		batch = NewBatch()
+		for i := 0; i < 5; i++ {
+			require.NoError(batch.Put(bucket1, key(300+i), testV1[2], ""))
+		}
+		require.NoError(kvStore.Commit(batch))
+		batch = NewBatch()
+		require.NoError(batch.Put(bucket1, key(400), testV1[2], ""))
+		timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		err = kvStore.(RateLimitedCommitter).WaitCommit(timeout, batch)
+		cancel()
+		require.Equal(context.DeadlineExceeded, errors.Cause(err))
+		done := make(chan error, 1)
+		go func() {
+			done <- kvStore.(RateLimitedCommitter).WaitCommit(ctx, batch)
+		}()
+		require.NoError(testutil.WaitUntil(time.Millisecond, time.Second, func() (bool, error) {
+			select {
+			case err := <-done:
+				return true, err
+			default:
+				clk.Add(10 * time.Millisecond)
+				return false, nil
+			}
+		}))
+		_, err = kvStore.Get(bucket1, key(400))
+		require.NoError(err)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testRateLimit(NewMemKVStore, t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-rate-limit.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testRateLimit(func(opts ...KVStoreOption) KVStore { return NewOnDiskDB(dbCfg, opts...) }, t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-rate-limit.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testRateLimit(func(opts ...KVStoreOption) KVStore { return NewOnDiskDB(dbCfg, opts...) }, t)
+	})
+}
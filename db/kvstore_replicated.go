@@ -0,0 +1,517 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/logger"
+)
+
+// replicationNamespace is the namespace keeping the state of the two-phase commit in each store
+const replicationNamespace = "replication"
+
+var (
+	// replicationPreparedKey is the key of the transaction prepared but not committed yet
+	replicationPreparedKey = []byte("prepared")
+	// replicationAppliedKey is the key of the sequence of the last transaction committed
+	replicationAppliedKey = []byte("applied")
+)
+
+type (
+	// ReplicatedOption sets an option of the replicated KV store
+	ReplicatedOption func(*replicatedKVStore)
+
+	// ReplicaValue is a record as read from a replica
+	ReplicaValue struct {
+		Value []byte
+		// Exists is false if the replica does not hold the record
+		Exists bool
+		// Timestamp is the time the replica wrote the record at, which is zero unless the replica is a
+		// TimestampGetter timestamping the namespace
+		Timestamp time.Time
+	}
+
+	// ConflictResolver decides the canonical record among the records the replicas disagree on, given in the order
+	// of the stores
+	ConflictResolver func(namespace string, key []byte, replicas []ReplicaValue) ReplicaValue
+
+	// replicatedKVStore is a KV store keeping the same records in multiple KV stores by two-phase commit
+	replicatedKVStore struct {
+		stores []KVStore
+		// mutex serializes the transactions and the recovery, and guards next and inDoubt
+		mutex sync.Mutex
+		next  uint64
+		// inDoubt is set once a transaction fails midway, so it is resolved before the next one
+		inDoubt bool
+		// resolver enables the read repair if not nil
+		resolver ConflictResolver
+		// repairs tracks the read repairs running in the background
+		repairs sync.WaitGroup
+	}
+
+	// replicaState is the state of the two-phase commit in a store
+	replicaState struct {
+		applied  uint64
+		prepared *preparedTx
+	}
+
+	// preparedTx is a transaction prepared in a store
+	preparedTx struct {
+		seq     uint64
+		entries []writeInfo
+	}
+)
+
+// PrimaryWins resolves a conflict in favor of the first store
+func PrimaryWins(_ string, _ []byte, replicas []ReplicaValue) ReplicaValue {
+	return replicas[0]
+}
+
+// LastWriterWins resolves a conflict in favor of the record written last, and of the earliest store among the
+// records written at the same time. A missing record is taken as never written, so it loses to any record
+func LastWriterWins(_ string, _ []byte, replicas []ReplicaValue) ReplicaValue {
+	winner := replicas[0]
+	for _, replica := range replicas[1:] {
+		if replica.Exists && (!winner.Exists || replica.Timestamp.After(winner.Timestamp)) {
+			winner = replica
+		}
+	}
+	return winner
+}
+
+// WithReadRepair makes Get read from all stores, and if they disagree, return the record decided by the resolver
+// and repair the other stores in the background. It keeps the stores converging when they diverge outside of the
+// replicated KV store, e.g. one of them is restored from a backup. LastWriterWins requires the stores to timestamp
+// the namespaces read, by WithTimestamps
+func WithReadRepair(resolver ConflictResolver) ReplicatedOption {
+	return func(s *replicatedKVStore) {
+		s.resolver = resolver
+	}
+}
+
+// NewReplicatedKVStore returns a KV store which keeps the same records in all the stores, and reads from the first
+// one. Each commit is a transaction of two phases: it first writes the entries as a prepared record to every store,
+// then commits them to every store along with the sequence of the transaction, each in a single commit of the store.
+// A transaction is decided to be committed once any store commits it. If it fails or crashes before that, it is
+// rolled back; otherwise the stores left behind commit it upon recovery, so the stores converge either way.
+// Recovery runs on Start, and before the next commit if a commit fails midway.
+//
+// It assumes each store is crash-recoverable on its own, i.e. a commit of the store is atomic and durable once it
+// returns, that the stores are only written through the replicated KV store, and that they hold the same records
+// when first used together. PutIfNotExists is checked against the first store and replicated as a Put. The namespace
+// "replication" is reserved in every store
+func NewReplicatedKVStore(stores []KVStore, opts ...ReplicatedOption) KVStore {
+	s := &replicatedKVStore{stores: append([]KVStore(nil), stores...), next: 1}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Start starts all stores, and completes or rolls back the transaction left in doubt by a crash
+func (s *replicatedKVStore) Start(ctx context.Context) error {
+	if len(s.stores) == 0 {
+		return errors.Wrap(ErrInvalidDB, "no store to replicate to")
+	}
+	for _, store := range s.stores {
+		if err := store.Start(ctx); err != nil {
+			return err
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.resolve()
+}
+
+// Stop waits for the read repairs in progress, stops all stores, and returns the first error
+func (s *replicatedKVStore) Stop(ctx context.Context) error {
+	s.repairs.Wait()
+	var err error
+	for _, store := range s.stores {
+		err = stopError(err, store.Stop(ctx))
+	}
+	return err
+}
+
+// Put inserts a <key, value> record into all stores
+func (s *replicatedKVStore) Put(namespace string, key, value []byte) error {
+	batch := NewBatch()
+	batch.Put(namespace, key, value, "failed to put key = %x", key)
+	return s.Commit(batch)
+}
+
+// PutIfNotExists inserts a <key, value> record into all stores only if it does not exist in the first store yet,
+// otherwise return ErrAlreadyExist
+func (s *replicatedKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	batch := NewBatch()
+	if err := batch.PutIfNotExists(namespace, key, value, "failed to put key = %x", key); err != nil {
+		return err
+	}
+	return s.Commit(batch)
+}
+
+// Get retrieves a record from the first store, or with read repair, the record decided by the resolver among the
+// records of all stores
+func (s *replicatedKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	if s.resolver == nil {
+		return s.stores[0].Get(namespace, key)
+	}
+	replicas, err := s.readReplicas(namespace, key)
+	if err != nil {
+		return nil, err
+	}
+	canonical := replicas[0]
+	if !agree(replicas) {
+		canonical = s.resolver(namespace, key, replicas)
+		s.repairs.Add(1)
+		go func() {
+			defer s.repairs.Done()
+			if err := s.repair(namespace, key, replicas, canonical); err != nil {
+				logger.Error().Err(err).Hex("key", key).Msg("Failed to repair the replicas.")
+			}
+		}()
+	}
+	if !canonical.Exists {
+		return nil, errors.Wrapf(ErrNotExist, "key = %x", key)
+	}
+	return canonical.Value, nil
+}
+
+// Delete deletes a record from all stores
+func (s *replicatedKVStore) Delete(namespace string, key []byte) error {
+	batch := NewBatch()
+	batch.Delete(namespace, key, "failed to delete key = %x", key)
+	return s.Commit(batch)
+}
+
+// Commit commits the batch to all stores by two-phase commit. If it returns an error after the first store commits
+// the batch, the other stores commit it upon recovery
+func (s *replicatedKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.inDoubt {
+		if err := s.resolve(); err != nil {
+			return errors.Wrap(err, "failed to recover the transaction in doubt")
+		}
+	}
+	entries, err := s.replicatedEntries(b)
+	if err != nil {
+		return err
+	}
+	tx := preparedTx{seq: s.next, entries: entries}
+	s.next++
+
+	prepare := []writeInfo{{
+		writeType: Put,
+		namespace: replicationNamespace,
+		key:       replicationPreparedKey,
+		value:     encodePreparedTx(tx),
+	}}
+	for i, store := range s.stores {
+		if err := store.Commit(newBatchOf(prepare)); err != nil {
+			s.inDoubt = true
+			return errors.Wrapf(err, "failed to prepare transaction %d in store %d", tx.seq, i)
+		}
+	}
+	for i, store := range s.stores {
+		if err := store.Commit(newBatchOf(commitEntries(tx))); err != nil {
+			s.inDoubt = true
+			return errors.Wrapf(err, "failed to commit transaction %d in store %d", tx.seq, i)
+		}
+	}
+	succeed = true
+	return nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// replicatedEntries returns a copy of the entries of the batch, with PutIfNotExists checked against the first store
+// and the entries before it, and turned into Put
+func (s *replicatedKVStore) replicatedEntries(b KVStoreBatch) ([]writeInfo, error) {
+	entries := make([]writeInfo, b.Size())
+	// staged is whether a record written by an earlier entry exists after it
+	staged := make(map[cacheKey]bool)
+	for i := range entries {
+		write, err := b.Entry(i)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = *write
+		record := cacheKey{namespace: write.namespace, key: string(write.key)}
+		if write.writeType == PutIfNotExists {
+			exists, ok := staged[record]
+			if !ok {
+				_, err := s.stores[0].Get(write.namespace, write.key)
+				if err != nil && !isNotExist(err) {
+					return nil, err
+				}
+				exists = err == nil
+			}
+			if exists {
+				return nil, errors.Wrapf(ErrAlreadyExist, "key = %x", write.key)
+			}
+			entries[i].writeType = Put
+		}
+		staged[record] = write.writeType != Delete
+	}
+	return entries, nil
+}
+
+// readReplicas reads the record from every store, along with its timestamp from the stores which are TimestampGetter
+func (s *replicatedKVStore) readReplicas(namespace string, key []byte) ([]ReplicaValue, error) {
+	replicas := make([]ReplicaValue, len(s.stores))
+	for i, store := range s.stores {
+		var (
+			value     []byte
+			timestamp time.Time
+			err       error
+		)
+		if getter, ok := store.(TimestampGetter); ok {
+			value, timestamp, err = getter.GetWithTimestamp(namespace, key)
+		} else {
+			value, err = store.Get(namespace, key)
+		}
+		switch {
+		case err == nil:
+			replicas[i] = ReplicaValue{Value: value, Exists: true, Timestamp: timestamp}
+		case !isNotExist(err):
+			return nil, errors.Wrapf(err, "failed to read key = %x from store %d", key, i)
+		}
+	}
+	return replicas, nil
+}
+
+// repair writes the canonical record to the stores holding another one. It gives up if any store no longer holds
+// the record read before, as a commit since then overrides the repair
+func (s *replicatedKVStore) repair(namespace string, key []byte, replicas []ReplicaValue,
+	canonical ReplicaValue) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	current, err := s.readReplicas(namespace, key)
+	if err != nil {
+		return err
+	}
+	for i := range current {
+		if !sameRecord(current[i], replicas[i]) {
+			return nil
+		}
+	}
+	for i, store := range s.stores {
+		if sameRecord(current[i], canonical) {
+			continue
+		}
+		if canonical.Exists {
+			err = store.Put(namespace, key, canonical.Value)
+		} else {
+			err = store.Delete(namespace, key)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to repair key = %x in store %d", key, i)
+		}
+	}
+	return nil
+}
+
+// resolve resolves the transaction prepared in any store: it is committed to the stores which have not committed it
+// if any store has, and rolled back otherwise. It then checks that all stores are at the same transaction
+func (s *replicatedKVStore) resolve() error {
+	states := make([]replicaState, len(s.stores))
+	var applied, last uint64
+	for i, store := range s.stores {
+		state, err := readReplicaState(store)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read the replication state of store %d", i)
+		}
+		states[i] = state
+		if state.applied > applied {
+			applied = state.applied
+		}
+		if state.prepared != nil && state.prepared.seq > last {
+			last = state.prepared.seq
+		}
+	}
+	for i, state := range states {
+		tx := state.prepared
+		if tx == nil {
+			continue
+		}
+		entries := []writeInfo{{writeType: Delete, namespace: replicationNamespace, key: replicationPreparedKey}}
+		if state.applied < tx.seq && applied >= tx.seq {
+			entries = commitEntries(*tx)
+			states[i].applied = tx.seq
+		}
+		if err := s.stores[i].Commit(newBatchOf(entries)); err != nil {
+			return errors.Wrapf(err, "failed to resolve transaction %d in store %d", tx.seq, i)
+		}
+	}
+	for i, state := range states {
+		if state.applied != applied {
+			return errors.Wrapf(
+				ErrInvalidDB,
+				"store %d is at transaction %d rather than %d",
+				i,
+				state.applied,
+				applied,
+			)
+		}
+	}
+	if applied > last {
+		last = applied
+	}
+	s.next = last + 1
+	s.inDoubt = false
+	return nil
+}
+
+// agree returns whether all replicas hold the same record
+func agree(replicas []ReplicaValue) bool {
+	for _, replica := range replicas[1:] {
+		if !sameRecord(replica, replicas[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameRecord returns whether both replicas hold the same record, regardless of when it is written
+func sameRecord(a, b ReplicaValue) bool {
+	return a.Exists == b.Exists && bytes.Equal(a.Value, b.Value)
+}
+
+// commitEntries returns the entries committing the transaction to a store, which apply its entries, advance the
+// sequence of the store and remove its prepared record at once
+func commitEntries(tx preparedTx) []writeInfo {
+	applied := make([]byte, 8)
+	binary.BigEndian.PutUint64(applied, tx.seq)
+	entries := make([]writeInfo, len(tx.entries), len(tx.entries)+2)
+	copy(entries, tx.entries)
+	return append(
+		entries,
+		writeInfo{writeType: Put, namespace: replicationNamespace, key: replicationAppliedKey, value: applied},
+		writeInfo{writeType: Delete, namespace: replicationNamespace, key: replicationPreparedKey},
+	)
+}
+
+// readReplicaState reads the sequence of the last transaction committed and the prepared transaction of the store
+func readReplicaState(store KVStore) (replicaState, error) {
+	var state replicaState
+	value, err := store.Get(replicationNamespace, replicationAppliedKey)
+	switch {
+	case err == nil:
+		if len(value) != 8 {
+			return state, errors.Wrap(ErrInvalidDB, "malformed sequence of the last transaction")
+		}
+		state.applied = binary.BigEndian.Uint64(value)
+	case !isNotExist(err):
+		return state, err
+	}
+	value, err = store.Get(replicationNamespace, replicationPreparedKey)
+	switch {
+	case err == nil:
+		tx, err := decodePreparedTx(value)
+		if err != nil {
+			return state, err
+		}
+		state.prepared = &tx
+	case !isNotExist(err):
+		return state, err
+	}
+	return state, nil
+}
+
+// encodePreparedTx encodes the transaction as its sequence, followed by the type, namespace, key and value of each
+// entry, the variable-length ones prefixed with their length. The length of a value is stored plus one, so that 0
+// stands for a nil value
+func encodePreparedTx(tx preparedTx) []byte {
+	var buf bytes.Buffer
+	n := make([]byte, binary.MaxVarintLen64)
+	binary.BigEndian.PutUint64(n, tx.seq)
+	buf.Write(n[:8])
+	for _, e := range tx.entries {
+		buf.Write(n[:binary.PutUvarint(n, uint64(e.writeType))])
+		buf.Write(n[:binary.PutUvarint(n, uint64(len(e.namespace)))])
+		buf.WriteString(e.namespace)
+		buf.Write(n[:binary.PutUvarint(n, uint64(len(e.key)))])
+		buf.Write(e.key)
+		if e.value == nil {
+			buf.Write(n[:binary.PutUvarint(n, 0)])
+			continue
+		}
+		buf.Write(n[:binary.PutUvarint(n, uint64(len(e.value))+1)])
+		buf.Write(e.value)
+	}
+	return buf.Bytes()
+}
+
+// decodePreparedTx decodes the prepared transaction
+func decodePreparedTx(value []byte) (preparedTx, error) {
+	malformed := errors.Wrap(ErrInvalidDB, "malformed prepared transaction")
+	if len(value) < 8 {
+		return preparedTx{}, malformed
+	}
+	tx := preparedTx{seq: binary.BigEndian.Uint64(value[:8])}
+	r := bytes.NewReader(value[8:])
+	readBytes := func() ([]byte, error) {
+		l, err := binary.ReadUvarint(r)
+		if err != nil || l > uint64(r.Len()) {
+			return nil, malformed
+		}
+		b := make([]byte, l)
+		r.Read(b)
+		return b, nil
+	}
+	for r.Len() > 0 {
+		writeType, err := binary.ReadUvarint(r)
+		if err != nil {
+			return preparedTx{}, malformed
+		}
+		namespace, err := readBytes()
+		if err != nil {
+			return preparedTx{}, err
+		}
+		key, err := readBytes()
+		if err != nil {
+			return preparedTx{}, err
+		}
+		e := writeInfo{writeType: int32(writeType), namespace: string(namespace), key: key}
+		l, err := binary.ReadUvarint(r)
+		if err != nil || l > uint64(r.Len())+1 {
+			return preparedTx{}, malformed
+		}
+		if l > 0 {
+			e.value = make([]byte, l-1)
+			r.Read(e.value)
+		}
+		tx.entries = append(tx.entries, e)
+	}
+	return tx, nil
+}
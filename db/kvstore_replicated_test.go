@@ -0,0 +1,268 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+// crashingKVStore fails the commit of the given number, counting from 1, as if the process crashed right before it
+type crashingKVStore struct {
+	KVStore
+	commits int
+	crashAt int
+}
+
+func (s *crashingKVStore) Commit(b KVStoreBatch) error {
+	s.commits++
+	if s.commits == s.crashAt {
+		return errWriteFailed
+	}
+	return s.KVStore.Commit(b)
+}
+
+func TestReplicatedKVStore(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	dbCfg := cfg
+	path := "test-replicated.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+
+	stores := []KVStore{NewMemKVStore(), NewOnDiskDB(dbCfg)}
+	kvStore := NewReplicatedKVStore(stores)
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+	require.NoError(kvStore.PutIfNotExists(bucket1, testK1[1], testV1[1]))
+	require.Equal(ErrAlreadyExist, errors.Cause(kvStore.PutIfNotExists(bucket1, testK1[0], testV1[1])))
+	batch := NewBatch()
+	batch.Put(bucket1, testK1[2], testV1[2], "")
+	batch.Delete(bucket1, testK1[1], "")
+	batch.Put(bucket2, testK2[0], []byte{}, "")
+	require.NoError(kvStore.Commit(batch))
+	require.Equal(0, batch.Size())
+	require.Equal(ErrBatchAlreadyCommitted, errors.Cause(kvStore.Commit(batch)))
+
+	// PutIfNotExists sees the entries staged before it in the batch
+	batch = NewBatch()
+	batch.Put(bucket2, testK2[1], testV2[1], "")
+	require.NoError(batch.PutIfNotExists(bucket2, testK2[1], testV2[2], ""))
+	require.Equal(ErrAlreadyExist, errors.Cause(kvStore.Commit(batch)))
+	require.Equal(2, batch.Size())
+	batch = NewBatch()
+	batch.Delete(bucket1, testK1[0], "")
+	require.NoError(batch.PutIfNotExists(bucket1, testK1[0], testV1[2], ""))
+	require.NoError(kvStore.Commit(batch))
+
+	for _, store := range stores {
+		value, err := store.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[2], value)
+		_, err = store.Get(bucket1, testK1[1])
+		require.True(isNotExist(err))
+		value, err = store.Get(bucket1, testK1[2])
+		require.NoError(err)
+		require.Equal(testV1[2], value)
+		value, err = store.Get(bucket2, testK2[0])
+		require.NoError(err)
+		require.Len(value, 0)
+		_, err = store.Get(bucket2, testK2[1])
+		require.True(isNotExist(err))
+		// no transaction is left prepared
+		_, err = store.Get(replicationNamespace, replicationPreparedKey)
+		require.True(isNotExist(err))
+	}
+	value, err := kvStore.Get(bucket1, testK1[2])
+	require.NoError(err)
+	require.Equal(testV1[2], value)
+}
+
+func TestReplicatedKVStoreRecovery(t *testing.T) {
+	ctx := context.Background()
+
+	for _, c := range []struct {
+		name string
+		// the commit of each store which crashes, the first commit of a store prepares and the second commits
+		crashAt [2]int
+		// whether the transaction is committed after recovery
+		committed bool
+	}{
+		{"crash while preparing", [2]int{0, 1}, false},
+		{"crash between prepare and commit", [2]int{2, 0}, false},
+		{"crash while committing", [2]int{0, 2}, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			require := require.New(t)
+
+			memStores := []KVStore{NewMemKVStore(), NewMemKVStore()}
+			seed := NewReplicatedKVStore(memStores)
+			require.NoError(seed.Start(ctx))
+			require.NoError(seed.Put(bucket1, testK1[0], testV1[0]))
+			crashing := make([]KVStore, len(memStores))
+			for i, store := range memStores {
+				crashing[i] = &crashingKVStore{KVStore: store, crashAt: c.crashAt[i]}
+			}
+			crashed := NewReplicatedKVStore(crashing)
+			require.NoError(crashed.Start(ctx))
+			batch := NewBatch()
+			batch.Put(bucket1, testK1[0], testV1[1], "")
+			batch.Put(bucket1, testK1[1], testV1[1], "")
+			require.Equal(errWriteFailed, errors.Cause(crashed.Commit(batch)))
+
+			// a new process recovers from the state the crashed one leaves behind
+			kvStore := NewReplicatedKVStore(memStores)
+			require.NoError(kvStore.Start(ctx))
+			expected := testV1[0]
+			if c.committed {
+				expected = testV1[1]
+			}
+			for _, store := range memStores {
+				value, err := store.Get(bucket1, testK1[0])
+				require.NoError(err)
+				require.Equal(expected, value)
+				_, err = store.Get(bucket1, testK1[1])
+				require.Equal(!c.committed, isNotExist(err))
+				_, err = store.Get(replicationNamespace, replicationPreparedKey)
+				require.True(isNotExist(err))
+			}
+
+			// the transactions afterwards commit to all stores
+			require.NoError(kvStore.Put(bucket1, testK1[2], testV1[2]))
+			for _, store := range memStores {
+				value, err := store.Get(bucket1, testK1[2])
+				require.NoError(err)
+				require.Equal(testV1[2], value)
+			}
+		})
+	}
+
+	t.Run("recover before next commit", func(t *testing.T) {
+		require := require.New(t)
+
+		memStores := []KVStore{NewMemKVStore(), NewMemKVStore()}
+		failing := &crashingKVStore{KVStore: memStores[1], crashAt: 2}
+		kvStore := NewReplicatedKVStore([]KVStore{memStores[0], failing})
+		require.NoError(kvStore.Start(ctx))
+		require.Equal(errWriteFailed, errors.Cause(kvStore.Put(bucket1, testK1[0], testV1[0])))
+		_, err := memStores[1].Get(bucket1, testK1[0])
+		require.True(isNotExist(err))
+
+		// the failed transaction is committed to the second store before the next one
+		require.NoError(kvStore.Put(bucket1, testK1[1], testV1[1]))
+		for _, store := range memStores {
+			for i := 0; i < 2; i++ {
+				value, err := store.Get(bucket1, testK1[i])
+				require.NoError(err)
+				require.Equal(testV1[i], value)
+			}
+		}
+	})
+
+	t.Run("diverged stores", func(t *testing.T) {
+		require := require.New(t)
+
+		memStores := []KVStore{NewMemKVStore(), NewMemKVStore()}
+		// only the first store commits the transaction
+		seed := NewReplicatedKVStore(memStores[:1])
+		require.NoError(seed.Start(ctx))
+		require.NoError(seed.Put(bucket1, testK1[0], testV1[0]))
+		err := NewReplicatedKVStore(memStores).Start(ctx)
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+		require.Equal(ErrInvalidDB, errors.Cause(NewReplicatedKVStore(nil).Start(ctx)))
+	})
+}
+
+func TestReplicatedKVStoreReadRepair(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	// converged waits until every store holds the value, or no record if it is nil
+	converged := func(stores []KVStore, key, expected []byte) {
+		require.NoError(testutil.WaitUntil(time.Millisecond, time.Second, func() (bool, error) {
+			for _, store := range stores {
+				value, err := store.Get(bucket1, key)
+				if err != nil && !isNotExist(err) {
+					return false, err
+				}
+				if !bytes.Equal(expected, value) || (expected == nil) != isNotExist(err) {
+					return false, nil
+				}
+			}
+			return true, nil
+		}))
+	}
+
+	for _, c := range []struct {
+		name     string
+		resolver ConflictResolver
+		// expected is the value of testK1[0] and testK1[1] resolved, nil for no record
+		expected [][]byte
+	}{
+		{"last writer wins", LastWriterWins, [][]byte{testV1[2], testV1[1]}},
+		{"primary wins", PrimaryWins, [][]byte{testV1[1], nil}},
+		{
+			"custom",
+			func(string, []byte, []ReplicaValue) ReplicaValue {
+				return ReplicaValue{Value: testV1[0], Exists: true}
+			},
+			[][]byte{testV1[0], testV1[0]},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			clk := clock.NewMock()
+			stores := []KVStore{
+				NewMemKVStore(WithTimestamps(bucket1), WithClock(clk)),
+				NewMemKVStore(WithTimestamps(bucket1), WithClock(clk)),
+			}
+			kvStore := NewReplicatedKVStore(stores, WithReadRepair(c.resolver))
+			require.NoError(kvStore.Start(ctx))
+			defer func() {
+				require.NoError(kvStore.Stop(ctx))
+			}()
+
+			// the records agreed on are read as they are
+			require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+			value, err := kvStore.Get(bucket1, testK1[0])
+			require.NoError(err)
+			require.Equal(testV1[0], value)
+
+			// the stores diverge, with the second one written last
+			clk.Add(time.Second)
+			require.NoError(stores[0].Put(bucket1, testK1[0], testV1[1]))
+			clk.Add(time.Second)
+			require.NoError(stores[1].Put(bucket1, testK1[0], testV1[2]))
+			require.NoError(stores[1].Put(bucket1, testK1[1], testV1[1]))
+
+			for i, key := range [][]byte{testK1[0], testK1[1]} {
+				value, err := kvStore.Get(bucket1, key)
+				if c.expected[i] == nil {
+					require.True(isNotExist(err))
+				} else {
+					require.NoError(err)
+					require.Equal(c.expected[i], value)
+				}
+				converged(stores, key, c.expected[i])
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// routedKVStore is a KV store routing each namespace to one of multiple underlying KV stores
+type routedKVStore struct {
+	defaultStore KVStore
+	routes       map[string]KVStore
+	// stores is the distinct underlying KV stores, in the order they are started
+	stores []KVStore
+}
+
+// NewRoutedKVStore returns a KV store which keeps the namespaces in routes in their own KV store, and all other
+// namespaces in defaultStore. This isolates namespaces of different workloads into separate physical DBs, e.g. a
+// churny cache from append-mostly blocks, so that each BadgerDB compacts a homogeneous workload.
+//
+// Commit is atomic only if all entries of the batch belong to the same underlying KV store. Otherwise the batch is
+// split and committed to each underlying KV store in turn, and if one of them fails, the parts committed before stay
+// committed. The batch is kept intact in that case, so committing it again re-applies the committed parts, which
+// fails on their PutIfNotExists entries
+func NewRoutedKVStore(defaultStore KVStore, routes map[string]KVStore) KVStore {
+	r := &routedKVStore{
+		defaultStore: defaultStore,
+		routes:       make(map[string]KVStore, len(routes)),
+		stores:       []KVStore{defaultStore},
+	}
+	seen := map[KVStore]struct{}{defaultStore: {}}
+	for namespace, kvStore := range routes {
+		r.routes[namespace] = kvStore
+		if _, ok := seen[kvStore]; !ok {
+			seen[kvStore] = struct{}{}
+			r.stores = append(r.stores, kvStore)
+		}
+	}
+	return r
+}
+
+// Start starts all underlying KV stores
+func (r *routedKVStore) Start(ctx context.Context) error {
+	for _, kvStore := range r.stores {
+		if err := kvStore.Start(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop stops all underlying KV stores, and returns the first error
+func (r *routedKVStore) Stop(ctx context.Context) error {
+	var err error
+	for _, kvStore := range r.stores {
+		if stopErr := kvStore.Stop(ctx); err == nil {
+			err = stopErr
+		}
+	}
+	return err
+}
+
+// Put inserts a <key, value> record
+func (r *routedKVStore) Put(namespace string, key, value []byte) error {
+	return r.route(namespace).Put(namespace, key, value)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (r *routedKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	return r.route(namespace).PutIfNotExists(namespace, key, value)
+}
+
+// Get retrieves a record
+func (r *routedKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	return r.route(namespace).Get(namespace, key)
+}
+
+// Delete deletes a record
+func (r *routedKVStore) Delete(namespace string, key []byte) error {
+	return r.route(namespace).Delete(namespace, key)
+}
+
+// Commit commits the entries of the batch to the underlying KV stores they belong to
+func (r *routedKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+
+	var order []KVStore
+	entries := make(map[KVStore][]writeInfo)
+	for i := 0; i < b.Size(); i++ {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		kvStore := r.route(write.namespace)
+		if _, ok := entries[kvStore]; !ok {
+			order = append(order, kvStore)
+		}
+		entries[kvStore] = append(entries[kvStore], *write)
+	}
+	for _, kvStore := range order {
+		if err := kvStore.Commit(newBatchOf(entries[kvStore])); err != nil {
+			return errors.Wrap(err, "failed to commit to underlying KV store")
+		}
+	}
+	succeed = true
+	return nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// route returns the underlying KV store of the namespace
+func (r *routedKVStore) route(namespace string) KVStore {
+	if kvStore, ok := r.routes[namespace]; ok {
+		return kvStore
+	}
+	return r.defaultStore
+}
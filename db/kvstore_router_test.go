@@ -0,0 +1,135 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutedKVStore(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	defaultStore := NewMemKVStore()
+	hotStore := NewMemKVStore()
+	kvStore := NewRoutedKVStore(defaultStore, map[string]KVStore{bucket2: hotStore, bucket3: hotStore})
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+
+	// writes go to the KV store of the namespace
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+	require.NoError(kvStore.Put(bucket2, testK1[0], testV1[1]))
+	require.Equal(ErrAlreadyExist, errors.Cause(kvStore.PutIfNotExists(bucket2, testK1[0], testV1[2])))
+	value, err := defaultStore.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], value)
+	value, err = kvStore.Get(bucket2, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[1], value)
+	_, err = defaultStore.Get(bucket2, testK1[0])
+	require.Error(err)
+	require.NoError(kvStore.Delete(bucket2, testK1[0]))
+	_, err = hotStore.Get(bucket2, testK1[0])
+	require.Error(err)
+
+	// a batch within one KV store is atomic
+	batch := NewBatch()
+	batch.Put(bucket2, testK1[1], testV1[1], "")
+	batch.Put(bucket3, testK1[1], testV1[1], "")
+	require.NoError(batch.PutIfNotExists(bucket3, testK1[1], testV1[2], ""))
+	require.Equal(ErrAlreadyExist, errors.Cause(kvStore.Commit(batch)))
+	require.Equal(3, batch.Size())
+	_, err = hotStore.Get(bucket2, testK1[1])
+	require.Error(err)
+
+	// a batch spanning KV stores is split
+	batch = NewBatch()
+	batch.Put(bucket1, testK1[2], testV1[2], "")
+	batch.Put(bucket2, testK1[2], testV1[2], "")
+	batch.Delete(bucket1, testK1[0], "")
+	require.NoError(kvStore.Commit(batch))
+	require.Equal(0, batch.Size())
+	value, err = defaultStore.Get(bucket1, testK1[2])
+	require.NoError(err)
+	require.Equal(testV1[2], value)
+	value, err = hotStore.Get(bucket2, testK1[2])
+	require.NoError(err)
+	require.Equal(testV1[2], value)
+	_, err = defaultStore.Get(bucket1, testK1[0])
+	require.Error(err)
+
+	// the parts committed before a failing one stay committed
+	batch = NewBatch()
+	batch.Put(bucket1, testK2[0], testV2[0], "")
+	require.NoError(batch.PutIfNotExists(bucket2, testK1[2], testV2[0], ""))
+	require.Error(kvStore.Commit(batch))
+	require.Equal(2, batch.Size())
+	value, err = kvStore.Get(bucket1, testK2[0])
+	require.NoError(err)
+	require.Equal(testV2[0], value)
+}
+
+func BenchmarkRoutedKVStore(b *testing.B) {
+	const (
+		hotNamespace    = "cache"
+		appendNamespace = "block"
+	)
+	newBadger := func(dir, name string) KVStore {
+		dbCfg := cfg
+		dbCfg.DbPath = filepath.Join(dir, name)
+		dbCfg.UseBadgerDB = true
+		return NewOnDiskDB(dbCfg)
+	}
+	benchmark := func(b *testing.B, split bool) {
+		require := require.New(b)
+		ctx := context.Background()
+		dir, err := ioutil.TempDir("", "bench-routed")
+		require.NoError(err)
+		defer func() {
+			require.NoError(os.RemoveAll(dir))
+		}()
+
+		kvStore := newBadger(dir, "combined")
+		if split {
+			kvStore = NewRoutedKVStore(
+				newBadger(dir, "append"),
+				map[string]KVStore{hotNamespace: newBadger(dir, "hot")},
+			)
+		}
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		value := make([]byte, 1024)
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			// the cache churns over a few keys, while blocks are only appended
+			require.NoError(kvStore.Put(hotNamespace, []byte(fmt.Sprintf("key_%d", n%64)), value))
+			require.NoError(kvStore.Put(appendNamespace, []byte(fmt.Sprintf("key_%d", n)), value))
+			if _, err := kvStore.Get(hotNamespace, []byte(fmt.Sprintf("key_%d", n%64))); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.Run("Combined", func(b *testing.B) {
+		benchmark(b, false)
+	})
+	b.Run("Split", func(b *testing.B) {
+		benchmark(b, true)
+	})
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// Perm is the access permitted to a namespace
+type Perm int
+
+const (
+	// PermNone permits no access
+	PermNone Perm = iota
+	// PermRead permits reads only
+	PermRead
+	// PermReadWrite permits reads and writes
+	PermReadWrite
+)
+
+// scopedPermissionKVStore is a KV store enforcing the access permitted to each namespace
+type scopedPermissionKVStore struct {
+	kvStore KVStore
+	perms   map[string]Perm
+}
+
+// NewScopedPermissionKVStore wraps the KV store to only permit the access given by perms to each namespace, and none
+// to the namespaces not in perms. An operation not permitted returns ErrPermissionDenied. This lets a component be
+// handed a KV store which enforces the namespaces it may read or write, rather than relying on convention
+func NewScopedPermissionKVStore(kvStore KVStore, perms map[string]Perm) KVStore {
+	s := &scopedPermissionKVStore{
+		kvStore: kvStore,
+		perms:   make(map[string]Perm, len(perms)),
+	}
+	for namespace, perm := range perms {
+		s.perms[namespace] = perm
+	}
+	return s
+}
+
+// Start starts the underlying KV store
+func (s *scopedPermissionKVStore) Start(ctx context.Context) error {
+	return s.kvStore.Start(ctx)
+}
+
+// Stop stops the underlying KV store
+func (s *scopedPermissionKVStore) Stop(ctx context.Context) error {
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record if the namespace is writable
+func (s *scopedPermissionKVStore) Put(namespace string, key, value []byte) error {
+	if err := s.check(namespace, PermReadWrite); err != nil {
+		return err
+	}
+	return s.kvStore.Put(namespace, key, value)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist, if
+// the namespace is writable
+func (s *scopedPermissionKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	if err := s.check(namespace, PermReadWrite); err != nil {
+		return err
+	}
+	return s.kvStore.PutIfNotExists(namespace, key, value)
+}
+
+// Get retrieves a record if the namespace is readable
+func (s *scopedPermissionKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	if err := s.check(namespace, PermRead); err != nil {
+		return nil, err
+	}
+	return s.kvStore.Get(namespace, key)
+}
+
+// Delete deletes a record if the namespace is writable
+func (s *scopedPermissionKVStore) Delete(namespace string, key []byte) error {
+	if err := s.check(namespace, PermReadWrite); err != nil {
+		return err
+	}
+	return s.kvStore.Delete(namespace, key)
+}
+
+// Commit commits the batch if the namespaces of all its entries are writable, otherwise nothing is committed. The
+// batch must not be modified while being committed
+func (s *scopedPermissionKVStore) Commit(b KVStoreBatch) error {
+	b.Lock()
+	for i := 0; i < b.Size(); i++ {
+		write, err := b.Entry(i)
+		if err == nil {
+			err = s.check(write.namespace, PermReadWrite)
+		}
+		if err != nil {
+			b.Unlock()
+			return err
+		}
+	}
+	b.Unlock()
+	return s.kvStore.Commit(b)
+}
+
+//======================================
+// private functions
+//======================================
+
+// check returns ErrPermissionDenied if the namespace is not permitted the access
+func (s *scopedPermissionKVStore) check(namespace string, perm Perm) error {
+	if s.perms[namespace] < perm {
+		return errors.Wrapf(ErrPermissionDenied, "namespace = %s", namespace)
+	}
+	return nil
+}
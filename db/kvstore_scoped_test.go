@@ -0,0 +1,77 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopedPermissionKVStore(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	const bucket3 = "test_ns3"
+	inner := NewMemKVStore()
+	require.NoError(inner.Put(bucket1, testK1[0], testV1[0]))
+	require.NoError(inner.Put(bucket3, testK1[0], testV1[0]))
+	kvStore := NewScopedPermissionKVStore(inner, map[string]Perm{
+		bucket1: PermRead,
+		bucket2: PermReadWrite,
+		bucket3: PermNone,
+	})
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+
+	// a read-only namespace can be read but not written
+	value, err := kvStore.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], value)
+	require.Equal(ErrPermissionDenied, errors.Cause(kvStore.Put(bucket1, testK1[1], testV1[1])))
+	require.Equal(ErrPermissionDenied, errors.Cause(kvStore.PutIfNotExists(bucket1, testK1[1], testV1[1])))
+	require.Equal(ErrPermissionDenied, errors.Cause(kvStore.Delete(bucket1, testK1[0])))
+	_, err = inner.Get(bucket1, testK1[1])
+	require.Equal(ErrNotExist, errors.Cause(err))
+
+	// a namespace of no access, or not in the permissions, can be neither read nor written
+	for _, namespace := range []string{bucket3, "test_ns4"} {
+		_, err = kvStore.Get(namespace, testK1[0])
+		require.Equal(ErrPermissionDenied, errors.Cause(err))
+		require.Equal(ErrPermissionDenied, errors.Cause(kvStore.Put(namespace, testK1[0], testV1[1])))
+	}
+
+	// a read-write namespace can be read and written
+	require.NoError(kvStore.Put(bucket2, testK2[0], testV2[0]))
+	require.NoError(kvStore.PutIfNotExists(bucket2, testK2[1], testV2[1]))
+	value, err = kvStore.Get(bucket2, testK2[0])
+	require.NoError(err)
+	require.Equal(testV2[0], value)
+	require.NoError(kvStore.Delete(bucket2, testK2[1]))
+
+	// a single entry of a namespace not writable rejects the whole batch
+	batch := NewBatch()
+	batch.Put(bucket2, testK2[2], testV2[2], "")
+	batch.Put(bucket1, testK1[2], testV1[2], "")
+	require.Equal(ErrPermissionDenied, errors.Cause(kvStore.Commit(batch)))
+	require.Equal(2, batch.Size())
+	_, err = inner.Get(bucket2, testK2[2])
+	require.Equal(ErrNotExist, errors.Cause(err))
+	_, err = inner.Get(bucket1, testK1[2])
+	require.Equal(ErrNotExist, errors.Cause(err))
+
+	batch.Clear()
+	batch.Put(bucket2, testK2[2], testV2[2], "")
+	require.NoError(kvStore.Commit(batch))
+	value, err = inner.Get(bucket2, testK2[2])
+	require.NoError(err)
+	require.Equal(testV2[2], value)
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/pkg/hash"
+)
+
+type (
+	// ringPoint is a point of a shard on the hash ring
+	ringPoint struct {
+		hash  uint64
+		shard int
+	}
+
+	// shardedKVStore is a KV store spreading the records over multiple underlying KV stores by consistent hashing
+	shardedKVStore struct {
+		shards []KVStore
+		// ring is the points of all shards sorted by hash
+		ring []ringPoint
+	}
+)
+
+// NewShardedKVStore returns a KV store which keeps each record in one of the shards, chosen by consistent hashing of
+// its namespace and key, with replicas points of each shard on the hash ring. A record stays on the same shard as
+// long as the shards are given in the same order, and adding a shard only moves the records it takes over.
+//
+// Commit is atomic only if all entries of the batch belong to the same shard. Otherwise the batch is split and
+// committed to each shard in turn, and if one of them fails, the parts committed before stay committed. The batch is
+// kept intact in that case, so committing it again re-applies the committed parts, which fails on their
+// PutIfNotExists entries. StreamAll and KeysPaged visit all shards, and require them to be a Streamer and a KeyPager
+func NewShardedKVStore(shards []KVStore, replicas int) KVStore {
+	if replicas < 1 {
+		replicas = 1
+	}
+	s := &shardedKVStore{
+		shards: append([]KVStore(nil), shards...),
+		ring:   make([]ringPoint, 0, len(shards)*replicas),
+	}
+	for i := range shards {
+		for r := 0; r < replicas; r++ {
+			s.ring = append(s.ring, ringPoint{hash: ringHash([]byte(fmt.Sprintf("shard-%d-%d", i, r))), shard: i})
+		}
+	}
+	sort.Slice(s.ring, func(i, j int) bool { return s.ring[i].hash < s.ring[j].hash })
+	return s
+}
+
+// Start starts all shards
+func (s *shardedKVStore) Start(ctx context.Context) error {
+	for _, shard := range s.shards {
+		if err := shard.Start(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop stops all shards, and returns the first error
+func (s *shardedKVStore) Stop(ctx context.Context) error {
+	var err error
+	for _, shard := range s.shards {
+		err = stopError(err, shard.Stop(ctx))
+	}
+	return err
+}
+
+// Put inserts a <key, value> record
+func (s *shardedKVStore) Put(namespace string, key, value []byte) error {
+	return s.shards[s.shardIndex(namespace, key)].Put(namespace, key, value)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (s *shardedKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	return s.shards[s.shardIndex(namespace, key)].PutIfNotExists(namespace, key, value)
+}
+
+// Get retrieves a record
+func (s *shardedKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	return s.shards[s.shardIndex(namespace, key)].Get(namespace, key)
+}
+
+// Delete deletes a record
+func (s *shardedKVStore) Delete(namespace string, key []byte) error {
+	return s.shards[s.shardIndex(namespace, key)].Delete(namespace, key)
+}
+
+// Commit commits the entries of the batch to the shards they belong to
+func (s *shardedKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+
+	var order []int
+	entries := make(map[int][]writeInfo)
+	for i := 0; i < b.Size(); i++ {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		shard := s.shardIndex(write.namespace, write.key)
+		if _, ok := entries[shard]; !ok {
+			order = append(order, shard)
+		}
+		entries[shard] = append(entries[shard], *write)
+	}
+	for _, shard := range order {
+		if err := s.shards[shard].Commit(newBatchOf(entries[shard])); err != nil {
+			return errors.Wrapf(err, "failed to commit to shard %d", shard)
+		}
+	}
+	succeed = true
+	return nil
+}
+
+// StreamAll calls fn on each record of the namespace of every shard, one shard after another
+func (s *shardedKVStore) StreamAll(namespace string, fn func([]byte, []byte) error) error {
+	for i, shard := range s.shards {
+		streamer, ok := shard.(Streamer)
+		if !ok {
+			return errors.Wrapf(ErrInvalidDB, "shard %d is not a Streamer", i)
+		}
+		if err := streamer.StreamAll(namespace, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// KeysPaged merges the pages of keys of every shard into a page of the keys in sorted order
+func (s *shardedKVStore) KeysPaged(namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	if limit <= 0 {
+		return nil, nil, errors.Wrapf(ErrInvalidDB, "invalid limit %d", limit)
+	}
+	var keys [][]byte
+	more := false
+	for i, shard := range s.shards {
+		pager, ok := shard.(KeyPager)
+		if !ok {
+			return nil, nil, errors.Wrapf(ErrInvalidDB, "shard %d is not a KeyPager", i)
+		}
+		page, cursor, err := pager.KeysPaged(namespace, after, limit)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, page...)
+		more = more || cursor != nil
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	// the keys of a shard beyond its page all sort after its page of limit keys, so the first limit keys are complete
+	if len(keys) > limit || more {
+		return keys[:limit], keys[limit-1], nil
+	}
+	return keys, nil, nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// shardIndex returns the index of the shard of the first point on the hash ring at or after the hash of the record
+func (s *shardedKVStore) shardIndex(namespace string, key []byte) int {
+	// separate namespace and key, so that ("a", "bc") and ("ab", "c") hash differently
+	record := make([]byte, 0, len(namespace)+1+len(key))
+	record = append(append(append(record, namespace...), 0), key...)
+	sum := ringHash(record)
+	i := sort.Search(len(s.ring), func(i int) bool { return s.ring[i].hash >= sum })
+	if i == len(s.ring) {
+		i = 0
+	}
+	return s.ring[i].shard
+}
+
+// ringHash returns the position of the data on the hash ring. A cryptographic hash is used since FNV spreads similar
+// keys, e.g. of a common prefix and a counter, unevenly over the ring
+func ringHash(data []byte) uint64 {
+	return binary.BigEndian.Uint64(hash.Hash256b(data)[:8])
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedKVStore(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	newShards := func(n int) []KVStore {
+		shards := make([]KVStore, n)
+		for i := range shards {
+			shards[i] = NewMemKVStore()
+		}
+		return shards
+	}
+	shards := newShards(4)
+	kvStore := NewShardedKVStore(shards, 64)
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+
+	// each record is kept in exactly one shard, and all shards get records
+	var keys [][]byte
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key_%04d", i)))
+		require.NoError(kvStore.Put(bucket1, keys[i], testV1[0]))
+	}
+	counts := make([]int, len(shards))
+	for _, key := range keys {
+		value, err := kvStore.Get(bucket1, key)
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+		found := 0
+		for i, shard := range shards {
+			if _, err := shard.Get(bucket1, key); err == nil {
+				found++
+				counts[i]++
+			}
+		}
+		require.Equal(1, found)
+	}
+	for _, count := range counts {
+		require.True(count > 100, "unbalanced shards %v", counts)
+	}
+
+	// the routing is stable, and adding a shard only moves the records it takes over
+	same := NewShardedKVStore(newShards(4), 64).(*shardedKVStore)
+	grown := NewShardedKVStore(newShards(5), 64).(*shardedKVStore)
+	moved := 0
+	for _, key := range keys {
+		shard := kvStore.(*shardedKVStore).shardIndex(bucket1, key)
+		require.Equal(shard, same.shardIndex(bucket1, key))
+		if newShard := grown.shardIndex(bucket1, key); newShard != shard {
+			require.Equal(4, newShard)
+			moved++
+		}
+	}
+	require.True(moved > 100 && moved < 350, "%d records moved", moved)
+
+	// the pages of keys are merged across shards in sorted order
+	pager := kvStore.(KeyPager)
+	var paged [][]byte
+	var after []byte
+	for {
+		page, cursor, err := pager.KeysPaged(bucket1, after, 64)
+		require.NoError(err)
+		require.True(len(page) <= 64)
+		paged = append(paged, page...)
+		if cursor == nil {
+			break
+		}
+		after = cursor
+	}
+	require.Equal(keys, paged)
+	var mutex sync.Mutex
+	streamed := 0
+	require.NoError(kvStore.(Streamer).StreamAll(bucket1, func(_, _ []byte) error {
+		mutex.Lock()
+		streamed++
+		mutex.Unlock()
+		return nil
+	}))
+	require.Equal(len(keys), streamed)
+
+	// a batch spanning shards is split, and the parts committed before a failing one stay committed
+	batch := NewBatch()
+	for _, key := range keys[:100] {
+		batch.Delete(bucket1, key, "")
+	}
+	require.NoError(kvStore.Commit(batch))
+	require.Equal(0, batch.Size())
+	for _, key := range keys[:100] {
+		_, err := kvStore.Get(bucket1, key)
+		require.Equal(ErrNotExist, errors.Cause(err))
+	}
+	first := kvStore.(*shardedKVStore).shardIndex(bucket2, testK2[0])
+	var other []byte
+	for _, key := range keys[100:] {
+		if kvStore.(*shardedKVStore).shardIndex(bucket1, key) != first {
+			other = key
+			break
+		}
+	}
+	batch.Put(bucket2, testK2[0], testV2[0], "")
+	require.NoError(batch.PutIfNotExists(bucket1, other, testV1[1], ""))
+	require.Equal(ErrAlreadyExist, errors.Cause(kvStore.Commit(batch)))
+	require.Equal(2, batch.Size())
+	value, err := kvStore.Get(bucket2, testK2[0])
+	require.NoError(err)
+	require.Equal(testV2[0], value)
+	value, err = kvStore.Get(bucket1, other)
+	require.NoError(err)
+	require.Equal(testV1[0], value)
+}
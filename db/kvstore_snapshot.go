@@ -0,0 +1,184 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+)
+
+type (
+	// recordGetter is what the snapshots of the backends have in common
+	recordGetter interface {
+		Get(string, []byte) ([]byte, error)
+	}
+
+	// snapshotKVStore is a read-only KV store serving the reads of a snapshot
+	snapshotKVStore struct {
+		// mutex guards getter against being released while read
+		mutex   sync.RWMutex
+		getter  recordGetter
+		release func(context.Context) error
+	}
+)
+
+// OpenSnapshot copies the records into memory, as Snapshot does
+func (m *memKVStore) OpenSnapshot() (KVStore, error) {
+	snapshot, err := m.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return newSnapshotKVStore(snapshot, func(context.Context) error {
+		snapshot.Release()
+		return nil
+	}), nil
+}
+
+// OpenSnapshot writes a copy of the BoltDB file within one read transaction, next to the file, and opens the copy
+// read-only. Stop closes and removes the copy. A copy left behind by a crash is not removed, and costs as much disk
+// space as the BoltDB file
+func (b *boltDB) OpenSnapshot() (KVStore, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(b.path), filepath.Base(b.path)+".snapshot")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create snapshot file")
+	}
+	path := f.Name()
+	err = b.db.View(func(tx *bolt.Tx) error {
+		defer b.readTxns.hold("OpenSnapshot")()
+		_, err := tx.WriteTo(f)
+		return err
+	})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, errors.Wrap(err, "failed to write snapshot file")
+	}
+	db, err := bolt.Open(path, fileMode, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		os.Remove(path)
+		return nil, errors.Wrap(err, "failed to open snapshot file")
+	}
+	// the copy is read with the same options, so that front-coded namespaces are decoded alike
+	copied := &boltDB{
+		db:       db,
+		path:     path,
+		config:   b.config,
+		options:  b.options,
+		readTxns: newReadTxnTracker(b.options.clk),
+	}
+	return newSnapshotKVStore(copied, func(ctx context.Context) error {
+		err := copied.Stop(ctx)
+		if removeErr := os.Remove(path); err == nil {
+			err = removeErr
+		}
+		return err
+	}), nil
+}
+
+// OpenSnapshot opens a read-only transaction, as Snapshot does, which reads at the version of its read timestamp.
+// Reads are serialized, since a transaction of BadgerDB must not be used concurrently
+func (b *badgerDB) OpenSnapshot() (KVStore, error) {
+	snapshot, err := b.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return newSnapshotKVStore(snapshot, func(context.Context) error {
+		snapshot.Release()
+		return nil
+	}), nil
+}
+
+// OpenAtVersion opens the BadgerDB directory at the path read-only in managed mode, and returns a read-only KV store
+// of its records as of the version, e.g. to inspect the state a bug left behind without restoring a backup. The
+// version is the commit timestamp BadgerDB stamps each transaction with, as reported by Item.Version of the native
+// handle, and a key reads as of the latest commit at or before it. The versions older than the latest are kept
+// through compactions only if the DB is written with WithRetainedVersions, so a key whose version is compacted away
+// reads as missing. A deleted key is not recoverable even so: BadgerDB v1.5 drops all versions below a delete marker
+// once they are compacted, which the DB always does on close, so such a key reads as missing at any version before
+// its delete as well. The KV store is open already, its writes return ErrReadOnlyTxn, and its Stop closes the DB. The DB
+// must not be open by another process for writing
+func OpenAtVersion(path string, version uint64) (KVStore, error) {
+	if version == 0 {
+		return nil, errors.Wrap(ErrInvalidDB, "version must be positive")
+	}
+	opts := badger.DefaultOptions
+	opts.Dir = path
+	opts.ValueDir = path
+	opts.ReadOnly = true
+	db, err := badger.OpenManaged(opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open BadgerDB %s", path)
+	}
+	snapshot := &badgerSnapshot{txn: db.NewTransactionAt(version, false)}
+	return newSnapshotKVStore(snapshot, func(context.Context) error {
+		snapshot.Release()
+		return db.Close()
+	}), nil
+}
+
+// Start does nothing, since the snapshot is open already
+func (s *snapshotKVStore) Start(context.Context) error { return nil }
+
+// Stop releases the snapshot
+func (s *snapshotKVStore) Stop(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.getter == nil {
+		return nil
+	}
+	s.getter = nil
+	return s.release(ctx)
+}
+
+// Put returns ErrReadOnlyTxn
+func (s *snapshotKVStore) Put(string, []byte, []byte) error { return ErrReadOnlyTxn }
+
+// PutIfNotExists returns ErrReadOnlyTxn
+func (s *snapshotKVStore) PutIfNotExists(string, []byte, []byte) error { return ErrReadOnlyTxn }
+
+// Get retrieves a record as of the time the snapshot is taken
+func (s *snapshotKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.getter == nil {
+		return nil, ErrDBClosed
+	}
+	return s.getter.Get(namespace, key)
+}
+
+// Delete returns ErrReadOnlyTxn
+func (s *snapshotKVStore) Delete(string, []byte) error { return ErrReadOnlyTxn }
+
+// Commit returns ErrReadOnlyTxn
+func (s *snapshotKVStore) Commit(KVStoreBatch) error { return ErrReadOnlyTxn }
+
+//======================================
+// private functions
+//======================================
+
+// newSnapshotKVStore returns the KV store serving the reads of getter, and calling release on Stop
+func newSnapshotKVStore(getter recordGetter, release func(context.Context) error) KVStore {
+	return &snapshotKVStore{getter: getter, release: release}
+}
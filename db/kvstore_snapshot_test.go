@@ -0,0 +1,194 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestOpenSnapshot(t *testing.T) {
+	testOpenSnapshot := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		opener, ok := kvStore.(SnapshotOpener)
+		require.True(ok)
+
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		require.NoError(kvStore.Put(bucket1, testK1[1], testV1[1]))
+		require.NoError(kvStore.Put(bucket2, testK2[0], []byte{}))
+		snapshot, err := opener.OpenSnapshot()
+		require.NoError(err)
+		require.NoError(snapshot.Start(ctx))
+
+		// the writes to the live KV store afterwards are not visible through the snapshot
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV2[0]))
+		require.NoError(kvStore.Delete(bucket1, testK1[1]))
+		require.NoError(kvStore.Put(bucket1, testK1[2], testV1[2]))
+		var wg sync.WaitGroup
+		errs := make(chan error, 8)
+		for i := 0; i < cap(errs); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					value, err := snapshot.Get(bucket1, testK1[0])
+					if err == nil && string(value) != string(testV1[0]) {
+						err = errors.Errorf("unexpected value %x", value)
+					}
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(err)
+		}
+		value, err := snapshot.Get(bucket1, testK1[1])
+		require.NoError(err)
+		require.Equal(testV1[1], value)
+		value, err = snapshot.Get(bucket2, testK2[0])
+		require.NoError(err)
+		require.Len(value, 0)
+		_, err = snapshot.Get(bucket1, testK1[2])
+		require.Equal(ErrNotExist, errors.Cause(err))
+		value, err = kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV2[0], value)
+
+		// the snapshot is read-only
+		require.Equal(ErrReadOnlyTxn, snapshot.Put(bucket1, testK1[0], testV1[2]))
+		require.Equal(ErrReadOnlyTxn, snapshot.PutIfNotExists(bucket1, testK1[2], testV1[2]))
+		require.Equal(ErrReadOnlyTxn, snapshot.Delete(bucket1, testK1[0]))
+		batch := NewBatch()
+		batch.Put(bucket1, testK1[0], testV1[2], "")
+		require.Equal(ErrReadOnlyTxn, snapshot.Commit(batch))
+
+		require.NoError(snapshot.Stop(ctx))
+		_, err = snapshot.Get(bucket1, testK1[0])
+		require.Equal(ErrDBClosed, errors.Cause(err))
+		// stopping again is harmless
+		require.NoError(snapshot.Stop(ctx))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testOpenSnapshot(NewMemKVStore(), t)
+	})
+
+	dbCfg := cfg
+	path := "test-open-snapshot.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testOpenSnapshot(NewOnDiskDB(dbCfg), t)
+		// the copy of the file is removed on Stop
+		copies, err := filepath.Glob(path + ".snapshot*")
+		require.NoError(t, err)
+		require.Empty(t, copies)
+	})
+	t.Run("Bolt DB front-coded", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testOpenSnapshot(NewOnDiskDB(dbCfg, WithFrontCoding(bucket1)), t)
+	})
+
+	path = "test-open-snapshot.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testOpenSnapshot(NewOnDiskDB(dbCfg), t)
+	})
+}
+
+func TestOpenAtVersion(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	path := "test-open-at-version.badger"
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+	dbCfg := cfg
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	kvStore := NewOnDiskDB(dbCfg, WithRetainedVersions(10))
+	require.NoError(kvStore.Start(ctx))
+	// version returns the version the key is written at last
+	version := func(namespace string, key []byte) uint64 {
+		db, ok := BadgerDB(kvStore)
+		require.True(ok)
+		var v uint64
+		require.NoError(db.View(func(txn *badger.Txn) error {
+			item, err := txn.Get(append([]byte(namespace), key...))
+			if err != nil {
+				return err
+			}
+			v = item.Version()
+			return nil
+		}))
+		return v
+	}
+
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+	v1 := version(bucket1, testK1[0])
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[1]))
+	require.NoError(kvStore.Put(bucket1, testK1[1], testV1[1]))
+	v2 := version(bucket1, testK1[1])
+	require.NoError(kvStore.Delete(bucket1, testK1[1]))
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[2]))
+	v3 := version(bucket1, testK1[0])
+	require.True(v1 < v2 && v2 < v3)
+	require.NoError(kvStore.Stop(ctx))
+
+	for _, c := range []struct {
+		version uint64
+		values  [][]byte
+	}{
+		{v1, [][]byte{testV1[0], nil}},
+		// the versions of testK1[1] are dropped along with its delete marker by the compaction on close
+		{v2, [][]byte{testV1[1], nil}},
+		{v3, [][]byte{testV1[2], nil}},
+	} {
+		pinned, err := OpenAtVersion(path, c.version)
+		require.NoError(err)
+		for i, expected := range c.values {
+			value, err := pinned.Get(bucket1, testK1[i])
+			if expected == nil {
+				require.Equal(ErrNotExist, errors.Cause(err))
+				continue
+			}
+			require.NoError(err)
+			require.Equal(expected, value)
+		}
+		require.Equal(ErrReadOnlyTxn, errors.Cause(pinned.Put(bucket1, testK1[2], testV1[2])))
+		require.Equal(ErrReadOnlyTxn, errors.Cause(pinned.Delete(bucket1, testK1[0])))
+		require.NoError(pinned.Stop(ctx))
+	}
+
+	_, err := OpenAtVersion(path, 0)
+	require.Equal(ErrInvalidDB, errors.Cause(err))
+}
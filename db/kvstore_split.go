@@ -0,0 +1,263 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// splitNamespace is the namespace keeping the number of buckets of each split namespace, keyed by the name of the
+// namespace
+const splitNamespace = "splitNamespaces"
+
+// splitPageSize is the number of keys listed at a time from each bucket to stream a split namespace
+const splitPageSize = 256
+
+// splitKVStore is a KV store spreading the records of each split namespace over multiple buckets by the hash of their
+// keys
+type splitKVStore struct {
+	kvStore KVStore
+	// mutex guards buckets, the number of buckets of each split namespace, which is the one recorded on start
+	mutex   sync.RWMutex
+	buckets map[string]int
+}
+
+// newSplitKVStore wraps the KV store to split each namespace over its number of buckets
+func newSplitKVStore(kvStore KVStore, buckets map[string]int) KVStore {
+	s := &splitKVStore{kvStore: kvStore, buckets: make(map[string]int, len(buckets))}
+	for namespace, n := range buckets {
+		s.buckets[namespace] = n
+	}
+	return s
+}
+
+// Start starts the underlying KV store, and records the number of buckets of each split namespace, or takes the one
+// recorded before if any
+func (s *splitKVStore) Start(ctx context.Context) error {
+	if err := s.kvStore.Start(ctx); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	manager, _ := s.kvStore.(NamespaceManager)
+	if manager != nil {
+		if err := manager.CreateNamespace(splitNamespace); err != nil {
+			return err
+		}
+	}
+	for namespace, n := range s.buckets {
+		value, err := s.kvStore.Get(splitNamespace, []byte(namespace))
+		switch {
+		case err == nil:
+			recorded, err := decodeSchemaVersion(value)
+			if err != nil || recorded == 0 {
+				return errors.Wrapf(ErrInvalidDB, "malformed number of buckets of namespace %s", namespace)
+			}
+			n = int(recorded)
+		case isNotExist(err):
+			if n < 1 {
+				return errors.Wrapf(ErrInvalidDB, "invalid number of buckets %d of namespace %s", n, namespace)
+			}
+			value = make([]byte, 4)
+			binary.BigEndian.PutUint32(value, uint32(n))
+			if err := s.kvStore.Put(splitNamespace, []byte(namespace), value); err != nil {
+				return errors.Wrapf(err, "failed to record the number of buckets of namespace %s", namespace)
+			}
+		default:
+			return errors.Wrapf(err, "failed to get the number of buckets of namespace %s", namespace)
+		}
+		s.buckets[namespace] = n
+		if manager != nil {
+			for i := 0; i < n; i++ {
+				if err := manager.CreateNamespace(splitBucket(namespace, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Stop stops the underlying KV store
+func (s *splitKVStore) Stop(ctx context.Context) error {
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record
+func (s *splitKVStore) Put(namespace string, key, value []byte) error {
+	return s.kvStore.Put(s.bucket(namespace, key), key, value)
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (s *splitKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	return s.kvStore.PutIfNotExists(s.bucket(namespace, key), key, value)
+}
+
+// Get retrieves a record
+func (s *splitKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	return s.kvStore.Get(s.bucket(namespace, key), key)
+}
+
+// Delete deletes a record
+func (s *splitKVStore) Delete(namespace string, key []byte) error {
+	return s.kvStore.Delete(s.bucket(namespace, key), key)
+}
+
+// Commit commits the batch with the entries of the split namespaces written to their buckets, in one commit of the
+// underlying KV store
+func (s *splitKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	entries := make([]writeInfo, b.Size())
+	for i := range entries {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		entries[i] = *write
+		entries[i].namespace = s.bucket(write.namespace, write.key)
+	}
+	if err := s.kvStore.Commit(newBatchOf(entries)); err != nil {
+		return err
+	}
+	succeed = true
+	return nil
+}
+
+// StreamAll calls fn on each record of the namespace in key order, merging the buckets of a split namespace by listing
+// their keys page by page. The records of a split namespace are read one by one rather than at a single point in
+// time, so a record deleted meanwhile may be skipped, and one written meanwhile may be visited
+func (s *splitKVStore) StreamAll(namespace string, fn func([]byte, []byte) error) error {
+	n := s.numBuckets(namespace)
+	if n == 0 {
+		streamer, ok := s.kvStore.(Streamer)
+		if !ok {
+			return errors.Wrap(ErrInvalidDB, "KV store does not support streaming")
+		}
+		return streamer.StreamAll(namespace, fn)
+	}
+	pager, ok := s.kvStore.(KeyPager)
+	if !ok {
+		return errors.Wrap(ErrInvalidDB, "KV store does not support listing keys")
+	}
+
+	// pages is the keys of each bucket not visited yet in the page listed, and cursors the cursor of its next page
+	pages := make([][][]byte, n)
+	cursors := make([][]byte, n)
+	for i := range cursors {
+		cursors[i] = []byte{}
+	}
+	for {
+		min := -1
+		for i := range pages {
+			if len(pages[i]) == 0 && cursors[i] != nil {
+				page, cursor, err := pager.KeysPaged(splitBucket(namespace, i), cursors[i], splitPageSize)
+				if err != nil {
+					return err
+				}
+				pages[i], cursors[i] = page, cursor
+			}
+			if len(pages[i]) > 0 && (min < 0 || bytes.Compare(pages[i][0], pages[min][0]) < 0) {
+				min = i
+			}
+		}
+		if min < 0 {
+			return nil
+		}
+		key := pages[min][0]
+		pages[min] = pages[min][1:]
+		value, err := s.kvStore.Get(splitBucket(namespace, min), key)
+		if isNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+}
+
+// KeysPaged merges the pages of keys of the buckets of a split namespace into a page of the keys in sorted order
+func (s *splitKVStore) KeysPaged(namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	pager, ok := s.kvStore.(KeyPager)
+	if !ok {
+		return nil, nil, errors.Wrap(ErrInvalidDB, "KV store does not support listing keys")
+	}
+	n := s.numBuckets(namespace)
+	if n == 0 {
+		return pager.KeysPaged(namespace, after, limit)
+	}
+	if limit <= 0 {
+		return nil, nil, errors.Wrapf(ErrInvalidDB, "invalid limit %d", limit)
+	}
+	var keys [][]byte
+	more := false
+	for i := 0; i < n; i++ {
+		page, cursor, err := pager.KeysPaged(splitBucket(namespace, i), after, limit)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, page...)
+		more = more || cursor != nil
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	// the keys of a bucket beyond its page all sort after its page of limit keys, so the first limit keys are complete
+	if len(keys) > limit || more {
+		return keys[:limit], keys[limit-1], nil
+	}
+	return keys, nil, nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// underlying returns the KV store wrapped
+func (s *splitKVStore) underlying() KVStore { return s.kvStore }
+
+// numBuckets returns the number of buckets of the namespace, 0 if it is not split
+func (s *splitKVStore) numBuckets(namespace string) int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.buckets[namespace]
+}
+
+// bucket returns the bucket of the record, which is the namespace itself if it is not split
+func (s *splitKVStore) bucket(namespace string, key []byte) string {
+	n := s.numBuckets(namespace)
+	if n == 0 {
+		return namespace
+	}
+	return splitBucket(namespace, int(ringHash(key)%uint64(n)))
+}
+
+// splitBucket returns the name of the i-th bucket of the split namespace
+func splitBucket(namespace string, i int) string {
+	return fmt.Sprintf("%s#%d", namespace, i)
+}
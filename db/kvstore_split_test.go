@@ -0,0 +1,170 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestSplitNamespace(t *testing.T) {
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key-%04d", i)) }
+
+	testSplit := func(newKVStore func(...KVStoreOption) KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		kvStore := newKVStore(WithSplitNamespace(bucket1, 4))
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+
+		// the records are written in random order, by a mix of writes and commits
+		const numRecords = 1000
+		batch := NewBatch()
+		for n, i := range rand.Perm(numRecords) {
+			if n%2 == 0 {
+				require.NoError(kvStore.Put(bucket1, key(i), []byte{byte(i)}))
+				continue
+			}
+			require.NoError(batch.Put(bucket1, key(i), []byte{byte(i)}, ""))
+		}
+		require.NoError(batch.PutIfNotExists(bucket2, testK2[0], testV2[0], ""))
+		require.NoError(kvStore.Commit(batch))
+		require.Equal(ErrAlreadyExist, errors.Cause(kvStore.PutIfNotExists(bucket1, key(7), testV1[0])))
+		require.NoError(kvStore.Delete(bucket1, key(numRecords-1)))
+		value, err := kvStore.Get(bucket1, key(42))
+		require.NoError(err)
+		require.Equal([]byte{42}, value)
+		_, err = kvStore.Get(bucket1, key(numRecords-1))
+		require.True(isNotExist(err))
+		value, err = kvStore.Get(bucket2, testK2[0])
+		require.NoError(err)
+		require.Equal(testV2[0], value)
+
+		// the iteration merges the buckets in key order
+		for _, limit := range []int{1, 7, 256, 2000} {
+			var keys [][]byte
+			after := []byte{}
+			for after != nil {
+				page, next, err := kvStore.(KeyPager).KeysPaged(bucket1, after, limit)
+				require.NoError(err)
+				require.True(len(page) <= limit)
+				keys = append(keys, page...)
+				after = next
+			}
+			require.Len(keys, numRecords-1)
+			for i, k := range keys {
+				require.Equal(key(i), k)
+			}
+		}
+		i := 0
+		require.NoError(kvStore.(Streamer).StreamAll(bucket1, func(k, v []byte) error {
+			require.Equal(key(i), k)
+			require.Equal([]byte{byte(i)}, v)
+			i++
+			return nil
+		}))
+		require.Equal(numRecords-1, i)
+		err = kvStore.(Streamer).StreamAll(bucket1, func(k, v []byte) error { return errWriteFailed })
+		require.Equal(errWriteFailed, errors.Cause(err))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testSplit(NewMemKVStore, t)
+	})
+	t.Run("Bolt DB", func(t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		dbCfg := cfg
+		path := "test-split-namespace.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testSplit(func(opts ...KVStoreOption) KVStore { return NewOnDiskDB(dbCfg, opts...) }, t)
+
+		// the records are spread over the buckets
+		kvStore := NewOnDiskDB(dbCfg)
+		require.NoError(kvStore.Start(ctx))
+		for i := 0; i < 4; i++ {
+			keys, _, err := kvStore.(KeyPager).KeysPaged(splitBucket(bucket1, i), []byte{}, 1)
+			require.NoError(err)
+			require.Len(keys, 1)
+		}
+		require.NoError(kvStore.Stop(ctx))
+
+		// the number of buckets recorded on the first start is kept on reopen
+		kvStore = NewOnDiskDB(dbCfg, WithSplitNamespace(bucket1, 16))
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		for i := 0; i < 999; i++ {
+			value, err := kvStore.Get(bucket1, key(i))
+			require.NoError(err)
+			require.Equal([]byte{byte(i)}, value)
+		}
+	})
+}
+
+func BenchmarkSplitNamespace(b *testing.B) {
+	const numRecords = 200000
+	for _, buckets := range []int{0, 16} {
+		b.Run(fmt.Sprintf("%d buckets", buckets), func(b *testing.B) {
+			require := require.New(b)
+			ctx := context.Background()
+
+			dbCfg := cfg
+			path := "bench-split-namespace.bolt"
+			dbCfg.DbPath = path
+			dbCfg.UseBadgerDB = false
+			require.NoError(os.RemoveAll(path))
+			defer func() {
+				require.NoError(os.RemoveAll(path))
+			}()
+			var opts []KVStoreOption
+			if buckets > 0 {
+				opts = append(opts, WithSplitNamespace(bucket1, buckets))
+			}
+			kvStore := NewOnDiskDB(dbCfg, opts...)
+			require.NoError(kvStore.Start(ctx))
+			defer func() {
+				require.NoError(kvStore.Stop(ctx))
+			}()
+			batch := NewBatch()
+			for i := 0; i < numRecords; i++ {
+				batch.Put(bucket1, []byte(fmt.Sprintf("key-%08d", rand.Intn(numRecords*10))), testV1[0], "")
+				if batch.Size() == 10000 {
+					require.NoError(kvStore.Commit(batch))
+				}
+			}
+			require.NoError(kvStore.Commit(batch))
+
+			b.Run("Put", func(b *testing.B) {
+				for n := 0; n < b.N; n++ {
+					kvStore.Put(bucket1, []byte(fmt.Sprintf("key-%08d", rand.Intn(numRecords*10))), testV1[1])
+				}
+			})
+			b.Run("Get", func(b *testing.B) {
+				for n := 0; n < b.N; n++ {
+					kvStore.Get(bucket1, []byte(fmt.Sprintf("key-%08d", rand.Intn(numRecords*10))))
+				}
+			})
+		})
+	}
+}
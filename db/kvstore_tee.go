@@ -0,0 +1,148 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/logger"
+)
+
+// TeeFailurePolicy is how a tee KV store handles a write failing on the secondary KV store
+type TeeFailurePolicy int
+
+const (
+	// TeeFatal fails the write if the secondary KV store fails it. The write is applied to the primary KV store
+	// already by then, so the secondary KV store is missing it
+	TeeFatal TeeFailurePolicy = iota
+	// TeeBestEffort logs the failure of the secondary KV store and succeeds the write
+	TeeBestEffort
+)
+
+// teeKVStore is a KV store mirroring the writes to a secondary KV store
+type teeKVStore struct {
+	// mutex serializes the writes, so the secondary KV store applies them in the same order as the primary
+	mutex     sync.Mutex
+	primary   KVStore
+	secondary KVStore
+	policy    TeeFailurePolicy
+}
+
+// NewTeeKVStore returns a KV store which applies each write to primary, and then mirrors it to secondary, while
+// serving reads from primary only. A write failing on primary is not mirrored. A write failing on secondary is handled
+// according to policy. PutIfNotExists is mirrored as a Put, so that secondary converges to primary even if it holds
+// the key already, e.g. copied there by a migration in progress
+func NewTeeKVStore(primary, secondary KVStore, policy TeeFailurePolicy) KVStore {
+	return &teeKVStore{
+		primary:   primary,
+		secondary: secondary,
+		policy:    policy,
+	}
+}
+
+// Start starts the primary and the secondary KV store
+func (t *teeKVStore) Start(ctx context.Context) error {
+	if err := t.primary.Start(ctx); err != nil {
+		return err
+	}
+	return t.secondary.Start(ctx)
+}
+
+// Stop stops the primary and the secondary KV store, and returns the first error
+func (t *teeKVStore) Stop(ctx context.Context) error {
+	return stopError(t.primary.Stop(ctx), t.secondary.Stop(ctx))
+}
+
+// Put inserts a <key, value> record into both KV stores
+func (t *teeKVStore) Put(namespace string, key, value []byte) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err := t.primary.Put(namespace, key, value); err != nil {
+		return err
+	}
+	return t.mirrored(t.secondary.Put(namespace, key, value))
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist in the primary KV store yet, otherwise
+// return ErrAlreadyExist
+func (t *teeKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err := t.primary.PutIfNotExists(namespace, key, value); err != nil {
+		return err
+	}
+	return t.mirrored(t.secondary.Put(namespace, key, value))
+}
+
+// Get retrieves a record from the primary KV store
+func (t *teeKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	return t.primary.Get(namespace, key)
+}
+
+// Delete deletes a record from both KV stores
+func (t *teeKVStore) Delete(namespace string, key []byte) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err := t.primary.Delete(namespace, key); err != nil {
+		return err
+	}
+	return t.mirrored(t.secondary.Delete(namespace, key))
+}
+
+// Commit commits the batch to the primary KV store, and then a copy of it to the secondary KV store. The batch must
+// not be modified while being committed
+func (t *teeKVStore) Commit(b KVStoreBatch) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	b.Lock()
+	if b.committed() {
+		b.Unlock()
+		return ErrBatchAlreadyCommitted
+	}
+	// the batch is cleared once committed, so the secondary KV store commits a copy
+	entries := make([]writeInfo, b.Size())
+	for i := range entries {
+		write, err := b.Entry(i)
+		if err != nil {
+			b.Unlock()
+			return err
+		}
+		entries[i] = *write
+		if entries[i].writeType == PutIfNotExists {
+			entries[i].writeType = Put
+		}
+	}
+	b.Unlock()
+
+	if err := t.primary.Commit(b); err != nil {
+		return err
+	}
+	return t.mirrored(t.secondary.Commit(newBatchOf(entries)))
+}
+
+//======================================
+// private functions
+//======================================
+
+// mirrored returns the error of the secondary KV store according to the failure policy
+func (t *teeKVStore) mirrored(err error) error {
+	if err == nil {
+		return nil
+	}
+	if t.policy == TeeBestEffort {
+		logger.Warn().Err(err).Msg("Failed to mirror write to secondary KV store.")
+		return nil
+	}
+	return errors.Wrap(err, "failed to mirror write to secondary KV store")
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+var errWriteFailed = errors.New("write failed")
+
+// failingKVStore fails every write while fail is set
+type failingKVStore struct {
+	KVStore
+	fail bool
+}
+
+func (s *failingKVStore) Put(namespace string, key, value []byte) error {
+	if s.fail {
+		return errWriteFailed
+	}
+	return s.KVStore.Put(namespace, key, value)
+}
+
+func (s *failingKVStore) Delete(namespace string, key []byte) error {
+	if s.fail {
+		return errWriteFailed
+	}
+	return s.KVStore.Delete(namespace, key)
+}
+
+func (s *failingKVStore) Commit(b KVStoreBatch) error {
+	if s.fail {
+		return errWriteFailed
+	}
+	return s.KVStore.Commit(b)
+}
+
+func TestTeeKVStore(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	primary := NewMemKVStore()
+	secondary := &failingKVStore{KVStore: NewMemKVStore()}
+	kvStore := NewTeeKVStore(primary, secondary, TeeFatal)
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+
+	// both KV stores receive the writes
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+	require.NoError(secondary.Put(bucket1, testK1[1], testV2[1]))
+	require.NoError(kvStore.PutIfNotExists(bucket1, testK1[1], testV1[1]))
+	require.Equal(ErrAlreadyExist, errors.Cause(kvStore.PutIfNotExists(bucket1, testK1[0], testV1[1])))
+	batch := NewBatch()
+	batch.Put(bucket1, testK1[2], testV1[2], "")
+	batch.PutIfNotExists(bucket2, testK2[0], testV2[0], "")
+	require.NoError(kvStore.Commit(batch))
+	require.Equal(0, batch.Size())
+	require.Equal(ErrBatchAlreadyCommitted, errors.Cause(kvStore.Commit(batch)))
+	for _, kv := range [][3][]byte{
+		{[]byte(bucket1), testK1[0], testV1[0]},
+		{[]byte(bucket1), testK1[1], testV1[1]},
+		{[]byte(bucket1), testK1[2], testV1[2]},
+		{[]byte(bucket2), testK2[0], testV2[0]},
+	} {
+		for _, store := range []KVStore{primary, secondary} {
+			value, err := store.Get(string(kv[0]), kv[1])
+			require.NoError(err)
+			require.Equal(kv[2], value)
+		}
+	}
+	require.NoError(kvStore.Delete(bucket1, testK1[0]))
+	for _, store := range []KVStore{primary, secondary} {
+		_, err := store.Get(bucket1, testK1[0])
+		require.Equal(ErrNotExist, errors.Cause(err))
+	}
+
+	// reads come from the primary
+	require.NoError(secondary.Put(bucket1, testK1[2], testV2[2]))
+	value, err := kvStore.Get(bucket1, testK1[2])
+	require.NoError(err)
+	require.Equal(testV1[2], value)
+
+	// a failure of the secondary fails the write, which the primary has applied
+	secondary.fail = true
+	require.Equal(errWriteFailed, errors.Cause(kvStore.Put(bucket1, testK1[0], testV1[0])))
+	value, err = primary.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], value)
+	batch.Put(bucket1, testK1[1], testV2[1], "")
+	require.Equal(errWriteFailed, errors.Cause(kvStore.Commit(batch)))
+	require.Equal(errWriteFailed, errors.Cause(kvStore.Delete(bucket1, testK1[0])))
+
+	// a failure of the primary is not mirrored
+	secondary.fail = false
+	failingPrimary := &failingKVStore{KVStore: NewMemKVStore(), fail: true}
+	other := NewMemKVStore()
+	err = NewTeeKVStore(failingPrimary, other, TeeFatal).Put(bucket1, testK1[0], testV1[0])
+	require.Equal(errWriteFailed, errors.Cause(err))
+	_, err = other.Get(bucket1, testK1[0])
+	require.Error(err)
+}
+
+func TestTeeKVStoreBestEffort(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	primary := NewMemKVStore()
+	secondary := &failingKVStore{KVStore: NewMemKVStore(), fail: true}
+	kvStore := NewTeeKVStore(primary, secondary, TeeBestEffort)
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+
+	// a failure of the secondary does not fail the write
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+	batch := NewBatch()
+	batch.Put(bucket1, testK1[1], testV1[1], "")
+	require.NoError(kvStore.Commit(batch))
+	require.NoError(kvStore.Delete(bucket1, testK1[0]))
+	_, err := primary.Get(bucket1, testK1[0])
+	require.Equal(ErrNotExist, errors.Cause(err))
+	value, err := kvStore.Get(bucket1, testK1[1])
+	require.NoError(err)
+	require.Equal(testV1[1], value)
+	_, err = secondary.Get(bucket1, testK1[1])
+	require.Error(err)
+
+	// the writes are mirrored again once the secondary recovers
+	secondary.fail = false
+	require.NoError(kvStore.Put(bucket1, testK1[2], testV1[2]))
+	value, err = secondary.Get(bucket1, testK1[2])
+	require.NoError(err)
+	require.Equal(testV1[2], value)
+}
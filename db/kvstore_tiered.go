@@ -0,0 +1,424 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/logger"
+)
+
+// tierMigrateBatchSize is the number of records migrated to the cold KV store in one commit
+const tierMigrateBatchSize = 256
+
+type (
+	// TierPolicy is which records of the hot KV store are migrated to the cold KV store, and when
+	TierPolicy struct {
+		// Namespaces is the namespaces whose records are migrated, the records of the other namespaces stay hot
+		Namespaces []string
+		// MaxAge is how long a record stays hot once written
+		MaxAge time.Duration
+		// MinReads keeps a record hot for another MaxAge as long as it is read at least MinReads times within MaxAge,
+		// 0 migrates it regardless of its reads
+		MinReads int
+		// Interval is how often the migrator looks for the records to migrate
+		Interval time.Duration
+	}
+
+	// TieredOption sets an option of the tiered KV store
+	TieredOption func(*tieredKVStore)
+
+	// tieredKVStore is a KV store writing to a hot KV store, and migrating the records of the hot KV store to a cold
+	// KV store in the background
+	tieredKVStore struct {
+		hot        KVStore
+		cold       KVStore
+		policy     TierPolicy
+		namespaces map[string]struct{}
+		clk        clock.Clock
+		// migrateMutex is read locked by the writes and locked by a migration, so that a record written meanwhile is
+		// never deleted from the hot KV store by a migration copying the value before the write
+		migrateMutex sync.RWMutex
+		// mutex guards the records of the hot KV store tracked for migration
+		mutex   sync.Mutex
+		tracked map[cacheKey]*tieredRecord
+		done    chan struct{}
+		wg      sync.WaitGroup
+	}
+
+	// tieredRecord is the use of a record of the hot KV store since the start of its current MaxAge
+	tieredRecord struct {
+		since time.Time
+		reads int
+	}
+)
+
+// WithTieredClock sets the clock timing the migrator and the ages of the records, which is the system clock by
+// default
+func WithTieredClock(clk clock.Clock) TieredOption {
+	return func(t *tieredKVStore) {
+		t.clk = clk
+	}
+}
+
+// NewTieredKVStore returns a KV store writing to hot, and reading from hot and then from cold if the record is not in
+// hot. A migrator moves the records of the namespaces of policy from hot to cold in the background, every interval of
+// the policy, once they are older than the max age of the policy and read less than its min reads within the age. A
+// record is deleted from hot only after it is written to cold, so it is readable throughout the migration. A record
+// is migrated only if hot holds it any longer than cold, so the ages are tracked in memory: the records found in hot
+// on start, which must be a KeyPager to list them, are taken as written on start. Deletes apply to both KV stores, a
+// PutIfNotExists checks both of them, and a commit applies to hot and then its deletes to cold, so a write is atomic
+// within each KV store but not across them
+func NewTieredKVStore(hot, cold KVStore, policy TierPolicy, opts ...TieredOption) KVStore {
+	t := &tieredKVStore{
+		hot:        hot,
+		cold:       cold,
+		policy:     policy,
+		namespaces: make(map[string]struct{}, len(policy.Namespaces)),
+		clk:        clock.New(),
+		tracked:    make(map[cacheKey]*tieredRecord),
+	}
+	for _, namespace := range policy.Namespaces {
+		t.namespaces[namespace] = struct{}{}
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Start starts the hot and the cold KV store, tracks the records of the namespaces of the policy in hot, and starts
+// the migrator
+func (t *tieredKVStore) Start(ctx context.Context) error {
+	if t.policy.MaxAge <= 0 || t.policy.Interval <= 0 {
+		return errors.Wrapf(ErrInvalidDB, "invalid tier policy of max age %s and interval %s", t.policy.MaxAge,
+			t.policy.Interval)
+	}
+	if err := t.hot.Start(ctx); err != nil {
+		return err
+	}
+	if err := t.cold.Start(ctx); err != nil {
+		return err
+	}
+	if err := t.seed(); err != nil {
+		return err
+	}
+	t.done = make(chan struct{})
+	t.wg.Add(1)
+	go t.migrateLoop()
+	return nil
+}
+
+// Stop stops the migrator, and then the hot and the cold KV store, and returns the first error
+func (t *tieredKVStore) Stop(ctx context.Context) error {
+	if t.done != nil {
+		close(t.done)
+		t.wg.Wait()
+		t.done = nil
+	}
+	return stopError(t.hot.Stop(ctx), t.cold.Stop(ctx))
+}
+
+// Put inserts a <key, value> record into the hot KV store
+func (t *tieredKVStore) Put(namespace string, key, value []byte) error {
+	t.migrateMutex.RLock()
+	defer t.migrateMutex.RUnlock()
+
+	if err := t.hot.Put(namespace, key, value); err != nil {
+		return err
+	}
+	t.written(namespace, key)
+	return nil
+}
+
+// PutIfNotExists inserts a <key, value> record into the hot KV store only if it exists in neither KV store, otherwise
+// return ErrAlreadyExist
+func (t *tieredKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	t.migrateMutex.RLock()
+	defer t.migrateMutex.RUnlock()
+
+	_, err := t.cold.Get(namespace, key)
+	if err == nil {
+		return kvError("PutIfNotExists", namespace, key, ErrAlreadyExist)
+	}
+	if !isNotExist(err) {
+		return err
+	}
+	if err := t.hot.PutIfNotExists(namespace, key, value); err != nil {
+		return err
+	}
+	t.written(namespace, key)
+	return nil
+}
+
+// Get retrieves a record from the hot KV store, or from the cold KV store if it is not in the hot one
+func (t *tieredKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	value, err := t.hot.Get(namespace, key)
+	if err == nil {
+		t.read(namespace, key)
+		return value, nil
+	}
+	if !isNotExist(err) {
+		return nil, err
+	}
+	return t.cold.Get(namespace, key)
+}
+
+// Delete deletes a record from both KV stores
+func (t *tieredKVStore) Delete(namespace string, key []byte) error {
+	t.migrateMutex.RLock()
+	defer t.migrateMutex.RUnlock()
+
+	if err := t.hot.Delete(namespace, key); err != nil {
+		return err
+	}
+	t.forget(namespace, key)
+	return t.cold.Delete(namespace, key)
+}
+
+// Commit commits the batch to the hot KV store, and then its deletes to the cold KV store
+func (t *tieredKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	t.migrateMutex.RLock()
+	defer t.migrateMutex.RUnlock()
+
+	entries := make([]writeInfo, b.Size())
+	var deletes []writeInfo
+	for i := range entries {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		switch write.writeType {
+		case AddCounter:
+			// the counter may be in the cold KV store
+			return errors.Wrap(ErrInvalidDB, "counters are not supported by the tiered KV store")
+		case PutIfNotExists:
+			if _, err := t.cold.Get(write.namespace, write.key); err == nil {
+				return errors.Wrapf(ErrAlreadyExist, write.errorFormat, write.errorArgs)
+			} else if !isNotExist(err) {
+				return err
+			}
+		case Delete:
+			deletes = append(deletes, *write)
+		}
+		entries[i] = *write
+	}
+	if err := t.hot.Commit(newBatchOf(entries)); err != nil {
+		return err
+	}
+	for _, write := range entries {
+		if write.writeType == Delete {
+			t.forget(write.namespace, write.key)
+		} else {
+			t.written(write.namespace, write.key)
+		}
+	}
+	if len(deletes) > 0 {
+		if err := t.cold.Commit(newBatchOf(deletes)); err != nil {
+			return errors.Wrap(err, "failed to commit deletes to the cold KV store")
+		}
+	}
+	succeed = true
+	return nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// seed tracks the records of the namespaces of the policy found in the hot KV store as written now
+func (t *tieredKVStore) seed() error {
+	pager, ok := t.hot.(KeyPager)
+	if !ok {
+		return nil
+	}
+	now := t.clk.Now()
+	tracked := make(map[cacheKey]*tieredRecord)
+	for namespace := range t.namespaces {
+		after := []byte{}
+		for after != nil {
+			keys, next, err := pager.KeysPaged(namespace, after, tierMigrateBatchSize)
+			if isNotExist(err) {
+				break
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed to list keys of namespace %s", namespace)
+			}
+			for _, key := range keys {
+				tracked[cacheKey{namespace: namespace, key: string(key)}] = &tieredRecord{since: now}
+			}
+			after = next
+		}
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.tracked = tracked
+	return nil
+}
+
+// written starts the age of the record of a migrated namespace over
+func (t *tieredKVStore) written(namespace string, key []byte) {
+	if _, ok := t.namespaces[namespace]; !ok {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.tracked[cacheKey{namespace: namespace, key: string(key)}] = &tieredRecord{since: t.clk.Now()}
+}
+
+// read counts a read of the record of a migrated namespace
+func (t *tieredKVStore) read(namespace string, key []byte) {
+	if _, ok := t.namespaces[namespace]; !ok || t.policy.MinReads <= 0 {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if record, ok := t.tracked[cacheKey{namespace: namespace, key: string(key)}]; ok {
+		record.reads++
+	}
+}
+
+// forget stops tracking the deleted record
+func (t *tieredKVStore) forget(namespace string, key []byte) {
+	if _, ok := t.namespaces[namespace]; !ok {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.tracked, cacheKey{namespace: namespace, key: string(key)})
+}
+
+// migrateLoop migrates the records due every interval until the KV store is stopped
+func (t *tieredKVStore) migrateLoop() {
+	defer t.wg.Done()
+
+	ticker := t.clk.Ticker(t.policy.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			if err := t.migrate(); err != nil {
+				logger.Error().Err(err).Msg("Failed to migrate records to the cold KV store.")
+			}
+		}
+	}
+}
+
+// migrate migrates the records due, a batch at a time
+func (t *tieredKVStore) migrate() error {
+	due := t.due()
+	for start := 0; start < len(due); start += tierMigrateBatchSize {
+		select {
+		case <-t.done:
+			return nil
+		default:
+		}
+		end := start + tierMigrateBatchSize
+		if end > len(due) {
+			end = len(due)
+		}
+		if err := t.migrateBatch(due[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// due returns the records older than the max age, and starts the age of those read often enough over
+func (t *tieredKVStore) due() []cacheKey {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.clk.Now()
+	var due []cacheKey
+	for k, record := range t.tracked {
+		if now.Sub(record.since) < t.policy.MaxAge {
+			continue
+		}
+		if t.policy.MinReads > 0 && record.reads >= t.policy.MinReads {
+			record.since, record.reads = now, 0
+			continue
+		}
+		due = append(due, k)
+	}
+	return due
+}
+
+// migrateBatch writes the records to the cold KV store in one commit, and then deletes them from the hot KV store in
+// another one. A record changed or deleted since it is found due is left as is
+func (t *tieredKVStore) migrateBatch(keys []cacheKey) error {
+	t.migrateMutex.Lock()
+	defer t.migrateMutex.Unlock()
+
+	now := t.clk.Now()
+	puts := NewBatch()
+	deletes := NewBatch()
+	var migrated []cacheKey
+	for _, k := range keys {
+		t.mutex.Lock()
+		record, ok := t.tracked[k]
+		stillDue := ok && now.Sub(record.since) >= t.policy.MaxAge
+		t.mutex.Unlock()
+		if !stillDue {
+			continue
+		}
+		value, err := t.hot.Get(k.namespace, []byte(k.key))
+		if isNotExist(err) {
+			t.forget(k.namespace, []byte(k.key))
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to get key = %x to migrate", []byte(k.key))
+		}
+		if err := puts.Put(k.namespace, []byte(k.key), value, "failed to migrate key = %x", []byte(k.key)); err != nil {
+			return err
+		}
+		if err := deletes.Delete(k.namespace, []byte(k.key), "failed to delete migrated key = %x",
+			[]byte(k.key)); err != nil {
+			return err
+		}
+		migrated = append(migrated, k)
+	}
+	if len(migrated) == 0 {
+		return nil
+	}
+	if err := t.cold.Commit(puts); err != nil {
+		return errors.Wrap(err, "failed to write migrated records to the cold KV store")
+	}
+	if err := t.hot.Commit(deletes); err != nil {
+		return errors.Wrap(err, "failed to delete migrated records from the hot KV store")
+	}
+	for _, k := range migrated {
+		t.forget(k.namespace, []byte(k.key))
+	}
+	return nil
+}
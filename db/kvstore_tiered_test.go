@@ -0,0 +1,96 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestTieredKVStore(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	hot, cold := NewMemKVStore(), NewMemKVStore()
+	clk := clock.NewMock()
+	policy := TierPolicy{Namespaces: []string{bucket1}, MaxAge: time.Hour, MinReads: 3, Interval: time.Minute}
+	kvStore := NewTieredKVStore(hot, cold, policy, WithTieredClock(clk))
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+
+	// a read falls through to the cold KV store, and an insert checks both of them
+	require.NoError(cold.Put(bucket1, testK1[0], testV1[0]))
+	value, err := kvStore.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], value)
+	require.Equal(ErrAlreadyExist, errors.Cause(kvStore.PutIfNotExists(bucket1, testK1[0], testV1[1])))
+	batch := NewBatch()
+	require.NoError(batch.PutIfNotExists(bucket1, testK1[0], testV1[1], ""))
+	require.Equal(ErrAlreadyExist, errors.Cause(kvStore.Commit(batch)))
+
+	// a write goes to the hot KV store, and a delete applies to both of them
+	require.NoError(kvStore.Put(bucket1, testK1[1], testV1[1]))
+	require.NoError(kvStore.Put(bucket1, testK1[2], testV1[2]))
+	require.NoError(kvStore.Put(bucket2, testK2[0], testV2[0]))
+	_, err = cold.Get(bucket1, testK1[1])
+	require.True(isNotExist(err))
+	require.NoError(kvStore.Delete(bucket1, testK1[0]))
+	_, err = kvStore.Get(bucket1, testK1[0])
+	require.True(isNotExist(err))
+
+	// the records older than the max age are migrated, except for those read often and the other namespaces
+	clk.Add(30 * time.Minute)
+	for i := 0; i < 3; i++ {
+		_, err = kvStore.Get(bucket1, testK1[2])
+		require.NoError(err)
+	}
+	require.NoError(testutil.WaitUntil(5*time.Millisecond, 5*time.Second, func() (bool, error) {
+		// the ticks of the mock clock are dropped unless the migrator is waiting for them, so tick until it migrates
+		clk.Add(time.Minute)
+		_, err := hot.Get(bucket1, testK1[1])
+		return isNotExist(err), nil
+	}))
+	value, err = cold.Get(bucket1, testK1[1])
+	require.NoError(err)
+	require.Equal(testV1[1], value)
+	value, err = hot.Get(bucket1, testK1[2])
+	require.NoError(err)
+	require.Equal(testV1[2], value)
+	value, err = hot.Get(bucket2, testK2[0])
+	require.NoError(err)
+	require.Equal(testV2[0], value)
+
+	// a migrated record is still read through the tiered KV store, from the cold KV store
+	value, err = kvStore.Get(bucket1, testK1[1])
+	require.NoError(err)
+	require.Equal(testV1[1], value)
+
+	// a record no longer read often is migrated after another max age
+	require.NoError(testutil.WaitUntil(5*time.Millisecond, 5*time.Second, func() (bool, error) {
+		clk.Add(time.Minute)
+		_, err := hot.Get(bucket1, testK1[2])
+		return isNotExist(err), nil
+	}))
+	value, err = kvStore.Get(bucket1, testK1[2])
+	require.NoError(err)
+	require.Equal(testV1[2], value)
+
+	// a record written again is hot again
+	require.NoError(kvStore.Put(bucket1, testK1[1], testV1[0]))
+	value, err = kvStore.Get(bucket1, testK1[1])
+	require.NoError(err)
+	require.Equal(testV1[0], value)
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// timeoutKVStore is a KV store failing the operations of the underlying KV store which take longer than the timeout
+type timeoutKVStore struct {
+	kvStore KVStore
+	timeout time.Duration
+}
+
+// NewTimeoutKVStore wraps the KV store so that Put, PutIfNotExists, Get, Delete and Commit return an error of cause
+// context.DeadlineExceeded if they do not finish within the timeout. Start and Stop are not subject to the timeout.
+//
+// None of the KV stores is able to cancel an operation in flight, so a timed-out operation keeps running in the
+// background and may still complete afterwards: a timed-out write may or may not be applied, and a timed-out Commit
+// may still clear the batch, which must not be reused until the commit is known to have finished
+func NewTimeoutKVStore(kvStore KVStore, timeout time.Duration) KVStore {
+	return &timeoutKVStore{
+		kvStore: kvStore,
+		timeout: timeout,
+	}
+}
+
+// Start starts the underlying KV store
+func (t *timeoutKVStore) Start(ctx context.Context) error {
+	return t.kvStore.Start(ctx)
+}
+
+// Stop stops the underlying KV store
+func (t *timeoutKVStore) Stop(ctx context.Context) error {
+	return t.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record
+func (t *timeoutKVStore) Put(namespace string, key, value []byte) error {
+	_, err := t.run("Put", func() ([]byte, error) {
+		return nil, t.kvStore.Put(namespace, key, value)
+	})
+	return err
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (t *timeoutKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	_, err := t.run("PutIfNotExists", func() ([]byte, error) {
+		return nil, t.kvStore.PutIfNotExists(namespace, key, value)
+	})
+	return err
+}
+
+// Get retrieves a record
+func (t *timeoutKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	return t.run("Get", func() ([]byte, error) {
+		return t.kvStore.Get(namespace, key)
+	})
+}
+
+// Delete deletes a record
+func (t *timeoutKVStore) Delete(namespace string, key []byte) error {
+	_, err := t.run("Delete", func() ([]byte, error) {
+		return nil, t.kvStore.Delete(namespace, key)
+	})
+	return err
+}
+
+// Commit commits a batch
+func (t *timeoutKVStore) Commit(b KVStoreBatch) error {
+	_, err := t.run("Commit", func() ([]byte, error) {
+		return nil, t.kvStore.Commit(b)
+	})
+	return err
+}
+
+//======================================
+// private functions
+//======================================
+
+// run runs the operation in a goroutine, and waits for it up to the timeout
+func (t *timeoutKVStore) run(name string, op func() ([]byte, error)) ([]byte, error) {
+	type result struct {
+		value []byte
+		err   error
+	}
+	// buffered, so that a timed-out operation does not leak its goroutine once it finishes
+	done := make(chan result, 1)
+	go func() {
+		value, err := op()
+		done <- result{value: value, err: err}
+	}()
+
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-timer.C:
+		return nil, errors.Wrapf(context.DeadlineExceeded, "%s did not finish within %v", name, t.timeout)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// slowKVStore blocks every operation until it is resumed
+type slowKVStore struct {
+	KVStore
+	resume chan struct{}
+}
+
+func (s *slowKVStore) Put(namespace string, key, value []byte) error {
+	<-s.resume
+	return s.KVStore.Put(namespace, key, value)
+}
+
+func (s *slowKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	<-s.resume
+	return s.KVStore.Get(namespace, key)
+}
+
+func (s *slowKVStore) Commit(b KVStoreBatch) error {
+	<-s.resume
+	return s.KVStore.Commit(b)
+}
+
+func TestTimeoutKVStore(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	inner := &slowKVStore{
+		KVStore: NewMemKVStore(),
+		resume:  make(chan struct{}),
+	}
+	kvStore := NewTimeoutKVStore(inner, 10*time.Millisecond)
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+
+	// operations not finishing in time fail
+	err := kvStore.Put(bucket1, testK1[0], testV1[0])
+	require.Equal(context.DeadlineExceeded, errors.Cause(err))
+	_, err = kvStore.Get(bucket1, testK1[0])
+	require.Equal(context.DeadlineExceeded, errors.Cause(err))
+	batch := NewBatch()
+	batch.Put(bucket1, testK1[1], testV1[1], "")
+	err = kvStore.Commit(batch)
+	require.Equal(context.DeadlineExceeded, errors.Cause(err))
+
+	// the timed-out operations complete in the background once the underlying KV store resumes
+	close(inner.resume)
+	require.NoError(kvStore.Put(bucket1, testK1[2], testV1[2]))
+	for i := 0; i < 3; i++ {
+		var value []byte
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if value, err = kvStore.Get(bucket1, testK1[i]); err == nil {
+				break
+			}
+		}
+		require.NoError(err)
+		require.Equal(testV1[i], value)
+	}
+
+	// operations not subject to the slow path finish in time
+	require.NoError(kvStore.Delete(bucket1, testK1[0]))
+	err = kvStore.PutIfNotExists(bucket1, testK1[1], testV1[0])
+	require.Equal(ErrAlreadyExist, errors.Cause(err))
+}
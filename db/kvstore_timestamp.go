@@ -0,0 +1,165 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+)
+
+// timestampSize is the length of the insertion timestamp prefixed to each value of a timestamped namespace
+const timestampSize = 8
+
+// TimestampGetter is the interface of KV store which is able to tell when a record is written
+type TimestampGetter interface {
+	// GetWithTimestamp retrieves a record and the time it is written at
+	GetWithTimestamp(string, []byte) ([]byte, time.Time, error)
+}
+
+// timestampKVStore is a KV store prefixing each value of the timestamped namespaces with the time it is written at
+type timestampKVStore struct {
+	kvStore    KVStore
+	namespaces map[string]struct{}
+	clk        clock.Clock
+	// mutex guards last, the latest timestamp stamped, which keeps the timestamps increasing
+	mutex sync.Mutex
+	last  int64
+}
+
+// newTimestampKVStore wraps the KV store to stamp the values of the namespaces with the time of clk
+func newTimestampKVStore(kvStore KVStore, namespaces []string, clk clock.Clock) KVStore {
+	s := &timestampKVStore{
+		kvStore:    kvStore,
+		namespaces: make(map[string]struct{}, len(namespaces)),
+		clk:        clk,
+	}
+	for _, namespace := range namespaces {
+		s.namespaces[namespace] = struct{}{}
+	}
+	return s
+}
+
+// Start starts the underlying KV store
+func (s *timestampKVStore) Start(ctx context.Context) error {
+	return s.kvStore.Start(ctx)
+}
+
+// Stop stops the underlying KV store
+func (s *timestampKVStore) Stop(ctx context.Context) error {
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record
+func (s *timestampKVStore) Put(namespace string, key, value []byte) error {
+	return s.kvStore.Put(namespace, key, s.encode(namespace, value, s.stamp()))
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (s *timestampKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	return s.kvStore.PutIfNotExists(namespace, key, s.encode(namespace, value, s.stamp()))
+}
+
+// Get retrieves a record without its timestamp
+func (s *timestampKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	value, _, err := s.GetWithTimestamp(namespace, key)
+	return value, err
+}
+
+// GetWithTimestamp retrieves a record and the time it is written at. The time is zero for a namespace which is not
+// timestamped
+func (s *timestampKVStore) GetWithTimestamp(namespace string, key []byte) ([]byte, time.Time, error) {
+	stored, err := s.kvStore.Get(namespace, key)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if _, ok := s.namespaces[namespace]; !ok {
+		return stored, time.Time{}, nil
+	}
+	if len(stored) < timestampSize {
+		return nil, time.Time{}, errors.Wrapf(ErrInvalidDB, "value of key = %x has no timestamp", key)
+	}
+	ts := time.Unix(0, int64(binary.BigEndian.Uint64(stored[:timestampSize])))
+	return stored[timestampSize:], ts, nil
+}
+
+// Delete deletes a record
+func (s *timestampKVStore) Delete(namespace string, key []byte) error {
+	return s.kvStore.Delete(namespace, key)
+}
+
+// Commit commits the batch with the values of the timestamped namespaces stamped, all with the same timestamp
+func (s *timestampKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	ts := s.stamp()
+	entries := make([]writeInfo, b.Size())
+	for i := range entries {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		if write.writeType == AddCounter {
+			return errors.Wrap(ErrInvalidDB, "counters are not supported by the timestamped KV store")
+		}
+		entries[i] = *write
+		if write.writeType != Delete {
+			entries[i].value = s.encode(write.namespace, write.value, ts)
+		}
+	}
+	if err := s.kvStore.Commit(newBatchOf(entries)); err != nil {
+		return err
+	}
+	succeed = true
+	return nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// underlying returns the KV store wrapped
+func (s *timestampKVStore) underlying() KVStore { return s.kvStore }
+
+// stamp returns the current time in nanoseconds, or one more than the last timestamp if the clock is not ahead of it
+func (s *timestampKVStore) stamp() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ts := s.clk.Now().UnixNano()
+	if ts <= s.last {
+		ts = s.last + 1
+	}
+	s.last = ts
+	return ts
+}
+
+// encode returns the value prefixed with the timestamp if the namespace is timestamped
+func (s *timestampKVStore) encode(namespace string, value []byte, ts int64) []byte {
+	if _, ok := s.namespaces[namespace]; !ok {
+		return value
+	}
+	stored := make([]byte, timestampSize, timestampSize+len(value))
+	binary.BigEndian.PutUint64(stored, uint64(ts))
+	return append(stored, value...)
+}
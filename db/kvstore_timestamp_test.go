@@ -0,0 +1,106 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestTimestampKVStore(t *testing.T) {
+	testTimestamp := func(kvStore KVStore, clk *clock.Mock, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		getter, ok := kvStore.(TimestampGetter)
+		require.True(ok)
+
+		// the timestamp round-trips, and Get returns the value without it
+		clk.Add(time.Hour)
+		t1 := clk.Now()
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		value, err := kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+		value, ts, err := getter.GetWithTimestamp(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+		require.True(t1.Equal(ts))
+
+		// the entries of a batch are stamped with the same timestamp
+		clk.Add(time.Minute)
+		t2 := clk.Now()
+		batch := NewBatch()
+		batch.Put(bucket1, testK1[1], testV1[1], "")
+		require.NoError(batch.PutIfNotExists(bucket1, testK1[2], testV1[2], ""))
+		batch.Put(bucket2, testK2[0], testV2[0], "")
+		require.NoError(kvStore.Commit(batch))
+		require.Equal(0, batch.Size())
+		for i := 1; i < 3; i++ {
+			value, ts, err = getter.GetWithTimestamp(bucket1, testK1[i])
+			require.NoError(err)
+			require.Equal(testV1[i], value)
+			require.True(t2.Equal(ts))
+		}
+		require.Equal(ErrAlreadyExist, errors.Cause(kvStore.PutIfNotExists(bucket1, testK1[0], testV1[1])))
+
+		// a namespace not timestamped keeps the values as is
+		value, ts, err = getter.GetWithTimestamp(bucket2, testK2[0])
+		require.NoError(err)
+		require.Equal(testV2[0], value)
+		require.True(ts.IsZero())
+
+		// the timestamps keep increasing while the clock stands still or goes back
+		clk.Add(-time.Hour)
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[1]))
+		value, ts, err = getter.GetWithTimestamp(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[1], value)
+		require.True(ts.After(t2))
+
+		require.NoError(kvStore.Delete(bucket1, testK1[0]))
+		_, _, err = getter.GetWithTimestamp(bucket1, testK1[0])
+		require.Equal(ErrNotExist, errors.Cause(err))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		clk := clock.NewMock()
+		testTimestamp(NewMemKVStore(WithTimestamps(bucket1), WithClock(clk)), clk, t)
+	})
+
+	dbCfg := cfg
+	path := "test-timestamp.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		clk := clock.NewMock()
+		testTimestamp(NewOnDiskDB(dbCfg, WithTimestamps(bucket1), WithClock(clk)), clk, t)
+	})
+
+	path = "test-timestamp.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		clk := clock.NewMock()
+		testTimestamp(NewOnDiskDB(dbCfg, WithTimestamps(bucket1), WithClock(clk)), clk, t)
+	})
+}
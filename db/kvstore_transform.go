@@ -0,0 +1,135 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// TransformFunc transforms the value of the record of (namespace, key), e.g. to migrate a legacy format or to
+	// redact a field
+	TransformFunc func(namespace string, key, value []byte) ([]byte, error)
+
+	// transformKVStore is a KV store transforming the values written and read
+	transformKVStore struct {
+		kvStore KVStore
+		onWrite TransformFunc
+		onRead  TransformFunc
+	}
+)
+
+// NewTransformKVStore wraps the KV store to transform each value by onWrite before it is written, and by onRead after
+// it is read, either of which may be nil. onWrite runs on the values of Put, PutIfNotExists and the Put and
+// PutIfNotExists entries of a batch, but not on the deltas of AddCounter, of which the KV store keeps the sum. An
+// error of a hook aborts the operation, so a batch with an entry failing onWrite is not committed at all. The hooks
+// must not modify the value given, but return a new one instead
+func NewTransformKVStore(kvStore KVStore, onWrite, onRead TransformFunc) KVStore {
+	return &transformKVStore{kvStore: kvStore, onWrite: onWrite, onRead: onRead}
+}
+
+// Start starts the underlying KV store
+func (s *transformKVStore) Start(ctx context.Context) error {
+	return s.kvStore.Start(ctx)
+}
+
+// Stop stops the underlying KV store
+func (s *transformKVStore) Stop(ctx context.Context) error {
+	return s.kvStore.Stop(ctx)
+}
+
+// Put inserts a <key, value> record of the value transformed by onWrite
+func (s *transformKVStore) Put(namespace string, key, value []byte) error {
+	value, err := s.write(namespace, key, value)
+	if err != nil {
+		return err
+	}
+	return s.kvStore.Put(namespace, key, value)
+}
+
+// PutIfNotExists inserts a <key, value> record of the value transformed by onWrite only if it does not exist yet,
+// otherwise return ErrAlreadyExist
+func (s *transformKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	value, err := s.write(namespace, key, value)
+	if err != nil {
+		return err
+	}
+	return s.kvStore.PutIfNotExists(namespace, key, value)
+}
+
+// Get retrieves a record, and returns its value transformed by onRead
+func (s *transformKVStore) Get(namespace string, key []byte) ([]byte, error) {
+	value, err := s.kvStore.Get(namespace, key)
+	if err != nil || s.onRead == nil {
+		return value, err
+	}
+	value, err = s.onRead(namespace, key, value)
+	if err != nil {
+		return nil, kvError("Get", namespace, key, errors.Wrap(err, "read is aborted by read hook"))
+	}
+	return value, nil
+}
+
+// Delete deletes a record
+func (s *transformKVStore) Delete(namespace string, key []byte) error {
+	return s.kvStore.Delete(namespace, key)
+}
+
+// Commit commits the batch with the values of its entries transformed by onWrite
+func (s *transformKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	entries := make([]writeInfo, b.Size())
+	for i := range entries {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		entries[i] = *write
+		if write.writeType != Put && write.writeType != PutIfNotExists {
+			continue
+		}
+		if entries[i].value, err = s.write(write.namespace, write.key, write.value); err != nil {
+			return err
+		}
+	}
+	if err := s.kvStore.Commit(newBatchOf(entries)); err != nil {
+		return err
+	}
+	succeed = true
+	return nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// write returns the value transformed by onWrite
+func (s *transformKVStore) write(namespace string, key, value []byte) ([]byte, error) {
+	if s.onWrite == nil {
+		return value, nil
+	}
+	value, err := s.onWrite(namespace, key, value)
+	if err != nil {
+		return nil, kvError("Put", namespace, key, errors.Wrap(err, "write is aborted by write hook"))
+	}
+	return value, nil
+}
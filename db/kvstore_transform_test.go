@@ -0,0 +1,111 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestTransformKVStore(t *testing.T) {
+	// the values are stamped with a version byte, while legacy values are hex encoded without one
+	const version = 2
+	errReadOnly := errors.New("namespace is read only")
+	stamp := func(namespace string, key, value []byte) ([]byte, error) {
+		if namespace == bucket2 {
+			return nil, errReadOnly
+		}
+		return append([]byte{version}, value...), nil
+	}
+	upgrade := func(namespace string, key, value []byte) ([]byte, error) {
+		if len(value) > 0 && value[0] == version {
+			return value[1:], nil
+		}
+		return hex.DecodeString(string(value))
+	}
+
+	testTransform := func(raw KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		kvStore := NewTransformKVStore(raw, stamp, upgrade)
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+
+		// the values written are stamped, and read back as written
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		require.NoError(kvStore.PutIfNotExists(bucket1, testK1[1], testV1[1]))
+		batch := NewBatch()
+		require.NoError(batch.Put(bucket1, testK1[2], testV1[2], ""))
+		require.NoError(batch.Delete(bucket1, testK1[0], ""))
+		require.NoError(kvStore.Commit(batch))
+		require.Equal(0, batch.Size())
+		for i := 1; i < 3; i++ {
+			value, err := kvStore.Get(bucket1, testK1[i])
+			require.NoError(err)
+			require.Equal(testV1[i], value)
+			stored, err := raw.Get(bucket1, testK1[i])
+			require.NoError(err)
+			require.Equal(append([]byte{version}, testV1[i]...), stored)
+		}
+		_, err := kvStore.Get(bucket1, testK1[0])
+		require.Error(err)
+
+		// a legacy value is upgraded as it is read
+		require.NoError(raw.Put(bucket1, testK2[0], []byte(hex.EncodeToString(testV2[0]))))
+		value, err := kvStore.Get(bucket1, testK2[0])
+		require.NoError(err)
+		require.Equal(testV2[0], value)
+
+		// a value the read hook fails on is not returned
+		require.NoError(raw.Put(bucket1, testK2[1], []byte("not hex")))
+		value, err = kvStore.Get(bucket1, testK2[1])
+		require.Error(err)
+		require.Nil(value)
+
+		// a write the write hook fails on is aborted, and so is the whole batch of it
+		require.Equal(errReadOnly, errors.Cause(kvStore.Put(bucket2, testK2[2], testV2[2])))
+		batch = NewBatch()
+		require.NoError(batch.Put(bucket1, testK2[2], testV2[2], ""))
+		require.NoError(batch.Put(bucket2, testK2[2], testV2[2], ""))
+		require.Equal(errReadOnly, errors.Cause(kvStore.Commit(batch)))
+		require.Equal(2, batch.Size())
+		_, err = raw.Get(bucket1, testK2[2])
+		require.Error(err)
+		_, err = raw.Get(bucket2, testK2[2])
+		require.Error(err)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testTransform(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-transform.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testTransform(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-transform.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testTransform(NewOnDiskDB(dbCfg), t)
+	})
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+type (
+	// LSMStatsReporter is the interface of KV store which reports the shape of its LSM tree, e.g. to watch the write
+	// amplification of its compactions
+	LSMStatsReporter interface {
+		// LSMStats returns the statistics of the LSM tree
+		LSMStats() (LSMStats, error)
+	}
+
+	// LSMStats is the statistics of an LSM tree
+	LSMStats struct {
+		// Levels is the statistics of each level, from level 0 down to the deepest level holding a table
+		Levels []LSMLevelStats
+		// LSMSize is the size of the tables, and VlogSize the size of the value logs, both as last refreshed by the
+		// KV store, which BadgerDB does every minute
+		LSMSize  int64
+		VlogSize int64
+	}
+
+	// LSMLevelStats is the statistics of a level of an LSM tree
+	LSMLevelStats struct {
+		// Level is the number of the level, 0 being the level the memtables are flushed to
+		Level int
+		// Tables is the number of tables of the level
+		Tables int
+	}
+)
+
+// LSMStats returns the number of tables at each level of BadgerDB and the sizes it keeps track of. Many tables at
+// level 0 mean the compactions fall behind the writes, and BadgerDB stalls the writes once there are too many
+func (b *badgerDB) LSMStats() (LSMStats, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return LSMStats{}, ErrDBClosed
+	}
+
+	var stats LSMStats
+	for _, table := range b.db.Tables() {
+		for len(stats.Levels) <= table.Level {
+			stats.Levels = append(stats.Levels, LSMLevelStats{Level: len(stats.Levels)})
+		}
+		stats.Levels[table.Level].Tables++
+	}
+	stats.LSMSize, stats.VlogSize = b.db.Size()
+	return stats, nil
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestLSMStats(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	path := "test-lsm-stats.badger"
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+	dbCfg := cfg
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	kvStore := NewOnDiskDB(dbCfg)
+	reporter := kvStore.(LSMStatsReporter)
+	_, err := reporter.LSMStats()
+	require.Equal(ErrDBClosed, err)
+
+	// a new DB has no table
+	require.NoError(kvStore.Start(ctx))
+	stats, err := reporter.LSMStats()
+	require.NoError(err)
+	require.Empty(stats.Levels)
+
+	// the memtable is flushed to a table on stop, which BadgerDB compacts down from level 0, and its size is counted on
+	// start
+	batch := NewBatch()
+	for i := 0; i < 1000; i++ {
+		require.NoError(batch.Put(bucket1, []byte(fmt.Sprintf("key-%d", i)), testV1[i%3], ""))
+	}
+	require.NoError(kvStore.Commit(batch))
+	require.NoError(kvStore.Stop(ctx))
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	stats, err = reporter.LSMStats()
+	require.NoError(err)
+	require.NotEmpty(stats.Levels)
+	tables := 0
+	for i, level := range stats.Levels {
+		require.Equal(i, level.Level)
+		tables += level.Tables
+	}
+	require.Equal(1, tables)
+	require.True(stats.LSMSize > 0)
+	require.True(stats.VlogSize > 0)
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/pkg/hash"
+)
+
+// merklePageSize is the number of keys read at a time while building a Merkle tree
+const merklePageSize = 256
+
+const (
+	// merkleLeafPrefix and merkleNodePrefix tell leaves and inner nodes apart, so a leaf never hashes like a node
+	merkleLeafPrefix = 0
+	merkleNodePrefix = 1
+)
+
+// Proof is an inclusion proof of a record in the Merkle tree of a namespace
+type Proof struct {
+	// Index is the position of the record in key order
+	Index uint64
+	// Size is the number of records of the namespace
+	Size uint64
+	// Siblings is the roots of the sibling subtrees on the path from the leaf of the record up to the root
+	Siblings [][]byte
+}
+
+// MerkleRoot returns the root of the Merkle tree over the records of the namespace in key order, which is the same for
+// the same records whichever backend keeps them. The KV store must implement KeyPager.
+//
+// Each leaf is the hash of 0x00 || uvarint(len(key)) || key || value, and each inner node is the hash of
+// 0x01 || left || right. The tree of n > 1 leaves has the first k leaves on the left, k being the largest power of 2
+// less than n, and the rest on the right, as the Merkle tree of RFC 6962. The root of an empty namespace is the hash
+// of nothing. The records are read page by page, and only O(log n) hashes are held in memory
+func MerkleRoot(kvStore KVStore, namespace string) ([]byte, error) {
+	// subtrees is the roots of the complete subtrees of the leaves so far, of decreasing heights
+	var subtrees [][]byte
+	var heights []int
+	if err := forEachMerkleLeaf(kvStore, namespace, func(_ []byte, leaf []byte) error {
+		subtrees, heights = append(subtrees, leaf), append(heights, 0)
+		for n := len(heights); n > 1 && heights[n-2] == heights[n-1]; n = len(heights) {
+			subtrees = append(subtrees[:n-2], merkleNodeHash(subtrees[n-2], subtrees[n-1]))
+			heights = append(heights[:n-2], heights[n-2]+1)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if len(subtrees) == 0 {
+		return hash.Hash256b(nil), nil
+	}
+	root := subtrees[len(subtrees)-1]
+	for i := len(subtrees) - 2; i >= 0; i-- {
+		root = merkleNodeHash(subtrees[i], root)
+	}
+	return root, nil
+}
+
+// MerkleProof returns the inclusion proof of the record of the key in the Merkle tree of the namespace, or
+// ErrNotExist if the key does not exist. The KV store must implement KeyPager. The hashes of all leaves are held in
+// memory while building the proof
+func MerkleProof(kvStore KVStore, namespace string, key []byte) (Proof, error) {
+	var leaves [][]byte
+	index := -1
+	if err := forEachMerkleLeaf(kvStore, namespace, func(k []byte, leaf []byte) error {
+		if bytes.Equal(k, key) {
+			index = len(leaves)
+		}
+		leaves = append(leaves, leaf)
+		return nil
+	}); err != nil {
+		return Proof{}, err
+	}
+	if index < 0 {
+		return Proof{}, errors.Wrapf(ErrNotExist, "key = %x", key)
+	}
+	return Proof{Index: uint64(index), Size: uint64(len(leaves)), Siblings: merklePath(index, leaves)}, nil
+}
+
+// Verify returns whether the proof proves the <key, value> record is in the Merkle tree of the root
+func (p Proof) Verify(root, key, value []byte) bool {
+	if p.Index >= p.Size {
+		return false
+	}
+	// walk up from the leaf as the verification of RFC 9162 section 2.1.3.2
+	fn, sn := p.Index, p.Size-1
+	r := merkleLeafHash(key, value)
+	for _, sibling := range p.Siblings {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = merkleNodeHash(sibling, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = merkleNodeHash(r, sibling)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(r, root)
+}
+
+//======================================
+// private functions
+//======================================
+
+// forEachMerkleLeaf calls fn on the key and the leaf hash of each record of the namespace in key order
+func forEachMerkleLeaf(kvStore KVStore, namespace string, fn func([]byte, []byte) error) error {
+	pager, ok := kvStore.(KeyPager)
+	if !ok {
+		return errors.Wrap(ErrInvalidDB, "KV store is unable to list keys in order")
+	}
+	var after []byte
+	for {
+		keys, cursor, err := pager.KeysPaged(namespace, after, merklePageSize)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			value, err := kvStore.Get(namespace, key)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get key = %x", key)
+			}
+			if err := fn(key, merkleLeafHash(key, value)); err != nil {
+				return err
+			}
+		}
+		if cursor == nil {
+			return nil
+		}
+		after = cursor
+	}
+}
+
+// merklePath returns the roots of the sibling subtrees of the leaf at index, from the leaf up
+func merklePath(index int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := merkleSplit(len(leaves))
+	if index < k {
+		return append(merklePath(index, leaves[:k]), merkleTreeHash(leaves[k:]))
+	}
+	return append(merklePath(index-k, leaves[k:]), merkleTreeHash(leaves[:k]))
+}
+
+// merkleTreeHash returns the root of the Merkle tree of the leaves, which must not be empty
+func merkleTreeHash(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := merkleSplit(len(leaves))
+	return merkleNodeHash(merkleTreeHash(leaves[:k]), merkleTreeHash(leaves[k:]))
+}
+
+// merkleSplit returns the largest power of 2 less than n, which must be greater than 1
+func merkleSplit(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// merkleLeafHash returns the hash of the leaf of the record
+func merkleLeafHash(key, value []byte) []byte {
+	n := make([]byte, binary.MaxVarintLen64)
+	data := make([]byte, 0, 1+len(n)+len(key)+len(value))
+	data = append(data, merkleLeafPrefix)
+	data = append(data, n[:binary.PutUvarint(n, uint64(len(key)))]...)
+	data = append(append(data, key...), value...)
+	return hash.Hash256b(data)
+}
+
+// merkleNodeHash returns the hash of the inner node of the two subtrees
+func merkleNodeHash(left, right []byte) []byte {
+	data := make([]byte, 0, 1+len(left)+len(right))
+	data = append(append(append(data, merkleNodePrefix), left...), right...)
+	return hash.Hash256b(data)
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/pkg/hash"
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestMerkleRoot(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	dbCfg := cfg
+	boltPath := "test-merkle.bolt"
+	badgerPath := "test-merkle.badger"
+	testutil.CleanupPath(t, boltPath)
+	testutil.CleanupPath(t, badgerPath)
+	defer testutil.CleanupPath(t, boltPath)
+	defer testutil.CleanupPath(t, badgerPath)
+	dbCfg.DbPath = boltPath
+	dbCfg.UseBadgerDB = false
+	boltStore := NewOnDiskDB(dbCfg)
+	dbCfg.DbPath = badgerPath
+	dbCfg.UseBadgerDB = true
+	badgerStore := NewOnDiskDB(dbCfg)
+	kvStores := []KVStore{NewMemKVStore(), boltStore, badgerStore}
+	for _, kvStore := range kvStores {
+		require.NoError(kvStore.Start(ctx))
+		defer func(kvStore KVStore) {
+			require.NoError(kvStore.Stop(ctx))
+		}(kvStore)
+	}
+
+	// the root of an empty namespace
+	for _, kvStore := range kvStores {
+		root, err := MerkleRoot(kvStore, bucket1)
+		require.NoError(err)
+		require.Equal(hash.Hash256b(nil), root)
+	}
+
+	// trees of every shape up to a few levels, including the empty value and more keys than a page. The namespaces are
+	// not prefixes of one another, which BadgerDB would list together
+	namespace := 0
+	for _, n := range []int{1, 2, 3, 4, 5, 7, 8, 9, 17, 300} {
+		namespace++
+		ns := fmt.Sprintf("merkle_%02d", namespace)
+		var roots [][]byte
+		for _, kvStore := range kvStores {
+			batch := NewBatch()
+			// put in reverse order, the tree is built in key order regardless
+			for i := n - 1; i >= 0; i-- {
+				batch.Put(ns, []byte(fmt.Sprintf("key_%03d", i)), []byte(fmt.Sprintf("value_%d", i)), "")
+			}
+			batch.Put(ns, []byte("key_empty"), []byte{}, "")
+			require.NoError(kvStore.Commit(batch))
+			root, err := MerkleRoot(kvStore, ns)
+			require.NoError(err)
+			roots = append(roots, root)
+		}
+		// all backends agree
+		require.Equal(roots[0], roots[1], "%d records", n)
+		require.Equal(roots[0], roots[2], "%d records", n)
+		root := roots[0]
+
+		for _, kvStore := range kvStores {
+			for i := 0; i < n; i++ {
+				key := []byte(fmt.Sprintf("key_%03d", i))
+				value := []byte(fmt.Sprintf("value_%d", i))
+				proof, err := MerkleProof(kvStore, ns, key)
+				require.NoError(err)
+				require.Equal(uint64(i), proof.Index)
+				require.Equal(uint64(n+1), proof.Size)
+				require.True(proof.Verify(root, key, value), "key %d of %d", i, n)
+				// the proof does not verify another record or another root
+				require.False(proof.Verify(root, key, []byte("forged")))
+				require.False(proof.Verify(root, []byte("key_999"), value))
+				require.False(proof.Verify(hash.Hash256b([]byte("other")), key, value))
+				forged := proof
+				forged.Index = (proof.Index + 1) % proof.Size
+				require.False(forged.Verify(root, key, value))
+			}
+			proof, err := MerkleProof(kvStore, ns, []byte("key_empty"))
+			require.NoError(err)
+			require.True(proof.Verify(root, []byte("key_empty"), []byte{}))
+
+			// there is no proof of an absent key
+			_, err = MerkleProof(kvStore, ns, []byte("key_999"))
+			require.Equal(ErrNotExist, errors.Cause(err))
+		}
+	}
+
+	// the tree of 3 records has the first 2 on the left
+	leaves := make([][]byte, 0, 3)
+	for _, kv := range [][2]string{{"key_000", "value_0"}, {"key_001", "value_1"}, {"key_empty", ""}} {
+		leaves = append(leaves, merkleLeafHash([]byte(kv[0]), []byte(kv[1])))
+	}
+	root, err := MerkleRoot(kvStores[0], "merkle_02")
+	require.NoError(err)
+	require.Equal(merkleNodeHash(merkleNodeHash(leaves[0], leaves[1]), leaves[2]), root)
+
+	// the root changes with any record
+	root, err = MerkleRoot(kvStores[0], "merkle_05")
+	require.NoError(err)
+	require.NoError(kvStores[0].Put("merkle_05", []byte("key_003"), []byte("value_x")))
+	changed, err := MerkleRoot(kvStores[0], "merkle_05")
+	require.NoError(err)
+	require.NotEqual(root, changed)
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+// ModifyFunc computes the new value of a record from its current value, old being nil if the record does not exist.
+// old is a copy, which fn may modify or return as the new value. It returns the value to put, or true to delete the
+// record instead, or an error to leave the record as it is
+type ModifyFunc func(old []byte, existed bool) (value []byte, del bool, err error)
+
+// Modifier is the interface of KV store which is able to read, modify and write a record atomically, e.g. to append
+// to a list value or update a field of an encoded struct, with no write in between lost as in a Get followed by a Put
+type Modifier interface {
+	// Modify reads the record of (namespace, key), calls fn with its value, and writes the value fn returns, or deletes
+	// the record if fn says so, all within one read-write transaction. An error of fn aborts the transaction without
+	// writing anything, and Modify returns it. As with Updater, fn must not use the KV store, or it deadlocks
+	Modify(string, []byte, ModifyFunc) error
+}
+
+// Modify modifies the record within a read-write transaction of BoltDB
+func (b *boltDB) Modify(namespace string, key []byte, fn ModifyFunc) error {
+	return modify(b, namespace, key, fn)
+}
+
+// Modify modifies the record within a read-write transaction of BadgerDB
+func (b *badgerDB) Modify(namespace string, key []byte, fn ModifyFunc) error {
+	return modify(b, namespace, key, fn)
+}
+
+// Modify modifies the record with all shards of the in-memory KV store locked
+func (m *memKVStore) Modify(namespace string, key []byte, fn ModifyFunc) error {
+	return modify(m, namespace, key, fn)
+}
+
+//======================================
+// private functions
+//======================================
+
+// modify reads, modifies and writes the record within a transaction of the updater
+func modify(updater Updater, namespace string, key []byte, fn ModifyFunc) error {
+	return updater.Update(func(tx Tx) error {
+		old, err := tx.Get(namespace, key)
+		if err != nil && !isNotExist(err) {
+			return err
+		}
+		existed := err == nil
+		// the in-memory KV store reads its own copy of the value within the transaction
+		value, del, err := fn(copyBytes(old), existed)
+		if err != nil {
+			return err
+		}
+		if del {
+			if !existed {
+				return nil
+			}
+			return tx.Delete(namespace, key)
+		}
+		return tx.Put(namespace, key, value)
+	})
+}
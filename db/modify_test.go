@@ -0,0 +1,119 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestModify(t *testing.T) {
+	testModify := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		modifier := kvStore.(Modifier)
+		appendByte := func(b byte) ModifyFunc {
+			return func(old []byte, _ bool) ([]byte, bool, error) {
+				return append(old, b), false, nil
+			}
+		}
+
+		// create if absent
+		createIfAbsent := func(old []byte, existed bool) ([]byte, bool, error) {
+			if existed {
+				return old, false, nil
+			}
+			return testV1[0], false, nil
+		}
+		require.NoError(modifier.Modify(bucket1, testK1[0], createIfAbsent))
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[1]))
+		require.NoError(modifier.Modify(bucket1, testK1[0], createIfAbsent))
+		value, err := kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[1], value)
+
+		// append to the value
+		require.NoError(modifier.Modify(bucket1, testK1[1], appendByte('a')))
+		require.NoError(modifier.Modify(bucket1, testK1[1], appendByte('b')))
+		value, err = kvStore.Get(bucket1, testK1[1])
+		require.NoError(err)
+		require.Equal([]byte("ab"), value)
+
+		// conditional delete, of an absent record as well
+		deleteIf := func(expected []byte) ModifyFunc {
+			return func(old []byte, _ bool) ([]byte, bool, error) {
+				return old, bytes.Equal(old, expected), nil
+			}
+		}
+		require.NoError(modifier.Modify(bucket1, testK1[1], deleteIf([]byte("a"))))
+		_, err = kvStore.Get(bucket1, testK1[1])
+		require.NoError(err)
+		require.NoError(modifier.Modify(bucket1, testK1[1], deleteIf([]byte("ab"))))
+		_, err = kvStore.Get(bucket1, testK1[1])
+		require.True(isNotExist(err))
+		require.NoError(modifier.Modify(bucket1, testK1[1], deleteIf(nil)))
+		_, err = kvStore.Get(bucket1, testK1[1])
+		require.True(isNotExist(err))
+
+		// an error of fn writes nothing
+		require.Equal(ErrInvalidDB, errors.Cause(modifier.Modify(bucket1, testK1[0],
+			func([]byte, bool) ([]byte, bool, error) {
+				return testV1[2], false, ErrInvalidDB
+			})))
+		value, err = kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[1], value)
+
+		// concurrent modifiers lose no append
+		const numModifiers = 50
+		var wg sync.WaitGroup
+		wg.Add(numModifiers)
+		for i := 0; i < numModifiers; i++ {
+			go func() {
+				defer wg.Done()
+				require.NoError(modifier.Modify(bucket2, testK2[0], appendByte('x')))
+			}()
+		}
+		wg.Wait()
+		value, err = kvStore.Get(bucket2, testK2[0])
+		require.NoError(err)
+		require.Equal(bytes.Repeat([]byte("x"), numModifiers), value)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testModify(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-modify.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testModify(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-modify.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testModify(NewOnDiskDB(dbCfg), t)
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"github.com/pkg/errors"
+)
+
+type (
+	// MoveOption sets an option of EntryMover.MoveEntries
+	MoveOption func(*moveOptions)
+
+	// moveOptions is the collection of options of EntryMover.MoveEntries
+	moveOptions struct {
+		// skipMissing makes the keys not existing in the source skipped, rather than abort the move
+		skipMissing bool
+	}
+)
+
+// WithSkipMissing makes MoveEntries skip the keys which do not exist in the source namespace, and move the others
+func WithSkipMissing() MoveOption {
+	return func(opts *moveOptions) {
+		opts.skipMissing = true
+	}
+}
+
+// MoveEntries moves the records to another namespace in one transaction of BoltDB
+func (b *boltDB) MoveEntries(src, dst string, keys [][]byte, opts ...MoveOption) error {
+	return moveEntries(b, src, dst, keys, opts)
+}
+
+// MoveEntries moves the records to another namespace in one transaction of BadgerDB
+func (b *badgerDB) MoveEntries(src, dst string, keys [][]byte, opts ...MoveOption) error {
+	return moveEntries(b, src, dst, keys, opts)
+}
+
+// MoveEntries moves the records to another namespace in one transaction of the in-memory KV store
+func (m *memKVStore) MoveEntries(src, dst string, keys [][]byte, opts ...MoveOption) error {
+	return moveEntries(m, src, dst, keys, opts)
+}
+
+//======================================
+// private functions
+//======================================
+
+// moveEntries moves the records within a read-write transaction of the KV store
+func moveEntries(updater Updater, src, dst string, keys [][]byte, opts []MoveOption) error {
+	var options moveOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return updater.Update(func(tx Tx) error {
+		return moveEntriesInTx(tx, src, dst, keys, options)
+	})
+}
+
+// moveEntriesInTx copies the value of each key to the destination and deletes it from the source within the
+// transaction, which must be rolled back if it fails
+func moveEntriesInTx(tx Tx, src, dst string, keys [][]byte, options moveOptions) error {
+	moved := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if _, ok := moved[string(key)]; ok {
+			continue
+		}
+		moved[string(key)] = struct{}{}
+		value, err := tx.Get(src, key)
+		if isNotExist(err) {
+			if options.skipMissing {
+				continue
+			}
+			// the namespace of BoltDB may not exist as well
+			return errors.Wrapf(ErrNotExist, "key = %x of namespace %s to move does not exist", key, src)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to move key = %x of namespace %s", key, src)
+		}
+		// moving within a namespace leaves the record as it is
+		if src == dst {
+			continue
+		}
+		if err := tx.Put(dst, key, value); err != nil {
+			return errors.Wrapf(err, "failed to move key = %x to namespace %s", key, dst)
+		}
+		if err := tx.Delete(src, key); err != nil {
+			return errors.Wrapf(err, "failed to move key = %x of namespace %s", key, src)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+// failingTx is a transaction failing the Put after the given number of them
+type failingTx struct {
+	Tx
+	puts int
+}
+
+func (t *failingTx) Put(namespace string, key, value []byte) error {
+	if t.puts == 0 {
+		return errors.New("simulated failure")
+	}
+	t.puts--
+	return t.Tx.Put(namespace, key, value)
+}
+
+func TestMoveEntries(t *testing.T) {
+	testMoveEntries := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		mover, ok := kvStore.(EntryMover)
+		require.True(ok)
+		requireIn := func(namespace string, keys [][]byte, values [][]byte) {
+			for i, key := range keys {
+				value, err := kvStore.Get(namespace, key)
+				require.NoError(err)
+				require.Equal(values[i], value)
+			}
+		}
+		requireNotIn := func(namespace string, keys [][]byte) {
+			for _, key := range keys {
+				_, err := kvStore.Get(namespace, key)
+				require.True(isNotExist(err))
+			}
+		}
+		for i := 0; i < 3; i++ {
+			require.NoError(kvStore.Put(bucket1, testK1[i], testV1[i]))
+		}
+
+		// the records are moved, and a key given twice is moved once
+		require.NoError(mover.MoveEntries(bucket1, bucket2, [][]byte{testK1[0], testK1[1], testK1[0]}))
+		requireIn(bucket2, testK1[:2], testV1[:2])
+		requireNotIn(bucket1, testK1[:2])
+
+		// a missing source key aborts the whole move
+		err := mover.MoveEntries(bucket2, bucket1, [][]byte{testK1[0], testK1[2]})
+		require.Equal(ErrNotExist, errors.Cause(err))
+		requireIn(bucket2, testK1[:2], testV1[:2])
+		requireNotIn(bucket1, testK1[:2])
+		require.Equal(ErrNotExist, errors.Cause(mover.MoveEntries("notCreated", bucket1, testK1[:1])))
+
+		// unless it is skipped
+		require.NoError(mover.MoveEntries(bucket2, bucket1, [][]byte{testK1[2], testK1[0]}, WithSkipMissing()))
+		requireIn(bucket1, testK1[:1], testV1[:1])
+		requireIn(bucket1, testK1[2:3], testV1[2:3])
+		requireIn(bucket2, testK1[1:2], testV1[1:2])
+		requireNotIn(bucket2, [][]byte{testK1[0]})
+
+		// moving within a namespace leaves the records as they are
+		require.NoError(mover.MoveEntries(bucket1, bucket1, testK1[:1]))
+		requireIn(bucket1, testK1[:1], testV1[:1])
+
+		// a failure in the middle of the move rolls back the records moved before it
+		err = kvStore.(Updater).Update(func(tx Tx) error {
+			return moveEntriesInTx(&failingTx{Tx: tx, puts: 1}, bucket1, bucket2, [][]byte{testK1[0], testK1[2]},
+				moveOptions{})
+		})
+		require.EqualError(errors.Cause(err), "simulated failure")
+		requireIn(bucket1, [][]byte{testK1[0], testK1[2]}, [][]byte{testV1[0], testV1[2]})
+		requireNotIn(bucket2, [][]byte{testK1[0], testK1[2]})
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testMoveEntries(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-move-entries.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testMoveEntries(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-move-entries.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testMoveEntries(NewOnDiskDB(dbCfg), t)
+	})
+}
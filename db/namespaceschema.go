@@ -0,0 +1,118 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// namespaceSchemaNamespace is the namespace keeping the schema version of each namespace created with one, keyed by
+// the name of the namespace
+const namespaceSchemaNamespace = "namespaceSchemas"
+
+// NamespaceSchemaCreator is the interface of KV store which is able to create a namespace along with its schema
+// version and initial records at once, e.g. for a subsystem to bootstrap its namespace and detect a double
+// initialization
+type NamespaceSchemaCreator interface {
+	// CreateNamespaceWithSchema creates the namespace in one transaction: it checks that the namespace has neither a
+	// schema version nor a record, records the version in the reserved namespace "namespaceSchemas", and puts the
+	// initial records into the namespace. It returns ErrAlreadyExist and writes nothing if the namespace exists
+	// already. A namespace created before with no record and no version, e.g. by NamespaceManager, is taken as absent
+	CreateNamespaceWithSchema(string, uint32, []KeyValue) error
+	// NamespaceSchemaVersion returns the schema version the namespace is created with, 0 if none is recorded
+	NamespaceSchemaVersion(string) (uint32, error)
+}
+
+// CreateNamespaceWithSchema creates the namespace in one transaction of BoltDB
+func (b *boltDB) CreateNamespaceWithSchema(namespace string, version uint32, initial []KeyValue) error {
+	return createNamespaceWithSchema(b, b.options, namespace, version, initial)
+}
+
+// NamespaceSchemaVersion returns the schema version of the namespace recorded in BoltDB
+func (b *boltDB) NamespaceSchemaVersion(namespace string) (uint32, error) {
+	return namespaceSchemaVersion(b, namespace)
+}
+
+// CreateNamespaceWithSchema creates the namespace in one transaction of BadgerDB
+func (b *badgerDB) CreateNamespaceWithSchema(namespace string, version uint32, initial []KeyValue) error {
+	return createNamespaceWithSchema(b, b.options, namespace, version, initial)
+}
+
+// NamespaceSchemaVersion returns the schema version of the namespace recorded in BadgerDB
+func (b *badgerDB) NamespaceSchemaVersion(namespace string) (uint32, error) {
+	return namespaceSchemaVersion(b, namespace)
+}
+
+// CreateNamespaceWithSchema creates the namespace with all shards of the in-memory KV store locked
+func (m *memKVStore) CreateNamespaceWithSchema(namespace string, version uint32, initial []KeyValue) error {
+	return createNamespaceWithSchema(m, m.options, namespace, version, initial)
+}
+
+// NamespaceSchemaVersion returns the schema version of the namespace recorded in the in-memory KV store
+func (m *memKVStore) NamespaceSchemaVersion(namespace string) (uint32, error) {
+	return namespaceSchemaVersion(m, namespace)
+}
+
+//======================================
+// private functions
+//======================================
+
+// createNamespaceWithSchema checks the namespace is absent and writes its schema version and initial records within a
+// read-write transaction of the KV store. In explicit namespace mode, the namespaces are created ahead of the
+// transaction, which leaves them empty if it fails, so that they are still taken as absent
+func createNamespaceWithSchema(kvStore KVStore, options kvStoreOptions, namespace string, version uint32,
+	initial []KeyValue) error {
+	if manager, ok := kvStore.(NamespaceManager); ok && options.explicitNamespaces {
+		for _, ns := range []string{namespaceSchemaNamespace, namespace} {
+			if err := manager.CreateNamespace(ns); err != nil {
+				return err
+			}
+		}
+	}
+	value := make([]byte, 4)
+	binary.BigEndian.PutUint32(value, version)
+	err := kvStore.(Updater).Update(func(tx Tx) error {
+		exists, err := tx.Has(namespaceSchemaNamespace, []byte(namespace))
+		if err != nil {
+			return err
+		}
+		if exists {
+			return errors.Wrapf(ErrAlreadyExist, "namespace %s has a schema version", namespace)
+		}
+		empty, err := tx.(emptyChecker).isNamespaceEmpty(namespace)
+		if err != nil {
+			return err
+		}
+		if !empty {
+			return errors.Wrapf(ErrAlreadyExist, "namespace %s has records", namespace)
+		}
+		if err := tx.Put(namespaceSchemaNamespace, []byte(namespace), value); err != nil {
+			return err
+		}
+		for _, kv := range initial {
+			if err := tx.Put(namespace, kv.Key, kv.Value); err != nil {
+				return errors.Wrapf(err, "failed to put initial key = %x", kv.Key)
+			}
+		}
+		return nil
+	})
+	return errors.Wrapf(err, "failed to create namespace %s", namespace)
+}
+
+// namespaceSchemaVersion reads the schema version of the namespace, 0 if none is recorded
+func namespaceSchemaVersion(kvStore KVStore, namespace string) (uint32, error) {
+	value, err := kvStore.Get(namespaceSchemaNamespace, []byte(namespace))
+	if isNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get schema version of namespace %s", namespace)
+	}
+	return decodeSchemaVersion(value)
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestCreateNamespaceWithSchema(t *testing.T) {
+	testCreate := func(newKVStore func(...KVStoreOption) KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		kvStore := newKVStore(WithExplicitNamespaces())
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		creator := kvStore.(NamespaceSchemaCreator)
+		initial := []KeyValue{{Key: testK1[0], Value: testV1[0]}, {Key: testK1[1], Value: testV1[1]}}
+
+		// first-time creation records the version along with the initial records
+		version, err := creator.NamespaceSchemaVersion(bucket1)
+		require.NoError(err)
+		require.Equal(uint32(0), version)
+		require.NoError(creator.CreateNamespaceWithSchema(bucket1, 3, initial))
+		version, err = creator.NamespaceSchemaVersion(bucket1)
+		require.NoError(err)
+		require.Equal(uint32(3), version)
+		for _, kv := range initial {
+			value, err := kvStore.Get(bucket1, kv.Key)
+			require.NoError(err)
+			require.Equal(kv.Value, value)
+		}
+
+		// a second creation is rejected and writes nothing
+		err = creator.CreateNamespaceWithSchema(bucket1, 4, []KeyValue{{Key: testK1[2], Value: testV1[2]}})
+		require.Equal(ErrAlreadyExist, errors.Cause(err))
+		version, err = creator.NamespaceSchemaVersion(bucket1)
+		require.NoError(err)
+		require.Equal(uint32(3), version)
+		_, err = kvStore.Get(bucket1, testK1[2])
+		require.True(isNotExist(err))
+
+		// so is the creation of a namespace with records but no version
+		require.NoError(kvStore.(NamespaceManager).CreateNamespace(bucket2))
+		require.NoError(kvStore.Put(bucket2, testK2[0], testV2[0]))
+		err = creator.CreateNamespaceWithSchema(bucket2, 1, nil)
+		require.Equal(ErrAlreadyExist, errors.Cause(err))
+		version, err = creator.NamespaceSchemaVersion(bucket2)
+		require.NoError(err)
+		require.Equal(uint32(0), version)
+
+		// of concurrent creators, exactly one creates the namespace, with all of its initial records
+		const numCreators = 10
+		var (
+			wg      sync.WaitGroup
+			mutex   sync.Mutex
+			created []int
+		)
+		wg.Add(numCreators)
+		for i := 0; i < numCreators; i++ {
+			go func(i int) {
+				defer wg.Done()
+				records := []KeyValue{{Key: testK2[1], Value: []byte{byte(i)}}, {Key: testK2[2], Value: []byte{byte(i)}}}
+				err := creator.CreateNamespaceWithSchema("concurrent", uint32(i+1), records)
+				if err != nil {
+					require.Equal(ErrAlreadyExist, errors.Cause(err))
+					return
+				}
+				mutex.Lock()
+				defer mutex.Unlock()
+				created = append(created, i)
+			}(i)
+		}
+		wg.Wait()
+		require.Len(created, 1)
+		version, err = creator.NamespaceSchemaVersion("concurrent")
+		require.NoError(err)
+		require.Equal(uint32(created[0]+1), version)
+		for _, key := range [][]byte{testK2[1], testK2[2]} {
+			value, err := kvStore.Get("concurrent", key)
+			require.NoError(err)
+			require.Equal([]byte{byte(created[0])}, value)
+		}
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testCreate(NewMemKVStore, t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-namespace-schema.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testCreate(func(opts ...KVStoreOption) KVStore { return NewOnDiskDB(dbCfg, opts...) }, t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-namespace-schema.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testCreate(func(opts ...KVStoreOption) KVStore { return NewOnDiskDB(dbCfg, opts...) }, t)
+	})
+}
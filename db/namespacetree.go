@@ -0,0 +1,164 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// NamespaceSeparator separates the elements of the path of a nested namespace, e.g. "accounts/balances" is nested in
+// "accounts"
+const NamespaceSeparator = "/"
+
+// NamespaceTreeManager is the interface of KV store which is able to manage nested namespaces as a tree, the subtree
+// of a namespace being itself and all namespaces whose path it prefixes, e.g. "accounts", "accounts/balances" and
+// "accounts/nonces" for "accounts" but not "accountsArchive". BadgerDB does not implement it, since a namespace is
+// only the prefix of its keys there, and the records of "accounts" whose keys start with the separator would be taken
+// for those of a namespace nested in it
+type NamespaceTreeManager interface {
+	// ListNamespaceTree returns the namespaces of the subtree of the namespace which exist, in name order
+	ListNamespaceTree(string) ([]string, error)
+	// DeleteNamespaceTree deletes the namespaces of the subtree of the namespace and all their records, in one
+	// transaction, leaving the other namespaces as they are
+	DeleteNamespaceTree(string) error
+}
+
+// NamespacePath returns the path of the namespace nested in the elements in order. An element must neither be empty
+// nor contain the separator, so that each path is the path of one nesting only
+func NamespacePath(elems ...string) (string, error) {
+	if len(elems) == 0 {
+		return "", errors.Wrap(ErrInvalidDB, "namespace path has no element")
+	}
+	for _, elem := range elems {
+		if elem == "" || strings.Contains(elem, NamespaceSeparator) {
+			return "", errors.Wrapf(ErrInvalidDB, "invalid element %q of namespace path", elem)
+		}
+	}
+	return strings.Join(elems, NamespaceSeparator), nil
+}
+
+// ListNamespaceTree returns the buckets of the subtree of the namespace
+func (b *boltDB) ListNamespaceTree(namespace string) ([]string, error) {
+	if err := checkNamespaceTree(namespace); err != nil {
+		return nil, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	var names []string
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		names, err = namespaceTreeBuckets(tx, namespace)
+		return err
+	})
+	return names, err
+}
+
+// DeleteNamespaceTree deletes the buckets of the subtree of the namespace in one transaction
+func (b *boltDB) DeleteNamespaceTree(namespace string) error {
+	if err := checkNamespaceTree(namespace); err != nil {
+		return err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		names, err := namespaceTreeBuckets(tx, namespace)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := tx.DeleteBucket([]byte(name)); err != nil {
+				return errors.Wrapf(err, "failed to delete bucket %s", name)
+			}
+		}
+		return nil
+	})
+}
+
+// ListNamespaceTree returns the namespaces of the subtree of the namespace
+func (m *memKVStore) ListNamespaceTree(namespace string) ([]string, error) {
+	if err := checkNamespaceTree(namespace); err != nil {
+		return nil, err
+	}
+	m.nsMutex.RLock()
+	defer m.nsMutex.RUnlock()
+
+	return m.namespaceTree(namespace), nil
+}
+
+// DeleteNamespaceTree deletes the namespaces of the subtree of the namespace while all shards are locked
+func (m *memKVStore) DeleteNamespaceTree(namespace string) error {
+	if err := checkNamespaceTree(namespace); err != nil {
+		return err
+	}
+	m.lockAll()
+	defer m.unlockAll()
+	m.nsMutex.Lock()
+	defer m.nsMutex.Unlock()
+
+	for _, name := range m.namespaceTree(namespace) {
+		for _, shard := range m.shards {
+			delete(shard.bucket, name)
+		}
+		delete(m.namespaces, name)
+	}
+	return nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// checkNamespaceTree rejects the namespace of a subtree which is empty, whose subtree would be every namespace
+func checkNamespaceTree(namespace string) error {
+	if namespace == "" {
+		return errors.Wrap(ErrInvalidDB, "namespace of subtree is empty")
+	}
+	return nil
+}
+
+// inNamespaceTree returns true if the name is the namespace or nested in it
+func inNamespaceTree(namespace, name string) bool {
+	return name == namespace || strings.HasPrefix(name, namespace+NamespaceSeparator)
+}
+
+// namespaceTreeBuckets returns the names of the buckets of the subtree of the namespace, in name order
+func namespaceTreeBuckets(tx *bolt.Tx, namespace string) ([]string, error) {
+	var names []string
+	err := tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+		if inNamespaceTree(namespace, string(name)) {
+			names = append(names, string(name))
+		}
+		return nil
+	})
+	return names, err
+}
+
+// namespaceTree returns the namespaces of the subtree of the namespace in name order, which nsMutex must be locked for
+func (m *memKVStore) namespaceTree(namespace string) []string {
+	var names []string
+	for name := range m.namespaces {
+		if inNamespaceTree(namespace, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
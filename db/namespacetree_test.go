@@ -0,0 +1,95 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestNamespacePath(t *testing.T) {
+	require := require.New(t)
+
+	path, err := NamespacePath("accounts", "balances")
+	require.NoError(err)
+	require.Equal("accounts/balances", path)
+	for _, elems := range [][]string{nil, {"accounts", ""}, {"accounts/balances"}} {
+		_, err := NamespacePath(elems...)
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+	}
+}
+
+func TestNamespaceTree(t *testing.T) {
+	testNamespaceTree := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		tree, ok := kvStore.(NamespaceTreeManager)
+		require.True(ok)
+
+		// "accountsArchive" and "accounts-old" share the prefix of the name, but are not nested in "accounts"
+		layout := []string{"accounts", "accounts/balances", "accounts/nonces", "accounts/nonces/pending",
+			"accountsArchive", "accounts-old", "blocks"}
+		for _, namespace := range layout {
+			require.NoError(kvStore.Put(namespace, testK1[0], []byte(namespace)))
+		}
+		names, err := tree.ListNamespaceTree("accounts")
+		require.NoError(err)
+		require.Equal([]string{"accounts", "accounts/balances", "accounts/nonces", "accounts/nonces/pending"}, names)
+		names, err = tree.ListNamespaceTree("accounts/nonces")
+		require.NoError(err)
+		require.Equal([]string{"accounts/nonces", "accounts/nonces/pending"}, names)
+		names, err = tree.ListNamespaceTree("missing")
+		require.NoError(err)
+		require.Empty(names)
+		_, err = tree.ListNamespaceTree("")
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+
+		// deleting a subtree leaves its parent and siblings
+		require.NoError(tree.DeleteNamespaceTree("accounts/nonces"))
+		for _, namespace := range []string{"accounts/nonces", "accounts/nonces/pending"} {
+			_, err := kvStore.Get(namespace, testK1[0])
+			require.True(isNotExist(err))
+		}
+		names, err = tree.ListNamespaceTree("accounts")
+		require.NoError(err)
+		require.Equal([]string{"accounts", "accounts/balances"}, names)
+
+		require.NoError(tree.DeleteNamespaceTree("accounts"))
+		names, err = tree.ListNamespaceTree("accounts")
+		require.NoError(err)
+		require.Empty(names)
+		for _, namespace := range []string{"accountsArchive", "accounts-old", "blocks"} {
+			value, err := kvStore.Get(namespace, testK1[0])
+			require.NoError(err)
+			require.Equal([]byte(namespace), value)
+		}
+		require.NoError(tree.DeleteNamespaceTree("missing"))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testNamespaceTree(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-namespace-tree.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testNamespaceTree(NewOnDiskDB(dbCfg), t)
+	})
+}
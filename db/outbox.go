@@ -0,0 +1,268 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/logger"
+)
+
+// outboxNamespace is the namespace keeping the events committed and not delivered yet, keyed by the time they are
+// committed at followed by a sequence, so that they are listed in the order they are committed
+const outboxNamespace = "outbox"
+
+// outboxPageSize is the number of events the relay lists at a time
+const outboxPageSize = 256
+
+// outboxSeq is the sequence of the last event committed by the process, which tells apart the events committed at
+// the same time
+var outboxSeq uint64
+
+type (
+	// OutboxEvent is an event to emit once the state changed along with it is committed
+	OutboxEvent struct {
+		// ID is the key of the event in the outbox, set by the relay, which is the same on each delivery of the event
+		// so that the receiver is able to drop a duplicate
+		ID      []byte
+		Topic   string
+		Payload []byte
+	}
+
+	// OutboxCommitter is the interface of KV store which is able to commit a batch along with the events to emit, as
+	// the transactional outbox pattern, so that an event is never lost once the state change is committed, nor
+	// emitted if it is not
+	OutboxCommitter interface {
+		// CommitWithOutbox commits the batch along with the events in the reserved namespace "outbox", in the same
+		// commit, for an OutboxRelay to deliver them. The batch is cleared once committed, as by Commit
+		CommitWithOutbox(KVStoreBatch, []OutboxEvent) error
+	}
+
+	// OutboxRelayOption sets an option of the outbox relay
+	OutboxRelayOption func(*OutboxRelay)
+
+	// OutboxRelay delivers the events of the outbox of a KV store in the background, and deletes them once delivered
+	OutboxRelay struct {
+		kvStore  KVStore
+		deliver  func(OutboxEvent) error
+		interval time.Duration
+		clk      clock.Clock
+		// mutex serializes the relays, so that an event is not delivered by two of them at once
+		mutex sync.Mutex
+		done  chan struct{}
+		wg    sync.WaitGroup
+	}
+)
+
+// CommitWithOutbox commits the batch and the events in one transaction of BoltDB
+func (b *boltDB) CommitWithOutbox(batch KVStoreBatch, events []OutboxEvent) error {
+	return commitWithOutbox(b, b.options, batch, events)
+}
+
+// CommitWithOutbox commits the batch and the events in one transaction of BadgerDB
+func (b *badgerDB) CommitWithOutbox(batch KVStoreBatch, events []OutboxEvent) error {
+	return commitWithOutbox(b, b.options, batch, events)
+}
+
+// CommitWithOutbox commits the batch and the events to the in-memory KV store at once
+func (m *memKVStore) CommitWithOutbox(batch KVStoreBatch, events []OutboxEvent) error {
+	return commitWithOutbox(m, m.options, batch, events)
+}
+
+// NewOutboxRelay returns a relay of the outbox of the KV store, which must implement KeyPager. It polls the outbox
+// every second by default, and passes each event to deliver in the order they are committed, deleting the event once
+// deliver returns nil. If deliver fails, the relay stops there and retries the event on the next poll, so the events
+// are delivered at least once and in order: an event delivered but not deleted yet, e.g. by a crash, is delivered
+// again
+func NewOutboxRelay(kvStore KVStore, deliver func(OutboxEvent) error, opts ...OutboxRelayOption) *OutboxRelay {
+	r := &OutboxRelay{
+		kvStore:  kvStore,
+		deliver:  deliver,
+		interval: time.Second,
+		clk:      clock.New(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// WithOutboxPollInterval sets how often the relay polls the outbox
+func WithOutboxPollInterval(interval time.Duration) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.interval = interval
+	}
+}
+
+// WithOutboxClock sets the clock timing the polls of the relay, which is the system clock by default
+func WithOutboxClock(clk clock.Clock) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.clk = clk
+	}
+}
+
+// Start starts polling the outbox in the background. The KV store must be started already
+func (r *OutboxRelay) Start(_ context.Context) error {
+	if _, ok := r.kvStore.(KeyPager); !ok {
+		return errors.Wrap(ErrInvalidDB, "KV store does not support listing keys")
+	}
+	if r.interval <= 0 {
+		return errors.Wrapf(ErrInvalidDB, "invalid outbox poll interval %s", r.interval)
+	}
+	if r.done != nil {
+		return nil
+	}
+	r.done = make(chan struct{})
+	r.wg.Add(1)
+	go r.poll()
+	return nil
+}
+
+// Stop stops polling the outbox, and waits for the relay in progress
+func (r *OutboxRelay) Stop(_ context.Context) error {
+	if r.done == nil {
+		return nil
+	}
+	close(r.done)
+	r.wg.Wait()
+	r.done = nil
+	return nil
+}
+
+// Relay delivers the events in the outbox now, until the outbox is empty or a delivery fails, and returns the number
+// of events delivered
+func (r *OutboxRelay) Relay() (int, error) {
+	pager, ok := r.kvStore.(KeyPager)
+	if !ok {
+		return 0, errors.Wrap(ErrInvalidDB, "KV store does not support listing keys")
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delivered := 0
+	after := []byte{}
+	for after != nil {
+		keys, next, err := pager.KeysPaged(outboxNamespace, after, outboxPageSize)
+		if isNotExist(err) {
+			break
+		}
+		if err != nil {
+			return delivered, errors.Wrap(err, "failed to list outbox events")
+		}
+		for _, key := range keys {
+			value, err := r.kvStore.Get(outboxNamespace, key)
+			if isNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return delivered, errors.Wrapf(err, "failed to get outbox event %x", key)
+			}
+			event, err := decodeOutboxEvent(key, value)
+			if err != nil {
+				return delivered, err
+			}
+			if err := r.deliver(event); err != nil {
+				return delivered, errors.Wrapf(err, "failed to deliver outbox event %x", key)
+			}
+			if err := r.kvStore.Delete(outboxNamespace, key); err != nil {
+				return delivered, errors.Wrapf(err, "failed to delete outbox event %x", key)
+			}
+			delivered++
+		}
+		after = next
+	}
+	return delivered, nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// poll relays the events every interval until the relay is stopped
+func (r *OutboxRelay) poll() {
+	defer r.wg.Done()
+
+	ticker := r.clk.Ticker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			if _, err := r.Relay(); err != nil {
+				logger.Warn().Err(err).Msg("Failed to relay outbox events.")
+			}
+		}
+	}
+}
+
+// commitWithOutbox commits a copy of the batch with the events put after its entries, and clears the batch once it is
+// committed
+func commitWithOutbox(kvStore KVStore, options kvStoreOptions, batch KVStoreBatch, events []OutboxEvent) error {
+	batch.Lock()
+	committed := batch.committed()
+	batch.Unlock()
+	if committed {
+		return ErrBatchAlreadyCommitted
+	}
+	if manager, ok := kvStore.(NamespaceManager); ok && options.explicitNamespaces {
+		if err := manager.CreateNamespace(outboxNamespace); err != nil {
+			return err
+		}
+	}
+
+	withEvents := NewBatch()
+	if err := withEvents.Merge(batch); err != nil {
+		return err
+	}
+	now := uint64(options.clk.Now().UnixNano())
+	for _, event := range events {
+		key := make([]byte, 16)
+		binary.BigEndian.PutUint64(key, now)
+		binary.BigEndian.PutUint64(key[8:], atomic.AddUint64(&outboxSeq, 1))
+		if err := withEvents.Put(outboxNamespace, key, encodeOutboxEvent(event),
+			"failed to put outbox event %x", key); err != nil {
+			return err
+		}
+	}
+	if err := kvStore.Commit(withEvents); err != nil {
+		return err
+	}
+	batch.Lock()
+	batch.ClearAndUnlock()
+	return nil
+}
+
+// encodeOutboxEvent encodes the event as its topic prefixed with its length, followed by its payload
+func encodeOutboxEvent(event OutboxEvent) []byte {
+	n := make([]byte, binary.MaxVarintLen64)
+	l := binary.PutUvarint(n, uint64(len(event.Topic)))
+	value := make([]byte, 0, l+len(event.Topic)+len(event.Payload))
+	value = append(value, n[:l]...)
+	value = append(value, event.Topic...)
+	return append(value, event.Payload...)
+}
+
+// decodeOutboxEvent decodes the event of the key
+func decodeOutboxEvent(key, value []byte) (OutboxEvent, error) {
+	l, n := binary.Uvarint(value)
+	if n <= 0 || l > uint64(len(value)-n) {
+		return OutboxEvent{}, errors.Wrapf(ErrInvalidDB, "malformed outbox event %x", key)
+	}
+	return OutboxEvent{
+		ID:      key,
+		Topic:   string(value[n : n+int(l)]),
+		Payload: value[n+int(l):],
+	}, nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestOutbox(t *testing.T) {
+	testOutbox := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		committer := kvStore.(OutboxCommitter)
+		event := func(i int) OutboxEvent {
+			return OutboxEvent{Topic: "transfer", Payload: []byte(fmt.Sprintf("event-%d", i))}
+		}
+
+		// the events are committed along with the state change
+		batch := NewBatch()
+		require.NoError(batch.Put(bucket1, testK1[0], testV1[0], ""))
+		require.NoError(committer.CommitWithOutbox(batch, []OutboxEvent{event(0), event(1)}))
+		require.Equal(0, batch.Size())
+		value, err := kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+		require.Equal(ErrBatchAlreadyCommitted, errors.Cause(committer.CommitWithOutbox(batch, nil)))
+
+		// neither of them is committed if the state change fails
+		batch = NewBatch()
+		require.NoError(batch.Put(bucket1, testK1[1], testV1[1], ""))
+		require.NoError(batch.PutIfNotExists(bucket1, testK1[0], testV1[2], ""))
+		require.Equal(ErrAlreadyExist, errors.Cause(committer.CommitWithOutbox(batch, []OutboxEvent{event(9)})))
+		require.Equal(2, batch.Size())
+		_, err = kvStore.Get(bucket1, testK1[1])
+		require.True(isNotExist(err))
+		batch = NewBatch()
+		require.NoError(batch.Put(bucket2, testK2[0], testV2[0], ""))
+		require.NoError(committer.CommitWithOutbox(batch, []OutboxEvent{event(2)}))
+
+		// a failed delivery stops the relay, and is retried on the next poll
+		var (
+			mutex     sync.Mutex
+			delivered []OutboxEvent
+			failures  = 1
+		)
+		deliver := func(e OutboxEvent) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if len(delivered) == 1 && failures > 0 {
+				failures--
+				return errWriteFailed
+			}
+			delivered = append(delivered, e)
+			return nil
+		}
+		clk := clock.NewMock()
+		relay := NewOutboxRelay(kvStore, deliver, WithOutboxPollInterval(time.Second), WithOutboxClock(clk))
+		n, err := relay.Relay()
+		require.Equal(errWriteFailed, errors.Cause(err))
+		require.Equal(1, n)
+		require.NoError(relay.Start(ctx))
+		defer func() {
+			require.NoError(relay.Stop(ctx))
+		}()
+		require.NoError(testutil.WaitUntil(time.Millisecond, time.Second, func() (bool, error) {
+			clk.Add(time.Second)
+			mutex.Lock()
+			defer mutex.Unlock()
+			return len(delivered) == 3, nil
+		}))
+
+		// the events are delivered in the order they are committed, and deleted once delivered
+		mutex.Lock()
+		for i, e := range delivered {
+			require.Equal(event(i).Topic, e.Topic)
+			require.Equal(event(i).Payload, e.Payload)
+			require.Len(e.ID, 16)
+		}
+		mutex.Unlock()
+		keys, _, err := kvStore.(KeyPager).KeysPaged(outboxNamespace, []byte{}, outboxPageSize)
+		require.True(err == nil || isNotExist(err))
+		require.Empty(keys)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testOutbox(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-outbox.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testOutbox(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-outbox.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testOutbox(NewOnDiskDB(dbCfg), t)
+	})
+}
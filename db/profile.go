@@ -0,0 +1,102 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Profile is the statistics of the records of a namespace, for capacity planning and spotting skew
+type Profile struct {
+	// Keys is the number of records
+	Keys uint64
+	// KeyBytes is the total size of the keys
+	KeyBytes uint64
+	// ValueBytes is the total size of the values
+	ValueBytes uint64
+	// MinValueSize is the size of the smallest value, 0 if there is no record
+	MinValueSize int
+	// MaxValueSize is the size of the largest value
+	MaxValueSize int
+	// MeanValueSize is the mean size of the values
+	MeanValueSize float64
+	// P50ValueSize, P90ValueSize and P99ValueSize are the percentiles of the sizes of the values, by nearest rank
+	P50ValueSize int
+	P90ValueSize int
+	P99ValueSize int
+	// Sampled is whether the percentiles are estimated from a sample of the values rather than computed from all
+	Sampled bool
+}
+
+// NamespaceProfile computes the profile of the namespace in a single pass over its records. The counts, the totals,
+// the minimum, the maximum and the mean are exact. The percentiles are computed from the sizes of up to sample values
+// chosen at random by seed, so that the memory taken is bounded for a large namespace, or from the sizes of all
+// values if sample is 0
+func NamespaceProfile(streamer Streamer, namespace string, sample int, seed int64) (Profile, error) {
+	if sample < 0 {
+		return Profile{}, errors.Wrapf(ErrInvalidDB, "invalid sample size %d", sample)
+	}
+	var (
+		mutex   sync.Mutex
+		profile Profile
+		sizes   []int
+		r       = rand.New(rand.NewSource(seed))
+	)
+	err := streamer.StreamAll(namespace, func(key, value []byte) error {
+		// fn may be called concurrently
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		size := len(value)
+		profile.Keys++
+		profile.KeyBytes += uint64(len(key))
+		profile.ValueBytes += uint64(size)
+		if profile.Keys == 1 || size < profile.MinValueSize {
+			profile.MinValueSize = size
+		}
+		if size > profile.MaxValueSize {
+			profile.MaxValueSize = size
+		}
+		if sample == 0 || len(sizes) < sample {
+			sizes = append(sizes, size)
+		} else if i := r.Int63n(int64(profile.Keys)); i < int64(sample) {
+			sizes[i] = size
+		}
+		return nil
+	})
+	if err != nil && !isNotExist(err) {
+		return Profile{}, err
+	}
+	if profile.Keys == 0 {
+		return Profile{}, nil
+	}
+	profile.MeanValueSize = float64(profile.ValueBytes) / float64(profile.Keys)
+	profile.Sampled = uint64(len(sizes)) < profile.Keys
+	sort.Ints(sizes)
+	profile.P50ValueSize = percentile(sizes, 0.5)
+	profile.P90ValueSize = percentile(sizes, 0.9)
+	profile.P99ValueSize = percentile(sizes, 0.99)
+	return profile, nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// percentile returns the p-th percentile of the sorted sizes by nearest rank
+func percentile(sorted []int, p float64) int {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestNamespaceProfile(t *testing.T) {
+	testProfile := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		streamer := kvStore.(Streamer)
+
+		// the values of bucket1 are of sizes 1 to 100, the keys of 8 bytes
+		batch := NewBatch()
+		for i := 1; i <= 100; i++ {
+			batch.Put(bucket1, []byte(fmt.Sprintf("key_%04d", i)), bytes.Repeat([]byte{1}, i), "")
+		}
+		require.NoError(kvStore.Commit(batch))
+		profile, err := NamespaceProfile(streamer, bucket1, 0, 1)
+		require.NoError(err)
+		require.Equal(Profile{
+			Keys:          100,
+			KeyBytes:      800,
+			ValueBytes:    5050,
+			MinValueSize:  1,
+			MaxValueSize:  100,
+			MeanValueSize: 50.5,
+			P50ValueSize:  50,
+			P90ValueSize:  90,
+			P99ValueSize:  99,
+		}, profile)
+
+		// a namespace without records has an empty profile
+		profile, err = NamespaceProfile(streamer, bucket2, 0, 1)
+		require.NoError(err)
+		require.Equal(Profile{}, profile)
+
+		// the percentiles of a large namespace are estimated from a sample, the rest is exact
+		batch = NewBatch()
+		for i := 0; i < 10000; i++ {
+			batch.Put(bucket2, []byte(fmt.Sprintf("key_%04d", i)), bytes.Repeat([]byte{1}, i%100+1), "")
+		}
+		require.NoError(kvStore.Commit(batch))
+		profile, err = NamespaceProfile(streamer, bucket2, 1000, 1)
+		require.NoError(err)
+		require.True(profile.Sampled)
+		require.Equal(uint64(10000), profile.Keys)
+		require.Equal(uint64(505000), profile.ValueBytes)
+		require.Equal(1, profile.MinValueSize)
+		require.Equal(100, profile.MaxValueSize)
+		require.Equal(50.5, profile.MeanValueSize)
+		require.InDelta(50, profile.P50ValueSize, 8)
+		require.InDelta(90, profile.P90ValueSize, 5)
+		require.InDelta(99, profile.P99ValueSize, 2)
+
+		_, err = NamespaceProfile(streamer, bucket2, -1, 1)
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testProfile(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-namespace-profile.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testProfile(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-namespace-profile.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testProfile(NewOnDiskDB(dbCfg), t)
+	})
+}
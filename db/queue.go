@@ -0,0 +1,149 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+)
+
+// PopFirst reads and deletes the first n records of the bucket in one transaction
+func (b *boltDB) PopFirst(namespace string, n int) ([]KeyValue, error) {
+	if n <= 0 {
+		return nil, errors.Wrapf(ErrInvalidDB, "invalid number of records to pop %d", n)
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	var (
+		popped []KeyValue
+		err    error
+	)
+	for c := uint8(0); c < b.config.NumRetries; c++ {
+		if err = b.db.Update(func(tx *bolt.Tx) error {
+			popped = nil
+			bucket, err := b.bucketToDelete(tx, namespace)
+			if bucket == nil {
+				return err
+			}
+			// the bucket must not be modified while iterating it, and its keys and values are only valid until then
+			err = bucket.ForEach(func(k, v []byte) error {
+				if len(popped) == n {
+					return errStopIteration
+				}
+				popped = append(popped, KeyValue{Key: copyBytes(k), Value: copyBytes(v)})
+				return nil
+			})
+			if err != nil && err != errStopIteration {
+				return err
+			}
+			for _, kv := range popped {
+				if err := bucket.Delete(kv.Key); err != nil {
+					return errors.Wrapf(err, "failed to delete key = %x", kv.Key)
+				}
+			}
+			return nil
+		}); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to pop records of namespace %s", namespace)
+	}
+	return popped, nil
+}
+
+// PopFirst reads and deletes the first n records prefixed with the namespace in one transaction
+func (b *badgerDB) PopFirst(namespace string, n int) ([]KeyValue, error) {
+	if n <= 0 {
+		return nil, errors.Wrapf(ErrInvalidDB, "invalid number of records to pop %d", n)
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.db == nil {
+		return nil, ErrDBClosed
+	}
+
+	if err := b.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	var (
+		popped []KeyValue
+		err    error
+	)
+	for c := uint8(0); c < b.config.NumRetries; c++ {
+		if err = b.update(func(txn *keyIndexTxn) error {
+			popped = nil
+			prefix := []byte(namespace)
+			it := txn.NewIterator(badger.DefaultIteratorOptions)
+			for it.Seek(prefix); it.ValidForPrefix(prefix) && len(popped) < n; it.Next() {
+				value, err := valueOf(it.Item())
+				if err != nil {
+					it.Close()
+					return err
+				}
+				popped = append(popped, KeyValue{Key: copyBytes(it.Item().Key()[len(prefix):]), Value: value})
+			}
+			it.Close()
+			for _, kv := range popped {
+				k := append([]byte(namespace), kv.Key...)
+				if err := txn.Delete(k); err != nil {
+					return errors.Wrapf(err, "failed to delete key = %x", k)
+				}
+			}
+			return nil
+		}); err == nil {
+			break
+		}
+	}
+	b.markDirty()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to pop records of namespace %s", namespace)
+	}
+	return popped, nil
+}
+
+// PopFirst reads and deletes the first n records of the namespace with all shards locked
+func (m *memKVStore) PopFirst(namespace string, n int) ([]KeyValue, error) {
+	if n <= 0 {
+		return nil, errors.Wrapf(ErrInvalidDB, "invalid number of records to pop %d", n)
+	}
+	if err := m.checkNamespace(namespace); err != nil {
+		return nil, err
+	}
+	m.lockAll()
+	defer m.unlockAll()
+
+	var keys []string
+	for _, shard := range m.shards {
+		for k, v := range shard.bucket[namespace] {
+			// a record of nil value is reported as not existing
+			if v != nil {
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	popped := make([]KeyValue, 0, len(keys))
+	for _, k := range keys {
+		shard := m.shard(namespace, []byte(k))
+		popped = append(popped, KeyValue{Key: []byte(k), Value: shard.bucket[namespace][k]})
+		shard.delete(namespace, []byte(k))
+	}
+	return popped, nil
+}
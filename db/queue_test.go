@@ -0,0 +1,122 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestPopFirst(t *testing.T) {
+	testPopFirst := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		dequeuer, ok := kvStore.(Dequeuer)
+		require.True(ok)
+
+		_, err := dequeuer.PopFirst(bucket1, 0)
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+		popped, err := dequeuer.PopFirst(bucket1, 1)
+		require.NoError(err)
+		require.Empty(popped)
+
+		// the records are popped in key order, and no more than there are
+		require.NoError(kvStore.Put(bucket1, testK1[2], testV1[2]))
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		require.NoError(kvStore.Put(bucket1, testK1[1], testV1[1]))
+		require.NoError(kvStore.Put(bucket2, testK2[0], testV2[0]))
+		popped, err = dequeuer.PopFirst(bucket1, 2)
+		require.NoError(err)
+		require.Equal([]KeyValue{{Key: testK1[0], Value: testV1[0]}, {Key: testK1[1], Value: testV1[1]}}, popped)
+		_, err = kvStore.Get(bucket1, testK1[0])
+		require.True(isNotExist(err))
+		popped, err = dequeuer.PopFirst(bucket1, 5)
+		require.NoError(err)
+		require.Equal([]KeyValue{{Key: testK1[2], Value: testV1[2]}}, popped)
+		value, err := kvStore.Get(bucket2, testK2[0])
+		require.NoError(err)
+		require.Equal(testV2[0], value)
+
+		// concurrent workers process each record exactly once
+		const items, workers = 200, 8
+		for i := 0; i < items; i++ {
+			require.NoError(kvStore.Put(bucket1, []byte(fmt.Sprintf("item_%03d", i)), []byte(fmt.Sprintf("%d", i))))
+		}
+		var (
+			wg        sync.WaitGroup
+			mutex     sync.Mutex
+			processed = make(map[string]int)
+		)
+		errs := make(chan error, workers)
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(batch int) {
+				defer wg.Done()
+				for {
+					popped, err := dequeuer.PopFirst(bucket1, batch)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if len(popped) == 0 {
+						return
+					}
+					mutex.Lock()
+					for _, kv := range popped {
+						processed[string(kv.Key)]++
+					}
+					mutex.Unlock()
+				}
+			}(w%3 + 1)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(err)
+		}
+		require.Equal(items, len(processed))
+		for i := 0; i < items; i++ {
+			require.Equal(1, processed[fmt.Sprintf("item_%03d", i)])
+		}
+		popped, err = dequeuer.PopFirst(bucket1, items)
+		require.NoError(err)
+		require.Empty(popped)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testPopFirst(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-pop-first.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testPopFirst(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-pop-first.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testPopFirst(NewOnDiskDB(dbCfg), t)
+	})
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"sync"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/logger"
+)
+
+type (
+	// ReadTxnStats is the statistics of the read transactions open in BoltDB. A read transaction keeps the pages it
+	// reads from being reused, so one held open for long makes the file grow with every write meanwhile
+	ReadTxnStats struct {
+		// Open is the number of read transactions open, including the short ones of single reads
+		Open int
+		// Held is the number of read transactions held beyond a single read: by a value of GetMapped or UnsafeGet not
+		// released yet, or by a StreamAll, ForEachNamespace, Snapshot or OpenSnapshot in progress
+		Held int
+		// OldestAge is how long the oldest held read transaction has been open, 0 if there is none
+		OldestAge time.Duration
+		// OldestOp is the operation holding the oldest read transaction, e.g. "UnsafeGet" for a value of GetMapped or
+		// UnsafeGet, "StreamAll" for a stream
+		OldestOp string
+		// Overdue is the number of held read transactions open longer than the threshold of WithReadTxnWatchdog
+		Overdue int
+	}
+
+	// readTxnTracker tracks the read transactions held beyond a single read. The short read transactions are not
+	// tracked, so reads pay nothing for it
+	readTxnTracker struct {
+		mutex sync.Mutex
+		clk   clock.Clock
+		next  uint64
+		held  map[uint64]*heldReadTxn
+	}
+
+	// heldReadTxn is a read transaction held by an operation
+	heldReadTxn struct {
+		op     string
+		opened time.Time
+		warned bool
+		// release closes the read transaction held by a caller, nil if it is held by an operation in progress
+		release func()
+	}
+)
+
+// Stats returns the statistics of the read transactions open
+func (b *boltDB) Stats() ReadTxnStats {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return ReadTxnStats{}
+	}
+	stats := b.readTxns.stats(b.options.readTxnWatchdog)
+	stats.Open = b.db.Stats().OpenTxN
+	return stats
+}
+
+//======================================
+// private functions
+//======================================
+
+// newReadTxnTracker returns a tracker of read transactions timed by the clock
+func newReadTxnTracker(clk clock.Clock) *readTxnTracker {
+	return &readTxnTracker{clk: clk, held: make(map[uint64]*heldReadTxn)}
+}
+
+// hold records a read transaction held by the operation from now on, and returns the func to call once it is closed
+func (t *readTxnTracker) hold(op string) func() {
+	return t.holdReleasable(op, nil)
+}
+
+// holdReleasable records a read transaction handed out to the caller of the operation, which release closes if the
+// caller leaks it, and returns the func to call once it is closed
+func (t *readTxnTracker) holdReleasable(op string, release func()) func() {
+	if t == nil {
+		return func() {}
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	id := t.next
+	t.next++
+	t.held[id] = &heldReadTxn{op: op, opened: t.clk.Now(), release: release}
+	return func() {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		delete(t.held, id)
+	}
+}
+
+// stats returns the statistics of the held read transactions, those open longer than threshold being overdue unless
+// threshold is 0. Open is left to the caller
+func (t *readTxnTracker) stats(threshold time.Duration) ReadTxnStats {
+	if t == nil {
+		return ReadTxnStats{}
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.clk.Now()
+	stats := ReadTxnStats{Held: len(t.held)}
+	for _, txn := range t.held {
+		age := now.Sub(txn.opened)
+		if age > stats.OldestAge || stats.OldestOp == "" {
+			stats.OldestAge, stats.OldestOp = age, txn.op
+		}
+		if threshold > 0 && age > threshold {
+			stats.Overdue++
+		}
+	}
+	return stats
+}
+
+// warnOverdue logs a warning for each held read transaction newly open longer than threshold
+func (t *readTxnTracker) warnOverdue(path string, threshold time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.clk.Now()
+	for _, txn := range t.held {
+		if age := now.Sub(txn.opened); age > threshold && !txn.warned {
+			txn.warned = true
+			logger.Warn().
+				Str("path", path).
+				Str("op", txn.op).
+				Dur("age", age).
+				Msg("Read transaction of BoltDB is open for long, it may be leaked and makes the file grow.")
+		}
+	}
+}
+
+// releaseLeaked closes the read transactions handed out and not released yet, and returns the number of them by
+// operation
+func (t *readTxnTracker) releaseLeaked() map[string]int {
+	if t == nil {
+		return nil
+	}
+	t.mutex.Lock()
+	leaked := make(map[string]int)
+	var releases []func()
+	for _, txn := range t.held {
+		if txn.release != nil {
+			leaked[txn.op]++
+			releases = append(releases, txn.release)
+		}
+	}
+	t.mutex.Unlock()
+
+	// each release removes its read transaction from the tracker
+	for _, release := range releases {
+		release()
+	}
+	return leaked
+}
+
+// releaseLeaked force-releases the read transactions leaked by the callers before the DB is closed, warning of each
+// operation leaking them, and returns an error of the number of them if any
+func (b *boltDB) releaseLeaked() error {
+	total := 0
+	for op, n := range b.readTxns.releaseLeaked() {
+		total += n
+		logger.Warn().
+			Str("path", b.path).
+			Str("op", op).
+			Int("leaked", n).
+			Msg("Read transactions of BoltDB are not released before stop, force-releasing them.")
+	}
+	if total == 0 {
+		return nil
+	}
+	return errors.Wrapf(ErrLeakedReadTxn, "%d read transactions not released before stop", total)
+}
+
+// watchReadTxns warns of the overdue read transactions every threshold until done is closed
+func (b *boltDB) watchReadTxns(threshold time.Duration, done <-chan struct{}) {
+	defer b.wg.Done()
+
+	ticker := b.options.clk.Ticker(threshold)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			b.readTxns.warnOverdue(b.path, threshold)
+		}
+	}
+}
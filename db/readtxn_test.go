@@ -0,0 +1,136 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestReadTxnStats(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	path := "test-read-txn-stats.bolt"
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+	dbCfg := cfg
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	clk := clock.NewMock()
+	kvStore := NewOnDiskDB(dbCfg, WithClock(clk), WithReadTxnWatchdog(time.Minute))
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	observer, ok := kvStore.(ReadTxnObserver)
+	require.True(ok)
+	require.Equal(ReadTxnStats{}, observer.Stats())
+
+	// a mapped value holds its read transaction until it is closed
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+	value, err := kvStore.(MappedGetter).GetMapped(bucket1, testK1[0])
+	require.NoError(err)
+	clk.Add(30 * time.Second)
+	require.Equal(ReadTxnStats{Open: 1, Held: 1, OldestAge: 30 * time.Second, OldestOp: "UnsafeGet"}, observer.Stats())
+
+	// the oldest of the held read transactions is reported, and those open longer than the threshold are overdue
+	_, release, err := kvStore.(UnsafeGetter).UnsafeGet(bucket1, testK1[0])
+	require.NoError(err)
+	clk.Add(45 * time.Second)
+	require.Equal(ReadTxnStats{Open: 2, Held: 2, OldestAge: 75 * time.Second, OldestOp: "UnsafeGet", Overdue: 1},
+		observer.Stats())
+	clk.Add(time.Minute)
+	require.Equal(ReadTxnStats{Open: 2, Held: 2, OldestAge: 135 * time.Second, OldestOp: "UnsafeGet", Overdue: 2},
+		observer.Stats())
+
+	require.NoError(value.Close())
+	require.Equal(ReadTxnStats{Open: 1, Held: 1, OldestAge: 105 * time.Second, OldestOp: "UnsafeGet", Overdue: 1},
+		observer.Stats())
+	release()
+	require.Equal(ReadTxnStats{}, observer.Stats())
+
+	// a stream holds its read transaction while in progress
+	require.NoError(kvStore.(Streamer).StreamAll(bucket1, func([]byte, []byte) error {
+		clk.Add(time.Second)
+		stats := kvStore.(*boltDB).readTxns.stats(0)
+		require.Equal(ReadTxnStats{Held: 1, OldestAge: time.Second, OldestOp: "StreamAll"}, stats)
+		return nil
+	}))
+	require.Equal(ReadTxnStats{}, observer.Stats())
+
+	// the watchdog warns of an overdue read transaction once
+	value, err = kvStore.(MappedGetter).GetMapped(bucket1, testK1[0])
+	require.NoError(err)
+	defer value.Close()
+	tracker := kvStore.(*boltDB).readTxns
+	require.NoError(testutil.WaitUntil(5*time.Millisecond, time.Second, func() (bool, error) {
+		// the ticks of the mock clock are dropped unless the watchdog is waiting for them, so tick until it is
+		clk.Add(time.Minute)
+		tracker.mutex.Lock()
+		defer tracker.mutex.Unlock()
+		for _, txn := range tracker.held {
+			return txn.warned, nil
+		}
+		return false, nil
+	}))
+}
+
+func TestReleaseLeakedReadTxns(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	path := "test-release-leaked-read-txns.bolt"
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+	dbCfg := cfg
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	kvStore := NewOnDiskDB(dbCfg)
+	require.NoError(kvStore.Start(ctx))
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+
+	// the values are neither closed nor released, while being read concurrently with the stop
+	value, err := kvStore.(MappedGetter).GetMapped(bucket1, testK1[0])
+	require.NoError(err)
+	_, release, err := kvStore.(UnsafeGetter).UnsafeGet(bucket1, testK1[0])
+	require.NoError(err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			kvStore.(ReadTxnObserver).Stats()
+		}
+	}()
+
+	// the stop closes the DB rather than hanging, and reports the leaked read transactions
+	stopCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	err = kvStore.Stop(stopCtx)
+	require.Error(err)
+	require.Equal(ErrLeakedReadTxn, errors.Cause(err))
+	require.Contains(err.Error(), "2 read transactions")
+	<-done
+	_, err = kvStore.Get(bucket1, testK1[0])
+	require.Equal(ErrDBClosed, errors.Cause(err))
+
+	// releasing them afterwards does nothing, and the DB opens again cleanly
+	require.NoError(value.Close())
+	release()
+	require.NoError(kvStore.Start(ctx))
+	v, err := kvStore.Get(bucket1, testK1[0])
+	require.NoError(err)
+	require.Equal(testV1[0], v)
+	require.NoError(kvStore.Stop(ctx))
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// batchRecordHeaderSize is the size of the header of a serialized batch: the sequence, the length of the entries and
+// their CRC-32
+const batchRecordHeaderSize = 16
+
+// WriteBatch serializes the entries of the batch as a record of the sequence to w, in one write. A record is the
+// header of the sequence, the length and the CRC-32 of the entries, followed by the write type, namespace, key and
+// value of each entry, the variable-length ones prefixed with their length. The formats of the errors of the entries
+// are not serialized
+func WriteBatch(w io.Writer, seq uint64, b KVStoreBatch) error {
+	b.Lock()
+	defer b.Unlock()
+
+	var buf bytes.Buffer
+	n := make([]byte, binary.MaxVarintLen64)
+	writeBytes := func(b []byte) {
+		buf.Write(n[:binary.PutUvarint(n, uint64(len(b)))])
+		buf.Write(b)
+	}
+	buf.Write(make([]byte, batchRecordHeaderSize))
+	buf.Write(n[:binary.PutUvarint(n, uint64(b.Size()))])
+	for i := 0; i < b.Size(); i++ {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		buf.Write(n[:binary.PutUvarint(n, uint64(write.writeType))])
+		writeBytes([]byte(write.namespace))
+		writeBytes(write.key)
+		writeBytes(write.value)
+	}
+	record := buf.Bytes()
+	binary.BigEndian.PutUint64(record, seq)
+	binary.BigEndian.PutUint32(record[8:], uint32(len(record)-batchRecordHeaderSize))
+	binary.BigEndian.PutUint32(record[12:], crc32.ChecksumIEEE(record[batchRecordHeaderSize:]))
+	_, err := w.Write(record)
+	return errors.Wrapf(err, "failed to write batch %d", seq)
+}
+
+// ReplayBatches reads the batches serialized by WriteBatch from r, and commits those of a sequence after fromSeq to
+// the KV store in order, one commit per batch, and returns the number of batches committed. A batch of a sequence
+// not after fromSeq or the last one committed is taken as applied already and skipped, so replaying the same log
+// again is idempotent. A record cut short at the end of r, as a crash in the middle of writing it leaves, ends the
+// replay cleanly; a record failing its checksum is an error
+func ReplayBatches(kvStore KVStore, r io.Reader, fromSeq uint64) (uint64, error) {
+	var applied uint64
+	header := make([]byte, batchRecordHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return applied, nil
+			}
+			return applied, errors.Wrap(err, "failed to read batch")
+		}
+		seq := binary.BigEndian.Uint64(header)
+		entries := make([]byte, binary.BigEndian.Uint32(header[8:]))
+		if _, err := io.ReadFull(r, entries); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return applied, nil
+			}
+			return applied, errors.Wrapf(err, "failed to read batch %d", seq)
+		}
+		if crc32.ChecksumIEEE(entries) != binary.BigEndian.Uint32(header[12:]) {
+			return applied, errors.Wrapf(ErrChecksumMismatch, "batch %d", seq)
+		}
+		if seq <= fromSeq {
+			continue
+		}
+		batch, err := decodeBatch(seq, entries)
+		if err != nil {
+			return applied, err
+		}
+		if err := kvStore.Commit(batch); err != nil {
+			return applied, errors.Wrapf(err, "failed to commit batch %d", seq)
+		}
+		applied++
+		fromSeq = seq
+	}
+}
+
+//======================================
+// private functions
+//======================================
+
+// decodeBatch decodes the entries of the batch of the sequence
+func decodeBatch(seq uint64, entries []byte) (KVStoreBatch, error) {
+	malformed := errors.Wrapf(ErrInvalidDB, "malformed batch %d", seq)
+	r := bytes.NewReader(entries)
+	readBytes := func() ([]byte, error) {
+		l, err := binary.ReadUvarint(r)
+		if err != nil || l > uint64(r.Len()) {
+			return nil, malformed
+		}
+		// an empty value is kept non-nil, since a nil value is reported as not existing by the in-memory KV store
+		b := make([]byte, l)
+		r.Read(b)
+		return b, nil
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil || count > uint64(r.Len()) {
+		return nil, malformed
+	}
+	writes := make([]writeInfo, count)
+	for i := range writes {
+		writeType, err := binary.ReadUvarint(r)
+		if err != nil || writeType > uint64(AddCounter) {
+			return nil, malformed
+		}
+		var namespace, key, value []byte
+		for _, field := range []*[]byte{&namespace, &key, &value} {
+			if *field, err = readBytes(); err != nil {
+				return nil, err
+			}
+		}
+		if int32(writeType) == Delete {
+			value = nil
+		}
+		writes[i] = writeInfo{
+			writeType:   int32(writeType),
+			namespace:   string(namespace),
+			key:         key,
+			value:       value,
+			errorFormat: "failed to replay batch %d",
+			errorArgs:   seq,
+		}
+	}
+	if r.Len() != 0 {
+		return nil, malformed
+	}
+	return newBatchOf(writes), nil
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestReplayBatches(t *testing.T) {
+	// the log holds 3 batches, of which the last one is cut short as by a crash while writing it
+	var log bytes.Buffer
+	batch := NewBatch()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, batch.Put(bucket1, testK1[i], testV1[i], ""))
+	}
+	require.NoError(t, WriteBatch(&log, 1, batch))
+	batch = NewBatch()
+	require.NoError(t, batch.Delete(bucket1, testK1[0], ""))
+	require.NoError(t, batch.Put(bucket2, testK2[0], []byte{}, ""))
+	require.NoError(t, WriteBatch(&log, 2, batch))
+	complete := log.Len()
+	batch = NewBatch()
+	require.NoError(t, batch.Put(bucket2, testK2[1], testV2[1], ""))
+	require.NoError(t, WriteBatch(&log, 3, batch))
+	truncated := log.Bytes()[:log.Len()-3]
+
+	testReplayBatches := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+
+		// the replay stops cleanly at the truncated record, after the last complete batch
+		applied, err := ReplayBatches(kvStore, bytes.NewReader(truncated), 0)
+		require.NoError(err)
+		require.Equal(uint64(2), applied)
+		_, err = kvStore.Get(bucket1, testK1[0])
+		require.True(isNotExist(err))
+		for i := 1; i < 3; i++ {
+			value, err := kvStore.Get(bucket1, testK1[i])
+			require.NoError(err)
+			require.Equal(testV1[i], value)
+		}
+		value, err := kvStore.Get(bucket2, testK2[0])
+		require.NoError(err)
+		require.Empty(value)
+		_, err = kvStore.Get(bucket2, testK2[1])
+		require.True(isNotExist(err))
+
+		// replaying the full log from the last applied sequence only applies the batch left
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		applied, err = ReplayBatches(kvStore, bytes.NewReader(log.Bytes()), 2)
+		require.NoError(err)
+		require.Equal(uint64(1), applied)
+		value, err = kvStore.Get(bucket2, testK2[1])
+		require.NoError(err)
+		require.Equal(testV2[1], value)
+		value, err = kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testReplayBatches(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-replay-batches.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testReplayBatches(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-replay-batches.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testReplayBatches(NewOnDiskDB(dbCfg), t)
+	})
+
+	t.Run("Corrupted batch", func(t *testing.T) {
+		require := require.New(t)
+
+		corrupted := append([]byte(nil), log.Bytes()[:complete]...)
+		corrupted[complete-1] ^= 0xff
+		kvStore := NewMemKVStore()
+		applied, err := ReplayBatches(kvStore, bytes.NewReader(corrupted), 0)
+		require.Equal(ErrChecksumMismatch, errors.Cause(err))
+		require.Equal(uint64(1), applied)
+	})
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// samplePageSize is the number of keys read at a time while sampling
+const samplePageSize = 256
+
+// SampleKeys returns n keys of the namespace chosen at random by seed, in key order, or all keys if the namespace has
+// no more than n keys. The keys are visited in key order and sampled by reservoir sampling, so the same seed always
+// yields the same sample of the same keys, whichever backend keeps them, and no more than n keys are held in memory
+func SampleKeys(pager KeyPager, namespace string, n int, seed int64) ([][]byte, error) {
+	if n < 0 {
+		return nil, errors.Wrapf(ErrInvalidDB, "invalid sample size %d", n)
+	}
+	r := rand.New(rand.NewSource(seed))
+	sample := make([][]byte, 0, n)
+	seen := 0
+	var after []byte
+	for {
+		keys, cursor, err := pager.KeysPaged(namespace, after, samplePageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			seen++
+			if len(sample) < n {
+				sample = append(sample, key)
+			} else if i := r.Intn(seen); i < n {
+				sample[i] = key
+			}
+		}
+		if cursor == nil {
+			break
+		}
+		after = cursor
+	}
+	sort.Slice(sample, func(i, j int) bool { return bytes.Compare(sample[i], sample[j]) < 0 })
+	return sample, nil
+}
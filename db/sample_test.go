@@ -0,0 +1,79 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestSampleKeys(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	dbCfg := cfg
+	path := "test-sample-keys.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+
+	memStore := NewMemKVStore()
+	boltStore := NewOnDiskDB(dbCfg)
+	var all [][]byte
+	for _, kvStore := range []KVStore{memStore, boltStore} {
+		require.NoError(kvStore.Start(ctx))
+		defer func(kvStore KVStore) {
+			require.NoError(kvStore.Stop(ctx))
+		}(kvStore)
+		batch := NewBatch()
+		// more keys than a page
+		for i := 0; i < 1000; i++ {
+			batch.Put(bucket1, []byte(fmt.Sprintf("key_%04d", i)), testV1[0], "")
+		}
+		batch.Put(bucket2, []byte("key_0000"), testV1[0], "")
+		require.NoError(kvStore.Commit(batch))
+	}
+	for i := 0; i < 1000; i++ {
+		all = append(all, []byte(fmt.Sprintf("key_%04d", i)))
+	}
+
+	// the same seed yields the same sample on both backends
+	sample, err := SampleKeys(memStore.(KeyPager), bucket1, 10, 7)
+	require.NoError(err)
+	require.Len(sample, 10)
+	boltSample, err := SampleKeys(boltStore.(KeyPager), bucket1, 10, 7)
+	require.NoError(err)
+	require.Equal(sample, boltSample)
+	again, err := SampleKeys(memStore.(KeyPager), bucket1, 10, 7)
+	require.NoError(err)
+	require.Equal(sample, again)
+
+	// another seed yields another sample
+	other, err := SampleKeys(memStore.(KeyPager), bucket1, 10, 8)
+	require.NoError(err)
+	require.Len(other, 10)
+	require.NotEqual(sample, other)
+
+	// all keys are returned if there are no more than n
+	for _, n := range []int{1000, 2000} {
+		sample, err = SampleKeys(boltStore.(KeyPager), bucket1, n, 7)
+		require.NoError(err)
+		require.Equal(all, sample)
+	}
+	sample, err = SampleKeys(boltStore.(KeyPager), bucket1, 0, 7)
+	require.NoError(err)
+	require.Empty(sample)
+	_, err = SampleKeys(boltStore.(KeyPager), bucket1, -1, 7)
+	require.Equal(ErrInvalidDB, errors.Cause(err))
+}
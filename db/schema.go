@@ -0,0 +1,186 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/logger"
+)
+
+// schemaNamespace is the namespace keeping the schema version of the DB
+const schemaNamespace = "schema"
+
+// schemaVersionKey is the key of the schema version in schemaNamespace
+var schemaVersionKey = []byte("version")
+
+type (
+	// SchemaVersioner is the interface of KV store which records the version of the schema of its DB
+	SchemaVersioner interface {
+		// SchemaVersion returns the schema version recorded in the DB, 0 if none is recorded
+		SchemaVersion() (uint32, error)
+	}
+
+	// SchemaMigrations is the migrations of the schema of a DB, each upgrading the records of a version to a later
+	// version. It is safe for concurrent use
+	SchemaMigrations struct {
+		mutex sync.RWMutex
+		steps map[uint32]schemaMigration
+	}
+
+	// schemaMigration is a migration to the version
+	schemaMigration struct {
+		to uint32
+		fn func(KVStore) error
+	}
+)
+
+// NewSchemaMigrations returns an empty set of migrations
+func NewSchemaMigrations() *SchemaMigrations {
+	return &SchemaMigrations{steps: make(map[uint32]schemaMigration)}
+}
+
+// RegisterMigration registers fn to upgrade a DB from version from to version to, which must be later. A version has
+// at most one migration from it, so the upgrade of a DB follows a single chain of migrations
+func (m *SchemaMigrations) RegisterMigration(from, to uint32, fn func(KVStore) error) error {
+	if to <= from {
+		return errors.Wrapf(ErrInvalidDB, "migration from version %d to %d is not an upgrade", from, to)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if step, ok := m.steps[from]; ok {
+		return errors.Wrapf(ErrInvalidDB, "migration from version %d to %d is registered already", from, step.to)
+	}
+	m.steps[from] = schemaMigration{to: to, fn: fn}
+	return nil
+}
+
+// SchemaVersion returns the schema version recorded in BoltDB
+func (b *boltDB) SchemaVersion() (uint32, error) {
+	return schemaVersion(b)
+}
+
+// SchemaVersion returns the schema version recorded in BadgerDB
+func (b *badgerDB) SchemaVersion() (uint32, error) {
+	return schemaVersion(b)
+}
+
+// SchemaVersion returns the schema version recorded in the in-memory KV store
+func (m *memKVStore) SchemaVersion() (uint32, error) {
+	return schemaVersion(m)
+}
+
+//======================================
+// private functions
+//======================================
+
+// schemaVersion reads the schema version recorded in the KV store, 0 if none is recorded
+func schemaVersion(kvStore KVStore) (uint32, error) {
+	value, err := kvStore.Get(schemaNamespace, schemaVersionKey)
+	if isNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get schema version")
+	}
+	return decodeSchemaVersion(value)
+}
+
+// putSchemaVersion records the schema version in the KV store
+func putSchemaVersion(kvStore KVStore, options kvStoreOptions, version uint32) error {
+	if manager, ok := kvStore.(NamespaceManager); ok && options.explicitNamespaces {
+		if err := manager.CreateNamespace(schemaNamespace); err != nil {
+			return err
+		}
+	}
+	value := make([]byte, 4)
+	binary.BigEndian.PutUint32(value, version)
+	return errors.Wrap(kvStore.Put(schemaNamespace, schemaVersionKey, value), "failed to put schema version")
+}
+
+// upgradeSchema brings the schema of the started KV store to the version of WithSchema. A DB without records is
+// recorded at the version right away, one with records but no version is taken as version 0, and the migrations are run
+// in order from the version of the DB, recording the version after each of them so that an interrupted upgrade resumes
+// from the last one done. It fails with ErrSchemaTooNew if the DB is of a later version, which the binary does not
+// understand
+func upgradeSchema(kvStore KVStore, options kvStoreOptions) error {
+	if options.schemaVersion == 0 {
+		return nil
+	}
+	current, err := schemaVersion(kvStore)
+	if err != nil {
+		return err
+	}
+	if current == options.schemaVersion {
+		return nil
+	}
+	if current > options.schemaVersion {
+		return errors.Wrapf(ErrSchemaTooNew, "DB is of version %d, later than version %d", current,
+			options.schemaVersion)
+	}
+	if current == 0 {
+		empty := false
+		if checker, ok := kvStore.(EmptyChecker); ok {
+			if empty, err = checker.IsEmpty(); err != nil {
+				return err
+			}
+		}
+		if empty {
+			return putSchemaVersion(kvStore, options, options.schemaVersion)
+		}
+	}
+	for current < options.schemaVersion {
+		step, ok := options.migrations.step(current)
+		if !ok {
+			return errors.Wrapf(ErrInvalidDB, "no migration from version %d", current)
+		}
+		if step.to > options.schemaVersion {
+			return errors.Wrapf(ErrInvalidDB, "migration from version %d to %d skips version %d", current, step.to,
+				options.schemaVersion)
+		}
+		if err := step.fn(kvStore); err != nil {
+			return errors.Wrapf(err, "failed to migrate from version %d to %d", current, step.to)
+		}
+		if err := putSchemaVersion(kvStore, options, step.to); err != nil {
+			return err
+		}
+		logger.Info().Uint32("from", current).Uint32("to", step.to).Msg("Migrated the schema of DB.")
+		current = step.to
+	}
+	return nil
+}
+
+// startWithSchema starts the KV store by start, and upgrades its schema. The KV store is stopped if the upgrade fails
+func startWithSchema(ctx context.Context, kvStore KVStore, options kvStoreOptions, start func() error) error {
+	if err := start(); err != nil {
+		return err
+	}
+	if err := upgradeSchema(kvStore, options); err != nil {
+		if stopErr := kvStore.Stop(ctx); stopErr != nil {
+			logger.Error().Err(stopErr).Msg("Failed to stop the KV store failing to upgrade its schema.")
+		}
+		return err
+	}
+	return nil
+}
+
+// step returns the migration from the version
+func (m *SchemaMigrations) step(from uint32) (schemaMigration, bool) {
+	if m == nil {
+		return schemaMigration{}, false
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	step, ok := m.steps[from]
+	return step, ok
+}
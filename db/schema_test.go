@@ -0,0 +1,128 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestSchemaVersion(t *testing.T) {
+	testSchema := func(newKVStore func(...KVStoreOption) KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		// a DB with records but no version is of version 0, which needs a migration
+		kvStore := newKVStore()
+		require.NoError(kvStore.Start(ctx))
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		version, err := kvStore.(SchemaVersioner).SchemaVersion()
+		require.NoError(err)
+		require.Equal(uint32(0), version)
+		require.NoError(kvStore.Stop(ctx))
+		kvStore = newKVStore(WithSchema(1, nil))
+		require.Equal(ErrInvalidDB, errors.Cause(kvStore.Start(ctx)))
+
+		// the migrations are chained in order, each recording the version it upgrades to
+		var migrated []string
+		migrations := NewSchemaMigrations()
+		for _, step := range [][2]uint32{{0, 1}, {1, 3}, {3, 4}} {
+			from, to := step[0], step[1]
+			require.NoError(migrations.RegisterMigration(from, to, func(kvStore KVStore) error {
+				version, err := kvStore.(SchemaVersioner).SchemaVersion()
+				require.NoError(err)
+				require.Equal(from, version)
+				migrated = append(migrated, fmt.Sprintf("%d->%d", from, to))
+				value, err := kvStore.Get(bucket1, testK1[0])
+				if err != nil {
+					return err
+				}
+				return kvStore.Put(bucket1, testK1[0], append(value, byte(to)))
+			}))
+		}
+		require.Equal(ErrInvalidDB, errors.Cause(migrations.RegisterMigration(1, 2, nil)))
+		require.Equal(ErrInvalidDB, errors.Cause(migrations.RegisterMigration(5, 5, nil)))
+		kvStore = newKVStore(WithSchema(3, migrations))
+		require.NoError(kvStore.Start(ctx))
+		require.Equal([]string{"0->1", "1->3"}, migrated)
+		version, err = kvStore.(SchemaVersioner).SchemaVersion()
+		require.NoError(err)
+		require.Equal(uint32(3), version)
+		value, err := kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(append(append([]byte{}, testV1[0]...), 1, 3), value)
+		require.NoError(kvStore.Stop(ctx))
+
+		// the DB is not upgraded again, and an upgrade resumes from the version of the DB
+		kvStore = newKVStore(WithSchema(4, migrations))
+		require.NoError(kvStore.Start(ctx))
+		require.Equal([]string{"0->1", "1->3", "3->4"}, migrated)
+		require.NoError(kvStore.Stop(ctx))
+		require.NoError(kvStore.Start(ctx))
+		require.Len(migrated, 3)
+		require.NoError(kvStore.Stop(ctx))
+
+		// a DB of a later version is refused, and the KV store is left stopped
+		kvStore = newKVStore(WithSchema(3, migrations))
+		require.Equal(ErrSchemaTooNew, errors.Cause(kvStore.Start(ctx)))
+		_, err = kvStore.Get(bucket1, testK1[0])
+		require.Equal(ErrDBClosed, errors.Cause(err))
+
+		// a migration missing in the chain fails the start
+		kvStore = newKVStore(WithSchema(6, migrations))
+		require.Equal(ErrInvalidDB, errors.Cause(kvStore.Start(ctx)))
+		// a cleared DB is recorded at the version on next start
+		kvStore = newKVStore(WithSchema(4, migrations))
+		require.NoError(kvStore.Start(ctx))
+		require.NoError(kvStore.(Clearable).Clear())
+		require.NoError(kvStore.Stop(ctx))
+		kvStore = newKVStore(WithSchema(6, migrations))
+		require.NoError(kvStore.Start(ctx))
+		version, err = kvStore.(SchemaVersioner).SchemaVersion()
+		require.NoError(err)
+		require.Equal(uint32(6), version)
+		require.NoError(kvStore.Stop(ctx))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		require := require.New(t)
+		kvStore := NewMemKVStore(WithSchema(2, nil))
+		require.NoError(kvStore.Start(context.Background()))
+		version, err := kvStore.(SchemaVersioner).SchemaVersion()
+		require.NoError(err)
+		require.Equal(uint32(2), version)
+	})
+
+	dbCfg := cfg
+	path := "test-schema.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testSchema(func(opts ...KVStoreOption) KVStore {
+			return NewOnDiskDB(dbCfg, opts...)
+		}, t)
+	})
+
+	path = "test-schema.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testSchema(func(opts ...KVStoreOption) KVStore {
+			return NewOnDiskDB(dbCfg, opts...)
+		}, t)
+	})
+}
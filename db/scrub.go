@@ -0,0 +1,173 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/iotexproject/iotex-core/logger"
+)
+
+// scrubPageSize is the number of keys the scrubber lists at a time
+const scrubPageSize = 256
+
+var scrubCorruptMtc = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "iotex_db_scrub_corrupt_entries",
+		Help: "Number of corrupted records found by the scrubber.",
+	},
+	[]string{"namespace"},
+)
+
+func init() {
+	prometheus.MustRegister(scrubCorruptMtc)
+}
+
+// ScrubberOption sets an option of the scrubber
+type ScrubberOption func(*Scrubber)
+
+// Scrubber reads every record of the namespaces in the background, cycle after cycle, so that a value corrupted on
+// disk is found before a read hits it. It only reports the corrupted records, and never deletes them
+type Scrubber struct {
+	kvStore    KVStore
+	namespaces []string
+	rate       int
+	interval   time.Duration
+	report     func(string, []byte, error)
+	clk        clock.Clock
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewScrubber returns a scrubber of the namespaces of the KV store, which must implement KeyPager. It reads up to
+// rate records per second, so that scrubbing barely competes with the foreground reads and writes, and waits interval
+// between two cycles. A record whose read fails, e.g. with ErrChecksumMismatch for a namespace of WithChecksums, is
+// counted by the metric iotex_db_scrub_corrupt_entries and passed to report, if not nil, with the error
+func NewScrubber(
+	kvStore KVStore,
+	namespaces []string,
+	rate int,
+	interval time.Duration,
+	report func(namespace string, key []byte, err error),
+	opts ...ScrubberOption,
+) *Scrubber {
+	s := &Scrubber{
+		kvStore:    kvStore,
+		namespaces: namespaces,
+		rate:       rate,
+		interval:   interval,
+		report:     report,
+		clk:        clock.New(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithScrubberClock sets the clock pacing the reads and the cycles of the scrubber, which is the system clock by
+// default
+func WithScrubberClock(clk clock.Clock) ScrubberOption {
+	return func(s *Scrubber) {
+		s.clk = clk
+	}
+}
+
+// Start starts scrubbing in the background. The KV store must be started already
+func (s *Scrubber) Start(_ context.Context) error {
+	if _, ok := s.kvStore.(KeyPager); !ok {
+		return errors.Wrap(ErrInvalidDB, "KV store does not support listing keys")
+	}
+	if s.rate <= 0 {
+		return errors.Wrapf(ErrInvalidDB, "invalid scrub rate %d", s.rate)
+	}
+	if s.done != nil {
+		return nil
+	}
+	s.done = make(chan struct{})
+	s.wg.Add(1)
+	go s.scrub()
+	return nil
+}
+
+// Stop stops scrubbing, and waits for the record being read
+func (s *Scrubber) Stop(_ context.Context) error {
+	if s.done == nil {
+		return nil
+	}
+	close(s.done)
+	s.wg.Wait()
+	s.done = nil
+	return nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// scrub runs the cycles until the scrubber is stopped
+func (s *Scrubber) scrub() {
+	defer s.wg.Done()
+
+	ticker := s.clk.Ticker(time.Second / time.Duration(s.rate))
+	defer ticker.Stop()
+	for {
+		for _, namespace := range s.namespaces {
+			if !s.scrubNamespace(namespace, ticker.C) {
+				return
+			}
+		}
+		select {
+		case <-s.done:
+			return
+		case <-s.clk.After(s.interval):
+		}
+	}
+}
+
+// scrubNamespace reads the records of the namespace one per tick, and returns false once the scrubber is stopped
+func (s *Scrubber) scrubNamespace(namespace string, tick <-chan time.Time) bool {
+	pager := s.kvStore.(KeyPager)
+	after := []byte{}
+	for after != nil {
+		keys, next, err := pager.KeysPaged(namespace, after, scrubPageSize)
+		if err != nil {
+			if !isNotExist(err) {
+				logger.Error().Err(err).Str("namespace", namespace).Msg("Failed to list the keys to scrub.")
+			}
+			return true
+		}
+		for _, key := range keys {
+			select {
+			case <-s.done:
+				return false
+			case <-tick:
+			}
+			_, err := s.kvStore.Get(namespace, key)
+			switch {
+			case err == nil, isNotExist(err):
+				// the record may be deleted since it is listed
+			case errors.Cause(err) == ErrDBClosed:
+				return true
+			default:
+				scrubCorruptMtc.WithLabelValues(namespace).Inc()
+				logger.Error().Err(err).Str("namespace", namespace).Hex("key", key).Msg("Found corrupted record.")
+				if s.report != nil {
+					s.report(namespace, key, err)
+				}
+			}
+		}
+		after = next
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestScrubber(t *testing.T) {
+	type corruption struct {
+		namespace string
+		key       []byte
+		err       error
+	}
+
+	testScrubber := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		for i := 0; i < 3; i++ {
+			require.NoError(kvStore.Put(bucket1, testK1[i], testV1[i]))
+		}
+		// a byte of a stored value flips
+		raw := kvStore.(*checksumKVStore).kvStore
+		stored, err := raw.Get(bucket1, testK1[1])
+		require.NoError(err)
+		corrupted := append([]byte(nil), stored...)
+		corrupted[checksumSize] ^= 0x80
+		require.NoError(raw.Put(bucket1, testK1[1], corrupted))
+
+		reports := make(chan corruption, 16)
+		scrubber := NewScrubber(kvStore, []string{bucket1, bucket2}, 1000, 10*time.Millisecond,
+			func(namespace string, key []byte, err error) {
+				select {
+				case reports <- corruption{namespace: namespace, key: key, err: err}:
+				default:
+				}
+			})
+		require.NoError(scrubber.Start(ctx))
+		var report corruption
+		require.NoError(testutil.WaitUntil(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+			select {
+			case report = <-reports:
+				return true, nil
+			default:
+				return false, nil
+			}
+		}))
+		require.NoError(scrubber.Stop(ctx))
+
+		// only the corrupted record is reported, and it is kept
+		require.Equal(bucket1, report.namespace)
+		require.Equal(testK1[1], report.key)
+		require.Equal(ErrChecksumMismatch, errors.Cause(report.err))
+		for len(reports) > 0 {
+			require.Equal(testK1[1], (<-reports).key)
+		}
+		stored, err = raw.Get(bucket1, testK1[1])
+		require.NoError(err)
+		require.Equal(corrupted, stored)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testScrubber(NewMemKVStore(WithChecksums(bucket1)), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-scrubber.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testScrubber(NewOnDiskDB(dbCfg, WithChecksums(bucket1)), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-scrubber.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testScrubber(NewOnDiskDB(dbCfg, WithChecksums(bucket1)), t)
+	})
+
+	// the KV store must list its keys
+	require.Equal(t, ErrInvalidDB, errors.Cause(NewScrubber(&slowKVStore{}, nil, 1, time.Second, nil).Start(
+		context.Background())))
+}
+
+func TestScrubberClock(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	kvStore := NewMemKVStore(WithChecksums(bucket1))
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	require.NoError(kvStore.(*checksumKVStore).kvStore.Put(bucket1, testK1[0], []byte{1}))
+
+	var reports int32
+	clk := clock.NewMock()
+	scrubber := NewScrubber(kvStore, []string{bucket1}, 1, 10*time.Second, func(string, []byte, error) {
+		atomic.AddInt32(&reports, 1)
+	}, WithScrubberClock(clk))
+	require.NoError(scrubber.Start(ctx))
+	defer func() {
+		require.NoError(scrubber.Stop(ctx))
+	}()
+
+	// the record is read once the clock reaches the pace of the reads, and again after the interval between cycles
+	require.Equal(int32(0), atomic.LoadInt32(&reports))
+	for cycle := int32(1); cycle <= 2; cycle++ {
+		require.NoError(testutil.WaitUntil(5*time.Millisecond, time.Second, func() (bool, error) {
+			// the ticks of the mock clock are dropped unless the scrubber is waiting for them, so tick until it is
+			clk.Add(time.Second)
+			return atomic.LoadInt32(&reports) == cycle, nil
+		}))
+	}
+}
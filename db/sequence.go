@@ -0,0 +1,109 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Sequence hands out monotonically increasing IDs, e.g. block indexes or action sequences, never handing out an ID
+// twice even across restarts. It reserves the IDs a range at a time, by persisting the end of the range reserved, the
+// high-water mark, in the record of a key of the KV store, so that a write is made once per range rather than once
+// per ID. The IDs of a range left unused when the process stops are skipped, as the next Sequence of the key resumes
+// from the high-water mark. Unlike the Sequence of BadgerDB, it works on any KV store serving Modifier.
+//
+// A KV store created with options, e.g. WithChecksums or WithAuditLog, does not serve Modifier, and Sequence does not
+// look through the wrappers the options add for the backend, since a write to the backend would skip what they do to
+// the writes. The high-water marks must be kept in a KV store created without options instead
+type Sequence struct {
+	kvStore   KVStore
+	namespace string
+	key       []byte
+	rangeSize uint64
+	// mutex guards next, the next ID to hand out, and leased, the high-water mark of the range reserved
+	mutex  sync.Mutex
+	next   uint64
+	leased uint64
+}
+
+// NewSequence returns the sequence of the key of the namespace, which reserves rangeSize IDs at a time. The first ID
+// of a new sequence is 0. The KV store must be started before Next is called. The ranges are reserved by an atomic
+// read-modify-write, so multiple Sequence of the same key hand out distinct IDs. The KV store must serve Modifier as
+// reported by Capabilities, otherwise Next returns ErrInvalidDB rather than risk handing out an ID twice
+func NewSequence(store KVStore, namespace string, key []byte, rangeSize uint64) *Sequence {
+	return &Sequence{
+		kvStore:   store,
+		namespace: namespace,
+		key:       append([]byte(nil), key...),
+		rangeSize: rangeSize,
+	}
+}
+
+// Next returns the next ID, reserving the next range first if the IDs of the range reserved are all handed out
+func (s *Sequence) Next() (uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.next == s.leased {
+		if err := s.lease(); err != nil {
+			return 0, err
+		}
+	}
+	id := s.next
+	s.next++
+	return id, nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// lease reserves the range after the high-water mark persisted, and moves the mark past it
+func (s *Sequence) lease() error {
+	if s.rangeSize == 0 {
+		return errors.Wrap(ErrInvalidDB, "invalid sequence range size 0")
+	}
+	// a read followed by a write would let two sequences of the key reserve the same range
+	if !Capabilities(s.kvStore).Has(CapModifier) {
+		return errors.Wrapf(ErrInvalidDB, "KV store of sequence %x is unable to modify a record atomically", s.key)
+	}
+	var start uint64
+	reserve := func(old []byte, existed bool) ([]byte, bool, error) {
+		mark, err := decodeSequenceMark(old, existed)
+		if err != nil {
+			return nil, false, err
+		}
+		if mark > math.MaxUint64-s.rangeSize {
+			return nil, false, errors.Wrapf(ErrInvalidDB, "sequence %x of namespace %s exhausted", s.key, s.namespace)
+		}
+		start = mark
+		value := make([]byte, 8)
+		binary.BigEndian.PutUint64(value, mark+s.rangeSize)
+		return value, false, nil
+	}
+
+	if err := s.kvStore.(Modifier).Modify(s.namespace, s.key, reserve); err != nil {
+		return errors.Wrapf(err, "failed to reserve the range of sequence %x", s.key)
+	}
+	s.next, s.leased = start, start+s.rangeSize
+	return nil
+}
+
+// decodeSequenceMark decodes the high-water mark of a sequence, 0 if there is none yet
+func decodeSequenceMark(value []byte, existed bool) (uint64, error) {
+	if !existed {
+		return 0, nil
+	}
+	if len(value) != 8 {
+		return 0, errors.Wrap(ErrInvalidDB, "malformed high-water mark of sequence")
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
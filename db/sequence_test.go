@@ -0,0 +1,137 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestSequence(t *testing.T) {
+	seqKey := []byte("blockIndex")
+
+	testSequence := func(newKVStore func() KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		kvStore := newKVStore()
+		require.NoError(kvStore.Start(ctx))
+		mark := func() uint64 {
+			value, err := kvStore.Get(bucket1, seqKey)
+			require.NoError(err)
+			return binary.BigEndian.Uint64(value)
+		}
+
+		// the IDs increase by 1, and the high-water mark is moved once per range of 10
+		seq := NewSequence(kvStore, bucket1, seqKey, 10)
+		for i := uint64(0); i < 25; i++ {
+			id, err := seq.Next()
+			require.NoError(err)
+			require.Equal(i, id)
+			require.Equal((i/10+1)*10, mark())
+		}
+
+		// a restart resumes past the range reserved, skipping its unused tail
+		require.NoError(kvStore.Stop(ctx))
+		kvStore = newKVStore()
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		seq = NewSequence(kvStore, bucket1, seqKey, 10)
+		id, err := seq.Next()
+		require.NoError(err)
+		require.Equal(uint64(30), id)
+		require.Equal(uint64(40), mark())
+
+		// the sequences of the same key hand out distinct IDs, each in increasing order
+		var (
+			wg    sync.WaitGroup
+			mutex sync.Mutex
+			ids   = make(map[uint64]struct{})
+		)
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(seq *Sequence) {
+				defer wg.Done()
+				last := uint64(0)
+				for j := 0; j < 100; j++ {
+					id, err := seq.Next()
+					require.NoError(err)
+					require.True(id > last)
+					last = id
+					mutex.Lock()
+					ids[id] = struct{}{}
+					mutex.Unlock()
+				}
+			}(NewSequence(kvStore, bucket1, seqKey, 7))
+		}
+		wg.Wait()
+		require.Len(ids, 400)
+		_, reused := ids[30]
+		require.False(reused)
+
+		_, err = NewSequence(kvStore, bucket1, []byte("empty"), 0).Next()
+		require.Equal(ErrInvalidDB, errors.Cause(err))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		// the in-memory KV store keeps its records across a restart
+		kvStore := NewMemKVStore()
+		testSequence(func() KVStore { return kvStore }, t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-sequence.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testSequence(func() KVStore { return NewOnDiskDB(dbCfg) }, t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-sequence.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testSequence(func() KVStore { return NewOnDiskDB(dbCfg) }, t)
+	})
+
+	t.Run("Wrapped KV Store", func(t *testing.T) {
+		// the wrappers of the options do not modify a record atomically, so no range is reserved through them
+		testWrapped := func(kvStore KVStore, t *testing.T) {
+			require := require.New(t)
+			ctx := context.Background()
+
+			require.False(Capabilities(kvStore).Has(CapModifier))
+			require.NoError(kvStore.Start(ctx))
+			defer func() {
+				require.NoError(kvStore.Stop(ctx))
+			}()
+			_, err := NewSequence(kvStore, bucket1, seqKey, 10).Next()
+			require.Equal(ErrInvalidDB, errors.Cause(err))
+			_, err = kvStore.Get(bucket1, seqKey)
+			require.True(isNotExist(err))
+		}
+
+		testWrapped(NewMemKVStore(WithChecksums(bucket1), WithAuditLog(0, false)), t)
+		path := "test-sequence-wrapped.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testWrapped(NewOnDiskDB(dbCfg, WithTimestamps(bucket1)), t)
+	})
+}
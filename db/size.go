@@ -0,0 +1,84 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/boltdb/bolt"
+)
+
+// Size returns the size of the pages of BoltDB in use, which excludes the free pages the file keeps for reuse
+func (b *boltDB) Size() (int64, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return 0, ErrDBClosed
+	}
+
+	var size int64
+	if err := b.db.View(func(tx *bolt.Tx) error {
+		size = tx.Size()
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	stats := b.db.Stats()
+	size -= int64(stats.FreePageN+stats.PendingPageN) * int64(b.db.Info().PageSize)
+	return size, nil
+}
+
+// Size returns the size of the tables and value logs of BadgerDB on disk
+func (b *badgerDB) Size() (int64, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return 0, ErrDBClosed
+	}
+	return filesSize(b.path, "*.sst") + valueLogSize(b.path), nil
+}
+
+// Size returns the size of the keys and values held by the in-memory KV store
+func (m *memKVStore) Size() (int64, error) {
+	m.rlockAll()
+	defer m.runlockAll()
+
+	var size int64
+	for _, shard := range m.shards {
+		for _, bucket := range shard.bucket {
+			for k, v := range bucket {
+				// a record of nil value is reported as not existing
+				if v != nil {
+					size += int64(len(k) + len(v))
+				}
+			}
+		}
+	}
+	return size, nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// filesSize returns the total size of the files under the path matching the pattern
+func filesSize(path, pattern string) int64 {
+	files, err := filepath.Glob(filepath.Join(path, pattern))
+	if err != nil {
+		return 0
+	}
+	var size int64
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	// statsPageSize is the number of keys listed at a time to count the keys of a namespace
+	statsPageSize = 1024
+	// statsSampleSize is the number of records of a namespace whose values are read to estimate its size, the size of
+	// the other records is extrapolated from them
+	statsSampleSize = 256
+)
+
+type (
+	// DBStats is a snapshot of the statistics of a KV store, gathered from the interfaces it serves. A statistic of an
+	// interface the KV store does not serve is left nil
+	DBStats struct {
+		// Size is the size of the DB as reported by Sizer, 0 if the KV store is not a Sizer
+		Size int64
+		// Namespaces is the statistics of each namespace
+		Namespaces map[string]NamespaceStats
+		// ReadTxns is the statistics of the read transactions open, as reported by ReadTxnObserver
+		ReadTxns *ReadTxnStats
+		// Cache is the statistics of the read cache of a CachedKVStore, and CacheHitRate the ratio of the Get served
+		// from the cache, 0 if none is made yet
+		Cache        *CacheStats
+		CacheHitRate float64
+		// ValueLogGC is the statistics of the value log GC, including its last run, as reported by ValueLogGCObserver
+		ValueLogGC *ValueLogGCStats
+		// LSM is the shape of the LSM tree, as reported by LSMStatsReporter
+		LSM *LSMStats
+		// Sequence is the sequence of the last commit of a WatchableKVStore, 0 otherwise
+		Sequence uint64
+	}
+
+	// NamespaceStats is the statistics of a namespace
+	NamespaceStats struct {
+		// Keys is the number of keys
+		Keys uint64
+		// Size is the total length of the keys and values, estimated from a sample of the records if Approximate
+		Size        int64
+		Approximate bool
+	}
+)
+
+// Stats gathers the statistics of the KV store at once, e.g. for a dashboard polling it every few seconds. The
+// statistics of the namespaces, which the KV store must be a KeyPager to gather, are those of the namespaces given, or
+// of all namespaces if none is given and the KV store is able to list them, as BoltDB and the in-memory KV store are.
+// The keys of each namespace are counted by listing them, which costs a read of every key, while the size is
+// extrapolated from the values of its first statsSampleSize records, so that a namespace of large values costs no
+// more than one of small values. The other statistics are read from the counters the KV store keeps, which costs
+// next to nothing
+func Stats(kvStore KVStore, namespaces ...string) (DBStats, error) {
+	var stats DBStats
+	if sizer, ok := kvStore.(Sizer); ok {
+		size, err := sizer.Size()
+		if err != nil {
+			return stats, errors.Wrap(err, "failed to get the size of the DB")
+		}
+		stats.Size = size
+	}
+	if lister, ok := kvStore.(namespaceLister); ok && len(namespaces) == 0 {
+		names, err := lister.namespaceNames()
+		if err != nil {
+			return stats, errors.Wrap(err, "failed to list namespaces")
+		}
+		namespaces = names
+	}
+	if pager, ok := kvStore.(KeyPager); ok {
+		stats.Namespaces = make(map[string]NamespaceStats, len(namespaces))
+		for _, namespace := range namespaces {
+			ns, err := namespaceStats(kvStore, pager, namespace)
+			if err != nil {
+				return stats, err
+			}
+			stats.Namespaces[namespace] = ns
+		}
+	}
+	if observer, ok := kvStore.(ReadTxnObserver); ok {
+		readTxns := observer.Stats()
+		stats.ReadTxns = &readTxns
+	}
+	if cached, ok := kvStore.(CachedKVStore); ok {
+		cache := cached.Stats()
+		stats.Cache = &cache
+		if reads := cache.Hits + cache.NegativeHits + cache.Misses; reads > 0 {
+			stats.CacheHitRate = float64(cache.Hits+cache.NegativeHits) / float64(reads)
+		}
+	}
+	if observer, ok := kvStore.(ValueLogGCObserver); ok {
+		gc := observer.Stats()
+		stats.ValueLogGC = &gc
+	}
+	if reporter, ok := kvStore.(LSMStatsReporter); ok {
+		lsm, err := reporter.LSMStats()
+		if err != nil {
+			return stats, errors.Wrap(err, "failed to get the statistics of the LSM tree")
+		}
+		stats.LSM = &lsm
+	}
+	if watchable, ok := kvStore.(WatchableKVStore); ok {
+		stats.Sequence = watchable.CurrentSequence()
+	}
+	return stats, nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// namespaceStats counts the keys of the namespace, and sums up the length of all keys and of the values of the first
+// statsSampleSize records, from which the length of the other values is extrapolated
+func namespaceStats(kvStore KVStore, pager KeyPager, namespace string) (NamespaceStats, error) {
+	var (
+		stats              NamespaceStats
+		sampled            int64
+		keySize, valueSize int64
+	)
+	after := []byte{}
+	for after != nil {
+		keys, next, err := pager.KeysPaged(namespace, after, statsPageSize)
+		if isNotExist(err) {
+			break
+		}
+		if err != nil {
+			return stats, errors.Wrapf(err, "failed to list the keys of namespace %s", namespace)
+		}
+		for _, key := range keys {
+			if sampled < statsSampleSize {
+				value, err := kvStore.Get(namespace, key)
+				if isNotExist(err) {
+					// deleted since listed
+					continue
+				}
+				if err != nil {
+					return stats, errors.Wrapf(err, "failed to get key = %x", key)
+				}
+				sampled++
+				valueSize += int64(len(value))
+			}
+			stats.Keys++
+			keySize += int64(len(key))
+		}
+		after = next
+	}
+	stats.Size = keySize + valueSize
+	if unsampled := int64(stats.Keys) - sampled; unsampled > 0 {
+		// the values beyond the sample are taken as long as the average of the sample
+		stats.Approximate = true
+		stats.Size += unsampled * valueSize / sampled
+	}
+	return stats, nil
+}
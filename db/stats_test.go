@@ -0,0 +1,137 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestStats(t *testing.T) {
+	// bucket2 holds more records than the sample, of values of the same length so that its size is extrapolated exactly
+	const numRecords = 1000
+	populate := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		batch := NewBatch()
+		for i := 0; i < 3; i++ {
+			require.NoError(batch.Put(bucket1, testK1[i], testV1[i], ""))
+		}
+		for i := 0; i < numRecords; i++ {
+			require.NoError(batch.Put(bucket2, []byte(fmt.Sprintf("key-%04d", i)), []byte("value-08"), ""))
+		}
+		require.NoError(kvStore.Commit(batch))
+	}
+	checkNamespaces := func(stats DBStats, t *testing.T) {
+		require := require.New(t)
+		var size int64
+		for i := 0; i < 3; i++ {
+			size += int64(len(testK1[i]) + len(testV1[i]))
+		}
+		require.Equal(NamespaceStats{Keys: 3, Size: size}, stats.Namespaces[bucket1])
+		require.Equal(NamespaceStats{Keys: numRecords, Size: numRecords * 16, Approximate: true},
+			stats.Namespaces[bucket2])
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		kvStore := NewMemKVStore()
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		populate(kvStore, t)
+		stats, err := Stats(kvStore)
+		require.NoError(err)
+		checkNamespaces(stats, t)
+		require.Equal(stats.Namespaces[bucket1].Size+stats.Namespaces[bucket2].Size, stats.Size)
+		require.Nil(stats.ReadTxns)
+		require.Nil(stats.Cache)
+		require.Nil(stats.ValueLogGC)
+		require.Nil(stats.LSM)
+	})
+	t.Run("Cached and watchable KV store", func(t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		watchable := NewWatchableKVStore(NewMemKVStore())
+		require.NoError(watchable.Start(ctx))
+		defer func() {
+			require.NoError(watchable.Stop(ctx))
+		}()
+		populate(watchable, t)
+		require.NoError(watchable.Put(bucket1, testK1[0], testV1[1]))
+		stats, err := Stats(watchable)
+		require.NoError(err)
+		require.Equal(uint64(2), stats.Sequence)
+
+		// one Get of the three misses the cache
+		cached := NewCachedKVStore(watchable, 16)
+		for i := 0; i < 3; i++ {
+			_, err := cached.Get(bucket1, testK1[0])
+			require.NoError(err)
+		}
+		stats, err = Stats(cached)
+		require.NoError(err)
+		require.NotNil(stats.Cache)
+		require.Equal(uint64(2), stats.Cache.Hits)
+		require.Equal(uint64(1), stats.Cache.Misses)
+		require.InDelta(2.0/3, stats.CacheHitRate, 1e-9)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		path := "test-stats.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		kvStore := NewOnDiskDB(dbCfg)
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		populate(kvStore, t)
+		stats, err := Stats(kvStore)
+		require.NoError(err)
+		checkNamespaces(stats, t)
+		require.True(stats.Size > 0)
+		require.NotNil(stats.ReadTxns)
+		require.Equal(0, stats.ReadTxns.Open)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		path := "test-stats.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		kvStore := NewOnDiskDB(dbCfg)
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		populate(kvStore, t)
+		// BadgerDB is unable to list its namespaces, so they are given
+		stats, err := Stats(kvStore, bucket1, bucket2)
+		require.NoError(err)
+		checkNamespaces(stats, t)
+		require.NotNil(stats.ValueLogGC)
+		require.Zero(stats.ValueLogGC.Runs)
+		require.NotNil(stats.LSM)
+	})
+}
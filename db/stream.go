@@ -0,0 +1,276 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/logger"
+)
+
+// streamNamespace is the namespace keeping the chunks of the values written by PutStream
+const streamNamespace = "streamedValues"
+
+// streamChunkSize is the size of the chunks a streamed value is split into
+const streamChunkSize = 1 << 20
+
+type (
+	// ValueStreamer is the interface of KV store which is able to write and read values too large to hold in memory,
+	// which are split into chunks kept as records of their own. A streamed value is only visible to the methods of
+	// ValueStreamer, and is not a record of the namespace for the other methods
+	ValueStreamer interface {
+		// PutStream writes the value read from the reader until EOF, replacing the value streamed before under
+		// (namespace, key). The chunks are written as they are read, and the value is only visible once all of them
+		// are written
+		PutStream(string, []byte, io.Reader) error
+		// GetStream returns a reader of the value streamed under (namespace, key), which reads a chunk at a time. A
+		// read fails with ErrNotExist if the value is replaced or deleted meanwhile
+		GetStream(string, []byte) (io.ReadCloser, error)
+		// DeleteStream deletes the value streamed under (namespace, key) and all its chunks, in one transaction
+		DeleteStream(string, []byte) error
+	}
+
+	// streamManifest is the chunks of a streamed value, written under the generation of the PutStream writing them
+	streamManifest struct {
+		generation []byte
+		chunks     uint64
+	}
+
+	// streamReader reads the chunks of a streamed value one after another
+	streamReader struct {
+		kvStore  KVStore
+		base     []byte
+		manifest streamManifest
+		next     uint64
+		chunk    []byte
+	}
+)
+
+// PutStream writes a value too large to hold in memory in chunks into BoltDB
+func (b *boltDB) PutStream(namespace string, key []byte, r io.Reader) error {
+	return putStream(b, namespace, key, r)
+}
+
+// GetStream returns a reader of a value written by PutStream into BoltDB
+func (b *boltDB) GetStream(namespace string, key []byte) (io.ReadCloser, error) {
+	return getStream(b, namespace, key)
+}
+
+// DeleteStream deletes a value written by PutStream from BoltDB
+func (b *boltDB) DeleteStream(namespace string, key []byte) error {
+	return deleteStream(b, namespace, key)
+}
+
+// PutStream writes a value too large to hold in memory in chunks into BadgerDB
+func (b *badgerDB) PutStream(namespace string, key []byte, r io.Reader) error {
+	return putStream(b, namespace, key, r)
+}
+
+// GetStream returns a reader of a value written by PutStream into BadgerDB
+func (b *badgerDB) GetStream(namespace string, key []byte) (io.ReadCloser, error) {
+	return getStream(b, namespace, key)
+}
+
+// DeleteStream deletes a value written by PutStream from BadgerDB
+func (b *badgerDB) DeleteStream(namespace string, key []byte) error {
+	return deleteStream(b, namespace, key)
+}
+
+// PutStream writes a value in chunks into the in-memory KV store
+func (m *memKVStore) PutStream(namespace string, key []byte, r io.Reader) error {
+	return putStream(m, namespace, key, r)
+}
+
+// GetStream returns a reader of a value written by PutStream into the in-memory KV store
+func (m *memKVStore) GetStream(namespace string, key []byte) (io.ReadCloser, error) {
+	return getStream(m, namespace, key)
+}
+
+// DeleteStream deletes a value written by PutStream from the in-memory KV store
+func (m *memKVStore) DeleteStream(namespace string, key []byte) error {
+	return deleteStream(m, namespace, key)
+}
+
+// Read reads the value, getting the next chunk once the current one is read
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		if r.next == r.manifest.chunks {
+			return 0, io.EOF
+		}
+		chunk, err := r.kvStore.Get(streamNamespace, streamChunkKey(r.base, r.manifest.generation, r.next))
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to get chunk %d of streamed value", r.next)
+		}
+		r.chunk = chunk
+		r.next++
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+// Close drops the chunk being read
+func (r *streamReader) Close() error {
+	r.chunk = nil
+	r.next = r.manifest.chunks
+	return nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// putStream writes the chunks of the value under a new generation, each as a record of its own, and then replaces
+// the manifest of the value and deletes the chunks it referenced in one transaction. The chunks written are deleted
+// if it fails before the manifest is replaced
+func putStream(kvStore KVStore, namespace string, key []byte, r io.Reader) (e error) {
+	if err := createStreamNamespace(kvStore); err != nil {
+		return err
+	}
+	base := streamBaseKey(namespace, key)
+	manifest := streamManifest{generation: make([]byte, 8)}
+	if _, err := rand.Read(manifest.generation); err != nil {
+		return errors.Wrap(err, "failed to generate the generation of streamed value")
+	}
+	defer func() {
+		if e == nil {
+			return
+		}
+		for i := uint64(0); i < manifest.chunks; i++ {
+			if err := kvStore.Delete(streamNamespace, streamChunkKey(base, manifest.generation, i)); err != nil {
+				logger.Error().Err(err).Msg("Failed to delete the chunk of a failed stream.")
+			}
+		}
+	}()
+
+	buf := make([]byte, streamChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			// the in-memory KV store keeps the value as is, so the buffer is not reused for it
+			chunk := append([]byte(nil), buf[:n]...)
+			k := streamChunkKey(base, manifest.generation, manifest.chunks)
+			if err := kvStore.Put(streamNamespace, k, chunk); err != nil {
+				return errors.Wrapf(err, "failed to put chunk %d of streamed value", manifest.chunks)
+			}
+			manifest.chunks++
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read streamed value")
+		}
+	}
+	return updateStream(kvStore, func(tx Tx) error {
+		if err := deleteChunks(tx, base); err != nil {
+			return err
+		}
+		return tx.Put(streamNamespace, base, manifest.encode())
+	})
+}
+
+// getStream reads the manifest of the value, and returns the reader of its chunks
+func getStream(kvStore KVStore, namespace string, key []byte) (io.ReadCloser, error) {
+	base := streamBaseKey(namespace, key)
+	value, err := kvStore.Get(streamNamespace, base)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get streamed value of key = %x", key)
+	}
+	manifest, err := decodeStreamManifest(value)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{kvStore: kvStore, base: base, manifest: manifest}, nil
+}
+
+// deleteStream deletes the manifest and the chunks of the value in one transaction
+func deleteStream(kvStore KVStore, namespace string, key []byte) error {
+	base := streamBaseKey(namespace, key)
+	return updateStream(kvStore, func(tx Tx) error {
+		return deleteChunks(tx, base)
+	})
+}
+
+// updateStream calls fn within a read-write transaction of the KV store
+func updateStream(kvStore KVStore, fn func(Tx) error) error {
+	updater, ok := kvStore.(Updater)
+	if !ok {
+		return errors.Wrap(ErrInvalidDB, "KV store does not support transactions")
+	}
+	return updater.Update(fn)
+}
+
+// deleteChunks deletes the manifest and the chunks of the value of the base key, if any
+func deleteChunks(tx Tx, base []byte) error {
+	value, err := tx.Get(streamNamespace, base)
+	if isNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	manifest, err := decodeStreamManifest(value)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < manifest.chunks; i++ {
+		if err := tx.Delete(streamNamespace, streamChunkKey(base, manifest.generation, i)); err != nil {
+			return err
+		}
+	}
+	return tx.Delete(streamNamespace, base)
+}
+
+// createStreamNamespace creates the namespace of the chunks, which must be created in explicit namespace mode
+func createStreamNamespace(kvStore KVStore) error {
+	return createReservedNamespace(kvStore, streamNamespace)
+}
+
+// streamBaseKey returns the key of the manifest of the value, which is the namespace and the key each prefixed with
+// its length, so that the key of a chunk, which is the base key followed by the generation and the index, never
+// collides with the one of another value
+func streamBaseKey(namespace string, key []byte) []byte {
+	n := make([]byte, binary.MaxVarintLen64)
+	base := append([]byte(nil), n[:binary.PutUvarint(n, uint64(len(namespace)))]...)
+	base = append(base, namespace...)
+	base = append(base, n[:binary.PutUvarint(n, uint64(len(key)))]...)
+	return append(base, key...)
+}
+
+// streamChunkKey returns the key of the chunk of the index written under the generation
+func streamChunkKey(base, generation []byte, index uint64) []byte {
+	k := make([]byte, len(base), len(base)+len(generation)+8)
+	copy(k, base)
+	k = append(k, generation...)
+	i := make([]byte, 8)
+	binary.BigEndian.PutUint64(i, index)
+	return append(k, i...)
+}
+
+// encode encodes the manifest as the generation followed by the number of chunks
+func (m streamManifest) encode() []byte {
+	value := make([]byte, 16)
+	copy(value, m.generation)
+	binary.BigEndian.PutUint64(value[8:], m.chunks)
+	return value
+}
+
+// decodeStreamManifest decodes the manifest of a streamed value
+func decodeStreamManifest(value []byte) (streamManifest, error) {
+	if len(value) != 16 {
+		return streamManifest{}, errors.Wrap(ErrInvalidDB, "malformed manifest of streamed value")
+	}
+	return streamManifest{
+		generation: append([]byte(nil), value[:8]...),
+		chunks:     binary.BigEndian.Uint64(value[8:]),
+	}, nil
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+// failingReader reads the reader, and then fails
+type failingReader struct {
+	io.Reader
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		return n, errors.New("read failure")
+	}
+	return n, err
+}
+
+func TestValueStreamer(t *testing.T) {
+	testStream := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		streamer, ok := kvStore.(ValueStreamer)
+		require.True(ok)
+		read := func(key []byte) []byte {
+			r, err := streamer.GetStream(bucket1, key)
+			require.NoError(err)
+			defer func() {
+				require.NoError(r.Close())
+			}()
+			value, err := ioutil.ReadAll(r)
+			require.NoError(err)
+			return value
+		}
+		records := func() int {
+			n := 0
+			require.NoError(kvStore.(Streamer).StreamAll(streamNamespace, func([]byte, []byte) error {
+				n++
+				return nil
+			}))
+			return n
+		}
+
+		// a value of 2.5 chunks is written in 3 chunks and a manifest
+		value := make([]byte, streamChunkSize*5/2)
+		rand.New(rand.NewSource(1)).Read(value)
+		require.NoError(streamer.PutStream(bucket1, testK1[0], bytes.NewReader(value)))
+		require.Equal(value, read(testK1[0]))
+		require.Equal(4, records())
+		// the streamed value is not a record of the namespace
+		_, err := kvStore.Get(bucket1, testK1[0])
+		require.True(isNotExist(err))
+
+		// a value of another key is apart, and an empty value has no chunk
+		require.NoError(streamer.PutStream(bucket1, testK1[1], bytes.NewReader(nil)))
+		require.Equal([]byte{}, read(testK1[1]))
+		require.Equal(5, records())
+
+		// a replaced value leaves no chunk of the former one behind
+		require.NoError(streamer.PutStream(bucket1, testK1[0], bytes.NewReader(value[:streamChunkSize])))
+		require.Equal(value[:streamChunkSize], read(testK1[0]))
+		require.Equal(3, records())
+
+		// a failed stream leaves the value as it is
+		err = streamer.PutStream(bucket1, testK1[0], failingReader{bytes.NewReader(value)})
+		require.Error(err)
+		require.Equal(value[:streamChunkSize], read(testK1[0]))
+		require.Equal(3, records())
+
+		// the deletion removes all chunks
+		require.NoError(streamer.PutStream(bucket1, testK1[0], bytes.NewReader(value)))
+		require.NoError(streamer.DeleteStream(bucket1, testK1[0]))
+		_, err = streamer.GetStream(bucket1, testK1[0])
+		require.Equal(ErrNotExist, errors.Cause(err))
+		require.Equal(1, records())
+		require.NoError(streamer.DeleteStream(bucket1, testK1[0]))
+		require.NoError(streamer.DeleteStream(bucket1, testK1[1]))
+		require.Equal(0, records())
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testStream(NewMemKVStore(), t)
+	})
+
+	dbCfg := cfg
+	path := "test-stream.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testStream(NewOnDiskDB(dbCfg), t)
+	})
+
+	path = "test-stream.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testStream(NewOnDiskDB(dbCfg), t)
+	})
+}
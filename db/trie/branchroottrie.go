@@ -12,9 +12,10 @@ import (
 	"sync"
 
 	"github.com/boltdb/bolt"
-	"github.com/dgraph-io/badger"
 	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/db"
 )
 
 type (
@@ -43,7 +44,7 @@ func (tr *branchRootTrie) Start(ctx context.Context) error {
 			tr.rootHash = root
 		case bolt.ErrBucketNotFound:
 			fallthrough
-		case badger.ErrKeyNotFound:
+		case db.ErrNotExist:
 			tr.rootHash = tr.emptyRootHash()
 		default:
 			return err
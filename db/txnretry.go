@@ -0,0 +1,66 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+)
+
+const (
+	// retryTxnBackoff is the longest wait before the first retry of a conflicting transaction
+	retryTxnBackoff = time.Millisecond
+	// retryTxnMaxBackoff is the longest wait before any retry of a conflicting transaction
+	retryTxnMaxBackoff = 100 * time.Millisecond
+)
+
+// RetryTxn calls fn within a read-write transaction of the KV store, and runs it again in a new transaction while it
+// fails with ErrTxnConflict, up to maxAttempts times in total. fn returns ErrTxnConflict itself when what it read is
+// stale, e.g. a compare-and-swap loop seeing a version other than the one expected, and a transaction BadgerDB rejects
+// for conflicting with another is retried alike. Each retry waits a random fraction of a backoff doubled from
+// retryTxnBackoff up to retryTxnMaxBackoff, so that the conflicting callers do not retry in lockstep. Once the attempts
+// are spent, ErrTxnRetryExhausted is returned with the last conflict in its message. Any other error of fn is returned
+// right away, and fn must be safe to run more than once, as only its last run is committed
+func RetryTxn(kvStore KVStore, maxAttempts int, fn func(Tx) error) error {
+	if maxAttempts <= 0 {
+		return errors.Wrapf(ErrInvalidDB, "invalid number of attempts %d", maxAttempts)
+	}
+	updater, ok := kvStore.(Updater)
+	if !ok {
+		return errors.Wrap(ErrInvalidDB, "KV store does not support transactions")
+	}
+	backoff := retryTxnBackoff
+	for attempt := 1; ; attempt++ {
+		err := updater.Update(fn)
+		if !isTxnConflict(err) {
+			return err
+		}
+		if attempt == maxAttempts {
+			return errors.Wrapf(ErrTxnRetryExhausted, "%d attempts, last conflict: %v", attempt, err)
+		}
+		time.Sleep(time.Duration(rand.Int63n(int64(backoff)) + 1))
+		if backoff *= 2; backoff > retryTxnMaxBackoff {
+			backoff = retryTxnMaxBackoff
+		}
+	}
+}
+
+//======================================
+// private functions
+//======================================
+
+// isTxnConflict returns true if the error indicates the transaction conflicts with another one
+func isTxnConflict(err error) bool {
+	switch errors.Cause(err) {
+	case ErrTxnConflict, badger.ErrConflict:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+// conflictingKVStore is a KV store whose transactions conflict the given number of times before they commit
+type conflictingKVStore struct {
+	KVStore
+	conflicts int
+}
+
+func (s *conflictingKVStore) Update(fn func(Tx) error) error {
+	return s.KVStore.(Updater).Update(func(tx Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if s.conflicts > 0 {
+			// the writes of fn are rolled back
+			s.conflicts--
+			return errors.Wrap(ErrTxnConflict, "conflicting commit")
+		}
+		return nil
+	})
+}
+
+func TestRetryTxn(t *testing.T) {
+	testRetry := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		require.NoError(kvStore.Put(bucket1, testK1[0], []byte{0}))
+		attempts := 0
+		increment := func(tx Tx) error {
+			attempts++
+			value, err := tx.Get(bucket1, testK1[0])
+			if err != nil {
+				return err
+			}
+			return tx.Put(bucket1, testK1[0], []byte{value[0] + 1})
+		}
+		store := &conflictingKVStore{KVStore: kvStore}
+
+		// the transaction is retried until it stops conflicting, and only the last run is committed
+		store.conflicts = 2
+		require.NoError(RetryTxn(store, 3, increment))
+		require.Equal(3, attempts)
+		value, err := kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal([]byte{1}, value)
+
+		// the attempts are spent, and nothing is committed
+		attempts = 0
+		store.conflicts = 5
+		err = RetryTxn(store, 3, increment)
+		require.Equal(ErrTxnRetryExhausted, errors.Cause(err))
+		require.Contains(err.Error(), "conflicting commit")
+		require.Equal(3, attempts)
+		value, err = kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal([]byte{1}, value)
+
+		// an error other than a conflict is not retried
+		attempts = 0
+		store.conflicts = 0
+		err = RetryTxn(store, 3, func(tx Tx) error {
+			attempts++
+			return errWriteFailed
+		})
+		require.Equal(errWriteFailed, errors.Cause(err))
+		require.Equal(1, attempts)
+		require.Equal(ErrInvalidDB, errors.Cause(RetryTxn(store, 0, increment)))
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		testRetry(NewMemKVStore(), t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-retry-txn.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testRetry(NewOnDiskDB(dbCfg), t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-retry-txn.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testRetry(NewOnDiskDB(dbCfg), t)
+	})
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger"
+
+	"github.com/iotexproject/iotex-core/logger"
+)
+
+// valueLogGCAttempts is the number of attempts in a row rewriting nothing after which a run of the value log GC stops
+const valueLogGCAttempts = 10
+
+type (
+	// ValueLogGCObserver is the interface of KV store which reports the runs of its value log GC, to tune the space
+	// reclaimed against the CPU and I/O spent rewriting
+	ValueLogGCObserver interface {
+		// Stats returns the statistics of the value log GC
+		Stats() ValueLogGCStats
+	}
+
+	// ValueLogGCStats is the statistics of the value log GC
+	ValueLogGCStats struct {
+		// Runs is the number of runs so far
+		Runs uint64
+		// Rewrites is the number of value log files rewritten so far
+		Rewrites uint64
+		// Reclaimed is the number of bytes the value logs shrank by in the runs so far
+		Reclaimed int64
+		// Last is the last run, zero if none has run yet
+		Last ValueLogGCRun
+	}
+
+	// ValueLogGCRun is a run of the value log GC
+	ValueLogGCRun struct {
+		// Time is when the run finished
+		Time time.Time
+		// Aggressive is whether the value logs exceeded the threshold of WithAggressiveValueLogGC
+		Aggressive bool
+		// Rewrites is the number of value log files rewritten, 0 if none has enough stale data
+		Rewrites int
+		// Reclaimed is the number of bytes the value logs shrank by
+		Reclaimed int64
+		// Err is the error the run failed with, if any
+		Err error
+	}
+
+	// valueLogGC keeps the statistics of the value log GC
+	valueLogGC struct {
+		mutex sync.Mutex
+		stats ValueLogGCStats
+	}
+)
+
+// Stats returns the statistics of the value log GC of WithValueLogGC
+func (b *badgerDB) Stats() ValueLogGCStats {
+	b.gc.mutex.Lock()
+	defer b.gc.mutex.Unlock()
+
+	return b.gc.stats
+}
+
+//======================================
+// private functions
+//======================================
+
+// scheduleValueLogGC runs the value log GC of db every interval until the DB is stopped. The mutex of the DB is not
+// locked, since Stop holds it while waiting for the GC to return
+func (b *badgerDB) scheduleValueLogGC(db *badger.DB, interval time.Duration) {
+	defer b.wg.Done()
+
+	ticker := b.options.clk.Ticker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			b.runValueLogGC(db)
+		}
+	}
+}
+
+// runValueLogGC rewrites a value log file of db with enough stale data, or keeps rewriting them in aggressive mode,
+// and records the run. It gives up after valueLogGCAttempts attempts in a row rewrite nothing
+func (b *badgerDB) runValueLogGC(db *badger.DB) {
+	before := valueLogSize(b.path)
+	run := ValueLogGCRun{}
+	ratio := b.options.valueLogGCRatio
+	if threshold := b.options.aggressiveGCThreshold; threshold > 0 && before > threshold {
+		run.Aggressive = true
+		ratio = b.options.aggressiveGCRatio
+	}
+	for misses := 0; ; {
+		err := db.RunValueLogGC(ratio)
+		if err == badger.ErrNoRewrite {
+			// BadgerDB picks the file and where to sample it at random, so a miss does not mean no file is stale
+			if misses++; misses < valueLogGCAttempts {
+				continue
+			}
+			break
+		}
+		if err != nil {
+			logger.Error().Err(err).Str("path", b.path).Msg("Failed to run the value log GC of BadgerDB.")
+			run.Err = err
+			break
+		}
+		run.Rewrites++
+		if !run.Aggressive || valueLogSize(b.path) <= b.options.aggressiveGCThreshold {
+			break
+		}
+	}
+	if reclaimed := before - valueLogSize(b.path); reclaimed > 0 {
+		run.Reclaimed = reclaimed
+	}
+	run.Time = b.options.clk.Now()
+
+	b.gc.mutex.Lock()
+	defer b.gc.mutex.Unlock()
+
+	b.gc.stats.Runs++
+	b.gc.stats.Rewrites += uint64(run.Rewrites)
+	b.gc.stats.Reclaimed += run.Reclaimed
+	b.gc.stats.Last = run
+}
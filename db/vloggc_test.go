@@ -0,0 +1,76 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/facebookgo/clock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestBadgerValueLogGC(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	path := "test-value-log-gc.badger"
+	dbCfg := cfg
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+
+	const fileSize = 1 << 20
+	clk := clock.NewMock()
+	// the memtables are flushed many times over the writes, so that the tables are compacted while the test runs
+	kvStore := NewOnDiskDB(dbCfg, WithClock(clk), WithValueLogFileSize(fileSize), WithMemTableSize(fileSize/16),
+		WithValueLogGC(time.Minute, 0.99), WithAggressiveValueLogGC(2*fileSize, 0.5))
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	observer := kvStore.(ValueLogGCObserver)
+	require.Equal(ValueLogGCStats{}, observer.Stats())
+
+	// fill several value log files, and delete all the records
+	value := make([]byte, 1024)
+	keys := make([][]byte, 8*fileSize/len(value))
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key_%06d", i))
+		batch := NewBatch()
+		batch.Put(bucket1, keys[i], value, "")
+		require.NoError(kvStore.Commit(batch))
+	}
+	for _, key := range keys {
+		require.NoError(kvStore.Delete(bucket1, key))
+	}
+	before := valueLogSize(path)
+	require.True(before > 4*fileSize)
+
+	// the value logs exceed the threshold, so the GC keeps rewriting the stale files, once a compaction has dropped the
+	// versions deleted
+	require.NoError(testutil.WaitUntil(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		// the ticks of the mock clock are dropped unless the GC is waiting for them, so tick until it has reclaimed
+		clk.Add(time.Minute)
+		return observer.Stats().Reclaimed > 2*fileSize, nil
+	}))
+	stats := observer.Stats()
+	require.True(stats.Runs > 0)
+	require.NoError(stats.Last.Err)
+	require.False(stats.Last.Time.IsZero())
+	require.True(stats.Rewrites > 2)
+	require.True(valueLogSize(path) < before-2*fileSize)
+	for _, key := range keys[:10] {
+		_, err := kvStore.Get(bucket1, key)
+		require.Error(err)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"hash/crc32"
+
+	"github.com/boltdb/bolt"
+	"github.com/dgraph-io/badger"
+	"github.com/pkg/errors"
+)
+
+// warmupCheckInterval is the number of records read between two checks of whether warmup is canceled
+const warmupCheckInterval = 1024
+
+// Warmup walks the buckets of the namespaces to pull their pages into the OS page cache. The keys and small values
+// share the leaf pages, so withValues only makes a difference for values spanning overflow pages. Writes wait for
+// Warmup to finish
+func (b *boltDB) Warmup(ctx context.Context, namespaces []string, withValues bool) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	return b.db.View(func(tx *bolt.Tx) error {
+		for _, namespace := range namespaces {
+			bucket := tx.Bucket([]byte(namespace))
+			if bucket == nil {
+				continue
+			}
+			n := 0
+			c := bucket.Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				if withValues {
+					touch(v)
+				}
+				if n++; n%warmupCheckInterval == 0 && ctx.Err() != nil {
+					return ctx.Err()
+				}
+			}
+		}
+		return ctx.Err()
+	})
+}
+
+// Warmup iterates the keys of the namespaces to pull the LSM tables into the OS page cache, and reads the values as
+// well from the value log if withValues is set. Writes wait for Warmup to finish
+func (b *badgerDB) Warmup(ctx context.Context, namespaces []string, withValues bool) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.db == nil {
+		return ErrDBClosed
+	}
+
+	return b.db.View(func(txn *badger.Txn) error {
+		for _, namespace := range namespaces {
+			if err := warmupBadgerNamespace(ctx, txn, namespace, withValues); err != nil {
+				return err
+			}
+		}
+		return ctx.Err()
+	})
+}
+
+// Warmup warms up the underlying KV store if it is a Warmer, and then reads the records of the namespaces into
+// the cache until it is full. The cache always holds the values, so withValues only applies to the underlying KV
+// store. The underlying KV store must be a KeyPager to list the records of the namespaces
+func (c *cachedKVStore) Warmup(ctx context.Context, namespaces []string, withValues bool) error {
+	if warmer, ok := c.kvStore.(Warmer); ok {
+		if err := warmer.Warmup(ctx, namespaces, withValues); err != nil {
+			return err
+		}
+	}
+	pager, ok := c.kvStore.(KeyPager)
+	if !ok {
+		return errors.Wrap(ErrInvalidDB, "underlying KV store is not a KeyPager")
+	}
+	for _, namespace := range namespaces {
+		var after []byte
+		for {
+			keys, cursor, err := pager.KeysPaged(namespace, after, warmupCheckInterval)
+			if err != nil {
+				return err
+			}
+			for _, key := range keys {
+				if c.full() {
+					return nil
+				}
+				// Get fills the cache without racing with the writes in flight
+				if _, err := c.Get(namespace, key); err != nil && !isNotExist(err) {
+					return err
+				}
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if cursor == nil {
+				break
+			}
+			after = cursor
+		}
+	}
+	return nil
+}
+
+//======================================
+// private functions
+//======================================
+
+// full returns whether the cache is full
+func (c *cachedKVStore) full() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lru.Len() >= c.size
+}
+
+// warmupBadgerNamespace iterates the keys of the namespace, and reads their values if withValues is set
+func warmupBadgerNamespace(ctx context.Context, txn *badger.Txn, namespace string, withValues bool) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	prefix := []byte(namespace)
+	n := 0
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		if withValues {
+			value, err := it.Item().Value()
+			if err != nil {
+				return errors.Wrapf(err, "failed to get value from key = %x", it.Item().Key())
+			}
+			touch(value)
+		}
+		if n++; n%warmupCheckInterval == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// touch reads every byte of the data, so the pages it is mapped from are loaded
+func touch(data []byte) uint32 {
+	return crc32.ChecksumIEEE(data)
+}
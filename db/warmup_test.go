@@ -0,0 +1,156 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestWarmup(t *testing.T) {
+	testWarmup := func(kvStore KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		require.NoError(kvStore.Start(ctx))
+		batch := NewBatch()
+		for i := 0; i < 3000; i++ {
+			batch.Put(bucket1, []byte(fmt.Sprintf("key_%04d", i)), make([]byte, 1024), "")
+		}
+		require.NoError(kvStore.Commit(batch))
+
+		warmer, ok := kvStore.(Warmer)
+		require.True(ok)
+		for _, withValues := range []bool{false, true} {
+			// a missing namespace is skipped
+			require.NoError(warmer.Warmup(ctx, []string{bucket1, bucket2}, withValues))
+		}
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		require.Equal(context.Canceled, errors.Cause(warmer.Warmup(canceled, []string{bucket1}, true)))
+
+		require.NoError(kvStore.Stop(ctx))
+		require.Equal(ErrDBClosed, errors.Cause(warmer.Warmup(ctx, []string{bucket1}, true)))
+	}
+
+	dbCfg := cfg
+	path := "test-warmup.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	t.Run("Bolt DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testWarmup(NewOnDiskDB(dbCfg), t)
+	})
+
+	path = "test-warmup.badger"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = true
+	t.Run("Badger DB", func(t *testing.T) {
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		testWarmup(NewOnDiskDB(dbCfg), t)
+	})
+}
+
+func TestCachedKVStoreWarmup(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	dbCfg := cfg
+	path := "test-cached-warmup.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	testutil.CleanupPath(t, path)
+	defer testutil.CleanupPath(t, path)
+
+	kvStore := NewCachedKVStore(NewOnDiskDB(dbCfg), 10)
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	var keys [][]byte
+	for i := 0; i < 20; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key_%02d", i)))
+		require.NoError(kvStore.Put(bucket1, keys[i], keys[i]))
+	}
+
+	// a canceled warmup leaves the cache as is
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.Equal(context.Canceled, errors.Cause(kvStore.(Warmer).Warmup(canceled, []string{bucket1}, false)))
+	require.Equal(0, kvStore.Stats().Size)
+
+	// warmup fills the cache until it is full, and the reads of the records warmed up hit the cache
+	require.NoError(kvStore.(Warmer).Warmup(ctx, []string{bucket1}, false))
+	stats := kvStore.Stats()
+	require.Equal(10, stats.Size)
+	require.Equal(uint64(0), stats.Evictions)
+	for _, key := range keys[:10] {
+		value, err := kvStore.Get(bucket1, key)
+		require.NoError(err)
+		require.Equal(key, value)
+	}
+	require.Equal(stats.Hits+10, kvStore.Stats().Hits)
+}
+
+func BenchmarkCachedKVStoreWarmup(b *testing.B) {
+	require := require.New(b)
+	ctx := context.Background()
+	dbCfg := cfg
+	path := "bench-cached-warmup.bolt"
+	dbCfg.DbPath = path
+	dbCfg.UseBadgerDB = false
+	require.NoError(os.RemoveAll(path))
+	defer func() {
+		require.NoError(os.RemoveAll(path))
+	}()
+
+	kvStore := NewCachedKVStore(NewOnDiskDB(dbCfg), 1000)
+	require.NoError(kvStore.Start(ctx))
+	var keys [][]byte
+	batch := NewBatch()
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key_%04d", i)))
+		batch.Put(bucket1, keys[i], make([]byte, 1024), "")
+	}
+	require.NoError(kvStore.Commit(batch))
+	require.NoError(kvStore.Stop(ctx))
+
+	for _, warm := range []bool{false, true} {
+		name := "Cold"
+		if warm {
+			name = "Warmed"
+		}
+		b.Run(name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				// restarting purges the cache
+				b.StopTimer()
+				require.NoError(kvStore.Start(ctx))
+				if warm {
+					require.NoError(kvStore.(Warmer).Warmup(ctx, []string{bucket1}, true))
+				}
+				b.StartTimer()
+				for _, key := range keys {
+					if _, err := kvStore.Get(bucket1, key); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.StopTimer()
+				require.NoError(kvStore.Stop(ctx))
+				b.StartTimer()
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const defaultWatchBufferSize = 256
+
+// watchNamespace is the namespace keeping the sequence of the last commit made through the watchable KV store
+const watchNamespace = "watchSequence"
+
+// watchSequenceKey is the key of the sequence in watchNamespace
+var watchSequenceKey = []byte("sequence")
+
+type (
+	// KVEvent is a change of a record made by a committed write. Key and Value are shared by all subscribers, and
+	// must not be modified
+	KVEvent struct {
+		// Sequence is the sequence of the commit, which increases by 1 for every commit. Events of the same commit
+		// share the sequence, and are delivered in the order the batch is staged
+		Sequence uint64
+		// Type is either Put or Delete
+		Type int32
+		// Namespace is the namespace of the record
+		Namespace string
+		// Key is the key of the record
+		Key []byte
+		// Value is the new value of the record, nil for Delete
+		Value []byte
+		// Gap indicates some events prior to this one are dropped since the subscriber fell behind
+		Gap bool
+	}
+
+	// WatchOption sets an option of a subscription to the change feed
+	WatchOption func(*watchOptions)
+
+	watchOptions struct {
+		ordered    bool
+		bufferSize int
+	}
+
+	// WatchableKVStore is a KV store which publishes the committed writes to subscribers
+	WatchableKVStore interface {
+		KVStore
+		// Watch subscribes to the changes of the namespace, or of all namespaces if it is empty. It returns the
+		// channel of events and a function to cancel the subscription, which closes the channel
+		Watch(string, ...WatchOption) (<-chan KVEvent, func())
+		// CurrentSequence returns the sequence of the last commit, 0 if none is made. The sequence is kept in the KV
+		// store along with each commit, so it carries on from where it is after a restart rather than from 0
+		CurrentSequence() uint64
+	}
+
+	// watchableKVStore implements WatchableKVStore on top of a KV store
+	watchableKVStore struct {
+		KVStore
+		// mutex serializes the writes, so that sequences are assigned in commit order
+		mutex       sync.Mutex
+		sequence    uint64
+		subsMutex   sync.RWMutex
+		subscribers map[*subscriber]struct{}
+	}
+
+	// subscriber is a subscription to the change feed
+	subscriber struct {
+		namespace string
+		options   watchOptions
+		ch        chan KVEvent
+		done      chan struct{}
+		// gapMutex guards gap, since unordered publishes of concurrent writes run concurrently
+		gapMutex sync.Mutex
+		gap      bool
+	}
+)
+
+// WithOrderedDelivery makes the subscriber receive the events in commit order, even if the writes are made by
+// multiple goroutines. An ordered subscriber applies backpressure: once its buffer is full, writes to the KV store
+// block until it catches up, so it must keep consuming events until the subscription is canceled. An unordered
+// subscriber never blocks writes; the events that do not fit its buffer are dropped, the next delivered event is
+// marked with Gap, and events of concurrent commits may be delivered out of sequence order
+func WithOrderedDelivery() WatchOption {
+	return func(opts *watchOptions) {
+		opts.ordered = true
+	}
+}
+
+// WithWatchBufferSize sets the number of events buffered for the subscriber
+func WithWatchBufferSize(size int) WatchOption {
+	return func(opts *watchOptions) {
+		opts.bufferSize = size
+	}
+}
+
+// NewWatchableKVStore wraps the KV store to publish the committed writes made through it. The sequence of the last
+// commit is kept in a reserved namespace "watchSequence" of the KV store, written in the same commit as the writes
+func NewWatchableKVStore(kvStore KVStore) WatchableKVStore {
+	return &watchableKVStore{
+		KVStore:     kvStore,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// Start starts the underlying KV store, and resumes the sequence of the last commit kept in it
+func (w *watchableKVStore) Start(ctx context.Context) error {
+	if err := w.KVStore.Start(ctx); err != nil {
+		return err
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := createReservedNamespace(w.KVStore, watchNamespace); err != nil {
+		return err
+	}
+	w.sequence = 0
+	value, err := w.KVStore.Get(watchNamespace, watchSequenceKey)
+	if isNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to get sequence of the change feed")
+	}
+	if len(value) != 8 {
+		return errors.Wrap(ErrInvalidDB, "malformed sequence of the change feed")
+	}
+	w.sequence = binary.BigEndian.Uint64(value)
+	return nil
+}
+
+// Put inserts a <key, value> record
+func (w *watchableKVStore) Put(namespace string, key, value []byte) error {
+	return w.write([]writeInfo{{writeType: Put, namespace: namespace, key: key, value: value}},
+		[]KVEvent{{Type: Put, Namespace: namespace, Key: key, Value: value}})
+}
+
+// PutIfNotExists inserts a <key, value> record only if it does not exist yet, otherwise return ErrAlreadyExist
+func (w *watchableKVStore) PutIfNotExists(namespace string, key, value []byte) error {
+	return w.write([]writeInfo{{writeType: PutIfNotExists, namespace: namespace, key: key, value: value}},
+		[]KVEvent{{Type: Put, Namespace: namespace, Key: key, Value: value}})
+}
+
+// Delete deletes a record
+func (w *watchableKVStore) Delete(namespace string, key []byte) error {
+	return w.write([]writeInfo{{writeType: Delete, namespace: namespace, key: key}},
+		[]KVEvent{{Type: Delete, Namespace: namespace, Key: key}})
+}
+
+// Commit commits a batch, and publishes an event for each entry of the batch
+func (w *watchableKVStore) Commit(b KVStoreBatch) error {
+	succeed := false
+	b.Lock()
+	defer func() {
+		if succeed {
+			// clear the batch if commit succeeds
+			b.ClearAndUnlock()
+		} else {
+			b.Unlock()
+		}
+	}()
+
+	if b.committed() {
+		return ErrBatchAlreadyCommitted
+	}
+	entries := make([]writeInfo, b.Size(), b.Size()+1)
+	events := make([]KVEvent, 0, b.Size())
+	for i := range entries {
+		write, err := b.Entry(i)
+		if err != nil {
+			return err
+		}
+		if write.writeType == AddCounter {
+			// the value of the event is not known before the commit
+			return errors.Wrap(ErrInvalidDB, "counters are not supported by the watchable KV store")
+		}
+		entries[i] = *write
+		event := KVEvent{Type: Put, Namespace: write.namespace, Key: write.key, Value: write.value}
+		if write.writeType == Delete {
+			event.Type = Delete
+			event.Value = nil
+		}
+		events = append(events, event)
+	}
+	if err := w.write(entries, events); err != nil {
+		return err
+	}
+	succeed = true
+	return nil
+}
+
+// CurrentSequence returns the sequence of the last commit
+func (w *watchableKVStore) CurrentSequence() uint64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.sequence
+}
+
+// Watch subscribes to the changes of the namespace
+func (w *watchableKVStore) Watch(namespace string, opts ...WatchOption) (<-chan KVEvent, func()) {
+	options := watchOptions{bufferSize: defaultWatchBufferSize}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	sub := &subscriber{
+		namespace: namespace,
+		options:   options,
+		ch:        make(chan KVEvent, options.bufferSize),
+		done:      make(chan struct{}),
+	}
+	w.subsMutex.Lock()
+	w.subscribers[sub] = struct{}{}
+	w.subsMutex.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			// unblock the publisher first, which holds subsMutex while sending
+			close(sub.done)
+			w.subsMutex.Lock()
+			delete(w.subscribers, sub)
+			close(sub.ch)
+			w.subsMutex.Unlock()
+		})
+	}
+}
+
+//======================================
+// private functions
+//======================================
+
+// write commits the entries along with the sequence of the commit, and publishes its events upon success
+func (w *watchableKVStore) write(entries []writeInfo, events []KVEvent) error {
+	w.mutex.Lock()
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, w.sequence+1)
+	entries = append(entries, writeInfo{writeType: Put, namespace: watchNamespace, key: watchSequenceKey, value: value})
+	if err := w.KVStore.Commit(newBatchOf(entries)); err != nil {
+		w.mutex.Unlock()
+		return err
+	}
+	w.sequence++
+	for i := range events {
+		events[i].Sequence = w.sequence
+		// the caller may reuse the slices after the write returns
+		events[i].Key = copyBytes(events[i].Key)
+		events[i].Value = copyBytes(events[i].Value)
+	}
+	// ordered subscribers are published to before the next write is assigned a sequence
+	w.publish(events, true)
+	w.mutex.Unlock()
+
+	w.publish(events, false)
+	return nil
+}
+
+// publish sends the events to the ordered or unordered subscribers
+func (w *watchableKVStore) publish(events []KVEvent, ordered bool) {
+	w.subsMutex.RLock()
+	defer w.subsMutex.RUnlock()
+
+	for sub := range w.subscribers {
+		if sub.options.ordered != ordered {
+			continue
+		}
+		for _, event := range events {
+			if sub.namespace != "" && sub.namespace != event.Namespace {
+				continue
+			}
+			if ordered {
+				select {
+				case sub.ch <- event:
+				case <-sub.done:
+				}
+				continue
+			}
+			sub.sendOrDrop(event)
+		}
+	}
+}
+
+// sendOrDrop sends the event to an unordered subscriber without blocking, or drops it if the buffer is full
+func (sub *subscriber) sendOrDrop(event KVEvent) {
+	sub.gapMutex.Lock()
+	defer sub.gapMutex.Unlock()
+
+	event.Gap = sub.gap
+	select {
+	case sub.ch <- event:
+		sub.gap = false
+	default:
+		sub.gap = true
+	}
+}
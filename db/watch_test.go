@@ -0,0 +1,171 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestWatchOrdered(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	kvStore := NewWatchableKVStore(NewMemKVStore())
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	// a small buffer makes the committers block on the subscriber
+	events, cancel := kvStore.Watch("", WithOrderedDelivery(), WithWatchBufferSize(4))
+	defer cancel()
+
+	// two goroutines commit interleaved batches of 3 entries
+	const commits = 100
+	var wg sync.WaitGroup
+	for g := 0; g < 2; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < commits; i++ {
+				batch := NewBatch()
+				for j := 0; j < 3; j++ {
+					batch.Put(bucket1, []byte(fmt.Sprintf("%d-%d-%d", g, i, j)), []byte{byte(j)}, "")
+				}
+				require.NoError(kvStore.Commit(batch))
+			}
+		}(g)
+	}
+
+	next := make(map[int]int)
+	for seq := uint64(1); seq <= 2*commits; seq++ {
+		var g, i int
+		for j := 0; j < 3; j++ {
+			event := <-events
+			require.Equal(seq, event.Sequence)
+			require.False(event.Gap)
+			require.Equal(Put, event.Type)
+			var n, k int
+			_, err := fmt.Sscanf(string(event.Key), "%d-%d-%d", &g, &n, &k)
+			require.NoError(err)
+			if j == 0 {
+				i = n
+			}
+			// the events of a commit are delivered together, in the order the batch is staged
+			require.Equal(i, n)
+			require.Equal(j, k)
+		}
+		// each goroutine's commits are delivered in the order they are made
+		require.Equal(next[g], i)
+		next[g]++
+	}
+	wg.Wait()
+}
+
+func TestWatchUnordered(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	kvStore := NewWatchableKVStore(NewMemKVStore())
+	require.NoError(kvStore.Start(ctx))
+	defer func() {
+		require.NoError(kvStore.Stop(ctx))
+	}()
+	events, cancel := kvStore.Watch(bucket1, WithWatchBufferSize(2))
+
+	// events of other namespaces are filtered out, and failed writes are not published
+	require.NoError(kvStore.Put(bucket2, testK2[0], testV2[0]))
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+	require.Error(kvStore.PutIfNotExists(bucket1, testK1[0], testV1[1]))
+	require.NoError(kvStore.Delete(bucket1, testK1[0]))
+	// the buffer is full, the writes still succeed and the events are dropped
+	require.NoError(kvStore.Put(bucket1, testK1[1], testV1[1]))
+	require.NoError(kvStore.Put(bucket1, testK1[2], testV1[2]))
+
+	event := <-events
+	require.Equal(KVEvent{Sequence: 2, Type: Put, Namespace: bucket1, Key: testK1[0], Value: testV1[0]}, event)
+	event = <-events
+	require.Equal(KVEvent{Sequence: 3, Type: Delete, Namespace: bucket1, Key: testK1[0]}, event)
+	// the next event after the dropped ones is marked with the gap
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[2]))
+	event = <-events
+	require.Equal(KVEvent{Sequence: 6, Type: Put, Namespace: bucket1, Key: testK1[0], Value: testV1[2], Gap: true}, event)
+
+	cancel()
+	_, ok := <-events
+	require.False(ok)
+	require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+}
+
+func TestWatchSequenceAcrossRestarts(t *testing.T) {
+	testWatchSequence := func(newKVStore func() KVStore, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+
+		kvStore := NewWatchableKVStore(newKVStore())
+		require.NoError(kvStore.Start(ctx))
+		require.Equal(uint64(0), kvStore.CurrentSequence())
+		for i := 0; i < 3; i++ {
+			batch := NewBatch()
+			require.NoError(batch.Put(bucket1, testK1[i], testV1[i], ""))
+			require.NoError(kvStore.Commit(batch))
+		}
+		// a failed write is not assigned a sequence
+		require.Error(kvStore.PutIfNotExists(bucket1, testK1[0], testV1[1]))
+		require.Equal(uint64(3), kvStore.CurrentSequence())
+		require.NoError(kvStore.Stop(ctx))
+
+		// the sequence carries on from where it is before the restart
+		kvStore = NewWatchableKVStore(newKVStore())
+		require.NoError(kvStore.Start(ctx))
+		defer func() {
+			require.NoError(kvStore.Stop(ctx))
+		}()
+		require.Equal(uint64(3), kvStore.CurrentSequence())
+		events, cancel := kvStore.Watch("", WithOrderedDelivery())
+		defer cancel()
+		require.NoError(kvStore.Delete(bucket1, testK1[0]))
+		require.NoError(kvStore.Put(bucket2, testK2[0], testV2[0]))
+		require.Equal(KVEvent{Sequence: 4, Type: Delete, Namespace: bucket1, Key: testK1[0]}, <-events)
+		require.Equal(KVEvent{Sequence: 5, Type: Put, Namespace: bucket2, Key: testK2[0], Value: testV2[0]}, <-events)
+		require.Equal(uint64(5), kvStore.CurrentSequence())
+
+		// the records written before the restart are kept
+		value, err := kvStore.Get(bucket1, testK1[2])
+		require.NoError(err)
+		require.Equal(testV1[2], value)
+	}
+
+	t.Run("In-memory KV Store", func(t *testing.T) {
+		// the in-memory KV store keeps its records across a restart of the same instance
+		kvStore := NewMemKVStore()
+		testWatchSequence(func() KVStore { return kvStore }, t)
+	})
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-watch-sequence.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testWatchSequence(func() KVStore { return NewOnDiskDB(dbCfg, WithExplicitNamespaces(bucket1, bucket2)) }, t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-watch-sequence.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testWatchSequence(func() KVStore { return NewOnDiskDB(dbCfg) }, t)
+	})
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/iotexproject/iotex-core/logger"
+)
+
+type (
+	// writerLock is the lock file of a DB held by the process writing it, which is flocked as long as the DB is open
+	// and names the process
+	writerLock struct {
+		file *os.File
+		path string
+	}
+
+	// lockOwner is the process named by a lock file
+	lockOwner struct {
+		pid      int
+		hostname string
+		since    time.Time
+	}
+)
+
+// acquireWriterLock locks the lock file of the DB at path, which is the path followed by ".lock", in mode
+// WithWriterLock, or returns nil otherwise. It fails with ErrDBLocked naming the owner if another process holds the
+// lock, or if the lock file names a process of this host which is not running anymore, unless in mode
+// WithStaleLockRecovery, in which case the lock is taken over
+func acquireWriterLock(path string, options kvStoreOptions) (*writerLock, error) {
+	if !options.writerLock {
+		return nil, nil
+	}
+	lockPath := path + ".lock"
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the hostname")
+	}
+	for {
+		file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, fileMode)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open lock file %s", lockPath)
+		}
+		if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			owner, _ := readLockOwner(file)
+			file.Close()
+			if err == syscall.EWOULDBLOCK {
+				return nil, errors.Wrapf(ErrDBLocked, "DB %s is locked by %s", path, owner)
+			}
+			return nil, errors.Wrapf(err, "failed to lock lock file %s", lockPath)
+		}
+		// the lock file may be removed by the owner releasing it between the open and the flock, in which case the
+		// lock of the removed file is worthless
+		if !isSameFile(file, lockPath) {
+			file.Close()
+			continue
+		}
+
+		// the lock file is left behind by an owner which did not release it, a lock file not naming an owner is left
+		// by one which failed to write it
+		if owner, ok := readLockOwner(file); ok {
+			if owner.hostname != hostname || isProcessAlive(owner.pid) {
+				file.Close()
+				return nil, errors.Wrapf(ErrDBLocked, "DB %s is locked by %s, which may still be writing it", path, owner)
+			}
+			if !options.staleLockRecovery {
+				file.Close()
+				return nil, errors.Wrapf(
+					ErrDBLocked,
+					"DB %s is locked by %s, which is not running, the stale lock file %s is recovered in mode "+
+						"WithStaleLockRecovery",
+					path,
+					owner,
+					lockPath,
+				)
+			}
+			logger.Warn().
+				Str("path", path).
+				Int("pid", owner.pid).
+				Time("since", owner.since).
+				Msg("Recovering the stale lock of the DB left by a process not running.")
+		}
+		owner := lockOwner{pid: os.Getpid(), hostname: hostname, since: time.Now()}
+		if err := writeLockOwner(file, owner); err != nil {
+			file.Close()
+			return nil, errors.Wrapf(err, "failed to write lock file %s", lockPath)
+		}
+		return &writerLock{file: file, path: lockPath}, nil
+	}
+}
+
+// release removes the lock file and unlocks it, in this order, so that another process never locks the file removed
+func (l *writerLock) release() {
+	if l == nil {
+		return
+	}
+	if err := os.Remove(l.path); err != nil {
+		logger.Error().Err(err).Str("path", l.path).Msg("Failed to remove the lock file of the DB.")
+	}
+	if err := l.file.Close(); err != nil {
+		logger.Error().Err(err).Str("path", l.path).Msg("Failed to close the lock file of the DB.")
+	}
+}
+
+// String returns the owner as it is named in an error
+func (o lockOwner) String() string {
+	if o.pid == 0 {
+		return "an unknown process"
+	}
+	return fmt.Sprintf("process %d on host %s since %s", o.pid, o.hostname, o.since.Format(time.RFC3339))
+}
+
+//======================================
+// private functions
+//======================================
+
+// readLockOwner reads the owner named by the lock file, as its PID, hostname and the Unix time it took the lock at,
+// one per line, or returns false if the file names none
+func readLockOwner(file *os.File) (lockOwner, bool) {
+	if _, err := file.Seek(0, 0); err != nil {
+		return lockOwner{}, false
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return lockOwner{}, false
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		return lockOwner{}, false
+	}
+	pid, err := strconv.Atoi(lines[0])
+	if err != nil || pid <= 0 {
+		return lockOwner{}, false
+	}
+	since, err := strconv.ParseInt(lines[2], 10, 64)
+	if err != nil {
+		return lockOwner{}, false
+	}
+	return lockOwner{pid: pid, hostname: lines[1], since: time.Unix(since, 0)}, true
+}
+
+// writeLockOwner replaces the content of the lock file by the owner, and fsyncs it
+func writeLockOwner(file *os.File, owner lockOwner) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	content := fmt.Sprintf("%d\n%s\n%d\n", owner.pid, owner.hostname, owner.since.Unix())
+	if _, err := file.WriteAt([]byte(content), 0); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// isSameFile returns true if the path is the file open
+func isSameFile(file *os.File, path string) bool {
+	opened, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(opened, current)
+}
+
+// isProcessAlive returns true if the process of the PID is running, including one of another user
+func isProcessAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2018 IoTeX
+// This is an alpha (internal) release and is not suitable for production. This source code is provided 'as is' and no
+// warranties are given as to title or non-infringement, merchantability or fitness for purpose and, to the extent
+// permitted by law, all liability for your use of the code is disclaimed. This source code is governed by Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iotexproject/iotex-core/testutil"
+)
+
+func TestWriterLock(t *testing.T) {
+	testWriterLock := func(newKVStore func(...KVStoreOption) KVStore, path string, t *testing.T) {
+		require := require.New(t)
+		ctx := context.Background()
+		lockPath := path + ".lock"
+		hostname, err := os.Hostname()
+		require.NoError(err)
+		writeLock := func(pid int, hostname string) {
+			content := fmt.Sprintf("%d\n%s\n%d\n", pid, hostname, time.Now().Unix())
+			require.NoError(ioutil.WriteFile(lockPath, []byte(content), fileMode))
+		}
+
+		// a second writer fails at once, with an error naming the owner
+		kvStore := newKVStore(WithWriterLock())
+		require.NoError(kvStore.Start(ctx))
+		require.NoError(kvStore.Put(bucket1, testK1[0], testV1[0]))
+		second := newKVStore(WithStaleLockRecovery())
+		err = second.Start(ctx)
+		require.Equal(ErrDBLocked, errors.Cause(err))
+		require.Contains(err.Error(), fmt.Sprintf("process %d on host %s", os.Getpid(), hostname))
+		require.NoError(kvStore.Stop(ctx))
+		_, err = os.Stat(lockPath)
+		require.True(os.IsNotExist(err))
+		require.NoError(second.Start(ctx))
+		require.NoError(second.Stop(ctx))
+
+		// a lock left by a process not running anymore is stale
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		require.NoError(cmd.Run())
+		writeLock(cmd.Process.Pid, hostname)
+		kvStore = newKVStore(WithWriterLock())
+		err = kvStore.Start(ctx)
+		require.Equal(ErrDBLocked, errors.Cause(err))
+		require.Contains(err.Error(), fmt.Sprintf("process %d on host %s", cmd.Process.Pid, hostname))
+		require.Contains(err.Error(), "not running")
+
+		// and is recovered in mode WithStaleLockRecovery
+		kvStore = newKVStore(WithStaleLockRecovery())
+		require.NoError(kvStore.Start(ctx))
+		value, err := kvStore.Get(bucket1, testK1[0])
+		require.NoError(err)
+		require.Equal(testV1[0], value)
+		content, err := ioutil.ReadFile(lockPath)
+		require.NoError(err)
+		require.Contains(string(content), fmt.Sprintf("%d\n%s\n", os.Getpid(), hostname))
+		require.NoError(kvStore.Stop(ctx))
+
+		// a lock of another host is never recovered, nor one of a process running
+		for _, owner := range []struct {
+			pid      int
+			hostname string
+		}{
+			{cmd.Process.Pid, hostname + "-other"},
+			{os.Getppid(), hostname},
+		} {
+			writeLock(owner.pid, owner.hostname)
+			kvStore = newKVStore(WithStaleLockRecovery())
+			require.Equal(ErrDBLocked, errors.Cause(kvStore.Start(ctx)))
+		}
+		require.NoError(os.Remove(lockPath))
+	}
+
+	dbCfg := cfg
+	t.Run("Bolt DB", func(t *testing.T) {
+		path := "test-writer-lock.bolt"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = false
+		testWriterLock(func(opts ...KVStoreOption) KVStore { return NewOnDiskDB(dbCfg, opts...) }, path, t)
+	})
+	t.Run("Badger DB", func(t *testing.T) {
+		path := "test-writer-lock.badger"
+		testutil.CleanupPath(t, path)
+		defer testutil.CleanupPath(t, path)
+		dbCfg.DbPath = path
+		dbCfg.UseBadgerDB = true
+		testWriterLock(func(opts ...KVStoreOption) KVStore { return NewOnDiskDB(dbCfg, opts...) }, path, t)
+	})
+}